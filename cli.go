@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of the CLI. it either runs or groups further subcommands, e.g.
+// "user create".
+type command struct {
+	name        string
+	usage       string // the arguments after the command name, for the help
+	summary     string
+	setup       func(flags *flag.FlagSet) func(args []string) error
+	subcommands []*command
+}
+
+// errUsage reports a command line the help was printed for
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	root := &command{
+		name:    "mediasysbackend",
+		summary: "Media library server. runs the server when no command is given.",
+		subcommands: []*command{
+			serveCommand,
+			scanCommand,
+			userCommand,
+			reindexCommand,
+			cleanupCommand,
+			exportCommand,
+			importCommand,
+			backupCommand,
+		},
+	}
+
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{serveCommand.name}
+	}
+	if err := root.execute(root.name, args); err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+}
+
+// execute runs the subcommand named by args[0], or this command with its flags parsed from args
+func (c *command) execute(path string, args []string) error {
+	if len(c.subcommands) > 0 {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			c.printHelp(path)
+			if len(args) == 0 {
+				return errUsage
+			}
+			return flag.ErrHelp
+		}
+		for _, sub := range c.subcommands {
+			if sub.name == args[0] {
+				return sub.execute(path+" "+sub.name, args[1:])
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		c.printHelp(path)
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet(path, flag.ContinueOnError)
+	run := c.setup(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] %s\n\n%s\n", path, c.usage, c.summary)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return run(flags.Args())
+}
+
+func (c *command) printHelp(path string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\n%s\n\nCommands:\n", path, c.summary)
+	for _, sub := range c.subcommands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", sub.name, sub.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", path)
+}
+
+// noArgs wraps a command that takes no positional arguments
+func noArgs(run func() error) func(args []string) error {
+	return func(args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+		}
+		return run()
+	}
+}
+
+var serveCommand = &command{
+	name:    "serve",
+	summary: "Runs the HTTP server, the workers and the maintenance schedule.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		return noArgs(func() error {
+			serve()
+			return nil
+		})
+	},
+}
+
+// readSecret returns value, or reads it from the first line of stdin when it is empty, so
+// passwords can be piped in rather than left in the shell history
+func readSecret(value, prompt string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read from stdin: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("a password is required")
+	}
+	return line, nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/email"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/camden-git/mediasysbackend/webhooks"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// how often scan and cleanup check whether the workers are done
+const drainPollInterval = time.Second
+
+// openLibrary loads the configuration the server would use and opens its database
+func openLibrary() (config.Config, *gorm.DB, func(), error) {
+	_ = godotenv.Load() // the environment may come from elsewhere
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	gormDB, err := database.InitGormDB(cfg.DatabasePath)
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("failed to open database %s: %w", cfg.DatabasePath, err)
+	}
+	// the server logs every query to stdout, where the commands write their output
+	gormDB.Logger = logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             time.Second,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+	})
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("failed to get underlying sql.DB from GORM: %w", err)
+	}
+	if err := database.AutoMigrateModels(gormDB); err != nil {
+		sqlDB.Close()
+		return cfg, nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return cfg, gormDB, func() { sqlDB.Close() }, nil
+}
+
+// startProcessor starts the image processor workers the way the server does, minus the
+// realtime hub. the returned function stops them once they are done with the queued jobs,
+// or right away on an interrupt.
+func startProcessor(cfg config.Config, gormDB *gorm.DB) (*workers.ImageProcessor, func(), error) {
+	geocoder, err := media.NewGeocoderFromConfig(cfg)
+	if err != nil {
+		log.Printf("Warning: Reverse geocoding disabled: %v", err)
+	}
+	mailer, err := email.NewMailer(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize email: %w", err)
+	}
+	webhookDispatcher := webhooks.NewDispatcher(repository.NewWebhookRepository(gormDB), cfg)
+	webhookDispatcher.Start()
+
+	imageProcessor := workers.NewImageProcessor(
+		cfg,
+		repository.NewImageRepository(gormDB),
+		repository.NewAlbumRepository(gormDB),
+		repository.NewFaceRepository(gormDB),
+		repository.NewImageEmbeddingRepository(gormDB),
+		repository.NewFaceEmbeddingRepository(gormDB),
+		repository.NewMachineTagRepository(gormDB),
+		geocoder,
+		repository.NewActivityRepository(gormDB),
+		cfg.ThumbnailQueueSize,
+		cfg.NumThumbnailWorkers,
+		nil,
+		webhookDispatcher,
+		email.NewNotifier(mailer, repository.NewNotificationRepository(gormDB), cfg.PublicURL),
+	)
+
+	// the runtime settings override the config here too
+	settingsService, err := services.NewSettingsService(repository.NewGormSettingRepository(gormDB), cfg)
+	if err != nil {
+		imageProcessor.Stop()
+		webhookDispatcher.Stop()
+		return nil, nil, fmt.Errorf("failed to load runtime settings: %w", err)
+	}
+	settingsService.OnChange(services.SettingThumbnailMaxSize, func(value interface{}) {
+		imageProcessor.SetThumbnailMaxSize(value.(int))
+	})
+	settingsService.OnChange(services.SettingWorkerCount, func(value interface{}) {
+		imageProcessor.SetWorkerCount(value.(int))
+	})
+	settingsService.OnChange(services.SettingFaceDetectionConfidence, func(value interface{}) {
+		imageProcessor.SetDetectionConfidence(float32(value.(float64)))
+	})
+	settingsService.OnChange(services.SettingFaceDetectionIoU, func(value interface{}) {
+		imageProcessor.SetDetectionIoUThreshold(float32(value.(float64)))
+	})
+	settingsService.OnChange(services.SettingNSFWThreshold, func(value interface{}) {
+		imageProcessor.SetNSFWThreshold(float32(value.(float64)))
+	})
+
+	finish := func() {
+		waitForJobs(imageProcessor)
+		imageProcessor.Stop()
+		webhookDispatcher.Stop()
+	}
+	return imageProcessor, finish, nil
+}
+
+// waitForJobs blocks until no job is queued, processing or waiting for a retry, or until
+// the process is interrupted. jobs left over are picked up by the next rescan.
+func waitForJobs(imageProcessor *workers.ImageProcessor) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	reported := -1
+	for {
+		states := imageProcessor.QueueStats().States
+		pending := states[workers.JobStateQueued] + states[workers.JobStateProcessing] + states[workers.JobStateRetrying]
+		if pending == 0 {
+			return
+		}
+		if pending != reported {
+			log.Printf("Waiting for %d job(s) to finish...", pending)
+			reported = pending
+		}
+		select {
+		case <-interrupt:
+			log.Printf("Interrupted with %d job(s) unfinished; the next rescan queues them again", pending)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runProcessorTask runs a maintenance task of the image processor and waits for the jobs it
+// queued
+func runProcessorTask(name string, task func(ip *workers.ImageProcessor) (int, error)) error {
+	cfg, gormDB, closeDB, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	imageProcessor, finish, err := startProcessor(cfg, gormDB)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	count, err := task(imageProcessor)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	log.Printf("%s: %d item(s) affected", name, count)
+	return nil
+}
+
+var scanCommand = &command{
+	name:    "scan",
+	summary: "Walks the library and processes new or changed files, then exits once the workers are done.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		return noArgs(func() error {
+			return runProcessorTask(workers.MaintenanceLibraryRescan, (*workers.ImageProcessor).RescanLibrary)
+		})
+	},
+}
+
+var cleanupCommand = &command{
+	name:    "cleanup",
+	summary: "Removes the records, faces and generated assets of files deleted from disk.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		return noArgs(func() error {
+			return runProcessorTask(workers.MaintenanceOrphanCleanup, (*workers.ImageProcessor).CleanupOrphans)
+		})
+	},
+}
+
+var reindexCommand = &command{
+	name:    "reindex",
+	summary: "Rebuilds the full-text search index from the images, albums and people.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		return noArgs(func() error {
+			_, gormDB, closeDB, err := openLibrary()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			if err := database.EnsureSearchIndex(gormDB); err != nil {
+				if errors.Is(err, database.ErrFTS5Unavailable) {
+					return errors.New("SQLite was built without FTS5 (build with -tags sqlite_fts5), there is no search index to rebuild")
+				}
+				return err
+			}
+			return database.RebuildSearchIndex(gormDB)
+		})
+	},
+}
+
+var importCommand = &command{
+	name:    "import",
+	summary: "Imports a Google Takeout export or a folder with JSON sidecars into a library folder and processes it.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		source := flags.String("source", "", "folder holding the export (required)")
+		destination := flags.String("destination", "", "library folder to import into, relative to the root (required)")
+		move := flags.Bool("move", false, "move the files rather than copy them")
+		return noArgs(func() error {
+			if *source == "" || *destination == "" {
+				return errors.New("-source and -destination are required")
+			}
+			cfg, gormDB, closeDB, err := openLibrary()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			imageProcessor, finish, err := startProcessor(cfg, gormDB)
+			if err != nil {
+				return err
+			}
+			defer finish()
+
+			importer := workers.NewImporter(imageProcessor, repository.NewPersonRepository(gormDB))
+			report, err := importer.Run(workers.ImportOptions{Source: *source, Destination: *destination, Move: *move})
+			if err != nil {
+				return fmt.Errorf("import failed: %w", err)
+			}
+			log.Printf("Imported %d file(s) (%d already present, %d unsupported skipped), created %d album(s) and %d people, %d error(s)",
+				report.Files, report.Existing, report.Unsupported, report.AlbumsCreated, report.PeopleCreated, report.ErrorCount)
+			return nil
+		})
+	},
+}
+
+// openBackupService opens the database and the backup service without workers to pause, so
+// restores should run while the server is stopped. dir overrides the backup folder.
+func openBackupService(dir string) (*services.BackupService, func(), error) {
+	cfg, gormDB, closeDB, err := openLibrary()
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir != "" {
+		if cfg.BackupPath, err = filepath.Abs(dir); err != nil {
+			closeDB()
+			return nil, nil, err
+		}
+	}
+	settingsService, err := services.NewSettingsService(repository.NewGormSettingRepository(gormDB), cfg)
+	if err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to load runtime settings: %w", err)
+	}
+	return services.NewBackupService(gormDB, settingsService, nil, nil, cfg), closeDB, nil
+}
+
+var backupCommand = &command{
+	name:    "backup",
+	summary: "Backs up the database and runtime settings, and restores backups.",
+	subcommands: []*command{
+		{
+			name:    "create",
+			summary: "Writes a backup to the backup folder and removes the oldest beyond BACKUP_KEEP.",
+			setup: func(flags *flag.FlagSet) func(args []string) error {
+				dir := flags.String("dir", "", "backup folder, instead of BACKUP_PATH")
+				return noArgs(func() error {
+					backupService, closeDB, err := openBackupService(*dir)
+					if err != nil {
+						return err
+					}
+					defer closeDB()
+					backup, err := backupService.Create()
+					if err != nil {
+						return fmt.Errorf("backup failed: %w", err)
+					}
+					fmt.Println(backup.Name)
+					return nil
+				})
+			},
+		},
+		{
+			name:    "list",
+			summary: "Lists the backups in the backup folder, newest first.",
+			setup: func(flags *flag.FlagSet) func(args []string) error {
+				dir := flags.String("dir", "", "backup folder, instead of BACKUP_PATH")
+				return noArgs(func() error {
+					backupService, closeDB, err := openBackupService(*dir)
+					if err != nil {
+						return err
+					}
+					defer closeDB()
+					backups, err := backupService.List()
+					if err != nil {
+						return err
+					}
+					for _, backup := range backups {
+						fmt.Printf("%s\t%d\t%s\n", backup.Name, backup.Size, time.Unix(backup.CreatedAt, 0).Format(time.RFC3339))
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:    "restore",
+			usage:   "<backup file>",
+			summary: "Replaces the database with the one in a backup, after backing up the current one. stop the server first, or restore through the API.",
+			setup: func(flags *flag.FlagSet) func(args []string) error {
+				dir := flags.String("dir", "", "backup folder for the pre-restore backup, instead of BACKUP_PATH")
+				return func(args []string) error {
+					if len(args) != 1 {
+						return errors.New("expected the backup file to restore")
+					}
+					backupService, closeDB, err := openBackupService(*dir)
+					if err != nil {
+						return err
+					}
+					defer closeDB()
+					manifest, err := backupService.Restore(args[0])
+					if err != nil {
+						return fmt.Errorf("restore failed: %w", err)
+					}
+					log.Printf("Restored the backup taken %s", time.Unix(manifest.CreatedAt, 0).Format(time.RFC3339))
+					return nil
+				}
+			},
+		},
+	},
+}
+
+// libraryExport is the document written by the export command
+type libraryExport struct {
+	ExportedAt int64           `json:"exported_at"`
+	Albums     []models.Album  `json:"albums"`
+	People     []models.Person `json:"people"`
+	Images     []models.Image  `json:"images"`
+}
+
+func writeExport(w io.Writer, export libraryExport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+var exportCommand = &command{
+	name:    "export",
+	summary: "Writes the albums, people and image metadata as JSON, e.g. for backups or migrations.",
+	setup: func(flags *flag.FlagSet) func(args []string) error {
+		output := flags.String("output", "-", "file to write to, - for stdout")
+		return noArgs(func() error {
+			_, gormDB, closeDB, err := openLibrary()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+
+			export := libraryExport{ExportedAt: time.Now().Unix()}
+			if export.Albums, err = repository.NewAlbumRepository(gormDB).ListAllAdmin(); err != nil {
+				return fmt.Errorf("failed to list albums: %w", err)
+			}
+			if export.People, err = repository.NewPersonRepository(gormDB).ListAll(true); err != nil {
+				return fmt.Errorf("failed to list people: %w", err)
+			}
+			if export.Images, err = repository.NewImageRepository(gormDB).ListAll(); err != nil {
+				return fmt.Errorf("failed to list images: %w", err)
+			}
+
+			if *output == "-" {
+				return writeExport(os.Stdout, export)
+			}
+			file, err := os.Create(*output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", *output, err)
+			}
+			if err := writeExport(file, export); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return fmt.Errorf("failed to write %s: %w", *output, err)
+			}
+			log.Printf("Exported %d album(s), %d people and %d image(s) to %s", len(export.Albums), len(export.People), len(export.Images), *output)
+			return nil
+		})
+	},
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/handlers"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/permissions"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+var userCommand = &command{
+	name:    "user",
+	summary: "Creates accounts and resets passwords, e.g. to bootstrap the first admin.",
+	subcommands: []*command{
+		{
+			name:    "create",
+			summary: "Creates an account, without an invite code. the password is read from stdin unless -password is set.",
+			setup:   setupUserCreate,
+		},
+		{
+			name:    "reset-password",
+			summary: "Sets the password of an account and lifts its login lockout. the password is read from stdin unless -password is set.",
+			setup:   setupUserResetPassword,
+		},
+	},
+}
+
+func setupUserCreate(flags *flag.FlagSet) func(args []string) error {
+	username := flags.String("username", "", "username of the account (required)")
+	password := flags.String("password", "", "password of the account")
+	emailAddress := flags.String("email", "", "email address, treated as verified")
+	firstName := flags.String("first-name", "", "first name")
+	lastName := flags.String("last-name", "", "last name")
+	admin := flags.Bool("admin", false, "grant every global permission")
+	roleNames := flags.String("roles", "", "comma separated names of roles to assign")
+
+	return noArgs(func() error {
+		if strings.TrimSpace(*username) == "" {
+			return errors.New("-username is required")
+		}
+		secret, err := readSecret(*password, "Password: ")
+		if err != nil {
+			return err
+		}
+
+		_, gormDB, closeDB, err := openLibrary()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+		userRepo := repository.NewGormUserRepository(gormDB)
+		roleRepo := repository.NewGormRoleRepository(gormDB)
+
+		if _, err := userRepo.GetByUsername(*username); err == nil {
+			return fmt.Errorf("user %q already exists", *username)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to check username: %w", err)
+		}
+		var roles []*models.Role
+		for _, name := range strings.Split(*roleNames, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			role, err := roleRepo.GetByName(name)
+			if err != nil {
+				return fmt.Errorf("failed to find role %q: %w", name, err)
+			}
+			roles = append(roles, role)
+		}
+
+		user := &models.User{
+			Username:          *username,
+			FirstName:         *firstName,
+			LastName:          *lastName,
+			GlobalPermissions: []string{},
+		}
+		if address := strings.ToLower(strings.TrimSpace(*emailAddress)); address != "" {
+			now := time.Now()
+			user.Email, user.EmailVerifiedAt = &address, &now
+		}
+		if *admin {
+			user.GlobalPermissions = permissions.GetAllPermissionKeys()
+		}
+		if err := user.SetPassword(secret); err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		if err := userRepo.Create(user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		for _, role := range roles {
+			if err := userRepo.AddRoleToUser(user.ID, role.ID); err != nil {
+				return fmt.Errorf("user %d created, but failed to assign role %q: %w", user.ID, role.Name, err)
+			}
+		}
+		log.Printf("Created user %q (ID %d)", user.Username, user.ID)
+		return nil
+	})
+}
+
+func setupUserResetPassword(flags *flag.FlagSet) func(args []string) error {
+	username := flags.String("username", "", "username of the account (required)")
+	password := flags.String("password", "", "new password")
+
+	return noArgs(func() error {
+		if strings.TrimSpace(*username) == "" {
+			return errors.New("-username is required")
+		}
+		secret, err := readSecret(*password, "New password: ")
+		if err != nil {
+			return err
+		}
+
+		cfg, gormDB, closeDB, err := openLibrary()
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+		userRepo := repository.NewGormUserRepository(gormDB)
+
+		user, err := userRepo.GetByUsername(*username)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("user %q not found", *username)
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if err := user.SetPassword(secret); err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		if err := userRepo.Update(user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if guard := handlers.NewLoginGuard(repository.NewLoginFailureRepository(gormDB), cfg); guard != nil {
+			if err := guard.Unlock(models.LoginSubjectUsername, user.Username); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Warning: Failed to lift the login lockout of %q: %v", user.Username, err)
+			}
+		}
+		log.Printf("Reset the password of user %q", user.Username)
+		return nil
+	})
+}
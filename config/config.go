@@ -4,42 +4,280 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 const (
 	DefaultThumbnailsSubDir = "thumbnails"
 	DefaultBannersSubDir    = "album_banners"
 	DefaultArchivesSubDir   = "album_archives"
+	DefaultVideosSubDir     = "video_renditions"
+	DefaultAvatarsSubDir    = "user_avatars"
+	DefaultResizedSubDir    = "resized_images"
+	DefaultWatermarksSubDir = "album_watermarks"
+	DefaultStreamsSubDir    = "video_streams"
 )
 
 const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+const (
+	SMTPSecurityNone     = "none"
+	SMTPSecuritySTARTTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+)
+
+// thumbnail formats generated next to the JPEGs
+const (
+	ThumbnailFormatWebP = "webp"
+	ThumbnailFormatAVIF = "avif"
+)
+
+const (
+	GeocodingProviderNone      = "none"
+	GeocodingProviderNominatim = "nominatim"
+	GeocodingProviderOffline   = "offline"
+)
+
+// ServiceMode values. read only rejects every change, maintenance also pauses background
+// processing so the database and storage can be worked on.
+const (
+	ServiceModeNormal      = "normal"
+	ServiceModeReadOnly    = "read_only"
+	ServiceModeMaintenance = "maintenance"
+)
+
+// SymlinkPolicy values. with follow, symlinks under a library are followed as long as they
+// point inside one of the libraries; with skip, they are treated as if they didn't exist.
+const (
+	SymlinkPolicyFollow = "follow"
+	SymlinkPolicySkip   = "skip"
+)
+
+const (
+	defaultPort               = "8080"
+	defaultCORSAllowedOrigins = "http://localhost:5173,http://127.0.0.1:5173"
+	defaultIgnorePatterns     = ".*,@eaDir,Thumbs.db,*.tmp"
+
 	defaultThumbnailQueueSize  = 200
 	defaultNumThumbnailWorkers = 4
-	defaultThumbnailMaxSize    = 300
+
+	defaultWorkerMaxAttempts           = 3
+	defaultWorkerRetryBaseDelaySeconds = 30
+	defaultWorkerRetryMaxDelaySeconds  = 1800
+	defaultShutdownTimeoutSeconds      = 30
+	defaultStatsStreamSeconds          = 15
+	defaultCompressionLevel            = 5
+	defaultListingCacheSeconds         = 300
+	defaultBurstIntervalMs             = 1000
+	defaultOrphanCleanupMaxPercent     = 50
+	defaultBackupKeep                  = 10
+	defaultThumbnailMaxSize            = 300
+	defaultResizeMaxSize               = 2560
+	defaultResizeSizes                 = "320,640,960,1280,1920,2560"
+	defaultWebDownloadMaxSize          = 2048
+	defaultWebDownloadQuality          = 85
+	defaultZipStreamMaxConcurrent      = 4
+
+	defaultVideoTranscodeMaxHeight = 720
+	defaultVideoHLSMinDuration     = 120
+	defaultVideoHLSHeights         = "360,720"
+
+	defaultScheduleLibraryRescanMinutes          = 1440
+	defaultScheduleOrphanCleanupMinutes          = 1440
+	defaultScheduleZipRefreshMinutes             = 60
+	defaultScheduleEmbeddingBackfillMinutes      = 1440
+	defaultScheduleIntegrityCheckMinutes         = 10080
+	defaultScheduleGeocodeBackfillMinutes        = 1440
+	defaultScheduleFaceClusteringMinutes         = 1440
+	defaultScheduleFaceSuggestionsMinutes        = 360
+	defaultScheduleClassificationBackfillMinutes = 1440
+	defaultScheduleOCRBackfillMinutes            = 1440
+	defaultScheduleNSFWBackfillMinutes           = 1440
+
+	defaultS3PresignExpirySeconds = 900
+	defaultAssetURLExpirySeconds  = 3600
+
+	defaultRateLimitLoginPerMinute      = 10
+	defaultRateLimitLoginBurst          = 5
+	defaultRateLimitRegisterPerMinute   = 5
+	defaultRateLimitRegisterBurst       = 3
+	defaultRateLimitUploadPerMinute     = 60
+	defaultRateLimitUploadBurst         = 20
+	defaultRateLimitFaceSearchPerMinute = 10
+	defaultRateLimitFaceSearchBurst     = 5
+
+	defaultLoginMaxFailures          = 5
+	defaultLoginIPMaxFailures        = 20
+	defaultLoginFailureWindowMinutes = 15
+	defaultLoginLockoutMinutes       = 15
+
+	defaultUploadQuotaMB       = 0
+	defaultUploadMaxFileSizeMB = 2048
+	defaultUploadMaxFiles      = 1000
+	defaultUploadMaxRequestMB  = 10240
+	defaultUploadAllowedTypes  = "image/jpeg,image/png,image/gif,image/bmp,image/tiff,video/mp4,video/quicktime"
+
+	defaultWebhookMaxAttempts           = 5
+	defaultWebhookRetryBaseDelaySeconds = 60
+	defaultWebhookTimeoutSeconds        = 10
+
+	defaultSMTPPort                     = 587
+	defaultPasswordResetExpiryMinutes   = 60
+	defaultEmailVerificationExpiryHours = 48
 )
 
 type Config struct {
+	// HTTP listen port
+	Port string
+
+	// origins allowed to make credentialed cross-origin requests
+	CORSAllowedOrigins []string
+
+	// base URL of the web frontend, used for links in emails
+	PublicURL string
+
+	// mode the server starts in, see ServiceModeNormal. admins can switch it at runtime
+	ServiceMode string
+
 	// source directory (where original user files are scanned)
 	RootDirectory string
 
+	// every root directory media is served from, the default library at RootDirectory first
+	Libraries []Library
+
+	// globs of the file and folder names left out of listings, library scans and album
+	// archives, e.g. ".*" for dotfiles. see IsIgnored
+	IgnorePatterns []string
+
+	// how symlinks under the libraries are treated in listings, uploads, scans and album
+	// archives, see SymlinkPolicyFollow
+	SymlinkPolicy string
+
 	// database path
 	DatabasePath string
 
+	// folder admins can import external libraries from over the API, e.g. unpacked Google
+	// Takeout exports. empty disables imports over the API; the import command takes any folder
+	ImportPath string
+
+	// folder database backups are written to and restored from, and how many of the newest
+	// are kept there. 0 keeps every backup
+	BackupPath string
+	BackupKeep int
+
 	// media storage configuration
 	MediaStoragePath string // primary root for generated assets (thumbs, banners, zips)
 	ThumbnailsPath   string // full-calculated path for thumbnails
 	BannersPath      string // full-calculated path for banners
 	ArchivesPath     string // full-calculated path for archives
+	VideosPath       string // full-calculated path for web-playable video renditions
+	AvatarsPath      string // full-calculated path for user avatars
+	ResizedPath      string // full-calculated path for the on-demand resize cache
+	WatermarksPath   string // full-calculated path for album watermark overlays
+	StreamsPath      string // full-calculated path for HLS playlists and segments
+
+	// storage backend for generated assets ("local" or "s3")
+	StorageBackend string
+
+	// S3-compatible object storage settings (used when StorageBackend is "s3")
+	S3Endpoint             string // e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	S3Region               string
+	S3Bucket               string
+	S3Prefix               string // optional key prefix inside the bucket
+	S3AccessKeyID          string
+	S3SecretAccessKey      string
+	S3UsePathStyle         bool // required by most MinIO deployments
+	S3PresignExpirySeconds int  // lifetime of presigned GET URLs handed out by the asset server
+
+	// HMAC key of signed asset URLs. when set, thumbnails, banners, archives and video
+	// renditions are only served from the URLs the API hands out
+	AssetURLSecret        string
+	AssetURLExpirySeconds int // minimum lifetime of a signed asset URL
 
 	// thumbnail generation settings
 	ThumbnailMaxSize int
+	ThumbnailSizes   []int    // longest sides of the extra sizes generated for responsive images, ascending
+	ThumbnailFormats []string // encodings stored next to every JPEG thumbnail, served to clients that accept them
+	ResizeMaxSize    int      // largest width or height the resize endpoint produces
+	ResizeSizes      []int    // widths and heights the resize endpoint rounds requests up to, ascending
+
+	// "web" downloads: JPEG copies scaled down to WebDownloadMaxSize without EXIF data
+	WebDownloadMaxSize int
+	WebDownloadQuality int // JPEG quality, 1-100
+	// write the copyright holder and license of the images into the copies as XMP
+	WebDownloadEmbedRights bool
+	// zips streamed at once, further requests get a 503 until one finishes. 0 is unlimited
+	ZipStreamMaxConcurrent int
+
+	// video processing settings
+	FFmpegPath              string
+	FFprobePath             string
+	VideoTranscodeEnabled   bool
+	VideoTranscodeMaxHeight int // renditions are scaled down to this height (never up)
+
+	// HLS packaging of videos at least VideoHLSMinDuration seconds long, so they can be
+	// streamed instead of downloaded. one variant per height, ascending, none taller than the video
+	VideoHLSEnabled     bool
+	VideoHLSMinDuration int
+	VideoHLSHeights     []int
+
+	// previews of the first page of PDFs, rendered with pdftoppm from poppler-utils
+	PdftoppmPath string
 
 	// worker settings
 	ThumbnailQueueSize  int
 	NumThumbnailWorkers int
 
+	// failed tasks are retried with exponential backoff until they have run WorkerMaxAttempts times
+	WorkerMaxAttempts           int
+	WorkerRetryBaseDelaySeconds int
+	WorkerRetryMaxDelaySeconds  int
+
+	// on shutdown, in-flight requests get ShutdownTimeoutSeconds to finish and jobs that
+	// never ran are saved to QueueStatePath, then queued again on the next start
+	ShutdownTimeoutSeconds int
+	QueueStatePath         string
+
+	// seconds between the stats events streamed to admin dashboards over the realtime hub,
+	// 0 disables them
+	StatsStreamSeconds int
+
+	// gzip and brotli level of compressed JSON, HTML and feed responses, 1 (fastest) to 9
+	// (smallest). 0 disables response compression
+	CompressionLevel int
+
+	// seconds a directory or album listing is kept in memory for repeated loads. uploads,
+	// deletions and processing drop it sooner. 0 disables the cache
+	ListingCacheSeconds int
+
+	// frames of the same camera in the same folder shot less than this many milliseconds apart
+	// are grouped into a burst stack. 0 disables burst grouping
+	BurstIntervalMs int
+
+	// orphan cleanup leaves a library alone when more than this percentage of its files are
+	// missing, which is more likely an unmounted disk than deleted files. 100 lifts the limit
+	OrphanCleanupMaxPercent int
+
+	// intervals of the periodic maintenance tasks in minutes, 0 disables a task
+	ScheduleLibraryRescanMinutes          int
+	ScheduleOrphanCleanupMinutes          int
+	ScheduleZipRefreshMinutes             int
+	ScheduleEmbeddingBackfillMinutes      int
+	ScheduleIntegrityCheckMinutes         int
+	ScheduleGeocodeBackfillMinutes        int
+	ScheduleFaceClusteringMinutes         int
+	ScheduleFaceSuggestionsMinutes        int
+	ScheduleClassificationBackfillMinutes int
+	ScheduleOCRBackfillMinutes            int
+	ScheduleNSFWBackfillMinutes           int
+
 	// face detection model paths (DNN - legacy)
 	FaceDNNNetConfigPath string
 	FaceDNNNetModelPath  string
@@ -47,6 +285,10 @@ type Config struct {
 	// face detection model paths (RetinaFace)
 	RetinaFaceModelPath string
 
+	// RetinaFace detection settings
+	FaceDetectionConfidence   float64 // minimum confidence for a detection to count as a face
+	FaceDetectionIoUThreshold float64 // overlap above which the weaker of two detections is dropped
+
 	// face recognition model paths
 	FaceRecognitionModelPath string
 	FaceRecognitionModelName string // "arcface", "facenet", etc.
@@ -55,13 +297,98 @@ type Config struct {
 	FaceRecognitionThreshold float64 // similarity threshold for face matching
 	FaceRecognitionEnabled   bool    // whether to enable face recognition
 
+	// CLIP semantic search, off unless enabled since it needs the models below
+	CLIPEnabled        bool
+	CLIPImageModelPath string  // ONNX image encoder, 224x224 RGB input
+	CLIPTextModelPath  string  // ONNX text encoder, 77 token IDs input
+	CLIPVocabPath      string  // BPE merges file of the CLIP tokenizer (bpe_simple_vocab_16e6.txt)
+	CLIPMinSimilarity  float64 // semantic search results scoring below this are dropped
+
+	// scene and object classification into machine tags, off unless enabled since it needs the model below
+	ClassificationEnabled       bool
+	ClassificationModelPath     string  // ONNX image classifier (e.g. MobileNet or EfficientNet), 224x224 RGB input
+	ClassificationLabelsPath    string  // machine tag name of each output class, one per line
+	ClassificationModelName     string  // recorded with every machine tag
+	ClassificationMinConfidence float64 // labels scoring below this are not stored
+	ClassificationMaxTags       int     // most machine tags stored per image
+
+	// OCR of visible text (signs, slides, whiteboards) into the search index, off unless
+	// enabled since it needs tesseract and its language data installed
+	OCREnabled    bool
+	TesseractPath string
+	OCRLanguages  string // tesseract language codes joined with '+', e.g. "eng+deu"
+
+	// NSFW detection, off unless enabled since it needs the model below. images scoring at
+	// least the threshold are flagged for review
+	NSFWEnabled    bool
+	NSFWModelPath  string  // ONNX image classifier, 224x224 RGB input
+	NSFWClasses    []int   // indexes of the model outputs that count as NSFW
+	NSFWThreshold  float64 // 0 to 1
+	NSFWHidePublic bool    // hide flagged and confirmed images from anonymous and share link views
+
+	// reverse geocoding of GPS positions to place names, off unless a provider is set
+	GeocodingProvider      string  // "none", "nominatim" or "offline"
+	GeocodingURL           string  // base URL of a Nominatim server
+	GeocodingUserAgent     string  // sent to Nominatim, whose usage policy requires one identifying the application
+	GeocodingDatasetPath   string  // GeoNames cities file (e.g. cities1000.txt) for the offline provider
+	GeocodingMaxDistanceKm float64 // the offline provider leaves positions further than this from any city unresolved
+
 	// Cloudflare Turnstile
 	TurnstileSiteKey   string
 	TurnstileSecretKey string
+
+	// rate limiting (token bucket per client IP and per user)
+	RateLimitEnabled             bool
+	RateLimitLoginPerMinute      int
+	RateLimitLoginBurst          int
+	RateLimitRegisterPerMinute   int
+	RateLimitRegisterBurst       int
+	RateLimitUploadPerMinute     int
+	RateLimitUploadBurst         int
+	RateLimitFaceSearchPerMinute int
+	RateLimitFaceSearchBurst     int
+
+	// failed logins are counted per username and per client IP; reaching the limit within the
+	// window locks logins for that username or IP. wrong share link passcodes count per link
+	// with LoginMaxFailures. LoginMaxFailures 0 disables lockouts.
+	LoginMaxFailures          int
+	LoginIPMaxFailures        int
+	LoginFailureWindowMinutes int
+	LoginLockoutMinutes       int
+
+	// bytes each user may upload, in MB. users can have their own quota; 0 is unlimited
+	UploadQuotaMB int
+
+	// uploads are checked by content: files larger than UploadMaxFileSizeMB (0 is unlimited) or
+	// whose sniffed media type is not in UploadAllowedTypes are refused
+	UploadMaxFileSizeMB int
+	UploadAllowedTypes  []string
+
+	// limits of a single upload request, 0 is unlimited. requests over them are cut short
+	UploadMaxFilesPerRequest int
+	UploadMaxRequestSizeMB   int
+
+	// failed webhook deliveries are retried with exponential backoff until they have been
+	// attempted WebhookMaxAttempts times
+	WebhookMaxAttempts           int
+	WebhookRetryBaseDelaySeconds int
+	WebhookTimeoutSeconds        int // per delivery attempt
+
+	// outgoing email, disabled unless SMTPHost is set
+	SMTPHost                   string
+	SMTPPort                   int
+	SMTPUsername               string
+	SMTPPassword               string
+	SMTPFrom                   string // sender address, e.g. "mediasys <gallery@example.com>"
+	SMTPSecurity               string // "starttls", "tls" (implicit, usually port 465) or "none"
+	PasswordResetExpiryMinutes int    // lifetime of password reset links
+	// when set, registering requires an email address and uploads are refused until it is confirmed
+	EmailVerificationRequired    bool
+	EmailVerificationExpiryHours int // lifetime of email verification links
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
+	value := lookupSetting(key)
 	if value == "" {
 		return defaultValue
 	}
@@ -69,7 +396,7 @@ func getEnvOrDefault(key, defaultValue string) string {
 }
 
 func getEnvIntOrDefault(envVar string, defaultVal int) int {
-	valStr := os.Getenv(envVar)
+	valStr := lookupSetting(envVar)
 	if valStr == "" {
 		return defaultVal
 	}
@@ -81,8 +408,22 @@ func getEnvIntOrDefault(envVar string, defaultVal int) int {
 	return val
 }
 
+// getEnvMinutesOrDefault reads an interval where 0 is allowed and means disabled
+func getEnvMinutesOrDefault(envVar string, defaultVal int) int {
+	valStr := lookupSetting(envVar)
+	if valStr == "" {
+		return defaultVal
+	}
+	val, err := strconv.Atoi(valStr)
+	if err != nil || val < 0 {
+		log.Printf("Warning: Invalid %s '%s'. Using default %d. Error: %v", envVar, valStr, defaultVal, err)
+		return defaultVal
+	}
+	return val
+}
+
 func getEnvFloatOrDefault(envVar string, defaultVal float64) float64 {
-	valStr := os.Getenv(envVar)
+	valStr := lookupSetting(envVar)
 	if valStr == "" {
 		return defaultVal
 	}
@@ -95,7 +436,7 @@ func getEnvFloatOrDefault(envVar string, defaultVal float64) float64 {
 }
 
 func getEnvBoolOrDefault(envVar string, defaultVal bool) bool {
-	valStr := os.Getenv(envVar)
+	valStr := lookupSetting(envVar)
 	if valStr == "" {
 		return defaultVal
 	}
@@ -107,15 +448,108 @@ func getEnvBoolOrDefault(envVar string, defaultVal bool) bool {
 	return val
 }
 
+// splitList splits a comma separated value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseSizeList parses a comma separated list of pixel sizes into ascending order,
+// dropping duplicates
+func parseSizeList(envVar, value string) ([]int, error) {
+	var sizes []int
+	for _, item := range splitList(value) {
+		size, err := strconv.Atoi(item)
+		if err != nil || size < 16 || size > 8192 {
+			return nil, fmt.Errorf("invalid %s entry '%s': must be a size between 16 and 8192 pixels", envVar, item)
+		}
+		if !slices.Contains(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+	slices.Sort(sizes)
+	return sizes, nil
+}
+
+// parseClassList parses a comma separated list of model output class indexes, dropping
+// duplicates
+func parseClassList(envVar, value string) ([]int, error) {
+	var classes []int
+	for _, item := range splitList(value) {
+		class, err := strconv.Atoi(item)
+		if err != nil || class < 0 {
+			return nil, fmt.Errorf("invalid %s entry '%s': must be a class index of 0 or more", envVar, item)
+		}
+		if !slices.Contains(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("%s must name at least one class", envVar)
+	}
+	return classes, nil
+}
+
+// LoadConfig builds the configuration from environment variables, falling back to the
+// config file (CONFIG_FILE, or config.yaml/config.yml/config.toml in the working directory)
+// and then to built-in defaults
 func LoadConfig() (Config, error) {
+	configFile, err := findConfigFile()
+	if err != nil {
+		return Config{}, err
+	}
+	fileSettings = nil
+	if configFile != "" {
+		fc, err := loadConfigFile(configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		fileSettings = fc.settings()
+		log.Printf("Loaded config file: %s", configFile)
+	}
+
+	port := getEnvOrDefault("PORT", defaultPort)
+	corsAllowedOrigins := splitList(getEnvOrDefault("CORS_ALLOWED_ORIGINS", defaultCORSAllowedOrigins))
+	// the frontend is usually served from the first allowed origin
+	defaultPublicURL := ""
+	if len(corsAllowedOrigins) > 0 {
+		defaultPublicURL = corsAllowedOrigins[0]
+	}
+	publicURL := strings.TrimSuffix(getEnvOrDefault("PUBLIC_URL", defaultPublicURL), "/")
+	serviceMode := strings.ToLower(getEnvOrDefault("SERVICE_MODE", ServiceModeNormal))
+	if serviceMode != ServiceModeNormal && serviceMode != ServiceModeReadOnly && serviceMode != ServiceModeMaintenance {
+		return Config{}, fmt.Errorf("invalid SERVICE_MODE '%s': must be '%s', '%s' or '%s'", serviceMode, ServiceModeNormal, ServiceModeReadOnly, ServiceModeMaintenance)
+	}
+
 	root := getEnvOrDefault("ROOT_DIRECTORY", ".")
 	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to get absolute path for root directory '%s': %w", root, err)
 	}
+	libraries, err := parseLibraries(splitList(getEnvOrDefault("LIBRARIES", "")), absRoot)
+	if err != nil {
+		return Config{}, err
+	}
+	ignorePatterns := splitList(getEnvOrDefault("IGNORE_PATTERNS", defaultIgnorePatterns))
+	symlinkPolicy := strings.ToLower(getEnvOrDefault("SYMLINK_POLICY", SymlinkPolicyFollow))
+	if symlinkPolicy != SymlinkPolicyFollow && symlinkPolicy != SymlinkPolicySkip {
+		return Config{}, fmt.Errorf("invalid SYMLINK_POLICY '%s': must be '%s' or '%s'", symlinkPolicy, SymlinkPolicyFollow, SymlinkPolicySkip)
+	}
 
 	dbPath := getEnvOrDefault("DATABASE_PATH", "images.db")
 
+	importPath := getEnvOrDefault("IMPORT_PATH", "")
+	if importPath != "" {
+		if importPath, err = filepath.Abs(importPath); err != nil {
+			return Config{}, fmt.Errorf("failed to get absolute path for import path: %w", err)
+		}
+	}
+
 	mediaStorage := getEnvOrDefault("MEDIA_STORAGE_PATH", filepath.Join(".", "media_storage"))
 	absMediaStorage, err := filepath.Abs(mediaStorage)
 	if err != nil {
@@ -131,10 +565,111 @@ func LoadConfig() (Config, error) {
 	archiveSubDir := getEnvOrDefault("ARCHIVES_SUBDIR", DefaultArchivesSubDir)
 	absArchivesPath := filepath.Join(absMediaStorage, archiveSubDir)
 
+	videoSubDir := getEnvOrDefault("VIDEOS_SUBDIR", DefaultVideosSubDir)
+	absVideosPath := filepath.Join(absMediaStorage, videoSubDir)
+
+	avatarSubDir := getEnvOrDefault("AVATARS_SUBDIR", DefaultAvatarsSubDir)
+	absAvatarsPath := filepath.Join(absMediaStorage, avatarSubDir)
+
+	resizedSubDir := getEnvOrDefault("RESIZED_SUBDIR", DefaultResizedSubDir)
+	absResizedPath := filepath.Join(absMediaStorage, resizedSubDir)
+
+	watermarksSubDir := getEnvOrDefault("WATERMARKS_SUBDIR", DefaultWatermarksSubDir)
+	absWatermarksPath := filepath.Join(absMediaStorage, watermarksSubDir)
+
+	streamsSubDir := getEnvOrDefault("STREAMS_SUBDIR", DefaultStreamsSubDir)
+	absStreamsPath := filepath.Join(absMediaStorage, streamsSubDir)
+
+	storageBackend := strings.ToLower(getEnvOrDefault("STORAGE_BACKEND", StorageBackendLocal))
+	if storageBackend != StorageBackendLocal && storageBackend != StorageBackendS3 {
+		return Config{}, fmt.Errorf("invalid STORAGE_BACKEND '%s': must be '%s' or '%s'", storageBackend, StorageBackendLocal, StorageBackendS3)
+	}
+
+	s3Region := getEnvOrDefault("S3_REGION", "us-east-1")
+	s3Endpoint := getEnvOrDefault("S3_ENDPOINT", fmt.Sprintf("https://s3.%s.amazonaws.com", s3Region))
+	s3Bucket := getEnvOrDefault("S3_BUCKET", "")
+	s3Prefix := strings.Trim(getEnvOrDefault("S3_PREFIX", ""), "/")
+	s3AccessKeyID := getEnvOrDefault("S3_ACCESS_KEY_ID", "")
+	s3SecretAccessKey := getEnvOrDefault("S3_SECRET_ACCESS_KEY", "")
+	s3UsePathStyle := getEnvBoolOrDefault("S3_USE_PATH_STYLE", false)
+	s3PresignExpiry := getEnvIntOrDefault("S3_PRESIGN_EXPIRY_SECONDS", defaultS3PresignExpirySeconds)
+
+	assetURLSecret := getEnvOrDefault("ASSET_URL_SECRET", "")
+	assetURLExpiry := getEnvIntOrDefault("ASSET_URL_EXPIRY_SECONDS", defaultAssetURLExpirySeconds)
+
+	if storageBackend == StorageBackendS3 && (s3Bucket == "" || s3AccessKeyID == "" || s3SecretAccessKey == "") {
+		return Config{}, fmt.Errorf("STORAGE_BACKEND is '%s' but S3_BUCKET, S3_ACCESS_KEY_ID or S3_SECRET_ACCESS_KEY is not set", StorageBackendS3)
+	}
+
 	thumbMaxSize := getEnvIntOrDefault("THUMBNAIL_MAX_SIZE", defaultThumbnailMaxSize)
+	resizeMaxSize := getEnvIntOrDefault("RESIZE_MAX_SIZE", defaultResizeMaxSize)
+	webDownloadMaxSize := getEnvIntOrDefault("WEB_DOWNLOAD_MAX_SIZE", defaultWebDownloadMaxSize)
+	webDownloadQuality := getEnvIntOrDefault("WEB_DOWNLOAD_QUALITY", defaultWebDownloadQuality)
+	zipStreamMaxConcurrent := getEnvMinutesOrDefault("ZIP_STREAM_MAX_CONCURRENT", defaultZipStreamMaxConcurrent)
+	webDownloadEmbedRights := getEnvBoolOrDefault("WEB_DOWNLOAD_EMBED_RIGHTS", true)
+	thumbSizes, err := parseSizeList("THUMBNAIL_SIZES", getEnvOrDefault("THUMBNAIL_SIZES", ""))
+	if err != nil {
+		return Config{}, err
+	}
+	resizeSizes, err := parseSizeList("RESIZE_SIZES", getEnvOrDefault("RESIZE_SIZES", defaultResizeSizes))
+	if err != nil {
+		return Config{}, err
+	}
+	var thumbFormats []string
+	for _, format := range splitList(strings.ToLower(getEnvOrDefault("THUMBNAIL_FORMATS", ""))) {
+		if format != ThumbnailFormatWebP && format != ThumbnailFormatAVIF {
+			return Config{}, fmt.Errorf("invalid THUMBNAIL_FORMATS entry '%s': must be '%s' or '%s'", format, ThumbnailFormatWebP, ThumbnailFormatAVIF)
+		}
+		if !slices.Contains(thumbFormats, format) {
+			thumbFormats = append(thumbFormats, format)
+		}
+	}
+
+	ffmpegPath := getEnvOrDefault("FFMPEG_PATH", "ffmpeg")
+	ffprobePath := getEnvOrDefault("FFPROBE_PATH", "ffprobe")
+	pdftoppmPath := getEnvOrDefault("PDFTOPPM_PATH", "pdftoppm")
+	videoTranscodeEnabled := getEnvBoolOrDefault("VIDEO_TRANSCODE_ENABLED", true)
+	videoTranscodeMaxHeight := getEnvIntOrDefault("VIDEO_TRANSCODE_MAX_HEIGHT", defaultVideoTranscodeMaxHeight)
+	videoHLSEnabled := getEnvBoolOrDefault("VIDEO_HLS_ENABLED", true)
+	videoHLSMinDuration := getEnvIntOrDefault("VIDEO_HLS_MIN_DURATION_SECONDS", defaultVideoHLSMinDuration)
+	videoHLSHeights, err := parseSizeList("VIDEO_HLS_HEIGHTS", getEnvOrDefault("VIDEO_HLS_HEIGHTS", defaultVideoHLSHeights))
+	if err != nil {
+		return Config{}, err
+	}
+	if videoHLSEnabled && len(videoHLSHeights) == 0 {
+		return Config{}, fmt.Errorf("VIDEO_HLS_HEIGHTS must name at least one height when VIDEO_HLS_ENABLED is set")
+	}
 
 	queueSize := getEnvIntOrDefault("THUMBNAIL_QUEUE_SIZE", defaultThumbnailQueueSize)
 	numWorkers := getEnvIntOrDefault("NUM_THUMBNAIL_WORKERS", defaultNumThumbnailWorkers)
+	workerMaxAttempts := getEnvIntOrDefault("WORKER_MAX_ATTEMPTS", defaultWorkerMaxAttempts)
+	workerRetryBaseDelay := getEnvIntOrDefault("WORKER_RETRY_BASE_DELAY_SECONDS", defaultWorkerRetryBaseDelaySeconds)
+	workerRetryMaxDelay := getEnvIntOrDefault("WORKER_RETRY_MAX_DELAY_SECONDS", defaultWorkerRetryMaxDelaySeconds)
+
+	shutdownTimeout := getEnvIntOrDefault("SHUTDOWN_TIMEOUT_SECONDS", defaultShutdownTimeoutSeconds)
+	queueStatePath := getEnvOrDefault("QUEUE_STATE_PATH", filepath.Join(filepath.Dir(dbPath), "pending_jobs.json"))
+	statsStreamSeconds := getEnvMinutesOrDefault("STATS_STREAM_SECONDS", defaultStatsStreamSeconds)
+	compressionLevel := getEnvMinutesOrDefault("COMPRESSION_LEVEL", defaultCompressionLevel)
+	listingCacheSeconds := getEnvMinutesOrDefault("LISTING_CACHE_SECONDS", defaultListingCacheSeconds)
+	burstIntervalMs := getEnvMinutesOrDefault("BURST_INTERVAL_MS", defaultBurstIntervalMs)
+	orphanCleanupMaxPercent := getEnvMinutesOrDefault("ORPHAN_CLEANUP_MAX_PERCENT", defaultOrphanCleanupMaxPercent)
+	backupPath, err := filepath.Abs(getEnvOrDefault("BACKUP_PATH", filepath.Join(filepath.Dir(dbPath), "backups")))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to get absolute path for backup path: %w", err)
+	}
+	backupKeep := getEnvMinutesOrDefault("BACKUP_KEEP", defaultBackupKeep)
+
+	scheduleLibraryRescan := getEnvMinutesOrDefault("SCHEDULE_LIBRARY_RESCAN_MINUTES", defaultScheduleLibraryRescanMinutes)
+	scheduleOrphanCleanup := getEnvMinutesOrDefault("SCHEDULE_ORPHAN_CLEANUP_MINUTES", defaultScheduleOrphanCleanupMinutes)
+	scheduleZipRefresh := getEnvMinutesOrDefault("SCHEDULE_ZIP_REFRESH_MINUTES", defaultScheduleZipRefreshMinutes)
+	scheduleEmbeddingBackfill := getEnvMinutesOrDefault("SCHEDULE_EMBEDDING_BACKFILL_MINUTES", defaultScheduleEmbeddingBackfillMinutes)
+	scheduleIntegrityCheck := getEnvMinutesOrDefault("SCHEDULE_INTEGRITY_CHECK_MINUTES", defaultScheduleIntegrityCheckMinutes)
+	scheduleGeocodeBackfill := getEnvMinutesOrDefault("SCHEDULE_GEOCODE_BACKFILL_MINUTES", defaultScheduleGeocodeBackfillMinutes)
+	scheduleFaceClustering := getEnvMinutesOrDefault("SCHEDULE_FACE_CLUSTERING_MINUTES", defaultScheduleFaceClusteringMinutes)
+	scheduleFaceSuggestions := getEnvMinutesOrDefault("SCHEDULE_FACE_SUGGESTIONS_MINUTES", defaultScheduleFaceSuggestionsMinutes)
+	scheduleClassificationBackfill := getEnvMinutesOrDefault("SCHEDULE_CLASSIFICATION_BACKFILL_MINUTES", defaultScheduleClassificationBackfillMinutes)
+	scheduleOCRBackfill := getEnvMinutesOrDefault("SCHEDULE_OCR_BACKFILL_MINUTES", defaultScheduleOCRBackfillMinutes)
+	scheduleNSFWBackfill := getEnvMinutesOrDefault("SCHEDULE_NSFW_BACKFILL_MINUTES", defaultScheduleNSFWBackfillMinutes)
 
 	// Legacy DNN face detection
 	faceDNNConfig := getEnvOrDefault("FACE_DNN_CONFIG_PATH", "./models/deploy.prototxt.txt")
@@ -142,6 +677,8 @@ func LoadConfig() (Config, error) {
 
 	// New RetinaFace detection
 	retinaFaceModel := getEnvOrDefault("RETINAFACE_MODEL_PATH", "./models/retinaface.onnx")
+	faceDetectionConfidence := getEnvFloatOrDefault("FACE_DETECTION_CONFIDENCE", 0.5)
+	faceDetectionIoUThreshold := getEnvFloatOrDefault("FACE_DETECTION_IOU_THRESHOLD", 0.5)
 
 	// Face recognition
 	faceRecognitionModel := getEnvOrDefault("FACE_RECOGNITION_MODEL_PATH", "./models/arcface.onnx")
@@ -150,30 +687,348 @@ func LoadConfig() (Config, error) {
 	faceRecognitionEnabled := getEnvBoolOrDefault("FACE_RECOGNITION_ENABLED", true)
 	// log.Printf("Config: FACE_RECOGNITION_ENABLED env var parsed as: %v", faceRecognitionEnabled)
 
+	// CLIP semantic search
+	clipEnabled := getEnvBoolOrDefault("CLIP_ENABLED", false)
+	clipImageModel := getEnvOrDefault("CLIP_IMAGE_MODEL_PATH", "./models/clip_image.onnx")
+	clipTextModel := getEnvOrDefault("CLIP_TEXT_MODEL_PATH", "./models/clip_text.onnx")
+	clipVocab := getEnvOrDefault("CLIP_VOCAB_PATH", "./models/bpe_simple_vocab_16e6.txt")
+	clipMinSimilarity := getEnvFloatOrDefault("CLIP_MIN_SIMILARITY", 0.2)
+
+	// scene and object classification
+	classificationEnabled := getEnvBoolOrDefault("CLASSIFICATION_ENABLED", false)
+	classificationModel := getEnvOrDefault("CLASSIFICATION_MODEL_PATH", "./models/classifier.onnx")
+	classificationLabels := getEnvOrDefault("CLASSIFICATION_LABELS_PATH", "./models/classifier_labels.txt")
+	classificationModelName := getEnvOrDefault("CLASSIFICATION_MODEL_NAME", "mobilenet")
+	classificationMinConfidence := getEnvFloatOrDefault("CLASSIFICATION_MIN_CONFIDENCE", 0.3)
+	classificationMaxTags := getEnvIntOrDefault("CLASSIFICATION_MAX_TAGS", 5)
+
+	// OCR
+	ocrEnabled := getEnvBoolOrDefault("OCR_ENABLED", false)
+	tesseractPath := getEnvOrDefault("TESSERACT_PATH", "tesseract")
+	ocrLanguages := getEnvOrDefault("OCR_LANGUAGES", "eng")
+
+	// NSFW detection; the default classes fit open_nsfw, whose outputs are sfw and nsfw
+	nsfwEnabled := getEnvBoolOrDefault("NSFW_ENABLED", false)
+	nsfwModel := getEnvOrDefault("NSFW_MODEL_PATH", "./models/nsfw.onnx")
+	nsfwClasses, err := parseClassList("NSFW_CLASSES", getEnvOrDefault("NSFW_CLASSES", "1"))
+	if err != nil {
+		return Config{}, err
+	}
+	nsfwThreshold := getEnvFloatOrDefault("NSFW_THRESHOLD", 0.8)
+	nsfwHidePublic := getEnvBoolOrDefault("NSFW_HIDE_PUBLIC", true)
+
+	// reverse geocoding
+	geocodingProvider := strings.ToLower(getEnvOrDefault("GEOCODING_PROVIDER", GeocodingProviderNone))
+	if geocodingProvider != GeocodingProviderNone && geocodingProvider != GeocodingProviderNominatim && geocodingProvider != GeocodingProviderOffline {
+		return Config{}, fmt.Errorf("invalid GEOCODING_PROVIDER '%s': must be '%s', '%s' or '%s'", geocodingProvider, GeocodingProviderNone, GeocodingProviderNominatim, GeocodingProviderOffline)
+	}
+	geocodingURL := strings.TrimSuffix(getEnvOrDefault("GEOCODING_URL", "https://nominatim.openstreetmap.org"), "/")
+	geocodingUserAgent := getEnvOrDefault("GEOCODING_USER_AGENT", "mediasys")
+	geocodingDataset := getEnvOrDefault("GEOCODING_DATASET_PATH", "./models/cities1000.txt")
+	geocodingMaxDistance := getEnvFloatOrDefault("GEOCODING_MAX_DISTANCE_KM", 25)
+
 	// Cloudflare Turnstile
 	turnstileSiteKey := getEnvOrDefault("TURNSTILE_SITE_KEY", "")
 	turnstileSecretKey := getEnvOrDefault("TURNSTILE_SECRET_KEY", "")
 
+	// Rate limiting
+	rateLimitEnabled := getEnvBoolOrDefault("RATE_LIMIT_ENABLED", true)
+	rateLimitLoginPerMinute := getEnvIntOrDefault("RATE_LIMIT_LOGIN_PER_MINUTE", defaultRateLimitLoginPerMinute)
+	rateLimitLoginBurst := getEnvIntOrDefault("RATE_LIMIT_LOGIN_BURST", defaultRateLimitLoginBurst)
+	rateLimitRegisterPerMinute := getEnvIntOrDefault("RATE_LIMIT_REGISTER_PER_MINUTE", defaultRateLimitRegisterPerMinute)
+	rateLimitRegisterBurst := getEnvIntOrDefault("RATE_LIMIT_REGISTER_BURST", defaultRateLimitRegisterBurst)
+	rateLimitUploadPerMinute := getEnvIntOrDefault("RATE_LIMIT_UPLOAD_PER_MINUTE", defaultRateLimitUploadPerMinute)
+	rateLimitUploadBurst := getEnvIntOrDefault("RATE_LIMIT_UPLOAD_BURST", defaultRateLimitUploadBurst)
+	rateLimitFaceSearchPerMinute := getEnvIntOrDefault("RATE_LIMIT_FACE_SEARCH_PER_MINUTE", defaultRateLimitFaceSearchPerMinute)
+	rateLimitFaceSearchBurst := getEnvIntOrDefault("RATE_LIMIT_FACE_SEARCH_BURST", defaultRateLimitFaceSearchBurst)
+	loginMaxFailures := getEnvIntOrDefault("LOGIN_MAX_FAILURES", defaultLoginMaxFailures)
+	loginIPMaxFailures := getEnvIntOrDefault("LOGIN_IP_MAX_FAILURES", defaultLoginIPMaxFailures)
+	loginFailureWindow := getEnvIntOrDefault("LOGIN_FAILURE_WINDOW_MINUTES", defaultLoginFailureWindowMinutes)
+	loginLockout := getEnvIntOrDefault("LOGIN_LOCKOUT_MINUTES", defaultLoginLockoutMinutes)
+	uploadQuotaMB := getEnvIntOrDefault("UPLOAD_QUOTA_MB", defaultUploadQuotaMB)
+	uploadMaxFileSizeMB := getEnvIntOrDefault("UPLOAD_MAX_FILE_SIZE_MB", defaultUploadMaxFileSizeMB)
+	uploadMaxFiles := getEnvIntOrDefault("UPLOAD_MAX_FILES_PER_REQUEST", defaultUploadMaxFiles)
+	uploadMaxRequestMB := getEnvIntOrDefault("UPLOAD_MAX_REQUEST_SIZE_MB", defaultUploadMaxRequestMB)
+	uploadAllowedTypes := splitList(strings.ToLower(getEnvOrDefault("UPLOAD_ALLOWED_TYPES", defaultUploadAllowedTypes)))
+
+	// Webhooks
+	webhookMaxAttempts := getEnvIntOrDefault("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts)
+	webhookRetryBaseDelay := getEnvIntOrDefault("WEBHOOK_RETRY_BASE_DELAY_SECONDS", defaultWebhookRetryBaseDelaySeconds)
+	webhookTimeout := getEnvIntOrDefault("WEBHOOK_TIMEOUT_SECONDS", defaultWebhookTimeoutSeconds)
+
+	// Email
+	smtpHost := getEnvOrDefault("SMTP_HOST", "")
+	smtpPort := getEnvIntOrDefault("SMTP_PORT", defaultSMTPPort)
+	smtpUsername := getEnvOrDefault("SMTP_USERNAME", "")
+	smtpPassword := getEnvOrDefault("SMTP_PASSWORD", "")
+	smtpFrom := getEnvOrDefault("SMTP_FROM", "")
+	smtpSecurity := strings.ToLower(getEnvOrDefault("SMTP_SECURITY", SMTPSecuritySTARTTLS))
+	if smtpSecurity != SMTPSecurityNone && smtpSecurity != SMTPSecuritySTARTTLS && smtpSecurity != SMTPSecurityTLS {
+		return Config{}, fmt.Errorf("invalid SMTP_SECURITY '%s': must be '%s', '%s' or '%s'", smtpSecurity, SMTPSecuritySTARTTLS, SMTPSecurityTLS, SMTPSecurityNone)
+	}
+	passwordResetExpiry := getEnvIntOrDefault("PASSWORD_RESET_EXPIRY_MINUTES", defaultPasswordResetExpiryMinutes)
+	emailVerificationRequired := getEnvBoolOrDefault("EMAIL_VERIFICATION_REQUIRED", false)
+	emailVerificationExpiry := getEnvIntOrDefault("EMAIL_VERIFICATION_EXPIRY_HOURS", defaultEmailVerificationExpiryHours)
+
 	cfg := Config{
-		RootDirectory:            absRoot,
-		DatabasePath:             dbPath,
-		MediaStoragePath:         absMediaStorage,
-		ThumbnailsPath:           absThumbnailsPath,
-		BannersPath:              absBannersPath,
-		ArchivesPath:             absArchivesPath,
-		ThumbnailMaxSize:         thumbMaxSize,
-		ThumbnailQueueSize:       queueSize,
-		NumThumbnailWorkers:      numWorkers,
-		FaceDNNNetConfigPath:     faceDNNConfig,
-		FaceDNNNetModelPath:      faceDNNModel,
-		RetinaFaceModelPath:      retinaFaceModel,
-		FaceRecognitionModelPath: faceRecognitionModel,
-		FaceRecognitionModelName: faceRecognitionModelName,
-		FaceRecognitionThreshold: faceRecognitionThreshold,
-		FaceRecognitionEnabled:   faceRecognitionEnabled,
-		TurnstileSiteKey:         turnstileSiteKey,
-		TurnstileSecretKey:       turnstileSecretKey,
+		Port:                                  port,
+		CORSAllowedOrigins:                    corsAllowedOrigins,
+		PublicURL:                             publicURL,
+		ServiceMode:                           serviceMode,
+		RootDirectory:                         absRoot,
+		Libraries:                             libraries,
+		IgnorePatterns:                        ignorePatterns,
+		SymlinkPolicy:                         symlinkPolicy,
+		DatabasePath:                          dbPath,
+		ImportPath:                            importPath,
+		BackupPath:                            backupPath,
+		BackupKeep:                            backupKeep,
+		MediaStoragePath:                      absMediaStorage,
+		ThumbnailsPath:                        absThumbnailsPath,
+		BannersPath:                           absBannersPath,
+		ArchivesPath:                          absArchivesPath,
+		VideosPath:                            absVideosPath,
+		AvatarsPath:                           absAvatarsPath,
+		ResizedPath:                           absResizedPath,
+		WatermarksPath:                        absWatermarksPath,
+		StreamsPath:                           absStreamsPath,
+		StorageBackend:                        storageBackend,
+		S3Endpoint:                            s3Endpoint,
+		S3Region:                              s3Region,
+		S3Bucket:                              s3Bucket,
+		S3Prefix:                              s3Prefix,
+		S3AccessKeyID:                         s3AccessKeyID,
+		S3SecretAccessKey:                     s3SecretAccessKey,
+		S3UsePathStyle:                        s3UsePathStyle,
+		S3PresignExpirySeconds:                s3PresignExpiry,
+		AssetURLSecret:                        assetURLSecret,
+		AssetURLExpirySeconds:                 assetURLExpiry,
+		ThumbnailMaxSize:                      thumbMaxSize,
+		ThumbnailSizes:                        thumbSizes,
+		ThumbnailFormats:                      thumbFormats,
+		ResizeMaxSize:                         resizeMaxSize,
+		ResizeSizes:                           resizeSizes,
+		WebDownloadMaxSize:                    webDownloadMaxSize,
+		WebDownloadQuality:                    webDownloadQuality,
+		WebDownloadEmbedRights:                webDownloadEmbedRights,
+		ZipStreamMaxConcurrent:                zipStreamMaxConcurrent,
+		FFmpegPath:                            ffmpegPath,
+		FFprobePath:                           ffprobePath,
+		VideoTranscodeEnabled:                 videoTranscodeEnabled,
+		VideoTranscodeMaxHeight:               videoTranscodeMaxHeight,
+		VideoHLSEnabled:                       videoHLSEnabled,
+		VideoHLSMinDuration:                   videoHLSMinDuration,
+		VideoHLSHeights:                       videoHLSHeights,
+		PdftoppmPath:                          pdftoppmPath,
+		ThumbnailQueueSize:                    queueSize,
+		NumThumbnailWorkers:                   numWorkers,
+		WorkerMaxAttempts:                     workerMaxAttempts,
+		WorkerRetryBaseDelaySeconds:           workerRetryBaseDelay,
+		WorkerRetryMaxDelaySeconds:            workerRetryMaxDelay,
+		ShutdownTimeoutSeconds:                shutdownTimeout,
+		StatsStreamSeconds:                    statsStreamSeconds,
+		CompressionLevel:                      compressionLevel,
+		ListingCacheSeconds:                   listingCacheSeconds,
+		BurstIntervalMs:                       burstIntervalMs,
+		OrphanCleanupMaxPercent:               orphanCleanupMaxPercent,
+		QueueStatePath:                        queueStatePath,
+		ScheduleLibraryRescanMinutes:          scheduleLibraryRescan,
+		ScheduleOrphanCleanupMinutes:          scheduleOrphanCleanup,
+		ScheduleZipRefreshMinutes:             scheduleZipRefresh,
+		ScheduleEmbeddingBackfillMinutes:      scheduleEmbeddingBackfill,
+		ScheduleIntegrityCheckMinutes:         scheduleIntegrityCheck,
+		ScheduleGeocodeBackfillMinutes:        scheduleGeocodeBackfill,
+		ScheduleFaceClusteringMinutes:         scheduleFaceClustering,
+		ScheduleFaceSuggestionsMinutes:        scheduleFaceSuggestions,
+		ScheduleClassificationBackfillMinutes: scheduleClassificationBackfill,
+		ScheduleOCRBackfillMinutes:            scheduleOCRBackfill,
+		ScheduleNSFWBackfillMinutes:           scheduleNSFWBackfill,
+		FaceDNNNetConfigPath:                  faceDNNConfig,
+		FaceDNNNetModelPath:                   faceDNNModel,
+		RetinaFaceModelPath:                   retinaFaceModel,
+		FaceDetectionConfidence:               faceDetectionConfidence,
+		FaceDetectionIoUThreshold:             faceDetectionIoUThreshold,
+		FaceRecognitionModelPath:              faceRecognitionModel,
+		FaceRecognitionModelName:              faceRecognitionModelName,
+		FaceRecognitionThreshold:              faceRecognitionThreshold,
+		FaceRecognitionEnabled:                faceRecognitionEnabled,
+		CLIPEnabled:                           clipEnabled,
+		CLIPImageModelPath:                    clipImageModel,
+		CLIPTextModelPath:                     clipTextModel,
+		CLIPVocabPath:                         clipVocab,
+		CLIPMinSimilarity:                     clipMinSimilarity,
+		ClassificationEnabled:                 classificationEnabled,
+		ClassificationModelPath:               classificationModel,
+		ClassificationLabelsPath:              classificationLabels,
+		ClassificationModelName:               classificationModelName,
+		ClassificationMinConfidence:           classificationMinConfidence,
+		ClassificationMaxTags:                 classificationMaxTags,
+		OCREnabled:                            ocrEnabled,
+		TesseractPath:                         tesseractPath,
+		OCRLanguages:                          ocrLanguages,
+		NSFWEnabled:                           nsfwEnabled,
+		NSFWModelPath:                         nsfwModel,
+		NSFWClasses:                           nsfwClasses,
+		NSFWThreshold:                         nsfwThreshold,
+		NSFWHidePublic:                        nsfwHidePublic,
+		GeocodingProvider:                     geocodingProvider,
+		GeocodingURL:                          geocodingURL,
+		GeocodingUserAgent:                    geocodingUserAgent,
+		GeocodingDatasetPath:                  geocodingDataset,
+		GeocodingMaxDistanceKm:                geocodingMaxDistance,
+		TurnstileSiteKey:                      turnstileSiteKey,
+		TurnstileSecretKey:                    turnstileSecretKey,
+		RateLimitEnabled:                      rateLimitEnabled,
+		LoginMaxFailures:                      loginMaxFailures,
+		LoginIPMaxFailures:                    loginIPMaxFailures,
+		LoginFailureWindowMinutes:             loginFailureWindow,
+		LoginLockoutMinutes:                   loginLockout,
+		UploadQuotaMB:                         uploadQuotaMB,
+		UploadMaxFileSizeMB:                   uploadMaxFileSizeMB,
+		UploadAllowedTypes:                    uploadAllowedTypes,
+		UploadMaxFilesPerRequest:              uploadMaxFiles,
+		UploadMaxRequestSizeMB:                uploadMaxRequestMB,
+		RateLimitLoginPerMinute:               rateLimitLoginPerMinute,
+		RateLimitLoginBurst:                   rateLimitLoginBurst,
+		RateLimitRegisterPerMinute:            rateLimitRegisterPerMinute,
+		RateLimitRegisterBurst:                rateLimitRegisterBurst,
+		RateLimitUploadPerMinute:              rateLimitUploadPerMinute,
+		RateLimitUploadBurst:                  rateLimitUploadBurst,
+		RateLimitFaceSearchPerMinute:          rateLimitFaceSearchPerMinute,
+		RateLimitFaceSearchBurst:              rateLimitFaceSearchBurst,
+		WebhookMaxAttempts:                    webhookMaxAttempts,
+		WebhookRetryBaseDelaySeconds:          webhookRetryBaseDelay,
+		WebhookTimeoutSeconds:                 webhookTimeout,
+		SMTPHost:                              smtpHost,
+		SMTPPort:                              smtpPort,
+		SMTPUsername:                          smtpUsername,
+		SMTPPassword:                          smtpPassword,
+		SMTPFrom:                              smtpFrom,
+		SMTPSecurity:                          smtpSecurity,
+		PasswordResetExpiryMinutes:            passwordResetExpiry,
+		EmailVerificationRequired:             emailVerificationRequired,
+		EmailVerificationExpiryHours:          emailVerificationExpiry,
 	}
 
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
 	return cfg, nil
 }
+
+// validate catches settings that would otherwise only fail once the server is running
+func (c Config) validate() error {
+	var problems []string
+
+	if portNum, err := strconv.Atoi(c.Port); err != nil || portNum < 1 || portNum > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT '%s' is not a valid port number", c.Port))
+	}
+	if info, err := os.Stat(c.RootDirectory); err != nil {
+		problems = append(problems, fmt.Sprintf("ROOT_DIRECTORY '%s' cannot be accessed: %v", c.RootDirectory, err))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("ROOT_DIRECTORY '%s' is not a directory", c.RootDirectory))
+	}
+	problems = append(problems, c.validateLibraries()...)
+	if info, err := os.Stat(c.MediaStoragePath); err == nil && !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("MEDIA_STORAGE_PATH '%s' is not a directory", c.MediaStoragePath))
+	}
+	if info, err := os.Stat(c.DatabasePath); err == nil && info.IsDir() {
+		problems = append(problems, fmt.Sprintf("DATABASE_PATH '%s' is a directory", c.DatabasePath))
+	}
+	if c.FaceDetectionConfidence < 0 || c.FaceDetectionConfidence > 1 {
+		problems = append(problems, fmt.Sprintf("FACE_DETECTION_CONFIDENCE %g must be between 0 and 1", c.FaceDetectionConfidence))
+	}
+	if c.FaceDetectionIoUThreshold < 0 || c.FaceDetectionIoUThreshold > 1 {
+		problems = append(problems, fmt.Sprintf("FACE_DETECTION_IOU_THRESHOLD %g must be between 0 and 1", c.FaceDetectionIoUThreshold))
+	}
+	if c.FaceRecognitionThreshold < 0 || c.FaceRecognitionThreshold > 1 {
+		problems = append(problems, fmt.Sprintf("FACE_RECOGNITION_THRESHOLD %g must be between 0 and 1", c.FaceRecognitionThreshold))
+	}
+	if c.CLIPMinSimilarity < -1 || c.CLIPMinSimilarity > 1 {
+		problems = append(problems, fmt.Sprintf("CLIP_MIN_SIMILARITY %g must be between -1 and 1", c.CLIPMinSimilarity))
+	}
+	if c.ClassificationMinConfidence < 0 || c.ClassificationMinConfidence > 1 {
+		problems = append(problems, fmt.Sprintf("CLASSIFICATION_MIN_CONFIDENCE %g must be between 0 and 1", c.ClassificationMinConfidence))
+	}
+	if c.ClassificationMaxTags < 1 {
+		problems = append(problems, fmt.Sprintf("CLASSIFICATION_MAX_TAGS %d must be at least 1", c.ClassificationMaxTags))
+	}
+	if c.NSFWThreshold < 0 || c.NSFWThreshold > 1 {
+		problems = append(problems, fmt.Sprintf("NSFW_THRESHOLD %g must be between 0 and 1", c.NSFWThreshold))
+	}
+	if c.GeocodingProvider == GeocodingProviderOffline {
+		if _, err := os.Stat(c.GeocodingDatasetPath); err != nil {
+			problems = append(problems, fmt.Sprintf("GEOCODING_DATASET_PATH '%s' cannot be accessed: %v", c.GeocodingDatasetPath, err))
+		}
+	}
+	if c.GeocodingMaxDistanceKm <= 0 {
+		problems = append(problems, fmt.Sprintf("GEOCODING_MAX_DISTANCE_KM %g must be positive", c.GeocodingMaxDistanceKm))
+	}
+	if c.WorkerRetryMaxDelaySeconds < c.WorkerRetryBaseDelaySeconds {
+		problems = append(problems, fmt.Sprintf("WORKER_RETRY_MAX_DELAY_SECONDS (%d) must not be less than WORKER_RETRY_BASE_DELAY_SECONDS (%d)", c.WorkerRetryMaxDelaySeconds, c.WorkerRetryBaseDelaySeconds))
+	}
+	if c.WebhookMaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_MAX_ATTEMPTS %d must be at least 1", c.WebhookMaxAttempts))
+	}
+	if c.WebhookTimeoutSeconds < 1 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_TIMEOUT_SECONDS %d must be at least 1", c.WebhookTimeoutSeconds))
+	}
+	if c.SMTPHost != "" && c.SMTPFrom == "" {
+		problems = append(problems, "SMTP_FROM must be set when SMTP_HOST is")
+	}
+	if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+		problems = append(problems, fmt.Sprintf("SMTP_PORT %d is not a valid port number", c.SMTPPort))
+	}
+	if c.PasswordResetExpiryMinutes < 1 {
+		problems = append(problems, fmt.Sprintf("PASSWORD_RESET_EXPIRY_MINUTES %d must be at least 1", c.PasswordResetExpiryMinutes))
+	}
+	if c.AssetURLSecret != "" && c.AssetURLExpirySeconds < 60 {
+		problems = append(problems, fmt.Sprintf("ASSET_URL_EXPIRY_SECONDS %d must be at least 60", c.AssetURLExpirySeconds))
+	}
+	if c.ResizeMaxSize < 1 {
+		problems = append(problems, fmt.Sprintf("RESIZE_MAX_SIZE %d must be at least 1", c.ResizeMaxSize))
+	}
+	if c.WebDownloadMaxSize < 1 {
+		problems = append(problems, fmt.Sprintf("WEB_DOWNLOAD_MAX_SIZE %d must be at least 1", c.WebDownloadMaxSize))
+	}
+	if c.WebDownloadQuality < 1 || c.WebDownloadQuality > 100 {
+		problems = append(problems, fmt.Sprintf("WEB_DOWNLOAD_QUALITY %d must be between 1 and 100", c.WebDownloadQuality))
+	}
+	for _, pattern := range c.IgnorePatterns {
+		if _, err := path.Match(pattern, ""); err != nil || strings.Contains(pattern, "/") {
+			problems = append(problems, fmt.Sprintf("IGNORE_PATTERNS entry '%s' must be a glob of file or folder names", pattern))
+		}
+	}
+	if c.CompressionLevel > 9 {
+		problems = append(problems, fmt.Sprintf("COMPRESSION_LEVEL %d must be between 0 and 9", c.CompressionLevel))
+	}
+	if c.LoginMaxFailures < 0 || c.LoginIPMaxFailures < 0 {
+		problems = append(problems, "LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must not be negative")
+	}
+	if c.LoginMaxFailures > 0 && (c.LoginFailureWindowMinutes < 1 || c.LoginLockoutMinutes < 1) {
+		problems = append(problems, "LOGIN_FAILURE_WINDOW_MINUTES and LOGIN_LOCKOUT_MINUTES must be at least 1")
+	}
+	if c.UploadQuotaMB < 0 {
+		problems = append(problems, fmt.Sprintf("UPLOAD_QUOTA_MB %d must not be negative", c.UploadQuotaMB))
+	}
+	if c.UploadMaxFileSizeMB < 0 {
+		problems = append(problems, fmt.Sprintf("UPLOAD_MAX_FILE_SIZE_MB %d must not be negative", c.UploadMaxFileSizeMB))
+	}
+	if c.UploadMaxFilesPerRequest < 0 || c.UploadMaxRequestSizeMB < 0 {
+		problems = append(problems, "UPLOAD_MAX_FILES_PER_REQUEST and UPLOAD_MAX_REQUEST_SIZE_MB must not be negative")
+	}
+	if len(c.UploadAllowedTypes) == 0 {
+		problems = append(problems, "UPLOAD_ALLOWED_TYPES must name at least one media type")
+	}
+	if c.EmailVerificationRequired && c.SMTPHost == "" {
+		problems = append(problems, "EMAIL_VERIFICATION_REQUIRED needs SMTP_HOST to send verification emails")
+	}
+	if c.EmailVerificationExpiryHours < 1 {
+		problems = append(problems, fmt.Sprintf("EMAIL_VERIFICATION_EXPIRY_HOURS %d must be at least 1", c.EmailVerificationExpiryHours))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
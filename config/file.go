@@ -0,0 +1,349 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// default config file locations, checked in order when CONFIG_FILE is not set
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// FileConfig is the schema of the optional config file. every setting maps to the
+// environment variable named in its env tag; environment variables take precedence
+// over values from the file, and unset values fall back to the built-in defaults.
+type FileConfig struct {
+	Port                    *string   `yaml:"port" toml:"port" env:"PORT"`
+	RootDirectory           *string   `yaml:"root_directory" toml:"root_directory" env:"ROOT_DIRECTORY"`
+	Libraries               *[]string `yaml:"libraries" toml:"libraries" env:"LIBRARIES"`
+	IgnorePatterns          *[]string `yaml:"ignore_patterns" toml:"ignore_patterns" env:"IGNORE_PATTERNS"`
+	SymlinkPolicy           *string   `yaml:"symlink_policy" toml:"symlink_policy" env:"SYMLINK_POLICY"`
+	DatabasePath            *string   `yaml:"database_path" toml:"database_path" env:"DATABASE_PATH"`
+	ImportPath              *string   `yaml:"import_path" toml:"import_path" env:"IMPORT_PATH"`
+	BackupPath              *string   `yaml:"backup_path" toml:"backup_path" env:"BACKUP_PATH"`
+	BackupKeep              *int      `yaml:"backup_keep" toml:"backup_keep" env:"BACKUP_KEEP"`
+	ShutdownTimeoutSeconds  *int      `yaml:"shutdown_timeout_seconds" toml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS"`
+	StatsStreamSeconds      *int      `yaml:"stats_stream_seconds" toml:"stats_stream_seconds" env:"STATS_STREAM_SECONDS"`
+	CompressionLevel        *int      `yaml:"compression_level" toml:"compression_level" env:"COMPRESSION_LEVEL"`
+	ListingCacheSeconds     *int      `yaml:"listing_cache_seconds" toml:"listing_cache_seconds" env:"LISTING_CACHE_SECONDS"`
+	BurstIntervalMs         *int      `yaml:"burst_interval_ms" toml:"burst_interval_ms" env:"BURST_INTERVAL_MS"`
+	OrphanCleanupMaxPercent *int      `yaml:"orphan_cleanup_max_percent" toml:"orphan_cleanup_max_percent" env:"ORPHAN_CLEANUP_MAX_PERCENT"`
+	CORSAllowedOrigins      *[]string `yaml:"cors_allowed_origins" toml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	PublicURL               *string   `yaml:"public_url" toml:"public_url" env:"PUBLIC_URL"`
+	ServiceMode             *string   `yaml:"service_mode" toml:"service_mode" env:"SERVICE_MODE"`
+
+	MediaStorage   fileMediaStorageConfig   `yaml:"media_storage" toml:"media_storage"`
+	Storage        fileStorageConfig        `yaml:"storage" toml:"storage"`
+	Thumbnails     fileThumbnailsConfig     `yaml:"thumbnails" toml:"thumbnails"`
+	Video          fileVideoConfig          `yaml:"video" toml:"video"`
+	Documents      fileDocumentsConfig      `yaml:"documents" toml:"documents"`
+	Workers        fileWorkersConfig        `yaml:"workers" toml:"workers"`
+	Faces          fileFacesConfig          `yaml:"faces" toml:"faces"`
+	CLIP           fileCLIPConfig           `yaml:"clip" toml:"clip"`
+	Classification fileClassificationConfig `yaml:"classification" toml:"classification"`
+	OCR            fileOCRConfig            `yaml:"ocr" toml:"ocr"`
+	NSFW           fileNSFWConfig           `yaml:"nsfw" toml:"nsfw"`
+	Geocoding      fileGeocodingConfig      `yaml:"geocoding" toml:"geocoding"`
+	Turnstile      fileTurnstileConfig      `yaml:"turnstile" toml:"turnstile"`
+	SignedURLs     fileSignedURLsConfig     `yaml:"signed_urls" toml:"signed_urls"`
+	Downloads      fileDownloadsConfig      `yaml:"downloads" toml:"downloads"`
+	RateLimit      fileRateLimitConfig      `yaml:"rate_limit" toml:"rate_limit"`
+	Login          fileLoginConfig          `yaml:"login" toml:"login"`
+	Uploads        fileUploadsConfig        `yaml:"uploads" toml:"uploads"`
+	Webhooks       fileWebhooksConfig       `yaml:"webhooks" toml:"webhooks"`
+	Email          fileEmailConfig          `yaml:"email" toml:"email"`
+	Schedule       fileScheduleConfig       `yaml:"schedule" toml:"schedule"`
+}
+
+type fileMediaStorageConfig struct {
+	Path             *string `yaml:"path" toml:"path" env:"MEDIA_STORAGE_PATH"`
+	ThumbnailsSubDir *string `yaml:"thumbnails_subdir" toml:"thumbnails_subdir" env:"THUMBNAILS_SUBDIR"`
+	BannersSubDir    *string `yaml:"banners_subdir" toml:"banners_subdir" env:"BANNERS_SUBDIR"`
+	ArchivesSubDir   *string `yaml:"archives_subdir" toml:"archives_subdir" env:"ARCHIVES_SUBDIR"`
+	VideosSubDir     *string `yaml:"videos_subdir" toml:"videos_subdir" env:"VIDEOS_SUBDIR"`
+	AvatarsSubDir    *string `yaml:"avatars_subdir" toml:"avatars_subdir" env:"AVATARS_SUBDIR"`
+	ResizedSubDir    *string `yaml:"resized_subdir" toml:"resized_subdir" env:"RESIZED_SUBDIR"`
+	WatermarksSubDir *string `yaml:"watermarks_subdir" toml:"watermarks_subdir" env:"WATERMARKS_SUBDIR"`
+	StreamsSubDir    *string `yaml:"streams_subdir" toml:"streams_subdir" env:"STREAMS_SUBDIR"`
+}
+
+type fileStorageConfig struct {
+	Backend *string      `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND"`
+	S3      fileS3Config `yaml:"s3" toml:"s3"`
+}
+
+type fileS3Config struct {
+	Endpoint             *string `yaml:"endpoint" toml:"endpoint" env:"S3_ENDPOINT"`
+	Region               *string `yaml:"region" toml:"region" env:"S3_REGION"`
+	Bucket               *string `yaml:"bucket" toml:"bucket" env:"S3_BUCKET"`
+	Prefix               *string `yaml:"prefix" toml:"prefix" env:"S3_PREFIX"`
+	AccessKeyID          *string `yaml:"access_key_id" toml:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey      *string `yaml:"secret_access_key" toml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	UsePathStyle         *bool   `yaml:"use_path_style" toml:"use_path_style" env:"S3_USE_PATH_STYLE"`
+	PresignExpirySeconds *int    `yaml:"presign_expiry_seconds" toml:"presign_expiry_seconds" env:"S3_PRESIGN_EXPIRY_SECONDS"`
+}
+
+type fileThumbnailsConfig struct {
+	MaxSize       *int      `yaml:"max_size" toml:"max_size" env:"THUMBNAIL_MAX_SIZE"`
+	Sizes         *[]int    `yaml:"sizes" toml:"sizes" env:"THUMBNAIL_SIZES"`
+	Formats       *[]string `yaml:"formats" toml:"formats" env:"THUMBNAIL_FORMATS"`
+	ResizeMaxSize *int      `yaml:"resize_max_size" toml:"resize_max_size" env:"RESIZE_MAX_SIZE"`
+	ResizeSizes   *[]int    `yaml:"resize_sizes" toml:"resize_sizes" env:"RESIZE_SIZES"`
+}
+
+type fileVideoConfig struct {
+	FFmpegPath         *string `yaml:"ffmpeg_path" toml:"ffmpeg_path" env:"FFMPEG_PATH"`
+	FFprobePath        *string `yaml:"ffprobe_path" toml:"ffprobe_path" env:"FFPROBE_PATH"`
+	TranscodeEnabled   *bool   `yaml:"transcode_enabled" toml:"transcode_enabled" env:"VIDEO_TRANSCODE_ENABLED"`
+	TranscodeMaxHeight *int    `yaml:"transcode_max_height" toml:"transcode_max_height" env:"VIDEO_TRANSCODE_MAX_HEIGHT"`
+	HLSEnabled         *bool   `yaml:"hls_enabled" toml:"hls_enabled" env:"VIDEO_HLS_ENABLED"`
+	HLSMinDuration     *int    `yaml:"hls_min_duration_seconds" toml:"hls_min_duration_seconds" env:"VIDEO_HLS_MIN_DURATION_SECONDS"`
+	HLSHeights         *[]int  `yaml:"hls_heights" toml:"hls_heights" env:"VIDEO_HLS_HEIGHTS"`
+}
+
+type fileDocumentsConfig struct {
+	PdftoppmPath *string `yaml:"pdftoppm_path" toml:"pdftoppm_path" env:"PDFTOPPM_PATH"`
+}
+
+type fileWorkersConfig struct {
+	Count                 *int    `yaml:"count" toml:"count" env:"NUM_THUMBNAIL_WORKERS"`
+	QueueSize             *int    `yaml:"queue_size" toml:"queue_size" env:"THUMBNAIL_QUEUE_SIZE"`
+	MaxAttempts           *int    `yaml:"max_attempts" toml:"max_attempts" env:"WORKER_MAX_ATTEMPTS"`
+	RetryBaseDelaySeconds *int    `yaml:"retry_base_delay_seconds" toml:"retry_base_delay_seconds" env:"WORKER_RETRY_BASE_DELAY_SECONDS"`
+	RetryMaxDelaySeconds  *int    `yaml:"retry_max_delay_seconds" toml:"retry_max_delay_seconds" env:"WORKER_RETRY_MAX_DELAY_SECONDS"`
+	QueueStatePath        *string `yaml:"queue_state_path" toml:"queue_state_path" env:"QUEUE_STATE_PATH"`
+}
+
+type fileFacesConfig struct {
+	DNNConfigPath        *string  `yaml:"dnn_config_path" toml:"dnn_config_path" env:"FACE_DNN_CONFIG_PATH"`
+	DNNModelPath         *string  `yaml:"dnn_model_path" toml:"dnn_model_path" env:"FACE_DNN_MODEL_PATH"`
+	RetinaFaceModelPath  *string  `yaml:"retinaface_model_path" toml:"retinaface_model_path" env:"RETINAFACE_MODEL_PATH"`
+	DetectionConfidence  *float64 `yaml:"detection_confidence" toml:"detection_confidence" env:"FACE_DETECTION_CONFIDENCE"`
+	DetectionIoU         *float64 `yaml:"detection_iou_threshold" toml:"detection_iou_threshold" env:"FACE_DETECTION_IOU_THRESHOLD"`
+	RecognitionEnabled   *bool    `yaml:"recognition_enabled" toml:"recognition_enabled" env:"FACE_RECOGNITION_ENABLED"`
+	RecognitionModelPath *string  `yaml:"recognition_model_path" toml:"recognition_model_path" env:"FACE_RECOGNITION_MODEL_PATH"`
+	RecognitionModelName *string  `yaml:"recognition_model_name" toml:"recognition_model_name" env:"FACE_RECOGNITION_MODEL_NAME"`
+	RecognitionThreshold *float64 `yaml:"recognition_threshold" toml:"recognition_threshold" env:"FACE_RECOGNITION_THRESHOLD"`
+}
+
+type fileCLIPConfig struct {
+	Enabled        *bool    `yaml:"enabled" toml:"enabled" env:"CLIP_ENABLED"`
+	ImageModelPath *string  `yaml:"image_model_path" toml:"image_model_path" env:"CLIP_IMAGE_MODEL_PATH"`
+	TextModelPath  *string  `yaml:"text_model_path" toml:"text_model_path" env:"CLIP_TEXT_MODEL_PATH"`
+	VocabPath      *string  `yaml:"vocab_path" toml:"vocab_path" env:"CLIP_VOCAB_PATH"`
+	MinSimilarity  *float64 `yaml:"min_similarity" toml:"min_similarity" env:"CLIP_MIN_SIMILARITY"`
+}
+
+type fileClassificationConfig struct {
+	Enabled       *bool    `yaml:"enabled" toml:"enabled" env:"CLASSIFICATION_ENABLED"`
+	ModelPath     *string  `yaml:"model_path" toml:"model_path" env:"CLASSIFICATION_MODEL_PATH"`
+	LabelsPath    *string  `yaml:"labels_path" toml:"labels_path" env:"CLASSIFICATION_LABELS_PATH"`
+	ModelName     *string  `yaml:"model_name" toml:"model_name" env:"CLASSIFICATION_MODEL_NAME"`
+	MinConfidence *float64 `yaml:"min_confidence" toml:"min_confidence" env:"CLASSIFICATION_MIN_CONFIDENCE"`
+	MaxTags       *int     `yaml:"max_tags" toml:"max_tags" env:"CLASSIFICATION_MAX_TAGS"`
+}
+
+type fileOCRConfig struct {
+	Enabled       *bool   `yaml:"enabled" toml:"enabled" env:"OCR_ENABLED"`
+	TesseractPath *string `yaml:"tesseract_path" toml:"tesseract_path" env:"TESSERACT_PATH"`
+	Languages     *string `yaml:"languages" toml:"languages" env:"OCR_LANGUAGES"`
+}
+
+type fileNSFWConfig struct {
+	Enabled    *bool    `yaml:"enabled" toml:"enabled" env:"NSFW_ENABLED"`
+	ModelPath  *string  `yaml:"model_path" toml:"model_path" env:"NSFW_MODEL_PATH"`
+	Classes    *[]int   `yaml:"classes" toml:"classes" env:"NSFW_CLASSES"`
+	Threshold  *float64 `yaml:"threshold" toml:"threshold" env:"NSFW_THRESHOLD"`
+	HidePublic *bool    `yaml:"hide_public" toml:"hide_public" env:"NSFW_HIDE_PUBLIC"`
+}
+
+type fileGeocodingConfig struct {
+	Provider      *string  `yaml:"provider" toml:"provider" env:"GEOCODING_PROVIDER"`
+	URL           *string  `yaml:"url" toml:"url" env:"GEOCODING_URL"`
+	UserAgent     *string  `yaml:"user_agent" toml:"user_agent" env:"GEOCODING_USER_AGENT"`
+	DatasetPath   *string  `yaml:"dataset_path" toml:"dataset_path" env:"GEOCODING_DATASET_PATH"`
+	MaxDistanceKm *float64 `yaml:"max_distance_km" toml:"max_distance_km" env:"GEOCODING_MAX_DISTANCE_KM"`
+}
+
+type fileTurnstileConfig struct {
+	SiteKey   *string `yaml:"site_key" toml:"site_key" env:"TURNSTILE_SITE_KEY"`
+	SecretKey *string `yaml:"secret_key" toml:"secret_key" env:"TURNSTILE_SECRET_KEY"`
+}
+
+type fileSignedURLsConfig struct {
+	Secret        *string `yaml:"secret" toml:"secret" env:"ASSET_URL_SECRET"`
+	ExpirySeconds *int    `yaml:"expiry_seconds" toml:"expiry_seconds" env:"ASSET_URL_EXPIRY_SECONDS"`
+}
+
+type fileDownloadsConfig struct {
+	WebMaxSize             *int  `yaml:"web_max_size" toml:"web_max_size" env:"WEB_DOWNLOAD_MAX_SIZE"`
+	WebQuality             *int  `yaml:"web_quality" toml:"web_quality" env:"WEB_DOWNLOAD_QUALITY"`
+	WebEmbedRights         *bool `yaml:"web_embed_rights" toml:"web_embed_rights" env:"WEB_DOWNLOAD_EMBED_RIGHTS"`
+	ZipStreamMaxConcurrent *int  `yaml:"zip_stream_max_concurrent" toml:"zip_stream_max_concurrent" env:"ZIP_STREAM_MAX_CONCURRENT"`
+}
+
+type fileRateLimitConfig struct {
+	Enabled             *bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	LoginPerMinute      *int  `yaml:"login_per_minute" toml:"login_per_minute" env:"RATE_LIMIT_LOGIN_PER_MINUTE"`
+	LoginBurst          *int  `yaml:"login_burst" toml:"login_burst" env:"RATE_LIMIT_LOGIN_BURST"`
+	RegisterPerMinute   *int  `yaml:"register_per_minute" toml:"register_per_minute" env:"RATE_LIMIT_REGISTER_PER_MINUTE"`
+	RegisterBurst       *int  `yaml:"register_burst" toml:"register_burst" env:"RATE_LIMIT_REGISTER_BURST"`
+	UploadPerMinute     *int  `yaml:"upload_per_minute" toml:"upload_per_minute" env:"RATE_LIMIT_UPLOAD_PER_MINUTE"`
+	UploadBurst         *int  `yaml:"upload_burst" toml:"upload_burst" env:"RATE_LIMIT_UPLOAD_BURST"`
+	FaceSearchPerMinute *int  `yaml:"face_search_per_minute" toml:"face_search_per_minute" env:"RATE_LIMIT_FACE_SEARCH_PER_MINUTE"`
+	FaceSearchBurst     *int  `yaml:"face_search_burst" toml:"face_search_burst" env:"RATE_LIMIT_FACE_SEARCH_BURST"`
+}
+
+type fileLoginConfig struct {
+	MaxFailures          *int `yaml:"max_failures" toml:"max_failures" env:"LOGIN_MAX_FAILURES"`
+	IPMaxFailures        *int `yaml:"ip_max_failures" toml:"ip_max_failures" env:"LOGIN_IP_MAX_FAILURES"`
+	FailureWindowMinutes *int `yaml:"failure_window_minutes" toml:"failure_window_minutes" env:"LOGIN_FAILURE_WINDOW_MINUTES"`
+	LockoutMinutes       *int `yaml:"lockout_minutes" toml:"lockout_minutes" env:"LOGIN_LOCKOUT_MINUTES"`
+}
+
+type fileUploadsConfig struct {
+	QuotaMB       *int      `yaml:"quota_mb" toml:"quota_mb" env:"UPLOAD_QUOTA_MB"`
+	MaxFileSizeMB *int      `yaml:"max_file_size_mb" toml:"max_file_size_mb" env:"UPLOAD_MAX_FILE_SIZE_MB"`
+	AllowedTypes  *[]string `yaml:"allowed_types" toml:"allowed_types" env:"UPLOAD_ALLOWED_TYPES"`
+	MaxFiles      *int      `yaml:"max_files_per_request" toml:"max_files_per_request" env:"UPLOAD_MAX_FILES_PER_REQUEST"`
+	MaxRequestMB  *int      `yaml:"max_request_size_mb" toml:"max_request_size_mb" env:"UPLOAD_MAX_REQUEST_SIZE_MB"`
+}
+
+type fileWebhooksConfig struct {
+	MaxAttempts           *int `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryBaseDelaySeconds *int `yaml:"retry_base_delay_seconds" toml:"retry_base_delay_seconds" env:"WEBHOOK_RETRY_BASE_DELAY_SECONDS"`
+	TimeoutSeconds        *int `yaml:"timeout_seconds" toml:"timeout_seconds" env:"WEBHOOK_TIMEOUT_SECONDS"`
+}
+
+type fileEmailConfig struct {
+	SMTPHost                   *string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort                   *int    `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername               *string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword               *string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD"`
+	SMTPFrom                   *string `yaml:"smtp_from" toml:"smtp_from" env:"SMTP_FROM"`
+	SMTPSecurity               *string `yaml:"smtp_security" toml:"smtp_security" env:"SMTP_SECURITY"`
+	PasswordResetExpiryMinutes *int    `yaml:"password_reset_expiry_minutes" toml:"password_reset_expiry_minutes" env:"PASSWORD_RESET_EXPIRY_MINUTES"`
+	VerificationRequired       *bool   `yaml:"verification_required" toml:"verification_required" env:"EMAIL_VERIFICATION_REQUIRED"`
+	VerificationExpiryHours    *int    `yaml:"verification_expiry_hours" toml:"verification_expiry_hours" env:"EMAIL_VERIFICATION_EXPIRY_HOURS"`
+}
+
+type fileScheduleConfig struct {
+	LibraryRescanMinutes          *int `yaml:"library_rescan_minutes" toml:"library_rescan_minutes" env:"SCHEDULE_LIBRARY_RESCAN_MINUTES"`
+	OrphanCleanupMinutes          *int `yaml:"orphan_cleanup_minutes" toml:"orphan_cleanup_minutes" env:"SCHEDULE_ORPHAN_CLEANUP_MINUTES"`
+	ZipRefreshMinutes             *int `yaml:"zip_refresh_minutes" toml:"zip_refresh_minutes" env:"SCHEDULE_ZIP_REFRESH_MINUTES"`
+	EmbeddingBackfillMinutes      *int `yaml:"embedding_backfill_minutes" toml:"embedding_backfill_minutes" env:"SCHEDULE_EMBEDDING_BACKFILL_MINUTES"`
+	IntegrityCheckMinutes         *int `yaml:"integrity_check_minutes" toml:"integrity_check_minutes" env:"SCHEDULE_INTEGRITY_CHECK_MINUTES"`
+	GeocodeBackfillMinutes        *int `yaml:"geocode_backfill_minutes" toml:"geocode_backfill_minutes" env:"SCHEDULE_GEOCODE_BACKFILL_MINUTES"`
+	FaceClusteringMinutes         *int `yaml:"face_clustering_minutes" toml:"face_clustering_minutes" env:"SCHEDULE_FACE_CLUSTERING_MINUTES"`
+	FaceSuggestionsMinutes        *int `yaml:"face_suggestions_minutes" toml:"face_suggestions_minutes" env:"SCHEDULE_FACE_SUGGESTIONS_MINUTES"`
+	ClassificationBackfillMinutes *int `yaml:"classification_backfill_minutes" toml:"classification_backfill_minutes" env:"SCHEDULE_CLASSIFICATION_BACKFILL_MINUTES"`
+	OCRBackfillMinutes            *int `yaml:"ocr_backfill_minutes" toml:"ocr_backfill_minutes" env:"SCHEDULE_OCR_BACKFILL_MINUTES"`
+	NSFWBackfillMinutes           *int `yaml:"nsfw_backfill_minutes" toml:"nsfw_backfill_minutes" env:"SCHEDULE_NSFW_BACKFILL_MINUTES"`
+}
+
+// values from the loaded config file keyed by environment variable name, consulted by
+// the getEnv helpers when the variable itself is not set
+var fileSettings map[string]string
+
+// findConfigFile returns the config file to load: CONFIG_FILE if set (which must exist),
+// otherwise the first default location that exists. returns "" if there is none.
+func findConfigFile() (string, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file '%s' from CONFIG_FILE cannot be read: %w", path, err)
+		}
+		return path, nil
+	}
+	for _, path := range defaultConfigFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// loadConfigFile parses a YAML or TOML config file, chosen by extension. unknown keys
+// and values of the wrong type are errors.
+func loadConfigFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+
+	var fc FileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &fc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("invalid config file '%s': unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file '%s': extension must be .yaml, .yml or .toml", path)
+	}
+	return &fc, nil
+}
+
+// settings flattens the file values that are set into a map keyed by environment variable name
+func (fc *FileConfig) settings() map[string]string {
+	settings := make(map[string]string)
+	collectSettings(reflect.ValueOf(fc).Elem(), settings)
+	return settings
+}
+
+func collectSettings(v reflect.Value, settings map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			collectSettings(field, settings)
+			continue
+		}
+		envVar := t.Field(i).Tag.Get("env")
+		if envVar == "" || field.IsNil() {
+			continue
+		}
+		if list, ok := field.Elem().Interface().([]string); ok {
+			settings[envVar] = strings.Join(list, ",")
+			continue
+		}
+		if list, ok := field.Elem().Interface().([]int); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = strconv.Itoa(item)
+			}
+			settings[envVar] = strings.Join(items, ",")
+			continue
+		}
+		settings[envVar] = fmt.Sprint(field.Elem().Interface())
+	}
+}
+
+// lookupSetting returns the environment variable if set, otherwise the config file value
+func lookupSetting(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileSettings[key]
+}
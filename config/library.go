@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/utils"
+)
+
+// DefaultLibraryID is the ID of the library rooted at ROOT_DIRECTORY
+const DefaultLibraryID = "default"
+
+var libraryIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Library is a named root directory media is served from. the default library is mounted
+// at the top of the relative path space and every other library appears in it as a top
+// level folder named after its ID, so "archive/2019/a.jpg" is "2019/a.jpg" of the archive
+// library. image records, album folders and API paths all use these relative paths.
+type Library struct {
+	ID   string `json:"id"`
+	Path string `json:"path"` // absolute
+}
+
+// parseLibraries reads "id=path" entries into libraries, after the default one at absRoot
+func parseLibraries(entries []string, absRoot string) ([]Library, error) {
+	libraries := []Library{{ID: DefaultLibraryID, Path: absRoot}}
+	seen := map[string]bool{DefaultLibraryID: true}
+	for _, entry := range entries {
+		id, dir, ok := strings.Cut(entry, "=")
+		id = strings.TrimSpace(id)
+		dir = strings.TrimSpace(dir)
+		if !ok || id == "" || dir == "" {
+			return nil, fmt.Errorf("invalid LIBRARIES entry '%s': must be id=path", entry)
+		}
+		if !libraryIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid library ID '%s': use lower case letters, digits, '-' and '_'", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("library ID '%s' is used more than once", id)
+		}
+		seen[id] = true
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for library '%s': %w", id, err)
+		}
+		libraries = append(libraries, Library{ID: id, Path: absDir})
+	}
+	return libraries, nil
+}
+
+// validateLibraries reports libraries that can't be read or would overlap with another one
+func (c Config) validateLibraries() []string {
+	var problems []string
+	for _, lib := range c.Libraries {
+		if lib.ID == DefaultLibraryID {
+			continue
+		}
+		if info, err := os.Stat(lib.Path); err != nil {
+			problems = append(problems, fmt.Sprintf("library '%s' path '%s' cannot be accessed: %v", lib.ID, lib.Path, err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("library '%s' path '%s' is not a directory", lib.ID, lib.Path))
+		}
+		if utils.IsWithin(c.RootDirectory, lib.Path) || utils.IsWithin(lib.Path, c.RootDirectory) {
+			problems = append(problems, fmt.Sprintf("library '%s' path '%s' overlaps ROOT_DIRECTORY", lib.ID, lib.Path))
+		}
+		// a folder of the default library with the same name would be hidden by the library
+		if _, err := os.Stat(filepath.Join(c.RootDirectory, lib.ID)); err == nil {
+			problems = append(problems, fmt.Sprintf("library '%s' conflicts with the folder of the same name in ROOT_DIRECTORY", lib.ID))
+		}
+	}
+	return problems
+}
+
+// LibraryByID returns the library with the given ID
+func (c Config) LibraryByID(id string) (Library, bool) {
+	for _, lib := range c.Libraries {
+		if lib.ID == id {
+			return lib, true
+		}
+	}
+	return Library{}, false
+}
+
+// SplitPath returns the library a relative path belongs to and the slash separated path
+// inside that library. paths can't climb above the top, so ".." segments never leave a
+// library.
+func (c Config) SplitPath(relPath string) (Library, string) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(relPath)), "/")
+	first, rest, _ := strings.Cut(cleaned, "/")
+	for _, lib := range c.Libraries {
+		if lib.ID != DefaultLibraryID && lib.ID == first {
+			return lib, rest
+		}
+	}
+	if lib, ok := c.LibraryByID(DefaultLibraryID); ok {
+		return lib, cleaned
+	}
+	// configs built without LoadConfig only know RootDirectory
+	return Library{ID: DefaultLibraryID, Path: c.RootDirectory}, cleaned
+}
+
+// ResolvePath returns the absolute path of a relative path
+func (c Config) ResolvePath(relPath string) string {
+	lib, inner := c.SplitPath(relPath)
+	return filepath.Join(lib.Path, filepath.FromSlash(inner))
+}
+
+// RelativePath turns an absolute path inside one of the libraries into its slash separated
+// relative path, e.g. the key of an image record. fails for paths outside every library.
+func (c Config) RelativePath(fullPath string) (string, error) {
+	fullPath = filepath.Clean(fullPath)
+	for _, lib := range c.Libraries {
+		if lib.ID == DefaultLibraryID || !utils.IsWithin(lib.Path, fullPath) {
+			continue
+		}
+		rel, err := filepath.Rel(lib.Path, fullPath)
+		if err != nil {
+			return "", err
+		}
+		if rel == "." {
+			return lib.ID, nil
+		}
+		return lib.ID + "/" + filepath.ToSlash(rel), nil
+	}
+	if !utils.IsWithin(c.RootDirectory, fullPath) {
+		return "", fmt.Errorf("'%s' is outside of every library", fullPath)
+	}
+	rel, err := filepath.Rel(c.RootDirectory, fullPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// LibraryPath returns the relative path of a folder inside a library
+func (l Library) LibraryPath(inner string) string {
+	inner = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(inner)), "/")
+	if l.ID == DefaultLibraryID {
+		return inner
+	}
+	if inner == "" {
+		return l.ID
+	}
+	return l.ID + "/" + inner
+}
+
+// ExtraLibraries returns every library except the default one, the top level folders that
+// don't exist in ROOT_DIRECTORY
+func (c Config) ExtraLibraries() []Library {
+	var extra []Library
+	for _, lib := range c.Libraries {
+		if lib.ID != DefaultLibraryID {
+			extra = append(extra, lib)
+		}
+	}
+	return extra
+}
+
+// IsIgnored reports whether a file or folder name matches one of IgnorePatterns, ignoring
+// case. ignored files are left out of listings, library scans and album archives, and are
+// never processed.
+func (c Config) IsIgnored(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range c.IgnorePatterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIgnoredPath reports whether any segment of a relative path is an ignored name
+func (c Config) IsIgnoredPath(relPath string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if segment != "" && segment != "." && c.IsIgnored(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSymlink reports whether the symlink at linkPath is followed under SymlinkPolicy:
+// never when symlinks are skipped, otherwise when it points inside a library
+func (c Config) AllowsSymlink(linkPath string) bool {
+	if c.SymlinkPolicy == SymlinkPolicySkip {
+		return false
+	}
+	target, err := filepath.EvalSymlinks(linkPath)
+	return err == nil && c.withinRealLibrary(target)
+}
+
+// CheckSymlinks checks that a path inside a library only goes through symlinks that
+// SymlinkPolicy follows. for a path that doesn't exist yet, e.g. the destination of an
+// upload, the part that exists is checked. a path going through any other symlink fails with
+// a *fs.PathError wrapping fs.ErrPermission, so os.IsPermission reports it.
+func (c Config) CheckSymlinks(fullPath string) error {
+	existing := filepath.Clean(fullPath)
+	real, err := filepath.EvalSymlinks(existing)
+	for errors.Is(err, fs.ErrNotExist) && existing != filepath.Dir(existing) {
+		existing = filepath.Dir(existing)
+		real, err = filepath.EvalSymlinks(existing)
+	}
+	if err != nil {
+		return err
+	}
+
+	allowed := false
+	if c.SymlinkPolicy == SymlinkPolicySkip {
+		// without symlinks on the way the real path is the same path under the real library root
+		if lib, ok := c.containingLibrary(existing); ok {
+			rel, err := filepath.Rel(lib.Path, existing)
+			allowed = err == nil && real == filepath.Join(realPath(lib.Path), rel)
+		}
+	} else {
+		allowed = c.withinRealLibrary(real)
+	}
+	if !allowed {
+		return &fs.PathError{Op: "follow symlink", Path: fullPath, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// containingLibrary returns the library a path is in, going by the path alone
+func (c Config) containingLibrary(fullPath string) (Library, bool) {
+	for _, lib := range c.libraries() {
+		if lib.ID != DefaultLibraryID && utils.IsWithin(lib.Path, fullPath) {
+			return lib, true
+		}
+	}
+	for _, lib := range c.libraries() {
+		if lib.ID == DefaultLibraryID && utils.IsWithin(lib.Path, fullPath) {
+			return lib, true
+		}
+	}
+	return Library{}, false
+}
+
+// libraries returns the libraries, or the default one at RootDirectory for configs built
+// without LoadConfig
+func (c Config) libraries() []Library {
+	if len(c.Libraries) == 0 {
+		return []Library{{ID: DefaultLibraryID, Path: c.RootDirectory}}
+	}
+	return c.Libraries
+}
+
+// withinRealLibrary reports whether a path without symlinks is inside one of the libraries,
+// wherever their root directories really are
+func (c Config) withinRealLibrary(real string) bool {
+	for _, lib := range c.libraries() {
+		if utils.IsWithin(realPath(lib.Path), real) {
+			return true
+		}
+	}
+	return false
+}
+
+// realPath resolves the symlinks of a path, returning it unchanged if that fails
+func realPath(p string) string {
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		return real
+	}
+	return p
+}
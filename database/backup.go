@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// ErrCorruptDatabase is returned when a database file fails the SQLite integrity check
+var ErrCorruptDatabase = errors.New("database file failed the integrity check")
+
+// SnapshotDatabase writes a consistent copy of the database to dest, which must not exist.
+// the WAL is checkpointed first, so the copy holds every committed transaction. writers
+// may carry on while the copy is made; their changes are left out of it.
+func SnapshotDatabase(db *gorm.DB, dest string) error {
+	// a no-op for databases not in WAL mode
+	if err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error; err != nil {
+		return fmt.Errorf("failed to checkpoint the WAL: %w", err)
+	}
+	if err := db.Exec("VACUUM INTO ?", dest).Error; err != nil {
+		return fmt.Errorf("failed to copy the database to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// openReadOnly opens a database file without creating or changing it
+func openReadOnly(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+}
+
+// CheckDatabaseFile runs the SQLite integrity check on a database file, e.g. a snapshot
+// about to be restored. returns ErrCorruptDatabase if the check finds problems.
+func CheckDatabaseFile(path string) error {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", ErrCorruptDatabase, result)
+	}
+	return nil
+}
+
+// RestoreDatabase replaces the contents of the open database with the database file at
+// src, using the SQLite online backup API. the copy is made in one step while holding the
+// write lock, so other connections see either the old or the restored database, never a
+// mix. callers migrate the restored schema afterwards, as src may be older.
+func RestoreDatabase(db *gorm.DB, src string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB from GORM: %w", err)
+	}
+	srcDB, err := openReadOnly(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer srcDB.Close()
+
+	ctx := context.Background()
+	destConn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer destConn.Close()
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			dest, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			source, ok2 := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("restoring needs the sqlite3 driver")
+			}
+			backup, err := dest.Backup("main", source, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start restoring %s: %w", src, err)
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to restore %s: %w", src, err)
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish restoring %s: %w", src, err)
+			}
+			return nil
+		})
+	})
+}
@@ -7,3 +7,10 @@ const (
 	StatusDone        = "done"
 	StatusError       = "error"
 )
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+	// PDFs, listed with a preview of their first page
+	MediaTypeDocument = "document"
+)
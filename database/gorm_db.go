@@ -54,18 +54,41 @@ func AutoMigrateModels(db *gorm.DB) error {
 		&models.Alias{},
 		&models.Face{},
 		&models.FaceEmbedding{},
+		&models.FaceSuggestion{},
+		&models.ImageEmbedding{},
 		&models.Image{},
 		&models.Album{},
+		&models.AlbumSlugRedirect{},
 		&models.User{},
 		&models.UserAlbumPermission{},
 		&models.Role{},
 		&models.UserRole{},
 		&models.RoleAlbumPermission{},
 		&models.InviteCode{},
+		&models.ShareLink{},
+		&models.ApiToken{},
+		&models.Setting{},
+		&models.SmartAlbum{},
+		&models.Tag{},
+		&models.ImageTag{},
+		&models.MachineTag{},
+		&models.ImageRating{},
+		&models.Activity{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.NotificationPreference{},
+		&models.ZipWatcher{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.LoginFailure{},
+		&models.SyncChange{},
 	)
 	if err != nil {
 		return fmt.Errorf("GORM AutoMigrate failed: %w", err)
 	}
+	if err := EnsureSyncLog(db); err != nil {
+		return err
+	}
 	log.Println("GORM AutoMigrate completed successfully.")
 	return nil
 }
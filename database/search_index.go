@@ -0,0 +1,137 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrFTS5Unavailable is returned by EnsureSearchIndex when SQLite was built without FTS5,
+// e.g. when the binary was not built with the sqlite_fts5 tag
+var ErrFTS5Unavailable = errors.New("SQLite FTS5 module is not available")
+
+// the search index is one FTS5 table per searchable entity. each row shares its rowid with
+// the indexed record and is kept in sync by triggers.
+const (
+	searchImageBody  = "trim(coalesce(%[1]s.camera_make, '') || ' ' || coalesce(%[1]s.camera_model, '') || ' ' || coalesce(%[1]s.lens_make, '') || ' ' || coalesce(%[1]s.lens_model, '') || ' ' || coalesce(%[1]s.ocr_text, ''))"
+	searchAlbumBody  = "coalesce(%[1]s.description, '') || ' ' || %[1]s.folder_path"
+	searchPersonBody = "coalesce((SELECT group_concat(name, ' ') FROM aliases WHERE aliases.person_id = %[1]s), '')"
+)
+
+var searchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS search_images USING fts5(ref UNINDEXED, title, body, tokenize = 'unicode61 remove_diacritics 2')`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS search_albums USING fts5(title, body, tokenize = 'unicode61 remove_diacritics 2')`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS search_people USING fts5(title, body, tokenize = 'unicode61 remove_diacritics 2')`,
+
+	// images: the path is the title, so file and folder names are searchable, and the camera
+	// metadata and the text read by OCR are the body. the triggers are created again on every
+	// start, so databases created before a column was indexed pick it up.
+	`DROP TRIGGER IF EXISTS search_images_ai`,
+	`DROP TRIGGER IF EXISTS search_images_au`,
+	`CREATE TRIGGER IF NOT EXISTS search_images_ai AFTER INSERT ON images WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_images(rowid, ref, title, body) VALUES (new.rowid, new.original_path, new.original_path, ` + fmt.Sprintf(searchImageBody, "new") + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_images_au AFTER UPDATE OF original_path, camera_make, camera_model, lens_make, lens_model, ocr_text, deleted_at ON images BEGIN
+		DELETE FROM search_images WHERE rowid = old.rowid;
+		INSERT INTO search_images(rowid, ref, title, body) SELECT new.rowid, new.original_path, new.original_path, ` + fmt.Sprintf(searchImageBody, "new") + ` WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_images_ad AFTER DELETE ON images BEGIN
+		DELETE FROM search_images WHERE rowid = old.rowid;
+	END`,
+
+	`CREATE TRIGGER IF NOT EXISTS search_albums_ai AFTER INSERT ON albums WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_albums(rowid, title, body) VALUES (new.id, new.name, ` + fmt.Sprintf(searchAlbumBody, "new") + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_albums_au AFTER UPDATE OF name, description, folder_path, deleted_at ON albums BEGIN
+		DELETE FROM search_albums WHERE rowid = old.id;
+		INSERT INTO search_albums(rowid, title, body) SELECT new.id, new.name, ` + fmt.Sprintf(searchAlbumBody, "new") + ` WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_albums_ad AFTER DELETE ON albums BEGIN
+		DELETE FROM search_albums WHERE rowid = old.id;
+	END`,
+
+	// people: the primary name is the title and the aliases are the body
+	`CREATE TRIGGER IF NOT EXISTS search_people_ai AFTER INSERT ON people BEGIN
+		INSERT INTO search_people(rowid, title, body) VALUES (new.id, new.primary_name, ` + fmt.Sprintf(searchPersonBody, "new.id") + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_people_au AFTER UPDATE OF primary_name ON people BEGIN
+		DELETE FROM search_people WHERE rowid = old.id;
+		INSERT INTO search_people(rowid, title, body) VALUES (new.id, new.primary_name, ` + fmt.Sprintf(searchPersonBody, "new.id") + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_people_ad AFTER DELETE ON people BEGIN
+		DELETE FROM search_people WHERE rowid = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_aliases_ai AFTER INSERT ON aliases BEGIN
+		UPDATE search_people SET body = ` + fmt.Sprintf(searchPersonBody, "new.person_id") + ` WHERE rowid = new.person_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_aliases_au AFTER UPDATE ON aliases BEGIN
+		UPDATE search_people SET body = ` + fmt.Sprintf(searchPersonBody, "old.person_id") + ` WHERE rowid = old.person_id;
+		UPDATE search_people SET body = ` + fmt.Sprintf(searchPersonBody, "new.person_id") + ` WHERE rowid = new.person_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_aliases_ad AFTER DELETE ON aliases BEGIN
+		UPDATE search_people SET body = ` + fmt.Sprintf(searchPersonBody, "old.person_id") + ` WHERE rowid = old.person_id;
+	END`,
+}
+
+// EnsureSearchIndex creates the full-text search tables and their triggers, and rebuilds the
+// index when it is out of step with the indexed tables, e.g. on first start. it must run
+// after AutoMigrateModels. returns ErrFTS5Unavailable if SQLite has no FTS5 support.
+func EnsureSearchIndex(db *gorm.DB) error {
+	if err := db.Exec(searchIndexStatements[0]).Error; err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return ErrFTS5Unavailable
+		}
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+	for _, statement := range searchIndexStatements[1:] {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create search index: %w", err)
+		}
+	}
+
+	// image rowids are not stable across a VACUUM, so a mismatch in counts triggers a rebuild too
+	stale := false
+	for _, check := range []string{
+		"SELECT (SELECT count(*) FROM search_images) != (SELECT count(*) FROM images WHERE deleted_at IS NULL)",
+		"SELECT (SELECT count(*) FROM search_albums) != (SELECT count(*) FROM albums WHERE deleted_at IS NULL)",
+		"SELECT (SELECT count(*) FROM search_people) != (SELECT count(*) FROM people)",
+	} {
+		var mismatch bool
+		if err := db.Raw(check).Scan(&mismatch).Error; err != nil {
+			return fmt.Errorf("failed to check search index: %w", err)
+		}
+		stale = stale || mismatch
+	}
+	if stale {
+		return RebuildSearchIndex(db)
+	}
+	return nil
+}
+
+// RebuildSearchIndex refills the full-text search tables from the indexed tables
+func RebuildSearchIndex(db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"DELETE FROM search_images",
+			"INSERT INTO search_images(rowid, ref, title, body) SELECT rowid, original_path, original_path, " + fmt.Sprintf(searchImageBody, "images") + " FROM images WHERE deleted_at IS NULL",
+			"DELETE FROM search_albums",
+			"INSERT INTO search_albums(rowid, title, body) SELECT id, name, " + fmt.Sprintf(searchAlbumBody, "albums") + " FROM albums WHERE deleted_at IS NULL",
+			"DELETE FROM search_people",
+			"INSERT INTO search_people(rowid, title, body) SELECT id, primary_name, " + fmt.Sprintf(searchPersonBody, "people.id") + " FROM people",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	log.Println("Search index rebuilt.")
+	return nil
+}
@@ -5,6 +5,7 @@ const (
 	SortFilenameNat = "filename_nat"
 	SortDateDesc    = "date_desc"
 	SortDateAsc     = "date_asc"
+	SortCustom      = "custom" // the positions set by an admin, see ImageRepository.SetSortPositions
 )
 
 const DefaultSortOrder = SortFilenameAsc
@@ -12,7 +13,7 @@ const DefaultSortOrder = SortFilenameAsc
 // IsValidSortOrder checks if a string is a valid sort order constant
 func IsValidSortOrder(order string) bool {
 	switch order {
-	case SortFilenameAsc, SortDateDesc, SortDateAsc, SortFilenameNat:
+	case SortFilenameAsc, SortDateDesc, SortDateAsc, SortFilenameNat, SortCustom:
 		return true
 	default:
 		return false
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// the sync log holds one row per image, album and face with the sequence number of its
+// latest change, written by triggers. a row is replaced on every change, so the log stays
+// as large as the library and deleted entities remain as tombstones.
+const (
+	syncNextSeq = "(SELECT coalesce(max(seq), 0) + 1 FROM sync_changes)"
+	syncNow     = "CAST(strftime('%s', 'now') AS INTEGER)"
+)
+
+// syncLogTriggers returns the triggers recording the changes of a table. key is the SQL of
+// the sync key with %[1]s standing for the new or old row.
+func syncLogTriggers(table, entity, key string) []string {
+	record := func(row, deleted string) string {
+		return fmt.Sprintf("INSERT OR REPLACE INTO sync_changes(entity, key, seq, deleted, changed_at) VALUES ('%s', %s, %s, %s, %s);",
+			entity, fmt.Sprintf(key, row), syncNextSeq, deleted, syncNow)
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS sync_%[1]s_ai AFTER INSERT ON %[1]s BEGIN
+		%[2]s
+	END`, table, record("new", "new.deleted_at IS NOT NULL")),
+		// a changed key, i.e. a moved image, is the deletion of the old key
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS sync_%[1]s_au AFTER UPDATE ON %[1]s BEGIN
+		INSERT OR REPLACE INTO sync_changes(entity, key, seq, deleted, changed_at) SELECT '%[2]s', %[3]s, %[5]s, 1, %[6]s WHERE %[3]s != %[4]s;
+		%[7]s
+	END`, table, entity, fmt.Sprintf(key, "old"), fmt.Sprintf(key, "new"), syncNextSeq, syncNow, record("new", "new.deleted_at IS NOT NULL")),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS sync_%[1]s_ad AFTER DELETE ON %[1]s BEGIN
+		%[2]s
+	END`, table, record("old", "1")),
+	}
+}
+
+// syncLogSources are the tracked tables, with the SQL of their sync key
+var syncLogSources = []struct {
+	table, entity, key string
+}{
+	{"images", models.SyncEntityImage, "%[1]s.original_path"},
+	{"albums", models.SyncEntityAlbum, "CAST(%[1]s.id AS TEXT)"},
+	{"faces", models.SyncEntityFace, "CAST(%[1]s.id AS TEXT)"},
+}
+
+// EnsureSyncLog creates the triggers of the sync log, and fills the log with the existing
+// images, albums and faces when it is empty, e.g. on first start
+func EnsureSyncLog(db *gorm.DB) error {
+	for _, source := range syncLogSources {
+		for _, statement := range syncLogTriggers(source.table, source.entity, source.key) {
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create sync log trigger on %s: %w", source.table, err)
+			}
+		}
+	}
+	var count int64
+	if err := db.Model(&models.SyncChange{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count sync log entries: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return seedSyncLog(tx, 0)
+	})
+}
+
+// seedSyncLog records every existing image, album and face as changed, numbered from after
+func seedSyncLog(tx *gorm.DB, after int64) error {
+	for _, source := range syncLogSources {
+		key := fmt.Sprintf(source.key, source.table)
+		statement := fmt.Sprintf("INSERT INTO sync_changes(entity, key, seq, deleted, changed_at) SELECT '%s', %s, ? + row_number() OVER (ORDER BY %s), 0, %s FROM %s WHERE deleted_at IS NULL",
+			source.entity, key, key, syncNow, source.table)
+		if err := tx.Exec(statement, after).Error; err != nil {
+			return fmt.Errorf("failed to fill sync log from %s: %w", source.table, err)
+		}
+		if err := tx.Model(&models.SyncChange{}).Select("coalesce(max(seq), 0)").Scan(&after).Error; err != nil {
+			return fmt.Errorf("failed to read sync log head: %w", err)
+		}
+	}
+	return nil
+}
+
+// SyncLogHead returns the sequence number of the latest change, 0 when the log is empty
+func SyncLogHead(db *gorm.DB) (int64, error) {
+	var head int64
+	if err := db.Model(&models.SyncChange{}).Select("coalesce(max(seq), 0)").Scan(&head).Error; err != nil {
+		return 0, fmt.Errorf("failed to read sync log head: %w", err)
+	}
+	return head, nil
+}
+
+// ResetSyncLog starts the sync log over after the tables were replaced, e.g. by a restore.
+// the log is refilled after a reset marker numbered above both previous head and the head
+// of the replaced log, so clients holding an older cursor can tell they must sync again
+// from the start.
+func ResetSyncLog(db *gorm.DB, previousHead int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		head, err := SyncLogHead(tx)
+		if err != nil {
+			return err
+		}
+		marker := max(head, previousHead) + 1
+		if err := tx.Exec("DELETE FROM sync_changes").Error; err != nil {
+			return fmt.Errorf("failed to clear sync log: %w", err)
+		}
+		reset := models.SyncChange{Entity: models.SyncEntityReset, Key: "", Seq: marker, ChangedAt: time.Now().Unix()}
+		if err := tx.Create(&reset).Error; err != nil {
+			return fmt.Errorf("failed to write sync log reset marker: %w", err)
+		}
+		return seedSyncLog(tx, marker)
+	})
+}
@@ -0,0 +1,214 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+// names of the message templates
+const (
+	TemplateInvite        = "invite"
+	TemplateZipReady      = "zip_ready"
+	TemplatePasswordReset = "password_reset"
+	TemplateVerifyEmail   = "verify_email"
+)
+
+// smtpTimeout bounds a whole SMTP conversation
+const smtpTimeout = time.Minute
+
+var ErrEmailDisabled = errors.New("email is not configured")
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// Mailer sends templated plain text emails through the configured SMTP server. each template
+// defines a "subject" and a "body". a Mailer without an SMTP host reports ErrEmailDisabled.
+type Mailer struct {
+	cfg       config.Config
+	from      *mail.Address
+	templates map[string]*template.Template
+}
+
+// NewMailer parses the message templates and the sender address
+func NewMailer(cfg config.Config) (*Mailer, error) {
+	m := &Mailer{cfg: cfg, templates: make(map[string]*template.Template)}
+	if cfg.SMTPHost != "" {
+		from, err := mail.ParseAddress(cfg.SMTPFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_FROM '%s': %w", cfg.SMTPFrom, err)
+		}
+		m.from = from
+	}
+
+	files, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email templates: %w", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		tmpl, err := template.ParseFS(templateFiles, "templates/"+file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+		}
+		m.templates[name] = tmpl
+	}
+	return m, nil
+}
+
+// Enabled reports whether emails can be sent
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.cfg.SMTPHost != ""
+}
+
+// Send renders a template and emails it to a single recipient
+func (m *Mailer) Send(to, templateName string, data interface{}) error {
+	if !m.Enabled() {
+		return ErrEmailDisabled
+	}
+	subject, body, err := m.render(templateName, data)
+	if err != nil {
+		return err
+	}
+	return m.deliver(to, subject, body)
+}
+
+// SendAsync sends an email in the background, logging failures, so requests never wait on
+// the SMTP server
+func (m *Mailer) SendAsync(to, templateName string, data interface{}) {
+	if !m.Enabled() {
+		return
+	}
+	go func() {
+		if err := m.Send(to, templateName, data); err != nil {
+			log.Printf("Email: failed to send %s email to %s: %v", templateName, to, err)
+		}
+	}()
+}
+
+func (m *Mailer) render(templateName string, data interface{}) (string, string, error) {
+	tmpl, ok := m.templates[templateName]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template '%s'", templateName)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", fmt.Errorf("failed to render subject of %s email: %w", templateName, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", fmt.Errorf("failed to render body of %s email: %w", templateName, err)
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimLeft(body.String(), "\n"), nil
+}
+
+// buildMessage encodes the headers and quoted-printable body of a message
+func (m *Mailer) buildMessage(to, subject, body string) ([]byte, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	domain := m.from.Address[strings.LastIndex(m.from.Address, "@")+1:]
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + m.from.String() + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Message-ID: <" + hex.EncodeToString(idBytes) + "@" + domain + ">\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// deliver sends a message over SMTP, using implicit TLS or STARTTLS as configured
+func (m *Mailer) deliver(to, subject, body string) error {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient '%s': %w", to, err)
+	}
+	msg, err := m.buildMessage(recipient.String(), subject, body)
+	if err != nil {
+		return err
+	}
+
+	host := m.cfg.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(m.cfg.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	if m.cfg.SMTPSecurity == config.SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session with %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if m.cfg.SMTPSecurity == config.SMTPSecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", addr, err)
+		}
+	}
+	if m.cfg.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,126 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// Notifier turns application events into emails, honouring each user's notification
+// preferences. links in the emails point at PublicURL.
+type Notifier struct {
+	Mailer    *Mailer
+	Repo      repository.NotificationRepositoryInterface
+	PublicURL string
+}
+
+// NewNotifier creates a Notifier
+func NewNotifier(mailer *Mailer, repo repository.NotificationRepositoryInterface, publicURL string) *Notifier {
+	return &Notifier{Mailer: mailer, Repo: repo, PublicURL: publicURL}
+}
+
+// Enabled reports whether the notifier can send emails
+func (n *Notifier) Enabled() bool {
+	return n != nil && n.Mailer.Enabled()
+}
+
+// displayName is how a user is greeted in emails
+func displayName(user *models.User) string {
+	switch {
+	case user.FirstName != "":
+		return user.FirstName
+	default:
+		return user.Username
+	}
+}
+
+// ZipReady emails the users waiting for an album's archive. watchers are removed even when
+// email is disabled so they are not notified about a later build.
+func (n *Notifier) ZipReady(album *models.Album) {
+	if n == nil || n.Repo == nil {
+		return
+	}
+	users, err := n.Repo.TakeZipWatchers(album.ID)
+	if err != nil {
+		log.Printf("Email: %v", err)
+		return
+	}
+	if !n.Enabled() {
+		return
+	}
+	for i := range users {
+		user := &users[i]
+		if user.Email == nil || *user.Email == "" {
+			continue
+		}
+		preferences, err := n.Repo.GetPreferences(user.ID)
+		if err != nil {
+			log.Printf("Email: %v", err)
+			continue
+		}
+		if !preferences[models.NotificationZipReady] {
+			continue
+		}
+		n.Mailer.SendAsync(*user.Email, TemplateZipReady, map[string]string{
+			"Name":        displayName(user),
+			"AlbumName":   album.Name,
+			"DownloadURL": n.PublicURL + "/album/" + url.PathEscape(album.Slug),
+			"SettingsURL": n.PublicURL + "/settings",
+		})
+	}
+}
+
+// PasswordReset sends a password reset link to a user. unlike other notifications it is sent
+// synchronously so the caller can log failures.
+func (n *Notifier) PasswordReset(user *models.User, token string, expiry time.Duration) error {
+	if !n.Enabled() {
+		return ErrEmailDisabled
+	}
+	if user.Email == nil || *user.Email == "" {
+		return fmt.Errorf("user %d has no email address", user.ID)
+	}
+	return n.Mailer.Send(*user.Email, TemplatePasswordReset, map[string]string{
+		"Name":      displayName(user),
+		"Username":  user.Username,
+		"ResetURL":  n.PublicURL + "/auth/reset-password?token=" + url.QueryEscape(token),
+		"ExpiresIn": expiry.String(),
+	})
+}
+
+// VerifyEmail sends an email address confirmation link to a user
+func (n *Notifier) VerifyEmail(user *models.User, token string, expiry time.Duration) error {
+	if !n.Enabled() {
+		return ErrEmailDisabled
+	}
+	if user.Email == nil || *user.Email == "" {
+		return fmt.Errorf("user %d has no email address", user.ID)
+	}
+	return n.Mailer.Send(*user.Email, TemplateVerifyEmail, map[string]string{
+		"Name":      displayName(user),
+		"Username":  user.Username,
+		"Email":     *user.Email,
+		"VerifyURL": n.PublicURL + "/auth/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": expiry.String(),
+	})
+}
+
+// Invite emails an invite code to someone who does not have an account yet
+func (n *Notifier) Invite(to, code, invitedBy string, expiresAt *time.Time) error {
+	if !n.Enabled() {
+		return ErrEmailDisabled
+	}
+	expires := ""
+	if expiresAt != nil {
+		expires = expiresAt.UTC().Format("January 2, 2006 15:04 MST")
+	}
+	return n.Mailer.Send(to, TemplateInvite, map[string]string{
+		"InvitedBy":   invitedBy,
+		"RegisterURL": n.PublicURL + "/auth/register?code=" + url.QueryEscape(code),
+		"Code":        code,
+		"ExpiresAt":   expires,
+	})
+}
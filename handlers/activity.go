@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// defaultActivityLimit is the number of activities in a feed page when no limit is given
+const defaultActivityLimit = 50
+
+type ActivityHandler struct {
+	ActivityRepo repository.ActivityRepositoryInterface
+	AlbumRepo    repository.AlbumRepositoryInterface
+}
+
+// NewActivityHandler creates a new ActivityHandler
+func NewActivityHandler(activityRepo repository.ActivityRepositoryInterface, albumRepo repository.AlbumRepositoryInterface) *ActivityHandler {
+	return &ActivityHandler{ActivityRepo: activityRepo, AlbumRepo: albumRepo}
+}
+
+// ActivityResponse is a page of the activity feed, newest first
+type ActivityResponse struct {
+	Activities []repository.ActivityEntry `json:"activities"`
+	Total      int                        `json:"total"`
+	Offset     int                        `json:"offset"`
+	Limit      int                        `json:"limit"`
+	HasMore    bool                       `json:"has_more"`
+	NextCursor string                     `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// GetActivity returns a page of the recent events in the albums the requester can see: every
+// album that is not hidden, and hidden ones when the user may list albums or view the album's
+// content.
+// Route: GET /api/activity?offset=...&limit=...
+func (ah *ActivityHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePageParams(r, defaultActivityLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	albums, err := ah.AlbumRepo.ListAllAdmin()
+	if err != nil {
+		log.Printf("Error listing albums for activity feed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load activity"})
+		return
+	}
+	user := currentUser(r)
+	canListHidden := user != nil && user.HasGlobalPermission("album.list")
+	var albumIDs []uint
+	for _, album := range albums {
+		if !album.IsHidden || canListHidden || (user != nil && user.HasAlbumPermission(album.ID, "album.view.content")) {
+			albumIDs = append(albumIDs, album.ID)
+		}
+	}
+
+	activities, total, err := ah.ActivityRepo.ListByAlbums(albumIDs, offset, limit)
+	if err != nil {
+		log.Printf("Error listing activities: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load activity"})
+		return
+	}
+
+	response := ActivityResponse{
+		Activities: activities,
+		Total:      int(total),
+		Offset:     offset,
+		Limit:      limit,
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// newActivity starts an activity of the given type in an album, caused by the requesting user
+// if there is one
+func newActivity(r *http.Request, activityType string, albumID uint) models.Activity {
+	activity := models.Activity{Type: activityType, AlbumID: albumID}
+	if user := currentUser(r); user != nil {
+		activity.UserID = &user.ID
+	}
+	return activity
+}
+
+// recordActivity adds an event to the activity feed. failures are logged, since the feed must
+// never break the action it reports.
+func recordActivity(repo repository.ActivityRepositoryInterface, activity models.Activity) {
+	if repo == nil {
+		return
+	}
+	if err := repo.Create(&activity); err != nil {
+		log.Printf("Error recording activity: %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/realtime"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// batch operations on album images
+const (
+	BatchOperationMove   = "move"
+	BatchOperationCopy   = "copy"
+	BatchOperationDelete = "delete"
+)
+
+const maxBatchImagePaths = 500
+
+// BatchImagesPayload selects images of an album and what to do with them. paths are relative
+// to the root directory, like the paths in album listings. move and copy put the files in the
+// target album's folder, or TargetSubfolder inside it, keeping their file names.
+type BatchImagesPayload struct {
+	Operation       string   `json:"operation"`
+	Paths           []string `json:"paths"`
+	TargetAlbumID   *uint    `json:"target_album_id,omitempty"`
+	TargetSubfolder string   `json:"target_subfolder,omitempty"`
+}
+
+// BatchImageResult is the outcome for a single path of a batch
+type BatchImageResult struct {
+	Path    string `json:"path"`
+	NewPath string `json:"new_path,omitempty"`
+	Status  string `json:"status"` // "ok" or "error"
+	Error   string `json:"error,omitempty"`
+}
+
+type BatchImagesResponse struct {
+	Operation string             `json:"operation"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []BatchImageResult `json:"results"`
+}
+
+// BatchImages moves, copies or deletes images of an album. each path is handled on its own:
+// the file and its DB records change together or not at all, and a failing path does not
+// stop the rest of the batch.
+func (h *AdminAlbumHandler) BatchImages(w http.ResponseWriter, r *http.Request) {
+	albumIDStr := chi.URLParam(r, "id")
+	albumID, err := strconv.ParseUint(albumIDStr, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid album ID"})
+		return
+	}
+
+	album, err := h.AlbumRepo.GetByID(uint(albumID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album %d for batch operation: %v", albumID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		}
+		return
+	}
+
+	var payload BatchImagesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if len(payload.Paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths must not be empty"})
+		return
+	}
+	if len(payload.Paths) > maxBatchImagePaths {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d paths can be processed per batch", maxBatchImagePaths)})
+		return
+	}
+
+	// copies may be taken out of an archived album, but nothing is moved or deleted from it
+	if album.IsArchived && payload.Operation != BatchOperationCopy {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": albumArchivedMessage})
+		return
+	}
+
+	var targetDir string // destination folder relative to the root, for move and copy
+	switch payload.Operation {
+	case BatchOperationMove, BatchOperationCopy:
+		if payload.TargetAlbumID == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "target_album_id is required for " + payload.Operation})
+			return
+		}
+		targetAlbum, err := h.AlbumRepo.GetByID(*payload.TargetAlbumID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "Target album not found"})
+			} else {
+				log.Printf("Error getting target album %d for batch operation: %v", *payload.TargetAlbumID, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve target album"})
+			}
+			return
+		}
+		if targetAlbum.IsArchived {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Target album is archived and read-only"})
+			return
+		}
+		subfolder := path.Clean("/" + filepath.ToSlash(payload.TargetSubfolder)) // rooted, so ".." cannot escape
+		targetDir = strings.TrimSuffix(path.Join(targetAlbum.FolderPath, subfolder), "/")
+		if err := os.MkdirAll(h.Cfg.ResolvePath(targetDir), 0755); err != nil {
+			log.Printf("Error creating batch target folder %s: %v", targetDir, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create target folder"})
+			return
+		}
+	case BatchOperationDelete:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "operation must be one of: move, copy, delete"})
+		return
+	}
+
+	var uploadedBy *uint
+	if user, ok := r.Context().Value(UserContextKey).(*models.User); ok && user != nil {
+		uploadedBy = &user.ID
+	}
+
+	response := BatchImagesResponse{Operation: payload.Operation, Results: make([]BatchImageResult, 0, len(payload.Paths))}
+	for _, rawPath := range payload.Paths {
+		relPath := filepath.ToSlash(strings.TrimPrefix(rawPath, "/"))
+		result := BatchImageResult{Path: relPath, Status: "ok"}
+
+		var itemErr error
+		if relPath != path.Clean(relPath) || !strings.HasPrefix(relPath, album.FolderPath+"/") {
+			itemErr = errors.New("path is not within the album")
+		} else {
+			switch payload.Operation {
+			case BatchOperationMove:
+				result.NewPath, itemErr = h.moveImage(relPath, targetDir)
+			case BatchOperationCopy:
+				result.NewPath, itemErr = h.copyImage(relPath, targetDir, uploadedBy)
+			case BatchOperationDelete:
+				itemErr = h.deleteImage(relPath)
+			}
+		}
+
+		if itemErr != nil {
+			result.Status = "error"
+			result.Error = itemErr.Error()
+			response.Failed++
+			log.Printf("Batch %s of %s failed: %v", payload.Operation, relPath, itemErr)
+		} else {
+			response.Succeeded++
+			InvalidateListings(relPath)
+			if result.NewPath != "" {
+				InvalidateListings(result.NewPath)
+			}
+			if h.Hub != nil {
+				h.Hub.Broadcast(realtime.Event{
+					Type:      "image",
+					Path:      relPath,
+					Status:    payload.Operation,
+					Extra:     map[string]interface{}{"new_path": result.NewPath},
+					Timestamp: time.Now().Unix(),
+				})
+			}
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// batchSource checks that a batch path is an existing image, video or document file
+func (h *AdminAlbumHandler) batchSource(relPath string) (string, error) {
+	fullPath := h.Cfg.ResolvePath(relPath)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("file not found")
+		}
+		return "", err
+	}
+	if info.IsDir() || (!media.IsProcessableImage(relPath) && !media.IsVideo(relPath) && !media.IsDocument(relPath)) {
+		return "", errors.New("not an image, video or document file")
+	}
+	return fullPath, nil
+}
+
+// batchDestination returns the new path of a file in the target folder, which must be free
+func (h *AdminAlbumHandler) batchDestination(relPath, targetDir string) (string, string, error) {
+	newRelPath := path.Join(targetDir, path.Base(relPath))
+	if newRelPath == relPath {
+		return "", "", errors.New("file is already in the target folder")
+	}
+	newFullPath := h.Cfg.ResolvePath(newRelPath)
+	if _, err := os.Lstat(newFullPath); err == nil {
+		return "", "", fmt.Errorf("%s already exists", newRelPath)
+	} else if !os.IsNotExist(err) {
+		return "", "", err
+	}
+	return newRelPath, newFullPath, nil
+}
+
+// moveImage renames a file and rewrites its DB records, keeping thumbnails and face tags.
+// the rename is undone if the records cannot be updated.
+func (h *AdminAlbumHandler) moveImage(relPath, targetDir string) (string, error) {
+	fullPath, err := h.batchSource(relPath)
+	if err != nil {
+		return "", err
+	}
+	newRelPath, newFullPath, err := h.batchDestination(relPath, targetDir)
+	if err != nil {
+		return "", err
+	}
+
+	if h.ImgProc != nil {
+		h.ImgProc.CancelJobsForPath(relPath)
+	}
+	if err := os.Rename(fullPath, newFullPath); err != nil {
+		return "", fmt.Errorf("failed to move file: %w", err)
+	}
+	if err := h.ImageRepo.MovePath(relPath, newRelPath); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		if rollbackErr := os.Rename(newFullPath, fullPath); rollbackErr != nil {
+			log.Printf("CRITICAL: Failed to move %s back after DB error: %v", newRelPath, rollbackErr)
+		}
+		return "", err
+	}
+
+	h.queueBatchProcessing(newRelPath)
+	return newRelPath, nil
+}
+
+// copyImage copies a file into the target folder and queues processing for the copy. the
+// copy is removed if its record cannot be created.
+func (h *AdminAlbumHandler) copyImage(relPath, targetDir string, uploadedBy *uint) (string, error) {
+	fullPath, err := h.batchSource(relPath)
+	if err != nil {
+		return "", err
+	}
+	newRelPath, newFullPath, err := h.batchDestination(relPath, targetDir)
+	if err != nil {
+		return "", err
+	}
+
+	// the copy keeps the uploader of the original if it is known
+	if img, err := h.ImageRepo.GetByPath(relPath); err == nil && img.UploadedByUserID != nil {
+		uploadedBy = img.UploadedByUserID
+	}
+
+	modTime, err := copyFilePreservingModTime(fullPath, newFullPath)
+	if err != nil {
+		return "", err
+	}
+	if media.IsVideo(newRelPath) {
+		_, err = h.ImageRepo.EnsureVideoExists(newRelPath, modTime, uploadedBy, h.Cfg.VideoTranscodeEnabled)
+	} else if media.IsDocument(newRelPath) {
+		_, err = h.ImageRepo.EnsureDocumentExists(newRelPath, modTime, uploadedBy)
+	} else {
+		_, err = h.ImageRepo.EnsureExistsWithUploader(newRelPath, modTime, uploadedBy)
+	}
+	if err != nil {
+		os.Remove(newFullPath)
+		return "", err
+	}
+
+	h.queueBatchProcessing(newRelPath)
+	return newRelPath, nil
+}
+
+// deleteImage removes a file, its DB records and its generated assets. the file is set
+// aside first and only removed once the records are gone, so a DB error leaves it in place.
+func (h *AdminAlbumHandler) deleteImage(relPath string) error {
+	fullPath, err := h.batchSource(relPath)
+	if err != nil {
+		return err
+	}
+
+	var assets []string
+	if img, err := h.ImageRepo.GetByPath(relPath); err == nil {
+		assets = img.AssetPaths()
+	}
+
+	if h.ImgProc != nil {
+		h.ImgProc.CancelJobsForPath(relPath)
+	}
+	asidePath := filepath.Join(filepath.Dir(fullPath), ".deleting-"+filepath.Base(fullPath))
+	if err := os.Rename(fullPath, asidePath); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := h.ImageRepo.DeleteWithFaces(relPath); err != nil {
+		if rollbackErr := os.Rename(asidePath, fullPath); rollbackErr != nil {
+			log.Printf("CRITICAL: Failed to restore %s after DB error: %v", relPath, rollbackErr)
+		}
+		return err
+	}
+	if err := os.Remove(asidePath); err != nil {
+		log.Printf("Warning: failed to remove deleted file '%s': %v", asidePath, err)
+	}
+
+	for _, asset := range assets {
+		assetFull := filepath.Join(h.Cfg.MediaStoragePath, filepath.FromSlash(asset))
+		if err := os.Remove(assetFull); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to delete generated asset '%s': %v", assetFull, err)
+		}
+	}
+	return nil
+}
+
+// queueBatchProcessing queues whatever processing a moved or copied file still needs
+func (h *AdminAlbumHandler) queueBatchProcessing(relPath string) {
+	if h.ImgProc == nil {
+		return
+	}
+	if _, err := h.ImgProc.QueueStaleTasks(relPath, workers.PriorityLow); err != nil {
+		log.Printf("Warning: failed to queue processing for %s: %v", relPath, err)
+	}
+}
+
+// copyFilePreservingModTime copies a file through a temporary file in the destination folder,
+// so a partial copy never appears under the final name. returns the copy's modification time.
+func copyFilePreservingModTime(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".copy-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create copy: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Chmod(0644); err != nil {
+		log.Printf("Warning: failed to set permissions of %s: %v", dst, err)
+	}
+	_, copyErr := io.Copy(tmp, in)
+	closeErr := tmp.Close()
+	if copyErr != nil || closeErr != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to copy file: %w", errors.Join(copyErr, closeErr))
+	}
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		log.Printf("Warning: failed to preserve modification time of %s: %v", dst, err)
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	copied, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+	return copied.ModTime().Unix(), nil
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// AlbumExportFormat identifies the manifest of an album export bundle
+	AlbumExportFormat = "mediasys-album-export"
+	// AlbumExportVersion is bumped whenever the manifest changes incompatibly
+	AlbumExportVersion = 1
+
+	albumExportManifestName = "manifest.json"
+	albumExportOriginalsDir = "originals"
+
+	// image records are looked up this many paths at a time
+	albumExportLookupBatch = 500
+)
+
+// AlbumExportManifest is the manifest.json of an album export bundle. the bundle holds the
+// files of the album folder and its subfolders under originals/, at the paths in Files.
+type AlbumExportManifest struct {
+	Format     string              `json:"format"`
+	Version    int                 `json:"version"`
+	ExportedAt int64               `json:"exported_at"`
+	Album      models.Album        `json:"album"`
+	Files      []AlbumExportFile   `json:"files"`
+	People     []AlbumExportPerson `json:"people"` // everyone tagged in the files
+}
+
+// AlbumExportFile is a file of an export bundle with what mediasys knows about it
+type AlbumExportFile struct {
+	Entry       string              `json:"entry"`           // path of the file inside the bundle
+	Path        string              `json:"path"`            // path of the file in the library
+	Size        int64               `json:"size"`            // in bytes
+	ModTime     int64               `json:"mod_time"`        // Unix timestamp
+	Image       *models.Image       `json:"image,omitempty"` // nil for files that were never indexed
+	Faces       []AlbumExportFace   `json:"faces"`
+	Tags        []string            `json:"tags"`
+	MachineTags []models.MachineTag `json:"machine_tags"`
+}
+
+// AlbumExportFace is a detected face, in pixels of the original file
+type AlbumExportFace struct {
+	X1                  int     `json:"x1"`
+	Y1                  int     `json:"y1"`
+	X2                  int     `json:"x2"`
+	Y2                  int     `json:"y2"`
+	DetectionConfidence float32 `json:"detection_confidence"`
+	PersonID            *uint   `json:"person_id,omitempty"` // ID in People, nil for untagged faces
+}
+
+// AlbumExportPerson is a person tagged in an export bundle
+type AlbumExportPerson struct {
+	ID          uint     `json:"id"`
+	PrimaryName string   `json:"primary_name"`
+	Aliases     []string `json:"aliases"`
+	BirthDate   *string  `json:"birth_date,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	IsHidden    bool     `json:"is_hidden"`
+}
+
+type AdminAlbumExportHandler struct {
+	AlbumRepo      repository.AlbumRepositoryInterface
+	ImageRepo      repository.ImageRepositoryInterface
+	FaceRepo       repository.FaceRepositoryInterface
+	PersonRepo     repository.PersonRepositoryInterface
+	TagRepo        repository.TagRepositoryInterface
+	MachineTagRepo repository.MachineTagRepositoryInterface
+	Cfg            config.Config
+}
+
+func NewAdminAlbumExportHandler(
+	albumRepo repository.AlbumRepositoryInterface,
+	imageRepo repository.ImageRepositoryInterface,
+	faceRepo repository.FaceRepositoryInterface,
+	personRepo repository.PersonRepositoryInterface,
+	tagRepo repository.TagRepositoryInterface,
+	machineTagRepo repository.MachineTagRepositoryInterface,
+	cfg config.Config,
+) *AdminAlbumExportHandler {
+	return &AdminAlbumExportHandler{
+		AlbumRepo:      albumRepo,
+		ImageRepo:      imageRepo,
+		FaceRepo:       faceRepo,
+		PersonRepo:     personRepo,
+		TagRepo:        tagRepo,
+		MachineTagRepo: machineTagRepo,
+		Cfg:            cfg,
+	}
+}
+
+// ExportAlbum streams a ZIP bundle of an album for migrating or archiving it: the original
+// files of the album folder and its subfolders, and a manifest.json with the album, the
+// metadata of every file and the faces and people tagged in them. the manifest comes first,
+// so readers can go through the bundle without seeking.
+// Route: GET /api/admin/albums/{id}/export
+func (h *AdminAlbumExportHandler) ExportAlbum(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid album ID"})
+		return
+	}
+	album, err := h.AlbumRepo.GetByID(uint(albumID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album %d for export: %v", albumID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		}
+		return
+	}
+
+	albumFullPath := filepath.Clean(h.Cfg.ResolvePath(album.FolderPath))
+	if library, _ := h.Cfg.SplitPath(album.FolderPath); !utils.IsWithin(library.Path, albumFullPath) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
+		return
+	}
+
+	manifest, err := h.buildManifest(album, albumFullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album folder not found on disk: " + album.FolderPath})
+		} else {
+			log.Printf("Error building export manifest for album %d/%s: %v", album.ID, album.Slug, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to export album"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_export.zip\"", album.Slug))
+	w.Header().Set("Content-Type", "application/zip")
+	if err := writeAlbumExport(newDeadlineWriter(w), albumFullPath, manifest); err != nil {
+		// the response has started, so the status can't report the failure. the archive is
+		// left without its central directory and the connection is dropped, rather than
+		// ended cleanly, so the client sees a failed download instead of a short bundle.
+		log.Printf("Error streaming export for album %d/%s, aborting the download: %v", album.ID, album.Slug, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// buildManifest lists the files of the album folder and collects their records, faces, tags
+// and people
+func (h *AdminAlbumExportHandler) buildManifest(album *models.Album, albumFullPath string) (*AlbumExportManifest, error) {
+	manifest := &AlbumExportManifest{
+		Format:     AlbumExportFormat,
+		Version:    AlbumExportVersion,
+		ExportedAt: time.Now().Unix(),
+		Album:      *album,
+		Files:      []AlbumExportFile{},
+		People:     []AlbumExportPerson{},
+	}
+
+	mediaStorage := filepath.Clean(h.Cfg.MediaStoragePath)
+	err := filepath.WalkDir(albumFullPath, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if fullPath == albumFullPath {
+				return err
+			}
+			log.Printf("Skipping %s in album export: %v", fullPath, err)
+			return nil
+		}
+		if fullPath != albumFullPath && h.Cfg.IsIgnored(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && filepath.Clean(fullPath) == mediaStorage {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("Skipping %s in album export: %v", fullPath, err)
+			return nil
+		}
+		rel, err := filepath.Rel(albumFullPath, fullPath)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, AlbumExportFile{
+			Entry:       path.Join(albumExportOriginalsDir, filepath.ToSlash(rel)),
+			Path:        path.Join(album.FolderPath, filepath.ToSlash(rel)),
+			Size:        info.Size(),
+			ModTime:     info.ModTime().Unix(),
+			Faces:       []AlbumExportFace{},
+			Tags:        []string{},
+			MachineTags: []models.MachineTag{},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]*models.Image, len(manifest.Files))
+	for start := 0; start < len(manifest.Files); start += albumExportLookupBatch {
+		end := min(start+albumExportLookupBatch, len(manifest.Files))
+		paths := make([]string, 0, end-start)
+		for _, file := range manifest.Files[start:end] {
+			paths = append(paths, file.Path)
+		}
+		found, err := h.ImageRepo.GetImagesByPaths(paths)
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			images[found[i].OriginalPath] = &found[i]
+		}
+	}
+
+	people := make(map[uint]bool)
+	for i := range manifest.Files {
+		file := &manifest.Files[i]
+		file.Image = images[file.Path]
+		if file.Image == nil {
+			continue
+		}
+		faces, err := h.FaceRepo.ListByImagePath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, face := range faces {
+			file.Faces = append(file.Faces, AlbumExportFace{
+				X1: face.X1, Y1: face.Y1, X2: face.X2, Y2: face.Y2,
+				DetectionConfidence: face.DetectionConfidence,
+				PersonID:            face.PersonID,
+			})
+			if face.Person != nil && !people[face.Person.ID] {
+				people[face.Person.ID] = true
+				person, err := h.exportPerson(face.Person)
+				if err != nil {
+					return nil, err
+				}
+				manifest.People = append(manifest.People, person)
+			}
+		}
+		tags, err := h.TagRepo.ListByImagePath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			file.Tags = append(file.Tags, tag.Name)
+		}
+		machineTags, err := h.MachineTagRepo.ListByImagePath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		file.MachineTags = append(file.MachineTags, machineTags...)
+	}
+	return manifest, nil
+}
+
+func (h *AdminAlbumExportHandler) exportPerson(person *models.Person) (AlbumExportPerson, error) {
+	exported := AlbumExportPerson{
+		ID:          person.ID,
+		PrimaryName: person.PrimaryName,
+		Aliases:     []string{},
+		BirthDate:   person.BirthDate,
+		Description: person.Description,
+		IsHidden:    person.IsHidden,
+	}
+	aliases, err := h.PersonRepo.ListAliasesByPersonID(person.ID)
+	if err != nil {
+		return exported, err
+	}
+	for _, alias := range aliases {
+		exported.Aliases = append(exported.Aliases, alias.Name)
+	}
+	return exported, nil
+}
+
+// writeAlbumExport writes the manifest and then the files it lists. files that can't be
+// opened any more are left out of the bundle but stay in the manifest.
+func writeAlbumExport(w io.Writer, albumFullPath string, manifest *AlbumExportManifest) error {
+	zipWriter := zip.NewWriter(w)
+	entry, err := zipWriter.Create(albumExportManifestName)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	for _, file := range manifest.Files {
+		rel := strings.TrimPrefix(file.Entry, albumExportOriginalsDir+"/")
+		fullPath := filepath.Join(albumFullPath, filepath.FromSlash(rel))
+		err := func() error {
+			src, err := os.Open(fullPath)
+			if err != nil {
+				log.Printf("Skipping %s in album export: %v", fullPath, err)
+				return nil
+			}
+			defer src.Close()
+			entry, err := zipWriter.CreateHeader(&zip.FileHeader{
+				Name:     file.Entry,
+				Method:   zip.Deflate,
+				Modified: time.Unix(file.ModTime, 0),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(entry, src)
+			return err
+		}()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Entry, err)
+		}
+	}
+	return zipWriter.Close()
+}
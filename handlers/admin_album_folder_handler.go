@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/realtime"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// MoveAlbumFolderPayload is the new folder of an album, relative to the library given by
+// LibraryID or, without one, to the top of the relative path space
+type MoveAlbumFolderPayload struct {
+	FolderPath string `json:"folder_path"`
+	LibraryID  string `json:"library_id"`
+}
+
+// MoveAlbumFolder renames an album's folder on disk and rewrites the paths of its images,
+// faces and nested albums, so thumbnails and face tags survive the move. the folder is
+// renamed back if the records cannot be updated.
+func (h *AdminAlbumHandler) MoveAlbumFolder(w http.ResponseWriter, r *http.Request) {
+	albumIDStr := chi.URLParam(r, "id")
+	albumID, err := strconv.ParseUint(albumIDStr, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid album ID"})
+		return
+	}
+
+	album, err := h.AlbumRepo.GetByID(uint(albumID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album %d for folder move: %v", albumID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		}
+		return
+	}
+
+	var payload MoveAlbumFolderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(payload.FolderPath) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder_path is required"})
+		return
+	}
+
+	newFolder, err := albumFolderPath(h.Cfg, payload.LibraryID, payload.FolderPath)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	// the top folder of a library is its root directory, which can't be renamed
+	newLibrary, newInner := h.Cfg.SplitPath(newFolder)
+	if newInner == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder_path must be a folder inside a library"})
+		return
+	}
+	oldFolder := album.FolderPath
+	if _, oldInner := h.Cfg.SplitPath(oldFolder); oldInner == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "The folder of this album is the top of a library and cannot be moved"})
+		return
+	}
+	if newFolder == oldFolder {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Album is already in " + newFolder})
+		return
+	}
+	if strings.HasPrefix(newFolder, oldFolder+"/") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "An album folder cannot be moved into itself"})
+		return
+	}
+
+	oldFullPath := h.Cfg.ResolvePath(oldFolder)
+	newFullPath := h.Cfg.ResolvePath(newFolder)
+	if stat, err := os.Stat(oldFullPath); err != nil || !stat.IsDir() {
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Error stating folder %s of album %d: %v", oldFullPath, album.ID, err)
+		}
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Album folder does not exist on disk: " + oldFolder})
+		return
+	}
+	if _, err := os.Lstat(newFullPath); err == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "folder_path already exists: " + newFolder})
+		return
+	} else if !os.IsNotExist(err) {
+		log.Printf("Error stating folder path %s for album %d: %v", newFullPath, album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Could not verify folder_path"})
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(newFullPath), 0755); err != nil {
+		log.Printf("Error creating parent of folder path %s for album %d: %v", newFullPath, album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Could not create parent of folder_path"})
+		return
+	}
+
+	// queued jobs carry the old paths; they are queued again under the new ones afterwards
+	var cancelledPaths []string
+	if h.ImgProc != nil {
+		cancelledPaths, err = h.ImgProc.CancelJobsForFolder(oldFolder)
+		if err != nil {
+			if errors.Is(err, workers.ErrFolderBusy) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "Images in this album are being processed, try again shortly"})
+			} else {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to cancel queued jobs"})
+			}
+			return
+		}
+	}
+
+	if err := os.Rename(oldFullPath, newFullPath); err != nil {
+		log.Printf("Error renaming album folder %s to %s: %v", oldFullPath, newFullPath, err)
+		h.requeueMovedPaths(cancelledPaths, oldFolder, oldFolder)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to rename album folder"})
+		return
+	}
+	if err := h.AlbumRepo.MoveFolder(oldFolder, newFolder, newLibrary.ID); err != nil {
+		log.Printf("Error moving records of album %d from %s to %s: %v", album.ID, oldFolder, newFolder, err)
+		if rollbackErr := os.Rename(newFullPath, oldFullPath); rollbackErr != nil {
+			log.Printf("CRITICAL: Failed to rename %s back to %s after DB error: %v", newFullPath, oldFullPath, rollbackErr)
+		}
+		h.requeueMovedPaths(cancelledPaths, oldFolder, oldFolder)
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Another album or image already uses folder_path"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update album folder"})
+		}
+		return
+	}
+	log.Printf("Moved album %d folder from %s to %s", album.ID, oldFolder, newFolder)
+	InvalidateListings(oldFolder)
+	InvalidateListings(newFolder)
+	h.requeueMovedPaths(cancelledPaths, oldFolder, newFolder)
+
+	if h.Hub != nil {
+		h.Hub.Broadcast(realtime.Event{
+			Type:      "album",
+			Path:      oldFolder,
+			Status:    "moved",
+			Extra:     map[string]interface{}{"album_id": album.ID, "new_path": newFolder},
+			Timestamp: time.Now().Unix(),
+		})
+	}
+
+	updated, err := h.AlbumRepo.GetByID(album.ID)
+	if err != nil {
+		log.Printf("Error reloading album %d after folder move: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Folder moved, but failed to reload album"})
+		return
+	}
+	writeJSON(w, http.StatusOK, convertAlbumToAdminResponse(updated, h.Cfg))
+}
+
+// requeueMovedPaths queues the processing of files whose jobs were cancelled for a folder move,
+// under their path in the new folder
+func (h *AdminAlbumHandler) requeueMovedPaths(paths []string, oldFolder, newFolder string) {
+	for _, relPath := range paths {
+		h.queueBatchProcessing(path.Join(newFolder, strings.TrimPrefix(relPath, oldFolder+"/")))
+	}
+}
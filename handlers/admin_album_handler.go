@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -11,25 +13,45 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/camden-git/mediasysbackend/config"
 	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/realtime"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
 	"github.com/camden-git/mediasysbackend/workers"
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
 )
 
+// upload statuses of a single file
+const (
+	uploadStatusSaved   = "saved"
+	uploadStatusSkipped = "skipped" // refused, by validation or a limit
+	uploadStatusError   = "error"   // failed while being saved
+)
+
+// uploadFileResult reports what became of one uploaded file
+type uploadFileResult struct {
+	File   string `json:"file"`           // path within the album, as sent by the client
+	Path   string `json:"path,omitempty"` // library relative path of the saved file
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"` // why the file was skipped or failed
+}
+
 type AdminAlbumHandler struct {
-	AlbumRepo repository.AlbumRepositoryInterface
-	ImageRepo repository.ImageRepositoryInterface
-	UserRepo  repository.UserRepository
-	RoleRepo  repository.RoleRepository
-	Cfg       config.Config
-	ImgProc   *workers.ImageProcessor
-	Hub       *realtime.Hub
+	AlbumRepo    repository.AlbumRepositoryInterface
+	ImageRepo    repository.ImageRepositoryInterface
+	UserRepo     repository.UserRepository
+	RoleRepo     repository.RoleRepository
+	ActivityRepo repository.ActivityRepositoryInterface
+	Cfg          config.Config
+	ImgProc      *workers.ImageProcessor
+	Hub          *realtime.Hub
+	Quota        *UploadQuota
 }
 
 func NewAdminAlbumHandler(
@@ -37,22 +59,28 @@ func NewAdminAlbumHandler(
 	imageRepo repository.ImageRepositoryInterface,
 	userRepo repository.UserRepository,
 	roleRepo repository.RoleRepository,
+	activityRepo repository.ActivityRepositoryInterface,
 	cfg config.Config,
 	imgProc *workers.ImageProcessor,
 	hub *realtime.Hub,
+	quota *UploadQuota,
 ) *AdminAlbumHandler {
 	return &AdminAlbumHandler{
-		AlbumRepo: albumRepo,
-		ImageRepo: imageRepo,
-		UserRepo:  userRepo,
-		RoleRepo:  roleRepo,
-		Cfg:       cfg,
-		ImgProc:   imgProc,
-		Hub:       hub,
+		AlbumRepo:    albumRepo,
+		ImageRepo:    imageRepo,
+		UserRepo:     userRepo,
+		RoleRepo:     roleRepo,
+		ActivityRepo: activityRepo,
+		Cfg:          cfg,
+		ImgProc:      imgProc,
+		Hub:          hub,
+		Quota:        quota,
 	}
 }
 
-// UploadImages handles multipart folder or multiple file uploads into the album's folder and queues processing
+// UploadImages handles multipart folder or multiple file uploads into the album's folder and queues processing.
+// files are checked by content with media.CheckUpload. the response lists the result of every file; requests over
+// the configured file count or size are cut short with 413, keeping the files saved so far.
 func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request) {
 	albumIDStr := chi.URLParam(r, "id")
 	albumID, err := strconv.ParseUint(albumIDStr, 10, 64)
@@ -61,6 +89,17 @@ func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	maxRequestSize := int64(h.Cfg.UploadMaxRequestSizeMB) << 20
+	requestTooLarge := fmt.Sprintf("Upload exceeds the %d MB request limit", h.Cfg.UploadMaxRequestSizeMB)
+	if maxRequestSize > 0 {
+		if r.ContentLength > maxRequestSize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": requestTooLarge})
+			return
+		}
+		// also catches bodies sent without a Content-Length
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	}
+
 	album, err := h.AlbumRepo.GetByID(uint(albumID))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -83,19 +122,54 @@ func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	albumBase := filepath.Join(h.Cfg.RootDirectory, album.FolderPath)
+	albumBase := h.Cfg.ResolvePath(album.FolderPath)
 	if err := os.MkdirAll(albumBase, 0755); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to ensure album folder"})
 		return
 	}
 
+	// bytes the uploader may still add, -1 when unlimited
+	uploader := currentUser(r)
+	var uploaderID uint
+	if uploader != nil {
+		uploaderID = uploader.ID
+	}
+	remaining := int64(-1)
+	if limit := h.Quota.LimitBytes(uploader); limit > 0 {
+		usage, err := h.Quota.Usage(uploader)
+		if err != nil {
+			log.Printf("UploadImages: failed to check upload quota of user %d: %v", uploader.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to check upload quota"})
+			return
+		}
+		remaining = *usage.RemainingBytes
+	}
+	maxFileSize := int64(h.Cfg.UploadMaxFileSizeMB) << 20
+
 	var relPathsQueue []string
 	saved := 0
+	fileCount := 0
+	quotaExceeded := false
+	limitError := "" // set when a per-request limit cut the upload short
+	results := []uploadFileResult{}
+	// refused or failed files are reported to the client and over the realtime hub
+	report := func(rel, destPath, status, reason string) {
+		log.Printf("UploadImages: %s %s: %s", status, destPath, reason)
+		results = append(results, uploadFileResult{File: rel, Status: status, Reason: reason})
+		if relFromRoot, err := h.Cfg.RelativePath(destPath); err == nil && h.Hub != nil {
+			h.Hub.Broadcast(realtime.Event{Type: "upload", Path: filepath.ToSlash(relFromRoot), Status: "error", Error: reason, UserID: uploaderID, Timestamp: time.Now().Unix()})
+		}
+	}
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
 			break
 		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			limitError = requestTooLarge
+			break
+		}
 		if err != nil {
 			log.Printf("UploadImages: error reading part: %v", err)
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Malformed upload data"})
@@ -120,6 +194,12 @@ func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request)
 			continue
 		}
 
+		fileCount++
+		if h.Cfg.UploadMaxFilesPerRequest > 0 && fileCount > h.Cfg.UploadMaxFilesPerRequest {
+			limitError = fmt.Sprintf("Upload exceeds the limit of %d files per request", h.Cfg.UploadMaxFilesPerRequest)
+			break
+		}
+
 		filename := part.FileName()
 		rel := filename
 		if len(relPathsQueue) > 0 {
@@ -138,72 +218,164 @@ func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request)
 			rel = rel[idx+1:]
 		}
 
-		destPath := filepath.Join(albumBase, rel)
-		// security: ensure inside albumBase
-		if !strings.HasPrefix(filepath.Clean(destPath), filepath.Clean(albumBase)) {
-			log.Printf("UploadImages: blocked path traversal: %s", destPath)
+		destPath, err := utils.SecureJoin(albumBase, rel)
+		if err != nil {
+			log.Printf("UploadImages: blocked path traversal: %s", rel)
+			results = append(results, uploadFileResult{File: rel, Status: uploadStatusSkipped, Reason: "path is outside the album"})
+			continue
+		}
+		if h.Cfg.IsIgnoredPath(rel) {
+			results = append(results, uploadFileResult{File: rel, Status: uploadStatusSkipped, Reason: "file name is ignored by the library"})
 			continue
 		}
+		if err := h.Cfg.CheckSymlinks(destPath); err != nil {
+			log.Printf("UploadImages: blocked write through symlink: %s: %v", destPath, err)
+			results = append(results, uploadFileResult{File: rel, Status: uploadStatusSkipped, Reason: "path goes through a symlink the library doesn't follow"})
+			continue
+		}
+
+		// the content is checked before anything is written; the extension alone can't be trusted
+		header := make([]byte, media.SniffLength)
+		n, err := io.ReadFull(part, header)
+		if errors.As(err, &maxBytesErr) {
+			limitError = requestTooLarge
+			report(rel, destPath, uploadStatusSkipped, "request size limit reached")
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			report(rel, destPath, uploadStatusError, "failed to read file")
+			continue
+		}
+		header = header[:n]
+		if _, err := media.CheckUpload(rel, header, h.Cfg.UploadAllowedTypes); err != nil {
+			report(rel, destPath, uploadStatusSkipped, err.Error())
+			continue
+		}
+
 		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			log.Printf("UploadImages: mkdir error for %s: %v", destPath, err)
+			report(rel, destPath, uploadStatusError, "failed to create folder")
 			continue
 		}
 
-		out, err := os.Create(destPath)
+		// written next to its destination and moved there once every limit has passed, so a
+		// refused upload never truncates a file of the same name
+		out, err := os.CreateTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".upload-*")
 		if err != nil {
-			log.Printf("UploadImages: create error for %s: %v", destPath, err)
-			// broadcast error
-			if h.Hub != nil {
-				relFromRoot, _ := filepath.Rel(h.Cfg.RootDirectory, destPath)
-				h.Hub.Broadcast(realtime.Event{Type: "upload", Path: filepath.ToSlash(relFromRoot), Status: "error", Error: err.Error(), Timestamp: time.Now().Unix()})
-			}
+			report(rel, destPath, uploadStatusError, err.Error())
 			continue
 		}
+		tmpPath := out.Name()
 		// compute db key before copy for consistent events
-		relFromRoot, err := filepath.Rel(h.Cfg.RootDirectory, destPath)
+		relFromRoot, err := h.Cfg.RelativePath(destPath)
 		if err == nil && h.Hub != nil {
-			h.Hub.Broadcast(realtime.Event{Type: "upload", Path: filepath.ToSlash(relFromRoot), Status: "uploading", Timestamp: time.Now().Unix()})
+			h.Hub.Broadcast(realtime.Event{Type: "upload", Path: filepath.ToSlash(relFromRoot), Status: "uploading", UserID: uploaderID, Timestamp: time.Now().Unix()})
 		}
 
-		if _, err := io.Copy(out, part); err != nil {
-			log.Printf("UploadImages: write error for %s: %v", destPath, err)
-			out.Close()
-			if h.Hub != nil && relFromRoot != "" {
-				h.Hub.Broadcast(realtime.Event{Type: "upload", Path: filepath.ToSlash(relFromRoot), Status: "error", Error: err.Error(), Timestamp: time.Now().Unix()})
-			}
+		src := io.MultiReader(bytes.NewReader(header), part)
+		if maxFileSize > 0 {
+			src = io.LimitReader(src, maxFileSize+1)
+		}
+		if remaining >= 0 {
+			src = io.LimitReader(src, remaining+1)
+		}
+		written, err := io.Copy(out, src)
+		if err == nil {
+			err = out.Chmod(0644)
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if errors.As(err, &maxBytesErr) {
+			os.Remove(tmpPath)
+			limitError = requestTooLarge
+			report(rel, destPath, uploadStatusSkipped, "request size limit reached")
+			break
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			report(rel, destPath, uploadStatusError, err.Error())
 			continue
 		}
-		out.Close()
+		if maxFileSize > 0 && written > maxFileSize {
+			os.Remove(tmpPath)
+			report(rel, destPath, uploadStatusSkipped, fmt.Sprintf("file exceeds the %d MB size limit", h.Cfg.UploadMaxFileSizeMB))
+			continue
+		}
+		if remaining >= 0 && written > remaining {
+			// the rest of the upload is refused along with the file that didn't fit
+			os.Remove(tmpPath)
+			report(rel, destPath, uploadStatusSkipped, "upload quota exceeded")
+			quotaExceeded = true
+			break
+		}
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
+			report(rel, destPath, uploadStatusError, "failed to save file")
+			continue
+		}
+		if remaining >= 0 {
+			remaining -= written
+		}
 
 		// Ensure DB record and queue processing if raster image
 		// Compute DB key relative to root
-		relFromRoot, err = filepath.Rel(h.Cfg.RootDirectory, destPath)
+		relFromRoot, err = h.Cfg.RelativePath(destPath)
 		if err != nil {
-			log.Printf("UploadImages: failed to compute relative path for %s: %v", destPath, err)
+			report(rel, destPath, uploadStatusError, "failed to compute library path")
 			continue
 		}
 		relDBKey := filepath.ToSlash(relFromRoot)
+		InvalidateListings(relDBKey)
 
 		if h.Hub != nil {
-			h.Hub.Broadcast(realtime.Event{Type: "upload", Path: relDBKey, Status: "uploaded", Timestamp: time.Now().Unix()})
+			h.Hub.Broadcast(realtime.Event{Type: "upload", Path: relDBKey, Status: "uploaded", UserID: uploaderID, Timestamp: time.Now().Unix()})
 		}
 
 		info, err := os.Stat(destPath)
 		if err != nil {
-			log.Printf("UploadImages: stat error for %s: %v", destPath, err)
+			report(rel, destPath, uploadStatusError, err.Error())
 			continue
 		}
 
+		if media.IsVideo(destPath) {
+			var uploadedBy *uint
+			if user, ok := r.Context().Value(UserContextKey).(*models.User); ok && user != nil {
+				uploadedBy = &user.ID
+			}
+			if _, err := h.ImageRepo.EnsureVideoExists(relDBKey, info.ModTime().Unix(), uploadedBy, h.Cfg.VideoTranscodeEnabled); err != nil {
+				log.Printf("UploadImages: EnsureVideoExists error for %s: %v", relDBKey, err)
+			} else if err := h.ImageRepo.SetFileSize(relDBKey, info.Size()); err != nil {
+				log.Printf("UploadImages: SetFileSize error for %s: %v", relDBKey, err)
+			}
+			queueVideoProcessing(h.ImgProc, destPath, relDBKey, info.ModTime().Unix(), true, h.Cfg.VideoTranscodeEnabled, false)
+		}
+
+		if media.IsDocument(destPath) {
+			var uploadedBy *uint
+			if user, ok := r.Context().Value(UserContextKey).(*models.User); ok && user != nil {
+				uploadedBy = &user.ID
+			}
+			if _, err := h.ImageRepo.EnsureDocumentExists(relDBKey, info.ModTime().Unix(), uploadedBy); err != nil {
+				log.Printf("UploadImages: EnsureDocumentExists error for %s: %v", relDBKey, err)
+			} else if err := h.ImageRepo.SetFileSize(relDBKey, info.Size()); err != nil {
+				log.Printf("UploadImages: SetFileSize error for %s: %v", relDBKey, err)
+			}
+			queueDocumentThumbnail(h.ImgProc, destPath, relDBKey, info.ModTime().Unix(), workers.PriorityLow)
+		}
+
 		// Only queue tasks for raster images
-		if media.IsRasterImage(destPath) {
+		if media.IsProcessableImage(destPath) {
 			var uploadedBy *uint
 			if user, ok := r.Context().Value(UserContextKey).(*models.User); ok && user != nil {
 				uploadedBy = &user.ID
 			}
 			if _, err := h.ImageRepo.EnsureExistsWithUploader(relDBKey, info.ModTime().Unix(), uploadedBy); err != nil {
 				log.Printf("UploadImages: EnsureExists error for %s: %v", relDBKey, err)
+			} else if err := h.ImageRepo.SetFileSize(relDBKey, info.Size()); err != nil {
+				log.Printf("UploadImages: SetFileSize error for %s: %v", relDBKey, err)
 			}
-			baseJob := workers.ImageJob{OriginalImagePath: destPath, OriginalRelativePath: relDBKey, ModTimeUnix: info.ModTime().Unix()}
+			// uploads are bulk work; viewing the folder promotes its thumbnails to the high lane
+			baseJob := workers.ImageJob{OriginalImagePath: destPath, OriginalRelativePath: relDBKey, ModTimeUnix: info.ModTime().Unix(), Priority: workers.PriorityLow}
 			// Queue tasks
 			for _, task := range []string{workers.TaskThumbnail, workers.TaskMetadata, workers.TaskDetection} {
 				job := baseJob
@@ -212,10 +384,34 @@ func (h *AdminAlbumHandler) UploadImages(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
+		results = append(results, uploadFileResult{File: rel, Path: relDBKey, Status: uploadStatusSaved})
 		saved++
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{"uploaded": saved})
+	if saved > 0 {
+		activity := newActivity(r, models.ActivityImagesUploaded, album.ID)
+		activity.Count = saved
+		recordActivity(h.ActivityRepo, activity)
+	}
+	if quotaExceeded {
+		response := map[string]any{"error": "Upload quota exceeded", "uploaded": saved, "files": results}
+		if usage, err := h.Quota.Usage(uploader); err == nil {
+			response["usage"] = usage
+		} else {
+			log.Printf("UploadImages: failed to report upload usage of user %d: %v", uploader.ID, err)
+		}
+		writeJSON(w, http.StatusRequestEntityTooLarge, response)
+		return
+	}
+	if limitError != "" {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": limitError, "uploaded": saved, "files": results})
+		return
+	}
+	if saved == 0 && len(results) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "No files were accepted", "uploaded": saved, "files": results})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"uploaded": saved, "files": results})
 }
 
 // AdminAlbumResponse represents the admin view of an album with additional fields
@@ -224,7 +420,9 @@ type AdminAlbumResponse struct {
 	Name               string  `json:"name"`
 	Slug               string  `json:"slug"`
 	Description        *string `json:"description,omitempty"`
+	DescriptionHTML    *string `json:"description_html,omitempty"`
 	FolderPath         string  `json:"folder_path"`
+	LibraryID          string  `json:"library_id"`
 	BannerImagePath    *string `json:"banner_image_path,omitempty"`
 	SortOrder          string  `json:"sort_order"`
 	ZipPath            *string `json:"zip_path,omitempty"`
@@ -233,38 +431,66 @@ type AdminAlbumResponse struct {
 	ZipLastGeneratedAt *int64  `json:"zip_last_generated_at,omitempty"`
 	ZipLastRequestedAt *int64  `json:"zip_last_requested_at,omitempty"`
 	ZipError           *string `json:"zip_error,omitempty"`
-	CreatedAt          int64   `json:"created_at"`
-	UpdatedAt          int64   `json:"updated_at"`
-	IsHidden           bool    `json:"is_hidden"`
-	Location           *string `json:"location,omitempty"`
-	Artists            []struct {
+	ZipProgress        int     `json:"zip_progress"`
+	// contact sheet for proofing, downloaded from the admin album's /contact-sheet
+	ContactSheetStatus      string  `json:"contact_sheet_status"`
+	ContactSheetGeneratedAt *int64  `json:"contact_sheet_generated_at,omitempty"`
+	ContactSheetError       *string `json:"contact_sheet_error,omitempty"`
+	CreatedAt               int64   `json:"created_at"`
+	UpdatedAt               int64   `json:"updated_at"`
+	IsHidden                bool    `json:"is_hidden"`
+	IsArchived              bool    `json:"is_archived"`
+	Location                *string `json:"location,omitempty"`
+	Copyright               *string `json:"copyright,omitempty"`
+	License                 *string `json:"license,omitempty"`
+	WatermarkText           *string `json:"watermark_text,omitempty"`
+	WatermarkImagePath      *string `json:"watermark_image_path,omitempty"`
+	WatermarkPosition       string  `json:"watermark_position"`
+	WatermarkOpacity        float64 `json:"watermark_opacity"`
+	Artists                 []struct {
 		ID        uint   `json:"id"`
 		Username  string `json:"username"`
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
 	} `json:"artists,omitempty"`
+
+	AlbumAssetURLs
 }
 
 // convertAlbumToAdminResponse converts a models.Album to AdminAlbumResponse
-func convertAlbumToAdminResponse(album *models.Album) *AdminAlbumResponse {
+func convertAlbumToAdminResponse(album *models.Album, cfg config.Config) *AdminAlbumResponse {
 	return &AdminAlbumResponse{
-		ID:                 album.ID,
-		Name:               album.Name,
-		Slug:               album.Slug,
-		Description:        album.Description,
-		FolderPath:         album.FolderPath,
-		BannerImagePath:    album.BannerImagePath,
-		SortOrder:          album.SortOrder,
-		ZipPath:            album.ZipPath,
-		ZipSize:            album.ZipSize,
-		ZipStatus:          album.ZipStatus,
-		ZipLastGeneratedAt: album.ZipLastGeneratedAt,
-		ZipLastRequestedAt: album.ZipLastRequestedAt,
-		ZipError:           album.ZipError,
-		CreatedAt:          album.CreatedAt,
-		UpdatedAt:          album.UpdatedAt,
-		IsHidden:           album.IsHidden,
-		Location:           album.Location,
+		ID:                      album.ID,
+		Name:                    album.Name,
+		Slug:                    album.Slug,
+		Description:             album.Description,
+		DescriptionHTML:         album.DescriptionHTML,
+		FolderPath:              album.FolderPath,
+		LibraryID:               album.LibraryID,
+		BannerImagePath:         album.BannerImagePath,
+		SortOrder:               album.SortOrder,
+		ZipPath:                 album.ZipPath,
+		ZipSize:                 album.ZipSize,
+		ZipStatus:               album.ZipStatus,
+		ZipLastGeneratedAt:      album.ZipLastGeneratedAt,
+		ZipLastRequestedAt:      album.ZipLastRequestedAt,
+		ZipError:                album.ZipError,
+		ZipProgress:             album.ZipProgress,
+		ContactSheetStatus:      album.ContactSheetStatus,
+		ContactSheetGeneratedAt: album.ContactSheetGeneratedAt,
+		ContactSheetError:       album.ContactSheetError,
+		AlbumAssetURLs:          albumAssetURLs(cfg, album),
+		CreatedAt:               album.CreatedAt,
+		UpdatedAt:               album.UpdatedAt,
+		IsHidden:                album.IsHidden,
+		IsArchived:              album.IsArchived,
+		Location:                album.Location,
+		Copyright:               album.Copyright,
+		License:                 album.License,
+		WatermarkText:           album.WatermarkText,
+		WatermarkImagePath:      album.WatermarkImagePath,
+		WatermarkPosition:       album.WatermarkPosition,
+		WatermarkOpacity:        album.WatermarkOpacity,
 	}
 }
 
@@ -279,7 +505,7 @@ func (h *AdminAlbumHandler) ListAlbums(w http.ResponseWriter, r *http.Request) {
 
 	adminAlbums := make([]*AdminAlbumResponse, len(albums))
 	for i, album := range albums {
-		adminAlbums[i] = convertAlbumToAdminResponse(&album)
+		adminAlbums[i] = convertAlbumToAdminResponse(&album, h.Cfg)
 	}
 
 	writeJSON(w, http.StatusOK, adminAlbums)
@@ -305,7 +531,7 @@ func (h *AdminAlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	adminAlbum := convertAlbumToAdminResponse(album)
+	adminAlbum := convertAlbumToAdminResponse(album, h.Cfg)
 	// populate artists with names
 	if ids, err := h.ImageRepo.GetDistinctUploaderIDsByFolderPrefix(album.FolderPath); err == nil && len(ids) > 0 {
 		for _, id := range ids {
@@ -322,12 +548,38 @@ func (h *AdminAlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, adminAlbum)
 }
 
+// validAlbumSlug reports whether a slug can be used in album URLs
+func validAlbumSlug(slug string) bool {
+	return !strings.ContainsAny(slug, " /\\?%*:|\"<>") && strings.TrimSpace(slug) != ""
+}
+
+// maxAlbumDescriptionLength is the length of the longest album description, in characters
+const maxAlbumDescriptionLength = 5000
+
+// validateAlbumDescription checks the markdown of an album description. it is rendered to
+// sanitized HTML when the album is loaded, so only its length and characters are checked.
+func validateAlbumDescription(description *string) error {
+	if description == nil {
+		return nil
+	}
+	if utf8.RuneCountInString(*description) > maxAlbumDescriptionLength {
+		return fmt.Errorf("description cannot be longer than %d characters", maxAlbumDescriptionLength)
+	}
+	for _, r := range *description {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return errors.New("description cannot contain control characters")
+		}
+	}
+	return nil
+}
+
 // CreateAlbum creates a new album
 func (h *AdminAlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name        string  `json:"name"`
 		Slug        string  `json:"slug"`
 		FolderPath  string  `json:"folder_path"`
+		LibraryID   string  `json:"library_id"` // optional, folder_path is then relative to the library
 		Description *string `json:"description"`
 		IsHidden    *bool   `json:"is_hidden"`
 		Location    *string `json:"location"`
@@ -344,18 +596,22 @@ func (h *AdminAlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if strings.ContainsAny(req.Slug, " /\\?%*:|\"<>") || strings.TrimSpace(req.Slug) == "" {
+	if !validAlbumSlug(req.Slug) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid slug format. Use URL-safe characters without spaces."})
 		return
 	}
+	if err := validateAlbumDescription(req.Description); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 
-	cleanRelativePath := filepath.Clean(req.FolderPath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder_path must be relative and cannot use '..'"})
+	folderPathForDB, err := albumFolderPath(h.Cfg, req.LibraryID, req.FolderPath)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	folderPathForDB := filepath.ToSlash(cleanRelativePath)
-	fullPath := filepath.Join(h.Cfg.RootDirectory, folderPathForDB)
+	library, _ := h.Cfg.SplitPath(folderPathForDB)
+	fullPath := h.Cfg.ResolvePath(folderPathForDB)
 	stat, err := os.Stat(fullPath)
 	if os.IsNotExist(err) {
 		// create the directory if it doesn't exist
@@ -380,6 +636,7 @@ func (h *AdminAlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request)
 		Slug:        req.Slug,
 		Description: req.Description,
 		FolderPath:  folderPathForDB,
+		LibraryID:   library.ID,
 	}
 	if req.IsHidden != nil {
 		newAlbum.IsHidden = *req.IsHidden
@@ -402,11 +659,14 @@ func (h *AdminAlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	adminAlbum := convertAlbumToAdminResponse(&newAlbum)
+	recordActivity(h.ActivityRepo, newActivity(r, models.ActivityAlbumCreated, newAlbum.ID))
+	adminAlbum := convertAlbumToAdminResponse(&newAlbum, h.Cfg)
 	writeJSON(w, http.StatusCreated, adminAlbum)
 }
 
-// UpdateAlbum updates an existing album's settings (name, description, hidden status, location, sort order)
+// UpdateAlbum updates an existing album's settings (name, slug, description, hidden status, location, sort order,
+// copyright holder and license).
+// the former slug keeps working, requests using it are redirected to the new one.
 func (h *AdminAlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 	albumIDStr := chi.URLParam(r, "id")
 	albumID, err := strconv.ParseUint(albumIDStr, 10, 64)
@@ -428,15 +688,39 @@ func (h *AdminAlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request)
 
 	var req struct {
 		Name        *string `json:"name"`
+		Slug        *string `json:"slug"`
 		Description *string `json:"description"`
 		IsHidden    *bool   `json:"is_hidden"`
 		Location    *string `json:"location"`
 		SortOrder   *string `json:"sort_order"`
+		IsArchived  *bool   `json:"is_archived"`
+		Copyright   *string `json:"copyright"`
+		License     *string `json:"license"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	// an archived album only takes being unarchived, alone or together with other changes
+	stayArchived := album.IsArchived && (req.IsArchived == nil || *req.IsArchived)
+	if stayArchived && (req.Name != nil || req.Slug != nil || req.Description != nil || req.IsHidden != nil || req.Location != nil || req.SortOrder != nil || req.Copyright != nil || req.License != nil) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": albumArchivedMessage})
+		return
+	}
+	if req.Slug != nil && !validAlbumSlug(*req.Slug) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid slug format. Use URL-safe characters without spaces."})
+		return
+	}
+	for _, check := range []error{
+		validateAlbumDescription(req.Description),
+		validateMetadataText("copyright", req.Copyright, maxCopyrightLength, false),
+		validateMetadataText("license", req.License, maxLicenseLength, false),
+	} {
+		if check != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": check.Error()})
+			return
+		}
+	}
 
 	var nameUpdate string
 	var descUpdate *string
@@ -472,31 +756,50 @@ func (h *AdminAlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request)
 		locationUpdate = album.Location
 	}
 
-	if updateRequested {
-		err = h.AlbumRepo.Update(album.ID, nameUpdate, descUpdate, isHiddenUpdate, locationUpdate)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found during update"})
-			} else if strings.Contains(strings.ToLower(err.Error()), "unique") {
-				writeJSON(w, http.StatusConflict, map[string]string{"error": "Album name already exists"})
-			} else {
-				log.Printf("Error updating album %d/%s: %v", album.ID, album.Slug, err)
-				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update album"})
+	// the details, the slug, the sort order and the rights are changed together, or not at all
+	err = h.AlbumRepo.WithTx(func(albumRepo repository.AlbumRepositoryInterface) error {
+		if updateRequested {
+			if err := albumRepo.Update(album.ID, nameUpdate, descUpdate, isHiddenUpdate, locationUpdate); err != nil {
+				return err
+			}
+		}
+		if req.Slug != nil {
+			if err := albumRepo.UpdateSlug(album.ID, *req.Slug); err != nil {
+				return err
+			}
+		}
+		if req.SortOrder != nil {
+			if err := albumRepo.UpdateSortOrder(album.ID, *req.SortOrder); err != nil {
+				return err
 			}
-			return
 		}
+		if req.Copyright != nil || req.License != nil {
+			copyright := editedValue(album.Copyright, req.Copyright)
+			license := editedValue(album.License, req.License)
+			if err := albumRepo.UpdateRights(album.ID, copyright, license); err != nil {
+				return err
+			}
+		}
+		if req.IsArchived != nil && *req.IsArchived != album.IsArchived {
+			return albumRepo.SetArchived(album.ID, *req.IsArchived)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found during update"})
+		} else if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Album name or slug already exists"})
+		} else {
+			log.Printf("Error updating album %d/%s: %v", album.ID, album.Slug, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update album"})
+		}
+		return
 	}
 
-	if req.SortOrder != nil {
-		err = h.AlbumRepo.UpdateSortOrder(album.ID, *req.SortOrder)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found during sort order update"})
-			} else {
-				log.Printf("Error updating sort order for album %d/%s: %v", album.ID, album.Slug, err)
-				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update sort order"})
-			}
-			return
+	if req.IsArchived != nil && *req.IsArchived != album.IsArchived && h.ImgProc != nil {
+		if err := h.ImgProc.RefreshArchivedFolders(); err != nil {
+			log.Printf("Error refreshing archived album folders after updating album %d/%s: %v", album.ID, album.Slug, err)
 		}
 	}
 
@@ -507,10 +810,40 @@ func (h *AdminAlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	adminAlbum := convertAlbumToAdminResponse(updatedAlbum)
+	adminAlbum := convertAlbumToAdminResponse(updatedAlbum, h.Cfg)
 	writeJSON(w, http.StatusOK, adminAlbum)
 }
 
+// albumArchivedMessage is the error message for changes to archived albums
+const albumArchivedMessage = "Album is archived and read-only"
+
+// RejectArchivedAlbum responds 409 Conflict to requests changing an archived album, like
+// uploads, deletions and edits. the album is taken from the {id} URL parameter.
+func (h *AdminAlbumHandler) RejectArchivedAlbum(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		albumID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid album ID"})
+			return
+		}
+		album, err := h.AlbumRepo.GetByID(uint(albumID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+			} else {
+				log.Printf("Error finding album %d to check its archived state: %v", albumID, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+			}
+			return
+		}
+		if album.IsArchived {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": albumArchivedMessage})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // DeleteAlbum deletes an album
 func (h *AdminAlbumHandler) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
 	albumIDStr := chi.URLParam(r, "id")
@@ -631,14 +964,20 @@ func (h *AdminAlbumHandler) ListAlbumImages(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	albumFullPath := filepath.Join(h.Cfg.RootDirectory, album.FolderPath)
+	albumFullPath := h.Cfg.ResolvePath(album.FolderPath)
 	albumFullPath = filepath.Clean(albumFullPath)
-	if !strings.HasPrefix(albumFullPath, h.Cfg.RootDirectory) {
+	if library, _ := h.Cfg.SplitPath(album.FolderPath); !utils.IsWithin(library.Path, albumFullPath) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
 		return
 	}
 
-    files, totalCount, err := listDirectoryContents(albumFullPath, "/"+album.FolderPath, h.Cfg, h.ImageRepo, h.ImgProc, album.SortOrder, -1, -1)
+	offset, limit, err := parsePageParams(r, 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	files, totalCount, err := listDirectoryContents(albumFullPath, "/"+album.FolderPath, h.Cfg, h.ImageRepo, h.ImgProc, album.SortOrder, offset, limit, false, false)
 	if err != nil {
 		if os.IsNotExist(err) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album folder not found on disk: " + album.FolderPath})
@@ -651,7 +990,9 @@ func (h *AdminAlbumHandler) ListAlbumImages(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-    writeJSON(w, http.StatusOK, DirectoryListing{Path: "/" + album.FolderPath, Files: files, Total: totalCount, Offset: 0, Limit: len(files), HasMore: false})
+	listing := DirectoryListing{Path: "/" + album.FolderPath, Files: files}
+	listing.paginate(offset, limit, totalCount)
+	writeJSON(w, http.StatusOK, listing)
 }
 
 // DeleteAlbumImage deletes a single image file within an album and removes DB records and generated assets
@@ -687,59 +1028,35 @@ func (h *AdminAlbumHandler) DeleteAlbumImage(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Try to get image DB record to find generated thumbnail path
-	var existingThumbPath *string
+	// Try to get image DB record to find generated thumbnail paths
+	var existingAssets []string
 	if img, err := h.ImageRepo.GetByPath(relPath); err == nil && img != nil {
-		existingThumbPath = img.ThumbnailPath
+		existingAssets = img.AssetPaths()
 	}
 
 	// Delete the original file from disk
-	fullPath := filepath.Join(h.Cfg.RootDirectory, relPath)
+	fullPath := h.Cfg.ResolvePath(relPath)
 	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
 		log.Printf("Error deleting original image '%s': %v", fullPath, err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete original image"})
 		return
 	}
 
-	// Best-effort delete of generated thumbnail asset if known
-	if existingThumbPath != nil && *existingThumbPath != "" {
-		thumbFull := filepath.Join(h.Cfg.MediaStoragePath, filepath.FromSlash(*existingThumbPath))
-		if err := os.Remove(thumbFull); err != nil && !os.IsNotExist(err) {
-			log.Printf("Warning: failed to delete thumbnail asset '%s': %v", thumbFull, err)
+	// Best-effort delete of generated assets if known
+	for _, asset := range existingAssets {
+		assetFull := filepath.Join(h.Cfg.MediaStoragePath, filepath.FromSlash(asset))
+		if err := os.Remove(assetFull); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to delete generated asset '%s': %v", assetFull, err)
 		}
 	}
 
-	// Delete DB records: image row, faces and embeddings for this image using GORM and a transaction
-	if repo, ok := h.ImageRepo.(*repository.ImageRepository); ok && repo != nil {
-		if err := repo.DB.Transaction(func(tx *gorm.DB) error {
-			var faceIDs []uint
-			if err := tx.Model(&models.Face{}).Where("image_path = ?", relPath).Pluck("id", &faceIDs).Error; err != nil {
-				return err
-			}
-			if len(faceIDs) > 0 {
-				if err := tx.Where("face_id IN ?", faceIDs).Delete(&models.FaceEmbedding{}).Error; err != nil {
-					return err
-				}
-			}
-			if err := tx.Where("image_path = ?", relPath).Delete(&models.Face{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("original_path = ?", relPath).Delete(&models.Image{}).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-				return err
-			}
-			return nil
-		}); err != nil {
-			log.Printf("Error deleting image and related records for %s: %v", relPath, err)
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete image record"})
-			return
-		}
-	} else {
-		if err := h.ImageRepo.Delete(relPath); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			log.Printf("Error deleting image DB record %s: %v", relPath, err)
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete image record"})
-			return
-		}
+	// Delete DB records: image row, faces and embeddings for this image
+	if err := h.ImageRepo.DeleteWithFaces(relPath); err != nil {
+		log.Printf("Error deleting image and related records for %s: %v", relPath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete image record"})
+		return
 	}
+	InvalidateListings(relPath)
 
 	writeJSON(w, http.StatusNoContent, nil)
 }
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newUploadTestHandler returns a handler uploading into the album "shoot" of a library in a
+// temporary folder, and the folder of the album
+func newUploadTestHandler(t *testing.T, cfg config.Config) (*AdminAlbumHandler, uint, string) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrateModels(db); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	cfg.RootDirectory = root
+	cfg.Libraries = []config.Library{{ID: config.DefaultLibraryID, Path: root}}
+	cfg.UploadAllowedTypes = []string{"image/jpeg"}
+
+	albumRepo := repository.NewAlbumRepository(db)
+	album := &models.Album{Name: "Shoot", Slug: "shoot", FolderPath: "shoot"}
+	if err := db.Create(album).Error; err != nil {
+		t.Fatal(err)
+	}
+	albumDir := filepath.Join(root, "shoot")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	imageRepo := repository.NewImageRepository(db)
+	handler := &AdminAlbumHandler{
+		AlbumRepo: albumRepo,
+		ImageRepo: imageRepo,
+		Cfg:       cfg,
+		ImgProc:   &workers.ImageProcessor{},
+		Quota:     &UploadQuota{ImageRepo: imageRepo},
+	}
+	return handler, album.ID, albumDir
+}
+
+// uploadRequest builds an upload of one JPEG file of size bytes into an album
+func uploadRequest(t *testing.T, albumID uint, name string, size int, user *models.User) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, size)
+	copy(content, "\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/albums/"+strconv.Itoa(int(albumID))+"/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", strconv.Itoa(int(albumID)))
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	if user != nil {
+		ctx = context.WithValue(ctx, UserContextKey, user)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestUploadImagesRefusedUploadKeepsExistingFile(t *testing.T) {
+	quotaMB := 1
+	tests := []struct {
+		name string
+		cfg  config.Config
+		size int
+		user *models.User
+		// sent without a Content-Length, so the request limit is only hit while copying
+		chunked bool
+		want    int
+	}{
+		{
+			name: "upload quota exceeded",
+			size: 2 << 20,
+			user: &models.User{ID: 7, Username: "uploader", UploadQuotaMB: &quotaMB},
+			want: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "file size limit exceeded",
+			cfg:  config.Config{UploadMaxFileSizeMB: 1},
+			size: 2 << 20,
+			want: http.StatusBadRequest,
+		},
+		{
+			name:    "request size limit reached",
+			cfg:     config.Config{UploadMaxRequestSizeMB: 1},
+			size:    2 << 20,
+			chunked: true,
+			want:    http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, albumID, albumDir := newUploadTestHandler(t, tt.cfg)
+			existing := filepath.Join(albumDir, "a.jpg")
+			if err := os.WriteFile(existing, []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r := uploadRequest(t, albumID, "a.jpg", tt.size, tt.user)
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.UploadImages(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			content, err := os.ReadFile(existing)
+			if err != nil {
+				t.Fatalf("existing file is gone: %v", err)
+			}
+			if string(content) != "original" {
+				t.Errorf("existing file was overwritten with %d bytes", len(content))
+			}
+			entries, err := os.ReadDir(albumDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.Contains(entry.Name(), ".upload-") {
+					t.Errorf("temporary file %s was left behind", entry.Name())
+				}
+			}
+		})
+	}
+}
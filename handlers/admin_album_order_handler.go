@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const maxImageOrderPaths = 10000
+
+// ImageOrderPayload is the custom order of the files of one folder of an album, usually the
+// album folder itself. paths are relative to the root directory, like the paths in album
+// listings; files left out follow the listed ones by name.
+type ImageOrderPayload struct {
+	Paths []string `json:"paths"`
+}
+
+type ImageOrderResponse struct {
+	Folder    string `json:"folder"`
+	SortOrder string `json:"sort_order"`
+	Count     int    `json:"count"`
+}
+
+// UpdateImageOrder stores a custom order for the files of an album folder and switches the
+// album to the custom sort order
+func (h *AdminAlbumHandler) UpdateImageOrder(w http.ResponseWriter, r *http.Request) {
+	albumIDStr := chi.URLParam(r, "id")
+	albumID, err := strconv.ParseUint(albumIDStr, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid album ID"})
+		return
+	}
+
+	album, err := h.AlbumRepo.GetByID(uint(albumID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album %d for reordering: %v", albumID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		}
+		return
+	}
+
+	var payload ImageOrderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if len(payload.Paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths must not be empty"})
+		return
+	}
+	if len(payload.Paths) > maxImageOrderPaths {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d paths can be ordered at once", maxImageOrderPaths)})
+		return
+	}
+
+	// every path must be directly in the same folder, inside the album
+	var folder string
+	seen := make(map[string]bool, len(payload.Paths))
+	paths := make([]string, len(payload.Paths))
+	for i, rawPath := range payload.Paths {
+		relPath := filepath.ToSlash(strings.TrimPrefix(rawPath, "/"))
+		if relPath != path.Clean(relPath) || !strings.HasPrefix(relPath, album.FolderPath+"/") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path is not within the album: " + rawPath})
+			return
+		}
+		if i == 0 {
+			folder = path.Dir(relPath)
+		} else if path.Dir(relPath) != folder {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "all paths must be in the same folder"})
+			return
+		}
+		if seen[relPath] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "duplicate path: " + rawPath})
+			return
+		}
+		seen[relPath] = true
+		paths[i] = relPath
+	}
+
+	if err := h.ImageRepo.SetSortPositions(folder, paths); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown image in paths (" + err.Error() + ")"})
+		} else {
+			log.Printf("Error storing image order of album %d (%s): %v", album.ID, folder, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to store image order"})
+		}
+		return
+	}
+	InvalidateListings(folder)
+
+	if album.SortOrder != database.SortCustom {
+		if err := h.AlbumRepo.UpdateSortOrder(album.ID, database.SortCustom); err != nil {
+			log.Printf("Error switching album %d to the custom sort order: %v", album.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Image order stored, but failed to update the album sort order"})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, ImageOrderResponse{Folder: folder, SortOrder: database.SortCustom, Count: len(paths)})
+}
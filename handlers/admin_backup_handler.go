@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/go-chi/chi/v5"
+)
+
+// form field of an uploaded backup
+const backupUploadField = "backup"
+
+type AdminBackupHandler struct {
+	BackupService *services.BackupService
+}
+
+func NewAdminBackupHandler(backupService *services.BackupService) *AdminBackupHandler {
+	return &AdminBackupHandler{BackupService: backupService}
+}
+
+// writeBackupError maps backup service errors to responses
+func writeBackupError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrBackupNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Backup not found"})
+	case errors.Is(err, services.ErrBackupInvalid):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrBackupInProgress):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error %s: %v", action, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed " + action})
+	}
+}
+
+// ListBackups lists the backups in the backup folder, newest first
+// Route: GET /api/admin/backups
+func (h *AdminBackupHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.BackupService.List()
+	if err != nil {
+		writeBackupError(w, err, "listing backups")
+		return
+	}
+	writeJSON(w, http.StatusOK, backups)
+}
+
+// CreateBackup backs up the database and the runtime settings. job processing and the
+// maintenance schedule are paused until the snapshot is written.
+// Route: POST /api/admin/backups
+func (h *AdminBackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.BackupService.Create()
+	if err != nil {
+		writeBackupError(w, err, "creating backup")
+		return
+	}
+	writeJSON(w, http.StatusCreated, backup)
+}
+
+// UploadBackup stores a backup uploaded as the "backup" field of a multipart form, e.g.
+// one downloaded from another server, so it can be restored
+// Route: POST /api/admin/backups/upload
+func (h *AdminBackupHandler) UploadBackup(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Expected a multipart form"})
+		return
+	}
+	// streamed to disk part by part, as backups can be larger than memory
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("No file uploaded in '%s' field", backupUploadField)})
+			return
+		}
+		if part.FormName() != backupUploadField {
+			part.Close()
+			continue
+		}
+		backup, err := h.BackupService.Save(part)
+		part.Close()
+		if err != nil {
+			writeBackupError(w, err, "storing uploaded backup")
+			return
+		}
+		writeJSON(w, http.StatusCreated, backup)
+		return
+	}
+}
+
+// DownloadBackup serves a backup file
+// Route: GET /api/admin/backups/{name}
+func (h *AdminBackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	fullPath, err := h.BackupService.Path(name)
+	if err != nil {
+		writeBackupError(w, err, "finding backup")
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		writeBackupError(w, err, "reading backup")
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("ETag", assetETag(info))
+	http.ServeFile(w, r, fullPath)
+}
+
+// DeleteBackup removes a backup from the backup folder
+// Route: DELETE /api/admin/backups/{name}
+func (h *AdminBackupHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	if err := h.BackupService.Delete(chi.URLParam(r, "name")); err != nil {
+		writeBackupError(w, err, "deleting backup")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// RestoreBackup replaces the database with the one in a backup, after backing up the
+// current one. changes are refused with 503 while the restore runs; the runtime settings
+// of the backup apply right after.
+// Route: POST /api/admin/backups/{name}/restore
+func (h *AdminBackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	fullPath, err := h.BackupService.Path(chi.URLParam(r, "name"))
+	if err != nil {
+		writeBackupError(w, err, "finding backup")
+		return
+	}
+	manifest, err := h.BackupService.Restore(fullPath)
+	if err != nil {
+		writeBackupError(w, err, "restoring backup")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"restored": manifest})
+}
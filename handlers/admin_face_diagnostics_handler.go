@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// number of leading embedding values included in embedding stats
+const embeddingHeadLength = 10
+
+// AdminFaceDiagnosticsHandler inspects face embeddings and the similarities between them, to
+// look into faces that are wrongly matched or not matched at all
+type AdminFaceDiagnosticsHandler struct {
+	FaceRepo               repository.FaceRepositoryInterface
+	EmbeddingRepo          repository.FaceEmbeddingRepositoryInterface
+	FaceRecognitionService *services.FaceRecognitionService
+}
+
+func NewAdminFaceDiagnosticsHandler(faceRepo repository.FaceRepositoryInterface, embeddingRepo repository.FaceEmbeddingRepositoryInterface, faceRecognitionService *services.FaceRecognitionService) *AdminFaceDiagnosticsHandler {
+	return &AdminFaceDiagnosticsHandler{FaceRepo: faceRepo, EmbeddingRepo: embeddingRepo, FaceRecognitionService: faceRecognitionService}
+}
+
+// EmbeddingStats describes the embedding of a face
+type EmbeddingStats struct {
+	FaceID       uint      `json:"face_id"`
+	Model        string    `json:"model"`
+	Dimensions   int       `json:"dimensions"`
+	Norm         float64   `json:"norm"` // L2 norm; about 1 for normalized embeddings
+	Min          float32   `json:"min"`
+	Max          float32   `json:"max"`
+	Mean         float64   `json:"mean"`
+	StdDev       float64   `json:"std_dev"`
+	Zeros        int       `json:"zeros"`
+	NonFinite    int       `json:"non_finite"` // NaN or infinite values, a sign of a broken model run
+	QualityScore *float32  `json:"quality_score,omitempty"`
+	Head         []float32 `json:"head"` // the first values
+	UpdatedAt    int64     `json:"updated_at"`
+}
+
+func newEmbeddingStats(embedding *models.FaceEmbedding) EmbeddingStats {
+	values := embedding.GetEmbedding()
+	stats := EmbeddingStats{
+		FaceID:       embedding.FaceID,
+		Model:        embedding.EmbeddingModel,
+		Dimensions:   len(values),
+		QualityScore: embedding.QualityScore,
+		Head:         values[:min(embeddingHeadLength, len(values))],
+		UpdatedAt:    embedding.UpdatedAt,
+	}
+	if len(values) == 0 {
+		return stats
+	}
+	var sum, sumSquares float64
+	finite := 0
+	for _, v := range values {
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			stats.NonFinite++
+			continue
+		}
+		if v == 0 {
+			stats.Zeros++
+		}
+		if finite == 0 {
+			stats.Min, stats.Max = v, v
+		}
+		stats.Min = min(stats.Min, v)
+		stats.Max = max(stats.Max, v)
+		sum += f
+		sumSquares += f * f
+		finite++
+	}
+	stats.Norm = math.Sqrt(sumSquares)
+	if finite > 0 {
+		stats.Mean = sum / float64(finite)
+		stats.StdDev = math.Sqrt(max(sumSquares/float64(finite)-stats.Mean*stats.Mean, 0))
+	}
+	return stats
+}
+
+// FaceComparison is the similarity of the embeddings of two faces
+type FaceComparison struct {
+	FaceA      *models.Face   `json:"face_a"`
+	FaceB      *models.Face   `json:"face_b"`
+	EmbeddingA EmbeddingStats `json:"embedding_a"`
+	EmbeddingB EmbeddingStats `json:"embedding_b"`
+	Similarity float32        `json:"similarity"` // cosine similarity
+	Threshold  float32        `json:"threshold"`  // the similarity faces need to be considered a match
+	Match      bool           `json:"match"`
+	Identical  bool           `json:"identical"` // the embeddings are exactly equal
+}
+
+// ImageFaceSimilarities holds the similarity of each pair of faces in an image
+type ImageFaceSimilarities struct {
+	Path   string        `json:"path"`
+	Faces  []models.Face `json:"faces"`
+	Models []string      `json:"models"` // embedding model of each face, "" if it has no embedding
+	// Matrix[i][j] is the similarity of Faces[i] and Faces[j], null if either has no
+	// embedding or they were embedded with different models
+	Matrix    [][]*float32 `json:"matrix"`
+	Threshold float32      `json:"threshold"`
+}
+
+// GetEmbeddingStats returns statistics of the embedding of a face
+// Route: GET /api/admin/diagnostics/faces/{face_id}/embedding
+func (h *AdminFaceDiagnosticsHandler) GetEmbeddingStats(w http.ResponseWriter, r *http.Request) {
+	faceID, err := strconv.ParseUint(chi.URLParam(r, "face_id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid face ID format"})
+		return
+	}
+	embedding, ok := h.embedding(w, uint(faceID))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newEmbeddingStats(embedding))
+}
+
+// CompareFaces returns the similarity of the embeddings of any two faces and whether they
+// would be considered a match
+// Route: GET /api/admin/diagnostics/faces/compare?a={face_id}&b={face_id}
+func (h *AdminFaceDiagnosticsHandler) CompareFaces(w http.ResponseWriter, r *http.Request) {
+	if h.FaceRecognitionService == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Face recognition service not available"})
+		return
+	}
+	var faceIDs [2]uint
+	for i, param := range []string{"a", "b"} {
+		id, err := strconv.ParseUint(r.URL.Query().Get(param), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Missing or invalid face ID in query parameter: %s", param)})
+			return
+		}
+		faceIDs[i] = uint(id)
+	}
+
+	var faces [2]*models.Face
+	var embeddings [2]*models.FaceEmbedding
+	for i, faceID := range faceIDs {
+		face, err := h.FaceRepo.GetByID(faceID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Face %d not found", faceID)})
+			} else {
+				log.Printf("Error getting face %d: %v", faceID, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve face"})
+			}
+			return
+		}
+		embedding, ok := h.embedding(w, faceID)
+		if !ok {
+			return
+		}
+		faces[i], embeddings[i] = face, embedding
+	}
+
+	a, b := embeddings[0].GetEmbedding(), embeddings[1].GetEmbedding()
+	if len(a) != len(b) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": fmt.Sprintf("Embeddings have different dimensions (%d and %d), re-embed the faces with the same model", len(a), len(b))})
+		return
+	}
+	similarity := h.FaceRecognitionService.CalculateSimilarity(a, b)
+	threshold := h.FaceRecognitionService.GetSimilarityThreshold()
+	identical := true
+	for i := range a {
+		if a[i] != b[i] {
+			identical = false
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, FaceComparison{
+		FaceA:      faces[0],
+		FaceB:      faces[1],
+		EmbeddingA: newEmbeddingStats(embeddings[0]),
+		EmbeddingB: newEmbeddingStats(embeddings[1]),
+		Similarity: similarity,
+		Threshold:  threshold,
+		Match:      similarity >= threshold,
+		Identical:  identical,
+	})
+}
+
+// GetImageSimilarityMatrix returns the similarity of every pair of faces in an image, e.g. to
+// check that the faces of different people in a group photo are told apart
+// Route: GET /api/admin/diagnostics/faces/matrix?path=...
+func (h *AdminFaceDiagnosticsHandler) GetImageSimilarityMatrix(w http.ResponseWriter, r *http.Request) {
+	if h.FaceRecognitionService == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Face recognition service not available"})
+		return
+	}
+	raw := r.URL.Query().Get("path")
+	if raw == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return
+	}
+	imagePath := strings.TrimPrefix(path.Clean("/"+raw), "/")
+
+	faces, err := h.FaceRepo.ListByImagePath(imagePath)
+	if err != nil {
+		log.Printf("Error listing faces of %s: %v", imagePath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list faces"})
+		return
+	}
+	result := ImageFaceSimilarities{
+		Path:      "/" + imagePath,
+		Faces:     faces,
+		Models:    make([]string, len(faces)),
+		Matrix:    make([][]*float32, len(faces)),
+		Threshold: h.FaceRecognitionService.GetSimilarityThreshold(),
+	}
+	if result.Faces == nil {
+		result.Faces = []models.Face{}
+	}
+
+	vectors := make([][]float32, len(faces))
+	for i := range faces {
+		embedding, err := h.EmbeddingRepo.GetByFaceID(faces[i].ID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			log.Printf("Error getting embedding of face %d: %v", faces[i].ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve face embedding"})
+			return
+		}
+		result.Models[i] = embedding.EmbeddingModel
+		vectors[i] = embedding.GetEmbedding()
+	}
+	for i := range faces {
+		result.Matrix[i] = make([]*float32, len(faces))
+		for j := range faces {
+			if vectors[i] == nil || vectors[j] == nil || result.Models[i] != result.Models[j] || len(vectors[i]) != len(vectors[j]) {
+				continue
+			}
+			similarity := h.FaceRecognitionService.CalculateSimilarity(vectors[i], vectors[j])
+			result.Matrix[i][j] = &similarity
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// embedding loads the embedding of a face, writing the error response if it can't
+func (h *AdminFaceDiagnosticsHandler) embedding(w http.ResponseWriter, faceID uint) (*models.FaceEmbedding, bool) {
+	embedding, err := h.EmbeddingRepo.GetByFaceID(faceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Face %d has no embedding", faceID)})
+		} else {
+			log.Printf("Error getting embedding of face %d: %v", faceID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve face embedding"})
+		}
+		return nil, false
+	}
+	return embedding, true
+}
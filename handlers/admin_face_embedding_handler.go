@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/workers"
+)
+
+type AdminFaceEmbeddingHandler struct {
+	ImageProcessor *workers.ImageProcessor
+	Scheduler      *workers.Scheduler
+}
+
+func NewAdminFaceEmbeddingHandler(imageProcessor *workers.ImageProcessor, scheduler *workers.Scheduler) *AdminFaceEmbeddingHandler {
+	return &AdminFaceEmbeddingHandler{ImageProcessor: imageProcessor, Scheduler: scheduler}
+}
+
+// GetFaceEmbeddingProgress returns the progress of the last face embedding run
+// Route: GET /api/admin/faces/embeddings
+func (h *AdminFaceEmbeddingHandler) GetFaceEmbeddingProgress(w http.ResponseWriter, r *http.Request) {
+	progress, ok := h.ImageProcessor.LastFaceEmbeddingProgress()
+	if !ok {
+		http.Error(w, "No face embedding run has started yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(progress)
+}
+
+// StartFaceEmbedding queues embedding of every face that has no embedding from the current
+// recognition model, including tagged faces and faces embedded with an older model. progress
+// is broadcast as "face_embedding" events and available from GetFaceEmbeddingProgress.
+// Route: POST /api/admin/faces/embeddings/reprocess
+func (h *AdminFaceEmbeddingHandler) StartFaceEmbedding(w http.ResponseWriter, r *http.Request) {
+	if !h.ImageProcessor.Config.FaceRecognitionEnabled {
+		http.Error(w, "Face recognition is disabled", http.StatusConflict)
+		return
+	}
+	if progress, ok := h.ImageProcessor.LastFaceEmbeddingProgress(); ok && progress.Running {
+		http.Error(w, workers.ErrFaceEmbeddingRunning.Error(), http.StatusConflict)
+		return
+	}
+	status, err := h.Scheduler.RunNow(workers.MaintenanceFaceEmbedding)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(scheduleResponse(status))
+}
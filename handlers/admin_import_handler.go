@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/workers"
+)
+
+type AdminImportHandler struct {
+	Importer *workers.Importer
+	Cfg      config.Config
+}
+
+func NewAdminImportHandler(importer *workers.Importer, cfg config.Config) *AdminImportHandler {
+	return &AdminImportHandler{Importer: importer, Cfg: cfg}
+}
+
+// GetImport returns the report of the running or last import
+// Route: GET /api/admin/imports
+func (h *AdminImportHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.Importer.Report()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "No import has run yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// StartImport imports a Google Takeout export or a folder with JSON sidecars from the import
+// folder into a library folder. it runs in the background; progress is broadcast as "import"
+// events and the report is available from GetImport.
+// Route: POST /api/admin/imports
+func (h *AdminImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	if h.Cfg.ImportPath == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Imports are disabled, IMPORT_PATH is not set"})
+		return
+	}
+	var req struct {
+		Source      string `json:"source"`      // folder inside the import folder
+		Destination string `json:"destination"` // library folder, relative to the root
+		Move        bool   `json:"move"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		return
+	}
+	if strings.TrimSpace(req.Destination) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "destination is required"})
+		return
+	}
+
+	opts := workers.ImportOptions{
+		// cleaned from the top so the source can't climb out of the import folder
+		Source:      filepath.Join(h.Cfg.ImportPath, filepath.Clean("/"+req.Source)),
+		Destination: req.Destination,
+		Move:        req.Move,
+	}
+	if user := currentUser(r); user != nil {
+		opts.UserID = &user.ID
+	}
+	report, err := h.Importer.Start(opts)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, workers.ErrImportRunning) {
+			status = http.StatusConflict
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, report)
+}
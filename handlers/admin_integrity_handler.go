@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/workers"
+)
+
+type AdminIntegrityHandler struct {
+	ImageProcessor *workers.ImageProcessor
+	Scheduler      *workers.Scheduler
+}
+
+func NewAdminIntegrityHandler(imageProcessor *workers.ImageProcessor, scheduler *workers.Scheduler) *AdminIntegrityHandler {
+	return &AdminIntegrityHandler{ImageProcessor: imageProcessor, Scheduler: scheduler}
+}
+
+// GetIntegrityReport returns the report of the last integrity check
+func (h *AdminIntegrityHandler) GetIntegrityReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.ImageProcessor.LastIntegrityReport()
+	if !ok {
+		http.Error(w, "No integrity check has run yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// StartIntegrityCheck starts an integrity check in the background. progress is broadcast as
+// "integrity" events and the result is available from GetIntegrityReport when it completes.
+func (h *AdminIntegrityHandler) StartIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Scheduler.RunNow(workers.MaintenanceIntegrityCheck)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(scheduleResponse(status))
+}
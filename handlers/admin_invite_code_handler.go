@@ -3,10 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/camden-git/mediasysbackend/email"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
 	"github.com/go-chi/chi/v5"
@@ -15,15 +18,25 @@ import (
 
 type AdminInviteCodeHandler struct {
 	InviteCodeRepo repository.InviteCodeRepository
+	UserRepo       repository.UserRepository
+	Notifier       *email.Notifier // sends invite emails
 }
 
-func NewAdminInviteCodeHandler(inviteCodeRepo repository.InviteCodeRepository) *AdminInviteCodeHandler {
-	return &AdminInviteCodeHandler{InviteCodeRepo: inviteCodeRepo}
+func NewAdminInviteCodeHandler(inviteCodeRepo repository.InviteCodeRepository, userRepo repository.UserRepository, notifier *email.Notifier) *AdminInviteCodeHandler {
+	return &AdminInviteCodeHandler{InviteCodeRepo: inviteCodeRepo, UserRepo: userRepo, Notifier: notifier}
 }
 
 type InviteCodeCreatePayload struct {
 	ExpiresAt *string `json:"expires_at,omitempty"` // ISO 8601 format e.g., "2023-12-31T23:59:59Z" or null
 	MaxUses   *int    `json:"max_uses,omitempty"`   // Nullable for unlimited
+	Email     string  `json:"email,omitempty"`      // if set, the new code is emailed to this address
+	BindEmail bool    `json:"bind_email,omitempty"` // only allow registering with Email
+}
+
+// InviteCodeSendPayload emails an existing invite code
+type InviteCodeSendPayload struct {
+	Email     string `json:"email"` // defaults to the address the code was last sent to
+	BindEmail *bool  `json:"bind_email,omitempty"`
 }
 
 type InviteCodeUpdatePayload struct {
@@ -43,24 +56,41 @@ type InviteCodeResponseDTO struct {
 	CreatedByUserID uint    `json:"created_by_user_id"`
 	CreatedAt       string  `json:"created_at"`
 	UpdatedAt       string  `json:"updated_at"`
+
+	Email            *string `json:"email,omitempty"`
+	BindEmail        bool    `json:"bind_email"`
+	EmailSentAt      *string `json:"email_sent_at,omitempty"`
+	OpenedAt         *string `json:"opened_at,omitempty"`
+	RedeemedAt       *string `json:"redeemed_at,omitempty"`
+	RedeemedByUserID *uint   `json:"redeemed_by_user_id,omitempty"`
 }
 
-func toInviteCodeResponseDTO(ic *models.InviteCode) InviteCodeResponseDTO {
-	var expiresAtStr *string
-	if ic.ExpiresAt != nil {
-		s := ic.ExpiresAt.Format(time.RFC3339)
-		expiresAtStr = &s
+// formatOptionalTime formats a nullable time as RFC3339
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
 	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+func toInviteCodeResponseDTO(ic *models.InviteCode) InviteCodeResponseDTO {
 	return InviteCodeResponseDTO{
-		ID:              ic.ID,
-		Code:            ic.Code,
-		ExpiresAt:       expiresAtStr,
-		MaxUses:         ic.MaxUses,
-		Uses:            ic.Uses,
-		IsActive:        ic.IsActive,
-		CreatedByUserID: ic.CreatedByUserID,
-		CreatedAt:       ic.CreatedAt.Format(http.TimeFormat),
-		UpdatedAt:       ic.UpdatedAt.Format(http.TimeFormat),
+		ID:               ic.ID,
+		Code:             ic.Code,
+		ExpiresAt:        formatOptionalTime(ic.ExpiresAt),
+		MaxUses:          ic.MaxUses,
+		Uses:             ic.Uses,
+		IsActive:         ic.IsActive,
+		CreatedByUserID:  ic.CreatedByUserID,
+		CreatedAt:        ic.CreatedAt.Format(http.TimeFormat),
+		UpdatedAt:        ic.UpdatedAt.Format(http.TimeFormat),
+		Email:            ic.Email,
+		BindEmail:        ic.BindEmail,
+		EmailSentAt:      formatOptionalTime(ic.EmailSentAt),
+		OpenedAt:         formatOptionalTime(ic.OpenedAt),
+		RedeemedAt:       formatOptionalTime(ic.RedeemedAt),
+		RedeemedByUserID: ic.RedeemedByUserID,
 	}
 }
 
@@ -128,6 +158,16 @@ func (h *AdminInviteCodeHandler) CreateInviteCode(w http.ResponseWriter, r *http
 		MaxUses:         payload.MaxUses,
 	}
 
+	var recipient *string
+	if payload.Email != "" {
+		address, status, err := h.checkRecipient(payload.Email)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		recipient = address
+	}
+
 	if payload.ExpiresAt != nil && *payload.ExpiresAt != "" {
 		t, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
 		if err != nil {
@@ -142,6 +182,14 @@ func (h *AdminInviteCodeHandler) CreateInviteCode(w http.ResponseWriter, r *http
 		return
 	}
 
+	if recipient != nil {
+		if err := h.sendInvite(inviteCode, currentUser, *recipient, payload.BindEmail); err != nil {
+			log.Printf("Failed to email invite code %d to %s: %v", inviteCode.ID, *recipient, err)
+			http.Error(w, "Invite code created but the email could not be sent: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
 	reloadedCode, err := h.InviteCodeRepo.GetByID(inviteCode.ID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve newly created invite code: "+err.Error(), http.StatusInternalServerError)
@@ -233,3 +281,108 @@ func (h *AdminInviteCodeHandler) DeleteInviteCode(w http.ResponseWriter, r *http
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// checkRecipient validates an invite address, returning it normalized or an error with the
+// HTTP status to respond with
+func (h *AdminInviteCodeHandler) checkRecipient(raw string) (*string, int, error) {
+	if !h.Notifier.Enabled() {
+		return nil, http.StatusServiceUnavailable, errors.New("Invite emails are unavailable because email is not configured")
+	}
+	address, err := normalizeEmail(raw)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if address == nil {
+		return nil, http.StatusBadRequest, errors.New("email is required")
+	}
+	taken, err := emailTaken(h.UserRepo, address, 0)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("Failed to check email address: " + err.Error())
+	}
+	if taken {
+		return nil, http.StatusConflict, errors.New("A user with this email address already exists")
+	}
+	return address, http.StatusOK, nil
+}
+
+// sendInvite emails an invite code and records where it was sent
+func (h *AdminInviteCodeHandler) sendInvite(inviteCode *models.InviteCode, sender *models.User, address string, bindEmail bool) error {
+	invitedBy := strings.TrimSpace(sender.FirstName + " " + sender.LastName)
+	if invitedBy == "" {
+		invitedBy = sender.Username
+	}
+	if err := h.Notifier.Invite(address, inviteCode.Code, invitedBy, inviteCode.ExpiresAt); err != nil {
+		return err
+	}
+	now := time.Now()
+	inviteCode.Email = &address
+	inviteCode.BindEmail = bindEmail
+	inviteCode.EmailSentAt = &now
+	if err := h.InviteCodeRepo.Update(inviteCode); err != nil {
+		log.Printf("Invite code %d was emailed to %s but recording it failed: %v", inviteCode.ID, address, err)
+	}
+	return nil
+}
+
+// SendInviteCode emails an existing invite code, e.g. to resend it or to send a code
+// created without an address
+func (h *AdminInviteCodeHandler) SendInviteCode(w http.ResponseWriter, r *http.Request) {
+	codeIDStr := chi.URLParam(r, "id")
+	codeID, err := strconv.ParseUint(codeIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid invite code ID format", http.StatusBadRequest)
+		return
+	}
+
+	var payload InviteCodeSendPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentUser, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok || currentUser == nil {
+		http.Error(w, "User not found in context (authentication error)", http.StatusInternalServerError)
+		return
+	}
+
+	inviteCode, err := h.InviteCodeRepo.GetByID(uint(codeID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Invite code not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve invite code: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !inviteCode.IsValid() {
+		http.Error(w, "Invite code is not valid (expired, inactive, or max uses reached)", http.StatusConflict)
+		return
+	}
+
+	rawAddress := payload.Email
+	if rawAddress == "" && inviteCode.Email != nil {
+		rawAddress = *inviteCode.Email
+	}
+	address, status, err := h.checkRecipient(rawAddress)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	bindEmail := inviteCode.BindEmail
+	if payload.BindEmail != nil {
+		bindEmail = *payload.BindEmail
+	}
+
+	if err := h.sendInvite(inviteCode, currentUser, *address, bindEmail); err != nil {
+		log.Printf("Failed to email invite code %d to %s: %v", inviteCode.ID, *address, err)
+		http.Error(w, "Failed to send invite email: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(toInviteCodeResponseDTO(inviteCode)); err != nil {
+		// fmt.Printf("Error encoding JSON response for SendInviteCode: %v\n", err)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminJobHandler struct {
+	ImgProc *workers.ImageProcessor
+}
+
+func NewAdminJobHandler(imgProc *workers.ImageProcessor) *AdminJobHandler {
+	return &AdminJobHandler{ImgProc: imgProc}
+}
+
+// writeJobError maps job tracker errors onto HTTP status codes
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, workers.ErrJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case errors.Is(err, workers.ErrJobNotCancellable), errors.Is(err, workers.ErrJobNotRetryable), errors.Is(err, workers.ErrJobAlreadyPending), errors.Is(err, workers.ErrAlbumArchived):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, workers.ErrJobQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "Job operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListJobs lists tracked worker jobs, optionally filtered with ?state=queued|processing|completed|failed|cancelled
+func (h *AdminJobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	state := workers.JobState(r.URL.Query().Get("state"))
+	switch state {
+	case "", workers.JobStateQueued, workers.JobStateProcessing, workers.JobStateCompleted, workers.JobStateFailed, workers.JobStateCancelled:
+	default:
+		http.Error(w, "Invalid job state filter", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.ImgProc.ListJobs(state))
+}
+
+func (h *AdminJobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.ImgProc.GetJob(chi.URLParam(r, "jobID"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelJob cancels a job that is still waiting in the queue
+func (h *AdminJobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.ImgProc.CancelJob(chi.URLParam(r, "jobID"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// RetryJob queues a failed or cancelled job again, responding with the new job
+func (h *AdminJobHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.ImgProc.RetryJob(chi.URLParam(r, "jobID"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// RetryErroredImages re-queues every errored image task with a fresh set of attempts
+func (h *AdminJobHandler) RetryErroredImages(w http.ResponseWriter, r *http.Request) {
+	queued, err := h.ImgProc.RetryErroredImages()
+	if err != nil {
+		http.Error(w, "Failed to retry errored images: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"queued": queued})
+}
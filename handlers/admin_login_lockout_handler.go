@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type AdminLoginLockoutHandler struct {
+	Guard *LoginGuard
+}
+
+func NewAdminLoginLockoutHandler(guard *LoginGuard) *AdminLoginLockoutHandler {
+	return &AdminLoginLockoutHandler{Guard: guard}
+}
+
+// LoginLockoutResponse is a failed login counter as shown to admins
+type LoginLockoutResponse struct {
+	models.LoginFailure
+	Locked bool `json:"locked"`
+}
+
+// ListLockouts handles GET /api/admin/login-lockouts, listing usernames and IPs with recent
+// failed logins or a running lockout
+func (h *AdminLoginLockoutHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	if h.Guard == nil {
+		writeJSON(w, http.StatusOK, []LoginLockoutResponse{})
+		return
+	}
+	failures, err := h.Guard.Active()
+	if err != nil {
+		log.Printf("Error listing login lockouts: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list login lockouts"})
+		return
+	}
+	now := time.Now().Unix()
+	response := make([]LoginLockoutResponse, len(failures))
+	for i, failure := range failures {
+		response[i] = LoginLockoutResponse{LoginFailure: failure, Locked: failure.IsLocked(now)}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Unlock handles DELETE /api/admin/login-lockouts/{kind}/{subject}, lifting the lockout and
+// clearing the failed logins of a username or IP, or the wrong passcodes of a share link
+func (h *AdminLoginLockoutHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if kind != models.LoginSubjectUsername && kind != models.LoginSubjectIP && kind != models.LoginSubjectShareLink {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "kind must be 'username', 'ip' or 'share_link'"})
+		return
+	}
+	if h.Guard == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Login lockouts are disabled"})
+		return
+	}
+	if err := h.Guard.Unlock(kind, chi.URLParam(r, "subject")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "No failed logins recorded for this " + kind})
+			return
+		}
+		log.Printf("Error unlocking login lockout: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to unlock"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+type AdminNSFWHandler struct {
+	ImageRepo repository.ImageRepositoryInterface
+	Cfg       config.Config
+}
+
+func NewAdminNSFWHandler(imageRepo repository.ImageRepositoryInterface, cfg config.Config) *AdminNSFWHandler {
+	return &AdminNSFWHandler{ImageRepo: imageRepo, Cfg: cfg}
+}
+
+// NSFWImage is an image in the NSFW review queue
+type NSFWImage struct {
+	FileInfo
+	NSFWScore      *float32 `json:"nsfw_score,omitempty"`
+	NSFWStatus     string   `json:"nsfw_status"`
+	NSFWReviewedBy *uint    `json:"nsfw_reviewed_by,omitempty"`
+	NSFWReviewedAt *int64   `json:"nsfw_reviewed_at,omitempty"`
+}
+
+// NSFWImagesResponse is a page of the images with an NSFW status
+type NSFWImagesResponse struct {
+	Images     []NSFWImage `json:"images"`
+	Total      int         `json:"total"`
+	Offset     int         `json:"offset"`
+	Limit      int         `json:"limit"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// ListNSFWImages returns a page of the images flagged as NSFW, or of those a reviewer
+// confirmed or cleared, highest score first. status defaults to flagged, the images waiting
+// for review.
+// Route: GET /api/admin/nsfw?status=flagged|confirmed|cleared&offset=...&limit=...
+func (h *AdminNSFWHandler) ListNSFWImages(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.NSFWFlagged
+	case models.NSFWFlagged, models.NSFWConfirmed, models.NSFWCleared:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid status, must be flagged, confirmed or cleared"})
+		return
+	}
+	offset, limit, err := parsePageParams(r, 50)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	images, total, err := h.ImageRepo.ListByNSFWStatus(status, offset, limit)
+	if err != nil {
+		log.Printf("Error listing %s NSFW images: %v", status, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list NSFW images"})
+		return
+	}
+
+	response := NSFWImagesResponse{
+		Images: make([]NSFWImage, 0, len(images)),
+		Total:  int(total),
+		Offset: offset,
+		Limit:  limit,
+	}
+	for i := range images {
+		img := &images[i]
+		response.Images = append(response.Images, NSFWImage{
+			FileInfo:       fileInfoFromImage(img, h.Cfg),
+			NSFWScore:      img.NSFWScore,
+			NSFWStatus:     img.NSFWStatus,
+			NSFWReviewedBy: img.NSFWReviewedBy,
+			NSFWReviewedAt: img.NSFWReviewedAt,
+		})
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// ConfirmNSFW agrees with the NSFW flag of an image, keeping it hidden from public and share
+// views even if it is scored again
+// Route: POST /api/admin/nsfw/confirm?path=...
+func (h *AdminNSFWHandler) ConfirmNSFW(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, models.NSFWConfirmed)
+}
+
+// ClearNSFW overrules the NSFW flag of an image, showing it in public and share views again
+// and keeping it from being flagged when it is scored again
+// Route: POST /api/admin/nsfw/clear?path=...
+func (h *AdminNSFWHandler) ClearNSFW(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, models.NSFWCleared)
+}
+
+func (h *AdminNSFWHandler) review(w http.ResponseWriter, r *http.Request, status string) {
+	raw := r.URL.Query().Get("path")
+	if raw == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return
+	}
+	imagePath := strings.TrimPrefix(path.Clean("/"+raw), "/")
+
+	user := currentUser(r)
+	if err := h.ImageRepo.ReviewNSFW(imagePath, status, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Image not found or not flagged as NSFW"})
+		} else {
+			log.Printf("Error reviewing NSFW flag of %s: %v", imagePath, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to review NSFW flag"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "NSFW flag " + status, "path": "/" + imagePath, "nsfw_status": status})
+}
@@ -213,45 +213,40 @@ func (h *AdminRoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	for _, apPayload := range payload.AlbumPermissions {
+		if err := validateRoleAlbumPermissions(apPayload.AlbumID, apPayload.Permissions); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	role := &models.Role{
 		Name:                   payload.Name,
 		GlobalPermissions:      payload.GlobalPermissions,
 		GlobalAlbumPermissions: payload.GlobalAlbumPermissions,
 	}
 
-	if err := h.RoleRepo.Create(role); err != nil {
-		http.Error(w, "Failed to create role: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var createdAlbumPermissions []models.RoleAlbumPermission
-	for _, apPayload := range payload.AlbumPermissions {
-		for _, pKey := range apPayload.Permissions {
-			permDef, ok := permissions.GetPermissionDefinition(pKey)
-			if !ok {
-				http.Error(w, fmt.Sprintf("Invalid album permission key: %s for album %d", pKey, apPayload.AlbumID), http.StatusBadRequest)
-				return
+	// the role is only created along with all of its album permissions
+	err := h.RoleRepo.WithTx(func(roleRepo repository.RoleRepository) error {
+		if err := roleRepo.Create(role); err != nil {
+			return fmt.Errorf("Failed to create role: %w", err)
+		}
+		for _, apPayload := range payload.AlbumPermissions {
+			rap := &models.RoleAlbumPermission{
+				RoleID:      role.ID,
+				AlbumID:     apPayload.AlbumID,
+				Permissions: apPayload.Permissions,
 			}
-			if permDef.Scope != permissions.ScopeAlbum {
-				http.Error(w, fmt.Sprintf("Permission %s is not an album-specific permission for album %d", pKey, apPayload.AlbumID), http.StatusBadRequest)
-				return
+			if err := roleRepo.CreateRoleAlbumPermission(rap); err != nil {
+				return fmt.Errorf("Failed to create album permission for album %d: %w", apPayload.AlbumID, err)
 			}
 		}
-
-		rap := &models.RoleAlbumPermission{
-			RoleID:      role.ID,
-			AlbumID:     apPayload.AlbumID,
-			Permissions: apPayload.Permissions,
-		}
-		if err := h.RoleRepo.CreateRoleAlbumPermission(rap); err != nil {
-			// attempt to clean up the created role if subsequent album perm creation fails
-			_ = h.RoleRepo.Delete(role.ID)
-			http.Error(w, fmt.Sprintf("Failed to create album permission for album %d: %s", apPayload.AlbumID, err.Error()), http.StatusInternalServerError)
-			return
-		}
-		createdAlbumPermissions = append(createdAlbumPermissions, *rap)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	role.AlbumPermissions = createdAlbumPermissions
 
 	reloadedRole, err := h.RoleRepo.GetByID(role.ID)
 	if err != nil {
@@ -266,6 +261,21 @@ func (h *AdminRoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validateRoleAlbumPermissions checks that the permissions granted to a role on an album
+// are all album-scoped permission keys
+func validateRoleAlbumPermissions(albumID uint, keys []string) error {
+	for _, pKey := range keys {
+		permDef, ok := permissions.GetPermissionDefinition(pKey)
+		if !ok {
+			return fmt.Errorf("Invalid album permission key: %s for album %d", pKey, albumID)
+		}
+		if permDef.Scope != permissions.ScopeAlbum {
+			return fmt.Errorf("Permission %s is not an album-specific permission for album %d", pKey, albumID)
+		}
+	}
+	return nil
+}
+
 // UpdateRole godoc
 // @Summary Update an existing role
 // @Description Update details of an existing role, including its global and album-specific permissions.
@@ -350,51 +360,53 @@ func (h *AdminRoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if payload.AlbumPermissions != nil {
-		existingRaps, err := h.RoleRepo.GetRoleAlbumPermissions(role.ID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve existing album permissions for update: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		for _, existingRap := range existingRaps {
-			if err := h.RoleRepo.DeleteRoleAlbumPermission(role.ID, existingRap.AlbumID); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to delete existing album permission for album %d: %s", existingRap.AlbumID, err.Error()), http.StatusInternalServerError)
+		for _, apInput := range *payload.AlbumPermissions {
+			if err := validateRoleAlbumPermissions(apInput.AlbumID, apInput.Permissions); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 		}
+	}
 
-		var newAlbumPermissions []models.RoleAlbumPermission
-		for _, apInput := range *payload.AlbumPermissions {
-			for _, pKey := range apInput.Permissions {
-				permDef, ok := permissions.GetPermissionDefinition(pKey)
-				if !ok {
-					http.Error(w, fmt.Sprintf("Invalid album permission key: %s for album %d", pKey, apInput.AlbumID), http.StatusBadRequest)
-					return
-				}
-				if permDef.Scope != permissions.ScopeAlbum {
-					http.Error(w, fmt.Sprintf("Permission %s is not an album-specific permission for album %d", pKey, apInput.AlbumID), http.StatusBadRequest)
-					return
-				}
+	// the album permissions are replaced and the role saved together, or not at all
+	err = h.RoleRepo.WithTx(func(roleRepo repository.RoleRepository) error {
+		if payload.AlbumPermissions != nil {
+			existingRaps, err := roleRepo.GetRoleAlbumPermissions(role.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to retrieve existing album permissions for update: %w", err)
 			}
-			rap := &models.RoleAlbumPermission{
-				RoleID:      role.ID,
-				AlbumID:     apInput.AlbumID,
-				Permissions: apInput.Permissions,
+			for _, existingRap := range existingRaps {
+				if err := roleRepo.DeleteRoleAlbumPermission(role.ID, existingRap.AlbumID); err != nil {
+					return fmt.Errorf("Failed to delete existing album permission for album %d: %w", existingRap.AlbumID, err)
+				}
 			}
 
-			if err := h.RoleRepo.CreateRoleAlbumPermission(rap); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to create/update album permission for album %d: %s", apInput.AlbumID, err.Error()), http.StatusInternalServerError)
-				return
-			}
-			createdRap, _ := h.RoleRepo.GetRoleAlbumPermission(role.ID, apInput.AlbumID)
-			if createdRap != nil {
+			var newAlbumPermissions []models.RoleAlbumPermission
+			for _, apInput := range *payload.AlbumPermissions {
+				rap := &models.RoleAlbumPermission{
+					RoleID:      role.ID,
+					AlbumID:     apInput.AlbumID,
+					Permissions: apInput.Permissions,
+				}
+				if err := roleRepo.CreateRoleAlbumPermission(rap); err != nil {
+					return fmt.Errorf("Failed to create/update album permission for album %d: %w", apInput.AlbumID, err)
+				}
+				createdRap, err := roleRepo.GetRoleAlbumPermission(role.ID, apInput.AlbumID)
+				if err != nil {
+					return fmt.Errorf("Failed to retrieve album permission for album %d: %w", apInput.AlbumID, err)
+				}
 				newAlbumPermissions = append(newAlbumPermissions, *createdRap)
 			}
+			role.AlbumPermissions = newAlbumPermissions
 		}
-		role.AlbumPermissions = newAlbumPermissions
-	}
 
-	if err := h.RoleRepo.Update(role); err != nil {
-		http.Error(w, "Failed to update role: "+err.Error(), http.StatusInternalServerError)
+		if err := roleRepo.Update(role); err != nil {
+			return fmt.Errorf("Failed to update role: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
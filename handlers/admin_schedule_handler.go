@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminScheduleHandler struct {
+	Scheduler *workers.Scheduler
+	Settings  *services.SettingsService
+}
+
+func NewAdminScheduleHandler(scheduler *workers.Scheduler, settings *services.SettingsService) *AdminScheduleHandler {
+	return &AdminScheduleHandler{Scheduler: scheduler, Settings: settings}
+}
+
+// ScheduleResponse is a maintenance task's status together with the runtime setting that
+// holds its interval
+type ScheduleResponse struct {
+	workers.ScheduledTaskStatus
+	SettingKey string `json:"setting_key"`
+}
+
+type ScheduleUpdatePayload struct {
+	IntervalMinutes *int `json:"interval_minutes"` // 0 disables the task
+}
+
+// writeScheduleError maps scheduler and settings errors onto HTTP status codes
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, workers.ErrScheduledTaskNotFound):
+		http.Error(w, "Scheduled task not found", http.StatusNotFound)
+	case errors.Is(err, workers.ErrScheduledTaskRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, workers.ErrSchedulerStopped):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, services.ErrInvalidSettingValue):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update schedule: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func scheduleResponse(status workers.ScheduledTaskStatus) ScheduleResponse {
+	return ScheduleResponse{ScheduledTaskStatus: status, SettingKey: services.ScheduleSettingKeys[status.Name]}
+}
+
+// ListSchedules lists the maintenance tasks with their interval and last run
+func (h *AdminScheduleHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	statuses := h.Scheduler.List()
+	response := make([]ScheduleResponse, len(statuses))
+	for i, status := range statuses {
+		response[i] = scheduleResponse(status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AdminScheduleHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Scheduler.Get(chi.URLParam(r, "name"))
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(scheduleResponse(status))
+}
+
+// UpdateSchedule changes the interval of a task. it is stored as a runtime setting, so it
+// survives restarts and can be reset through the settings API.
+func (h *AdminScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok || currentUser == nil {
+		http.Error(w, "User not found in context (authentication error)", http.StatusInternalServerError)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	settingKey, ok := services.ScheduleSettingKeys[name]
+	if !ok {
+		writeScheduleError(w, workers.ErrScheduledTaskNotFound)
+		return
+	}
+
+	var payload ScheduleUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.IntervalMinutes == nil {
+		http.Error(w, "interval_minutes is required", http.StatusBadRequest)
+		return
+	}
+
+	raw, _ := json.Marshal(*payload.IntervalMinutes)
+	if _, err := h.Settings.Set(settingKey, raw, currentUser.ID); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	status, err := h.Scheduler.Get(name)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(scheduleResponse(status))
+}
+
+// RunSchedule starts a task right away. it runs in the background; poll GetSchedule for the outcome.
+func (h *AdminScheduleHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Scheduler.RunNow(chi.URLParam(r, "name"))
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(scheduleResponse(status))
+}
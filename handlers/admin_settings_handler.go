@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminSettingsHandler struct {
+	Settings *services.SettingsService
+}
+
+func NewAdminSettingsHandler(settings *services.SettingsService) *AdminSettingsHandler {
+	return &AdminSettingsHandler{Settings: settings}
+}
+
+type SettingUpdatePayload struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// writeSettingError maps settings service errors onto HTTP status codes
+func writeSettingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownSetting):
+		http.Error(w, "Setting not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidSettingValue):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update setting: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListSettings lists every runtime setting with its effective and default value
+func (h *AdminSettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.Settings.List())
+}
+
+func (h *AdminSettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request) {
+	setting, err := h.Settings.Get(chi.URLParam(r, "key"))
+	if err != nil {
+		writeSettingError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(setting)
+}
+
+// UpdateSetting overrides a setting. the change is applied immediately, without a restart.
+func (h *AdminSettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok || currentUser == nil {
+		http.Error(w, "User not found in context (authentication error)", http.StatusInternalServerError)
+		return
+	}
+
+	var payload SettingUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(payload.Value) == 0 {
+		http.Error(w, "value is required", http.StatusBadRequest)
+		return
+	}
+
+	setting, err := h.Settings.Set(chi.URLParam(r, "key"), payload.Value, currentUser.ID)
+	if err != nil {
+		writeSettingError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(setting)
+}
+
+// ResetSetting removes the override of a setting, restoring the value from the config
+func (h *AdminSettingsHandler) ResetSetting(w http.ResponseWriter, r *http.Request) {
+	setting, err := h.Settings.Reset(chi.URLParam(r, "key"))
+	if err != nil {
+		writeSettingError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(setting)
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type AdminShareLinkHandler struct {
+	ShareLinkRepo repository.ShareLinkRepository
+	AlbumRepo     repository.AlbumRepositoryInterface
+}
+
+func NewAdminShareLinkHandler(shareLinkRepo repository.ShareLinkRepository, albumRepo repository.AlbumRepositoryInterface) *AdminShareLinkHandler {
+	return &AdminShareLinkHandler{ShareLinkRepo: shareLinkRepo, AlbumRepo: albumRepo}
+}
+
+type ShareLinkCreatePayload struct {
+	ExpiresAt *string `json:"expires_at,omitempty"` // ISO 8601 format e.g., "2023-12-31T23:59:59Z" or null
+	MaxViews  *int    `json:"max_views,omitempty"`  // Nullable for unlimited
+	Passcode  *string `json:"passcode,omitempty"`   // plain text, only the bcrypt hash is stored
+}
+
+type ShareLinkUpdatePayload struct {
+	ExpiresAt *string `json:"expires_at,omitempty"`
+	MaxViews  *int    `json:"max_views,omitempty"`
+	Passcode  *string `json:"passcode,omitempty"` // empty string removes the passcode
+	IsActive  *bool   `json:"is_active,omitempty"`
+}
+
+// ShareLinkResponseDTO for API responses
+type ShareLinkResponseDTO struct {
+	ID              uint    `json:"id"`
+	Token           string  `json:"token"`
+	AlbumID         uint    `json:"album_id"`
+	ExpiresAt       *string `json:"expires_at,omitempty"`
+	MaxViews        *int    `json:"max_views,omitempty"`
+	Views           int     `json:"views"`
+	HasPasscode     bool    `json:"has_passcode"`
+	IsActive        bool    `json:"is_active"`
+	CreatedByUserID uint    `json:"created_by_user_id"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+func toShareLinkResponseDTO(sl *models.ShareLink) ShareLinkResponseDTO {
+	var expiresAtStr *string
+	if sl.ExpiresAt != nil {
+		s := sl.ExpiresAt.Format(time.RFC3339)
+		expiresAtStr = &s
+	}
+	return ShareLinkResponseDTO{
+		ID:              sl.ID,
+		Token:           sl.Token,
+		AlbumID:         sl.AlbumID,
+		ExpiresAt:       expiresAtStr,
+		MaxViews:        sl.MaxViews,
+		Views:           sl.Views,
+		HasPasscode:     sl.HasPasscode(),
+		IsActive:        sl.IsActive,
+		CreatedByUserID: sl.CreatedByUserID,
+		CreatedAt:       sl.CreatedAt.Format(http.TimeFormat),
+		UpdatedAt:       sl.UpdatedAt.Format(http.TimeFormat),
+	}
+}
+
+func toShareLinkListResponseDTO(sls []models.ShareLink) []ShareLinkResponseDTO {
+	dtos := make([]ShareLinkResponseDTO, len(sls))
+	for i, sl := range sls {
+		dtos[i] = toShareLinkResponseDTO(&sl)
+	}
+	return dtos
+}
+
+func (h *AdminShareLinkHandler) ListAlbumShareLinks(w http.ResponseWriter, r *http.Request) {
+	albumIDStr := chi.URLParam(r, "id")
+	albumID, err := strconv.ParseUint(albumIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid album ID format", http.StatusBadRequest)
+		return
+	}
+
+	links, err := h.ShareLinkRepo.ListByAlbumID(uint(albumID))
+	if err != nil {
+		http.Error(w, "Failed to retrieve share links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(toShareLinkListResponseDTO(links)); err != nil {
+		// fmt.Printf("Error encoding JSON response for ListAlbumShareLinks: %v\n", err)
+	}
+}
+
+func (h *AdminShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	albumIDStr := chi.URLParam(r, "id")
+	albumID, err := strconv.ParseUint(albumIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid album ID format", http.StatusBadRequest)
+		return
+	}
+
+	var payload ShareLinkCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentUser, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok || currentUser == nil {
+		http.Error(w, "User not found in context (authentication error)", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.AlbumRepo.GetByID(uint(albumID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Album not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve album: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if payload.MaxViews != nil && *payload.MaxViews <= 0 {
+		http.Error(w, "max_views must be greater than zero", http.StatusBadRequest)
+		return
+	}
+
+	shareLink := &models.ShareLink{
+		AlbumID:         uint(albumID),
+		CreatedByUserID: currentUser.ID,
+		MaxViews:        payload.MaxViews,
+	}
+
+	if payload.ExpiresAt != nil && *payload.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
+		if err != nil {
+			http.Error(w, "Invalid expires_at format (must be RFC3339): "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		shareLink.ExpiresAt = &t
+	}
+
+	if payload.Passcode != nil {
+		if err := shareLink.SetPasscode(*payload.Passcode); err != nil {
+			http.Error(w, "Failed to hash passcode: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.ShareLinkRepo.Create(shareLink); err != nil {
+		http.Error(w, "Failed to create share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reloadedLink, err := h.ShareLinkRepo.GetByID(shareLink.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve newly created share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(toShareLinkResponseDTO(reloadedLink)); err != nil {
+		// fmt.Printf("Error encoding JSON response for CreateShareLink: %v\n", err)
+	}
+}
+
+func (h *AdminShareLinkHandler) GetShareLink(w http.ResponseWriter, r *http.Request) {
+	linkIDStr := chi.URLParam(r, "id")
+	linkID, err := strconv.ParseUint(linkIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid share link ID format", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.ShareLinkRepo.GetByID(uint(linkID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve share link: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(toShareLinkResponseDTO(link)); err != nil {
+		// fmt.Printf("Error encoding JSON response for GetShareLink: %v\n", err)
+	}
+}
+
+func (h *AdminShareLinkHandler) UpdateShareLink(w http.ResponseWriter, r *http.Request) {
+	linkIDStr := chi.URLParam(r, "id")
+	linkID, err := strconv.ParseUint(linkIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid share link ID format", http.StatusBadRequest)
+		return
+	}
+
+	var payload ShareLinkUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.ShareLinkRepo.GetByID(uint(linkID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve share link for update: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if payload.ExpiresAt != nil {
+		if *payload.ExpiresAt == "" {
+			link.ExpiresAt = nil
+		} else {
+			t, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
+			if err != nil {
+				http.Error(w, "Invalid expires_at format (must be RFC3339): "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			link.ExpiresAt = &t
+		}
+	}
+	if payload.MaxViews != nil {
+		if *payload.MaxViews <= 0 {
+			link.MaxViews = nil // zero or negative clears the limit
+		} else {
+			link.MaxViews = payload.MaxViews
+		}
+	}
+	if payload.Passcode != nil {
+		if err := link.SetPasscode(*payload.Passcode); err != nil {
+			http.Error(w, "Failed to hash passcode: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if payload.IsActive != nil {
+		link.IsActive = *payload.IsActive
+	}
+
+	if err := h.ShareLinkRepo.Update(link); err != nil {
+		http.Error(w, "Failed to update share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(toShareLinkResponseDTO(link)); err != nil {
+		// fmt.Printf("Error encoding JSON response for UpdateShareLink: %v\n", err)
+	}
+}
+
+func (h *AdminShareLinkHandler) DeleteShareLink(w http.ResponseWriter, r *http.Request) {
+	linkIDStr := chi.URLParam(r, "id")
+	linkID, err := strconv.ParseUint(linkIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid share link ID format", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.ShareLinkRepo.GetByID(uint(linkID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to check share link before delete: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.ShareLinkRepo.Delete(uint(linkID)); err != nil {
+		http.Error(w, "Failed to delete share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type AdminSmartAlbumHandler struct {
+	SmartAlbumRepo repository.SmartAlbumRepositoryInterface
+	AlbumRepo      repository.AlbumRepositoryInterface
+	Cfg            config.Config
+}
+
+func NewAdminSmartAlbumHandler(smartAlbumRepo repository.SmartAlbumRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, cfg config.Config) *AdminSmartAlbumHandler {
+	return &AdminSmartAlbumHandler{SmartAlbumRepo: smartAlbumRepo, AlbumRepo: albumRepo, Cfg: cfg}
+}
+
+type SmartAlbumCreatePayload struct {
+	Name        string                  `json:"name"`
+	Slug        string                  `json:"slug"`
+	Description *string                 `json:"description"`
+	Rules       *models.SmartAlbumRules `json:"rules"`
+	SortOrder   *string                 `json:"sort_order"`
+	IsHidden    *bool                   `json:"is_hidden"`
+}
+
+type SmartAlbumUpdatePayload struct {
+	Name        *string                 `json:"name"`
+	Slug        *string                 `json:"slug"`
+	Description *string                 `json:"description"`
+	Rules       *models.SmartAlbumRules `json:"rules"`
+	SortOrder   *string                 `json:"sort_order"`
+	IsHidden    *bool                   `json:"is_hidden"`
+}
+
+// AdminSmartAlbumResponse is a smart album for the admin view, which shows the hidden flag
+type AdminSmartAlbumResponse struct {
+	SmartAlbumResponse
+	IsHidden bool `json:"is_hidden"`
+}
+
+func adminSmartAlbumResponse(album *models.SmartAlbum) AdminSmartAlbumResponse {
+	return AdminSmartAlbumResponse{SmartAlbumResponse: smartAlbumResponse(album), IsHidden: album.IsHidden}
+}
+
+func (h *AdminSmartAlbumHandler) getSmartAlbum(w http.ResponseWriter, r *http.Request) *models.SmartAlbum {
+	albumID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid smart album ID"})
+		return nil
+	}
+	album, err := h.SmartAlbumRepo.GetByID(uint(albumID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Smart album not found"})
+		} else {
+			log.Printf("Error getting smart album %d: %v", albumID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve smart album"})
+		}
+		return nil
+	}
+	return album
+}
+
+// checkSlug validates a slug and makes sure no regular album uses it, since both kinds of
+// album are served under /api/albums/{slug}
+func (h *AdminSmartAlbumHandler) checkSlug(w http.ResponseWriter, slug string) bool {
+	if strings.ContainsAny(slug, " /\\?%*:|\"<>") || strings.TrimSpace(slug) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid slug format. Use URL-safe characters without spaces."})
+		return false
+	}
+	if _, err := strconv.ParseUint(slug, 10, 64); err == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "A smart album slug cannot be a number"})
+		return false
+	}
+	if _, err := h.AlbumRepo.GetBySlug(slug); err == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "An album already uses this slug"})
+		return false
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error checking album slug '%s': %v", slug, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to verify slug"})
+		return false
+	}
+	return true
+}
+
+// setSmartAlbumRules validates and stores the rules of a smart album
+func setSmartAlbumRules(w http.ResponseWriter, album *models.SmartAlbum, rules models.SmartAlbumRules) bool {
+	if err := validateSmartAlbumRules(rules); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid rules: " + err.Error()})
+		return false
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid rules: " + err.Error()})
+		return false
+	}
+	album.Rules = string(encoded)
+	return true
+}
+
+func (h *AdminSmartAlbumHandler) ListSmartAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, err := h.SmartAlbumRepo.ListAllAdmin()
+	if err != nil {
+		log.Printf("Error listing smart albums for admin: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve smart albums"})
+		return
+	}
+	response := make([]AdminSmartAlbumResponse, len(albums))
+	for i := range albums {
+		response[i] = adminSmartAlbumResponse(&albums[i])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *AdminSmartAlbumHandler) GetSmartAlbum(w http.ResponseWriter, r *http.Request) {
+	album := h.getSmartAlbum(w, r)
+	if album == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, adminSmartAlbumResponse(album))
+}
+
+func (h *AdminSmartAlbumHandler) CreateSmartAlbum(w http.ResponseWriter, r *http.Request) {
+	var payload SmartAlbumCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if payload.Name == "" || payload.Slug == "" || payload.Rules == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required fields: name, slug, and rules"})
+		return
+	}
+	if !h.checkSlug(w, payload.Slug) {
+		return
+	}
+
+	album := models.SmartAlbum{
+		Name:        payload.Name,
+		Slug:        payload.Slug,
+		Description: payload.Description,
+	}
+	if !setSmartAlbumRules(w, &album, *payload.Rules) {
+		return
+	}
+	if payload.SortOrder != nil {
+		if !database.IsValidSortOrder(*payload.SortOrder) || *payload.SortOrder == database.SortCustom {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sort_order value"})
+			return
+		}
+		album.SortOrder = *payload.SortOrder
+	}
+	if payload.IsHidden != nil {
+		album.IsHidden = *payload.IsHidden
+	}
+
+	if err := h.SmartAlbumRepo.Create(&album); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Smart album name or slug already exists"})
+		} else {
+			log.Printf("Error creating smart album '%s': %v", payload.Name, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create smart album"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, adminSmartAlbumResponse(&album))
+}
+
+func (h *AdminSmartAlbumHandler) UpdateSmartAlbum(w http.ResponseWriter, r *http.Request) {
+	album := h.getSmartAlbum(w, r)
+	if album == nil {
+		return
+	}
+
+	var payload SmartAlbumUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if payload.Name != nil {
+		if *payload.Name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name cannot be empty"})
+			return
+		}
+		album.Name = *payload.Name
+	}
+	if payload.Slug != nil && *payload.Slug != album.Slug {
+		if !h.checkSlug(w, *payload.Slug) {
+			return
+		}
+		album.Slug = *payload.Slug
+	}
+	if payload.Description != nil {
+		album.Description = payload.Description
+	}
+	if payload.Rules != nil && !setSmartAlbumRules(w, album, *payload.Rules) {
+		return
+	}
+	if payload.SortOrder != nil {
+		if !database.IsValidSortOrder(*payload.SortOrder) || *payload.SortOrder == database.SortCustom {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sort_order value"})
+			return
+		}
+		album.SortOrder = *payload.SortOrder
+	}
+	if payload.IsHidden != nil {
+		album.IsHidden = *payload.IsHidden
+	}
+
+	if err := h.SmartAlbumRepo.Update(album); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Smart album not found"})
+		} else if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Smart album name or slug already exists"})
+		} else {
+			log.Printf("Error updating smart album %d: %v", album.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update smart album"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, adminSmartAlbumResponse(album))
+}
+
+func (h *AdminSmartAlbumHandler) DeleteSmartAlbum(w http.ResponseWriter, r *http.Request) {
+	album := h.getSmartAlbum(w, r)
+	if album == nil {
+		return
+	}
+	if err := h.SmartAlbumRepo.Delete(album.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Smart album not found"})
+		} else {
+			log.Printf("Error deleting smart album %d: %v", album.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete smart album"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSmartAlbumContents previews the images matching a smart album's rules, hidden or not
+func (h *AdminSmartAlbumHandler) GetSmartAlbumContents(w http.ResponseWriter, r *http.Request) {
+	album := h.getSmartAlbum(w, r)
+	if album == nil {
+		return
+	}
+	writeSmartAlbumContents(w, r, h.Cfg, h.SmartAlbumRepo, album)
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/services"
+)
+
+type AdminStatsHandler struct {
+	StatsService *services.StatsService
+}
+
+func NewAdminStatsHandler(statsService *services.StatsService) *AdminStatsHandler {
+	return &AdminStatsHandler{StatsService: statsService}
+}
+
+// GetStats returns the library, storage, queue and user activity statistics of the admin
+// dashboard. the same snapshot is streamed as "stats" events to the websocket clients
+// subscribed to the stats topic.
+// Route: GET /api/admin/stats
+func (h *AdminStatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.StatsService.Collect()
+	if err != nil {
+		log.Printf("Error collecting dashboard stats: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to collect statistics"})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
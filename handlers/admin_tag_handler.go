@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type AdminTagHandler struct {
+	TagRepo repository.TagRepositoryInterface
+}
+
+func NewAdminTagHandler(tagRepo repository.TagRepositoryInterface) *AdminTagHandler {
+	return &AdminTagHandler{TagRepo: tagRepo}
+}
+
+type TagPayload struct {
+	Name string `json:"name"`
+}
+
+// BulkTagPayload adds and removes tags, by name, on a set of images. paths are relative to
+// the root directory, like the paths in album listings. tags that are added and do not exist
+// yet are created.
+type BulkTagPayload struct {
+	Paths  []string `json:"paths"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+type BulkTagResponse struct {
+	Added   int64 `json:"added"`
+	Removed int64 `json:"removed"`
+}
+
+// validateTagName checks a tag name and returns it normalized
+func validateTagName(name string) (string, error) {
+	name = models.NormalizeTagName(name)
+	if name == "" {
+		return "", errors.New("tag name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > repository.MaxTagNameLength {
+		return "", fmt.Errorf("tag name cannot be longer than %d characters", repository.MaxTagNameLength)
+	}
+	return name, nil
+}
+
+func (h *AdminTagHandler) tagID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	tagID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid tag ID"})
+		return 0, false
+	}
+	return uint(tagID), true
+}
+
+func (h *AdminTagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var payload TagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	name, err := validateTagName(payload.Name)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tag := models.Tag{Name: name}
+	if err := h.TagRepo.Create(&tag); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Tag already exists"})
+		} else {
+			log.Printf("Error creating tag '%s': %v", name, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create tag"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+func (h *AdminTagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	tagID, ok := h.tagID(w, r)
+	if !ok {
+		return
+	}
+	var payload TagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	name, err := validateTagName(payload.Name)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.TagRepo.Rename(tagID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Tag not found"})
+		case strings.Contains(strings.ToLower(err.Error()), "unique"):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Another tag already has this name"})
+		default:
+			log.Printf("Error renaming tag %d: %v", tagID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to rename tag"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from every image and deletes it
+func (h *AdminTagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tagID, ok := h.tagID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.TagRepo.Delete(tagID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Tag not found"})
+		} else {
+			log.Printf("Error deleting tag %d: %v", tagID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete tag"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BulkTagImages adds and removes tags on many images at once. paths without an image record
+// are skipped.
+func (h *AdminTagHandler) BulkTagImages(w http.ResponseWriter, r *http.Request) {
+	var payload BulkTagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if len(payload.Paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths must not be empty"})
+		return
+	}
+	if len(payload.Paths) > maxBatchImagePaths {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d paths can be tagged at once", maxBatchImagePaths)})
+		return
+	}
+	if len(payload.Add) == 0 && len(payload.Remove) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "add or remove must list at least one tag"})
+		return
+	}
+	for _, names := range [][]string{payload.Add, payload.Remove} {
+		for _, name := range names {
+			if _, err := validateTagName(name); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(payload.Paths))
+	for _, p := range payload.Paths {
+		if cleaned := strings.TrimPrefix(path.Clean("/"+p), "/"); cleaned != "" {
+			paths = append(paths, cleaned)
+		}
+	}
+
+	var response BulkTagResponse
+	if len(payload.Remove) > 0 {
+		tags, err := h.TagRepo.ListByNames(payload.Remove)
+		if err != nil {
+			log.Printf("Error looking up tags to remove: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update tags"})
+			return
+		}
+		removed, err := h.TagRepo.RemoveFromImages(tagIDs(tags), paths)
+		if err != nil {
+			log.Printf("Error removing tags from images: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update tags"})
+			return
+		}
+		response.Removed = removed
+	}
+	if len(payload.Add) > 0 {
+		tags, err := h.TagRepo.GetOrCreateByNames(payload.Add)
+		if err != nil {
+			log.Printf("Error creating tags to add: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update tags"})
+			return
+		}
+		added, err := h.TagRepo.AddToImages(tagIDs(tags), paths)
+		if err != nil {
+			log.Printf("Error adding tags to images: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update tags"})
+			return
+		}
+		response.Added = added
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func tagIDs(tags []models.Tag) []uint {
+	ids := make([]uint, len(tags))
+	for i, tag := range tags {
+		ids[i] = tag.ID
+	}
+	return ids
+}
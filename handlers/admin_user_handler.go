@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/permissions"
@@ -16,12 +19,13 @@ import (
 )
 
 type AdminUserHandler struct {
-	UserRepo repository.UserRepository
-	RoleRepo repository.RoleRepository
+	UserRepo   repository.UserRepository
+	RoleRepo   repository.RoleRepository
+	PersonRepo repository.PersonRepositoryInterface
 }
 
-func NewAdminUserHandler(userRepo repository.UserRepository, roleRepo repository.RoleRepository) *AdminUserHandler {
-	return &AdminUserHandler{UserRepo: userRepo, RoleRepo: roleRepo}
+func NewAdminUserHandler(userRepo repository.UserRepository, roleRepo repository.RoleRepository, personRepo repository.PersonRepositoryInterface) *AdminUserHandler {
+	return &AdminUserHandler{UserRepo: userRepo, RoleRepo: roleRepo, PersonRepo: personRepo}
 }
 
 type UserCreatePayload struct {
@@ -31,6 +35,8 @@ type UserCreatePayload struct {
 	GlobalPermissions []string `json:"global_permissions"`
 	FirstName         string   `json:"first_name"`
 	LastName          string   `json:"last_name"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"` // mark Email as confirmed instead of leaving it unverified
 }
 
 type UserUpdatePayload struct {
@@ -40,6 +46,10 @@ type UserUpdatePayload struct {
 	GlobalPermissions *[]string `json:"global_permissions,omitempty"`
 	FirstName         *string   `json:"first_name,omitempty"`
 	LastName          *string   `json:"last_name,omitempty"`
+	Email             *string   `json:"email,omitempty"` // an empty string removes the address
+	EmailVerified     *bool     `json:"email_verified,omitempty"`
+	UploadQuotaMB     *int      `json:"upload_quota_mb,omitempty"` // 0 is unlimited, negative restores the configured quota
+	PersonID          *uint     `json:"person_id,omitempty"`       // links the user to the person they are in photos; 0 unlinks
 }
 
 // UserResponseDTO is a simplified User model for API responses
@@ -48,6 +58,12 @@ type UserResponseDTO struct {
 	Username          string                       `json:"username"`
 	FirstName         string                       `json:"first_name"`
 	LastName          string                       `json:"last_name"`
+	Email             *string                      `json:"email,omitempty"`
+	EmailVerifiedAt   *string                      `json:"email_verified_at,omitempty"`
+	AvatarPath        *string                      `json:"avatar_path,omitempty"`
+	AvatarURLs        map[string]string            `json:"avatar_urls,omitempty"` // keyed by edge length in pixels
+	UploadQuotaMB     *int                         `json:"upload_quota_mb,omitempty"`
+	PersonID          *uint                        `json:"person_id,omitempty"`
 	Roles             []models.Role                `json:"roles"`
 	GlobalPermissions []string                     `json:"global_permissions"`
 	AlbumPermissions  []models.UserAlbumPermission `json:"album_permissions"`
@@ -71,6 +87,12 @@ func toUserResponseDTO(user *models.User, userAlbumPerms []models.UserAlbumPermi
 		Username:          user.Username,
 		FirstName:         user.FirstName,
 		LastName:          user.LastName,
+		Email:             user.Email,
+		EmailVerifiedAt:   formatOptionalTime(user.EmailVerifiedAt),
+		AvatarPath:        user.AvatarPath,
+		AvatarURLs:        avatarURLs(user.AvatarPath),
+		UploadQuotaMB:     user.UploadQuotaMB,
+		PersonID:          user.PersonID,
 		Roles:             roles,
 		GlobalPermissions: user.GlobalPermissions,
 		AlbumPermissions:  userAlbumPerms,
@@ -79,6 +101,36 @@ func toUserResponseDTO(user *models.User, userAlbumPerms []models.UserAlbumPermi
 	}
 }
 
+// normalizeEmail validates an email address and returns it in the lower case form users are
+// stored with. an empty address returns nil.
+func normalizeEmail(raw string) (*string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+	addr, err := mail.ParseAddress(trimmed)
+	if err != nil || addr.Address != trimmed {
+		return nil, fmt.Errorf("invalid email address: %s", trimmed)
+	}
+	normalized := strings.ToLower(addr.Address)
+	return &normalized, nil
+}
+
+// emailTaken reports whether another user than userID already uses an email address
+func emailTaken(userRepo repository.UserRepository, email *string, userID uint) (bool, error) {
+	if email == nil {
+		return false, nil
+	}
+	existing, err := userRepo.GetByEmail(*email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return existing.ID != userID, nil
+}
+
 func toUserListResponseDTO(users []models.User) []UserResponseDTO {
 	dtos := make([]UserResponseDTO, len(users))
 	for i, user := range users {
@@ -181,6 +233,19 @@ func (h *AdminUserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	emailAddress, err := normalizeEmail(payload.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if taken, err := emailTaken(h.UserRepo, emailAddress, 0); err != nil {
+		http.Error(w, "Failed to check email address: "+err.Error(), http.StatusInternalServerError)
+		return
+	} else if taken {
+		http.Error(w, "Email address is already used by another user", http.StatusConflict)
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 	if err != nil {
 		http.Error(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
@@ -193,6 +258,11 @@ func (h *AdminUserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		GlobalPermissions: payload.GlobalPermissions,
 		FirstName:         payload.FirstName,
 		LastName:          payload.LastName,
+		Email:             emailAddress,
+	}
+	if emailAddress != nil && payload.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
 	}
 
 	if len(payload.RoleIDs) > 0 {
@@ -310,6 +380,65 @@ func (h *AdminUserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if payload.LastName != nil {
 		user.LastName = *payload.LastName
 	}
+	if payload.Email != nil {
+		emailAddress, err := normalizeEmail(*payload.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if taken, err := emailTaken(h.UserRepo, emailAddress, user.ID); err != nil {
+			http.Error(w, "Failed to check email address: "+err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "Email address is already used by another user", http.StatusConflict)
+			return
+		}
+		if emailAddress == nil || user.Email == nil || *emailAddress != *user.Email {
+			user.EmailVerifiedAt = nil // a new address has to be confirmed again
+		}
+		user.Email = emailAddress
+	}
+	if payload.EmailVerified != nil && user.Email != nil {
+		if !*payload.EmailVerified {
+			user.EmailVerifiedAt = nil
+		} else if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	if payload.UploadQuotaMB != nil {
+		if *payload.UploadQuotaMB < 0 {
+			user.UploadQuotaMB = nil
+		} else {
+			user.UploadQuotaMB = payload.UploadQuotaMB
+		}
+	}
+
+	if payload.PersonID != nil {
+		if *payload.PersonID == 0 {
+			user.PersonID = nil
+		} else {
+			if _, err := h.PersonRepo.GetByID(*payload.PersonID); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					http.Error(w, fmt.Sprintf("Person with ID %d not found", *payload.PersonID), http.StatusBadRequest)
+				} else {
+					http.Error(w, "Failed to retrieve person: "+err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			linked, err := h.UserRepo.GetByPersonID(*payload.PersonID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "Failed to check person link: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if linked != nil && linked.ID != user.ID {
+				http.Error(w, "Person is already linked to another user", http.StatusConflict)
+				return
+			}
+			user.PersonID = payload.PersonID
+		}
+	}
 
 	if err := h.UserRepo.Update(user); err != nil {
 		http.Error(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
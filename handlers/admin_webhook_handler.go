@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/webhooks"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// defaultDeliveriesLimit is the number of deliveries in a log page when no limit is given
+const defaultDeliveriesLimit = 50
+
+type AdminWebhookHandler struct {
+	WebhookRepo repository.WebhookRepositoryInterface
+	Dispatcher  *webhooks.Dispatcher
+}
+
+func NewAdminWebhookHandler(webhookRepo repository.WebhookRepositoryInterface, dispatcher *webhooks.Dispatcher) *AdminWebhookHandler {
+	return &AdminWebhookHandler{WebhookRepo: webhookRepo, Dispatcher: dispatcher}
+}
+
+// WebhookCreatePayload registers a webhook. a signing secret is generated when none is given.
+type WebhookCreatePayload struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Secret   *string  `json:"secret,omitempty"`
+	IsActive *bool    `json:"is_active,omitempty"` // defaults to true
+}
+
+// WebhookUpdatePayload changes a webhook; omitted fields are left as they are.
+// rotate_secret replaces the signing secret with a generated one.
+type WebhookUpdatePayload struct {
+	URL          *string   `json:"url,omitempty"`
+	Events       *[]string `json:"events,omitempty"`
+	Secret       *string   `json:"secret,omitempty"`
+	RotateSecret bool      `json:"rotate_secret,omitempty"`
+	IsActive     *bool     `json:"is_active,omitempty"`
+}
+
+// WebhookResponse is a webhook as shown to admins. the secret is only included when it was
+// set or generated by the request.
+type WebhookResponse struct {
+	models.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDeliveriesResponse is a page of a webhook's delivery log, newest first
+type WebhookDeliveriesResponse struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+	Total      int                      `json:"total"`
+	Offset     int                      `json:"offset"`
+	Limit      int                      `json:"limit"`
+	HasMore    bool                     `json:"has_more"`
+	NextCursor string                   `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateWebhookEvents checks that events lists at least one known event
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("events must list at least one of %v", models.WebhookEvents)
+	}
+	for _, event := range events {
+		if !models.IsWebhookEvent(event) {
+			return fmt.Errorf("unknown event '%s', must be one of %v", event, models.WebhookEvents)
+		}
+	}
+	return nil
+}
+
+func (h *AdminWebhookHandler) webhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	webhookID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+	webhook, err := h.WebhookRepo.GetByID(uint(webhookID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+		} else {
+			log.Printf("Error getting webhook %d: %v", webhookID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve webhook"})
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+// ListWebhooks returns every registered webhook
+// Route: GET /api/admin/webhooks
+func (h *AdminWebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhookList, err := h.WebhookRepo.List()
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list webhooks"})
+		return
+	}
+	response := make([]WebhookResponse, 0, len(webhookList))
+	for _, webhook := range webhookList {
+		response = append(response, WebhookResponse{Webhook: webhook})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CreateWebhook registers a webhook and returns it with its signing secret
+// Route: POST /api/admin/webhooks
+func (h *AdminWebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload WebhookCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if err := validateWebhookURL(payload.URL); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookEvents(payload.Events); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	webhook := models.Webhook{URL: payload.URL, Events: payload.Events, IsActive: true}
+	if payload.IsActive != nil {
+		webhook.IsActive = *payload.IsActive
+	}
+	if payload.Secret != nil && *payload.Secret != "" {
+		webhook.Secret = *payload.Secret
+	} else {
+		secret, err := models.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create webhook"})
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	if err := h.WebhookRepo.Create(&webhook); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create webhook"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, WebhookResponse{Webhook: webhook, Secret: webhook.Secret})
+}
+
+// GetWebhook returns a single webhook
+// Route: GET /api/admin/webhooks/{id}
+func (h *AdminWebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, WebhookResponse{Webhook: *webhook})
+}
+
+// UpdateWebhook changes a webhook's URL, events, secret or active state
+// Route: PUT /api/admin/webhooks/{id}
+func (h *AdminWebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	var payload WebhookUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if payload.Secret != nil && payload.RotateSecret {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "secret and rotate_secret cannot be used together"})
+		return
+	}
+
+	if payload.URL != nil {
+		if err := validateWebhookURL(*payload.URL); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		if err := validateWebhookEvents(*payload.Events); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		webhook.Events = *payload.Events
+	}
+	if payload.IsActive != nil {
+		webhook.IsActive = *payload.IsActive
+	}
+
+	response := WebhookResponse{}
+	if payload.Secret != nil {
+		if *payload.Secret == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "secret cannot be empty"})
+			return
+		}
+		webhook.Secret = *payload.Secret
+		response.Secret = webhook.Secret
+	} else if payload.RotateSecret {
+		secret, err := models.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update webhook"})
+			return
+		}
+		webhook.Secret = secret
+		response.Secret = secret
+	}
+
+	if err := h.WebhookRepo.Update(webhook); err != nil {
+		log.Printf("Error updating webhook %d: %v", webhook.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update webhook"})
+		return
+	}
+	response.Webhook = *webhook
+	writeJSON(w, http.StatusOK, response)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+// Route: DELETE /api/admin/webhooks/{id}
+func (h *AdminWebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+		return
+	}
+	if err := h.WebhookRepo.Delete(uint(webhookID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+		} else {
+			log.Printf("Error deleting webhook %d: %v", webhookID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete webhook"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns a page of a webhook's delivery log, newest first
+// Route: GET /api/admin/webhooks/{id}/deliveries?offset=...&limit=...
+func (h *AdminWebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultDeliveriesLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	deliveries, total, err := h.WebhookRepo.ListDeliveries(webhook.ID, offset, limit)
+	if err != nil {
+		log.Printf("Error listing deliveries of webhook %d: %v", webhook.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list deliveries"})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	response := WebhookDeliveriesResponse{
+		Deliveries: deliveries,
+		Total:      int(total),
+		Offset:     offset,
+		Limit:      limit,
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// RedeliverDelivery sends the payload of a logged delivery again, as a new delivery
+// Route: POST /api/admin/webhooks/{id}/deliveries/{delivery_id}/redeliver
+func (h *AdminWebhookHandler) RedeliverDelivery(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseUint(chi.URLParam(r, "delivery_id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid delivery ID"})
+		return
+	}
+	original, err := h.WebhookRepo.GetDelivery(uint(deliveryID))
+	if err != nil || original.WebhookID != webhook.ID {
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Delivery not found"})
+		} else {
+			log.Printf("Error getting webhook delivery %d: %v", deliveryID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve delivery"})
+		}
+		return
+	}
+
+	delivery, err := h.Dispatcher.Redeliver(original)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrDispatcherStopped) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Server is shutting down"})
+		} else {
+			log.Printf("Error redelivering webhook delivery %d: %v", deliveryID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to redeliver"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
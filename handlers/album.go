@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
 	"github.com/camden-git/mediasysbackend/workers"
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
@@ -40,6 +42,45 @@ type AlbumHandler struct {
 	Cfg            config.Config
 	ThumbGen       *workers.ImageProcessor
 	MediaProcessor *media.Processor
+	MediaStore     media.Store
+	SmartAlbumRepo repository.SmartAlbumRepositoryInterface
+	RatingRepo     repository.ImageRatingRepositoryInterface
+	// records who to email when a pending album archive is ready, nil disables it
+	NotificationRepo repository.NotificationRepositoryInterface
+
+	// aggregates the stats of the album admin page
+	StatsRepo repository.StatsRepositoryInterface
+
+	// bounds the zips streamed at once, nil for no limit
+	ZipStreams *StreamLimiter
+}
+
+// watchZip asks for the signed in user, if any, to be emailed once an album's archive is built
+func (ah *AlbumHandler) watchZip(r *http.Request, albumID uint) {
+	user := currentUser(r)
+	if user == nil || user.Email == nil || ah.NotificationRepo == nil {
+		return
+	}
+	if err := ah.NotificationRepo.AddZipWatcher(albumID, user.ID); err != nil {
+		log.Printf("Error adding zip watcher for album %d: %v", albumID, err)
+	}
+}
+
+// redirectToPresignedAsset sends the client to a presigned object storage URL when the
+// media store supports it. returns false if the caller should serve the file itself.
+func (ah *AlbumHandler) redirectToPresignedAsset(w http.ResponseWriter, r *http.Request, relativePath string) bool {
+	presigner, ok := ah.MediaStore.(media.Presigner)
+	if !ok {
+		return false
+	}
+	signedURL, err := presigner.PresignGet(relativePath, time.Duration(ah.Cfg.S3PresignExpirySeconds)*time.Second)
+	if err != nil {
+		log.Printf("Error presigning asset %s: %v", relativePath, err)
+		http.Error(w, "Failed to access asset.", http.StatusInternalServerError)
+		return true
+	}
+	http.Redirect(w, r, signedURL, http.StatusFound)
+	return true
 }
 
 func (ah *AlbumHandler) getAlbumByIdentifier(identifier string) (*models.Album, error) {
@@ -71,6 +112,7 @@ func (ah *AlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 		Name        string  `json:"name"`
 		Slug        string  `json:"slug"`
 		FolderPath  string  `json:"folder_path"`
+		LibraryID   string  `json:"library_id"` // optional, folder_path is then relative to the library
 		Description *string `json:"description"`
 		IsHidden    *bool   `json:"is_hidden"`
 		Location    *string `json:"location"`
@@ -86,18 +128,22 @@ func (ah *AlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.ContainsAny(req.Slug, " /\\?%*:|\"<>") || strings.TrimSpace(req.Slug) == "" {
+	if !validAlbumSlug(req.Slug) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid slug format. Use URL-safe characters without spaces."})
 		return
 	}
+	if err := validateAlbumDescription(req.Description); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 
-	cleanRelativePath := filepath.Clean(req.FolderPath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "folder_path must be relative and cannot use '..'"})
+	folderPathForDB, err := albumFolderPath(ah.Cfg, req.LibraryID, req.FolderPath)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	folderPathForDB := filepath.ToSlash(cleanRelativePath)
-	fullPath := filepath.Join(ah.Cfg.RootDirectory, folderPathForDB)
+	library, _ := ah.Cfg.SplitPath(folderPathForDB)
+	fullPath := ah.Cfg.ResolvePath(folderPathForDB)
 	stat, err := os.Stat(fullPath)
 	if os.IsNotExist(err) {
 		// create the directory if it doesn't exist
@@ -122,6 +168,7 @@ func (ah *AlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
 		Slug:        req.Slug,
 		Description: req.Description,
 		FolderPath:  folderPathForDB,
+		LibraryID:   library.ID,
 	}
 	if req.IsHidden != nil {
 		newAlbumGorm.IsHidden = *req.IsHidden
@@ -151,10 +198,15 @@ func (ah *AlbumHandler) ListAlbums(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve albums"})
 		return
 	}
-	if albums == nil {
-		albums = []models.Album{} // ensure an empty array instead of null for JSON
+	type albumWithURLs struct {
+		models.Album
+		AlbumAssetURLs
 	}
-	writeJSON(w, http.StatusOK, albums)
+	response := make([]albumWithURLs, 0, len(albums)) // an empty array instead of null for JSON
+	for i := range albums {
+		response = append(response, albumWithURLs{Album: albums[i], AlbumAssetURLs: albumAssetURLs(ah.Cfg, &albums[i])})
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (ah *AlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
@@ -163,6 +215,10 @@ func (ah *AlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
 	album, err := ah.getAlbumByIdentifier(identifier)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if smart := ah.getSmartAlbumBySlug(identifier); smart != nil {
+				writeJSON(w, http.StatusOK, smartAlbumResponse(smart))
+				return
+			}
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
 		} else {
 			log.Printf("Error getting album by identifier '%s': %v", identifier, err)
@@ -171,6 +227,11 @@ func (ah *AlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ah.writeAlbum(w, album)
+}
+
+// writeAlbum responds with the album and the users who uploaded to it
+func (ah *AlbumHandler) writeAlbum(w http.ResponseWriter, album *models.Album) {
 	// Build artists list from uploaders
 	var artists []map[string]interface{}
 	if ah.ImageRepo != nil && ah.UserRepo != nil {
@@ -190,9 +251,10 @@ func (ah *AlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
 
 	type albumWithArtists struct {
 		*models.Album
+		AlbumAssetURLs
 		Artists []map[string]interface{} `json:"artists,omitempty"`
 	}
-	writeJSON(w, http.StatusOK, albumWithArtists{Album: album, Artists: artists})
+	writeJSON(w, http.StatusOK, albumWithArtists{Album: album, AlbumAssetURLs: albumAssetURLs(ah.Cfg, album), Artists: artists})
 }
 
 // ShareAlbumHTML serves minimal HTML with Open Graph/Twitter meta tags so link unfurlers
@@ -212,15 +274,7 @@ func (ah *AlbumHandler) ShareAlbumHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	scheme := "http"
-	if r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil {
-		scheme = "https"
-	}
-	host := r.Header.Get("X-Forwarded-Host")
-	if host == "" {
-		host = r.Host
-	}
-
+	origin := requestOrigin(r)
 	absolute := func(path string) string {
 		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
 			return path
@@ -228,7 +282,7 @@ func (ah *AlbumHandler) ShareAlbumHTML(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(path, "/") {
 			path = "/" + path
 		}
-		return scheme + "://" + host + path
+		return origin + path
 	}
 
 	pageURL := absolute("/album/" + album.Slug)
@@ -236,9 +290,7 @@ func (ah *AlbumHandler) ShareAlbumHTML(w http.ResponseWriter, r *http.Request) {
 	var imageURL string
 	if album.BannerImagePath != nil && *album.BannerImagePath != "" {
 		// Banners are exposed under /api/<bannersSubDir>/<filename>
-		bannersSubDir := filepath.Base(ah.Cfg.BannersPath)
-		filename := filepath.Base(*album.BannerImagePath)
-		imageURL = absolute("/api/" + bannersSubDir + "/" + filename)
+		imageURL = absolute(bannerURL(ah.Cfg, *album.BannerImagePath))
 	}
 
 	title := album.Name
@@ -247,7 +299,7 @@ func (ah *AlbumHandler) ShareAlbumHTML(w http.ResponseWriter, r *http.Request) {
 		desc = *album.Description
 	}
 
-	// Minimal HTML document with OG and Twitter tags
+	// Minimal HTML document with OG and Twitter tags, and the oEmbed discovery link
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	html := "<!doctype html><html lang=\"en\"><head>" +
 		"<meta charset=\"utf-8\">" +
@@ -256,7 +308,8 @@ func (ah *AlbumHandler) ShareAlbumHTML(w http.ResponseWriter, r *http.Request) {
 		"<meta property=\"og:type\" content=\"website\">" +
 		"<meta property=\"og:url\" content=\"" + htmlAttr(pageURL) + "\">" +
 		"<meta property=\"og:title\" content=\"" + htmlAttr(title) + "\">" +
-		"<meta property=\"og:description\" content=\"" + htmlAttr(desc) + "\">"
+		"<meta property=\"og:description\" content=\"" + htmlAttr(desc) + "\">" +
+		"<link rel=\"alternate\" type=\"application/json+oembed\" href=\"" + htmlAttr(origin+"/api/oembed?format=json&url="+url.QueryEscape(pageURL)) + "\" title=\"" + htmlAttr(title) + "\">"
 	if imageURL != "" {
 		html += "<meta property=\"og:image\" content=\"" + htmlAttr(imageURL) + "\">" +
 			"<meta property=\"og:image:alt\" content=\"" + htmlAttr(title) + "\">"
@@ -301,6 +354,10 @@ func (ah *AlbumHandler) GetAlbumContents(w http.ResponseWriter, r *http.Request)
 	album, err := ah.getAlbumByIdentifier(identifier)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if smart := ah.getSmartAlbumBySlug(identifier); smart != nil {
+				writeSmartAlbumContents(w, r, ah.Cfg, ah.SmartAlbumRepo, smart)
+				return
+			}
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
 		} else {
 			log.Printf("Error getting album '%s' for contents: %v", identifier, err)
@@ -309,31 +366,49 @@ func (ah *AlbumHandler) GetAlbumContents(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	albumFullPath := filepath.Join(ah.Cfg.RootDirectory, album.FolderPath)
+	ah.writeAlbumContents(w, r, album)
+}
+
+// writeAlbumContents responds with a page of the album folder listing, honoring the offset, limit and cursor query params
+// and the metadata filters read by parseImageFilterParams. burst stacks are listed as their best frame, and Live
+// Photos as their still, unless expand_stacks=true is given
+func (ah *AlbumHandler) writeAlbumContents(w http.ResponseWriter, r *http.Request, album *models.Album) {
+	albumFullPath := ah.Cfg.ResolvePath(album.FolderPath)
 	albumFullPath = filepath.Clean(albumFullPath)
-	if !strings.HasPrefix(albumFullPath, ah.Cfg.RootDirectory) {
-		log.Printf("CRITICAL: Album ID %d (slug %s) folder path '%s' resolved outside root directory ('%s'). Aborting.", album.ID, album.Slug, album.FolderPath, albumFullPath)
+	if library, _ := ah.Cfg.SplitPath(album.FolderPath); !utils.IsWithin(library.Path, albumFullPath) {
+		log.Printf("CRITICAL: Album ID %d (slug %s) folder path '%s' resolved outside its library ('%s'). Aborting.", album.ID, album.Slug, album.FolderPath, albumFullPath)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
 		return
 	}
 
-    defaultLimit := 120
-    q := r.URL.Query()
-    offset := 0
-    limit := defaultLimit
-    if o := q.Get("offset"); o != "" {
-        if v, convErr := strconv.Atoi(o); convErr == nil && v >= 0 {
-            offset = v
-        }
-    }
-    if l := q.Get("limit"); l != "" {
-        if v, convErr := strconv.Atoi(l); convErr == nil && v > 0 {
-            limit = v
-        }
-    }
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter, filtered, err := parseImageFilterParams(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errRatingFilterUnauthenticated) {
+			status = http.StatusUnauthorized
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	if filtered {
+		ah.writeFilteredAlbumContents(w, r, album, filter, offset, limit)
+		return
+	}
+	expandStacks := false
+	if raw := r.URL.Query().Get("expand_stacks"); raw != "" {
+		if expandStacks, err = strconv.ParseBool(raw); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expand_stacks must be true or false"})
+			return
+		}
+	}
 
     // Pass ah.ImageRepo to listDirectoryContents, as it expects an ImageRepositoryInterface
-    fileInfos, totalCount, err := listDirectoryContents(albumFullPath, "/"+album.FolderPath, ah.Cfg, ah.ImageRepo, ah.ThumbGen, album.SortOrder, offset, limit)
+    fileInfos, totalCount, err := listDirectoryContents(albumFullPath, "/"+album.FolderPath, ah.Cfg, ah.ImageRepo, ah.ThumbGen, album.SortOrder, offset, limit, hidesNSFW(ah.Cfg, r), !expandStacks)
 	if err != nil {
 		if os.IsNotExist(err) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album folder not found on disk: " + album.FolderPath})
@@ -346,15 +421,14 @@ func (ah *AlbumHandler) GetAlbumContents(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	applyAlbumRights(album, fileInfos)
+	annotateRatings(ah.RatingRepo, currentUser(r), fileInfos)
 	listing := DirectoryListing{
 		Path:  "/" + album.FolderPath,
-        Files: fileInfos,
-        Total: totalCount,
-        Offset: offset,
-        Limit: limit,
-        HasMore: offset+len(fileInfos) < totalCount,
+		Files: fileInfos,
 		// Parent: "/api/albums",
 	}
+	listing.paginate(offset, limit, totalCount)
 	writeJSON(w, http.StatusOK, listing)
 }
 
@@ -429,6 +503,10 @@ func (ah *AlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	if err := validateAlbumDescription(req.Description); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 
 	var nameUpdate string
 	var descUpdate *string // keep as a pointer for repository
@@ -543,29 +621,20 @@ func (ah *AlbumHandler) UploadAlbumBanner(w http.ResponseWriter, r *http.Request
 	oldBannerRelativePathPtr := album.BannerImagePath
 	newBannerRelativePath := savedRelPath
 	if oldBannerRelativePathPtr != nil && (*oldBannerRelativePathPtr != newBannerRelativePath) {
-		mediaStore, storeErr := media.NewLocalStorage(ah.Cfg.MediaStoragePath, map[media.AssetType]string{})
-		if storeErr == nil { // only attempt to delete if store initialized
-			oldBannerFullPath, pathErr := mediaStore.GetFullPath(*oldBannerRelativePathPtr)
-			if pathErr == nil {
-				if removeErr := os.Remove(oldBannerFullPath); removeErr != nil && !os.IsNotExist(removeErr) {
-					log.Printf("Warning: Failed to remove old banner file %s: %v", oldBannerFullPath, removeErr)
-				} else if removeErr == nil {
-					log.Printf("Removed old banner file: %s", oldBannerFullPath)
-				}
-			} else {
-				log.Printf("Warning: Could not resolve full path for old banner %s: %v", *oldBannerRelativePathPtr, pathErr)
+		if ah.MediaStore != nil {
+			if removeErr := ah.MediaStore.Delete(*oldBannerRelativePathPtr); removeErr != nil {
+				log.Printf("Warning: Failed to remove old banner file %s: %v", *oldBannerRelativePathPtr, removeErr)
 			}
 		} else {
-			log.Printf("Warning: Could not initialize media store to delete old banner: %v", storeErr)
+			log.Printf("Warning: Media store not configured, cannot delete old banner %s", *oldBannerRelativePathPtr)
 		}
 	}
 
 	dbErr := ah.AlbumRepo.UpdateBannerPath(album.ID, &newBannerRelativePath)
 	if dbErr != nil {
-		mediaStore, storeErr := media.NewLocalStorage(ah.Cfg.MediaStoragePath, map[media.AssetType]string{})
-		if storeErr == nil {
+		if ah.MediaStore != nil {
 			// attempt to delete the newly saved banner if DB update fails
-			if delErr := mediaStore.Delete(newBannerRelativePath); delErr != nil {
+			if delErr := ah.MediaStore.Delete(newBannerRelativePath); delErr != nil {
 				log.Printf("Warning: Failed to delete banner %s after DB update failure: %v", newBannerRelativePath, delErr)
 			}
 		}
@@ -623,6 +692,7 @@ func (ah *AlbumHandler) RequestAlbumZipGeneration(w http.ResponseWriter, r *http
 	}
 
 	log.Printf("Album ZIP generation requested and queued for Album ID: %d", album.ID)
+	ah.watchZip(r, album.ID)
 	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Album ZIP generation request accepted and queued."})
 }
 
@@ -642,6 +712,7 @@ func (ah *AlbumHandler) DownloadAlbumZipByID(w http.ResponseWriter, r *http.Requ
 
 	if album.ZipStatus != database.StatusDone || album.ZipPath == nil || *album.ZipPath == "" {
 		if album.ZipStatus == database.StatusPending || album.ZipStatus == database.StatusProcessing {
+			ah.watchZip(r, album.ID)
 			http.Error(w, "ZIP archive is currently being generated. Please try again later.", http.StatusAccepted)
 		} else if album.ZipStatus == database.StatusError && album.ZipError != nil {
 			http.Error(w, fmt.Sprintf("ZIP generation failed: %s", *album.ZipError), http.StatusConflict)
@@ -651,11 +722,15 @@ func (ah *AlbumHandler) DownloadAlbumZipByID(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if ah.redirectToPresignedAsset(w, r, *album.ZipPath) {
+		return
+	}
+
 	// construct the full path to the zip file
 	fullZipPath := filepath.Join(ah.Cfg.MediaStoragePath, *album.ZipPath)
 	fullZipPath = filepath.Clean(fullZipPath)
 
-	if !strings.HasPrefix(fullZipPath, ah.Cfg.MediaStoragePath) {
+	if !utils.IsWithin(ah.Cfg.MediaStoragePath, fullZipPath) {
 		log.Printf("SECURITY: Attempt to download ZIP outside media storage: %s (resolved from %s)", fullZipPath, *album.ZipPath)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
@@ -682,18 +757,10 @@ func (ah *AlbumHandler) DownloadAlbumZipByID(w http.ResponseWriter, r *http.Requ
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_archive.zip\"", album.Slug))
 	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-
-	modTime := fileInfo.ModTime()
-	if !modTime.IsZero() {
-		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
-	}
+	w.Header().Set("ETag", assetETag(fileInfo))
 
-	_, copyErr := io.Copy(w, file)
-	if copyErr != nil {
-		log.Printf("Error copying ZIP file %s to response: %v", fullZipPath, copyErr)
-		// don't return error here as the response has already started
-	}
+	// handles Range and If-Range, so interrupted downloads resume where they stopped
+	http.ServeContent(w, r, "", fileInfo.ModTime(), file)
 }
 
 func (ah *AlbumHandler) DownloadAlbumZip(w http.ResponseWriter, r *http.Request) {
@@ -712,6 +779,7 @@ func (ah *AlbumHandler) DownloadAlbumZip(w http.ResponseWriter, r *http.Request)
 
 	if album.ZipStatus != database.StatusDone || album.ZipPath == nil || *album.ZipPath == "" {
 		if album.ZipStatus == database.StatusPending || album.ZipStatus == database.StatusProcessing {
+			ah.watchZip(r, album.ID)
 			http.Error(w, "ZIP archive is currently being generated. Please try again later.", http.StatusAccepted)
 		} else if album.ZipStatus == database.StatusError && album.ZipError != nil {
 			http.Error(w, fmt.Sprintf("ZIP generation failed: %s", *album.ZipError), http.StatusConflict)
@@ -721,11 +789,15 @@ func (ah *AlbumHandler) DownloadAlbumZip(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if ah.redirectToPresignedAsset(w, r, *album.ZipPath) {
+		return
+	}
+
 	// construct the full path to the zip file
 	fullZipPath := filepath.Join(ah.Cfg.MediaStoragePath, *album.ZipPath)
 	fullZipPath = filepath.Clean(fullZipPath)
 
-	if !strings.HasPrefix(fullZipPath, ah.Cfg.MediaStoragePath) {
+	if !utils.IsWithin(ah.Cfg.MediaStoragePath, fullZipPath) {
 		log.Printf("SECURITY: Attempt to download ZIP outside media storage: %s (resolved from %s)", fullZipPath, *album.ZipPath)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
@@ -752,16 +824,179 @@ func (ah *AlbumHandler) DownloadAlbumZip(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_archive.zip\"", album.Slug))
 	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
+	w.Header().Set("ETag", assetETag(fileInfo))
+
+	// handles Range and If-Range, so interrupted downloads resume where they stopped
+	http.ServeContent(w, r, "", fileInfo.ModTime(), file)
+}
+
+// StreamAlbumZip zips the album folder straight into the response, so the download starts
+// right away and no archive is kept in media storage. the size isn't known up front and
+// interrupted downloads can't be resumed; DownloadAlbumZip serves pre-generated archives.
+// with ?mode=web the archive holds web versions of the images instead of the originals.
+func (ah *AlbumHandler) StreamAlbumZip(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "album_identifier")
+	download, err := parseImageDownload(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.NotFound(w, r)
+		} else {
+			log.Printf("Error finding album '%s' for zip stream: %v", identifier, err)
+			http.Error(w, "Failed to find album", http.StatusInternalServerError)
+		}
+		return
+	}
 
-	modTime := fileInfo.ModTime()
-	if !modTime.IsZero() {
-		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	albumFullPath, err := ah.albumFolderFullPath(album)
+	if err != nil {
+		http.Error(w, "Album configuration error", http.StatusInternalServerError)
+		return
+	}
+
+	names, err := utils.AlbumZipFiles(albumFullPath, ah.Cfg.IsIgnored, ah.Cfg.AllowsSymlink)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoFilesToZip) {
+			http.Error(w, "Album has no files to download.", http.StatusNotFound)
+		} else if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Album folder not found on disk.", http.StatusNotFound)
+		} else {
+			log.Printf("Error listing files to zip for album %d/%s: %v", album.ID, album.Slug, err)
+			http.Error(w, "Failed to create ZIP archive.", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !ah.ZipStreams.acquire() {
+		streamsBusy(w)
+		return
+	}
+	defer ah.ZipStreams.release()
+
+	download.rights = downloadRights(ah.Cfg, ah.ImageRepo, album)
+	streamDownloadZip(w, ah.Cfg, album, albumFullPath, names, download, zipFileName(album, "archive", download))
+}
+
+// maxCustomZipFiles caps how many files one custom album zip can hold
+const maxCustomZipFiles = 1000
+
+// StreamCustomAlbumZip handles POST /api/albums/{album_identifier}/zip/custom, streaming
+// a one-off archive of just the chosen files. paths are either file names or the paths
+// from the album contents listing, and must be files directly inside the album folder.
+// ?mode=web works as for StreamAlbumZip.
+func (ah *AlbumHandler) StreamCustomAlbumZip(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "album_identifier")
+	download, err := parseImageDownload(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error finding album '%s' for custom zip: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to find album"})
+		}
+		return
+	}
+
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths must list at least one file"})
+		return
+	}
+	if len(req.Paths) > maxCustomZipFiles {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("paths can list at most %d files", maxCustomZipFiles)})
+		return
+	}
+
+	albumFullPath, err := ah.albumFolderFullPath(album)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Paths))
+	names := make([]string, 0, len(req.Paths))
+	for _, requested := range req.Paths {
+		name, ok := albumFileName(album, albumFullPath, requested)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Not a file in this album: " + requested})
+			return
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
 
-	_, copyErr := io.Copy(w, file)
-	if copyErr != nil {
-		log.Printf("Error streaming ZIP file %s to client: %v", fullZipPath, copyErr)
+	if !ah.ZipStreams.acquire() {
+		w.Header().Set("Retry-After", streamRetryAfter)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Too many downloads in progress, please try again shortly."})
+		return
+	}
+	defer ah.ZipStreams.release()
+
+	download.rights = downloadRights(ah.Cfg, ah.ImageRepo, album)
+	streamDownloadZip(w, ah.Cfg, album, albumFullPath, names, download, zipFileName(album, "selection", download))
+}
+
+// albumFileName returns the name of a file directly inside the album folder, given either
+// the name or its path from the album contents listing. ok is false if there's no such file.
+func albumFileName(album *models.Album, albumFullPath, requested string) (name string, ok bool) {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(requested)), "/")
+	if dir := path.Dir(name); dir != "." {
+		if dir != strings.Trim(filepath.ToSlash(album.FolderPath), "/") {
+			return "", false
+		}
+		name = path.Base(name)
+	}
+	if name == "" || name == "." || name == ".." {
+		return "", false
+	}
+	info, err := os.Lstat(filepath.Join(albumFullPath, name))
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return name, true
+}
+
+// albumFolderFullPath resolves an album's folder on disk, refusing folders that resolve
+// outside their library
+func (ah *AlbumHandler) albumFolderFullPath(album *models.Album) (string, error) {
+	albumFullPath := filepath.Clean(ah.Cfg.ResolvePath(album.FolderPath))
+	if library, _ := ah.Cfg.SplitPath(album.FolderPath); !utils.IsWithin(library.Path, albumFullPath) {
+		log.Printf("CRITICAL: Album ID %d (slug %s) folder path '%s' resolved outside its library ('%s'). Aborting.", album.ID, album.Slug, album.FolderPath, albumFullPath)
+		return "", fmt.Errorf("album folder resolved outside its library")
+	}
+	if err := ah.Cfg.CheckSymlinks(albumFullPath); err != nil {
+		log.Printf("Album ID %d (slug %s) folder '%s' is not accessible under the symlink policy: %v", album.ID, album.Slug, albumFullPath, err)
+		return "", err
+	}
+	return albumFullPath, nil
+}
+
+// streamZip zips the named files of an album folder into the response as filename
+func streamZip(w http.ResponseWriter, album *models.Album, albumFullPath string, names []string, filename string) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Type", "application/zip")
+	if err := utils.WriteAlbumZip(newDeadlineWriter(w), albumFullPath, names, nil); err != nil {
+		// the response has started, so the client is left with a truncated archive
+		log.Printf("Error streaming zip for album %d/%s: %v", album.ID, album.Slug, err)
 	}
 }
 
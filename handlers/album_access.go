@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// RequireAlbumAccess is a middleware for the public routes of the album named by the
+// {album_identifier} URL param. albums that are not hidden are open to everyone; hidden ones
+// need a user with the given album permission, or the global album.list permission.
+// identifiers that don't name an album are passed on, so handlers can fall back to smart albums.
+// It should be used after OptionalAuthMiddleware.
+func (ah *AlbumHandler) RequireAlbumAccess(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identifier := chi.URLParam(r, "album_identifier")
+		album, err := ah.getAlbumByIdentifier(identifier)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			log.Printf("Error getting album '%s' for access check: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+			return
+		}
+
+		user := currentUser(r)
+		if canAccessAlbum(user, album, permission) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+			return
+		}
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Forbidden: requires album permission '" + permission + "'"})
+	})
+}
+
+// RedirectFormerSlug is a middleware for the routes of the album named by the
+// {album_identifier} URL param. requests naming an album by one of its former slugs are
+// redirected to the same URL with the current slug, so links shared before the slug was
+// changed keep working. an album ID or a smart album with the same slug takes precedence.
+func (ah *AlbumHandler) RedirectFormerSlug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identifier := chi.URLParam(r, "album_identifier")
+		album, err := ah.AlbumRepo.GetBySlugRedirect(identifier)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Error looking up slug redirect '%s': %v", identifier, err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if albumID, err := strconv.ParseUint(identifier, 10, 64); err == nil {
+			if _, err := ah.AlbumRepo.GetByID(uint(albumID)); err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if ah.getSmartAlbumBySlug(identifier) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target := *r.URL
+		target.Path = replaceAlbumSegment(r.URL.Path, identifier, album.Slug)
+		target.RawPath = ""
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// keeps the method and body, unlike a 301
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target.RequestURI(), status)
+	})
+}
+
+// replaceAlbumSegment replaces the path segment following "/albums/" that is identifier
+func replaceAlbumSegment(p, identifier, replacement string) string {
+	segment := "/albums/" + identifier
+	for start := 0; ; {
+		i := strings.Index(p[start:], segment)
+		if i < 0 {
+			return p
+		}
+		end := start + i + len(segment)
+		if end == len(p) || p[end] == '/' {
+			return p[:start+i] + "/albums/" + replacement + p[end:]
+		}
+		start += i + 1
+	}
+}
+
+// canAccessAlbum reports whether user, nil when anonymous, may use the public routes of album
+// that need permission
+func canAccessAlbum(user *models.User, album *models.Album, permission string) bool {
+	if !album.IsHidden {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	return user.HasGlobalPermission("album.list") || user.HasAlbumPermission(album.ID, permission)
+}
+
+// hiddenAlbumFolders returns the folders of the hidden albums user, nil when anonymous, may not
+// view, for leaving their files out of listings that span the whole library
+func hiddenAlbumFolders(albumRepo repository.AlbumRepositoryInterface, user *models.User) ([]string, error) {
+	albums, err := albumRepo.ListAllAdmin()
+	if err != nil {
+		return nil, err
+	}
+	var folders []string
+	for i := range albums {
+		if !canAccessAlbum(user, &albums[i], "album.view.content") {
+			folders = append(folders, albums[i].FolderPath)
+		}
+	}
+	return folders, nil
+}
+
+// withinAnyFolder reports whether the file at filePath, relative to the root, is anywhere below
+// any of folders
+func withinAnyFolder(filePath string, folders []string) bool {
+	for _, folder := range folders {
+		folder = strings.Trim(folder, "/")
+		if folder == "" || folder == "." || strings.HasPrefix(filePath, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hidesNSFW reports whether images flagged or confirmed as NSFW are left out of the response
+// to r: they are hidden from anonymous requests, share link visitors included, unless
+// NSFW_HIDE_PUBLIC is off
+func hidesNSFW(cfg config.Config, r *http.Request) bool {
+	return cfg.NSFWHidePublic && currentUser(r) == nil
+}
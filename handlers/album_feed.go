@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// number of entries in an album feed, unless the limit query param asks for fewer or more
+const (
+	defaultFeedLimit = 50
+	maxFeedLimit     = 200
+)
+
+// atomFeed is an Atom 1.0 feed document, see RFC 4287
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Logo     string      `xml:"logo,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Summary string      `xml:"summary,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// requestOrigin returns the scheme and host the request was sent to, honoring the headers
+// set by a reverse proxy, e.g. "https://photos.example.com"
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	return scheme + "://" + host
+}
+
+// escapeURLPath escapes each segment of a slash separated path for use in a URL
+func escapeURLPath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// GetAlbumFeed returns an Atom feed of the latest files in an album folder, newest upload
+// first, with a thumbnail and links to the original and the album page, so subscribers can
+// follow new uploads. like the contents, subfolders and, for anonymous requests, NSFW files
+// are left out.
+// Route: GET /api/albums/{album_identifier}/feed.xml?limit=...
+func (ah *AlbumHandler) GetAlbumFeed(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "album_identifier")
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album '%s' for feed: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album information"})
+		}
+		return
+	}
+	limit := defaultFeedLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(v, maxFeedLimit)
+	}
+
+	images, err := ah.ImageRepo.ListRecent(repository.ImageFilter{Folder: album.FolderPath, ExcludeNSFW: hidesNSFW(ah.Cfg, r)}, limit)
+	if err != nil {
+		log.Printf("Error listing latest images of album %d for feed: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list album contents"})
+		return
+	}
+
+	// assets are served by this server, the album page by the web app
+	apiOrigin := requestOrigin(r)
+	appOrigin := ah.Cfg.PublicURL
+	if appOrigin == "" {
+		appOrigin = apiOrigin
+	}
+	absolute := func(p string) string {
+		if strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") {
+			return p
+		}
+		return apiOrigin + p
+	}
+	pageURL := appOrigin + "/album/" + url.PathEscape(album.Slug)
+
+	feed := atomFeed{
+		ID:      pageURL,
+		Title:   album.Name,
+		Updated: time.Unix(album.UpdatedAt, 0).UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: apiOrigin + r.URL.EscapedPath(), Type: "application/atom+xml"},
+			{Rel: "alternate", Href: pageURL, Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0, len(images)),
+	}
+	if album.Description != nil {
+		feed.Subtitle = *album.Description
+	}
+	if album.BannerImagePath != nil && *album.BannerImagePath != "" {
+		feed.Logo = absolute(bannerURL(ah.Cfg, *album.BannerImagePath))
+	}
+
+	if len(images) > 0 && images[0].LastModified > album.UpdatedAt {
+		feed.Updated = time.Unix(images[0].LastModified, 0).UTC().Format(time.RFC3339)
+	}
+	for i := range images {
+		feed.Entries = append(feed.Entries, feedEntry(ah.Cfg, &images[i], pageURL, absolute))
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Printf("Error writing feed of album %d: %v", album.ID, err)
+	}
+}
+
+// feedEntry builds the feed entry of an image. absolute turns a server path into a URL.
+func feedEntry(cfg config.Config, img *models.Image, pageURL string, absolute func(string) string) atomEntry {
+	name := path.Base(img.OriginalPath)
+	originalURL := absolute("/api/" + escapeURLPath(img.OriginalPath))
+	entry := atomEntry{
+		ID:      originalURL,
+		Title:   name,
+		Updated: time.Unix(img.LastModified, 0).UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Rel: "alternate", Href: pageURL, Type: "text/html"}},
+	}
+	enclosure := atomLink{Rel: "enclosure", Href: originalURL, Type: mime.TypeByExtension(path.Ext(name))}
+	if img.FileSize != nil {
+		enclosure.Length = *img.FileSize
+	}
+	entry.Links = append(entry.Links, enclosure)
+	if img.Description != nil {
+		entry.Summary = *img.Description
+	}
+
+	// the content is the thumbnail linking to the original, or a plain link before it is generated
+	html := `<p><a href="` + htmlAttr(originalURL) + `">`
+	if img.ThumbnailPath != nil && img.ThumbnailStatus == database.StatusDone {
+		html += `<img src="` + htmlAttr(absolute(thumbnailURL(cfg, *img.ThumbnailPath))) + `" alt="` + htmlAttr(name) + `">`
+	} else {
+		html += htmlEscape(name)
+	}
+	html += `</a></p>`
+	if img.Description != nil {
+		html += "<p>" + htmlEscape(*img.Description) + "</p>"
+	}
+	entry.Content = atomContent{Type: "html", Body: html}
+	return entry
+}
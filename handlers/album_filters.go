@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// errRatingFilterUnauthenticated rejects favorites and rating filters in anonymous requests
+var errRatingFilterUnauthenticated = errors.New("favorites and rating filters require authentication")
+
+// parseImageFilterParams reads the metadata filter query params of an album listing:
+// taken_after and taken_before (Unix seconds or YYYY-MM-DD), camera_make, camera_model and
+// lens (repeatable), iso_min, iso_max, focal_min, focal_max, has_faces, media_type,
+// location (repeatable; a city, region or country name), tag (repeatable) and machine_tag
+// (repeatable; a label given by image classification), stack (the ID of a burst stack, listing all of its frames), and
+// the favorites, rating_min and rating_max filters on the authenticated user's ratings.
+// returns false if no filter was given, and errRatingFilterUnauthenticated if a rating filter
+// was given without a user.
+func parseImageFilterParams(r *http.Request) (repository.ImageFilter, bool, error) {
+	q := r.URL.Query()
+	var filter repository.ImageFilter
+	filtered := false
+
+	parseTime := func(name string) (*int64, error) {
+		raw := q.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		filtered = true
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return &v, nil
+		}
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a Unix timestamp or a YYYY-MM-DD date", name)
+		}
+		v := t.Unix()
+		return &v, nil
+	}
+	parseInt := func(name string) (*int, error) {
+		raw := q.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		filtered = true
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		return &v, nil
+	}
+	parseFloat := func(name string) (*float64, error) {
+		raw := q.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		filtered = true
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		return &v, nil
+	}
+	values := func(name string) []string {
+		var out []string
+		for _, v := range q[name] {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		if len(out) > 0 {
+			filtered = true
+		}
+		return out
+	}
+
+	var err error
+	if filter.TakenAfter, err = parseTime("taken_after"); err != nil {
+		return filter, false, err
+	}
+	if filter.TakenBefore, err = parseTime("taken_before"); err != nil {
+		return filter, false, err
+	}
+	if filter.ISOMin, err = parseInt("iso_min"); err != nil {
+		return filter, false, err
+	}
+	if filter.ISOMax, err = parseInt("iso_max"); err != nil {
+		return filter, false, err
+	}
+	if filter.FocalMin, err = parseFloat("focal_min"); err != nil {
+		return filter, false, err
+	}
+	if filter.FocalMax, err = parseFloat("focal_max"); err != nil {
+		return filter, false, err
+	}
+	filter.CameraMakes = values("camera_make")
+	filter.CameraModels = values("camera_model")
+	filter.Lenses = values("lens")
+	filter.Locations = values("location")
+	filter.Tags = values("tag")
+	filter.MachineTags = values("machine_tag")
+
+	if raw := q.Get("has_faces"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, false, fmt.Errorf("has_faces must be true or false")
+		}
+		filter.HasFaces = &v
+		filtered = true
+	}
+	if filter.RatingMin, err = parseInt("rating_min"); err != nil {
+		return filter, false, err
+	}
+	if filter.RatingMax, err = parseInt("rating_max"); err != nil {
+		return filter, false, err
+	}
+	for _, rating := range []*int{filter.RatingMin, filter.RatingMax} {
+		if rating != nil && (*rating < 1 || *rating > models.MaxImageRating) {
+			return filter, false, fmt.Errorf("rating_min and rating_max must be from 1 to %d", models.MaxImageRating)
+		}
+	}
+	if raw := q.Get("favorites"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, false, fmt.Errorf("favorites must be true or false")
+		}
+		filter.FavoritesOnly = v
+		filtered = true
+	}
+	if filter.FavoritesOnly || filter.RatingMin != nil || filter.RatingMax != nil {
+		user, ok := r.Context().Value(UserContextKey).(*models.User)
+		if !ok || user == nil {
+			return filter, false, errRatingFilterUnauthenticated
+		}
+		filter.RatingUserID = user.ID
+	}
+	if raw := q.Get("media_type"); raw != "" {
+		if raw != database.MediaTypeImage && raw != database.MediaTypeVideo && raw != database.MediaTypeDocument {
+			return filter, false, fmt.Errorf("media_type must be %q, %q or %q", database.MediaTypeImage, database.MediaTypeVideo, database.MediaTypeDocument)
+		}
+		filter.MediaType = raw
+		filtered = true
+	}
+	if raw := q.Get("stack"); raw != "" {
+		filter.StackID = raw
+		filtered = true
+	}
+	return filter, filtered, nil
+}
+
+// writeFilteredAlbumContents responds with a page of the files of an album folder that match
+// a metadata filter. the filter runs against the images table, so folders and files that
+// have not been indexed yet are not listed.
+func (ah *AlbumHandler) writeFilteredAlbumContents(w http.ResponseWriter, r *http.Request, album *models.Album, filter repository.ImageFilter, offset, limit int) {
+	filter.Folder = album.FolderPath
+	filter.ExcludeNSFW = hidesNSFW(ah.Cfg, r)
+	images, total, err := ah.ImageRepo.ListFiltered(filter, album.SortOrder, offset, limit)
+	if err != nil {
+		log.Printf("Error listing filtered contents for album %d/%s: %v", album.ID, album.Slug, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list album contents"})
+		return
+	}
+
+	files := make([]FileInfo, 0, len(images))
+	for i := range images {
+		files = append(files, fileInfoFromImage(&images[i], ah.Cfg))
+	}
+	applyAlbumRights(album, files)
+	annotateRatings(ah.RatingRepo, currentUser(r), files)
+	listing := DirectoryListing{Path: "/" + album.FolderPath, Files: files}
+	listing.paginate(offset, limit, int(total))
+	writeJSON(w, http.StatusOK, listing)
+}
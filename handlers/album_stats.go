@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// GetAlbumStats returns the number and size of the files in an album and its subfolders,
+// the range of their capture dates, the cameras they were taken with, the people tagged in
+// them and how far their processing got. like the contents, NSFW files are left out for
+// anonymous requests, as are hidden people.
+// Route: GET /api/albums/{album_identifier}/stats
+func (ah *AlbumHandler) GetAlbumStats(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "album_identifier")
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album '%s' for stats: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album information"})
+		}
+		return
+	}
+
+	stats, err := ah.StatsRepo.AlbumStats(album.FolderPath, hidesNSFW(ah.Cfg, r), currentUser(r) != nil)
+	if err != nil {
+		log.Printf("Error collecting stats of album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to collect album statistics"})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/permissions"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type ApiTokenHandler struct {
+	ApiTokenRepo repository.ApiTokenRepository
+}
+
+func NewApiTokenHandler(apiTokenRepo repository.ApiTokenRepository) *ApiTokenHandler {
+	return &ApiTokenHandler{ApiTokenRepo: apiTokenRepo}
+}
+
+type ApiTokenCreatePayload struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	AlbumIDs    []uint   `json:"album_ids,omitempty"`  // empty for all albums
+	ExpiresAt   *string  `json:"expires_at,omitempty"` // ISO 8601 format e.g., "2023-12-31T23:59:59Z" or null
+}
+
+type ApiTokenUpdatePayload struct {
+	Name        *string   `json:"name,omitempty"`
+	Permissions *[]string `json:"permissions,omitempty"`
+	AlbumIDs    *[]uint   `json:"album_ids,omitempty"`
+	ExpiresAt   *string   `json:"expires_at,omitempty"` // empty string removes the expiry
+}
+
+// ApiTokenResponseDTO for API responses
+type ApiTokenResponseDTO struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	TokenPrefix string   `json:"token_prefix"`
+	Token       string   `json:"token,omitempty"` // only set in the create response
+	Permissions []string `json:"permissions"`
+	AlbumIDs    []uint   `json:"album_ids"`
+	ExpiresAt   *string  `json:"expires_at,omitempty"`
+	LastUsedAt  *string  `json:"last_used_at,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+func toApiTokenResponseDTO(t *models.ApiToken) ApiTokenResponseDTO {
+	var expiresAtStr, lastUsedAtStr *string
+	if t.ExpiresAt != nil {
+		s := t.ExpiresAt.Format(time.RFC3339)
+		expiresAtStr = &s
+	}
+	if t.LastUsedAt != nil {
+		s := t.LastUsedAt.Format(time.RFC3339)
+		lastUsedAtStr = &s
+	}
+	perms := t.Permissions
+	if perms == nil {
+		perms = []string{}
+	}
+	albumIDs := t.AlbumIDs
+	if albumIDs == nil {
+		albumIDs = []uint{}
+	}
+	return ApiTokenResponseDTO{
+		ID:          t.ID,
+		Name:        t.Name,
+		TokenPrefix: t.TokenPrefix,
+		Permissions: perms,
+		AlbumIDs:    albumIDs,
+		ExpiresAt:   expiresAtStr,
+		LastUsedAt:  lastUsedAtStr,
+		CreatedAt:   t.CreatedAt.Format(http.TimeFormat),
+		UpdatedAt:   t.UpdatedAt.Format(http.TimeFormat),
+	}
+}
+
+// sessionUser returns the authenticated user, rejecting requests made with an API token
+// so a scoped token can never mint a broader one
+func (h *ApiTokenHandler) sessionUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	currentUser, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok || currentUser == nil {
+		http.Error(w, "User not found in context (authentication error)", http.StatusInternalServerError)
+		return nil, false
+	}
+	if currentUser.APIToken != nil {
+		http.Error(w, "API tokens cannot be managed with an API token", http.StatusForbidden)
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// ownedToken loads a token by the {id} URL param, hiding tokens that belong to other users
+func (h *ApiTokenHandler) ownedToken(w http.ResponseWriter, r *http.Request, userID uint) (*models.ApiToken, bool) {
+	tokenIDStr := chi.URLParam(r, "id")
+	tokenID, err := strconv.ParseUint(tokenIDStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid API token ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	token, err := h.ApiTokenRepo.GetByID(uint(tokenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "API token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve API token: "+err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	if token.UserID != userID {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return nil, false
+	}
+	return token, true
+}
+
+func validateApiTokenPermissions(perms []string) (string, bool) {
+	if len(perms) == 0 {
+		return "At least one permission is required", false
+	}
+	for _, p := range perms {
+		if !permissions.IsValidPermissionKey(p) {
+			return "Invalid permission key: " + p, false
+		}
+	}
+	return "", true
+}
+
+func (h *ApiTokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.ApiTokenRepo.ListByUserID(currentUser.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve API tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dtos := make([]ApiTokenResponseDTO, len(tokens))
+	for i, t := range tokens {
+		dtos[i] = toApiTokenResponseDTO(&t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dtos)
+}
+
+func (h *ApiTokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var payload ApiTokenCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Token name is required", http.StatusBadRequest)
+		return
+	}
+	if msg, valid := validateApiTokenPermissions(payload.Permissions); !valid {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	plainToken, tokenHash, err := models.GenerateApiToken()
+	if err != nil {
+		http.Error(w, "Failed to generate API token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiToken := &models.ApiToken{
+		UserID:      currentUser.ID,
+		Name:        payload.Name,
+		TokenHash:   tokenHash,
+		TokenPrefix: plainToken[:len(models.ApiTokenPrefix)+6],
+		Permissions: payload.Permissions,
+		AlbumIDs:    payload.AlbumIDs,
+	}
+
+	if payload.ExpiresAt != nil && *payload.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
+		if err != nil {
+			http.Error(w, "Invalid expires_at format (must be RFC3339): "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		apiToken.ExpiresAt = &t
+	}
+
+	if err := h.ApiTokenRepo.Create(apiToken); err != nil {
+		http.Error(w, "Failed to create API token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dto := toApiTokenResponseDTO(apiToken)
+	dto.Token = plainToken
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dto)
+}
+
+func (h *ApiTokenHandler) GetToken(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+	token, ok := h.ownedToken(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toApiTokenResponseDTO(token))
+}
+
+func (h *ApiTokenHandler) UpdateToken(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var payload ApiTokenUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, ok := h.ownedToken(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	if payload.Name != nil {
+		name := strings.TrimSpace(*payload.Name)
+		if name == "" {
+			http.Error(w, "Token name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		token.Name = name
+	}
+	if payload.Permissions != nil {
+		if msg, valid := validateApiTokenPermissions(*payload.Permissions); !valid {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		token.Permissions = *payload.Permissions
+	}
+	if payload.AlbumIDs != nil {
+		token.AlbumIDs = *payload.AlbumIDs
+	}
+	if payload.ExpiresAt != nil {
+		if *payload.ExpiresAt == "" {
+			token.ExpiresAt = nil
+		} else {
+			t, err := time.Parse(time.RFC3339, *payload.ExpiresAt)
+			if err != nil {
+				http.Error(w, "Invalid expires_at format (must be RFC3339): "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			token.ExpiresAt = &t
+		}
+	}
+
+	if err := h.ApiTokenRepo.Update(token); err != nil {
+		http.Error(w, "Failed to update API token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toApiTokenResponseDTO(token))
+}
+
+func (h *ApiTokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := h.sessionUser(w, r)
+	if !ok {
+		return
+	}
+	token, ok := h.ownedToken(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.ApiTokenRepo.Delete(token.ID); err != nil {
+		http.Error(w, "Failed to delete API token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
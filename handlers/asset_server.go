@@ -6,8 +6,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/utils"
 )
 
 // AssetServer creates a handler to serve static files from a specific base directory.
@@ -19,11 +25,44 @@ import (
 //
 // where the route prefix matches the subDir.
 func AssetServer(baseStoragePath, subDir string) http.HandlerFunc {
+	return AssetServerWithOptions(baseStoragePath, subDir, AssetServerOptions{})
+}
+
+// AssetServerOptions adjusts how AssetServerWithOptions serves a kind of asset
+type AssetServerOptions struct {
+	// alternative encodings a JPEG asset may also be stored in, e.g. thumbnails. a request
+	// for "x.jpg" from a client whose Accept header allows one of them is served
+	// "x.<format>" instead, if that file exists.
+	Formats []string
+	// the assets have generated, never reused names, so a URL always returns the same bytes
+	// and browsers may keep them without revalidating
+	Immutable bool
+}
+
+// cache lifetimes of assets whose URL may start returning a newer file, and of immutable ones
+const (
+	assetCacheDuration          = 24 * time.Hour
+	immutableAssetCacheDuration = 365 * 24 * time.Hour
+)
+
+// negotiableFormats lists the image formats a JPEG asset may be swapped for, most
+// compact first
+var negotiableFormats = []struct {
+	format    string
+	mediaType string
+}{
+	{config.ThumbnailFormatAVIF, "image/avif"},
+	{config.ThumbnailFormatWebP, "image/webp"},
+}
+
+// AssetServerWithOptions is AssetServer with the behaviour adjusted by opts. every response
+// carries an ETag and Last-Modified, so conditional requests are answered with 304.
+func AssetServerWithOptions(baseStoragePath, subDir string, opts AssetServerOptions) http.HandlerFunc {
 	fullAssetDirPath := filepath.Join(baseStoragePath, subDir)
 	fullAssetDirPath = filepath.Clean(fullAssetDirPath)
 	log.Printf("Serving assets for '/%s/*' from directory: %s", subDir, fullAssetDirPath)
 
-	if !strings.HasPrefix(fullAssetDirPath, baseStoragePath) {
+	if !utils.IsWithin(baseStoragePath, fullAssetDirPath) {
 		log.Fatalf("FATAL: Asset subdirectory '%s' resolved outside base storage path '%s'. Resolved path: '%s'", subDir, baseStoragePath, fullAssetDirPath)
 	}
 
@@ -32,22 +71,14 @@ func AssetServer(baseStoragePath, subDir string) http.HandlerFunc {
 		routePrefix := "/api/" + subDir + "/"
 		relativePath := strings.TrimPrefix(r.URL.Path, routePrefix)
 
-		if relativePath == "" || strings.Contains(relativePath, "..") {
+		cleanedAssetPath, err := utils.SecureJoin(fullAssetDirPath, relativePath)
+		if err != nil || cleanedAssetPath == fullAssetDirPath {
 			http.Error(w, "Invalid asset path", http.StatusBadRequest)
 			return
 		}
 
-		requestedAssetPath := filepath.Join(fullAssetDirPath, relativePath)
-		cleanedAssetPath := filepath.Clean(requestedAssetPath)
-
-		if !strings.HasPrefix(cleanedAssetPath, fullAssetDirPath) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			log.Printf("SECURITY: Attempted asset access outside designated directory: Request='%s', Resolved='%s', Allowed Base='%s'",
-				r.URL.Path, cleanedAssetPath, fullAssetDirPath)
-			return
-		}
-
-		if _, err := os.Stat(cleanedAssetPath); os.IsNotExist(err) {
+		info, err := os.Stat(cleanedAssetPath)
+		if os.IsNotExist(err) {
 			http.NotFound(w, r)
 			// log.Printf("Asset not found: %s", cleanedAssetPath) // less verbose logging for 404
 			return
@@ -57,10 +88,101 @@ func AssetServer(baseStoragePath, subDir string) http.HandlerFunc {
 			return
 		}
 
-		cacheDuration := 24 * time.Hour
-		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cacheDuration.Seconds())))
-		w.Header().Set("Expires", time.Now().Add(cacheDuration).Format(http.TimeFormat))
+		if len(opts.Formats) > 0 && strings.EqualFold(filepath.Ext(cleanedAssetPath), media.ThumbnailFileExtension) {
+			// caches must keep a copy per Accept header
+			w.Header().Add("Vary", "Accept")
+			if negotiatedPath := negotiateAssetFormat(cleanedAssetPath, opts.Formats, r.Header.Get("Accept")); negotiatedPath != cleanedAssetPath {
+				if negotiatedInfo, err := os.Stat(negotiatedPath); err == nil {
+					cleanedAssetPath, info = negotiatedPath, negotiatedInfo
+				}
+			}
+		}
 
+		setAssetCacheHeaders(w, info, opts.Immutable)
 		http.ServeFile(w, r, cleanedAssetPath)
 	}
 }
+
+// assetETag returns a strong ETag for a file. size and modification time change whenever
+// the file is replaced, so it needn't be read.
+func assetETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// setAssetCacheHeaders sets the caching headers of a file about to be served with
+// http.ServeFile, which answers If-None-Match and If-Modified-Since from them
+func setAssetCacheHeaders(w http.ResponseWriter, info os.FileInfo, immutable bool) {
+	w.Header().Set("ETag", assetETag(info))
+
+	cacheDuration := assetCacheDuration
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(cacheDuration.Seconds()))
+	if immutable {
+		cacheDuration = immutableAssetCacheDuration
+		cacheControl = fmt.Sprintf("public, max-age=%d, immutable", int(cacheDuration.Seconds()))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Expires", time.Now().Add(cacheDuration).Format(http.TimeFormat))
+}
+
+// negotiateAssetFormat returns the path of the best alternative format of a JPEG asset the
+// client accepts, or jpegPath if there is none
+func negotiateAssetFormat(jpegPath string, formats []string, accept string) string {
+	for _, candidate := range negotiableFormats {
+		if !slices.Contains(formats, candidate.format) || !acceptsMediaType(accept, candidate.mediaType) {
+			continue
+		}
+		alternativePath := media.ThumbnailFormatPath(jpegPath, candidate.format)
+		if _, err := os.Stat(alternativePath); err == nil {
+			return alternativePath
+		}
+	}
+	return jpegPath
+}
+
+// acceptsMediaType reports whether an Accept header explicitly lists mediaType with a
+// non-zero quality. wildcards don't count, browsers send "*/*" whatever they support.
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), mediaType) {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// PresignedAssetServer creates a handler for assets kept in object storage. instead of
+// proxying the bytes it redirects the client to a short-lived presigned URL.
+// the route prefix must match the subDir, same as AssetServer.
+func PresignedAssetServer(presigner media.Presigner, subDir string, expiry time.Duration) http.HandlerFunc {
+	log.Printf("Serving assets for '/%s/*' via presigned object storage URLs (expiry: %s)", subDir, expiry)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		routePrefix := "/api/" + subDir + "/"
+		relativePath := strings.TrimPrefix(r.URL.Path, routePrefix)
+
+		if relativePath == "" || strings.Contains(relativePath, "..") {
+			http.Error(w, "Invalid asset path", http.StatusBadRequest)
+			return
+		}
+
+		signedURL, err := presigner.PresignGet(subDir+"/"+relativePath, expiry)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			log.Printf("Error presigning asset %s/%s: %v", subDir, relativePath, err)
+			return
+		}
+
+		// cache the redirect for less than the URL lifetime so clients never follow an expired link
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(expiry.Seconds()/2)))
+		http.Redirect(w, r, signedURL, http.StatusFound)
+	}
+}
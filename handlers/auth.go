@@ -4,14 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/camden-git/mediasysbackend/config"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/webhooks"
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -24,10 +28,14 @@ type AuthHandler struct {
 	UserRepo       repository.UserRepository
 	InviteCodeRepo repository.InviteCodeRepository
 	Cfg            config.Config
+	Webhooks       *webhooks.Dispatcher      // sends user.registered
+	Verification   *EmailVerificationHandler // emails confirmation links to new users
+	LoginGuard     *LoginGuard               // delays and locks out repeated failed logins, nil disables it
+	Quota          *UploadQuota              // reports the user's upload usage on /auth/me
 }
 
-func NewAuthHandler(userRepo repository.UserRepository, inviteCodeRepo repository.InviteCodeRepository, cfg config.Config) *AuthHandler {
-	return &AuthHandler{UserRepo: userRepo, InviteCodeRepo: inviteCodeRepo, Cfg: cfg}
+func NewAuthHandler(userRepo repository.UserRepository, inviteCodeRepo repository.InviteCodeRepository, cfg config.Config, dispatcher *webhooks.Dispatcher, verification *EmailVerificationHandler, loginGuard *LoginGuard, quota *UploadQuota) *AuthHandler {
+	return &AuthHandler{UserRepo: userRepo, InviteCodeRepo: inviteCodeRepo, Cfg: cfg, Webhooks: dispatcher, Verification: verification, LoginGuard: loginGuard, Quota: quota}
 }
 
 type LoginPayload struct {
@@ -68,16 +76,24 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	user, err := h.UserRepo.GetByUsername(payload.Username)
-	if err != nil {
-		WriteAPIError(w, http.StatusUnauthorized, "DisplayException", "No account matching those credentials could be found.")
+	ip := remoteIP(r)
+	if lockedUntil := h.LoginGuard.LockedUntil(payload.Username, ip); !lockedUntil.IsZero() {
+		retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		WriteAPIError(w, http.StatusTooManyRequests, "AccountLockedException", fmt.Sprintf("Too many failed logins. Please try again in %d minute(s).", (retryAfter+59)/60))
 		return
 	}
 
-	if !user.CheckPassword(payload.Password) {
+	user, err := h.UserRepo.GetByUsername(payload.Username)
+	if err != nil || !user.CheckPassword(payload.Password) {
+		time.Sleep(h.LoginGuard.RecordFailure(payload.Username, ip))
 		WriteAPIError(w, http.StatusUnauthorized, "DisplayException", "No account matching those credentials could be found.")
 		return
 	}
+	h.LoginGuard.RecordSuccess(payload.Username)
 
 	expirationTime := time.Now().Add(jwtExpirationHours * time.Hour)
 	claims := &jwt.RegisteredClaims{
@@ -167,6 +183,37 @@ type RegisterPayload struct {
 	InviteCode string `json:"invite_code"`
 	FirstName  string `json:"first_name"`
 	LastName   string `json:"last_name"`
+	Email      string `json:"email"` // optional unless the invite is bound to an address
+}
+
+// InviteLookupResponse tells the registration page about an invite code
+type InviteLookupResponse struct {
+	Valid     bool    `json:"valid"`
+	Email     *string `json:"email,omitempty"` // the address registration must use, only set for bound invites
+	BindEmail bool    `json:"bind_email"`
+	ExpiresAt *string `json:"expires_at,omitempty"`
+}
+
+// GetInvite checks an invite code before registering. the registration page calls this
+// when opened from an invite email, which is recorded as the invite being opened.
+func (h *AuthHandler) GetInvite(w http.ResponseWriter, r *http.Request) {
+	inviteCode, err := h.InviteCodeRepo.GetByCode(chi.URLParam(r, "code"))
+	if err != nil || !inviteCode.IsValid() {
+		WriteAPIError(w, http.StatusNotFound, "InviteCodeException", "Invalid or expired invite code")
+		return
+	}
+	if inviteCode.Email != nil {
+		if err := h.InviteCodeRepo.MarkOpened(inviteCode.ID); err != nil {
+			fmt.Printf("Failed to record invite code %d as opened: %v\n", inviteCode.ID, err)
+		}
+	}
+
+	response := InviteLookupResponse{Valid: true, BindEmail: inviteCode.BindEmail, ExpiresAt: formatOptionalTime(inviteCode.ExpiresAt)}
+	if inviteCode.BindEmail {
+		response.Email = inviteCode.Email
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // Register handles new user registration using an invitation code
@@ -193,10 +240,41 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	emailAddress, err := normalizeEmail(payload.Email)
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", err.Error())
+		return
+	}
+	var emailVerifiedAt *time.Time
+	if inviteCode.BindEmail && inviteCode.Email != nil {
+		// a bound invite can only be redeemed with the address it was sent to, which receiving
+		// the code also confirms
+		if emailAddress != nil && *emailAddress != *inviteCode.Email {
+			WriteAPIError(w, http.StatusForbidden, "InviteCodeException", "This invite code was issued for a different email address")
+			return
+		}
+		emailAddress = inviteCode.Email
+		now := time.Now()
+		emailVerifiedAt = &now
+	}
+	if emailAddress == nil && h.Cfg.EmailVerificationRequired {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", "An email address is required")
+		return
+	}
+	if taken, err := emailTaken(h.UserRepo, emailAddress, 0); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to check email address: "+err.Error())
+		return
+	} else if taken {
+		WriteAPIError(w, http.StatusConflict, "DisplayException", "An account with this email address already exists.")
+		return
+	}
+
 	newUser := &models.User{
 		Username:          payload.Username,
 		FirstName:         payload.FirstName,
 		LastName:          payload.LastName,
+		Email:             emailAddress,
+		EmailVerifiedAt:   emailVerifiedAt,
 		GlobalPermissions: []string{},
 	}
 	if err := newUser.SetPassword(payload.Password); err != nil {
@@ -212,6 +290,23 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if err := h.InviteCodeRepo.IncrementUses(inviteCode.ID); err != nil {
 		fmt.Printf("CRITICAL: User %s created but failed to increment uses for invite code %s (ID: %d): %v\n", newUser.Username, inviteCode.Code, inviteCode.ID, err)
 	}
+	if err := h.InviteCodeRepo.MarkRedeemed(inviteCode.ID, newUser.ID); err != nil {
+		fmt.Printf("Failed to record invite code %d as redeemed: %v\n", inviteCode.ID, err)
+	}
+
+	if newUser.HasUnverifiedEmail() && h.Verification != nil {
+		if err := h.Verification.SendVerification(newUser); err != nil {
+			fmt.Printf("Failed to send email verification to user %s: %v\n", newUser.Username, err)
+		}
+	}
+
+	h.Webhooks.Emit(models.WebhookEventUserRegistered, map[string]interface{}{
+		"user_id":        newUser.ID,
+		"username":       newUser.Username,
+		"first_name":     newUser.FirstName,
+		"last_name":      newUser.LastName,
+		"invite_code_id": inviteCode.ID,
+	})
 
 	// TODO: deactivate invite code if it reached max uses after this increment
 	// this requires fetching the code again to check current uses vs max_uses
@@ -226,6 +321,14 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully. Please discard your token."})
 }
 
+// currentUserResponse is the /auth/me payload, the user plus links to their avatar and how
+// much they have uploaded
+type currentUserResponse struct {
+	models.User
+	AvatarURLs  map[string]string `json:"avatar_urls,omitempty"`
+	UploadUsage *UploadQuotaUsage `json:"upload_usage,omitempty"`
+}
+
 // CurrentUser retrieves the authenticated user from the request context
 func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(UserContextKey).(*models.User)
@@ -235,9 +338,134 @@ func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userForResponse := *user
+	userForResponse := currentUserResponse{User: *user, AvatarURLs: avatarURLs(user.AvatarPath)}
 	userForResponse.PasswordHash = ""
+	if h.Quota != nil {
+		if usage, err := h.Quota.Usage(user); err == nil {
+			userForResponse.UploadUsage = &usage
+		} else {
+			fmt.Printf("Failed to load upload usage of user %d: %v\n", user.ID, err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(userForResponse)
 }
+
+// ProfileUpdatePayload is the body of PUT /api/auth/me. omitted fields are left unchanged;
+// changing the email address or password requires the current password.
+type ProfileUpdatePayload struct {
+	FirstName       *string `json:"first_name,omitempty"`
+	LastName        *string `json:"last_name,omitempty"`
+	Email           *string `json:"email,omitempty"` // an empty string removes the address
+	NewPassword     *string `json:"new_password,omitempty"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// UpdateCurrentUser lets the authenticated user edit their own profile. unlike the admin
+// user edit it can't touch usernames, roles or permissions.
+func (h *AuthHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	current := currentUser(r)
+	if current == nil {
+		WriteAPIError(w, http.StatusUnauthorized, "AuthenticationException", "Authentication required")
+		return
+	}
+	if current.APIToken != nil {
+		WriteAPIError(w, http.StatusForbidden, "AuthorizationException", "Profile changes can't be made with an API token")
+		return
+	}
+
+	var payload ProfileUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Invalid request payload")
+		return
+	}
+
+	user := *current
+	if payload.FirstName != nil {
+		if strings.TrimSpace(*payload.FirstName) == "" {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", "first_name can't be empty")
+			return
+		}
+		user.FirstName = strings.TrimSpace(*payload.FirstName)
+	}
+	if payload.LastName != nil {
+		if strings.TrimSpace(*payload.LastName) == "" {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", "last_name can't be empty")
+			return
+		}
+		user.LastName = strings.TrimSpace(*payload.LastName)
+	}
+
+	var emailAddress *string
+	emailChanged := false
+	if payload.Email != nil {
+		var err error
+		emailAddress, err = normalizeEmail(*payload.Email)
+		if err != nil {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", err.Error())
+			return
+		}
+		emailChanged = (emailAddress == nil) != (user.Email == nil) || (emailAddress != nil && *emailAddress != *user.Email)
+		if emailAddress == nil && h.Cfg.EmailVerificationRequired {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", "An email address is required")
+			return
+		}
+	}
+	if payload.NewPassword != nil && *payload.NewPassword == "" {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", "new_password can't be empty")
+		return
+	}
+
+	if emailChanged || payload.NewPassword != nil {
+		// the current password is checked like a login so a stolen session can't be used to
+		// guess it
+		ip := remoteIP(r)
+		if lockedUntil := h.LoginGuard.LockedUntil(user.Username, ip); !lockedUntil.IsZero() {
+			WriteAPIError(w, http.StatusTooManyRequests, "AccountLockedException", "Too many failed attempts. Please try again later.")
+			return
+		}
+		if payload.CurrentPassword == "" {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", "current_password is required to change your email address or password")
+			return
+		}
+		if !user.CheckPassword(payload.CurrentPassword) {
+			time.Sleep(h.LoginGuard.RecordFailure(user.Username, ip))
+			WriteAPIError(w, http.StatusForbidden, "DisplayException", "Your current password is incorrect.")
+			return
+		}
+	}
+
+	if emailChanged {
+		if taken, err := emailTaken(h.UserRepo, emailAddress, user.ID); err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to check email address: "+err.Error())
+			return
+		} else if taken {
+			WriteAPIError(w, http.StatusConflict, "DisplayException", "An account with this email address already exists.")
+			return
+		}
+		user.Email = emailAddress
+		user.EmailVerifiedAt = nil // a new address has to be confirmed again
+	}
+	if payload.NewPassword != nil {
+		if err := user.SetPassword(*payload.NewPassword); err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "HashingException", "Failed to hash password: "+err.Error())
+			return
+		}
+	}
+
+	if err := h.UserRepo.Update(&user); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to update profile: "+err.Error())
+		return
+	}
+
+	if emailChanged && user.Email != nil && h.Verification != nil {
+		if err := h.Verification.SendVerification(&user); err != nil {
+			fmt.Printf("Failed to send email verification to user %s: %v\n", user.Username, err)
+		}
+	}
+
+	userForResponse := currentUserResponse{User: user, AvatarURLs: avatarURLs(user.AvatarPath)}
+	userForResponse.PasswordHash = ""
+	writeJSON(w, http.StatusOK, userForResponse)
+}
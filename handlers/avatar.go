@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const maxAvatarUploadSize = 10 << 20 // 10 MB
+
+// AvatarHandler manages the profile pictures of users
+type AvatarHandler struct {
+	UserRepo       repository.UserRepository
+	MediaProcessor *media.Processor
+}
+
+func NewAvatarHandler(userRepo repository.UserRepository, mediaProcessor *media.Processor) *AvatarHandler {
+	return &AvatarHandler{UserRepo: userRepo, MediaProcessor: mediaProcessor}
+}
+
+// avatarURLs maps each avatar size to the URL it is served at, or returns nil for users
+// without an avatar
+func avatarURLs(avatarPath *string) map[string]string {
+	if avatarPath == nil || *avatarPath == "" {
+		return nil
+	}
+	urls := make(map[string]string, len(media.AvatarSizes))
+	for _, size := range media.AvatarSizes {
+		// avatars are exposed under /api/<avatarsSubDir>/<filename>
+		urls[strconv.Itoa(size)] = "/api/" + media.AvatarSizePath(*avatarPath, size)
+	}
+	return urls
+}
+
+func avatarResponse(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"avatar_path": user.AvatarPath,
+		"avatar_urls": avatarURLs(user.AvatarPath),
+	}
+}
+
+// UploadAvatar handles PUT /api/auth/me/avatar with the image in the "avatar" form field
+func (h *AvatarHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		WriteAPIError(w, http.StatusUnauthorized, "AuthenticationException", "Authentication required")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxAvatarUploadSize); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Invalid form data: "+err.Error())
+		return
+	}
+	file, fileHeader, err := r.FormFile("avatar")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			WriteAPIError(w, http.StatusBadRequest, "ValidationException", "No file uploaded in 'avatar' field")
+		} else {
+			WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Could not retrieve uploaded file")
+		}
+		return
+	}
+	defer file.Close()
+
+	log.Printf("Received avatar upload for user %d: %s (Size: %d)", user.ID, fileHeader.Filename, fileHeader.Size)
+
+	savedRelPath, err := h.MediaProcessor.ProcessAvatar(file)
+	if err != nil {
+		log.Printf("Error processing avatar for user %d: %v", user.ID, err)
+		WriteAPIError(w, http.StatusBadRequest, "DisplayException", "The uploaded file could not be read as an image.")
+		return
+	}
+
+	oldAvatarPath := user.AvatarPath
+	updated := *user
+	updated.AvatarPath = &savedRelPath
+	if err := h.UserRepo.Update(&updated); err != nil {
+		if delErr := h.MediaProcessor.DeleteAvatar(savedRelPath); delErr != nil {
+			log.Printf("Warning: Failed to delete avatar %s after DB update failure: %v", savedRelPath, delErr)
+		}
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to save avatar: "+err.Error())
+		return
+	}
+	h.removeFiles(oldAvatarPath)
+
+	writeJSON(w, http.StatusOK, avatarResponse(&updated))
+}
+
+// DeleteAvatar handles DELETE /api/auth/me/avatar
+func (h *AvatarHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		WriteAPIError(w, http.StatusUnauthorized, "AuthenticationException", "Authentication required")
+		return
+	}
+	if err := h.clearAvatar(user); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to remove avatar: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminDeleteAvatar handles DELETE /api/admin/users/{id}/avatar, for removing inappropriate
+// pictures
+func (h *AvatarHandler) AdminDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+	user, err := h.UserRepo.GetByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.clearAvatar(user); err != nil {
+		http.Error(w, "Failed to remove avatar: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearAvatar unsets the avatar of a user and removes its files
+func (h *AvatarHandler) clearAvatar(user *models.User) error {
+	if user.AvatarPath == nil {
+		return nil
+	}
+	oldAvatarPath := user.AvatarPath
+	updated := *user
+	updated.AvatarPath = nil
+	if err := h.UserRepo.Update(&updated); err != nil {
+		return err
+	}
+	h.removeFiles(oldAvatarPath)
+	return nil
+}
+
+// removeFiles deletes the files of a replaced or removed avatar. failures only leave
+// orphaned files behind, so they are logged and otherwise ignored.
+func (h *AvatarHandler) removeFiles(avatarPath *string) {
+	if avatarPath == nil || *avatarPath == "" {
+		return
+	}
+	if err := h.MediaProcessor.DeleteAvatar(*avatarPath); err != nil {
+		log.Printf("Warning: Failed to remove old avatar %s: %v", *avatarPath, err)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/andybalholm/brotli"
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// compressedContentTypes are the responses worth compressing. images, videos and zips are
+// compressed already and are sent as they are.
+var compressedContentTypes = []string{
+	"application/json",
+	"application/atom+xml",
+	"application/rss+xml",
+	"application/xml",
+	"text/html",
+	"text/plain",
+	"text/css",
+	"text/javascript",
+	"text/xml",
+	"image/svg+xml",
+}
+
+// CompressMiddleware compresses the responses of compressedContentTypes with brotli when the
+// client accepts it and gzip otherwise, at cfg.CompressionLevel. directory listings and
+// album contents with thousands of entries shrink to a fraction. returns a pass-through
+// middleware when the level is 0.
+func CompressMiddleware(cfg config.Config) func(http.Handler) http.Handler {
+	if cfg.CompressionLevel == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	compressor := middleware.NewCompressor(cfg.CompressionLevel, compressedContentTypes...)
+	// registered last, so it takes precedence over gzip
+	compressor.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
+	})
+	return compressor.Handler
+}
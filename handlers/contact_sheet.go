@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/utils"
+	"github.com/camden-git/mediasysbackend/workers"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// RequestAlbumContactSheet queues the generation of the contact sheet of an album, a PDF of
+// its thumbnails with their filenames for clients proofing it
+func (ah *AlbumHandler) RequestAlbumContactSheet(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "id")
+
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error finding album '%s' for contact sheet request: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to find album"})
+		}
+		return
+	}
+
+	if album.ContactSheetStatus == database.StatusPending || album.ContactSheetStatus == database.StatusProcessing {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Album contact sheet generation is already pending or processing."})
+		return
+	}
+
+	if err := ah.AlbumRepo.RequestContactSheet(album.ID); err != nil {
+		log.Printf("Error marking album contact sheet pending for ID %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to request contact sheet generation"})
+		return
+	}
+
+	job := workers.ImageJob{
+		AlbumID:     int64(album.ID),
+		TaskType:    workers.TaskAlbumContactSheet,
+		ModTimeUnix: time.Now().Unix(),
+	}
+	if !ah.ThumbGen.QueueJob(job) {
+		log.Printf("Failed to queue album contact sheet job for Album ID %d (queue full or already pending).", album.ID)
+		if err := ah.AlbumRepo.SetContactSheetResult(album.ID, nil, errors.New("processing queue is full")); err != nil {
+			log.Printf("Error resetting album contact sheet status for ID %d: %v", album.ID, err)
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Failed to queue contact sheet generation: processing queue is full."})
+		return
+	}
+
+	log.Printf("Album contact sheet generation requested and queued for Album ID: %d", album.ID)
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Album contact sheet generation request accepted and queued."})
+}
+
+// DownloadAlbumContactSheet serves the last generated contact sheet of an album
+func (ah *AlbumHandler) DownloadAlbumContactSheet(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "id")
+
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.NotFound(w, r)
+		} else {
+			log.Printf("Error finding album '%s' for contact sheet download: %v", identifier, err)
+			http.Error(w, "Failed to find album", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// a regenerating or failed sheet leaves the previous one in place, but a stale sheet
+	// handed out as current would be proofed against the wrong files
+	if album.ContactSheetStatus != database.StatusDone || album.ContactSheetPath == nil || *album.ContactSheetPath == "" {
+		if album.ContactSheetStatus == database.StatusPending || album.ContactSheetStatus == database.StatusProcessing {
+			http.Error(w, "Contact sheet is currently being generated. Please try again later.", http.StatusAccepted)
+		} else if album.ContactSheetStatus == database.StatusError && album.ContactSheetError != nil {
+			http.Error(w, fmt.Sprintf("Contact sheet generation failed: %s", *album.ContactSheetError), http.StatusConflict)
+		} else {
+			http.Error(w, "Contact sheet not available for this album or not yet generated.", http.StatusNotFound)
+		}
+		return
+	}
+
+	if ah.redirectToPresignedAsset(w, r, *album.ContactSheetPath) {
+		return
+	}
+
+	fullSheetPath := filepath.Clean(filepath.Join(ah.Cfg.MediaStoragePath, *album.ContactSheetPath))
+	if !utils.IsWithin(ah.Cfg.MediaStoragePath, fullSheetPath) {
+		log.Printf("SECURITY: Attempt to download contact sheet outside media storage: %s (resolved from %s)", fullSheetPath, *album.ContactSheetPath)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	file, err := os.Open(fullSheetPath)
+	if os.IsNotExist(err) {
+		log.Printf("Contact sheet %s (from DB path %s) not found on disk. Inconsistency.", fullSheetPath, *album.ContactSheetPath)
+		http.Error(w, "Contact sheet file not found on server.", http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		log.Printf("Error opening contact sheet %s: %v", fullSheetPath, err)
+		http.Error(w, "Failed to access contact sheet.", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		log.Printf("Error stating contact sheet %s: %v", fullSheetPath, err)
+		http.Error(w, "Failed to get contact sheet info.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_contact_sheet.pdf\"", album.Slug))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("ETag", assetETag(fileInfo))
+	http.ServeContent(w, r, "", fileInfo.ModTime(), file)
+}
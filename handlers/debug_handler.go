@@ -7,12 +7,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/camden-git/mediasysbackend/config"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
 	"github.com/camden-git/mediasysbackend/workers"
 )
 
@@ -45,14 +44,12 @@ func (dh *DebugHandler) QueueFaceDetection(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	cleanRelativePath := filepath.Clean(decodedPath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
+	dbPath, err := utils.CleanRelPath(decodedPath)
+	if err != nil {
 		http.Error(w, "Invalid path: must be relative, no '..'", http.StatusBadRequest)
 		return
 	}
-
-	dbPath := filepath.ToSlash(cleanRelativePath)
-	fullPath := filepath.Join(dh.Cfg.RootDirectory, dbPath)
+	fullPath := dh.Cfg.ResolvePath(dbPath)
 
 	response := QueueDetectionResponse{
 		Success:   false,
@@ -139,14 +136,12 @@ func (dh *DebugHandler) GetDetectionStatus(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	cleanRelativePath := filepath.Clean(decodedPath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
+	dbPath, err := utils.CleanRelPath(decodedPath)
+	if err != nil {
 		http.Error(w, "Invalid path: must be relative, no '..'", http.StatusBadRequest)
 		return
 	}
 
-	dbPath := filepath.ToSlash(cleanRelativePath)
-
 	// Get image record
 	image, err := dh.ImageRepo.GetByPath(dbPath)
 	if err != nil {
@@ -8,8 +8,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/camden-git/mediasysbackend/config"
@@ -17,6 +20,7 @@ import (
 	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
 	"github.com/camden-git/mediasysbackend/workers"
 	"github.com/facette/natsort"
 	"gorm.io/gorm"
@@ -41,29 +45,80 @@ type FileInfo struct {
 	CameraMake      *string  `json:"camera_make,omitempty"`
 	CameraModel     *string  `json:"camera_model,omitempty"`
 	TakenAt         *int64   `json:"taken_at,omitempty"`
+	Latitude        *float64 `json:"latitude,omitempty"`
+	Longitude       *float64 `json:"longitude,omitempty"`
+	Altitude        *float64 `json:"altitude,omitempty"`
+	Location        *string  `json:"location,omitempty"`
+	Description     *string  `json:"description,omitempty"`
+	Title           *string  `json:"title,omitempty"`
+	Copyright       *string  `json:"copyright,omitempty"`
+	License         *string  `json:"license,omitempty"`
+	Favorite        bool     `json:"favorite,omitempty"` // the authenticated user's, in album contents
+	Rating          int      `json:"rating,omitempty"`
+	StackID         *string  `json:"stack_id,omitempty"`
+	StackBest       bool     `json:"stack_best,omitempty"`
+	StackSize       int      `json:"stack_size,omitempty"`
 	ThumbnailStatus string   `json:"thumbnail_status,omitempty"`
 	MetadataStatus  string   `json:"metadata_status,omitempty"`
 	DetectionStatus string   `json:"detection_status,omitempty"`
+
+	// video entries
+	MediaType       string   `json:"media_type,omitempty"`
+	Duration        *float64 `json:"duration,omitempty"`
+	VideoCodec      *string  `json:"video_codec,omitempty"`
+	AudioCodec      *string  `json:"audio_codec,omitempty"`
+	Bitrate         *int64   `json:"bitrate,omitempty"` // bits per second
+	RenditionPath   *string  `json:"rendition_path,omitempty"`
+	TranscodeStatus string   `json:"transcode_status,omitempty"`
+	StreamPath      *string  `json:"stream_path,omitempty"` // HLS master playlist of long videos
+
+	// the video of a Live Photo, on its still, which album contents list in place of both
+	LivePhotoPath          *string `json:"live_photo_path,omitempty"`
+	LivePhotoRenditionPath *string `json:"live_photo_rendition_path,omitempty"`
+
+	// GPano projection of spherical images clients render in a panorama viewer, e.g. "equirectangular"
+	Projection *string `json:"projection,omitempty"`
+
+	// thumbnail URLs by longest side in pixels, for picking a resolution like srcset
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+	// blurhash of the thumbnail, rendered as a placeholder until it loads
+	Blurhash *string `json:"blurhash,omitempty"`
+	// resized copies of images, with w, h and fit params appended to it
+	ResizeURL string `json:"resize_url,omitempty"`
 }
 
 type DirectoryListing struct {
-	Path   string     `json:"path"`
-	Files  []FileInfo `json:"files"`
-	Parent string     `json:"parent,omitempty"`
-    Total  int        `json:"total,omitempty"`
-    Offset int        `json:"offset,omitempty"`
-    Limit  int        `json:"limit,omitempty"`
-    HasMore bool      `json:"has_more,omitempty"`
+	Path       string     `json:"path"`
+	Files      []FileInfo `json:"files"`
+	Parent     string     `json:"parent,omitempty"`
+	Total      int        `json:"total,omitempty"`
+	Offset     int        `json:"offset,omitempty"`
+	Limit      int        `json:"limit,omitempty"`
+	HasMore    bool       `json:"has_more,omitempty"`
+	NextCursor string     `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
 }
 
 const thumbnailApiPrefix = "/thumbnails/"
 
+// thumbnailURLs maps each extra thumbnail size of an image to the URL it is served at
+func thumbnailURLs(img *models.Image, cfg config.Config) map[string]string {
+	if len(img.ThumbnailSizes) == 0 || img.ThumbnailStatus != database.StatusDone {
+		return nil
+	}
+	urls := make(map[string]string, len(img.ThumbnailSizes))
+	for size, sizePath := range img.ThumbnailSizes {
+		urls[strconv.Itoa(size)] = thumbnailURL(cfg, sizePath)
+	}
+	return urls
+}
+
 type entryInfo struct {
 	entry fs.DirEntry
 	info  fs.FileInfo
 	err   error
 	imageInfo *models.Image
 	takenAt   *int64
+	stackSize int // frames of the burst stack the entry stands for, see collapseStacks
 }
 
 // DirectoryHandler now accepts repositories
@@ -77,14 +132,19 @@ func DirectoryHandler(cfg config.Config, imgRepo repository.ImageRepositoryInter
 		} else {
 			actualContentPath = rawRequestedPath
 		}
+		// ignored files are served as if they didn't exist
+		if cfg.IsIgnoredPath(actualContentPath) {
+			http.NotFound(w, r)
+			return
+		}
 
 		if actualContentPath != "/" && !strings.HasSuffix(actualContentPath, "/") {
-			potentialFullPath := filepath.Join(cfg.RootDirectory, actualContentPath)
+			potentialFullPath := cfg.ResolvePath(actualContentPath)
 			potentialFullPath = filepath.Clean(potentialFullPath)
 
-			if !strings.HasPrefix(potentialFullPath, cfg.RootDirectory) && potentialFullPath != cfg.RootDirectory {
+			if library, _ := cfg.SplitPath(actualContentPath); !utils.IsWithin(library.Path, potentialFullPath) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
-				log.Printf("Attempted access outside root directory (pre-stat): Request='%s', Resolved='%s', Root='%s'", actualContentPath, potentialFullPath, cfg.RootDirectory)
+				log.Printf("Attempted access outside root directory (pre-stat): Request='%s', Resolved='%s', Root='%s'", actualContentPath, potentialFullPath, library.Path)
 				return
 			}
 
@@ -104,7 +164,7 @@ func DirectoryHandler(cfg config.Config, imgRepo repository.ImageRepositoryInter
 			return
 		}
 
-		fullPath := filepath.Join(cfg.RootDirectory, actualContentPath)
+		fullPath := cfg.ResolvePath(actualContentPath)
 		fullPath = filepath.Clean(fullPath)
 		serveFileOrDirectory(w, r, cfg, imgRepo, imgProc, actualContentPath, fullPath)
 	}
@@ -112,13 +172,22 @@ func DirectoryHandler(cfg config.Config, imgRepo repository.ImageRepositoryInter
 
 func serveFileOrDirectory(w http.ResponseWriter, r *http.Request, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor, requestedPath, fullPath string) {
 	cleanedFullPath := filepath.Clean(fullPath)
-	if !strings.HasPrefix(cleanedFullPath, cfg.RootDirectory) {
-		isRootItself := cleanedFullPath == filepath.Clean(cfg.RootDirectory)
-		if !isRootItself {
+	library, _ := cfg.SplitPath(requestedPath)
+	if !utils.IsWithin(library.Path, cleanedFullPath) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		log.Printf("Attempted access outside root directory: Request='%s', Resolved='%s', Cleaned='%s', Root='%s'", requestedPath, fullPath, cleanedFullPath, library.Path)
+		return
+	}
+
+	if err := cfg.CheckSymlinks(cleanedFullPath); err != nil {
+		if os.IsPermission(err) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
-			log.Printf("Attempted access outside root directory: Request='%s', Resolved='%s', Cleaned='%s', Root='%s'", requestedPath, fullPath, cleanedFullPath, cfg.RootDirectory)
-			return
+			log.Printf("Attempted access through a symlink outside the symlink policy: Request='%s', Resolved='%s'", requestedPath, cleanedFullPath)
+		} else {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			log.Printf("Error resolving symlinks of %s: %v", cleanedFullPath, err)
 		}
+		return
 	}
 
 	fileInfo, err := os.Stat(cleanedFullPath)
@@ -134,11 +203,26 @@ func serveFileOrDirectory(w http.ResponseWriter, r *http.Request, cfg config.Con
 	}
 
 	if !fileInfo.IsDir() {
-		http.ServeFile(w, r, cleanedFullPath)
+		download, err := parseImageDownload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		download.rights = downloadRights(cfg, imgRepo, nil)
+		if err := serveDownloadFile(w, r, cfg, cleanedFullPath, fileInfo, download); err != nil {
+			log.Printf("Error preparing download of %s: %v", cleanedFullPath, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	offset, limit, err := parsePageParams(r, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-    fileInfos, totalCount, err := listDirectoryContents(cleanedFullPath, requestedPath, cfg, imgRepo, imgProc, database.DefaultSortOrder, -1, -1)
+	fileInfos, totalCount, err := listDirectoryContents(cleanedFullPath, requestedPath, cfg, imgRepo, imgProc, database.DefaultSortOrder, offset, limit, hidesNSFW(cfg, r), false)
 	if err != nil {
 		if os.IsPermission(err) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
@@ -149,14 +233,11 @@ func serveFileOrDirectory(w http.ResponseWriter, r *http.Request, cfg config.Con
 		return
 	}
 
-    listing := DirectoryListing{
-        Path:   requestedPath,
-        Files:  fileInfos,
-        Total:  totalCount,
-        Offset: 0,
-        Limit:  len(fileInfos),
-        HasMore: false,
-    }
+	listing := DirectoryListing{
+		Path:  requestedPath,
+		Files: fileInfos,
+	}
+	listing.paginate(offset, limit, totalCount)
 
 	if requestedPath != "/" && requestedPath != "" {
 		parent := filepath.ToSlash(filepath.Dir(strings.TrimSuffix(requestedPath, "/")))
@@ -179,33 +260,100 @@ func serveFileOrDirectory(w http.ResponseWriter, r *http.Request, cfg config.Con
 	}
 }
 
-func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor, sortOrder string, offset int, limit int) ([]FileInfo, int, error) {
+// listDirectoryContents returns a page of the listing of a directory, from the listing cache
+// while the directory is unchanged
+func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor, sortOrder string, offset int, limit int, hideNSFW bool, collapse bool) ([]FileInfo, int, error) {
+	if err := cfg.CheckSymlinks(baseDirFullPath); err != nil {
+		return nil, 0, fmt.Errorf("reading directory %s: %w", baseDirFullPath, err)
+	}
+	if listingCacheTTL(cfg) <= 0 {
+		return assembleDirectoryContents(baseDirFullPath, requestPathPrefix, cfg, imgRepo, imgProc, sortOrder, offset, limit, hideNSFW, collapse)
+	}
+	dirInfo, err := os.Stat(baseDirFullPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading directory %s: %w", baseDirFullPath, err)
+	}
+	key := listingKey{dir: filepath.Clean(baseDirFullPath), prefix: requestPathPrefix, sortOrder: sortOrder, offset: offset, limit: limit, hideNSFW: hideNSFW, collapse: collapse}
+	if files, total, ok := listings.get(cfg, key, dirInfo.ModTime()); ok {
+		return files, total, nil
+	}
+
+	generation := listings.currentGeneration()
+	files, total, err := assembleDirectoryContents(baseDirFullPath, requestPathPrefix, cfg, imgRepo, imgProc, sortOrder, offset, limit, hideNSFW, collapse)
+	if err != nil {
+		return nil, 0, err
+	}
+	if relDir, relErr := cfg.RelativePath(baseDirFullPath); relErr == nil {
+		listings.put(cfg, key, filepath.ToSlash(relDir), dirInfo.ModTime(), files, total, generation)
+	}
+	return files, total, nil
+}
+
+// assembleDirectoryContents lists a directory: it stats the entries, sorts them and builds
+// the FileInfo of those on the page, creating missing image records and queuing their tasks
+func assembleDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor, sortOrder string, offset int, limit int, hideNSFW bool, collapse bool) ([]FileInfo, int, error) {
 	dirEntries, err := os.ReadDir(baseDirFullPath)
 	if err != nil {
         return nil, 0, fmt.Errorf("reading directory %s: %w", baseDirFullPath, err)
 	}
+	dirEntries = slices.DeleteFunc(dirEntries, func(entry fs.DirEntry) bool {
+		if entry.Type()&fs.ModeSymlink != 0 && !cfg.AllowsSymlink(listingEntryPath(baseDirFullPath, entry)) {
+			return true
+		}
+		return cfg.IsIgnored(entry.Name())
+	})
+	if filepath.Clean(baseDirFullPath) == filepath.Clean(cfg.RootDirectory) {
+		dirEntries = append(dirEntries, libraryDirEntries(cfg)...)
+	}
+
+	// load the records of all images, videos and documents in the directory in one query, rather than one per file
+	imagesByPath := make(map[string]*models.Image)
+	if imgRepo != nil {
+		var dbKeys []string
+		for _, entry := range dirEntries {
+			if !media.IsProcessableImage(entry.Name()) && !media.IsVideo(entry.Name()) && !media.IsDocument(entry.Name()) {
+				continue
+			}
+			if relFromRoot, relErr := cfg.RelativePath(listingEntryPath(baseDirFullPath, entry)); relErr == nil {
+				dbKeys = append(dbKeys, filepath.ToSlash(relFromRoot))
+			}
+		}
+		images, err := imgRepo.GetImagesByPaths(dbKeys)
+		if err != nil {
+			return nil, 0, fmt.Errorf("loading image records for %s: %w", baseDirFullPath, err)
+		}
+		for i := range images {
+			imagesByPath[images[i].OriginalPath] = &images[i]
+		}
+	}
 
 	entriesWithInfo := make([]entryInfo, 0, len(dirEntries))
 	for _, entry := range dirEntries {
-		entryFullPath := filepath.Join(baseDirFullPath, entry.Name())
+		entryFullPath := listingEntryPath(baseDirFullPath, entry)
 		info, statErr := os.Stat(entryFullPath)
 
 		var imgInfo *models.Image
 		var taken *int64
 		// preload minimal metadata required for sorting if needed
-		if statErr == nil && info != nil && !info.IsDir() && media.IsRasterImage(entry.Name()) {
+		if statErr == nil && info != nil && !info.IsDir() && (media.IsProcessableImage(entry.Name()) || media.IsVideo(entry.Name()) || media.IsDocument(entry.Name())) {
 			// compute DB key relative to root
-			relFromRoot, relErr := filepath.Rel(cfg.RootDirectory, entryFullPath)
+			relFromRoot, relErr := cfg.RelativePath(entryFullPath)
 			if relErr == nil {
-				dbKey := filepath.ToSlash(relFromRoot)
-				if imgRepo != nil {
-					if ii, getErr := imgRepo.GetByPath(dbKey); getErr == nil && ii != nil {
-						imgInfo = ii
-						taken = ii.TakenAt
-					}
+				if ii, ok := imagesByPath[filepath.ToSlash(relFromRoot)]; ok {
+					imgInfo = ii
+					taken = ii.TakenAt
 				}
 			}
 		}
+		if hideNSFW && imgInfo != nil && imgInfo.IsNSFWHidden() {
+			continue
+		}
+		// the video of a Live Photo is left to its still, when that is listed too
+		if collapse && imgInfo != nil && imgInfo.MediaType == database.MediaTypeVideo && imgInfo.LivePairPath != nil {
+			if _, ok := imagesByPath[*imgInfo.LivePairPath]; ok {
+				continue
+			}
+		}
 
 		entriesWithInfo = append(entriesWithInfo, entryInfo{
 			entry:     entry,
@@ -262,6 +410,16 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 				tj = ej.info.ModTime().Unix()
 			}
 			return ti < tj
+		case database.SortCustom:
+			// positioned files first, in their position order, then the rest by name
+			pi, pj := sortPosition(ei), sortPosition(ej)
+			if pi != nil && pj != nil && *pi != *pj {
+				return *pi < *pj
+			}
+			if (pi == nil) != (pj == nil) {
+				return pi != nil
+			}
+			return strings.ToLower(ei.entry.Name()) < strings.ToLower(ej.entry.Name())
 		case database.SortFilenameNat:
 			// natural sort, case-insensitive
 			return natsort.Compare(strings.ToLower(ei.entry.Name()), strings.ToLower(ej.entry.Name()))
@@ -272,6 +430,9 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 			return strings.ToLower(ei.entry.Name()) < strings.ToLower(ej.entry.Name())
 		}
 	})
+	if collapse {
+		entriesWithInfo = collapseStacks(entriesWithInfo)
+	}
 
     totalCount := len(entriesWithInfo)
 
@@ -294,14 +455,14 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
     for _, ei := range window {
 		// skip entries that had stat errors
 		if ei.err != nil {
-            log.Printf("Error stating directory entry %s: %v. Skipping.", filepath.Join(baseDirFullPath, ei.entry.Name()), ei.err)
+            log.Printf("Error stating directory entry %s: %v. Skipping.", listingEntryPath(baseDirFullPath, ei.entry), ei.err)
 			continue
 		}
 
 		entry := ei.entry
 		info := ei.info
 		name := entry.Name()
-		entryFullPath := filepath.Join(baseDirFullPath, name)
+		entryFullPath := listingEntryPath(baseDirFullPath, entry)
 		isDir := info.IsDir()
 		modTimeUnix := info.ModTime().Unix()
 
@@ -321,11 +482,16 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 			Size:    info.Size(),
 			ModTime: modTimeUnix,
 		}
-
-		if !isDir && media.IsRasterImage(name) {
-			relPathFromRoot, err := filepath.Rel(cfg.RootDirectory, entryFullPath)
+		apiFileInfo.StackSize = ei.stackSize
+
+		if !isDir && media.IsVideo(name) {
+			populateVideoEntry(&apiFileInfo, ei.imageInfo, entryFullPath, modTimeUnix, cfg, imgRepo, imgProc)
+		} else if !isDir && media.IsDocument(name) {
+			populateDocumentEntry(&apiFileInfo, ei.imageInfo, entryFullPath, modTimeUnix, cfg, imgRepo, imgProc)
+		} else if !isDir && media.IsProcessableImage(name) {
+			relPathFromRoot, err := cfg.RelativePath(entryFullPath)
 			if err != nil {
-				log.Printf("CRITICAL: Error creating relative path for DB key (%s relative to %s): %v. Skipping image processing.", entryFullPath, cfg.RootDirectory, err)
+				log.Printf("CRITICAL: Error creating relative path for DB key (%s): %v. Skipping image processing.", entryFullPath, err)
 				fileInfos = append(fileInfos, apiFileInfo)
 				continue
 			}
@@ -334,12 +500,12 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 		var imageInfo *models.Image
 		var recordExists = true
 
-		// Reuse preloaded image info if available to avoid duplicate DB lookups
+		// the records were all loaded up front, so one that wasn't found doesn't exist yet
 		if ei.imageInfo != nil {
 			imageInfo = ei.imageInfo
 			err = nil
 		} else {
-			imageInfo, err = imgRepo.GetByPath(dbKeyPath)
+			err = gorm.ErrRecordNotFound
 		}
 
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -402,11 +568,34 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 				apiFileInfo.CameraMake = imageInfo.CameraMake
 				apiFileInfo.CameraModel = imageInfo.CameraModel
 				apiFileInfo.TakenAt = imageInfo.TakenAt
+				apiFileInfo.Latitude = imageInfo.Latitude
+				apiFileInfo.Longitude = imageInfo.Longitude
+				apiFileInfo.Altitude = imageInfo.Altitude
+				apiFileInfo.Location = imageInfo.Location
+				apiFileInfo.Description = imageInfo.Description
+				apiFileInfo.Title = imageInfo.Title
+				apiFileInfo.Copyright = imageInfo.Copyright
+				apiFileInfo.License = imageInfo.License
+				apiFileInfo.StackID = imageInfo.StackID
+				apiFileInfo.StackBest = imageInfo.StackBest
+				apiFileInfo.Projection = imageInfo.Projection
+				apiFileInfo.ResizeURL = resizeURL(cfg, imageInfo.OriginalPath)
+				if imageInfo.LivePairPath != nil {
+					if motion, ok := imagesByPath[*imageInfo.LivePairPath]; ok {
+						motionPath := "/" + strings.TrimPrefix(prefix+"/"+path.Base(motion.OriginalPath), "/")
+						apiFileInfo.LivePhotoPath = &motionPath
+						if motion.RenditionPath != nil && motion.TranscodeStatus == database.StatusDone {
+							motionURL := renditionURL(cfg, *motion.RenditionPath)
+							apiFileInfo.LivePhotoRenditionPath = &motionURL
+						}
+					}
+				}
 
 				if imageInfo.ThumbnailPath != nil && imageInfo.ThumbnailStatus == database.StatusDone {
-					thumbFilename := filepath.Base(*imageInfo.ThumbnailPath)
-					fullThumbURL := "/api" + thumbnailApiPrefix + thumbFilename
+					fullThumbURL := thumbnailURL(cfg, *imageInfo.ThumbnailPath)
 					apiFileInfo.ThumbnailPath = &fullThumbURL
+					apiFileInfo.Thumbnails = thumbnailURLs(imageInfo, cfg)
+					apiFileInfo.Blurhash = imageInfo.Blurhash
 				}
 			} else {
 				apiFileInfo.ThumbnailStatus = database.StatusPending
@@ -431,15 +620,15 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 				log.Printf("Queuing all tasks for updated image file: %s (ModTime: %d > DB: %d)", dbKeyPath, modTimeUnix, imageInfo.LastModified)
 			} else {
 				// file not newer, check individual task statuses
-				if imageInfo.ThumbnailStatus != database.StatusDone && imageInfo.ThumbnailStatus != database.StatusNotRequired {
+				if workers.TaskNeedsProcessing(imageInfo.ThumbnailStatus, imageInfo.ThumbnailAttempts, cfg.WorkerMaxAttempts) {
 					queueThumbnail = true
 					log.Printf("Re-queuing thumbnail task for %s (status: %s)", dbKeyPath, imageInfo.ThumbnailStatus)
 				}
-				if imageInfo.MetadataStatus != database.StatusDone && imageInfo.MetadataStatus != database.StatusNotRequired {
+				if workers.TaskNeedsProcessing(imageInfo.MetadataStatus, imageInfo.MetadataAttempts, cfg.WorkerMaxAttempts) {
 					queueMetadata = true
 					log.Printf("Re-queuing metadata task for %s (status: %s)", dbKeyPath, imageInfo.MetadataStatus)
 				}
-				if imageInfo.DetectionStatus != database.StatusDone && imageInfo.DetectionStatus != database.StatusNotRequired {
+				if workers.TaskNeedsProcessing(imageInfo.DetectionStatus, imageInfo.DetectionAttempts, cfg.WorkerMaxAttempts) {
 					queueDetection = true
 					log.Printf("Re-queuing detection task for %s (status: %s)", dbKeyPath, imageInfo.DetectionStatus)
 				}
@@ -455,6 +644,7 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 				if queueThumbnail {
 					thumbJob := baseJob
 					thumbJob.TaskType = workers.TaskThumbnail
+					thumbJob.Priority = workers.PriorityHigh // someone is looking at this folder right now
 					imgProc.QueueJob(thumbJob)
 				}
 				if queueMetadata {
@@ -465,6 +655,7 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 				if queueDetection {
 					detectJob := baseJob
 					detectJob.TaskType = workers.TaskDetection
+					detectJob.Priority = workers.PriorityLow
 					imgProc.QueueJob(detectJob)
 				}
 			}
@@ -475,3 +666,203 @@ func listDirectoryContents(baseDirFullPath string, requestPathPrefix string, cfg
 
     return fileInfos, totalCount, nil
 }
+
+// libraryDirEntry lists another library as a folder at the top of the default library
+type libraryDirEntry struct {
+	fs.DirEntry
+	library config.Library
+}
+
+func (e libraryDirEntry) Name() string {
+	return e.library.ID
+}
+
+// libraryDirEntries returns a folder entry for every library besides the default one.
+// unavailable libraries are logged and left out.
+func libraryDirEntries(cfg config.Config) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for _, lib := range cfg.ExtraLibraries() {
+		info, err := os.Stat(lib.Path)
+		if err != nil || !info.IsDir() {
+			log.Printf("Library '%s' at %s is unavailable: %v", lib.ID, lib.Path, err)
+			continue
+		}
+		entries = append(entries, libraryDirEntry{DirEntry: fs.FileInfoToDirEntry(info), library: lib})
+	}
+	return entries
+}
+
+// listingEntryPath returns the absolute path of a directory listing entry
+func listingEntryPath(baseDirFullPath string, entry fs.DirEntry) string {
+	if libEntry, ok := entry.(libraryDirEntry); ok {
+		return libEntry.library.Path
+	}
+	return filepath.Join(baseDirFullPath, entry.Name())
+}
+
+// sortPosition returns the custom sort position of a listing entry, if it has one
+func sortPosition(ei entryInfo) *int {
+	if ei.imageInfo == nil {
+		return nil
+	}
+	return ei.imageInfo.SortPosition
+}
+
+// populateVideoEntry fills in video details for a listing entry from its preloaded record,
+// creating the DB record when videoInfo is nil and queuing poster/transcode tasks when they
+// are missing or stale
+func populateVideoEntry(apiFileInfo *FileInfo, videoInfo *models.Image, entryFullPath string, modTimeUnix int64, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor) {
+	apiFileInfo.MediaType = database.MediaTypeVideo
+
+	relPathFromRoot, err := cfg.RelativePath(entryFullPath)
+	if err != nil {
+		log.Printf("CRITICAL: Error creating relative path for DB key (%s): %v. Skipping video processing.", entryFullPath, err)
+		return
+	}
+	dbKeyPath := filepath.ToSlash(relPathFromRoot)
+
+	if videoInfo == nil {
+		if _, ensureErr := imgRepo.EnsureVideoExists(dbKeyPath, modTimeUnix, nil, cfg.VideoTranscodeEnabled); ensureErr != nil {
+			log.Printf("ERROR ensuring video record exists for %s: %v", dbKeyPath, ensureErr)
+			return
+		}
+		videoInfo, err = imgRepo.GetByPath(dbKeyPath)
+		if err != nil {
+			log.Printf("ERROR querying video DB record for '%s': %v", dbKeyPath, err)
+			return
+		}
+	}
+
+	apiFileInfo.ThumbnailStatus = videoInfo.ThumbnailStatus
+	apiFileInfo.TranscodeStatus = videoInfo.TranscodeStatus
+	apiFileInfo.Width = videoInfo.Width
+	apiFileInfo.Height = videoInfo.Height
+	apiFileInfo.Duration = videoInfo.Duration
+	apiFileInfo.VideoCodec = videoInfo.VideoCodec
+	apiFileInfo.AudioCodec = videoInfo.AudioCodec
+	apiFileInfo.Bitrate = videoInfo.Bitrate
+	apiFileInfo.TakenAt = videoInfo.TakenAt
+	apiFileInfo.Description = videoInfo.Description
+	apiFileInfo.Title = videoInfo.Title
+	apiFileInfo.Copyright = videoInfo.Copyright
+	apiFileInfo.License = videoInfo.License
+
+	if videoInfo.ThumbnailPath != nil && videoInfo.ThumbnailStatus == database.StatusDone {
+		fullThumbURL := thumbnailURL(cfg, *videoInfo.ThumbnailPath)
+		apiFileInfo.ThumbnailPath = &fullThumbURL
+		apiFileInfo.Thumbnails = thumbnailURLs(videoInfo, cfg)
+		apiFileInfo.Blurhash = videoInfo.Blurhash
+	}
+	if videoInfo.RenditionPath != nil && videoInfo.TranscodeStatus == database.StatusDone {
+		videoURL := renditionURL(cfg, *videoInfo.RenditionPath)
+		apiFileInfo.RenditionPath = &videoURL
+	}
+	apiFileInfo.StreamPath = streamMasterURL(cfg, videoInfo)
+
+	fileChanged := modTimeUnix > videoInfo.LastModified
+	queueThumbnail := fileChanged || workers.TaskNeedsProcessing(videoInfo.ThumbnailStatus, videoInfo.ThumbnailAttempts, cfg.WorkerMaxAttempts)
+	queueTranscode := cfg.VideoTranscodeEnabled &&
+		(fileChanged || workers.TaskNeedsProcessing(videoInfo.TranscodeStatus, videoInfo.TranscodeAttempts, cfg.WorkerMaxAttempts))
+	// a changed video is streamed again once the thumbnail task probed it
+	queueStream := cfg.VideoHLSEnabled && !fileChanged &&
+		workers.TaskNeedsProcessing(videoInfo.StreamStatus, videoInfo.StreamAttempts, cfg.WorkerMaxAttempts)
+
+	queueVideoProcessing(imgProc, entryFullPath, dbKeyPath, modTimeUnix, queueThumbnail, queueTranscode, queueStream)
+}
+
+// populateDocumentEntry fills in document details for a listing entry from its preloaded
+// record, creating the DB record when documentInfo is nil and queuing the thumbnail of its
+// first page when it is missing or stale
+func populateDocumentEntry(apiFileInfo *FileInfo, documentInfo *models.Image, entryFullPath string, modTimeUnix int64, cfg config.Config, imgRepo repository.ImageRepositoryInterface, imgProc *workers.ImageProcessor) {
+	apiFileInfo.MediaType = database.MediaTypeDocument
+
+	relPathFromRoot, err := cfg.RelativePath(entryFullPath)
+	if err != nil {
+		log.Printf("CRITICAL: Error creating relative path for DB key (%s): %v. Skipping document processing.", entryFullPath, err)
+		return
+	}
+	dbKeyPath := filepath.ToSlash(relPathFromRoot)
+
+	if documentInfo == nil {
+		if _, ensureErr := imgRepo.EnsureDocumentExists(dbKeyPath, modTimeUnix, nil); ensureErr != nil {
+			log.Printf("ERROR ensuring document record exists for %s: %v", dbKeyPath, ensureErr)
+			return
+		}
+		documentInfo, err = imgRepo.GetByPath(dbKeyPath)
+		if err != nil {
+			log.Printf("ERROR querying document DB record for '%s': %v", dbKeyPath, err)
+			return
+		}
+	}
+
+	apiFileInfo.ThumbnailStatus = documentInfo.ThumbnailStatus
+	apiFileInfo.Description = documentInfo.Description
+	apiFileInfo.Title = documentInfo.Title
+	apiFileInfo.Copyright = documentInfo.Copyright
+	apiFileInfo.License = documentInfo.License
+
+	if documentInfo.ThumbnailPath != nil && documentInfo.ThumbnailStatus == database.StatusDone {
+		fullThumbURL := thumbnailURL(cfg, *documentInfo.ThumbnailPath)
+		apiFileInfo.ThumbnailPath = &fullThumbURL
+		apiFileInfo.Thumbnails = thumbnailURLs(documentInfo, cfg)
+		apiFileInfo.Blurhash = documentInfo.Blurhash
+	}
+
+	if modTimeUnix > documentInfo.LastModified || workers.TaskNeedsProcessing(documentInfo.ThumbnailStatus, documentInfo.ThumbnailAttempts, cfg.WorkerMaxAttempts) {
+		queueDocumentThumbnail(imgProc, entryFullPath, dbKeyPath, modTimeUnix, workers.PriorityHigh)
+	}
+}
+
+// queueDocumentThumbnail queues the thumbnail task of a document
+func queueDocumentThumbnail(imgProc *workers.ImageProcessor, fullPath, dbKeyPath string, modTimeUnix int64, priority workers.JobPriority) {
+	if imgProc == nil {
+		return
+	}
+	imgProc.QueueJob(workers.ImageJob{
+		OriginalImagePath:    fullPath,
+		OriginalRelativePath: dbKeyPath,
+		ModTimeUnix:          modTimeUnix,
+		TaskType:             workers.TaskDocumentThumbnail,
+		Priority:             priority,
+	})
+}
+
+// streamMasterURL returns the signed URL of the master playlist of a video's HLS stream, or
+// nil if it has none
+func streamMasterURL(cfg config.Config, video *models.Image) *string {
+	if !cfg.VideoHLSEnabled || video.StreamStatus != database.StatusDone || len(video.StreamFiles) == 0 {
+		return nil
+	}
+	masterURL := streamURL(cfg, video.OriginalPath, media.HLSMasterPlaylist)
+	return &masterURL
+}
+
+// queueVideoProcessing queues the poster thumbnail, transcode and/or stream tasks for a video
+func queueVideoProcessing(imgProc *workers.ImageProcessor, fullPath, dbKeyPath string, modTimeUnix int64, thumbnail, transcode, stream bool) {
+	if imgProc == nil {
+		return
+	}
+	baseJob := workers.ImageJob{
+		OriginalImagePath:    fullPath,
+		OriginalRelativePath: dbKeyPath,
+		ModTimeUnix:          modTimeUnix,
+	}
+	if thumbnail {
+		thumbJob := baseJob
+		thumbJob.TaskType = workers.TaskVideoThumbnail
+		thumbJob.Priority = workers.PriorityHigh
+		imgProc.QueueJob(thumbJob)
+	}
+	if transcode {
+		transcodeJob := baseJob
+		transcodeJob.TaskType = workers.TaskVideoTranscode
+		transcodeJob.Priority = workers.PriorityLow
+		imgProc.QueueJob(transcodeJob)
+	}
+	if stream {
+		streamJob := baseJob
+		streamJob.TaskType = workers.TaskVideoStream
+		streamJob.Priority = workers.PriorityLow
+		imgProc.QueueJob(streamJob)
+	}
+}
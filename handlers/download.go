@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+// download modes, chosen with the mode query param of file and zip downloads
+const (
+	downloadModeOriginal = "original" // the files as they are
+	downloadModeWeb      = "web"      // JPEG copies of images, scaled down and without EXIF data
+)
+
+// imageDownload is how the images of a download are prepared. the zero value serves the
+// original files.
+type imageDownload struct {
+	web       bool
+	watermark *media.Watermark // only images can be watermarked, so other files are left out
+	// the copyright holder and license embedded in web copies, see downloadRights
+	rights func(fullPath string) media.XMPProperties
+}
+
+// parseImageDownload reads the download mode from the mode query param
+func parseImageDownload(r *http.Request) (imageDownload, error) {
+	switch r.URL.Query().Get("mode") {
+	case "", downloadModeOriginal:
+		return imageDownload{}, nil
+	case downloadModeWeb:
+		return imageDownload{web: true}, nil
+	}
+	return imageDownload{}, fmt.Errorf("mode must be %s or %s", downloadModeOriginal, downloadModeWeb)
+}
+
+// original reports whether every file is served unchanged
+func (d imageDownload) original() bool {
+	return !d.web && d.watermark == nil
+}
+
+// includes reports whether a file can be part of the download
+func (d imageDownload) includes(name string) bool {
+	return d.watermark == nil || media.IsProcessableImage(name)
+}
+
+// reencodes reports whether a file is served as a re-encoded JPEG rather than as it is
+func (d imageDownload) reencodes(name string) bool {
+	return !d.original() && media.IsProcessableImage(name)
+}
+
+// fileName is the name a file is downloaded as
+func (d imageDownload) fileName(name string) string {
+	if !d.reencodes(name) {
+		return name
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".jpg"
+}
+
+// render decodes an image, with the same orientation and color handling as thumbnails,
+// and scales and watermarks it as the download asks
+func (d imageDownload) render(cfg config.Config, imagePath string) (image.Image, error) {
+	img, _, err := media.DecodeImageFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", imagePath, err)
+	}
+	if d.web {
+		img = media.ResizeImage(img, cfg.WebDownloadMaxSize, cfg.WebDownloadMaxSize, media.ResizeFitContain)
+	}
+	if d.watermark != nil {
+		img = media.ApplyWatermark(img, *d.watermark)
+	}
+	return img, nil
+}
+
+// encode writes the rendered image of fullPath as JPEG. web downloads are at the web quality
+// and keep the copyright holder and license, unless turned off with WEB_DOWNLOAD_EMBED_RIGHTS.
+func (d imageDownload) encode(cfg config.Config, w io.Writer, fullPath string, img image.Image) error {
+	if !d.web {
+		return media.EncodeJPEG(w, img, media.WatermarkJpegQuality)
+	}
+	var props media.XMPProperties
+	if cfg.WebDownloadEmbedRights && d.rights != nil {
+		props = d.rights(fullPath)
+	}
+	return media.EncodeJPEGWithXMP(w, img, cfg.WebDownloadQuality, props)
+}
+
+// serveDownloadFile serves a single file as the download asks. callers check includes first.
+// returns an error, having written nothing, if the image can't be rendered.
+func serveDownloadFile(w http.ResponseWriter, r *http.Request, cfg config.Config, fullPath string, info os.FileInfo, d imageDownload) error {
+	name := filepath.Base(fullPath)
+	if !d.reencodes(name) {
+		// ServeFile handles Range requests; the ETag lets If-Range resume downloads safely
+		w.Header().Set("ETag", assetETag(info))
+		http.ServeFile(w, r, fullPath)
+		return nil
+	}
+
+	img, err := d.render(cfg, fullPath)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", d.fileName(name)))
+	if err := d.encode(cfg, w, fullPath, img); err != nil {
+		log.Printf("Error writing %s for download: %v", fullPath, err)
+	}
+	return nil
+}
+
+// zipFileName names the zip of an album download, e.g. "trip_archive_web.zip"
+func zipFileName(album *models.Album, kind string, d imageDownload) string {
+	if d.web {
+		return album.Slug + "_" + kind + "_" + downloadModeWeb + ".zip"
+	}
+	return album.Slug + "_" + kind + ".zip"
+}
+
+// streamDownloadZip zips the named files of an album folder into the response as the
+// download asks. images that fail to render are left out.
+func streamDownloadZip(w http.ResponseWriter, cfg config.Config, album *models.Album, albumFullPath string, names []string, d imageDownload, filename string) {
+	if d.original() {
+		streamZip(w, album, albumFullPath, names, filename)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Type", "application/zip")
+
+	zipWriter := zip.NewWriter(newDeadlineWriter(w))
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !d.includes(name) {
+			continue
+		}
+		if err := writeDownloadZipEntry(zipWriter, cfg, filepath.Join(albumFullPath, name), d, used); err != nil {
+			// the response has started, so the client is left with a truncated archive
+			log.Printf("Error streaming zip for album %d/%s: %v", album.ID, album.Slug, err)
+			return
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		log.Printf("Error finishing zip for album %d/%s: %v", album.ID, album.Slug, err)
+	}
+}
+
+// writeDownloadZipEntry adds one file to a download zip. used holds the entry names taken
+// so far, as a.png and a.jpg both become a.jpg when re-encoded. files that can't be read or
+// rendered are skipped; the returned error means the archive itself failed.
+func writeDownloadZipEntry(zipWriter *zip.Writer, cfg config.Config, fullPath string, d imageDownload, used map[string]bool) error {
+	name := filepath.Base(fullPath)
+	entryName := d.fileName(name)
+	if used[entryName] {
+		entryName = name + filepath.Ext(entryName)
+	}
+
+	if !d.reencodes(name) {
+		file, err := os.Open(fullPath)
+		if err != nil {
+			log.Printf("Skipping %s in zip: %v", fullPath, err)
+			return nil
+		}
+		defer file.Close()
+		used[entryName] = true
+		entry, err := zipWriter.Create(entryName)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, file)
+		return err
+	}
+
+	img, err := d.render(cfg, fullPath)
+	if err != nil {
+		log.Printf("Skipping %s in zip: %v", fullPath, err)
+		return nil
+	}
+	used[entryName] = true
+	entry, err := zipWriter.Create(entryName)
+	if err != nil {
+		return err
+	}
+	return d.encode(cfg, entry, fullPath, img)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/email"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+// EmailVerificationHandler confirms that users can receive mail at their email address
+type EmailVerificationHandler struct {
+	UserRepo         repository.UserRepository
+	NotificationRepo repository.NotificationRepositoryInterface
+	Notifier         *email.Notifier
+	Cfg              config.Config
+}
+
+func NewEmailVerificationHandler(userRepo repository.UserRepository, notificationRepo repository.NotificationRepositoryInterface, notifier *email.Notifier, cfg config.Config) *EmailVerificationHandler {
+	return &EmailVerificationHandler{UserRepo: userRepo, NotificationRepo: notificationRepo, Notifier: notifier, Cfg: cfg}
+}
+
+type EmailVerificationConfirmPayload struct {
+	Token string `json:"token"`
+}
+
+// SendVerification creates a verification token for the user's current email address and
+// emails it in the background
+func (h *EmailVerificationHandler) SendVerification(user *models.User) error {
+	if user.Email == nil {
+		return fmt.Errorf("user %d has no email address", user.ID)
+	}
+	if !h.Notifier.Enabled() {
+		return email.ErrEmailDisabled
+	}
+	token, hash, err := models.GenerateEmailVerificationToken()
+	if err != nil {
+		return err
+	}
+	expiry := time.Duration(h.Cfg.EmailVerificationExpiryHours) * time.Hour
+	verificationToken := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     *user.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(expiry).Unix(),
+	}
+	if err := h.NotificationRepo.CreateEmailVerificationToken(verificationToken); err != nil {
+		return err
+	}
+	recipient := *user
+	go func() {
+		if err := h.Notifier.VerifyEmail(&recipient, token, expiry); err != nil {
+			log.Printf("Email verification: failed to email user %d: %v", recipient.ID, err)
+		}
+	}()
+	return nil
+}
+
+// ResendVerification handles POST /api/auth/me/verify-email
+func (h *EmailVerificationHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		WriteAPIError(w, http.StatusUnauthorized, "AuthenticationException", "Authentication required")
+		return
+	}
+	if user.Email == nil {
+		WriteAPIError(w, http.StatusBadRequest, "DisplayException", "Your account has no email address to confirm.")
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		WriteAPIError(w, http.StatusConflict, "DisplayException", "Your email address is already confirmed.")
+		return
+	}
+	if err := h.SendVerification(user); err != nil {
+		if errors.Is(err, email.ErrEmailDisabled) {
+			WriteAPIError(w, http.StatusServiceUnavailable, "DisplayException", "Email verification is unavailable because email is not configured.")
+			return
+		}
+		log.Printf("Email verification: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to create verification link")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "A confirmation link has been sent to " + *user.Email + "."})
+}
+
+// ConfirmEmail handles POST /api/auth/verify-email using the token from a verification email
+func (h *EmailVerificationHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	var payload EmailVerificationConfirmPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Invalid request payload")
+		return
+	}
+	if payload.Token == "" {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", "token is required")
+		return
+	}
+
+	verificationToken, err := h.NotificationRepo.ConsumeEmailVerificationToken(models.HashEmailToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteAPIError(w, http.StatusBadRequest, "DisplayException", "This confirmation link is invalid or has expired.")
+			return
+		}
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to check verification token: "+err.Error())
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(verificationToken.UserID)
+	// also rejects links sent before the address was changed
+	if err != nil || user.Email == nil || *user.Email != verificationToken.Email {
+		WriteAPIError(w, http.StatusBadRequest, "DisplayException", "This confirmation link is invalid or has expired.")
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := h.UserRepo.Update(user); err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to confirm email address: "+err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Email address confirmed."})
+}
+
+// RequireVerifiedEmail is a middleware that refuses users with an unconfirmed email address
+// when the deployment requires verification. It should be used after AuthMiddleware.
+func RequireVerifiedEmail(required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if required {
+			if user := currentUser(r); user != nil && user.HasUnverifiedEmail() {
+				http.Error(w, "Forbidden: confirm your email address first", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,18 +3,22 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
 	"github.com/camden-git/mediasysbackend/services"
+	"github.com/camden-git/mediasysbackend/utils"
+	"github.com/camden-git/mediasysbackend/webhooks"
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
 )
@@ -22,8 +26,13 @@ import (
 type FaceHandler struct {
 	FaceRepo               repository.FaceRepositoryInterface
 	PersonRepo             repository.PersonRepositoryInterface
+	SuggestionRepo         repository.FaceSuggestionRepositoryInterface
 	Cfg                    config.Config
 	FaceRecognitionService *services.FaceRecognitionService
+	AlbumRepo              repository.AlbumRepositoryInterface
+	ActivityRepo           repository.ActivityRepositoryInterface
+	Webhooks               *webhooks.Dispatcher
+	Embedder               *media.FaceEmbedder // search by example photo, nil or disabled unless face recognition is enabled
 }
 
 func (fh *FaceHandler) AddFace(w http.ResponseWriter, r *http.Request) {
@@ -65,13 +74,12 @@ func (fh *FaceHandler) AddFace(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	cleanRelativePath := filepath.Clean(req.ImagePath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
+	imagePathForDB, err := utils.CleanRelPath(req.ImagePath)
+	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "image_path must be relative and cannot use '..'"})
 		return
 	}
-	imagePathForDB := filepath.ToSlash(cleanRelativePath)
-	fullImagePath := filepath.Join(fh.Cfg.RootDirectory, imagePathForDB)
+	fullImagePath := fh.Cfg.ResolvePath(imagePathForDB)
 	if _, err := os.Stat(fullImagePath); os.IsNotExist(err) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "image_path does not exist: " + imagePathForDB})
 		return
@@ -116,12 +124,11 @@ func (fh *FaceHandler) ListFacesByImage(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid URL encoding for path parameter"})
 		return
 	}
-	cleanRelativePath := filepath.Clean(imagePath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
+	imagePathForDB, err := utils.CleanRelPath(imagePath)
+	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "image_path must be relative and cannot use '..'"})
 		return
 	}
-	imagePathForDB := filepath.ToSlash(cleanRelativePath)
 	faces, err := fh.FaceRepo.ListByImagePath(imagePathForDB)
 	if err != nil {
 		log.Printf("Error listing faces for image %s: %v", imagePathForDB, err)
@@ -241,6 +248,9 @@ func (fh *FaceHandler) UpdateFace(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if personIDUpdate != nil {
+		fh.enforceRecognitionOptOut(*personIDUpdate)
+	}
 
 	updatedFace, err := fh.FaceRepo.GetByID(uint(faceID))
 	if err != nil {
@@ -301,6 +311,132 @@ func (fh *FaceHandler) SearchFacesByPerson(w http.ResponseWriter, r *http.Reques
 	writeJSON(w, http.StatusOK, imagePaths)
 }
 
+// largest example photo accepted by SearchFacesByImage
+const maxExamplePhotoBytes = 50 << 20
+
+// image types the face detector can decode
+var examplePhotoTypes = []string{media.MediaTypeJPEG, media.MediaTypePNG, media.MediaTypeBMP, media.MediaTypeTIFF}
+
+// ExamplePhotoFace is a face found in an example photo
+type ExamplePhotoFace struct {
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	W          int     `json:"w"`
+	H          int     `json:"h"`
+	Confidence float32 `json:"confidence"`
+}
+
+// ExamplePhotoPerson is a person with faces matching the face of an example photo
+type ExamplePhotoPerson struct {
+	PersonID   uint    `json:"person_id"`
+	PersonName *string `json:"person_name,omitempty"`
+	Similarity float32 `json:"similarity"` // of the most similar of the person's faces
+	Matches    int     `json:"matches"`
+}
+
+// SearchFacesByImage finds the faces, and with them the people and images, matching a face
+// in an uploaded photo, sent as the photo field of a multipart form. the photo is not saved.
+// faces in the photo are numbered largest first; face picks which one to search for.
+// Route: POST /api/search/faces/by-image?face=...&limit=...
+func (fh *FaceHandler) SearchFacesByImage(w http.ResponseWriter, r *http.Request) {
+	if fh.FaceRecognitionService == nil || fh.Embedder == nil || !fh.Embedder.Enabled {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Face recognition is not enabled"})
+		return
+	}
+	faceIndex := 0
+	if faceStr := r.URL.Query().Get("face"); faceStr != "" {
+		parsed, err := strconv.Atoi(faceStr)
+		if err != nil || parsed < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "face must be a non-negative integer"})
+			return
+		}
+		faceIndex = parsed
+	}
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxExamplePhotoBytes+1<<20) // room for the form around the photo
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "Photo is too large"})
+		} else {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing photo file: " + err.Error()})
+		}
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxExamplePhotoBytes+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to read photo: " + err.Error()})
+		return
+	}
+	if len(data) > maxExamplePhotoBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "Photo is too large"})
+		return
+	}
+	if mediaType := media.SniffMediaType(data[:min(len(data), media.SniffLength)]); !slices.Contains(examplePhotoTypes, mediaType) {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "Photo must be a JPEG, PNG, BMP or TIFF image, not " + mediaType})
+		return
+	}
+
+	detections, err := fh.Embedder.EmbedFaces(data)
+	if err != nil {
+		log.Printf("Error finding faces in example photo: %v", err)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to read faces from the photo"})
+		return
+	}
+	if len(detections) == 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "No face was found in the photo"})
+		return
+	}
+	if faceIndex >= len(detections) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "face must be less than the " + strconv.Itoa(len(detections)) + " faces found in the photo"})
+		return
+	}
+
+	matches, err := fh.FaceRecognitionService.FindSimilarToEmbedding(detections[faceIndex].Embedding, limit)
+	if err != nil {
+		log.Printf("Error searching faces by example photo: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search faces"})
+		return
+	}
+	if matches == nil {
+		matches = []services.SimilarFaceResult{}
+	}
+
+	faces := make([]ExamplePhotoFace, len(detections))
+	for i, detection := range detections {
+		faces[i] = ExamplePhotoFace{X: detection.X, Y: detection.Y, W: detection.W, H: detection.H, Confidence: detection.Confidence}
+	}
+	// matches are most similar first, so a person's first match is their most similar
+	people := []ExamplePhotoPerson{}
+	personIndex := make(map[uint]int)
+	for _, match := range matches {
+		if match.PersonID == nil {
+			continue
+		}
+		if i, ok := personIndex[*match.PersonID]; ok {
+			people[i].Matches++
+			continue
+		}
+		personIndex[*match.PersonID] = len(people)
+		people = append(people, ExamplePhotoPerson{PersonID: *match.PersonID, PersonName: match.PersonName, Similarity: match.Similarity, Matches: 1})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"faces":   faces,
+		"face":    faceIndex,
+		"people":  people,
+		"matches": matches,
+	})
+}
+
 // GetSimilarFaces finds faces similar to a given face ID
 func (fh *FaceHandler) GetSimilarFaces(w http.ResponseWriter, r *http.Request) {
 	if fh.FaceRecognitionService == nil {
@@ -419,9 +555,58 @@ func (fh *FaceHandler) TagFace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fh.faceTagged(r, uint(faceID), req.PersonID, false)
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Face tagged successfully"})
 }
 
+// enforceRecognitionOptOut purges the embeddings of a person's faces, including one just
+// tagged, if they opted out of face recognition
+func (fh *FaceHandler) enforceRecognitionOptOut(personID uint) {
+	if fh.FaceRecognitionService == nil {
+		return
+	}
+	if _, err := fh.FaceRecognitionService.EnforceRecognitionOptOut(personID); err != nil {
+		log.Printf("Error enforcing recognition opt-out of person %d: %v", personID, err)
+	}
+}
+
+// faceTagged sends face.tagged to webhooks and adds a person.tagged event to the activity feed
+// of the album holding the face's image, and purges the face's embedding if the person opted
+// out of face recognition. faces outside of any album are not in the feed.
+func (fh *FaceHandler) faceTagged(r *http.Request, faceID uint, personID uint, auto bool) {
+	fh.enforceRecognitionOptOut(personID)
+	if fh.Webhooks == nil && (fh.ActivityRepo == nil || fh.AlbumRepo == nil) {
+		return
+	}
+	face, err := fh.FaceRepo.GetByID(faceID)
+	if err != nil {
+		log.Printf("Error getting tagged face %d: %v", faceID, err)
+		return
+	}
+
+	event := map[string]interface{}{"face_id": faceID, "person_id": personID, "image_path": "/" + face.ImagePath, "auto": auto}
+	if user := currentUser(r); user != nil {
+		event["user_id"] = user.ID
+	}
+	fh.Webhooks.Emit(models.WebhookEventFaceTagged, event)
+
+	if fh.ActivityRepo == nil || fh.AlbumRepo == nil {
+		return
+	}
+	album, err := fh.AlbumRepo.FindByImagePath(face.ImagePath)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error finding album of %s for activity: %v", face.ImagePath, err)
+		}
+		return
+	}
+
+	activity := newActivity(r, models.ActivityPersonTagged, album.ID)
+	activity.ImagePath = &face.ImagePath
+	activity.PersonID = &personID
+	recordActivity(fh.ActivityRepo, activity)
+}
+
 // AutoTagFace automatically tags a face based on similar faces
 func (fh *FaceHandler) AutoTagFace(w http.ResponseWriter, r *http.Request) {
 	if fh.FaceRecognitionService == nil {
@@ -463,6 +648,7 @@ func (fh *FaceHandler) AutoTagFace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fh.faceTagged(r, uint(faceID), *personID, true)
 	response := map[string]interface{}{
 		"message":    "Face auto-tagged successfully",
 		"person_id":  *personID,
@@ -475,107 +661,302 @@ func (fh *FaceHandler) AutoTagFace(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, response)
 }
 
-// DebugFaces returns debug information about faces in the database
-func (fh *FaceHandler) DebugFaces(w http.ResponseWriter, r *http.Request) {
-	if fh.FaceRecognitionService == nil {
-		writeJSON(w, http.StatusOK, map[string]interface{}{
-			"error": "Face recognition service not available",
-		})
-		return
+// faces shown for each cluster in the cluster listing
+const faceClusterSampleSize = 4
+
+// ListFaceClusters returns the clusters of untagged faces found by the face clustering
+// task, largest first, each with a few of its faces
+// Route: GET /api/faces/clusters?limit=...
+func (fh *FaceHandler) ListFaceClusters(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
 	}
 
-	// Get face 485 and its embedding
-	face485, err := fh.FaceRepo.GetByID(485)
+	clusters, err := fh.FaceRepo.ListClusters(limit)
 	if err != nil {
-		log.Printf("Error getting face 485: %v", err)
-		writeJSON(w, http.StatusOK, map[string]interface{}{
-			"error": "Face 485 not found",
-		})
+		log.Printf("Error listing face clusters: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list face clusters"})
 		return
 	}
 
-	// Get the embedding for face 485
-	embedding485, err := fh.FaceRecognitionService.GetEmbeddingRepo().GetByFaceID(485)
+	type clusterWithFaces struct {
+		repository.FaceCluster
+		Faces []models.Face `json:"faces"`
+	}
+	response := make([]clusterWithFaces, 0, len(clusters))
+	for _, cluster := range clusters {
+		faces, err := fh.FaceRepo.ListByClusterID(cluster.ClusterID, faceClusterSampleSize)
+		if err != nil {
+			log.Printf("Error listing faces of cluster %d: %v", cluster.ClusterID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list face clusters"})
+			return
+		}
+		response = append(response, clusterWithFaces{FaceCluster: cluster, Faces: faces})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// clusterIDParam reads the {cluster_id} URL param, writing an error response if it is invalid
+func clusterIDParam(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	clusterID, err := strconv.ParseUint(chi.URLParam(r, "cluster_id"), 10, 64)
+	if err != nil || clusterID == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cluster ID format"})
+		return 0, false
+	}
+	return uint(clusterID), true
+}
+
+// GetFaceCluster returns every untagged face of a cluster
+// Route: GET /api/faces/clusters/{cluster_id}
+func (fh *FaceHandler) GetFaceCluster(w http.ResponseWriter, r *http.Request) {
+	clusterID, ok := clusterIDParam(w, r)
+	if !ok {
+		return
+	}
+	faces, err := fh.FaceRepo.ListByClusterID(clusterID, 0)
 	if err != nil {
-		log.Printf("Error getting embedding for face 485: %v", err)
-		writeJSON(w, http.StatusOK, map[string]interface{}{
-			"face_485":        face485,
-			"embedding_error": err.Error(),
-		})
+		log.Printf("Error listing faces of cluster %d: %v", clusterID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get face cluster"})
+		return
+	}
+	if len(faces) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Face cluster not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cluster_id": clusterID, "face_count": len(faces), "faces": faces})
+}
+
+// TagFaceCluster tags every untagged face of a cluster with one person
+// Route: POST /api/faces/clusters/{cluster_id}/tag
+func (fh *FaceHandler) TagFaceCluster(w http.ResponseWriter, r *http.Request) {
+	clusterID, ok := clusterIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	// Get embeddings for the similar faces
-	embedding481, err := fh.FaceRecognitionService.GetEmbeddingRepo().GetByFaceID(481)
+	var req struct {
+		PersonID uint `json:"person_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.PersonID == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "person_id is required and must be greater than 0"})
+		return
+	}
+	if _, err := fh.PersonRepo.GetByID(req.PersonID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Person not found"})
+		} else {
+			log.Printf("Error verifying person %d: %v", req.PersonID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to verify person"})
+		}
+		return
+	}
+
+	faceIDs, err := fh.FaceRepo.TagCluster(clusterID, req.PersonID)
 	if err != nil {
-		log.Printf("Error getting embedding for face 481: %v", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Face cluster not found"})
+		} else {
+			log.Printf("Error tagging cluster %d with person %d: %v", clusterID, req.PersonID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to tag face cluster"})
+		}
+		return
 	}
 
-	embedding483, err := fh.FaceRecognitionService.GetEmbeddingRepo().GetByFaceID(483)
+	for _, faceID := range faceIDs {
+		fh.faceTagged(r, faceID, req.PersonID, false)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Face cluster tagged successfully", "person_id": req.PersonID, "tagged": len(faceIDs)})
+}
+
+// most faces one bulk tag request may change
+const maxBulkTagFaces = 10000
+
+// BulkTagFaces tags a list of faces with one person, or untags them when person_id is null,
+// all or nothing
+// Route: POST /api/faces/bulk-tag
+func (fh *FaceHandler) BulkTagFaces(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FaceIDs  []uint `json:"face_ids"`
+		PersonID *uint  `json:"person_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.FaceIDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "face_ids must list at least one face"})
+		return
+	}
+	if len(req.FaceIDs) > maxBulkTagFaces {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "face_ids may list at most " + strconv.Itoa(maxBulkTagFaces) + " faces"})
+		return
+	}
+	if req.PersonID != nil {
+		if *req.PersonID == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "person_id must be greater than 0, or null to untag"})
+			return
+		}
+		if _, err := fh.PersonRepo.GetByID(*req.PersonID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Person not found"})
+			} else {
+				log.Printf("Error verifying person %d: %v", *req.PersonID, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to verify person"})
+			}
+			return
+		}
+	}
+
+	seen := make(map[uint]bool, len(req.FaceIDs))
+	faceIDs := make([]uint, 0, len(req.FaceIDs))
+	for _, faceID := range req.FaceIDs {
+		if !seen[faceID] {
+			seen[faceID] = true
+			faceIDs = append(faceIDs, faceID)
+		}
+	}
+
+	missing, err := fh.FaceRepo.SetPersonForFaces(faceIDs, req.PersonID)
 	if err != nil {
-		log.Printf("Error getting embedding for face 483: %v", err)
+		log.Printf("Error bulk tagging %d faces: %v", len(faceIDs), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to tag faces"})
+		return
+	}
+	if len(missing) > 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "Some faces were not found, no faces were changed", "missing_face_ids": missing})
+		return
 	}
 
-	// Calculate similarities manually
-	var similarities []map[string]interface{}
+	if req.PersonID != nil {
+		for _, faceID := range faceIDs {
+			fh.faceTagged(r, faceID, *req.PersonID, false)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Faces tagged successfully", "person_id": req.PersonID, "updated": len(faceIDs)})
+}
+
+// FaceSuggestionsResponse is a page of the person suggestions waiting for review
+type FaceSuggestionsResponse struct {
+	Suggestions []models.FaceSuggestion `json:"suggestions"`
+	Total       int                     `json:"total"`
+	Offset      int                     `json:"offset"`
+	Limit       int                     `json:"limit"`
+	HasMore     bool                    `json:"has_more"`
+	NextCursor  string                  `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
 
-	if embedding481 != nil {
-		similarity := fh.FaceRecognitionService.CalculateSimilarity(
-			embedding485.GetEmbedding(),
-			embedding481.GetEmbedding(),
-		)
-		similarities = append(similarities, map[string]interface{}{
-			"face_id":          481,
-			"similarity":       similarity,
-			"embedding_length": len(embedding481.GetEmbedding()),
-		})
+// ListFaceSuggestions returns a page of the person suggestions for untagged faces that wait
+// for review, most confident first
+// Route: GET /api/faces/suggestions?offset=...&limit=...
+func (fh *FaceHandler) ListFaceSuggestions(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePageParams(r, 50)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
 	}
 
-	if embedding483 != nil {
-		similarity := fh.FaceRecognitionService.CalculateSimilarity(
-			embedding485.GetEmbedding(),
-			embedding483.GetEmbedding(),
-		)
-		similarities = append(similarities, map[string]interface{}{
-			"face_id":          483,
-			"similarity":       similarity,
-			"embedding_length": len(embedding483.GetEmbedding()),
-		})
+	suggestions, total, err := fh.SuggestionRepo.ListPending(offset, limit)
+	if err != nil {
+		log.Printf("Error listing face suggestions: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list face suggestions"})
+		return
+	}
+	if suggestions == nil {
+		suggestions = []models.FaceSuggestion{}
+	}
+
+	response := FaceSuggestionsResponse{
+		Suggestions: suggestions,
+		Total:       int(total),
+		Offset:      offset,
+		Limit:       limit,
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
 	}
+	writeJSON(w, http.StatusOK, response)
+}
 
-	// Check if embeddings are identical
-	embedding485Vector := embedding485.GetEmbedding()
-	var embedding485Head, embedding481Head []float32
-	for i := 0; i < 10 && i < len(embedding485Vector); i++ {
-		embedding485Head = append(embedding485Head, embedding485Vector[i])
+// pendingSuggestion reads the {suggestion_id} URL param and gets the suggestion, writing an
+// error response if it is invalid, missing or already reviewed
+func (fh *FaceHandler) pendingSuggestion(w http.ResponseWriter, r *http.Request) (*models.FaceSuggestion, bool) {
+	if fh.FaceRecognitionService == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Face recognition service not available"})
+		return nil, false
 	}
-	var identicalCount int
-	if embedding481 != nil {
-		embedding481Vector := embedding481.GetEmbedding()
-		for i := 0; i < 10 && i < len(embedding481Vector); i++ {
-			embedding481Head = append(embedding481Head, embedding481Vector[i])
+	suggestionID, err := strconv.ParseUint(chi.URLParam(r, "suggestion_id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid suggestion ID format"})
+		return nil, false
+	}
+	suggestion, err := fh.SuggestionRepo.GetByID(uint(suggestionID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Face suggestion not found"})
+		} else {
+			log.Printf("Error getting face suggestion %d: %v", suggestionID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve face suggestion"})
 		}
-		if len(embedding485Vector) == len(embedding481Vector) {
-			identical := true
-			for i := 0; i < len(embedding485Vector); i++ {
-				if embedding485Vector[i] != embedding481Vector[i] {
-					identical = false
-					break
-				}
-			}
-			if identical {
-				identicalCount++
-			}
+		return nil, false
+	}
+	if suggestion.Status != models.FaceSuggestionPending {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Face suggestion was already " + suggestion.Status})
+		return nil, false
+	}
+	if suggestion.Face == nil || suggestion.Face.PersonID != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Face is already tagged"})
+		return nil, false
+	}
+	return suggestion, true
+}
+
+// AcceptFaceSuggestion tags the face of a suggestion with the suggested person
+// Route: POST /api/faces/suggestions/{suggestion_id}/accept
+func (fh *FaceHandler) AcceptFaceSuggestion(w http.ResponseWriter, r *http.Request) {
+	suggestion, ok := fh.pendingSuggestion(w, r)
+	if !ok {
+		return
+	}
+	user := currentUser(r)
+	if err := fh.FaceRecognitionService.AcceptFaceSuggestion(suggestion, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Face suggestion was already reviewed"})
+		} else {
+			log.Printf("Error accepting face suggestion %d: %v", suggestion.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to accept face suggestion"})
 		}
+		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"face_485":             face485,
-		"embedding_485_length": len(embedding485Vector),
-		"embedding_485_head":   embedding485Head,
-		"embedding_481_head":   embedding481Head,
-		"similarities":         similarities,
-		"identical_embeddings": identicalCount,
-		"threshold":            fh.FaceRecognitionService.GetSimilarityThreshold(),
-	})
+	fh.faceTagged(r, suggestion.FaceID, suggestion.PersonID, false)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Face suggestion accepted", "face_id": suggestion.FaceID, "person_id": suggestion.PersonID})
+}
+
+// RejectFaceSuggestion records that a suggested person is not the person of the face, so it
+// is not suggested for the face again
+// Route: POST /api/faces/suggestions/{suggestion_id}/reject
+func (fh *FaceHandler) RejectFaceSuggestion(w http.ResponseWriter, r *http.Request) {
+	suggestion, ok := fh.pendingSuggestion(w, r)
+	if !ok {
+		return
+	}
+	user := currentUser(r)
+	if err := fh.FaceRecognitionService.RejectFaceSuggestion(suggestion, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Face suggestion was already reviewed"})
+		} else {
+			log.Printf("Error rejecting face suggestion %d: %v", suggestion.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to reject face suggestion"})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Face suggestion rejected", "face_id": suggestion.FaceID, "person_id": suggestion.PersonID})
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/services"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestFaceSuggestionReviewNeedsFaceTag(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrateModels(db); err != nil {
+		t.Fatal(err)
+	}
+	person := &models.Person{PrimaryName: "Ada"}
+	if err := db.Create(person).Error; err != nil {
+		t.Fatal(err)
+	}
+	face := &models.Face{ImagePath: "a.jpg", X2: 10, Y2: 10}
+	if err := db.Create(face).Error; err != nil {
+		t.Fatal(err)
+	}
+	suggestion := &models.FaceSuggestion{FaceID: face.ID, PersonID: person.ID, Status: models.FaceSuggestionPending}
+	if err := db.Create(suggestion).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	faceRepo := repository.NewFaceRepository(db)
+	personRepo := repository.NewPersonRepository(db)
+	suggestionRepo := repository.NewFaceSuggestionRepository(db)
+	handler := &FaceHandler{
+		FaceRepo:               faceRepo,
+		PersonRepo:             personRepo,
+		SuggestionRepo:         suggestionRepo,
+		FaceRecognitionService: services.NewFaceRecognitionService(faceRepo, personRepo, nil, suggestionRepo, 0.5),
+	}
+	// wired like the review routes in main.go, behind AuthMiddleware
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return RequireGlobalPermission("face.tag", next)
+		})
+		r.Post("/api/faces/suggestions/{suggestion_id}/accept", handler.AcceptFaceSuggestion)
+		r.Post("/api/faces/suggestions/{suggestion_id}/reject", handler.RejectFaceSuggestion)
+	})
+
+	review := func(action string, user *models.User) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/faces/suggestions/"+strconv.Itoa(int(suggestion.ID))+"/"+action, nil)
+		r = r.WithContext(context.WithValue(r.Context(), UserContextKey, user))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	viewer := &models.User{ID: 1, GlobalPermissions: []string{"album.list"}}
+	for _, action := range []string{"accept", "reject"} {
+		t.Run(action, func(t *testing.T) {
+			w := review(action, viewer)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body.String())
+			}
+
+			var stored models.FaceSuggestion
+			if err := db.Preload("Face").First(&stored, suggestion.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != models.FaceSuggestionPending || stored.Face.PersonID != nil {
+				t.Errorf("suggestion is %s and the face tagged as %v after a refused %s", stored.Status, stored.Face.PersonID, action)
+			}
+		})
+	}
+
+	tagger := &models.User{ID: 2, GlobalPermissions: []string{"face.tag"}}
+	if w := review("reject", tagger); w.Code != http.StatusOK {
+		t.Errorf("reject with face.tag: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+	"gorm.io/gorm"
+)
+
+// limits of the edited metadata, in characters
+const (
+	maxImageTitleLength       = 200
+	maxImageDescriptionLength = 5000
+	maxCopyrightLength        = 500
+	maxLicenseLength          = 500
+)
+
+type ImageMetadataHandler struct {
+	ImageRepo repository.ImageRepositoryInterface
+	AlbumRepo repository.AlbumRepositoryInterface
+	Cfg       config.Config
+}
+
+// NewImageMetadataHandler creates a new ImageMetadataHandler
+func NewImageMetadataHandler(imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, cfg config.Config) *ImageMetadataHandler {
+	return &ImageMetadataHandler{ImageRepo: imageRepo, AlbumRepo: albumRepo, Cfg: cfg}
+}
+
+// ImageMetadataPayload changes the descriptive metadata of an image. omitted fields are left
+// as they are; an empty title, description, copyright or license removes it.
+type ImageMetadataPayload struct {
+	TakenAt     *int64  `json:"taken_at"` // Unix timestamp
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Copyright   *string `json:"copyright"`
+	License     *string `json:"license"`
+}
+
+// validateMetadataText checks an edited text field against its length limit. only the
+// description may span several lines.
+func validateMetadataText(field string, value *string, maxLength int, multiline bool) error {
+	if value == nil {
+		return nil
+	}
+	if utf8.RuneCountInString(*value) > maxLength {
+		return fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+	for _, r := range *value {
+		if unicode.IsControl(r) && !(multiline && (r == '\n' || r == '\r' || r == '\t')) {
+			return fmt.Errorf("%s contains invalid characters", field)
+		}
+	}
+	return nil
+}
+
+// editedValue returns the new value of an edited text field: the current one when omitted,
+// nil when emptied
+func editedValue(current, edited *string) *string {
+	if edited == nil {
+		return current
+	}
+	if value := strings.TrimSpace(*edited); value != "" {
+		return &value
+	}
+	return nil
+}
+
+// canEditImageMetadata reports whether user may edit the metadata of images in album, nil
+// for images outside every album. archived albums are checked separately.
+func canEditImageMetadata(user *models.User, album *models.Album) bool {
+	if user.HasGlobalPermission("album.edit.general") {
+		return true
+	}
+	return album != nil && user.HasAlbumPermission(album.ID, "album.photo.editmeta")
+}
+
+// UpdateImageMetadata changes the capture time, title, description, copyright and license of
+// an image. they are written to the XMP sidecar of the file, so they survive reprocessing and
+// travel with the file to other tools, and stored on the image record. requires the
+// album.photo.editmeta permission on the image's album, or the global album.edit.general.
+// Route: PUT /api/images/metadata?path=...
+func (h *ImageMetadataHandler) UpdateImageMetadata(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	rawPath := r.URL.Query().Get("path")
+	if rawPath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return
+	}
+	imagePath, err := utils.CleanRelPath(strings.TrimPrefix(rawPath, "/"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must be relative and cannot use '..'"})
+		return
+	}
+
+	image, err := h.ImageRepo.GetByPath(imagePath)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Image not found"})
+		} else {
+			log.Printf("Error getting image %s for metadata update: %v", imagePath, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve image"})
+		}
+		return
+	}
+
+	album, err := h.AlbumRepo.FindByImagePath(imagePath)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error finding album of %s for metadata update: %v", imagePath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		return
+	}
+	if !canEditImageMetadata(user, album) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Forbidden: requires album permission 'album.photo.editmeta'"})
+		return
+	}
+	if album != nil && album.IsArchived {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": albumArchivedMessage})
+		return
+	}
+
+	var payload ImageMetadataPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if payload.TakenAt != nil {
+		if year := time.Unix(*payload.TakenAt, 0).Year(); year < 1 || year > 9999 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "taken_at is out of range"})
+			return
+		}
+	}
+	for _, check := range []error{
+		validateMetadataText("title", payload.Title, maxImageTitleLength, false),
+		validateMetadataText("description", payload.Description, maxImageDescriptionLength, true),
+		validateMetadataText("copyright", payload.Copyright, maxCopyrightLength, false),
+		validateMetadataText("license", payload.License, maxLicenseLength, false),
+	} {
+		if check != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": check.Error()})
+			return
+		}
+	}
+
+	edited := repository.EditedMetadata{
+		Title:       editedValue(image.Title, payload.Title),
+		Description: editedValue(image.Description, payload.Description),
+		Copyright:   editedValue(image.Copyright, payload.Copyright),
+		License:     editedValue(image.License, payload.License),
+		TakenAt:     image.TakenAt,
+	}
+	if payload.TakenAt != nil {
+		edited.TakenAt = payload.TakenAt
+	}
+
+	fullPath := h.Cfg.ResolvePath(imagePath)
+	if err := h.Cfg.CheckSymlinks(fullPath); err != nil {
+		if os.IsPermission(err) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Path goes through a symlink the library doesn't follow"})
+		} else {
+			log.Printf("Error checking symlinks of %s for metadata update: %v", imagePath, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update image metadata"})
+		}
+		return
+	}
+	// the sidecar is written first, so the record never holds edits the file lacks
+	err = media.WriteXMPSidecar(fullPath, media.XMPProperties{
+		Title:       edited.Title,
+		Description: edited.Description,
+		Copyright:   edited.Copyright,
+		License:     edited.License,
+		TakenAt:     edited.TakenAt,
+	})
+	if err != nil {
+		log.Printf("Error writing XMP sidecar of %s: %v", imagePath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to write image metadata"})
+		return
+	}
+	if err := h.ImageRepo.SetEditedMetadata(imagePath, edited); err != nil {
+		log.Printf("Error storing edited metadata of %s: %v", imagePath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update image metadata"})
+		return
+	}
+	InvalidateListings(imagePath)
+
+	updated, err := h.ImageRepo.GetByPath(imagePath)
+	if err != nil {
+		log.Printf("Error fetching image %s after metadata update: %v", imagePath, err)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Image metadata updated successfully"})
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
@@ -9,11 +9,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/camden-git/mediasysbackend/config"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
 	"gocv.io/x/gocv"
 	"gorm.io/gorm"
 )
@@ -36,14 +35,13 @@ func (iph *ImagePreviewHandler) ServeImageWithFaces(w http.ResponseWriter, r *ht
 		http.Error(w, "Invalid URL encoding for path parameter", http.StatusBadRequest)
 		return
 	}
-	cleanRelativePath := filepath.Clean(decodedPath)
-	if filepath.IsAbs(cleanRelativePath) || strings.HasPrefix(cleanRelativePath, "..") {
+	dbPath, err := utils.CleanRelPath(decodedPath)
+	if err != nil {
 		http.Error(w, "Invalid path: must be relative, no '..'", http.StatusBadRequest)
 		return
 	}
-	dbPath := filepath.ToSlash(cleanRelativePath)
 
-	fullPath := filepath.Join(iph.Cfg.RootDirectory, dbPath)
+	fullPath := iph.Cfg.ResolvePath(dbPath)
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		http.NotFound(w, r)
 		return
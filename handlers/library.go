@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/utils"
+)
+
+// albumFolderPath validates the folder of a new or moved album and returns its relative path.
+// with a library ID the folder is relative to that library, otherwise to the top of the
+// relative path space, where other libraries are top level folders.
+func albumFolderPath(cfg config.Config, libraryID, folderPath string) (string, error) {
+	cleanRelativePath, err := utils.CleanRelPath(folderPath)
+	if err != nil {
+		return "", fmt.Errorf("folder_path must be relative and cannot use '..'")
+	}
+	if libraryID == "" {
+		return cleanRelativePath, nil
+	}
+	lib, ok := cfg.LibraryByID(libraryID)
+	if !ok {
+		return "", fmt.Errorf("unknown library_id '%s'", libraryID)
+	}
+	if cleanRelativePath == "." {
+		cleanRelativePath = ""
+	}
+	return lib.LibraryPath(cleanRelativePath), nil
+}
+
+// LibraryResponse describes a configured library
+type LibraryResponse struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`      // absolute path on the server
+	Folder    string `json:"folder"`    // relative path of the library's top folder
+	Available bool   `json:"available"` // the directory can be read
+}
+
+// ListLibraries handles GET /api/admin/libraries
+func ListLibraries(cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		libraries := make([]LibraryResponse, 0, len(cfg.Libraries))
+		for _, lib := range cfg.Libraries {
+			info, err := os.Stat(lib.Path)
+			libraries = append(libraries, LibraryResponse{
+				ID:        lib.ID,
+				Path:      lib.Path,
+				Folder:    "/" + lib.LibraryPath(""),
+				Available: err == nil && info.IsDir(),
+			})
+		}
+		writeJSON(w, http.StatusOK, libraries)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+// maxCachedListings bounds the listings kept in memory. a listing is a page of a directory
+// in one sort order, so a large album paged through takes one per page.
+const maxCachedListings = 512
+
+// listingKey identifies a page of a directory listing
+type listingKey struct {
+	dir       string // full path of the directory
+	prefix    string // path the entries are listed under
+	sortOrder string
+	offset    int
+	limit     int
+	hideNSFW  bool
+	collapse  bool // burst stacks listed as one entry
+}
+
+type cachedListing struct {
+	relDir   string    // the directory relative to its library, like image paths
+	modTime  time.Time // of the directory when it was listed
+	storedAt time.Time
+	files    []FileInfo
+	total    int
+}
+
+// listingCache keeps assembled directory listings, so repeated loads of a large album don't
+// stat every file and look up its record again. a listing is used while the modification time
+// of its directory is unchanged, until it expires or InvalidateListings drops it.
+type listingCache struct {
+	mu         sync.Mutex
+	entries    map[listingKey]*cachedListing
+	generation uint64 // counts invalidations, so listings assembled meanwhile aren't stored
+}
+
+var listings = &listingCache{entries: make(map[listingKey]*cachedListing)}
+
+// listingCacheTTL returns how long a listing is kept. the signed thumbnail URLs in it are only
+// guaranteed to stay valid for AssetURLExpirySeconds.
+func listingCacheTTL(cfg config.Config) time.Duration {
+	seconds := cfg.ListingCacheSeconds
+	if cfg.AssetURLSecret != "" {
+		seconds = min(seconds, cfg.AssetURLExpirySeconds)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// get returns a copy of the cached listing, if it is still fresh for a directory modified at
+// modTime
+func (c *listingCache) get(cfg config.Config, key listingKey, modTime time.Time) ([]FileInfo, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	if !cached.modTime.Equal(modTime) || time.Since(cached.storedAt) > listingCacheTTL(cfg) {
+		delete(c.entries, key)
+		return nil, 0, false
+	}
+	// callers annotate the entries, e.g. with the ratings of the user
+	return append([]FileInfo(nil), cached.files...), cached.total, true
+}
+
+// currentGeneration is read before assembling a listing and passed to put
+func (c *listingCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put stores a copy of a listing assembled since generation, unless something was invalidated
+// in the meantime
+func (c *listingCache) put(cfg config.Config, key listingKey, relDir string, modTime time.Time, files []FileInfo, total int, generation uint64) {
+	ttl := listingCacheTTL(cfg)
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCachedListings {
+		c.evictLocked(ttl)
+	}
+	c.entries[key] = &cachedListing{
+		relDir:   relDir,
+		modTime:  modTime,
+		storedAt: time.Now(),
+		files:    append([]FileInfo(nil), files...),
+		total:    total,
+	}
+}
+
+// evictLocked drops the expired listings, or the oldest one if none has expired. c.mu must
+// be held.
+func (c *listingCache) evictLocked(ttl time.Duration) {
+	var oldestKey listingKey
+	var oldest time.Time
+	for key, cached := range c.entries {
+		if time.Since(cached.storedAt) > ttl {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest.IsZero() || cached.storedAt.Before(oldest) {
+			oldestKey, oldest = key, cached.storedAt
+		}
+	}
+	if len(c.entries) >= maxCachedListings {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// InvalidateListings drops the cached listings of the folder holding relPath and, when
+// relPath is a folder, those of the folder and every folder below it. relPath is relative to
+// its library, like image paths. called whenever files are added, removed or processed.
+func InvalidateListings(relPath string) {
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" {
+		relPath = "."
+	}
+	parent := path.Dir(relPath)
+	listings.mu.Lock()
+	defer listings.mu.Unlock()
+	listings.generation++
+	for key, cached := range listings.entries {
+		if relPath == "." || cached.relDir == parent || cached.relDir == relPath || strings.HasPrefix(cached.relDir, relPath+"/") {
+			delete(listings.entries, key)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	loginDelayBase      = 500 * time.Millisecond // delay after the second failure, doubled for each further one
+	loginDelayMax       = 5 * time.Second
+	loginPruneInterval  = 10 * time.Minute
+	loginSubjectMaxSize = 255
+)
+
+// LoginGuard protects logins against brute forcing. failed logins are counted per username
+// and per client IP; each failure delays the response a little longer and reaching the limit
+// locks logins for that username or IP for a while. wrong share link passcodes are counted
+// the same way, per share link and IP. a nil LoginGuard allows everything.
+type LoginGuard struct {
+	Repo          repository.LoginFailureRepositoryInterface
+	MaxFailures   int // per username or share link
+	IPMaxFailures int // per client IP, 0 counts no IPs
+	Window        time.Duration
+	Lockout       time.Duration
+
+	mu        sync.Mutex // serializes counter updates
+	lastPrune time.Time
+}
+
+// NewLoginGuard creates a LoginGuard from the configuration, or nil when lockouts are disabled
+func NewLoginGuard(repo repository.LoginFailureRepositoryInterface, cfg config.Config) *LoginGuard {
+	if cfg.LoginMaxFailures <= 0 {
+		return nil
+	}
+	return &LoginGuard{
+		Repo:          repo,
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		Window:        time.Duration(cfg.LoginFailureWindowMinutes) * time.Minute,
+		Lockout:       time.Duration(cfg.LoginLockoutMinutes) * time.Minute,
+	}
+}
+
+// remoteIP returns the client IP of a request. RemoteAddr has already been rewritten from
+// proxy headers by the RealIP middleware.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// loginSubject normalizes a username so variations of it share a counter
+func loginSubject(username string) string {
+	subject := strings.ToLower(strings.TrimSpace(username))
+	if len(subject) > loginSubjectMaxSize {
+		subject = subject[:loginSubjectMaxSize]
+	}
+	return subject
+}
+
+// subjects lists the counters a login attempt affects
+func (g *LoginGuard) subjects(username, ip string) [][2]string {
+	return g.withIP([2]string{models.LoginSubjectUsername, loginSubject(username)}, ip)
+}
+
+// shareSubjects lists the counters a passcode attempt on a share link affects
+func (g *LoginGuard) shareSubjects(linkID uint, ip string) [][2]string {
+	return g.withIP([2]string{models.LoginSubjectShareLink, strconv.FormatUint(uint64(linkID), 10)}, ip)
+}
+
+// withIP adds the counter of the client IP to the counter of what was guessed at
+func (g *LoginGuard) withIP(subject [2]string, ip string) [][2]string {
+	subjects := [][2]string{subject}
+	if g.IPMaxFailures > 0 && ip != "" {
+		subjects = append(subjects, [2]string{models.LoginSubjectIP, ip})
+	}
+	return subjects
+}
+
+// LockedUntil returns when the lockout of a username or IP ends, or the zero time if neither
+// is locked
+func (g *LoginGuard) LockedUntil(username, ip string) time.Time {
+	if g == nil {
+		return time.Time{}
+	}
+	return g.lockedUntil(g.subjects(username, ip))
+}
+
+// ShareLockedUntil returns when the passcode lockout of a share link or IP ends, or the zero
+// time if neither is locked
+func (g *LoginGuard) ShareLockedUntil(linkID uint, ip string) time.Time {
+	if g == nil {
+		return time.Time{}
+	}
+	return g.lockedUntil(g.shareSubjects(linkID, ip))
+}
+
+func (g *LoginGuard) lockedUntil(subjects [][2]string) time.Time {
+	now := time.Now().Unix()
+	var until int64
+	for _, s := range subjects {
+		failure, err := g.Repo.Get(s[0], s[1])
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Login guard: %v", err)
+			}
+			continue
+		}
+		if failure.IsLocked(now) && failure.LockedUntil > until {
+			until = failure.LockedUntil
+		}
+	}
+	if until == 0 {
+		return time.Time{}
+	}
+	return time.Unix(until, 0)
+}
+
+// RecordFailure counts a failed login and returns how long to delay the response
+func (g *LoginGuard) RecordFailure(username, ip string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	return g.recordFailure(g.subjects(username, ip))
+}
+
+// RecordShareFailure counts a wrong passcode for a share link and returns how long to delay
+// the response
+func (g *LoginGuard) RecordShareFailure(linkID uint, ip string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	return g.recordFailure(g.shareSubjects(linkID, ip))
+}
+
+// recordFailure counts a failure for each subject. the delay grows with the failures of the
+// username or share link, not those of the IP.
+func (g *LoginGuard) recordFailure(subjects [][2]string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.pruneLocked(now)
+	windowStart := now.Add(-g.Window).Unix()
+	maxFailures := 0
+	for _, s := range subjects {
+		failure, err := g.Repo.Get(s[0], s[1])
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Login guard: %v", err)
+				continue
+			}
+			failure = &models.LoginFailure{Kind: s[0], Subject: s[1]}
+		}
+		// start over once the failures have aged out or an earlier lockout has ended
+		if (failure.LockedUntil != 0 && !failure.IsLocked(now.Unix())) || failure.LastFailureAt < windowStart {
+			failure.Failures = 0
+			failure.LockedUntil = 0
+		}
+		failure.Failures++
+		failure.LastFailureAt = now.Unix()
+
+		limit := g.MaxFailures
+		if failure.Kind == models.LoginSubjectIP {
+			limit = g.IPMaxFailures
+		}
+		if failure.Failures >= limit && failure.LockedUntil == 0 {
+			failure.LockedUntil = now.Add(g.Lockout).Unix()
+			log.Printf("Login guard: locked logins for %s '%s' until %s after %d failures", failure.Kind, failure.Subject, time.Unix(failure.LockedUntil, 0).Format(time.RFC3339), failure.Failures)
+		}
+		if err := g.Repo.Save(failure); err != nil {
+			log.Printf("Login guard: %v", err)
+		}
+		if failure.Kind != models.LoginSubjectIP && failure.Failures > maxFailures {
+			maxFailures = failure.Failures
+		}
+	}
+	return loginDelay(maxFailures)
+}
+
+// loginDelay is the progressive delay after the given number of consecutive failures
+func loginDelay(failures int) time.Duration {
+	if failures < 2 {
+		return 0
+	}
+	delay := loginDelayBase
+	for i := 2; i < failures && delay < loginDelayMax; i++ {
+		delay *= 2
+	}
+	if delay > loginDelayMax {
+		delay = loginDelayMax
+	}
+	return delay
+}
+
+// RecordSuccess clears the failures of a username after a successful login. the IP counter
+// is kept so one valid account can't be used to reset it.
+func (g *LoginGuard) RecordSuccess(username string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.Repo.Delete(models.LoginSubjectUsername, loginSubject(username)); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Login guard: %v", err)
+	}
+}
+
+// RecordShareSuccess clears the failures of a share link after its passcode was entered
+func (g *LoginGuard) RecordShareSuccess(linkID uint) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.Repo.Delete(models.LoginSubjectShareLink, strconv.FormatUint(uint64(linkID), 10)); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Login guard: %v", err)
+	}
+}
+
+// Active returns the counters with recent failures or a running lockout
+func (g *LoginGuard) Active() ([]models.LoginFailure, error) {
+	now := time.Now()
+	return g.Repo.ListActive(now.Add(-g.Window).Unix(), now.Unix())
+}
+
+// Unlock lifts the lockout and clears the failures of a username or IP. returns
+// gorm.ErrRecordNotFound if there were none.
+func (g *LoginGuard) Unlock(kind, subject string) error {
+	if kind == models.LoginSubjectUsername {
+		subject = loginSubject(subject)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Repo.Delete(kind, subject)
+}
+
+// pruneLocked removes stale counters now and then. callers must hold g.mu.
+func (g *LoginGuard) pruneLocked(now time.Time) {
+	if now.Sub(g.lastPrune) < loginPruneInterval {
+		return
+	}
+	g.lastPrune = now
+	if err := g.Repo.DeleteStale(now.Add(-g.Window).Unix(), now.Unix()); err != nil {
+		log.Printf("Login guard: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+const (
+	// maxMapZoom is the highest zoom level the map API clusters for, as in most tile servers
+	maxMapZoom = 22
+	// mapClusterCellSize is the side, in screen pixels, of the grid cells images are clustered in
+	mapClusterCellSize = 64
+	// mapTileSize is the side, in pixels, of a Web Mercator tile
+	mapTileSize = 256
+	// maxMercatorLatitude is where Web Mercator maps are cut off
+	maxMercatorLatitude = 85.05112878
+)
+
+type MapHandler struct {
+	ImageRepo repository.ImageRepositoryInterface
+	AlbumRepo repository.AlbumRepositoryInterface
+	Cfg       config.Config
+}
+
+// NewMapHandler creates a new MapHandler
+func NewMapHandler(imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, cfg config.Config) *MapHandler {
+	return &MapHandler{ImageRepo: imageRepo, AlbumRepo: albumRepo, Cfg: cfg}
+}
+
+// MapBounds is a box in decimal degrees
+type MapBounds struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// MapCluster is a group of images that are close together at the requested zoom level
+type MapCluster struct {
+	Latitude  float64   `json:"latitude"` // centroid of the images
+	Longitude float64   `json:"longitude"`
+	Count     int       `json:"count"`
+	Bounds    MapBounds `json:"bounds"`          // covers every image of the cluster, for zooming in on it
+	Cover     *FileInfo `json:"cover,omitempty"` // the most recently taken image, or the only one when Count is 1
+}
+
+// MapResponse is the clustered map view of the geotagged images
+type MapResponse struct {
+	Zoom     int          `json:"zoom"`
+	Total    int          `json:"total"` // geotagged images within the requested bounds
+	Clusters []MapCluster `json:"clusters"`
+}
+
+// GetMapImages returns the geotagged images clustered for a map view at a zoom level. images
+// whose Web Mercator position falls in the same grid cell of mapClusterCellSize pixels are
+// merged, so zooming in splits clusters apart. bbox limits the images to a west,south,east,north
+// box, e.g. the visible part of the map.
+// Route: GET /api/map/images?zoom=...&bbox=...
+func (mh *MapHandler) GetMapImages(w http.ResponseWriter, r *http.Request) {
+	zoom := 0
+	if raw := r.URL.Query().Get("zoom"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > maxMapZoom {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "zoom must be an integer from 0 to " + strconv.Itoa(maxMapZoom)})
+			return
+		}
+		zoom = v
+	}
+
+	var bounds *repository.GeoBounds
+	if raw := r.URL.Query().Get("bbox"); raw != "" {
+		parsed, err := parseBBox(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		bounds = parsed
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(mh.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for map: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load map images"})
+		return
+	}
+
+	points, err := mh.ImageRepo.ListGeoPoints(bounds, hidesNSFW(mh.Cfg, r), hiddenFolders)
+	if err != nil {
+		log.Printf("Error listing geotagged images for map: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load map images"})
+		return
+	}
+
+	clusters, covers := clusterGeoPoints(points, zoom)
+	if len(covers) > 0 {
+		images, err := mh.ImageRepo.GetImagesByPaths(covers)
+		if err != nil {
+			log.Printf("Error loading cover images for map: %v", err)
+		}
+		files := make(map[string]*FileInfo, len(images))
+		for i := range images {
+			file := fileInfoFromImage(&images[i], mh.Cfg)
+			files[images[i].OriginalPath] = &file
+		}
+		for i := range clusters {
+			clusters[i].Cover = files[covers[i]]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, MapResponse{Zoom: zoom, Total: len(points), Clusters: clusters})
+}
+
+// parseBBox parses a west,south,east,north box. west may exceed east for a box that crosses
+// the antimeridian.
+func parseBBox(raw string) (*repository.GeoBounds, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox must be west,south,east,north")
+	}
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errors.New("bbox must be west,south,east,north")
+		}
+		values[i] = v
+	}
+	bounds := &repository.GeoBounds{West: values[0], South: values[1], East: values[2], North: values[3]}
+	if bounds.South < -90 || bounds.North > 90 || bounds.South > bounds.North {
+		return nil, errors.New("bbox latitudes must be from -90 to 90, south first")
+	}
+	if bounds.West < -180 || bounds.West > 180 || bounds.East < -180 || bounds.East > 180 {
+		return nil, errors.New("bbox longitudes must be from -180 to 180")
+	}
+	return bounds, nil
+}
+
+// clusterGeoPoints merges the points in each mapClusterCellSize grid cell at a zoom level. it
+// returns the clusters, largest first, and the path of the cover image of each.
+func clusterGeoPoints(points []repository.GeoPoint, zoom int) ([]MapCluster, []string) {
+	type cell struct{ x, y int }
+	type accumulator struct {
+		cluster MapCluster
+		latSum  float64
+		lonSum  float64
+		cover   *repository.GeoPoint
+	}
+
+	worldSize := float64(mapTileSize) * math.Exp2(float64(zoom))
+	cells := make(map[cell]*accumulator)
+	var order []cell
+	for i := range points {
+		p := &points[i]
+		x, y := mercatorPixel(p.Latitude, p.Longitude, worldSize)
+		key := cell{int(x / mapClusterCellSize), int(y / mapClusterCellSize)}
+
+		acc, ok := cells[key]
+		if !ok {
+			acc = &accumulator{cluster: MapCluster{Bounds: MapBounds{West: p.Longitude, South: p.Latitude, East: p.Longitude, North: p.Latitude}}}
+			cells[key] = acc
+			order = append(order, key)
+		}
+		acc.cluster.Count++
+		acc.latSum += p.Latitude
+		acc.lonSum += p.Longitude
+		acc.cluster.Bounds.West = math.Min(acc.cluster.Bounds.West, p.Longitude)
+		acc.cluster.Bounds.East = math.Max(acc.cluster.Bounds.East, p.Longitude)
+		acc.cluster.Bounds.South = math.Min(acc.cluster.Bounds.South, p.Latitude)
+		acc.cluster.Bounds.North = math.Max(acc.cluster.Bounds.North, p.Latitude)
+		if acc.cover == nil || newerGeoPoint(p, acc.cover) {
+			acc.cover = p
+		}
+	}
+
+	accumulators := make([]*accumulator, len(order))
+	for i, key := range order {
+		acc := cells[key]
+		acc.cluster.Latitude = acc.latSum / float64(acc.cluster.Count)
+		acc.cluster.Longitude = acc.lonSum / float64(acc.cluster.Count)
+		accumulators[i] = acc
+	}
+	sort.SliceStable(accumulators, func(i, j int) bool {
+		return accumulators[i].cluster.Count > accumulators[j].cluster.Count
+	})
+
+	clusters := make([]MapCluster, len(accumulators))
+	covers := make([]string, len(accumulators))
+	for i, acc := range accumulators {
+		clusters[i] = acc.cluster
+		covers[i] = acc.cover.OriginalPath
+	}
+	return clusters, covers
+}
+
+// mercatorPixel projects a position to Web Mercator pixel coordinates in a world of the given size
+func mercatorPixel(lat, lon, worldSize float64) (float64, float64) {
+	lat = math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, lat))
+	sinLat := math.Sin(lat * math.Pi / 180)
+	x := (lon + 180) / 360 * worldSize
+	y := (0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)) * worldSize
+	// keep the east edge and the south cut-off in the last cell
+	return math.Min(x, worldSize-1), math.Min(math.Max(y, 0), worldSize-1)
+}
+
+// newerGeoPoint reports whether a was taken after b. images without a capture time come last.
+func newerGeoPoint(a, b *repository.GeoPoint) bool {
+	if a.TakenAt == nil || b.TakenAt == nil {
+		return a.TakenAt != nil
+	}
+	return *a.TakenAt > *b.TakenAt
+}
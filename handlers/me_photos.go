@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// MePhotosHandler lists the photos of the person a user is linked to
+type MePhotosHandler struct {
+	ImageRepo  repository.ImageRepositoryInterface
+	AlbumRepo  repository.AlbumRepositoryInterface
+	RatingRepo repository.ImageRatingRepositoryInterface
+	Cfg        config.Config
+}
+
+// NewMePhotosHandler creates a new MePhotosHandler
+func NewMePhotosHandler(imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, ratingRepo repository.ImageRatingRepositoryInterface, cfg config.Config) *MePhotosHandler {
+	return &MePhotosHandler{ImageRepo: imageRepo, AlbumRepo: albumRepo, RatingRepo: ratingRepo, Cfg: cfg}
+}
+
+// ListMyPhotos returns a page of the images in which the person linked to the authenticated
+// user is tagged, newest first, in the same shape as album contents. only images in albums
+// the user may view the content of are included. the album filter params narrow them down
+// further.
+// Route: GET /api/me/photos?offset=...&limit=...
+func (h *MePhotosHandler) ListMyPhotos(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	if user.PersonID == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Your account is not linked to a person"})
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter, _, err := parseImageFilterParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	albums, err := h.AlbumRepo.ListAllAdmin()
+	if err != nil {
+		log.Printf("Error listing albums for photos of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list photos"})
+		return
+	}
+	for i := range albums {
+		if canAccessAlbum(user, &albums[i], "album.view.content") {
+			filter.Subtrees = append(filter.Subtrees, albums[i].FolderPath)
+		}
+	}
+	listing := DirectoryListing{Path: "/me/photos", Files: []FileInfo{}}
+	if len(filter.Subtrees) == 0 {
+		listing.paginate(offset, limit, 0)
+		writeJSON(w, http.StatusOK, listing)
+		return
+	}
+	filter.PersonIDs = []uint{*user.PersonID}
+
+	images, total, err := h.ImageRepo.ListFiltered(filter, database.SortDateDesc, offset, limit)
+	if err != nil {
+		log.Printf("Error listing photos of person %d for user %d: %v", *user.PersonID, user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list photos"})
+		return
+	}
+	for i := range images {
+		listing.Files = append(listing.Files, fileInfoFromImage(&images[i], h.Cfg))
+	}
+	annotateRatings(h.RatingRepo, user, listing.Files)
+	listing.paginate(offset, limit, int(total))
+	writeJSON(w, http.StatusOK, listing)
+}
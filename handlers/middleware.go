@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/camden-git/mediasysbackend/models" // Added import
 	"github.com/camden-git/mediasysbackend/repository"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions.
@@ -20,9 +23,10 @@ const (
 	UserContextKey ContextKey = "user"
 )
 
-// AuthMiddleware creates a middleware handler for JWT authentication.
+// AuthMiddleware creates a middleware handler for JWT and personal API token authentication.
 // It verifies the token and, if valid, fetches the user and adds them to the request context.
-func AuthMiddleware(userRepo repository.UserRepository, next http.Handler) http.Handler {
+// Users authenticated with an API token carry it on User.APIToken, limiting their permissions.
+func AuthMiddleware(userRepo repository.UserRepository, apiTokenRepo repository.ApiTokenRepository, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -37,6 +41,18 @@ func AuthMiddleware(userRepo repository.UserRepository, next http.Handler) http.
 		}
 		tokenString := parts[1]
 
+		if models.IsApiToken(tokenString) {
+			user, err := authenticateApiToken(userRepo, apiTokenRepo, tokenString)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			touchLastSeen(userRepo, user)
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		claims := &jwt.RegisteredClaims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -76,12 +92,70 @@ func AuthMiddleware(userRepo repository.UserRepository, next http.Handler) http.
 			return
 		}
 
+		touchLastSeen(userRepo, user)
+
 		// Add user to context
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// OptionalAuthMiddleware authenticates requests that carry an Authorization header like
+// AuthMiddleware, and lets anonymous requests through without a user in the context.
+func OptionalAuthMiddleware(userRepo repository.UserRepository, apiTokenRepo repository.ApiTokenRepository, next http.Handler) http.Handler {
+	authenticated := AuthMiddleware(userRepo, apiTokenRepo, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// how often the last request of a user is recorded, to spare a write on every request
+const lastSeenResolution = 5 * time.Minute
+
+// touchLastSeen records that a user made an authenticated request, for the active users
+// count of the admin stats
+func touchLastSeen(userRepo repository.UserRepository, user *models.User) {
+	now := time.Now()
+	if user.LastSeenAt != nil && now.Sub(*user.LastSeenAt) < lastSeenResolution {
+		return
+	}
+	if err := userRepo.TouchLastSeen(user.ID, now); err != nil {
+		log.Printf("Error updating last seen time of user %d: %v", user.ID, err)
+		return
+	}
+	user.LastSeenAt = &now
+}
+
+// authenticateApiToken resolves a personal API token to its owner, with the token attached
+// so permission checks are restricted to the token's scopes
+func authenticateApiToken(userRepo repository.UserRepository, apiTokenRepo repository.ApiTokenRepository, tokenString string) (*models.User, error) {
+	apiToken, err := apiTokenRepo.GetByTokenHash(models.HashApiToken(tokenString))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up API token: %v", err)
+		}
+		return nil, errors.New("Invalid API token")
+	}
+	if apiToken.IsExpired() {
+		return nil, errors.New("API token has expired")
+	}
+
+	user, err := userRepo.GetByID(apiToken.UserID)
+	if err != nil {
+		return nil, errors.New("User not found")
+	}
+	user.APIToken = apiToken
+
+	if err := apiTokenRepo.TouchLastUsed(apiToken.ID, time.Now()); err != nil {
+		log.Printf("Error updating last use of API token %d: %v", apiToken.ID, err)
+	}
+	return user, nil
+}
+
 // RequireGlobalPermission is a middleware that checks if the authenticated user has
 // a specific global permission. It should be used after AuthMiddleware.
 func RequireGlobalPermission(requiredPermission string, next http.Handler) http.Handler {
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// NotificationHandler serves the signed in user's email notification preferences
+type NotificationHandler struct {
+	Repo repository.NotificationRepositoryInterface
+}
+
+func NewNotificationHandler(repo repository.NotificationRepositoryInterface) *NotificationHandler {
+	return &NotificationHandler{Repo: repo}
+}
+
+// NotificationPreferencesResponse maps each notification type to whether it is emailed
+type NotificationPreferencesResponse struct {
+	Email      map[string]bool `json:"email"`
+	HasAddress bool            `json:"has_address"` // false if the user has no email address, so nothing is sent
+}
+
+func (h *NotificationHandler) writePreferences(w http.ResponseWriter, user *models.User) {
+	preferences, err := h.Repo.GetPreferences(user.ID)
+	if err != nil {
+		log.Printf("Error getting notification preferences of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get notification preferences"})
+		return
+	}
+	writeJSON(w, http.StatusOK, NotificationPreferencesResponse{
+		Email:      preferences,
+		HasAddress: user.Email != nil && *user.Email != "",
+	})
+}
+
+// GetPreferences handles GET /api/auth/me/notifications
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	h.writePreferences(w, user)
+}
+
+// UpdatePreferences handles PUT /api/auth/me/notifications. the body is {"email": {"<type>": bool}};
+// types that are left out keep their current setting.
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	var payload struct {
+		Email map[string]bool `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	for notificationType := range payload.Email {
+		if _, known := models.DefaultNotificationPreferences[notificationType]; !known {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown notification type: " + notificationType})
+			return
+		}
+	}
+	for notificationType, enabled := range payload.Email {
+		if err := h.Repo.SetPreference(user.ID, notificationType, enabled); err != nil {
+			log.Printf("Error updating notification preferences of user %d: %v", user.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update notification preferences"})
+			return
+		}
+	}
+	h.writePreferences(w, user)
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	oEmbedProviderName = "mediasys"
+
+	// size of the album widget iframe, unless the consumer asks for a smaller one
+	embedDefaultWidth  = 600
+	embedDefaultHeight = 400
+
+	// number of thumbnails in the album widget, unless the limit query param asks otherwise
+	embedDefaultLimit = 12
+	embedMaxLimit     = 60
+)
+
+// OEmbedResponse is an oEmbed 1.0 response, see https://oembed.com. albums are "rich" and
+// embedded with the album widget, images are "photo" pointing at a thumbnail, and videos are
+// a "link" with their poster as the thumbnail.
+type OEmbedResponse struct {
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	Title           string `json:"title,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	URL             string `json:"url,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	HTML            string `json:"html,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+}
+
+// fitThumbnail picks the largest stored thumbnail of an image that fits within maxWidth by
+// maxHeight, 0 meaning no bound, or the smallest one when none fits. ok is false when the
+// image has no thumbnail or its dimensions are unknown.
+func fitThumbnail(cfg config.Config, img *models.Image, maxWidth, maxHeight int) (thumbURL string, width, height int, ok bool) {
+	if img.ThumbnailPath == nil || img.ThumbnailStatus != database.StatusDone || img.Width == nil || img.Height == nil || *img.Width <= 0 || *img.Height <= 0 {
+		return "", 0, 0, false
+	}
+	sizes := map[int]string{cfg.ThumbnailMaxSize: *img.ThumbnailPath}
+	for size, sizePath := range img.ThumbnailSizes {
+		sizes[size] = sizePath
+	}
+	ordered := make([]int, 0, len(sizes))
+	for size := range sizes {
+		ordered = append(ordered, size)
+	}
+	sort.Ints(ordered)
+
+	longest := max(*img.Width, *img.Height)
+	dimensions := func(size int) (int, int) {
+		scale := float64(min(size, longest)) / float64(longest)
+		return max(1, int(math.Round(float64(*img.Width)*scale))), max(1, int(math.Round(float64(*img.Height)*scale)))
+	}
+	chosen := ordered[0]
+	for _, size := range ordered {
+		w, h := dimensions(size)
+		if (maxWidth == 0 || w <= maxWidth) && (maxHeight == 0 || h <= maxHeight) {
+			chosen = size
+		}
+	}
+	width, height = dimensions(chosen)
+	return thumbnailURL(cfg, sizes[chosen]), width, height, true
+}
+
+// parseEmbedSize reads a positive integer query param, 0 when it is absent
+func parseEmbedSize(r *http.Request, name string) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return v, nil
+}
+
+// GetOEmbed describes a public album or image for chat apps and sites embedding it. url is
+// the album page of the web app, e.g. https://photos.example.com/album/trip, its share page
+// under /api/share/albums, or the URL of an original under /api. as consumers fetch
+// anonymously, hidden albums and the images in them are refused as private, and NSFW images
+// follow NSFW_HIDE_PUBLIC. only the json format is supported.
+// Route: GET /api/oembed?url=...&maxwidth=...&maxheight=...&format=json
+func (ah *AlbumHandler) GetOEmbed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if format := q.Get("format"); format != "" && format != "json" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "Only the json format is supported"})
+		return
+	}
+	maxWidth, err := parseEmbedSize(r, "maxwidth")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	maxHeight, err := parseEmbedSize(r, "maxheight")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	target, err := url.Parse(q.Get("url"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "url must be an http or https URL"})
+		return
+	}
+
+	apiOrigin := requestOrigin(r)
+	appOrigin := ah.Cfg.PublicURL
+	if appOrigin == "" {
+		appOrigin = apiOrigin
+	}
+	// only URLs of this server or of the web app are described
+	ownHost := false
+	for _, origin := range []string{apiOrigin, appOrigin} {
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, target.Host) {
+			ownHost = true
+		}
+	}
+	if !ownHost {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "URL does not belong to this server"})
+		return
+	}
+
+	response := OEmbedResponse{Version: "1.0", ProviderName: oEmbedProviderName, ProviderURL: appOrigin}
+	targetPath := target.Path
+	var albumIdentifier string
+	for _, prefix := range []string{"/album/", "/api/share/albums/", "/api/albums/", "/api/embed/albums/"} {
+		if rest, ok := strings.CutPrefix(targetPath, prefix); ok {
+			albumIdentifier, _, _ = strings.Cut(rest, "/")
+			break
+		}
+	}
+
+	if albumIdentifier != "" {
+		album, err := ah.getAlbumByIdentifier(albumIdentifier)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// links shared before the slug of the album was changed
+			album, err = ah.AlbumRepo.GetBySlugRedirect(albumIdentifier)
+		}
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+			} else {
+				log.Printf("Error getting album '%s' for oEmbed: %v", albumIdentifier, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album information"})
+			}
+			return
+		}
+		if !canAccessAlbum(nil, album, "album.view.content") {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Album is private"})
+			return
+		}
+		width, height := embedDefaultWidth, embedDefaultHeight
+		if maxWidth > 0 {
+			width = min(width, maxWidth)
+		}
+		if maxHeight > 0 {
+			height = min(height, maxHeight)
+		}
+		widgetURL := apiOrigin + "/api/embed/albums/" + url.PathEscape(album.Slug)
+		response.Type = "rich"
+		response.Title = album.Name
+		response.Width = width
+		response.Height = height
+		response.HTML = `<iframe src="` + htmlAttr(widgetURL) + `" width="` + strconv.Itoa(width) + `" height="` + strconv.Itoa(height) +
+			`" title="` + htmlAttr(album.Name) + `" frameborder="0" loading="lazy" style="border:0"></iframe>`
+		latest, err := ah.ImageRepo.ListRecent(repository.ImageFilter{Folder: album.FolderPath, MediaType: database.MediaTypeImage, ExcludeNSFW: ah.Cfg.NSFWHidePublic}, 1)
+		if err != nil {
+			log.Printf("Error getting the latest image of album %d for oEmbed: %v", album.ID, err)
+		} else if len(latest) > 0 {
+			if thumbURL, tw, th, ok := fitThumbnail(ah.Cfg, &latest[0], maxWidth, maxHeight); ok {
+				response.ThumbnailURL, response.ThumbnailWidth, response.ThumbnailHeight = apiOrigin+thumbURL, tw, th
+			}
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	imagePath, ok := strings.CutPrefix(targetPath, "/api/")
+	if !ok || imagePath == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "URL is not an album or image"})
+		return
+	}
+	img, err := ah.ImageRepo.GetByPath(imagePath)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Image not found"})
+		} else {
+			log.Printf("Error getting image '%s' for oEmbed: %v", imagePath, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve image"})
+		}
+		return
+	}
+	if album, err := ah.AlbumRepo.FindByImagePath(img.OriginalPath); err == nil && !canAccessAlbum(nil, album, "album.view.content") {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Image is private"})
+		return
+	}
+	if ah.Cfg.NSFWHidePublic && img.IsNSFWHidden() {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Image is private"})
+		return
+	}
+
+	response.Title = path.Base(img.OriginalPath)
+	if img.Description != nil && *img.Description != "" {
+		response.Title = *img.Description
+	}
+	thumbURL, tw, th, ok := fitThumbnail(ah.Cfg, img, maxWidth, maxHeight)
+	if img.MediaType != database.MediaTypeImage || !ok {
+		response.Type = "link"
+		if ok {
+			response.ThumbnailURL, response.ThumbnailWidth, response.ThumbnailHeight = apiOrigin+thumbURL, tw, th
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	response.Type = "photo"
+	response.URL, response.Width, response.Height = apiOrigin+thumbURL, tw, th
+	writeJSON(w, http.StatusOK, response)
+}
+
+// EmbedAlbumHTML serves the album widget embedded by the oEmbed html of an album: a grid of
+// the thumbnails of the latest files in the album folder, each opening the album page.
+// Route: GET /api/embed/albums/{album_identifier}?limit=...
+func (ah *AlbumHandler) EmbedAlbumHTML(w http.ResponseWriter, r *http.Request) {
+	identifier := chi.URLParam(r, "album_identifier")
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.NotFound(w, r)
+		} else {
+			log.Printf("Error getting album '%s' for embed: %v", identifier, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	limit := embedDefaultLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(v, embedMaxLimit)
+	}
+	images, err := ah.ImageRepo.ListRecent(repository.ImageFilter{Folder: album.FolderPath, ExcludeNSFW: hidesNSFW(ah.Cfg, r)}, limit)
+	if err != nil {
+		log.Printf("Error listing latest images of album %d for embed: %v", album.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	appOrigin := ah.Cfg.PublicURL
+	if appOrigin == "" {
+		appOrigin = requestOrigin(r)
+	}
+	pageURL := appOrigin + "/album/" + url.PathEscape(album.Slug)
+
+	html := "<!doctype html><html lang=\"en\"><head>" +
+		"<meta charset=\"utf-8\">" +
+		"<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">" +
+		"<title>" + htmlEscape(album.Name) + "</title>" +
+		"<style>" +
+		"body{margin:0;font-family:system-ui,sans-serif;background:#111;color:#eee}" +
+		"header{padding:8px 12px;font-size:15px}header a{color:inherit;text-decoration:none}" +
+		".grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(120px,1fr));gap:4px;padding:0 4px 4px}" +
+		".grid a{display:block;aspect-ratio:1;background:#222}" +
+		".grid img{width:100%;height:100%;object-fit:cover;display:block}" +
+		"</style></head><body>" +
+		"<header><a href=\"" + htmlAttr(pageURL) + "\" target=\"_blank\" rel=\"noopener\">" + htmlEscape(album.Name) + "</a></header>" +
+		"<div class=\"grid\">"
+	for i := range images {
+		img := &images[i]
+		if img.ThumbnailPath == nil || img.ThumbnailStatus != database.StatusDone {
+			continue
+		}
+		html += "<a href=\"" + htmlAttr(pageURL) + "\" target=\"_blank\" rel=\"noopener\">" +
+			"<img src=\"" + htmlAttr(thumbnailURL(ah.Cfg, *img.ThumbnailPath)) + "\" alt=\"" + htmlAttr(path.Base(img.OriginalPath)) + "\" loading=\"lazy\"></a>"
+	}
+	html += "</div></body></html>"
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(html))
+}
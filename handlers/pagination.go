@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPageLimit caps the limit query param of paginated listings
+const maxPageLimit = 1000
+
+// parsePageParams reads the offset, limit and cursor query params of a listing. a cursor,
+// taken from the next_cursor of a previous page, takes precedence over offset. a missing
+// or invalid limit falls back to defaultLimit, where 0 means the whole listing, and an
+// invalid offset to 0, as listings always have. only a cursor that can't be decoded is an
+// error, as it can't have come from a previous page.
+func parsePageParams(r *http.Request, defaultLimit int) (int, int, error) {
+	q := r.URL.Query()
+	offset := 0
+	limit := defaultLimit
+
+	if o := q.Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+	if c := q.Get("cursor"); c != "" {
+		v, err := decodeCursor(c)
+		if err != nil {
+			return 0, 0, err
+		}
+		offset = v
+	}
+	if l := q.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return offset, limit, nil
+}
+
+// encodeCursor turns a listing offset into an opaque cursor token
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	value, ok := strings.CutPrefix(string(raw), "o:")
+	if !ok {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
+
+// paginate fills in the pagination fields of a listing page that starts at offset. limit 0
+// means the page holds the rest of the listing.
+func (listing *DirectoryListing) paginate(offset, limit, total int) {
+	listing.Total = total
+	listing.Offset = offset
+	listing.Limit = limit
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	} else if limit <= 0 {
+		listing.Limit = len(listing.Files)
+	}
+	listing.HasMore = end < total
+	if listing.HasMore {
+		listing.NextCursor = encodeCursor(end)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/email"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+// PasswordResetHandler lets users who forgot their password set a new one through a link
+// sent to their email address
+type PasswordResetHandler struct {
+	UserRepo         repository.UserRepository
+	NotificationRepo repository.NotificationRepositoryInterface
+	Notifier         *email.Notifier
+	Cfg              config.Config
+}
+
+func NewPasswordResetHandler(userRepo repository.UserRepository, notificationRepo repository.NotificationRepositoryInterface, notifier *email.Notifier, cfg config.Config) *PasswordResetHandler {
+	return &PasswordResetHandler{UserRepo: userRepo, NotificationRepo: notificationRepo, Notifier: notifier, Cfg: cfg}
+}
+
+type PasswordResetRequestPayload struct {
+	Login string `json:"login"` // username or email address
+}
+
+type PasswordResetConfirmPayload struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// RequestReset emails a reset link to the account matching a username or email address. the
+// response is the same whether or not an account matched, so it can't be used to discover
+// accounts.
+func (h *PasswordResetHandler) RequestReset(w http.ResponseWriter, r *http.Request) {
+	var payload PasswordResetRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Invalid request payload")
+		return
+	}
+	login := strings.TrimSpace(payload.Login)
+	if login == "" {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", "login is required")
+		return
+	}
+	if !h.Notifier.Enabled() {
+		WriteAPIError(w, http.StatusServiceUnavailable, "DisplayException", "Password resets are unavailable because email is not configured.")
+		return
+	}
+
+	var user *models.User
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = h.UserRepo.GetByEmail(login)
+	} else {
+		user, err = h.UserRepo.GetByUsername(login)
+	}
+	switch {
+	case err == nil && user.Email != nil:
+		h.sendResetEmail(user)
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		log.Printf("Password reset: failed to look up '%s': %v", login, err)
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "If an account with an email address matches, a reset link has been sent to it."})
+}
+
+// sendResetEmail creates a reset token for a user and emails it in the background
+func (h *PasswordResetHandler) sendResetEmail(user *models.User) {
+	token, hash, err := models.GeneratePasswordResetToken()
+	if err != nil {
+		log.Printf("Password reset: %v", err)
+		return
+	}
+	expiry := time.Duration(h.Cfg.PasswordResetExpiryMinutes) * time.Minute
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(expiry).Unix(),
+	}
+	if err := h.NotificationRepo.CreatePasswordResetToken(resetToken); err != nil {
+		log.Printf("Password reset: %v", err)
+		return
+	}
+	go func() {
+		if err := h.Notifier.PasswordReset(user, token, expiry); err != nil {
+			log.Printf("Password reset: failed to email user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+// ConfirmReset sets a new password using the token from a reset email
+func (h *PasswordResetHandler) ConfirmReset(w http.ResponseWriter, r *http.Request) {
+	var payload PasswordResetConfirmPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "InvalidPayloadException", "Invalid request payload")
+		return
+	}
+	if payload.Token == "" || payload.Password == "" {
+		WriteAPIError(w, http.StatusBadRequest, "ValidationException", "token and password are required")
+		return
+	}
+
+	resetToken, err := h.NotificationRepo.ConsumePasswordResetToken(models.HashEmailToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteAPIError(w, http.StatusBadRequest, "DisplayException", "This reset link is invalid or has expired.")
+			return
+		}
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to check reset token: "+err.Error())
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(resetToken.UserID)
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "DisplayException", "This reset link is invalid or has expired.")
+		return
+	}
+	if err := user.SetPassword(payload.Password); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "HashingException", "Failed to hash password: "+err.Error())
+		return
+	}
+	if err := h.UserRepo.Update(user); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "PersistenceException", "Failed to update password: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password updated. Please log in."})
+}
@@ -3,26 +3,116 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"image"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/services"
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm" // For gorm.ErrRecordNotFound
 )
 
 type PersonHandler struct {
-	PersonRepo repository.PersonRepositoryInterface
+	PersonRepo     repository.PersonRepositoryInterface
+	FaceRepo       repository.FaceRepositoryInterface
+	ImageRepo      repository.ImageRepositoryInterface
+	AlbumRepo      repository.AlbumRepositoryInterface // leaves hidden albums out of a person's images
+	MediaProcessor *media.Processor                    // saves profile photos
+	Cfg            config.Config
+	// purges the embeddings of people who opt out of face recognition
+	FaceRecognitionService *services.FaceRecognitionService
 	// GormDB *gorm.DB
 }
 
+// personResponse is a person with the URL of each size of their profile photo
+type personResponse struct {
+	models.Person
+	PhotoURLs map[string]string `json:"photo_urls,omitempty"`
+}
+
+func newPersonResponse(person *models.Person) personResponse {
+	return personResponse{Person: *person, PhotoURLs: avatarURLs(person.PhotoPath)}
+}
+
+// PersonProfilePayload changes the profile of a person. omitted fields are left as they are;
+// an empty birth_date or description removes it. setting any of them, the recognition opt-out
+// included, needs person.edit.
+type PersonProfilePayload struct {
+	BirthDate   *string `json:"birth_date"` // YYYY-MM-DD
+	Description *string `json:"description"`
+	IsHidden    *bool   `json:"is_hidden"`
+	// opting out purges the embeddings of the person's faces but keeps their tags
+	RecognitionOptOut *bool `json:"recognition_opt_out"`
+}
+
+// changesProfile reports whether the payload sets any of the profile fields or the
+// recognition opt-out
+func (p PersonProfilePayload) changesProfile() bool {
+	return p.BirthDate != nil || p.Description != nil || p.IsHidden != nil || p.RecognitionOptOut != nil
+}
+
+// authorizeProfileChange checks that the user changing the profile of a person, hiding them
+// or their recognition consent included, has the person.edit permission, answering the
+// request when they don't
+func authorizeProfileChange(w http.ResponseWriter, r *http.Request) bool {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return false
+	}
+	if !user.HasGlobalPermission("person.edit") {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Forbidden: requires global permission 'person.edit'"})
+		return false
+	}
+	return true
+}
+
+// apply validates the payload and sets its fields on person
+func (p PersonProfilePayload) apply(person *models.Person) error {
+	if p.BirthDate != nil {
+		birthDate := strings.TrimSpace(*p.BirthDate)
+		if birthDate == "" {
+			person.BirthDate = nil
+		} else {
+			parsed, err := time.Parse(time.DateOnly, birthDate)
+			if err != nil {
+				return errors.New("Invalid birth_date, must be YYYY-MM-DD")
+			}
+			if parsed.After(time.Now()) {
+				return errors.New("Invalid birth_date, must not be in the future")
+			}
+			person.BirthDate = &birthDate
+		}
+	}
+	if p.Description != nil {
+		description := strings.TrimSpace(*p.Description)
+		if description == "" {
+			person.Description = nil
+		} else {
+			person.Description = &description
+		}
+	}
+	if p.IsHidden != nil {
+		person.IsHidden = *p.IsHidden
+	}
+	if p.RecognitionOptOut != nil {
+		person.RecognitionOptOut = *p.RecognitionOptOut
+	}
+	return nil
+}
+
 func (ph *PersonHandler) CreatePerson(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		PrimaryName string   `json:"primary_name"`
 		Aliases     []string `json:"aliases"`
+		PersonProfilePayload
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -34,10 +124,17 @@ func (ph *PersonHandler) CreatePerson(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required field: primary_name"})
 		return
 	}
+	if req.changesProfile() && !authorizeProfileChange(w, r) {
+		return
+	}
 
 	person := models.Person{
 		PrimaryName: req.PrimaryName,
 	}
+	if err := req.PersonProfilePayload.apply(&person); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 
 	err := ph.PersonRepo.Create(&person)
 	if err != nil {
@@ -70,20 +167,23 @@ func (ph *PersonHandler) CreatePerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, createdPerson)
+	writeJSON(w, http.StatusCreated, newPersonResponse(createdPerson))
 }
 
+// ListPeople returns every person, leaving out hidden people for anonymous visitors
+// Route: GET /api/people
 func (ph *PersonHandler) ListPeople(w http.ResponseWriter, r *http.Request) {
-	people, err := ph.PersonRepo.ListAll()
+	people, err := ph.PersonRepo.ListAll(currentUser(r) != nil)
 	if err != nil {
 		log.Printf("Error listing people: %v", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve people"})
 		return
 	}
-	if people == nil {
-		people = []models.Person{}
+	response := make([]personResponse, 0, len(people))
+	for i := range people {
+		response = append(response, newPersonResponse(&people[i]))
 	}
-	writeJSON(w, http.StatusOK, people)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (ph *PersonHandler) GetPerson(w http.ResponseWriter, r *http.Request) {
@@ -104,8 +204,13 @@ func (ph *PersonHandler) GetPerson(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// hidden people are only shown to signed in users
+	if person.IsHidden && currentUser(r) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Person not found"})
+		return
+	}
 	// GetByID should preload aliases if defined in repository method
-	writeJSON(w, http.StatusOK, person)
+	writeJSON(w, http.StatusOK, newPersonResponse(person))
 }
 
 func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +223,7 @@ func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		PrimaryName string `json:"primary_name"`
+		PersonProfilePayload
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
@@ -127,6 +233,9 @@ func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required field: primary_name"})
 		return
 	}
+	if req.changesProfile() && !authorizeProfileChange(w, r) {
+		return
+	}
 
 	personToUpdate, err := ph.PersonRepo.GetByID(uint(personID))
 	if err != nil {
@@ -140,6 +249,10 @@ func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 	}
 
 	personToUpdate.PrimaryName = req.PrimaryName
+	if err := req.PersonProfilePayload.apply(personToUpdate); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 
 	err = ph.PersonRepo.Update(personToUpdate)
 	if err != nil {
@@ -147,6 +260,13 @@ func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update person"})
 		return
 	}
+	if personToUpdate.RecognitionOptOut && ph.FaceRecognitionService != nil {
+		if _, err := ph.FaceRecognitionService.EnforceRecognitionOptOut(personToUpdate.ID); err != nil {
+			log.Printf("Error purging face recognition data of person %d: %v", personID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Person updated, but failed to purge face recognition data"})
+			return
+		}
+	}
 
 	updatedPerson, err := ph.PersonRepo.GetByID(uint(personID))
 	if err != nil {
@@ -154,7 +274,7 @@ func (ph *PersonHandler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]string{"message": "Person updated successfully, but failed to fetch full details."})
 		return
 	}
-	writeJSON(w, http.StatusOK, updatedPerson)
+	writeJSON(w, http.StatusOK, newPersonResponse(updatedPerson))
 }
 
 func (ph *PersonHandler) DeletePerson(w http.ResponseWriter, r *http.Request) {
@@ -165,6 +285,17 @@ func (ph *PersonHandler) DeletePerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	person, err := ph.PersonRepo.GetByID(uint(personID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Person not found"})
+		} else {
+			log.Printf("Error finding person %d for deletion: %v", personID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to find person for deletion"})
+		}
+		return
+	}
+
 	err = ph.PersonRepo.Delete(uint(personID))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -175,9 +306,119 @@ func (ph *PersonHandler) DeletePerson(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	ph.removePhoto(person.PhotoPath)
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// SetProfileFace makes a crop of a face tagged with the person their profile photo
+// Route: PUT /api/people/{person_id}/profile-face with {"face_id": ...}
+func (ph *PersonHandler) SetProfileFace(w http.ResponseWriter, r *http.Request) {
+	person, ok := ph.personFromURL(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		FaceID uint `json:"face_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.FaceID == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required field: face_id"})
+		return
+	}
+
+	face, err := ph.FaceRepo.GetByID(req.FaceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Face not found"})
+		} else {
+			log.Printf("Error getting face %d for the profile of person %d: %v", req.FaceID, person.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve face"})
+		}
+		return
+	}
+	if face.PersonID == nil || *face.PersonID != person.ID {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Face is not tagged with this person"})
+		return
+	}
+
+	// face boxes are found on the upright image, which DecodeImageFile returns
+	img, _, err := media.DecodeImageFile(ph.Cfg.ResolvePath(face.ImagePath))
+	if err != nil {
+		log.Printf("Error reading %s for the profile of person %d: %v", face.ImagePath, person.ID, err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "The image of the face could not be read"})
+		return
+	}
+	photoPath, err := ph.MediaProcessor.ProcessFaceAvatar(img, image.Rect(face.X1, face.Y1, face.X2, face.Y2))
+	if err != nil {
+		log.Printf("Error cropping face %d for the profile of person %d: %v", face.ID, person.ID, err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "The face could not be cropped from its image"})
+		return
+	}
+	if err := ph.PersonRepo.SetProfilePhoto(person.ID, &face.ID, &photoPath); err != nil {
+		ph.removePhoto(&photoPath)
+		log.Printf("Error setting profile photo of person %d: %v", person.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to set profile photo"})
+		return
+	}
+	ph.removePhoto(person.PhotoPath)
+
+	person.ProfileFaceID, person.PhotoPath = &face.ID, &photoPath
+	writeJSON(w, http.StatusOK, newPersonResponse(person))
+}
+
+// DeleteProfileFace removes the profile photo of a person
+// Route: DELETE /api/people/{person_id}/profile-face
+func (ph *PersonHandler) DeleteProfileFace(w http.ResponseWriter, r *http.Request) {
+	person, ok := ph.personFromURL(w, r)
+	if !ok {
+		return
+	}
+	if person.PhotoPath != nil || person.ProfileFaceID != nil {
+		if err := ph.PersonRepo.SetProfilePhoto(person.ID, nil, nil); err != nil {
+			log.Printf("Error removing profile photo of person %d: %v", person.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to remove profile photo"})
+			return
+		}
+		ph.removePhoto(person.PhotoPath)
+	}
 	writeJSON(w, http.StatusNoContent, nil)
 }
 
+// personFromURL reads the {person_id} URL param and gets the person, writing an error
+// response if it is invalid or missing
+func (ph *PersonHandler) personFromURL(w http.ResponseWriter, r *http.Request) (*models.Person, bool) {
+	personID, err := strconv.ParseUint(chi.URLParam(r, "person_id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid person ID format"})
+		return nil, false
+	}
+	person, err := ph.PersonRepo.GetByID(uint(personID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Person not found"})
+		} else {
+			log.Printf("Error getting person %d: %v", personID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve person"})
+		}
+		return nil, false
+	}
+	return person, true
+}
+
+// removePhoto deletes the files of a replaced or removed profile photo. failures only leave
+// orphaned files behind, so they are logged and otherwise ignored.
+func (ph *PersonHandler) removePhoto(photoPath *string) {
+	if photoPath == nil || *photoPath == "" {
+		return
+	}
+	if err := ph.MediaProcessor.DeleteAvatar(*photoPath); err != nil {
+		log.Printf("Warning: Failed to remove old profile photo %s: %v", *photoPath, err)
+	}
+}
+
 func (ph *PersonHandler) AddAlias(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "person_id")
 	personID, err := strconv.ParseUint(idStr, 10, 64)
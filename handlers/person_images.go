@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// PersonImageFace is the bounding box of a person's face in one of their images
+type PersonImageFace struct {
+	ID uint `json:"id"`
+	X1 int  `json:"x1"`
+	Y1 int  `json:"y1"`
+	X2 int  `json:"x2"`
+	Y2 int  `json:"y2"`
+}
+
+// PersonImage is an image a person is tagged in, with the faces tagged as them
+type PersonImage struct {
+	FileInfo
+	Faces []PersonImageFace `json:"faces"`
+}
+
+// PersonImagesResponse is a page of the images a person is tagged in
+type PersonImagesResponse struct {
+	Images     []PersonImage `json:"images"`
+	Total      int           `json:"total"`
+	Offset     int           `json:"offset"`
+	Limit      int           `json:"limit"`
+	HasMore    bool          `json:"has_more"`
+	NextCursor string        `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// ListPersonImages returns a page of the images a person is tagged in, by the date they were
+// taken (newest first unless sort is date_asc), with thumbnails and the bounding boxes of the
+// person's faces in each
+// Route: GET /api/people/{person_id}/images?sort=date_desc|date_asc&offset=...&limit=...
+func (ph *PersonHandler) ListPersonImages(w http.ResponseWriter, r *http.Request) {
+	sortOrder := r.URL.Query().Get("sort")
+	switch sortOrder {
+	case "":
+		sortOrder = database.SortDateDesc
+	case database.SortDateDesc, database.SortDateAsc:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sort, must be date_desc or date_asc"})
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	person, ok := ph.personFromURL(w, r)
+	if !ok {
+		return
+	}
+	// hidden people are only shown to signed in users
+	if person.IsHidden && currentUser(r) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Person not found"})
+		return
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(ph.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for images of person %d: %v", person.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list images of person"})
+		return
+	}
+
+	filter := repository.ImageFilter{PersonIDs: []uint{person.ID}, ExcludeNSFW: hidesNSFW(ph.Cfg, r), ExcludeSubtrees: hiddenFolders}
+	images, total, err := ph.ImageRepo.ListFiltered(filter, sortOrder, offset, limit)
+	if err != nil {
+		log.Printf("Error listing images of person %d: %v", person.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list images of person"})
+		return
+	}
+
+	paths := make([]string, len(images))
+	for i := range images {
+		paths[i] = images[i].OriginalPath
+	}
+	faces, err := ph.FaceRepo.ListByPersonAndImagePaths(person.ID, paths)
+	if err != nil {
+		log.Printf("Error listing faces of person %d: %v", person.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list faces of person"})
+		return
+	}
+	facesByPath := make(map[string][]PersonImageFace, len(images))
+	for _, face := range faces {
+		facesByPath[face.ImagePath] = append(facesByPath[face.ImagePath], PersonImageFace{ID: face.ID, X1: face.X1, Y1: face.Y1, X2: face.X2, Y2: face.Y2})
+	}
+
+	response := PersonImagesResponse{
+		Images: make([]PersonImage, 0, len(images)),
+		Total:  int(total),
+		Offset: offset,
+		Limit:  limit,
+	}
+	for i := range images {
+		imageFaces := facesByPath[images[i].OriginalPath]
+		if imageFaces == nil {
+			imageFaces = []PersonImageFace{}
+		}
+		response.Images = append(response.Images, PersonImage{FileInfo: fileInfoFromImage(&images[i], ph.Cfg), Faces: imageFaces})
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
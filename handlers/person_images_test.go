@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newPersonTestHandler returns a person handler over an empty database, and the database
+func newPersonTestHandler(t *testing.T) (*PersonHandler, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrateModels(db); err != nil {
+		t.Fatal(err)
+	}
+	handler := &PersonHandler{
+		PersonRepo: repository.NewPersonRepository(db),
+		FaceRepo:   repository.NewFaceRepository(db),
+		ImageRepo:  repository.NewImageRepository(db),
+		AlbumRepo:  repository.NewAlbumRepository(db),
+	}
+	return handler, db
+}
+
+// personRequest builds a request for a route of the person with personID
+func personRequest(method, target string, personID uint, body string, user *models.User) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("person_id", strconv.Itoa(int(personID)))
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	if user != nil {
+		ctx = context.WithValue(ctx, UserContextKey, user)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestListPersonImagesLeavesOutHiddenAlbums(t *testing.T) {
+	handler, db := newPersonTestHandler(t)
+	person := &models.Person{PrimaryName: "Ada"}
+	if err := db.Create(person).Error; err != nil {
+		t.Fatal(err)
+	}
+	album := &models.Album{Name: "Private", Slug: "private", FolderPath: "private", IsHidden: true}
+	if err := db.Create(album).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, imagePath := range []string{"public/a.jpg", "private/b.jpg"} {
+		if err := db.Create(&models.Image{OriginalPath: imagePath, LastModified: 1}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&models.Face{PersonID: &person.ID, ImagePath: imagePath, X2: 10, Y2: 10}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		user *models.User
+		want []string
+	}{
+		{"anonymous", nil, []string{"/public/a.jpg"}},
+		{"signed in with album.list", &models.User{ID: 1, GlobalPermissions: []string{"album.list"}}, []string{"/private/b.jpg", "/public/a.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ListPersonImages(w, personRequest(http.MethodGet, "/api/people/1/images?sort=date_asc", person.ID, "", tt.user))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var response PersonImagesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]bool)
+			for _, image := range response.Images {
+				got[image.Path] = true
+			}
+			if len(got) != len(tt.want) || response.Total != len(tt.want) {
+				t.Fatalf("images = %v (total %d), want %v", got, response.Total, tt.want)
+			}
+			for _, want := range tt.want {
+				if !got[want] {
+					t.Errorf("images = %v, missing %s", got, want)
+				}
+			}
+		})
+	}
+}
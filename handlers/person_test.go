@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+func TestUpdatePersonProfileNeedsPersonEdit(t *testing.T) {
+	editor := &models.User{ID: 1, GlobalPermissions: []string{"person.edit"}}
+	viewer := &models.User{ID: 2}
+	tests := []struct {
+		name string
+		body string
+		user *models.User
+		want int
+	}{
+		{"anonymous unhiding", `{"primary_name":"Ada","is_hidden":false}`, nil, http.StatusUnauthorized},
+		{"anonymous description", `{"primary_name":"Ada","description":"x"}`, nil, http.StatusUnauthorized},
+		{"anonymous birth date", `{"primary_name":"Ada","birth_date":"1990-01-01"}`, nil, http.StatusUnauthorized},
+		{"without person.edit", `{"primary_name":"Ada","is_hidden":false}`, viewer, http.StatusForbidden},
+		{"with person.edit", `{"primary_name":"Ada","is_hidden":false}`, editor, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, db := newPersonTestHandler(t)
+			person := &models.Person{PrimaryName: "Ada", IsHidden: true}
+			if err := db.Create(person).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.UpdatePerson(w, personRequest(http.MethodPut, "/api/people/1", person.ID, tt.body, tt.user))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			var stored models.Person
+			if err := db.First(&stored, person.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if changed := stored.IsHidden != person.IsHidden || stored.Description != nil || stored.BirthDate != nil; changed != (tt.want == http.StatusOK) {
+				t.Errorf("person changed = %v after a %d response", changed, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreatePersonProfileNeedsPersonEdit(t *testing.T) {
+	handler, db := newPersonTestHandler(t)
+	w := httptest.NewRecorder()
+	handler.CreatePerson(w, personRequest(http.MethodPost, "/api/people", 0, `{"primary_name":"Ada","is_hidden":true}`, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body.String())
+	}
+	var count int64
+	if err := db.Model(&models.Person{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d people were created", count)
+	}
+}
+
+func TestUpdatePersonRecognitionOptOutNeedsPersonEdit(t *testing.T) {
+	for _, optOut := range []bool{true, false} {
+		t.Run(strconv.FormatBool(optOut), func(t *testing.T) {
+			handler, db := newPersonTestHandler(t)
+			person := &models.Person{PrimaryName: "Ada", RecognitionOptOut: !optOut}
+			if err := db.Create(person).Error; err != nil {
+				t.Fatal(err)
+			}
+			face := &models.Face{PersonID: &person.ID, ImagePath: "a.jpg", X2: 10, Y2: 10}
+			if err := db.Create(face).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			body := `{"primary_name":"Ada","recognition_opt_out":` + strconv.FormatBool(optOut) + `}`
+			w := httptest.NewRecorder()
+			handler.UpdatePerson(w, personRequest(http.MethodPut, "/api/people/1", person.ID, body, nil))
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body.String())
+			}
+
+			var stored models.Person
+			if err := db.First(&stored, person.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.RecognitionOptOut == optOut {
+				t.Errorf("an anonymous request set recognition_opt_out to %v", optOut)
+			}
+			var storedFace models.Face
+			if err := db.First(&storedFace, face.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if storedFace.PersonID == nil || *storedFace.PersonID != person.ID {
+				t.Errorf("face tag changed to %v", storedFace.PersonID)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+// idle buckets are pruned at most this often to keep memory bounded
+const rateLimitCleanupInterval = time.Minute
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// RateLimiter is an in-memory token bucket limiter keyed by client (IP address or user).
+// each key may burst up to Burst requests and then refills at PerMinute requests per minute.
+type RateLimiter struct {
+	ratePerSecond float64
+	burst         float64
+
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+// NewRateLimiter creates a limiter. returns nil if the limit is not positive, which
+// RateLimitMiddleware treats as unlimited
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimiter{
+		ratePerSecond: float64(perMinute) / 60,
+		burst:         float64(burst),
+		buckets:       make(map[string]*tokenBucket),
+		lastCleanup:   time.Now(),
+	}
+}
+
+// Allow takes a token for the key. if none is available it returns false and how long
+// the client should wait before retrying
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastCleanup) >= rateLimitCleanupInterval {
+		rl.cleanup(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, lastRefill: now}
+		rl.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastRefill).Seconds()
+		b.tokens = math.Min(rl.burst, b.tokens+elapsed*rl.ratePerSecond)
+		b.lastRefill = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rl.ratePerSecond * float64(time.Second))
+	return false, wait
+}
+
+// cleanup drops buckets that have been idle long enough to be full again,
+// since a fresh bucket behaves identically
+func (rl *RateLimiter) cleanup(now time.Time) {
+	fullAfter := time.Duration(rl.burst / rl.ratePerSecond * float64(time.Second))
+	for key, b := range rl.buckets {
+		if now.Sub(b.lastRefill) > fullAfter {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastCleanup = now
+}
+
+// RateLimitMiddleware limits requests per client IP and, when the request is authenticated,
+// per user as well. a nil limiter disables limiting. if used after AuthMiddleware the user
+// limit applies; on public routes only the IP limit does.
+func RateLimitMiddleware(limiter *RateLimiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []string{"ip:" + remoteIP(r)}
+		if user, ok := r.Context().Value(UserContextKey).(*models.User); ok && user != nil {
+			keys = append(keys, fmt.Sprintf("user:%d", user.ID))
+		}
+
+		for _, key := range keys {
+			if allowed, retryAfter := limiter.Allow(key); !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				WriteAPIError(w, http.StatusTooManyRequests, "TooManyRequestsException", "Too many requests, please try again later.")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+type RatingHandler struct {
+	RatingRepo repository.ImageRatingRepositoryInterface
+	ImageRepo  repository.ImageRepositoryInterface
+	Cfg        config.Config
+}
+
+// NewRatingHandler creates a new RatingHandler
+func NewRatingHandler(ratingRepo repository.ImageRatingRepositoryInterface, imageRepo repository.ImageRepositoryInterface, cfg config.Config) *RatingHandler {
+	return &RatingHandler{RatingRepo: ratingRepo, ImageRepo: imageRepo, Cfg: cfg}
+}
+
+// RatingPayload changes the favorite flag and/or the star rating of an image. omitted fields
+// are left as they are; a rating of 0 removes it.
+type RatingPayload struct {
+	Favorite *bool `json:"favorite"`
+	Rating   *int  `json:"rating"`
+}
+
+// RatingResponse is the authenticated user's favorite flag and rating of an image
+type RatingResponse struct {
+	Path     string `json:"path"`
+	Favorite bool   `json:"favorite"`
+	Rating   int    `json:"rating"` // 0 when not rated
+}
+
+// currentUser returns the authenticated user, or nil for anonymous requests
+func currentUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(UserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// ratedImagePath reads the path query param and checks that it names an indexed image
+func (rh *RatingHandler) ratedImagePath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	raw := r.URL.Query().Get("path")
+	if raw == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return "", false
+	}
+	imagePath := strings.TrimPrefix(path.Clean("/"+raw), "/")
+	if _, err := rh.ImageRepo.GetByPath(imagePath); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Image not found"})
+		} else {
+			log.Printf("Error getting image %s for rating: %v", imagePath, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve image"})
+		}
+		return "", false
+	}
+	return imagePath, true
+}
+
+// GetRating returns the authenticated user's favorite flag and rating of an image
+// Route: GET /api/images/rating?path=...
+func (rh *RatingHandler) GetRating(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	imagePath, ok := rh.ratedImagePath(w, r)
+	if !ok {
+		return
+	}
+
+	response := RatingResponse{Path: "/" + imagePath}
+	rating, err := rh.RatingRepo.Get(user.ID, imagePath)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error getting rating of %s for user %d: %v", imagePath, user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve rating"})
+		return
+	}
+	if rating != nil {
+		response.Favorite, response.Rating = rating.Favorite, rating.Rating
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// SetRating favorites or unfavorites an image and/or gives it a star rating for the
+// authenticated user
+// Route: PUT /api/images/rating?path=...
+func (rh *RatingHandler) SetRating(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	imagePath, ok := rh.ratedImagePath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload RatingPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if payload.Favorite == nil && payload.Rating == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "favorite or rating is required"})
+		return
+	}
+	if payload.Rating != nil && (*payload.Rating < 0 || *payload.Rating > models.MaxImageRating) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("rating must be from 1 to %d, or 0 to remove it", models.MaxImageRating)})
+		return
+	}
+
+	rating, err := rh.RatingRepo.Set(user.ID, imagePath, payload.Favorite, payload.Rating)
+	if err != nil {
+		log.Printf("Error setting rating of %s for user %d: %v", imagePath, user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save rating"})
+		return
+	}
+	writeJSON(w, http.StatusOK, RatingResponse{Path: "/" + imagePath, Favorite: rating.Favorite, Rating: rating.Rating})
+}
+
+// DeleteRating unfavorites an image and removes its rating for the authenticated user
+// Route: DELETE /api/images/rating?path=...
+func (rh *RatingHandler) DeleteRating(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	imagePath, ok := rh.ratedImagePath(w, r)
+	if !ok {
+		return
+	}
+	if err := rh.RatingRepo.Delete(user.ID, imagePath); err != nil {
+		log.Printf("Error clearing rating of %s for user %d: %v", imagePath, user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to clear rating"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFavorites returns a page of the authenticated user's favorite images, newest first, in
+// the same shape as album contents. rating_min and rating_max narrow them down further.
+// Route: GET /api/favorites?rating_min=...&rating_max=...&offset=...&limit=...
+func (rh *RatingHandler) ListFavorites(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter, _, err := parseImageFilterParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter.RatingUserID = user.ID
+	filter.FavoritesOnly = true
+
+	images, total, err := rh.ImageRepo.ListFiltered(filter, database.SortDateDesc, offset, limit)
+	if err != nil {
+		log.Printf("Error listing favorites of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list favorites"})
+		return
+	}
+
+	files := make([]FileInfo, 0, len(images))
+	for i := range images {
+		files = append(files, fileInfoFromImage(&images[i], rh.Cfg))
+	}
+	annotateRatings(rh.RatingRepo, user, files)
+	listing := DirectoryListing{Path: "/favorites", Files: files}
+	listing.paginate(offset, limit, int(total))
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// annotateRatings fills in a user's favorite flags and ratings of the files of a listing.
+// it does nothing for anonymous requests.
+func annotateRatings(ratingRepo repository.ImageRatingRepositoryInterface, user *models.User, files []FileInfo) {
+	if ratingRepo == nil || user == nil || len(files) == 0 {
+		return
+	}
+	var paths []string
+	for _, file := range files {
+		if !file.IsDir {
+			paths = append(paths, strings.TrimPrefix(file.Path, "/"))
+		}
+	}
+	ratings, err := ratingRepo.ListByImagePaths(user.ID, paths)
+	if err != nil {
+		log.Printf("Error loading ratings of user %d: %v", user.ID, err)
+		return
+	}
+	byPath := make(map[string]*models.ImageRating, len(ratings))
+	for i := range ratings {
+		byPath["/"+ratings[i].ImagePath] = &ratings[i]
+	}
+	for i := range files {
+		if rating, ok := byPath[files[i].Path]; ok {
+			files[i].Favorite = rating.Favorite
+			files[i].Rating = rating.Rating
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/realtime"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+// RealtimeAccess publishes realtime events on the topic of the album holding their file, or
+// on the system topic for files outside of albums, and on the topic of the user who started
+// them. users may read the albums they can view the content of, their own topic, with
+// job.list the system topic and with system.stats.view the stats topic.
+type RealtimeAccess struct {
+	AlbumRepo repository.AlbumRepositoryInterface
+}
+
+func NewRealtimeAccess(albumRepo repository.AlbumRepositoryInterface) *RealtimeAccess {
+	return &RealtimeAccess{AlbumRepo: albumRepo}
+}
+
+// EventTopics implements realtime.Access
+func (a *RealtimeAccess) EventTopics(event realtime.Event) []string {
+	var topics []string
+	if event.UserID != 0 {
+		topics = append(topics, realtime.UserTopic(event.UserID))
+	}
+	if albumID, ok := eventAlbumID(event); ok {
+		return append(topics, realtime.AlbumTopic(albumID))
+	}
+	if event.Path != "" {
+		album, err := a.AlbumRepo.FindByImagePath(event.Path)
+		if err == nil {
+			return append(topics, realtime.AlbumTopic(album.ID))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("realtime: failed to find the album of %s, publishing on the system topic: %v", event.Path, err)
+		}
+	}
+	return append(topics, realtime.SystemTopic)
+}
+
+// RealtimeFileInfo renders images for the task events of the realtime hub the same way
+// directory listings do
+func RealtimeFileInfo(cfg config.Config) func(img *models.Image) interface{} {
+	return func(img *models.Image) interface{} {
+		return fileInfoFromImage(img, cfg)
+	}
+}
+
+// eventAlbumID returns the album_id an event names, e.g. of album moves and zip progress,
+// whose path is the album folder rather than a file in it
+func eventAlbumID(event realtime.Event) (uint, bool) {
+	switch id := event.Extra["album_id"].(type) {
+	case uint:
+		return id, true
+	case int:
+		return uint(id), id > 0
+	case int64:
+		return uint(id), id > 0
+	}
+	return 0, false
+}
+
+// CanSubscribe implements realtime.Access
+func (a *RealtimeAccess) CanSubscribe(r *http.Request, topic string) bool {
+	user := currentUser(r)
+	if user == nil {
+		return false
+	}
+	switch topic {
+	case realtime.SystemTopic:
+		return user.HasGlobalPermission("job.list")
+	case realtime.StatsTopic:
+		return user.HasGlobalPermission("system.stats.view")
+	}
+	kind, rawID, ok := strings.Cut(topic, ":")
+	if !ok {
+		return false
+	}
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return false
+	}
+	switch kind {
+	case "user":
+		return uint(id) == user.ID
+	case "album":
+		album, err := a.AlbumRepo.GetByID(uint(id))
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("realtime: failed to get album %d for a subscription of user %d: %v", id, user.ID, err)
+			}
+			return false
+		}
+		return canAccessAlbum(user, album, "album.view.content")
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+	"gorm.io/gorm"
+)
+
+// route prefix of the resize endpoint, followed by the path of the image
+const resizeAPIPrefix = "/api/resize/"
+
+// resizeCall is a derivative being generated; later requests for it wait on done
+type resizeCall struct {
+	done chan struct{}
+	err  error
+}
+
+// ResizeHandler serves resized copies of library images at the configured RESIZE_SIZES.
+// derivatives are cached in the resize directory of the media storage, named after the
+// original's path, modification time and the requested box, so a changed original gets new ones.
+type ResizeHandler struct {
+	Cfg       config.Config
+	ImageRepo repository.ImageRepositoryInterface
+	AlbumRepo repository.AlbumRepositoryInterface
+
+	mu       sync.Mutex
+	inflight map[string]*resizeCall // by cache file name
+}
+
+// NewResizeHandler creates a new ResizeHandler
+func NewResizeHandler(cfg config.Config, imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface) *ResizeHandler {
+	return &ResizeHandler{Cfg: cfg, ImageRepo: imageRepo, AlbumRepo: albumRepo, inflight: make(map[string]*resizeCall)}
+}
+
+// Resize handles GET /api/resize/{path}?w=...&h=...&fit=contain|cover, from the resize_url
+// of a listed image. images the requester couldn't list, as they are ignored, behind a
+// symlink the library doesn't follow, in a hidden album or hidden as NSFW, are not found.
+func (h *ResizeHandler) Resize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	relPath, err := utils.CleanRelPath(strings.TrimPrefix(r.URL.Path, resizeAPIPrefix))
+	if err != nil || relPath == "" || relPath == "." {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must be a relative path to an image"})
+		return
+	}
+	if !media.IsProcessableImage(relPath) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path is not an image that can be resized"})
+		return
+	}
+
+	width, err := h.parseDimension(query.Get("w"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "w: " + err.Error()})
+		return
+	}
+	height, err := h.parseDimension(query.Get("h"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "h: " + err.Error()})
+		return
+	}
+	if width == 0 && height == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "w or h is required"})
+		return
+	}
+	fit := strings.ToLower(query.Get("fit"))
+	if fit == "" {
+		fit = media.ResizeFitContain
+	}
+	if fit != media.ResizeFitContain && fit != media.ResizeFitCover {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "fit must be contain or cover"})
+		return
+	}
+
+	if h.Cfg.IsIgnoredPath(relPath) {
+		http.NotFound(w, r)
+		return
+	}
+	originalPath := h.Cfg.ResolvePath(relPath)
+	info, err := os.Stat(originalPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Resize: Error stating %s: %v", originalPath, err)
+		return
+	}
+	if err := h.Cfg.CheckSymlinks(originalPath); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	visible, err := h.visible(r, relPath)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Resize: Error checking access to %s: %v", relPath, err)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := fmt.Sprintf("%s|%d|%d|%d|%d|%s", relPath, info.ModTime().UnixNano(), info.Size(), width, height, fit)
+	sum := sha256.Sum256([]byte(key))
+	cachePath := filepath.Join(h.Cfg.ResizedPath, hex.EncodeToString(sum[:16])+media.ResizedFileExtension)
+
+	cacheInfo, err := os.Stat(cachePath)
+	if os.IsNotExist(err) {
+		if err := h.generate(originalPath, cachePath, width, height, fit); err != nil {
+			http.Error(w, "Failed to resize image", http.StatusInternalServerError)
+			log.Printf("Resize: Failed to resize %s to %dx%d (%s): %v", relPath, width, height, fit, err)
+			return
+		}
+		cacheInfo, err = os.Stat(cachePath)
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Resize: Error stating cached derivative %s: %v", cachePath, err)
+		return
+	}
+
+	// the same URL gets a new derivative once the original changes
+	setAssetCacheHeaders(w, cacheInfo, false)
+	http.ServeFile(w, r, cachePath)
+}
+
+// visible reports whether the requester may see the image at relPath: it's not in a hidden
+// album they may not view, nor hidden from them as NSFW
+func (h *ResizeHandler) visible(r *http.Request, relPath string) (bool, error) {
+	hiddenFolders, err := hiddenAlbumFolders(h.AlbumRepo, currentUser(r))
+	if err != nil {
+		return false, err
+	}
+	if withinAnyFolder(relPath, hiddenFolders) {
+		return false, nil
+	}
+	if hidesNSFW(h.Cfg, r) {
+		img, err := h.ImageRepo.GetByPath(relPath)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		if err == nil && img.IsNSFWHidden() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseDimension parses an optional width or height, rounded up to the next of the configured
+// ResizeSizes and capped at ResizeMaxSize, so the cache holds a bounded number of derivatives
+// per image. 0 means unset
+func (h *ResizeHandler) parseDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("must be a positive integer")
+	}
+	if len(h.Cfg.ResizeSizes) > 0 {
+		rounded := h.Cfg.ResizeSizes[len(h.Cfg.ResizeSizes)-1]
+		for _, allowed := range h.Cfg.ResizeSizes {
+			if allowed >= size {
+				rounded = allowed
+				break
+			}
+		}
+		size = rounded
+	}
+	return min(size, h.Cfg.ResizeMaxSize), nil
+}
+
+// generate writes the derivative to cachePath. concurrent requests for the same derivative
+// share one generation and all get its result.
+func (h *ResizeHandler) generate(originalPath, cachePath string, width, height int, fit string) error {
+	h.mu.Lock()
+	if call, ok := h.inflight[cachePath]; ok {
+		h.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &resizeCall{done: make(chan struct{})}
+	h.inflight[cachePath] = call
+	h.mu.Unlock()
+
+	call.err = writeResized(originalPath, cachePath, width, height, fit)
+
+	h.mu.Lock()
+	delete(h.inflight, cachePath)
+	h.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// writeResized decodes, resizes and saves an image. the file is written under a temporary
+// name and renamed, so it's never served half written.
+func writeResized(originalPath, cachePath string, width, height int, fit string) error {
+	img, _, err := media.DecodeImageFile(originalPath)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	resized := media.ResizeImage(img, width, height, fit)
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create resize cache directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(cachePath), ".resize-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // no-op once renamed
+
+	if err := media.EncodeResizedJPEG(tmpFile, resized); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to encode resized image: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write resized image: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), cachePath); err != nil {
+		return fmt.Errorf("failed to save resized image: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// applyAlbumRights fills in the copyright holder and license of the files of an album's
+// listing that don't have their own with those of the album
+func applyAlbumRights(album *models.Album, files []FileInfo) {
+	if album == nil || (album.Copyright == nil && album.License == nil) {
+		return
+	}
+	for i := range files {
+		if files[i].IsDir {
+			continue
+		}
+		if files[i].Copyright == nil {
+			files[i].Copyright = album.Copyright
+		}
+		if files[i].License == nil {
+			files[i].License = album.License
+		}
+	}
+}
+
+// downloadRights returns the copyright holder and license embedded in the web copies of a
+// download: the image's own, or else those of album, which may be nil
+func downloadRights(cfg config.Config, imageRepo repository.ImageRepositoryInterface, album *models.Album) func(fullPath string) media.XMPProperties {
+	return func(fullPath string) media.XMPProperties {
+		var props media.XMPProperties
+		if relPath, err := cfg.RelativePath(fullPath); err == nil && imageRepo != nil {
+			if image, err := imageRepo.GetByPath(relPath); err == nil {
+				props.Copyright, props.License = image.Copyright, image.License
+			}
+		}
+		if album != nil {
+			if props.Copyright == nil {
+				props.Copyright = album.Copyright
+			}
+			if props.License == nil {
+				props.License = album.License
+			}
+		}
+		return props
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+// defaultSearchLimit is the page size of search results when no limit is given
+const defaultSearchLimit = 50
+
+type SearchHandler struct {
+	SearchRepo repository.SearchRepositoryInterface
+	ImageRepo  repository.ImageRepositoryInterface
+	AlbumRepo  repository.AlbumRepositoryInterface
+	PersonRepo repository.PersonRepositoryInterface
+	Cfg        config.Config
+
+	// semantic search, nil or disabled unless CLIP is enabled
+	EmbeddingRepo repository.ImageEmbeddingRepositoryInterface
+	TextEncoder   *media.CLIPTextEncoder
+}
+
+// NewSearchHandler creates a new SearchHandler. textEncoder may be nil when CLIP is disabled.
+func NewSearchHandler(searchRepo repository.SearchRepositoryInterface, imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, personRepo repository.PersonRepositoryInterface, embeddingRepo repository.ImageEmbeddingRepositoryInterface, textEncoder *media.CLIPTextEncoder, cfg config.Config) *SearchHandler {
+	return &SearchHandler{SearchRepo: searchRepo, ImageRepo: imageRepo, AlbumRepo: albumRepo, PersonRepo: personRepo, EmbeddingRepo: embeddingRepo, TextEncoder: textEncoder, Cfg: cfg}
+}
+
+// SearchResult is one entry of a search response. exactly one of File, Album and Person is set,
+// according to Type.
+type SearchResult struct {
+	Type       string             `json:"type"`
+	Title      string             `json:"title"`
+	Rank       float64            `json:"rank"`
+	Similarity *float32           `json:"similarity,omitempty"` // semantic search only, higher is better
+	File       *FileInfo          `json:"file,omitempty"`
+	Album      *SearchAlbumResult `json:"album,omitempty"`
+	Person     *models.Person     `json:"person,omitempty"`
+}
+
+// SearchAlbumResult is the public summary of an album in search results
+type SearchAlbumResult struct {
+	ID          uint    `json:"id"`
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
+	Description *string `json:"description,omitempty"`
+	BannerURL   *string `json:"banner_url,omitempty"`
+}
+
+// SearchResponse is a page of search results
+type SearchResponse struct {
+	Query      string         `json:"query"`
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	Offset     int            `json:"offset"`
+	Limit      int            `json:"limit"`
+	HasMore    bool           `json:"has_more"`
+	NextCursor string         `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// Search runs a full-text search over file names and paths, camera metadata, album names and
+// descriptions, and people's names and aliases. type limits the results to a comma separated
+// list of image, album and person. tag (repeatable) limits the results to images with any of
+// the named tags.
+// Route: GET /api/search?q=...&type=...&tag=...&offset=...&limit=...
+func (sh *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query param: q"})
+		return
+	}
+
+	var kinds []string
+	if raw := r.URL.Query().Get("type"); raw != "" {
+		for _, kind := range strings.Split(raw, ",") {
+			kind = strings.TrimSpace(kind)
+			switch kind {
+			case repository.SearchKindImage, repository.SearchKindAlbum, repository.SearchKindPerson:
+				kinds = append(kinds, kind)
+			case "":
+			default:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid type '" + kind + "', expected image, album or person"})
+				return
+			}
+		}
+	}
+
+	var tags []string
+	for _, tag := range r.URL.Query()["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	offset, limit, err := parsePageParams(r, defaultSearchLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(sh.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for search: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search"})
+		return
+	}
+
+	hits, total, err := sh.SearchRepo.Search(query, kinds, tags, hidesNSFW(sh.Cfg, r), hiddenFolders, offset, limit)
+	if err != nil {
+		log.Printf("Error searching for '%s': %v", query, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search"})
+		return
+	}
+
+	response := SearchResponse{
+		Query:   query,
+		Results: sh.searchResults(hits),
+		Total:   int(total),
+		Offset:  offset,
+		Limit:   limit,
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// SemanticSearch ranks images by how well they match a text description, e.g. "sunset over
+// water", using CLIP embeddings. only images embedded by the clip_embedding worker task are
+// found.
+// Route: GET /api/search/semantic?q=...&offset=...&limit=...
+func (sh *SearchHandler) SemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if sh.TextEncoder == nil || !sh.TextEncoder.Enabled {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Semantic search is not enabled"})
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query param: q"})
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultSearchLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(sh.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for semantic search: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search"})
+		return
+	}
+
+	embedding, err := sh.TextEncoder.EncodeText(query)
+	if err != nil {
+		log.Printf("Error embedding semantic search query '%s': %v", query, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search"})
+		return
+	}
+	matches, total, err := sh.EmbeddingRepo.SearchSimilar(embedding, float32(sh.Cfg.CLIPMinSimilarity), hidesNSFW(sh.Cfg, r), hiddenFolders, offset, limit)
+	if err != nil {
+		log.Printf("Error running semantic search for '%s': %v", query, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search"})
+		return
+	}
+
+	// rank is the cosine distance, so lower is better as in full-text results
+	hits := make([]repository.SearchHit, len(matches))
+	similarities := make(map[string]float32, len(matches))
+	for i, match := range matches {
+		hits[i] = repository.SearchHit{Kind: repository.SearchKindImage, Ref: match.ImagePath, Rank: float64(1 - match.Similarity)}
+		similarities["/"+match.ImagePath] = match.Similarity
+	}
+	results := sh.searchResults(hits)
+	for i := range results {
+		similarity := similarities[results[i].File.Path]
+		results[i].Similarity = &similarity
+	}
+
+	response := SearchResponse{
+		Query:   query,
+		Results: results,
+		Total:   int(total),
+		Offset:  offset,
+		Limit:   limit,
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// searchResults loads the records behind a page of search hits. hits whose record has gone
+// away since it was indexed are dropped.
+func (sh *SearchHandler) searchResults(hits []repository.SearchHit) []SearchResult {
+	var paths []string
+	for _, hit := range hits {
+		if hit.Kind == repository.SearchKindImage {
+			paths = append(paths, hit.Ref)
+		}
+	}
+	images := make(map[string]*models.Image, len(paths))
+	if len(paths) > 0 {
+		records, err := sh.ImageRepo.GetImagesByPaths(paths)
+		if err != nil {
+			log.Printf("Error loading images of search results: %v", err)
+		}
+		for i := range records {
+			images[records[i].OriginalPath] = &records[i]
+		}
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		result := SearchResult{Type: hit.Kind, Title: hit.Title, Rank: hit.Rank}
+		switch hit.Kind {
+		case repository.SearchKindImage:
+			img, ok := images[hit.Ref]
+			if !ok {
+				continue
+			}
+			file := fileInfoFromImage(img, sh.Cfg)
+			result.Title = file.Name
+			result.File = &file
+		case repository.SearchKindAlbum:
+			album := sh.searchAlbum(hit.Ref)
+			if album == nil {
+				continue
+			}
+			result.Album = album
+		case repository.SearchKindPerson:
+			person := sh.searchPerson(hit.Ref)
+			if person == nil {
+				continue
+			}
+			result.Person = person
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (sh *SearchHandler) searchAlbum(ref string) *SearchAlbumResult {
+	id, err := strconv.ParseUint(ref, 10, 32)
+	if err != nil {
+		return nil
+	}
+	album, err := sh.AlbumRepo.GetByID(uint(id))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error loading album %d of search results: %v", id, err)
+		}
+		return nil
+	}
+	result := &SearchAlbumResult{ID: album.ID, Name: album.Name, Slug: album.Slug, Description: album.Description}
+	if album.BannerImagePath != nil && *album.BannerImagePath != "" {
+		banner := bannerURL(sh.Cfg, *album.BannerImagePath)
+		result.BannerURL = &banner
+	}
+	return result
+}
+
+func (sh *SearchHandler) searchPerson(ref string) *models.Person {
+	id, err := strconv.ParseUint(ref, 10, 32)
+	if err != nil {
+		return nil
+	}
+	person, err := sh.PersonRepo.GetByID(uint(id))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error loading person %d of search results: %v", id, err)
+		}
+		return nil
+	}
+	person.Faces = nil // not needed in results, and can be large
+	return person
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+// retry hint sent with maintenance responses, in seconds
+const maintenanceRetryAfter = "300"
+
+// requests that only start a session, or switch the mode back, keep working in every mode
+var serviceModeExemptRoutes = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/auth/(login|logout)/?$`),
+	regexp.MustCompile(`^/api/s/[^/]+/session/?$`),
+	regexp.MustCompile(`^/api/admin/settings/service_mode/?$`),
+}
+
+// isMutatingMethod reports whether requests with the method may change data
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// ServiceModeMiddleware rejects requests that change data while the server is read only
+// (423) or in maintenance (503). reads are always served. mode is called on every request
+// so switching modes applies immediately.
+func ServiceModeMiddleware(mode func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutatingMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, route := range serviceModeExemptRoutes {
+			if route.MatchString(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		switch mode() {
+		case config.ServiceModeReadOnly:
+			WriteAPIError(w, http.StatusLocked, "ReadOnlyModeException", "The server is in read-only mode, changes are not accepted right now.")
+		case config.ServiceModeMaintenance:
+			w.Header().Set("Retry-After", maintenanceRetryAfter)
+			WriteAPIError(w, http.StatusServiceUnavailable, "MaintenanceModeException", "The server is down for maintenance, changes are not accepted right now.")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// ServiceStatus handles GET /api/status, so clients can tell users when changes are disabled
+func ServiceStatus(mode func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := mode()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"service_mode": current,
+			"read_only":    current != config.ServiceModeNormal,
+		})
+	}
+}
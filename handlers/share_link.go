@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// ShareLinkContextKey is the key used to store the share link in the request context.
+	ShareLinkContextKey ContextKey = "share_link"
+
+	shareSessionCookieName = "share_session"
+	shareSessionAudience   = "share_link"
+	shareSessionDuration   = 24 * time.Hour
+	// session subjects carry a prefix so they can never be mistaken for a user ID by AuthMiddleware
+	shareSessionSubjectPrefix = "share:"
+)
+
+type ShareLinkHandler struct {
+	ShareLinkRepo repository.ShareLinkRepository
+	AlbumHandler  *AlbumHandler
+	LoginGuard    *LoginGuard // delays and locks out repeated wrong passcodes, nil disables it
+}
+
+func NewShareLinkHandler(shareLinkRepo repository.ShareLinkRepository, albumHandler *AlbumHandler, loginGuard *LoginGuard) *ShareLinkHandler {
+	return &ShareLinkHandler{ShareLinkRepo: shareLinkRepo, AlbumHandler: albumHandler, LoginGuard: loginGuard}
+}
+
+type ShareSessionPayload struct {
+	Passcode string `json:"passcode"`
+}
+
+// CreateSession verifies the passcode of a share link (if any), counts a view and issues
+// a session cookie scoped to the link.
+// Route: POST /s/{share_token}/session
+func (h *ShareLinkHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.loadUsableShareLink(w, r)
+	if !ok {
+		return
+	}
+
+	// an existing session does not consume another view
+	if hasValidShareSession(r, link) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"album_id": link.AlbumID})
+		return
+	}
+
+	var payload ShareSessionPayload
+	// the body is optional for links without a passcode
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		return
+	}
+
+	if link.HasPasscode() {
+		ip := remoteIP(r)
+		if lockedUntil := h.LoginGuard.ShareLockedUntil(link.ID, ip); !lockedUntil.IsZero() {
+			retryAfter := max(1, int(math.Ceil(time.Until(lockedUntil).Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("Too many wrong passcodes. Please try again in %d minute(s).", (retryAfter+59)/60)})
+			return
+		}
+		if !link.CheckPasscode(payload.Passcode) {
+			time.Sleep(h.LoginGuard.RecordShareFailure(link.ID, ip))
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid passcode"})
+			return
+		}
+		h.LoginGuard.RecordShareSuccess(link.ID)
+	}
+
+	if !h.startShareSession(w, r, link) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"album_id": link.AlbumID})
+}
+
+// GetSharedAlbum returns the album behind the share link.
+// Route: GET /s/{share_token}
+func (h *ShareLinkHandler) GetSharedAlbum(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.sharedAlbum(w, r)
+	if !ok {
+		return
+	}
+	h.AlbumHandler.writeAlbum(w, album)
+}
+
+// GetSharedAlbumContents returns a page of the album contents behind the share link.
+// Route: GET /s/{share_token}/contents
+func (h *ShareLinkHandler) GetSharedAlbumContents(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.sharedAlbum(w, r)
+	if !ok {
+		return
+	}
+	h.AlbumHandler.writeAlbumContents(w, r, album)
+}
+
+// GetSharedOriginal serves a file of the album behind the share link, named by the path
+// query param as for custom album zips. images are watermarked if the album has a watermark,
+// and other files are then refused.
+// Route: GET /s/{share_token}/original?path=...&mode=original|web
+func (h *ShareLinkHandler) GetSharedOriginal(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.sharedAlbum(w, r)
+	if !ok {
+		return
+	}
+	download, err := parseImageDownload(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	albumFullPath, err := h.AlbumHandler.albumFolderFullPath(album)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
+		return
+	}
+	name, ok := albumFileName(album, albumFullPath, r.URL.Query().Get("path"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found in this album"})
+		return
+	}
+	fullPath := filepath.Join(albumFullPath, name)
+	visible, err := h.withoutNSFW(r, albumFullPath, []string{name})
+	if err != nil {
+		log.Printf("Error checking NSFW flags of %s for share link download: %v", fullPath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to prepare download"})
+		return
+	}
+	if len(visible) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found in this album"})
+		return
+	}
+
+	download.watermark, err = h.AlbumHandler.albumWatermark(album)
+	if err != nil {
+		log.Printf("Error loading watermark of album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to prepare download"})
+		return
+	}
+	download.rights = downloadRights(h.AlbumHandler.Cfg, h.AlbumHandler.ImageRepo, album)
+	if !download.includes(name) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Only images can be downloaded from this album"})
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "File not found in this album"})
+		return
+	}
+	if err := serveDownloadFile(w, r, h.AlbumHandler.Cfg, fullPath, info, download); err != nil {
+		log.Printf("Error preparing %s for share link download: %v", fullPath, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to prepare download"})
+	}
+}
+
+// DownloadSharedAlbumZip streams a zip of the album behind the share link. when the album
+// has a watermark, the archive holds watermarked copies of its images only.
+// Route: GET /s/{share_token}/zip?mode=original|web
+func (h *ShareLinkHandler) DownloadSharedAlbumZip(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.sharedAlbum(w, r)
+	if !ok {
+		return
+	}
+	download, err := parseImageDownload(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	albumFullPath, err := h.AlbumHandler.albumFolderFullPath(album)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Album configuration error"})
+		return
+	}
+	names, err := utils.AlbumZipFiles(albumFullPath, h.AlbumHandler.Cfg.IsIgnored, h.AlbumHandler.Cfg.AllowsSymlink)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoFilesToZip) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album has no files to download"})
+		} else {
+			log.Printf("Error listing files to zip for album %d via share link: %v", album.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create ZIP archive"})
+		}
+		return
+	}
+	if names, err = h.withoutNSFW(r, albumFullPath, names); err != nil {
+		log.Printf("Error checking NSFW flags of album %d for share link zip: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create ZIP archive"})
+		return
+	}
+	if len(names) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album has no files to download"})
+		return
+	}
+
+	download.watermark, err = h.AlbumHandler.albumWatermark(album)
+	if err != nil {
+		log.Printf("Error loading watermark of album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create ZIP archive"})
+		return
+	}
+	download.rights = downloadRights(h.AlbumHandler.Cfg, h.AlbumHandler.ImageRepo, album)
+	streamDownloadZip(w, h.AlbumHandler.Cfg, album, albumFullPath, names, download, zipFileName(album, "archive", download))
+}
+
+// withoutNSFW drops the names of the files in an album folder that are hidden from share link
+// visitors as NSFW
+func (h *ShareLinkHandler) withoutNSFW(r *http.Request, albumFullPath string, names []string) ([]string, error) {
+	if !hidesNSFW(h.AlbumHandler.Cfg, r) {
+		return names, nil
+	}
+	dbPaths := make([]string, 0, len(names))
+	nameByPath := make(map[string]string, len(names))
+	for _, name := range names {
+		rel, err := h.AlbumHandler.Cfg.RelativePath(filepath.Join(albumFullPath, name))
+		if err != nil {
+			continue
+		}
+		dbPath := filepath.ToSlash(rel)
+		dbPaths = append(dbPaths, dbPath)
+		nameByPath[dbPath] = name
+	}
+	images, err := h.AlbumHandler.ImageRepo.GetImagesByPaths(dbPaths)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[string]bool)
+	for i := range images {
+		if images[i].IsNSFWHidden() {
+			hidden[nameByPath[images[i].OriginalPath]] = true
+		}
+	}
+	visible := make([]string, 0, len(names))
+	for _, name := range names {
+		if !hidden[name] {
+			visible = append(visible, name)
+		}
+	}
+	return visible, nil
+}
+
+func (h *ShareLinkHandler) sharedAlbum(w http.ResponseWriter, r *http.Request) (*models.Album, bool) {
+	link, ok := r.Context().Value(ShareLinkContextKey).(*models.ShareLink)
+	if !ok || link == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Share link not found in context"})
+		return nil, false
+	}
+
+	album, err := h.AlbumHandler.AlbumRepo.GetByID(link.AlbumID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error getting album %d for share link %d: %v", link.AlbumID, link.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve album"})
+		}
+		return nil, false
+	}
+	return album, true
+}
+
+// ShareLinkMiddleware guards routes under /s/{share_token}. it rejects inactive or expired
+// links, requires a session cookie for passcode-protected links, and counts a view for each
+// new visitor of an open link until its view limit is reached.
+func (h *ShareLinkHandler) ShareLinkMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		link, ok := h.loadUsableShareLink(w, r)
+		if !ok {
+			return
+		}
+
+		if !hasValidShareSession(r, link) {
+			if link.HasPasscode() {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error":             "Passcode required",
+					"passcode_required": true,
+				})
+				return
+			}
+			if !h.startShareSession(w, r, link) {
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), ShareLinkContextKey, link)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// loadUsableShareLink fetches the link named in the URL and writes an error response
+// if it does not exist, was deactivated or has expired
+func (h *ShareLinkHandler) loadUsableShareLink(w http.ResponseWriter, r *http.Request) (*models.ShareLink, bool) {
+	token := chi.URLParam(r, "share_token")
+	if token == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Share link not found"})
+		return nil, false
+	}
+
+	link, err := h.ShareLinkRepo.GetByToken(token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Share link not found"})
+		} else {
+			log.Printf("Error getting share link: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve share link"})
+		}
+		return nil, false
+	}
+
+	if !link.IsActive || link.IsExpired() {
+		writeJSON(w, http.StatusGone, map[string]string{"error": "Share link has expired"})
+		return nil, false
+	}
+	return link, true
+}
+
+// startShareSession counts a view against the link and sets the session cookie.
+// writes an error response and returns false if the view limit has been reached.
+func (h *ShareLinkHandler) startShareSession(w http.ResponseWriter, r *http.Request, link *models.ShareLink) bool {
+	consumed, err := h.ShareLinkRepo.ConsumeView(link.ID)
+	if err != nil {
+		log.Printf("Error counting view for share link %d: %v", link.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to start share session"})
+		return false
+	}
+	if !consumed {
+		writeJSON(w, http.StatusGone, map[string]string{"error": "Share link view limit reached"})
+		return false
+	}
+	link.Views++
+
+	expiresAt := time.Now().Add(shareSessionDuration)
+	if link.ExpiresAt != nil && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = *link.ExpiresAt
+	}
+
+	claims := &jwt.RegisteredClaims{
+		Subject:   shareSessionSubjectPrefix + strconv.FormatUint(uint64(link.ID), 10),
+		Audience:  jwt.ClaimStrings{shareSessionAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+	if err != nil {
+		log.Printf("Error signing share session for link %d: %v", link.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to start share session"})
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     shareSessionCookieName,
+		Value:    tokenString,
+		Path:     "/api/s/" + link.Token,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return true
+}
+
+// hasValidShareSession checks whether the request carries a session cookie issued for this link
+func hasValidShareSession(r *http.Request, link *models.ShareLink) bool {
+	cookie, err := r.Cookie(shareSessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtKey, nil
+	}, jwt.WithAudience(shareSessionAudience), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return false
+	}
+
+	linkIDStr, ok := strings.CutPrefix(claims.Subject, shareSessionSubjectPrefix)
+	if !ok {
+		return false
+	}
+	linkID, err := strconv.ParseUint(linkIDStr, 10, 32)
+	return err == nil && uint(linkID) == link.ID
+}
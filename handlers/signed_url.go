@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+// query parameters of signed asset URLs
+const (
+	assetURLExpiresParam   = "expires"
+	assetURLSignatureParam = "sig"
+)
+
+// signAssetURL adds an expiry and signature to the path of an asset, e.g.
+// "/api/thumbnails/x.jpg". returns the path unchanged when signing is disabled.
+// expiries are rounded up to a whole period, so an asset keeps the same URL for a while
+// and clients and CDNs can cache it.
+func signAssetURL(cfg config.Config, assetPath string) string {
+	if cfg.AssetURLSecret == "" {
+		return assetPath
+	}
+	period := int64(cfg.AssetURLExpirySeconds)
+	expires := (time.Now().Unix()/period + 2) * period
+	return assetPath + "?" + assetURLExpiresParam + "=" + strconv.FormatInt(expires, 10) +
+		"&" + assetURLSignatureParam + "=" + assetURLSignature(cfg.AssetURLSecret, assetPath, expires)
+}
+
+// assetURLSignature signs the path of an asset together with its expiry
+func assetURLSignature(secret, assetPath string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(assetPath + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedAssetMiddleware only lets through asset requests carrying a valid, unexpired
+// signature from signAssetURL. does nothing when signing is disabled.
+func SignedAssetMiddleware(cfg config.Config, next http.Handler) http.Handler {
+	if cfg.AssetURLSecret == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		expires, err := strconv.ParseInt(query.Get(assetURLExpiresParam), 10, 64)
+		if err != nil || query.Get(assetURLSignatureParam) == "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if time.Now().Unix() > expires {
+			http.Error(w, "Link expired", http.StatusForbidden)
+			return
+		}
+		expected := assetURLSignature(cfg.AssetURLSecret, r.URL.Path, expires)
+		if !hmac.Equal([]byte(expected), []byte(query.Get(assetURLSignatureParam))) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// thumbnailURL returns the signed URL of a stored thumbnail
+func thumbnailURL(cfg config.Config, thumbnailPath string) string {
+	return signAssetURL(cfg, "/api"+thumbnailApiPrefix+filepath.Base(thumbnailPath))
+}
+
+// renditionURL returns the signed URL of a stored video rendition
+func renditionURL(cfg config.Config, renditionPath string) string {
+	return signAssetURL(cfg, "/api/"+filepath.Base(cfg.VideosPath)+"/"+filepath.Base(renditionPath))
+}
+
+// resizeURL returns the signed URL of the resize endpoint for the image at imagePath,
+// relative to the root. clients append the w, h and fit params, which the signature doesn't
+// cover as the endpoint only produces the configured sizes.
+func resizeURL(cfg config.Config, imagePath string) string {
+	assetPath := resizeAPIPrefix + imagePath
+	signed := signAssetURL(cfg, assetPath)
+	return (&url.URL{Path: assetPath}).EscapedPath() + strings.TrimPrefix(signed, assetPath)
+}
+
+// streamURL returns the signed URL of a playlist or segment of the HLS stream of the video at
+// videoPath, relative to the root. the URL is escaped, while the signature is over the
+// unescaped path the middleware checks.
+func streamURL(cfg config.Config, videoPath, file string) string {
+	assetPath := streamAPIPrefix + videoPath + "/" + file
+	signed := signAssetURL(cfg, assetPath)
+	return (&url.URL{Path: assetPath}).EscapedPath() + strings.TrimPrefix(signed, assetPath)
+}
+
+// bannerURL returns the signed URL of a stored album banner
+func bannerURL(cfg config.Config, bannerPath string) string {
+	return signAssetURL(cfg, "/api/"+filepath.Base(cfg.BannersPath)+"/"+filepath.Base(bannerPath))
+}
+
+// AlbumAssetURLs are the URLs of an album's banner and archive, signed when signing is
+// enabled. clients should use them rather than building URLs from the stored paths.
+type AlbumAssetURLs struct {
+	BannerURL *string `json:"banner_url,omitempty"`
+	ZipURL    *string `json:"zip_url,omitempty"`
+}
+
+func albumAssetURLs(cfg config.Config, album *models.Album) AlbumAssetURLs {
+	var urls AlbumAssetURLs
+	if album.BannerImagePath != nil && *album.BannerImagePath != "" {
+		banner := bannerURL(cfg, *album.BannerImagePath)
+		urls.BannerURL = &banner
+	}
+	if album.ZipStatus == database.StatusDone && album.ZipPath != nil && *album.ZipPath != "" {
+		zip := signAssetURL(cfg, "/api/"+filepath.Base(cfg.ArchivesPath)+"/"+filepath.Base(*album.ZipPath))
+		urls.ZipURL = &zip
+	}
+	return urls
+}
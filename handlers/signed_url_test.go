@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+func signedTestConfig() config.Config {
+	return config.Config{AssetURLSecret: "test-secret", AssetURLExpirySeconds: 3600}
+}
+
+// serveSigned runs a request for target through SignedAssetMiddleware and returns the status
+func serveSigned(cfg config.Config, target string) int {
+	handler := SignedAssetMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w.Code
+}
+
+func TestSignAssetURLDisabled(t *testing.T) {
+	if got := signAssetURL(config.Config{}, "/api/thumbnails/x.jpg"); got != "/api/thumbnails/x.jpg" {
+		t.Errorf("signAssetURL without a secret = %q, want the path unchanged", got)
+	}
+	if got := serveSigned(config.Config{}, "/api/thumbnails/x.jpg"); got != http.StatusOK {
+		t.Errorf("unsigned request without a secret: status = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestSignAssetURLExpiryIsRoundedToAPeriod(t *testing.T) {
+	cfg := signedTestConfig()
+	signed, err := url.Parse(signAssetURL(cfg, "/api/thumbnails/x.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, err := strconv.ParseInt(signed.Query().Get(assetURLExpiresParam), 10, 64)
+	if err != nil {
+		t.Fatalf("expires param: %v", err)
+	}
+	period := int64(cfg.AssetURLExpirySeconds)
+	if expires%period != 0 {
+		t.Errorf("expires %d is not a multiple of the %d second period", expires, period)
+	}
+	if lifetime := expires - time.Now().Unix(); lifetime < period || lifetime > 2*period {
+		t.Errorf("signed URL lives %d seconds, want between %d and %d", lifetime, period, 2*period)
+	}
+}
+
+func TestSignedAssetMiddleware(t *testing.T) {
+	cfg := signedTestConfig()
+	signed := signAssetURL(cfg, "/api/thumbnails/x.jpg")
+	expired := time.Now().Add(-time.Minute).Unix()
+	expiredURL := "/api/thumbnails/x.jpg?" + assetURLExpiresParam + "=" + strconv.FormatInt(expired, 10) +
+		"&" + assetURLSignatureParam + "=" + assetURLSignature(cfg.AssetURLSecret, "/api/thumbnails/x.jpg", expired)
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"valid signature", signed, http.StatusOK},
+		{"unsigned", "/api/thumbnails/x.jpg", http.StatusForbidden},
+		{"signature of another asset", strings.Replace(signed, "x.jpg", "y.jpg", 1), http.StatusForbidden},
+		{"tampered signature", signed[:len(signed)-2] + "AA", http.StatusForbidden},
+		{"extended expiry", strings.Replace(signed, assetURLExpiresParam+"=", assetURLExpiresParam+"=1", 1), http.StatusForbidden},
+		{"expired", expiredURL, http.StatusForbidden},
+		{"missing expiry", "/api/thumbnails/x.jpg?" + assetURLSignatureParam + "=abc", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveSigned(cfg, tt.target); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	other := cfg
+	other.AssetURLSecret = "other-secret"
+	if got := serveSigned(other, signed); got != http.StatusForbidden {
+		t.Errorf("URL signed with another secret: status = %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestStreamAndResizeURLsAreEscapedAndVerify(t *testing.T) {
+	cfg := signedTestConfig()
+	tests := []struct {
+		name string
+		url  string
+		path string
+	}{
+		{"stream", streamURL(cfg, "events/new year #1.mov", "master.m3u8"), "/api/stream/events/new%20year%20%231.mov/master.m3u8"},
+		{"resize", resizeURL(cfg, "events/new year #1.jpg"), "/api/resize/events/new%20year%20%231.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.HasPrefix(tt.url, tt.path+"?") {
+				t.Errorf("URL %q does not start with the escaped path %q", tt.url, tt.path)
+			}
+			if got := serveSigned(cfg, tt.url); got != http.StatusOK {
+				t.Errorf("status = %d, want %d", got, http.StatusOK)
+			}
+		})
+	}
+
+	// the resize params are appended by clients and left out of the signature
+	if got := serveSigned(cfg, resizeURL(cfg, "a.jpg")+"&w=640&fit=cover"); got != http.StatusOK {
+		t.Errorf("resize URL with params: status = %d, want %d", got, http.StatusOK)
+	}
+}
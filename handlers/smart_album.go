@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+const defaultContentsLimit = 120
+
+// SmartAlbumResponse is a smart album with its rules decoded
+type SmartAlbumResponse struct {
+	*models.SmartAlbum
+	Rules models.SmartAlbumRules `json:"rules"`
+}
+
+func smartAlbumResponse(album *models.SmartAlbum) SmartAlbumResponse {
+	response := SmartAlbumResponse{SmartAlbum: album}
+	if rules, err := decodeSmartAlbumRules(album.Rules); err != nil {
+		log.Printf("Error decoding rules of smart album %d: %v", album.ID, err)
+	} else {
+		response.Rules = rules
+	}
+	return response
+}
+
+func decodeSmartAlbumRules(raw string) (models.SmartAlbumRules, error) {
+	var rules models.SmartAlbumRules
+	if raw == "" {
+		return rules, nil
+	}
+	err := json.Unmarshal([]byte(raw), &rules)
+	return rules, err
+}
+
+// validateSmartAlbumRules rejects rules that match everything or cannot be evaluated
+func validateSmartAlbumRules(rules models.SmartAlbumRules) error {
+	if rules.TakenAfter == nil && rules.TakenBefore == nil && len(rules.CameraMakes) == 0 &&
+		len(rules.CameraModels) == 0 && len(rules.PersonIDs) == 0 && len(rules.FolderGlobs) == 0 && rules.MediaType == "" &&
+		len(rules.Locations) == 0 && len(rules.Tags) == 0 && len(rules.MachineTags) == 0 {
+		return errors.New("rules must contain at least one condition")
+	}
+	if rules.TakenAfter != nil && rules.TakenBefore != nil && *rules.TakenAfter >= *rules.TakenBefore {
+		return errors.New("taken_after must be before taken_before")
+	}
+	for _, glob := range rules.FolderGlobs {
+		if strings.TrimSpace(glob) == "" {
+			return errors.New("folder_globs must not contain empty patterns")
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid folder glob %q", glob)
+		}
+	}
+	for _, location := range rules.Locations {
+		if strings.TrimSpace(location) == "" {
+			return errors.New("locations must not contain empty names")
+		}
+	}
+	for _, tag := range rules.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("tags must not contain empty names")
+		}
+	}
+	for _, tag := range rules.MachineTags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("machine_tags must not contain empty names")
+		}
+	}
+	if rules.MediaType != "" && rules.MediaType != database.MediaTypeImage && rules.MediaType != database.MediaTypeVideo && rules.MediaType != database.MediaTypeDocument {
+		return fmt.Errorf("media_type must be %q, %q or %q", database.MediaTypeImage, database.MediaTypeVideo, database.MediaTypeDocument)
+	}
+	return nil
+}
+
+// writeSmartAlbumContents responds with a page of the images matching a smart album's rules,
+// in the same shape as a regular album's contents
+func writeSmartAlbumContents(w http.ResponseWriter, r *http.Request, cfg config.Config, repo repository.SmartAlbumRepositoryInterface, album *models.SmartAlbum) {
+	rules, err := decodeSmartAlbumRules(album.Rules)
+	if err != nil {
+		log.Printf("Error decoding rules of smart album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Smart album configuration error"})
+		return
+	}
+
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	images, total, err := repo.ListImages(rules, album.SortOrder, hidesNSFW(cfg, r), offset, limit)
+	if err != nil {
+		log.Printf("Error listing contents for smart album %d/%s: %v", album.ID, album.Slug, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list album contents"})
+		return
+	}
+
+	files := make([]FileInfo, 0, len(images))
+	for i := range images {
+		files = append(files, fileInfoFromImage(&images[i], cfg))
+	}
+	listing := DirectoryListing{Files: files}
+	listing.paginate(offset, limit, int(total))
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// fileInfoFromImage builds a listing entry from an image record. the size and modification
+// time come from the file when it can be read.
+func fileInfoFromImage(img *models.Image, cfg config.Config) FileInfo {
+	fileInfo := FileInfo{
+		Name:            path.Base(img.OriginalPath),
+		Path:            "/" + img.OriginalPath,
+		ModTime:         img.LastModified,
+		Width:           img.Width,
+		Height:          img.Height,
+		Aperture:        img.Aperture,
+		ShutterSpeed:    img.ShutterSpeed,
+		ISO:             img.ISO,
+		FocalLength:     img.FocalLength,
+		LensMake:        img.LensMake,
+		LensModel:       img.LensModel,
+		CameraMake:      img.CameraMake,
+		CameraModel:     img.CameraModel,
+		TakenAt:         img.TakenAt,
+		Latitude:        img.Latitude,
+		Longitude:       img.Longitude,
+		Altitude:        img.Altitude,
+		Location:        img.Location,
+		Description:     img.Description,
+		Title:           img.Title,
+		Copyright:       img.Copyright,
+		License:         img.License,
+		StackID:         img.StackID,
+		StackBest:       img.StackBest,
+		Projection:      img.Projection,
+		ThumbnailStatus: img.ThumbnailStatus,
+	}
+	if img.FileSize != nil {
+		fileInfo.Size = *img.FileSize
+	}
+	if img.MediaType != database.MediaTypeVideo && img.LivePairPath != nil {
+		motionPath := "/" + *img.LivePairPath
+		fileInfo.LivePhotoPath = &motionPath
+	}
+	if info, err := os.Stat(cfg.ResolvePath(img.OriginalPath)); err == nil {
+		fileInfo.Size = info.Size()
+		fileInfo.ModTime = info.ModTime().Unix()
+	}
+	if img.ThumbnailPath != nil && img.ThumbnailStatus == database.StatusDone {
+		thumbURL := thumbnailURL(cfg, *img.ThumbnailPath)
+		fileInfo.ThumbnailPath = &thumbURL
+		fileInfo.Thumbnails = thumbnailURLs(img, cfg)
+		fileInfo.Blurhash = img.Blurhash
+	}
+	if media.IsProcessableImage(img.OriginalPath) {
+		fileInfo.ResizeURL = resizeURL(cfg, img.OriginalPath)
+	}
+
+	if img.MediaType == database.MediaTypeVideo {
+		fileInfo.MediaType = database.MediaTypeVideo
+		fileInfo.Duration = img.Duration
+		fileInfo.VideoCodec = img.VideoCodec
+		fileInfo.AudioCodec = img.AudioCodec
+		fileInfo.Bitrate = img.Bitrate
+		fileInfo.TranscodeStatus = img.TranscodeStatus
+		if img.RenditionPath != nil && img.TranscodeStatus == database.StatusDone {
+			videoURL := renditionURL(cfg, *img.RenditionPath)
+			fileInfo.RenditionPath = &videoURL
+		}
+		fileInfo.StreamPath = streamMasterURL(cfg, img)
+		return fileInfo
+	}
+	if img.MediaType == database.MediaTypeDocument {
+		fileInfo.MediaType = database.MediaTypeDocument
+		return fileInfo
+	}
+	fileInfo.MetadataStatus = img.MetadataStatus
+	fileInfo.DetectionStatus = img.DetectionStatus
+	return fileInfo
+}
+
+// getSmartAlbumBySlug looks up the smart album served under a slug that no regular album
+// uses. returns nil if there is none; lookup errors are logged and treated the same way.
+func (ah *AlbumHandler) getSmartAlbumBySlug(slug string) *models.SmartAlbum {
+	if ah.SmartAlbumRepo == nil {
+		return nil
+	}
+	album, err := ah.SmartAlbumRepo.GetBySlug(slug)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error getting smart album by slug '%s': %v", slug, err)
+		}
+		return nil
+	}
+	return album
+}
+
+// ListSmartAlbums lists the smart albums that are not hidden
+func (ah *AlbumHandler) ListSmartAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, err := ah.SmartAlbumRepo.ListAll()
+	if err != nil {
+		log.Printf("Error listing smart albums: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve smart albums"})
+		return
+	}
+	response := make([]SmartAlbumResponse, len(albums))
+	for i := range albums {
+		response[i] = smartAlbumResponse(&albums[i])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
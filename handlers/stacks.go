@@ -0,0 +1,37 @@
+package handlers
+
+// collapseStacks leaves one entry of each burst stack in a sorted listing: its best frame, or
+// the first frame listed when the best one isn't, e.g. after it was deleted. the entry kept
+// records how many frames it stands for; a stack down to one frame is listed as a plain image.
+func collapseStacks(entries []entryInfo) []entryInfo {
+	shown := make(map[string]int) // index of the entry shown by stack ID
+	counts := make(map[string]int)
+	for i, ei := range entries {
+		if ei.imageInfo == nil || ei.imageInfo.StackID == nil {
+			continue
+		}
+		id := *ei.imageInfo.StackID
+		counts[id]++
+		if current, ok := shown[id]; !ok || (ei.imageInfo.StackBest && !entries[current].imageInfo.StackBest) {
+			shown[id] = i
+		}
+	}
+	if len(shown) == 0 {
+		return entries
+	}
+
+	collapsed := make([]entryInfo, 0, len(entries))
+	for i, ei := range entries {
+		if ei.imageInfo != nil && ei.imageInfo.StackID != nil {
+			id := *ei.imageInfo.StackID
+			if shown[id] != i {
+				continue
+			}
+			if counts[id] > 1 {
+				ei.stackSize = counts[id]
+			}
+		}
+		collapsed = append(collapsed, ei)
+	}
+	return collapsed
+}
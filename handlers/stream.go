@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+	"gorm.io/gorm"
+)
+
+// route prefix of the HLS streams of videos, followed by the path of the video
+const streamAPIPrefix = "/api/stream/"
+
+// StreamHandler serves the HLS streams long videos are packaged into, so they can be played
+// without downloading the whole file
+type StreamHandler struct {
+	ImageRepo  repository.ImageRepositoryInterface
+	MediaStore media.Store
+	Cfg        config.Config
+}
+
+// NewStreamHandler creates a new StreamHandler
+func NewStreamHandler(imageRepo repository.ImageRepositoryInterface, mediaStore media.Store, cfg config.Config) *StreamHandler {
+	return &StreamHandler{ImageRepo: imageRepo, MediaStore: mediaStore, Cfg: cfg}
+}
+
+// ServeStream serves the master playlist, variant playlists and segments of the stream of a
+// video. playlists are rewritten to list the signed URLs of their variants and segments.
+// Route: GET /api/stream/{path}/master.m3u8, and the files it lists
+func (h *StreamHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	dir, file := path.Split(strings.TrimPrefix(r.URL.Path, streamAPIPrefix))
+	relPath, err := utils.CleanRelPath(strings.TrimSuffix(dir, "/"))
+	if dir == "" || file == "" || err != nil || !media.IsVideo(relPath) || !h.Cfg.VideoHLSEnabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	video, err := h.ImageRepo.GetByPath(relPath)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("Stream: Error loading video %s: %v", relPath, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// only the files of the current stream are served, never arbitrary asset paths
+	assetPath := ""
+	if video.StreamStatus == database.StatusDone {
+		for _, streamFile := range video.StreamFiles {
+			if path.Base(streamFile) == file {
+				assetPath = streamFile
+				break
+			}
+		}
+	}
+	if assetPath == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	reader, info, err := h.MediaStore.Get(assetPath)
+	if err != nil {
+		log.Printf("Stream: Error opening %s of %s: %v", assetPath, relPath, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer reader.Close()
+
+	if strings.HasSuffix(file, media.HLSPlaylistExtension) {
+		playlist, err := io.ReadAll(reader)
+		if err != nil {
+			log.Printf("Stream: Error reading %s of %s: %v", assetPath, relPath, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		// the signed URLs in it expire, so it isn't cached like the segments are
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(rewriteHLSPlaylist(playlist, func(uri string) string {
+			return streamURL(h.Cfg, relPath, uri)
+		}))
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	setAssetCacheHeaders(w, info, true)
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, file, info.ModTime(), seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Stream: Error sending %s of %s: %v", assetPath, relPath, err)
+	}
+}
+
+// rewriteHLSPlaylist replaces the URI lines of a playlist, those that aren't tags or blank
+func rewriteHLSPlaylist(playlist []byte, rewrite func(uri string) string) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = rewrite(line)
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
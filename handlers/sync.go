@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// defaultSyncLimit is the number of changes in a page of the sync API when no limit is given
+const defaultSyncLimit = 500
+
+// SyncHandler serves the changes to the library for client apps that keep a local mirror
+type SyncHandler struct {
+	SyncRepo  repository.SyncRepositoryInterface
+	ImageRepo repository.ImageRepositoryInterface
+	AlbumRepo repository.AlbumRepositoryInterface
+	Cfg       config.Config
+}
+
+// NewSyncHandler creates a new SyncHandler
+func NewSyncHandler(syncRepo repository.SyncRepositoryInterface, imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, cfg config.Config) *SyncHandler {
+	return &SyncHandler{SyncRepo: syncRepo, ImageRepo: imageRepo, AlbumRepo: albumRepo, Cfg: cfg}
+}
+
+// SyncAlbum is an album as sent by the sync API, with the URLs of its assets
+type SyncAlbum struct {
+	models.Album
+	AlbumAssetURLs
+}
+
+// SyncImageChanges are the images created or changed and the paths of those deleted
+type SyncImageChanges struct {
+	Upserted []FileInfo `json:"upserted"`
+	Deleted  []string   `json:"deleted"` // in the form of FileInfo.Path
+}
+
+// SyncAlbumChanges are the albums created or changed and the IDs of those deleted
+type SyncAlbumChanges struct {
+	Upserted []SyncAlbum `json:"upserted"`
+	Deleted  []uint      `json:"deleted"`
+}
+
+// SyncFaceChanges are the faces created or changed and the IDs of those deleted
+type SyncFaceChanges struct {
+	Upserted []models.Face `json:"upserted"`
+	Deleted  []uint        `json:"deleted"`
+}
+
+// SyncChanges is a page of the sync API. Cursor is passed as since to get the next page, and
+// is kept by clients between syncs once HasMore is false.
+type SyncChanges struct {
+	Cursor  string           `json:"cursor"`
+	HasMore bool             `json:"has_more"`
+	Reset   bool             `json:"reset"` // the since cursor is no longer valid, e.g. after a restore: the mirror is dropped and the changes start from the beginning
+	Images  SyncImageChanges `json:"images"`
+	Albums  SyncAlbumChanges `json:"albums"`
+	Faces   SyncFaceChanges  `json:"faces"`
+}
+
+// encodeSyncCursor turns a sync log position into an opaque cursor token
+func encodeSyncCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("s:" + strconv.FormatInt(seq, 10)))
+}
+
+func decodeSyncCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	value, ok := strings.CutPrefix(string(raw), "s:")
+	if !ok {
+		return 0, errors.New("invalid cursor")
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return seq, nil
+}
+
+// GetChanges returns the images, albums and faces created, changed or deleted after the since
+// cursor, oldest change first; without since, the whole library. only what the user may view
+// the content of is sent: images and their faces in albums the user has access to, like
+// /api/me/photos. anything else that changed, e.g. an album that became hidden, is reported
+// as deleted, and clients drop the images below the folder of a deleted album.
+// Route: GET /api/sync/changes?since=...&limit=...
+func (h *SyncHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+	q := r.URL.Query()
+	var since int64
+	if c := q.Get("since"); c != "" {
+		v, err := decodeSyncCursor(c)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		since = v
+	}
+	limit := defaultSyncLimit
+	if l := q.Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(v, maxPageLimit)
+	}
+
+	// read before the changes, so every change up to head is in the listing
+	head, reset, err := h.SyncRepo.Bounds()
+	if err != nil {
+		log.Printf("Error reading sync log for user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list changes"})
+		return
+	}
+	response := SyncChanges{
+		Images: SyncImageChanges{Upserted: []FileInfo{}, Deleted: []string{}},
+		Albums: SyncAlbumChanges{Upserted: []SyncAlbum{}, Deleted: []uint{}},
+		Faces:  SyncFaceChanges{Upserted: []models.Face{}, Deleted: []uint{}},
+	}
+	// a cursor from before the log was started over, or from another server
+	if since > head || (since > 0 && since < reset) {
+		response.Reset = true
+		since = 0
+	}
+
+	changes, err := h.SyncRepo.ListChanges(since, limit+1)
+	if err != nil {
+		log.Printf("Error listing sync changes for user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list changes"})
+		return
+	}
+	response.HasMore = len(changes) > limit
+	if response.HasMore {
+		changes = changes[:limit]
+		response.Cursor = encodeSyncCursor(changes[len(changes)-1].Seq)
+	} else if len(changes) > 0 {
+		response.Cursor = encodeSyncCursor(max(changes[len(changes)-1].Seq, head))
+	} else {
+		response.Cursor = encodeSyncCursor(max(since, head))
+	}
+
+	albums, err := h.AlbumRepo.ListAllAdmin()
+	if err != nil {
+		log.Printf("Error listing albums for sync of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list changes"})
+		return
+	}
+	albumsByID := make(map[uint]*models.Album, len(albums))
+	var subtrees []string
+	for i := range albums {
+		albumsByID[albums[i].ID] = &albums[i]
+		if canAccessAlbum(user, &albums[i], "album.view.content") {
+			subtrees = append(subtrees, strings.Trim(albums[i].FolderPath, "/"))
+		}
+	}
+	imageVisible := func(imagePath string) bool {
+		for _, folder := range subtrees {
+			if folder == "" || folder == "." || strings.HasPrefix(imagePath, folder+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var imagePaths []string
+	var faceIDs []uint
+	for _, change := range changes {
+		if change.Deleted {
+			continue
+		}
+		switch change.Entity {
+		case models.SyncEntityImage:
+			imagePaths = append(imagePaths, change.Key)
+		case models.SyncEntityFace:
+			if id, err := strconv.ParseUint(change.Key, 10, 64); err == nil {
+				faceIDs = append(faceIDs, uint(id))
+			}
+		}
+	}
+	images, err := h.ImageRepo.GetImagesByPaths(imagePaths)
+	if err != nil {
+		log.Printf("Error loading changed images for sync of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list changes"})
+		return
+	}
+	imagesByPath := make(map[string]*models.Image, len(images))
+	for i := range images {
+		imagesByPath[images[i].OriginalPath] = &images[i]
+	}
+	faces, err := h.SyncRepo.ListFacesByIDs(faceIDs)
+	if err != nil {
+		log.Printf("Error loading changed faces for sync of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list changes"})
+		return
+	}
+	facesByID := make(map[uint]*models.Face, len(faces))
+	for i := range faces {
+		facesByID[faces[i].ID] = &faces[i]
+	}
+
+	for _, change := range changes {
+		switch change.Entity {
+		case models.SyncEntityImage:
+			if img, ok := imagesByPath[change.Key]; ok && !change.Deleted && imageVisible(img.OriginalPath) {
+				response.Images.Upserted = append(response.Images.Upserted, fileInfoFromImage(img, h.Cfg))
+			} else {
+				response.Images.Deleted = append(response.Images.Deleted, "/"+change.Key)
+			}
+		case models.SyncEntityAlbum:
+			id, err := strconv.ParseUint(change.Key, 10, 64)
+			if err != nil {
+				continue
+			}
+			if album, ok := albumsByID[uint(id)]; ok && !change.Deleted && canAccessAlbum(user, album, "album.view.content") {
+				response.Albums.Upserted = append(response.Albums.Upserted, SyncAlbum{Album: *album, AlbumAssetURLs: albumAssetURLs(h.Cfg, album)})
+			} else {
+				response.Albums.Deleted = append(response.Albums.Deleted, uint(id))
+			}
+		case models.SyncEntityFace:
+			id, err := strconv.ParseUint(change.Key, 10, 64)
+			if err != nil {
+				continue
+			}
+			if face, ok := facesByID[uint(id)]; ok && !change.Deleted && imageVisible(face.ImagePath) {
+				response.Faces.Upserted = append(response.Faces.Upserted, *face)
+			} else {
+				response.Faces.Deleted = append(response.Faces.Deleted, uint(id))
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/utils"
+)
+
+type TagHandler struct {
+	TagRepo        repository.TagRepositoryInterface
+	MachineTagRepo repository.MachineTagRepositoryInterface
+}
+
+// NewTagHandler creates a new TagHandler
+func NewTagHandler(tagRepo repository.TagRepositoryInterface, machineTagRepo repository.MachineTagRepositoryInterface) *TagHandler {
+	return &TagHandler{TagRepo: tagRepo, MachineTagRepo: machineTagRepo}
+}
+
+// ListTags returns every tag with the number of images carrying it, ordered by name
+// Route: GET /api/tags
+func (th *TagHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.TagRepo.ListWithCounts()
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve tags"})
+		return
+	}
+	if tags == nil {
+		tags = []repository.TagCount{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// ListImageTags returns the tags of an image, ordered by name
+// Route: GET /api/images/tags?path=...
+func (th *TagHandler) ListImageTags(w http.ResponseWriter, r *http.Request) {
+	imagePath := r.URL.Query().Get("path")
+	if imagePath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return
+	}
+	imagePathForDB, err := utils.CleanRelPath(strings.TrimPrefix(imagePath, "/"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must be relative and cannot use '..'"})
+		return
+	}
+	tags, err := th.TagRepo.ListByImagePath(imagePathForDB)
+	if err != nil {
+		log.Printf("Error listing tags for image %s: %v", imagePathForDB, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve tags for image"})
+		return
+	}
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// ListMachineTags returns every machine tag given by image classification with the number of
+// images carrying it, ordered by name
+// Route: GET /api/machine-tags
+func (th *TagHandler) ListMachineTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.MachineTagRepo.ListWithCounts()
+	if err != nil {
+		log.Printf("Error listing machine tags: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve machine tags"})
+		return
+	}
+	if tags == nil {
+		tags = []repository.MachineTagCount{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// ListImageMachineTags returns the machine tags of an image, most confident first
+// Route: GET /api/images/machine-tags?path=...
+func (th *TagHandler) ListImageMachineTags(w http.ResponseWriter, r *http.Request) {
+	imagePath := r.URL.Query().Get("path")
+	if imagePath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing required query parameter: path"})
+		return
+	}
+	imagePathForDB, err := utils.CleanRelPath(strings.TrimPrefix(imagePath, "/"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must be relative and cannot use '..'"})
+		return
+	}
+	tags, err := th.MachineTagRepo.ListByImagePath(imagePathForDB)
+	if err != nil {
+		log.Printf("Error listing machine tags for image %s: %v", imagePathForDB, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve machine tags for image"})
+		return
+	}
+	if tags == nil {
+		tags = []models.MachineTag{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
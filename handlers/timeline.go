@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultTimelineLimit is the number of buckets in a timeline page when no limit is given
+const defaultTimelineLimit = 60
+
+// timelineKeyLayouts are the layouts of the bucket keys of each timeline granularity
+var timelineKeyLayouts = map[string]string{
+	repository.TimelineYear:  "2006",
+	repository.TimelineMonth: "2006-01",
+	repository.TimelineDay:   "2006-01-02",
+}
+
+// timelineRank orders the granularities from coarsest to finest
+var timelineRank = map[string]int{
+	repository.TimelineYear:  0,
+	repository.TimelineMonth: 1,
+	repository.TimelineDay:   2,
+}
+
+type TimelineHandler struct {
+	ImageRepo repository.ImageRepositoryInterface
+	AlbumRepo repository.AlbumRepositoryInterface
+	Cfg       config.Config
+}
+
+// NewTimelineHandler creates a new TimelineHandler
+func NewTimelineHandler(imageRepo repository.ImageRepositoryInterface, albumRepo repository.AlbumRepositoryInterface, cfg config.Config) *TimelineHandler {
+	return &TimelineHandler{ImageRepo: imageRepo, AlbumRepo: albumRepo, Cfg: cfg}
+}
+
+// TimelineBucketResponse is the images taken in one year, month or day
+type TimelineBucketResponse struct {
+	Key   string    `json:"key"`   // e.g. "2024", "2024-03" or "2024-03-15"; pass to /api/timeline/{key}
+	Start int64     `json:"start"` // Unix timestamp, inclusive
+	End   int64     `json:"end"`   // Unix timestamp, exclusive
+	Count int64     `json:"count"`
+	Cover *FileInfo `json:"cover,omitempty"` // the most recently taken image
+}
+
+// TimelineResponse is a page of timeline buckets, newest first
+type TimelineResponse struct {
+	Granularity string                   `json:"granularity"`
+	Within      string                   `json:"within,omitempty"`
+	Buckets     []TimelineBucketResponse `json:"buckets"`
+	Total       int                      `json:"total"`
+	Offset      int                      `json:"offset"`
+	Limit       int                      `json:"limit"`
+	HasMore     bool                     `json:"has_more"`
+	NextCursor  string                   `json:"next_cursor,omitempty"` // pass as ?cursor= to get the next page
+}
+
+// GetTimeline groups the images by the year, month or day they were taken in (server local
+// time), newest first, with the number of images and a cover image per group. images without
+// a capture time are left out. within limits the groups to those inside a coarser bucket,
+// e.g. granularity=day&within=2024-03 lists the days of March 2024.
+// Route: GET /api/timeline?granularity=year|month|day&within=...&offset=...&limit=...
+func (th *TimelineHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = repository.TimelineMonth
+	}
+	if _, ok := timelineKeyLayouts[granularity]; !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "granularity must be year, month or day"})
+		return
+	}
+
+	var takenAfter, takenBefore *int64
+	within := r.URL.Query().Get("within")
+	if within != "" {
+		withinGranularity, start, end, err := parseTimelineKey(within)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "within: " + err.Error()})
+			return
+		}
+		if timelineRank[withinGranularity] >= timelineRank[granularity] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "within must be a longer period than the granularity"})
+			return
+		}
+		startUnix, endUnix := start.Unix(), end.Unix()
+		takenAfter, takenBefore = &startUnix, &endUnix
+	}
+
+	offset, limit, err := parsePageParams(r, defaultTimelineLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(th.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for timeline: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load timeline"})
+		return
+	}
+
+	buckets, total, err := th.ImageRepo.ListTimelineBuckets(granularity, takenAfter, takenBefore, hidesNSFW(th.Cfg, r), hiddenFolders, offset, limit)
+	if err != nil {
+		log.Printf("Error listing %s timeline: %v", granularity, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load timeline"})
+		return
+	}
+
+	covers := make(map[string]*FileInfo, len(buckets))
+	if len(buckets) > 0 {
+		paths := make([]string, len(buckets))
+		for i, bucket := range buckets {
+			paths[i] = bucket.CoverPath
+		}
+		images, err := th.ImageRepo.GetImagesByPaths(paths)
+		if err != nil {
+			log.Printf("Error loading timeline cover images: %v", err)
+		}
+		for i := range images {
+			file := fileInfoFromImage(&images[i], th.Cfg)
+			covers[images[i].OriginalPath] = &file
+		}
+	}
+
+	response := TimelineResponse{
+		Granularity: granularity,
+		Within:      within,
+		Buckets:     make([]TimelineBucketResponse, 0, len(buckets)),
+		Total:       int(total),
+		Offset:      offset,
+		Limit:       limit,
+	}
+	for _, bucket := range buckets {
+		item := TimelineBucketResponse{Key: bucket.Key, Count: bucket.Count, Cover: covers[bucket.CoverPath]}
+		if _, start, end, err := parseTimelineKey(bucket.Key); err == nil {
+			item.Start, item.End = start.Unix(), end.Unix()
+		}
+		response.Buckets = append(response.Buckets, item)
+	}
+	if next := offset + limit; next < response.Total {
+		response.HasMore = true
+		response.NextCursor = encodeCursor(next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetTimelineBucket returns a page of the images taken in one timeline bucket, newest first,
+// in the same shape as album contents
+// Route: GET /api/timeline/{bucket}?offset=...&limit=...
+func (th *TimelineHandler) GetTimelineBucket(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "bucket")
+	_, start, end, err := parseTimelineKey(key)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	offset, limit, err := parsePageParams(r, defaultContentsLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	hiddenFolders, err := hiddenAlbumFolders(th.AlbumRepo, currentUser(r))
+	if err != nil {
+		log.Printf("Error listing hidden albums for timeline bucket %s: %v", key, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load timeline"})
+		return
+	}
+
+	startUnix, endUnix := start.Unix(), end.Unix()
+	filter := repository.ImageFilter{TakenAfter: &startUnix, TakenBefore: &endUnix, ExcludeNSFW: hidesNSFW(th.Cfg, r), ExcludeSubtrees: hiddenFolders}
+	images, total, err := th.ImageRepo.ListFiltered(filter, database.SortDateDesc, offset, limit)
+	if err != nil {
+		log.Printf("Error listing timeline bucket %s: %v", key, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to load timeline"})
+		return
+	}
+
+	files := make([]FileInfo, 0, len(images))
+	for i := range images {
+		files = append(files, fileInfoFromImage(&images[i], th.Cfg))
+	}
+	listing := DirectoryListing{Path: key, Files: files}
+	listing.paginate(offset, limit, int(total))
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// parseTimelineKey returns the granularity of a bucket key and the local time range it covers
+func parseTimelineKey(key string) (string, time.Time, time.Time, error) {
+	for granularity, layout := range timelineKeyLayouts {
+		if len(key) != len(layout) {
+			continue
+		}
+		start, err := time.ParseInLocation(layout, key, time.Local)
+		if err != nil {
+			break
+		}
+		switch granularity {
+		case repository.TimelineYear:
+			return granularity, start, start.AddDate(1, 0, 0), nil
+		case repository.TimelineMonth:
+			return granularity, start, start.AddDate(0, 1, 0), nil
+		default:
+			return granularity, start, start.AddDate(0, 0, 1), nil
+		}
+	}
+	return "", time.Time{}, time.Time{}, errors.New("bucket must be a year (2024), month (2024-03) or day (2024-03-15)")
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+const bytesPerMB = 1 << 20
+
+// UploadQuota limits how much each user may upload. usage is the total size of the images
+// and videos a user uploaded that still exist.
+type UploadQuota struct {
+	ImageRepo repository.ImageRepositoryInterface
+	DefaultMB int // applies to users without their own quota, 0 is unlimited
+}
+
+func NewUploadQuota(imageRepo repository.ImageRepositoryInterface, cfg config.Config) *UploadQuota {
+	return &UploadQuota{ImageRepo: imageRepo, DefaultMB: cfg.UploadQuotaMB}
+}
+
+// UploadQuotaUsage describes how much of their quota a user has used
+type UploadQuotaUsage struct {
+	UserID         uint   `json:"user_id"`
+	Username       string `json:"username,omitempty"`
+	Files          int64  `json:"files"`
+	UsedBytes      int64  `json:"used_bytes"`
+	QuotaBytes     *int64 `json:"quota_bytes"` // null is unlimited
+	RemainingBytes *int64 `json:"remaining_bytes,omitempty"`
+}
+
+// LimitBytes returns how many bytes a user may upload in total, or 0 for no limit
+func (q *UploadQuota) LimitBytes(user *models.User) int64 {
+	if q == nil || user == nil {
+		return 0
+	}
+	quotaMB := q.DefaultMB
+	if user.UploadQuotaMB != nil {
+		quotaMB = *user.UploadQuotaMB
+	}
+	if quotaMB <= 0 {
+		return 0
+	}
+	return int64(quotaMB) * bytesPerMB
+}
+
+// Usage returns the upload usage of a user
+func (q *UploadQuota) Usage(user *models.User) (UploadQuotaUsage, error) {
+	usage, err := q.ImageRepo.GetUploadUsage(user.ID)
+	if err != nil {
+		return UploadQuotaUsage{}, err
+	}
+	return q.describe(user, usage), nil
+}
+
+func (q *UploadQuota) describe(user *models.User, usage repository.UploadUsage) UploadQuotaUsage {
+	described := UploadQuotaUsage{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Files:     usage.Files,
+		UsedBytes: usage.Bytes,
+	}
+	if limit := q.LimitBytes(user); limit > 0 {
+		remaining := limit - usage.Bytes
+		if remaining < 0 {
+			remaining = 0
+		}
+		described.QuotaBytes = &limit
+		described.RemainingBytes = &remaining
+	}
+	return described
+}
+
+// AdminUploadUsageHandler reports how much each user has uploaded
+type AdminUploadUsageHandler struct {
+	UserRepo repository.UserRepository
+	Quota    *UploadQuota
+}
+
+func NewAdminUploadUsageHandler(userRepo repository.UserRepository, quota *UploadQuota) *AdminUploadUsageHandler {
+	return &AdminUploadUsageHandler{UserRepo: userRepo, Quota: quota}
+}
+
+// ListUsage handles GET /api/admin/upload-usage, listing every user with their usage and
+// quota, largest usage first
+func (h *AdminUploadUsageHandler) ListUsage(w http.ResponseWriter, r *http.Request) {
+	users, err := h.UserRepo.ListAll()
+	if err != nil {
+		http.Error(w, "Failed to retrieve users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	usages, err := h.Quota.ImageRepo.ListUploadUsage()
+	if err != nil {
+		log.Printf("Error listing upload usage: %v", err)
+		http.Error(w, "Failed to retrieve upload usage", http.StatusInternalServerError)
+		return
+	}
+	byUser := make(map[uint]repository.UploadUsage, len(usages))
+	for _, usage := range usages {
+		byUser[usage.UserID] = usage
+	}
+
+	report := make([]UploadQuotaUsage, 0, len(users))
+	for i := range users {
+		report = append(report, h.Quota.describe(&users[i], byUser[users[i].ID]))
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].UsedBytes > report[j].UsedBytes
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"default_quota_mb": h.Quota.DefaultMB,
+		"users":            report,
+	})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// WatermarkPayload sets the watermark of an album. the overlay image is uploaded separately
+type WatermarkPayload struct {
+	Text     *string  `json:"text"`
+	Position *string  `json:"position,omitempty"`
+	Opacity  *float64 `json:"opacity,omitempty"`
+}
+
+// albumForWatermark fetches the album named by the {id} URL param, writing an error response if it can't
+func (ah *AlbumHandler) albumForWatermark(w http.ResponseWriter, r *http.Request) (*models.Album, bool) {
+	identifier := chi.URLParam(r, "id")
+	album, err := ah.getAlbumByIdentifier(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Album not found"})
+		} else {
+			log.Printf("Error finding album '%s' for watermark: %v", identifier, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to find album"})
+		}
+		return nil, false
+	}
+	return album, true
+}
+
+// writeUpdatedWatermark responds with the admin view of the album after a watermark change
+func (ah *AlbumHandler) writeUpdatedWatermark(w http.ResponseWriter, albumID uint) {
+	updatedAlbum, err := ah.AlbumRepo.GetByID(albumID)
+	if err != nil {
+		log.Printf("Error fetching updated album %d after watermark change: %v", albumID, err)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Watermark updated successfully"})
+		return
+	}
+	writeJSON(w, http.StatusOK, convertAlbumToAdminResponse(updatedAlbum, ah.Cfg))
+}
+
+// UpdateAlbumWatermark sets the watermark text, position and opacity of an album. an
+// uploaded overlay image is kept and takes precedence over the text.
+// Route: PUT /admin/albums/{id}/watermark
+func (ah *AlbumHandler) UpdateAlbumWatermark(w http.ResponseWriter, r *http.Request) {
+	album, ok := ah.albumForWatermark(w, r)
+	if !ok {
+		return
+	}
+
+	var payload WatermarkPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	text := payload.Text
+	if text != nil {
+		trimmed := strings.TrimSpace(*text)
+		text = &trimmed
+		if trimmed == "" {
+			text = nil
+		}
+	}
+	position := album.WatermarkPosition
+	if payload.Position != nil {
+		position = *payload.Position
+	}
+	if !media.IsValidWatermarkPosition(position) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid watermark position provided"})
+		return
+	}
+	opacity := album.WatermarkOpacity
+	if payload.Opacity != nil {
+		opacity = *payload.Opacity
+	}
+	if opacity <= 0 || opacity > 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "opacity must be greater than 0 and at most 1"})
+		return
+	}
+
+	if err := ah.AlbumRepo.UpdateWatermark(album.ID, text, album.WatermarkImagePath, position, opacity); err != nil {
+		log.Printf("Error updating watermark for album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update watermark"})
+		return
+	}
+	ah.writeUpdatedWatermark(w, album.ID)
+}
+
+// UploadAlbumWatermarkImage sets the overlay image of an album's watermark, e.g. a logo
+// as PNG with transparency, replacing any previous one.
+// Route: PUT /admin/albums/{id}/watermark/image
+func (ah *AlbumHandler) UploadAlbumWatermarkImage(w http.ResponseWriter, r *http.Request) {
+	album, ok := ah.albumForWatermark(w, r)
+	if !ok {
+		return
+	}
+
+	const maxUploadSize = 10 << 20 // 10 MB
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid form data: " + err.Error()})
+		return
+	}
+	file, _, err := r.FormFile("watermark_image")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "No file uploaded in 'watermark_image' field"})
+		} else {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Could not retrieve uploaded file"})
+		}
+		return
+	}
+	defer file.Close()
+
+	if ah.MediaProcessor == nil {
+		log.Printf("CRITICAL ERROR: MediaProcessor not configured in AlbumHandler for watermark upload.")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Server configuration error"})
+		return
+	}
+	savedRelPath, err := ah.MediaProcessor.ProcessWatermark(file)
+	if err != nil {
+		log.Printf("Error processing watermark for album %d/%s: %v", album.ID, album.Slug, err)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to process watermark image"})
+		return
+	}
+
+	if err := ah.AlbumRepo.UpdateWatermark(album.ID, album.WatermarkText, &savedRelPath, album.WatermarkPosition, album.WatermarkOpacity); err != nil {
+		ah.deleteWatermarkImage(&savedRelPath)
+		log.Printf("Error saving watermark image for album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save watermark information"})
+		return
+	}
+	ah.deleteWatermarkImage(album.WatermarkImagePath)
+	ah.writeUpdatedWatermark(w, album.ID)
+}
+
+// DeleteAlbumWatermark removes the watermark text and overlay image of an album, so share
+// link visitors get the original files again.
+// Route: DELETE /admin/albums/{id}/watermark
+func (ah *AlbumHandler) DeleteAlbumWatermark(w http.ResponseWriter, r *http.Request) {
+	album, ok := ah.albumForWatermark(w, r)
+	if !ok {
+		return
+	}
+	if err := ah.AlbumRepo.UpdateWatermark(album.ID, nil, nil, album.WatermarkPosition, album.WatermarkOpacity); err != nil {
+		log.Printf("Error removing watermark of album %d: %v", album.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to remove watermark"})
+		return
+	}
+	ah.deleteWatermarkImage(album.WatermarkImagePath)
+	ah.writeUpdatedWatermark(w, album.ID)
+}
+
+func (ah *AlbumHandler) deleteWatermarkImage(relativePath *string) {
+	if relativePath == nil || *relativePath == "" || ah.MediaStore == nil {
+		return
+	}
+	if err := ah.MediaStore.Delete(*relativePath); err != nil {
+		log.Printf("Warning: Failed to remove watermark image %s: %v", *relativePath, err)
+	}
+}
+
+// albumWatermark loads the watermark of an album, nil if it has none
+func (ah *AlbumHandler) albumWatermark(album *models.Album) (*media.Watermark, error) {
+	if !album.HasWatermark() {
+		return nil, nil
+	}
+	wm := &media.Watermark{Position: album.WatermarkPosition, Opacity: album.WatermarkOpacity}
+	if album.WatermarkText != nil {
+		wm.Text = *album.WatermarkText
+	}
+	if album.WatermarkImagePath != nil && *album.WatermarkImagePath != "" {
+		if ah.MediaProcessor == nil {
+			return nil, fmt.Errorf("media processor not configured")
+		}
+		overlay, err := ah.MediaProcessor.LoadWatermark(*album.WatermarkImagePath)
+		if err != nil {
+			return nil, err
+		}
+		wm.Overlay = overlay
+	}
+	return wm, nil
+}
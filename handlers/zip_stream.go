@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamIdleTimeout is how long a streamed download may wait on a slow client for a write.
+// the server's WriteTimeout covers the whole response, which a large archive outlasts, so
+// streams push the deadline forward as they make progress instead.
+const streamIdleTimeout = time.Minute
+
+// streamRetryAfter is the Retry-After, in seconds, of downloads refused by a StreamLimiter
+const streamRetryAfter = "30"
+
+// deadlineWriter writes to a response, pushing its write deadline streamIdleTimeout ahead
+// as data is written
+type deadlineWriter struct {
+	w          io.Writer
+	controller *http.ResponseController
+	extended   time.Time
+}
+
+// newDeadlineWriter wraps a response for a long download
+func newDeadlineWriter(w http.ResponseWriter) *deadlineWriter {
+	return &deadlineWriter{w: w, controller: http.NewResponseController(w)}
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	// setting the deadline on every small write would be wasted effort
+	if now := time.Now(); now.Sub(d.extended) >= time.Second {
+		if err := d.controller.SetWriteDeadline(now.Add(streamIdleTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return 0, err
+		}
+		d.extended = now
+	}
+	return d.w.Write(p)
+}
+
+// StreamLimiter bounds how many archives are streamed at once, as each keeps files open and,
+// for web copies, images decoded for as long as the download takes
+type StreamLimiter struct {
+	slots chan struct{}
+}
+
+// NewStreamLimiter creates a StreamLimiter for max streams, or nil, which never refuses a
+// stream, when max is 0
+func NewStreamLimiter(max int) *StreamLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &StreamLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire takes a slot for a stream without waiting, and reports whether there was one. a
+// taken slot must be given back with release.
+func (l *StreamLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *StreamLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// streamsBusy answers a download refused by a StreamLimiter
+func streamsBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", streamRetryAfter)
+	http.Error(w, "Too many downloads in progress, please try again shortly.", http.StatusServiceUnavailable)
+}
@@ -1,21 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/camden-git/mediasysbackend/media"
 
 	"github.com/camden-git/mediasysbackend/config"
 	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/email"
 	"github.com/camden-git/mediasysbackend/handlers"
 	"github.com/camden-git/mediasysbackend/realtime"
 	"github.com/camden-git/mediasysbackend/repository"
 	"github.com/camden-git/mediasysbackend/services"
+	"github.com/camden-git/mediasysbackend/webhooks"
 	"github.com/camden-git/mediasysbackend/workers"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,7 +29,8 @@ import (
 	"github.com/rs/cors"
 )
 
-func main() {
+// serve runs the server until it receives SIGINT or SIGTERM
+func serve() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Printf("Info: No .env file found or error loading: %v", err)
@@ -33,7 +40,7 @@ func main() {
 		log.Fatalf("FATAL: Failed to load configuration: %v", err)
 	}
 
-	storagePaths := []string{cfg.ThumbnailsPath, cfg.BannersPath, cfg.ArchivesPath, filepath.Dir(cfg.DatabasePath)}
+	storagePaths := []string{cfg.ThumbnailsPath, cfg.BannersPath, cfg.ArchivesPath, cfg.VideosPath, cfg.AvatarsPath, cfg.ResizedPath, cfg.WatermarksPath, cfg.StreamsPath, filepath.Dir(cfg.DatabasePath)}
 	for _, p := range storagePaths {
 		log.Printf("Ensuring storage directory exists: %s", p)
 		if err := os.MkdirAll(p, 0755); err != nil {
@@ -57,59 +64,207 @@ func main() {
 	}
 	log.Println("GORM AutoMigrate completed.")
 
-	mediaSubDirs := map[media.AssetType]string{
-		media.AssetTypeThumbnail: filepath.Base(cfg.ThumbnailsPath),
-		media.AssetTypeBanner:    filepath.Base(cfg.BannersPath),
-		media.AssetTypeArchive:   filepath.Base(cfg.ArchivesPath),
+	searchFTS := true
+	if err := database.EnsureSearchIndex(gormDB); err != nil {
+		if !errors.Is(err, database.ErrFTS5Unavailable) {
+			log.Fatalf("FATAL: Failed to set up search index: %v", err)
+		}
+		log.Println("WARNING: SQLite was built without FTS5 (build with -tags sqlite_fts5), search falls back to substring matching.")
+		searchFTS = false
 	}
-	mediaStore, err := media.NewLocalStorage(cfg.MediaStoragePath, mediaSubDirs)
+
+	mediaStore, err := media.NewStoreFromConfig(cfg)
 	if err != nil {
 		log.Fatalf("FATAL: Failed to initialize media store: %v", err)
 	}
 	mediaProcessor := media.NewProcessor(mediaStore)
 
-	// Realtime hub for websocket updates
-	hub := realtime.NewHub()
+	albumRepo := repository.NewAlbumRepository(gormDB)
+
+	// Realtime hub for websocket updates, delivered to the clients that may view their album
+	hub := realtime.NewHub(handlers.NewRealtimeAccess(albumRepo))
 	go hub.Run()
 
 	log.Printf("Initializing image processor worker pool (Workers: %d, Queue Size: %d)...", cfg.NumThumbnailWorkers, cfg.ThumbnailQueueSize)
 
-	albumRepo := repository.NewAlbumRepository(gormDB)
+	smartAlbumRepo := repository.NewSmartAlbumRepository(gormDB)
+	tagRepo := repository.NewTagRepository(gormDB)
+	machineTagRepo := repository.NewMachineTagRepository(gormDB)
+	imageRatingRepo := repository.NewImageRatingRepository(gormDB)
+	activityRepo := repository.NewActivityRepository(gormDB)
+	webhookRepo := repository.NewWebhookRepository(gormDB)
+	notificationRepo := repository.NewNotificationRepository(gormDB)
+	loginFailureRepo := repository.NewLoginFailureRepository(gormDB)
+	searchRepo := repository.NewSearchRepository(gormDB, searchFTS)
 	personRepo := repository.NewPersonRepository(gormDB)
 	faceRepo := repository.NewFaceRepository(gormDB)
 	faceEmbeddingRepo := repository.NewFaceEmbeddingRepository(gormDB)
+	faceSuggestionRepo := repository.NewFaceSuggestionRepository(gormDB)
+	// build the face similarity index up front rather than on the first search
+	go func() {
+		if err := faceEmbeddingRepo.SyncIndex(); err != nil {
+			log.Printf("Warning: Failed to build face similarity index: %v", err)
+		}
+	}()
+	imageEmbeddingRepo := repository.NewImageEmbeddingRepository(gormDB)
 	imageRepo := repository.NewImageRepository(gormDB)
 	userRepo := repository.NewGormUserRepository(gormDB)
 	roleRepo := repository.NewGormRoleRepository(gormDB)
 	inviteCodeRepo := repository.NewGormInviteCodeRepository(gormDB)
+	shareLinkRepo := repository.NewGormShareLinkRepository(gormDB)
+	apiTokenRepo := repository.NewGormApiTokenRepository(gormDB)
+	settingRepo := repository.NewGormSettingRepository(gormDB)
+	statsRepo := repository.NewStatsRepository(gormDB)
+	syncRepo := repository.NewSyncRepository(gormDB)
 
 	// Initialize face recognition service
 	faceRecognitionService := services.NewFaceRecognitionService(
 		faceRepo,
 		personRepo,
 		faceEmbeddingRepo,
+		faceSuggestionRepo,
 		float32(cfg.FaceRecognitionThreshold),
 	)
 
+	geocoder, err := media.NewGeocoderFromConfig(cfg)
+	if err != nil {
+		log.Printf("Warning: Reverse geocoding disabled: %v", err)
+	} else if geocoder != nil {
+		log.Printf("Reverse geocoding enabled (%s)", cfg.GeocodingProvider)
+	}
+
+	webhookDispatcher := webhooks.NewDispatcher(webhookRepo, cfg)
+	webhookDispatcher.Start()
+
+	mailer, err := email.NewMailer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize email: %v", err)
+	}
+	if mailer.Enabled() {
+		log.Printf("Sending email through %s:%d as %s", cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPFrom)
+	}
+	notifier := email.NewNotifier(mailer, notificationRepo, cfg.PublicURL)
+
 	imageProcessor := workers.NewImageProcessor(
 		cfg,
 		imageRepo,
 		albumRepo,
 		faceRepo,
+		imageEmbeddingRepo,
+		faceEmbeddingRepo,
+		machineTagRepo,
+		geocoder,
+		activityRepo,
 		cfg.ThumbnailQueueSize,
 		cfg.NumThumbnailWorkers,
 		hub,
+		webhookDispatcher,
+		notifier,
 	)
+	imageProcessor.SetFileInfoRenderer(handlers.RealtimeFileInfo(cfg))
+	imageProcessor.SetImageChangedListener(handlers.InvalidateListings)
+	if err := imageProcessor.RefreshArchivedFolders(); err != nil {
+		log.Printf("Warning: Failed to load archived albums, their files may be reprocessed: %v", err)
+	}
+	if restored, err := imageProcessor.RestoreQueue(cfg.QueueStatePath); err != nil {
+		log.Printf("Warning: Failed to restore queued jobs from %s: %v", cfg.QueueStatePath, err)
+	} else if restored > 0 {
+		log.Printf("Restored %d queued job(s) left over from the last shutdown", restored)
+	}
+
+	// runtime settings override the config and are applied without a restart
+	settingsService, err := services.NewSettingsService(settingRepo, cfg)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load runtime settings: %v", err)
+	}
+	settingsService.OnChange(services.SettingThumbnailMaxSize, func(value interface{}) {
+		imageProcessor.SetThumbnailMaxSize(value.(int))
+	})
+	settingsService.OnChange(services.SettingWorkerCount, func(value interface{}) {
+		imageProcessor.SetWorkerCount(value.(int))
+	})
+	settingsService.OnChange(services.SettingFaceDetectionConfidence, func(value interface{}) {
+		imageProcessor.SetDetectionConfidence(float32(value.(float64)))
+	})
+	settingsService.OnChange(services.SettingFaceDetectionIoU, func(value interface{}) {
+		imageProcessor.SetDetectionIoUThreshold(float32(value.(float64)))
+	})
+	settingsService.OnChange(services.SettingNSFWThreshold, func(value interface{}) {
+		imageProcessor.SetNSFWThreshold(float32(value.(float64)))
+	})
+	settingsService.OnChange(services.SettingFaceSimilarityThreshold, func(value interface{}) {
+		faceRecognitionService.SetSimilarityThreshold(float32(value.(float64)))
+	})
+
+	// periodic maintenance; intervals are runtime settings so they can be changed without a restart
+	scheduler := workers.NewScheduler()
+	scheduler.Register(workers.MaintenanceLibraryRescan, "Walks the whole library and queues missing or stale processing tasks.", imageProcessor.RescanLibrary)
+	scheduler.Register(workers.MaintenanceOrphanCleanup, "Removes records, faces and generated assets of files deleted from disk.", imageProcessor.CleanupOrphans)
+	scheduler.Register(workers.MaintenanceZipRefresh, "Regenerates album archives whose folder changed since they were built.", imageProcessor.RefreshAlbumZips)
+	scheduler.Register(workers.MaintenanceEmbeddingBackfill, "Embeds faces that have no recognition embedding from the current model, and images for semantic search.", imageProcessor.BackfillEmbeddings)
+	scheduler.Register(workers.MaintenanceIntegrityCheck, "Hashes every original to detect bit-rot, moved files and records without a file.", imageProcessor.VerifyIntegrity)
+	scheduler.Register(workers.MaintenanceGeocodeBackfill, "Resolves the GPS positions of images without a place name, when reverse geocoding is enabled.", imageProcessor.BackfillLocations)
+	scheduler.Register(workers.MaintenanceFaceClustering, "Groups untagged faces with recognition embeddings into clusters of likely the same person.", faceRecognitionService.ClusterUntaggedFaces)
+	scheduler.Register(workers.MaintenanceFaceSuggestions, "Suggests a person for untagged faces from similar tagged faces, for review.", faceRecognitionService.RefreshFaceSuggestions)
+	scheduler.Register(workers.MaintenanceClassificationBackfill, "Classifies images without up to date machine tags, when classification is enabled.", imageProcessor.BackfillClassifications)
+	scheduler.Register(workers.MaintenanceOCRBackfill, "Reads the visible text of images not yet read, when OCR is enabled.", imageProcessor.BackfillOCR)
+	scheduler.Register(workers.MaintenanceNSFWBackfill, "Scores images not yet checked for NSFW content, when NSFW detection is enabled.", imageProcessor.BackfillNSFW)
+	scheduler.Register(workers.MaintenanceFaceEmbedding, "Extracts recognition embeddings for faces, tagged or not, that have none from the current model.", imageProcessor.ReembedFaces)
+	for taskName, settingKey := range services.ScheduleSettingKeys {
+		settingsService.OnChange(settingKey, func(value interface{}) {
+			scheduler.SetInterval(taskName, time.Duration(value.(int))*time.Minute)
+		})
+	}
+	// maintenance mode holds background processing so the database and storage stay still
+	settingsService.OnChange(services.SettingServiceMode, func(value interface{}) {
+		maintenance := value.(string) == config.ServiceModeMaintenance
+		imageProcessor.SetPaused(maintenance)
+		scheduler.SetPaused(maintenance)
+		log.Printf("Service mode: %s", value)
+	})
+	scheduler.Start()
+
+	backupService := services.NewBackupService(gormDB, settingsService, imageProcessor, scheduler, cfg)
+
+	// live dashboard stats for the websocket clients subscribed to the stats topic
+	statsService := services.NewStatsService(statsRepo, imageProcessor, hub, cfg)
+	if cfg.StatsStreamSeconds > 0 {
+		statsService.Start(time.Duration(cfg.StatsStreamSeconds) * time.Second)
+	}
 
 	log.Printf("Serving files from root: %s", cfg.RootDirectory)
+	for _, lib := range cfg.ExtraLibraries() {
+		log.Printf("Serving library '%s' from: %s", lib.ID, lib.Path)
+	}
 	log.Printf("Using database: %s", cfg.DatabasePath)
-	log.Printf("Storing thumbnails in: %s", cfg.ThumbnailsPath)
-	log.Printf("Thumbnail max size (longest side): %dpx", cfg.ThumbnailMaxSize)
+	if cfg.StorageBackend == config.StorageBackendS3 {
+		log.Printf("Storing generated assets in bucket: %s (prefix: '%s')", cfg.S3Bucket, cfg.S3Prefix)
+	} else {
+		log.Printf("Storing thumbnails in: %s", cfg.ThumbnailsPath)
+	}
+	log.Printf("Thumbnail max size (longest side): %dpx", imageProcessor.ThumbnailMaxSize())
+
+	var loginLimiter, registerLimiter, uploadLimiter, faceSearchLimiter *handlers.RateLimiter
+	if cfg.RateLimitEnabled {
+		loginLimiter = handlers.NewRateLimiter(cfg.RateLimitLoginPerMinute, cfg.RateLimitLoginBurst)
+		registerLimiter = handlers.NewRateLimiter(cfg.RateLimitRegisterPerMinute, cfg.RateLimitRegisterBurst)
+		uploadLimiter = handlers.NewRateLimiter(cfg.RateLimitUploadPerMinute, cfg.RateLimitUploadBurst)
+		faceSearchLimiter = handlers.NewRateLimiter(cfg.RateLimitFaceSearchPerMinute, cfg.RateLimitFaceSearchBurst)
+		log.Printf("Rate limits (per minute): login %d, register %d, upload %d, face search %d", cfg.RateLimitLoginPerMinute, cfg.RateLimitRegisterPerMinute, cfg.RateLimitUploadPerMinute, cfg.RateLimitFaceSearchPerMinute)
+	}
 
 	r := chi.NewRouter()
 
 	corsOptions := cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+		// origins are read from the runtime settings on every request so changes apply immediately
+		AllowOriginFunc: func(origin string) bool {
+			for _, allowed := range settingsService.StringList(services.SettingCORSAllowedOrigins) {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Content-Length"},
 		ExposedHeaders:   []string{"Link"},
@@ -125,10 +280,53 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(corsHandler.Handler)
+	r.Use(handlers.CompressMiddleware(cfg))
+	serviceMode := func() string {
+		// the database is replaced while a restore runs, so nothing may change it
+		if backupService.Restoring() {
+			return config.ServiceModeMaintenance
+		}
+		return settingsService.String(services.SettingServiceMode)
+	}
+	r.Use(func(next http.Handler) http.Handler {
+		return handlers.ServiceModeMiddleware(serviceMode, next)
+	})
 
-	albumHandler := &handlers.AlbumHandler{AlbumRepo: albumRepo, ImageRepo: imageRepo, UserRepo: userRepo, Cfg: cfg, ThumbGen: imageProcessor, MediaProcessor: mediaProcessor}
-	personHandler := &handlers.PersonHandler{PersonRepo: personRepo}
-	faceHandler := &handlers.FaceHandler{FaceRepo: faceRepo, PersonRepo: personRepo, Cfg: cfg, FaceRecognitionService: faceRecognitionService}
+	albumHandler := &handlers.AlbumHandler{AlbumRepo: albumRepo, ImageRepo: imageRepo, UserRepo: userRepo, Cfg: cfg, ThumbGen: imageProcessor, MediaProcessor: mediaProcessor, MediaStore: mediaStore, SmartAlbumRepo: smartAlbumRepo, RatingRepo: imageRatingRepo, NotificationRepo: notificationRepo, StatsRepo: statsRepo, ZipStreams: handlers.NewStreamLimiter(cfg.ZipStreamMaxConcurrent)}
+	personHandler := &handlers.PersonHandler{PersonRepo: personRepo, FaceRepo: faceRepo, ImageRepo: imageRepo, AlbumRepo: albumRepo, MediaProcessor: mediaProcessor, Cfg: cfg, FaceRecognitionService: faceRecognitionService}
+	var clipTextEncoder *media.CLIPTextEncoder
+	if cfg.CLIPEnabled {
+		clipTextEncoder = media.NewCLIPTextEncoder(cfg.CLIPTextModelPath, cfg.CLIPVocabPath)
+		defer clipTextEncoder.Close()
+		if !clipTextEncoder.Enabled {
+			log.Println("WARNING: CLIP text encoder failed to load, semantic search is unavailable.")
+		}
+	}
+	searchHandler := handlers.NewSearchHandler(searchRepo, imageRepo, albumRepo, personRepo, imageEmbeddingRepo, clipTextEncoder, cfg)
+	mapHandler := handlers.NewMapHandler(imageRepo, albumRepo, cfg)
+	timelineHandler := handlers.NewTimelineHandler(imageRepo, albumRepo, cfg)
+	resizeHandler := handlers.NewResizeHandler(cfg, imageRepo, albumRepo)
+	tagHandler := handlers.NewTagHandler(tagRepo, machineTagRepo)
+	ratingHandler := handlers.NewRatingHandler(imageRatingRepo, imageRepo, cfg)
+	imageMetadataHandler := handlers.NewImageMetadataHandler(imageRepo, albumRepo, cfg)
+	mePhotosHandler := handlers.NewMePhotosHandler(imageRepo, albumRepo, imageRatingRepo, cfg)
+	syncHandler := handlers.NewSyncHandler(syncRepo, imageRepo, albumRepo, cfg)
+	activityHandler := handlers.NewActivityHandler(activityRepo, albumRepo)
+	streamHandler := handlers.NewStreamHandler(imageRepo, mediaStore, cfg)
+	var faceEmbedder *media.FaceEmbedder
+	if cfg.FaceRecognitionEnabled {
+		faceEmbedder = media.NewFaceEmbedder(cfg.RetinaFaceModelPath, cfg.FaceRecognitionModelPath, cfg.FaceRecognitionModelName)
+		defer faceEmbedder.Close()
+		if !faceEmbedder.Enabled {
+			log.Println("WARNING: Face models failed to load, search by example photo is unavailable.")
+		}
+		applyDetectionThresholds := func(interface{}) {
+			faceEmbedder.SetDetectionThresholds(imageProcessor.DetectionThresholds())
+		}
+		settingsService.OnChange(services.SettingFaceDetectionConfidence, applyDetectionThresholds)
+		settingsService.OnChange(services.SettingFaceDetectionIoU, applyDetectionThresholds)
+	}
+	faceHandler := &handlers.FaceHandler{FaceRepo: faceRepo, PersonRepo: personRepo, SuggestionRepo: faceSuggestionRepo, Cfg: cfg, FaceRecognitionService: faceRecognitionService, AlbumRepo: albumRepo, ActivityRepo: activityRepo, Webhooks: webhookDispatcher, Embedder: faceEmbedder}
 	imagePreviewHandler := &handlers.ImagePreviewHandler{FaceRepo: faceRepo, Cfg: cfg}
 
 	debugHandler := &handlers.DebugHandler{
@@ -136,12 +334,37 @@ func main() {
 		ImageRepo:      imageRepo,
 		ImageProcessor: imageProcessor,
 	}
-	authHandler := handlers.NewAuthHandler(userRepo, inviteCodeRepo, cfg)
+	emailVerificationHandler := handlers.NewEmailVerificationHandler(userRepo, notificationRepo, notifier, cfg)
+	loginGuard := handlers.NewLoginGuard(loginFailureRepo, cfg)
+	uploadQuota := handlers.NewUploadQuota(imageRepo, cfg)
+	authHandler := handlers.NewAuthHandler(userRepo, inviteCodeRepo, cfg, webhookDispatcher, emailVerificationHandler, loginGuard, uploadQuota)
+	passwordResetHandler := handlers.NewPasswordResetHandler(userRepo, notificationRepo, notifier, cfg)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo)
+	apiTokenHandler := handlers.NewApiTokenHandler(apiTokenRepo)
 	permissionsHandler := handlers.NewPermissionsHandler()
-	adminUserHandler := handlers.NewAdminUserHandler(userRepo, roleRepo)
+	adminUserHandler := handlers.NewAdminUserHandler(userRepo, roleRepo, personRepo)
+	avatarHandler := handlers.NewAvatarHandler(userRepo, mediaProcessor)
 	adminRoleHandler := handlers.NewAdminRoleHandler(roleRepo)
-	adminInviteCodeHandler := handlers.NewAdminInviteCodeHandler(inviteCodeRepo)
-	adminAlbumHandler := handlers.NewAdminAlbumHandler(albumRepo, imageRepo, userRepo, roleRepo, cfg, imageProcessor, hub)
+	adminInviteCodeHandler := handlers.NewAdminInviteCodeHandler(inviteCodeRepo, userRepo, notifier)
+	adminShareLinkHandler := handlers.NewAdminShareLinkHandler(shareLinkRepo, albumRepo)
+	adminJobHandler := handlers.NewAdminJobHandler(imageProcessor)
+	adminSettingsHandler := handlers.NewAdminSettingsHandler(settingsService)
+	adminScheduleHandler := handlers.NewAdminScheduleHandler(scheduler, settingsService)
+	adminIntegrityHandler := handlers.NewAdminIntegrityHandler(imageProcessor, scheduler)
+	adminFaceEmbeddingHandler := handlers.NewAdminFaceEmbeddingHandler(imageProcessor, scheduler)
+	adminNSFWHandler := handlers.NewAdminNSFWHandler(imageRepo, cfg)
+	adminFaceDiagnosticsHandler := handlers.NewAdminFaceDiagnosticsHandler(faceRepo, faceEmbeddingRepo, faceRecognitionService)
+	adminStatsHandler := handlers.NewAdminStatsHandler(statsService)
+	adminAlbumExportHandler := handlers.NewAdminAlbumExportHandler(albumRepo, imageRepo, faceRepo, personRepo, tagRepo, machineTagRepo, cfg)
+	adminBackupHandler := handlers.NewAdminBackupHandler(backupService)
+	adminImportHandler := handlers.NewAdminImportHandler(workers.NewImporter(imageProcessor, personRepo), cfg)
+	shareLinkHandler := handlers.NewShareLinkHandler(shareLinkRepo, albumHandler, loginGuard)
+	adminAlbumHandler := handlers.NewAdminAlbumHandler(albumRepo, imageRepo, userRepo, roleRepo, activityRepo, cfg, imageProcessor, hub, uploadQuota)
+	adminUploadUsageHandler := handlers.NewAdminUploadUsageHandler(userRepo, uploadQuota)
+	adminSmartAlbumHandler := handlers.NewAdminSmartAlbumHandler(smartAlbumRepo, albumRepo, cfg)
+	adminTagHandler := handlers.NewAdminTagHandler(tagRepo)
+	adminWebhookHandler := handlers.NewAdminWebhookHandler(webhookRepo, webhookDispatcher)
+	adminLoginLockoutHandler := handlers.NewAdminLoginLockoutHandler(loginGuard)
 	adminAlbumUserHandler := handlers.NewAdminAlbumUserHandler(userRepo, albumRepo)
 	setupHandler := handlers.NewSetupHandler(gormDB, userRepo, roleRepo) // Initialize SetupHandler
 
@@ -150,19 +373,56 @@ func main() {
 	}
 
 	r.Route("/api", func(r chi.Router) {
+		r.Get("/status", handlers.ServiceStatus(serviceMode))
 		r.Post("/setup/initial-admin", setupHandler.CreateFirstAdmin)
 
 		// authentication routes
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/login", authHandler.Login)
-			r.Post("/register", authHandler.Register)
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RateLimitMiddleware(loginLimiter, next)
+			}).Post("/login", authHandler.Login)
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RateLimitMiddleware(registerLimiter, next)
+			}).Post("/register", authHandler.Register)
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RateLimitMiddleware(registerLimiter, next)
+			}).Get("/invites/{code}", authHandler.GetInvite)
 			r.Post("/logout", authHandler.Logout)
+			r.Group(func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.RateLimitMiddleware(loginLimiter, next)
+				})
+				r.Post("/password-reset", passwordResetHandler.RequestReset)
+				r.Post("/password-reset/confirm", passwordResetHandler.ConfirmReset)
+				r.Post("/verify-email", emailVerificationHandler.ConfirmEmail)
+			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(func(next http.Handler) http.Handler {
-					return handlers.AuthMiddleware(userRepo, next)
+					return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
 				})
 				r.Get("/me", authHandler.CurrentUser)
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RateLimitMiddleware(loginLimiter, next)
+				}).Put("/me", authHandler.UpdateCurrentUser)
+				r.Get("/me/notifications", notificationHandler.GetPreferences)
+				r.Put("/me/notifications", notificationHandler.UpdatePreferences)
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RateLimitMiddleware(loginLimiter, next)
+				}).Post("/me/verify-email", emailVerificationHandler.ResendVerification)
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RateLimitMiddleware(uploadLimiter, next)
+				}).Put("/me/avatar", avatarHandler.UploadAvatar)
+				r.Delete("/me/avatar", avatarHandler.DeleteAvatar)
+
+				// personal API tokens
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", apiTokenHandler.ListTokens)
+					r.Post("/", apiTokenHandler.CreateToken)
+					r.Get("/{id}", apiTokenHandler.GetToken)
+					r.Put("/{id}", apiTokenHandler.UpdateToken)
+					r.Delete("/{id}", apiTokenHandler.DeleteToken)
+				})
 			})
 		})
 
@@ -175,7 +435,7 @@ func main() {
 		// admin routes for User and Role management
 		r.Route("/admin", func(r chi.Router) {
 			r.Use(func(next http.Handler) http.Handler {
-				return handlers.AuthMiddleware(userRepo, next) // All admin routes require authentication
+				return handlers.AuthMiddleware(userRepo, apiTokenRepo, next) // All admin routes require authentication
 			})
 
 			// user management Routes
@@ -200,9 +460,34 @@ func main() {
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("user.delete", next)
 					}).Delete("/", adminUserHandler.DeleteUser)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("user.edit", next)
+					}).Delete("/avatar", avatarHandler.AdminDeleteAvatar)
 				})
 			})
 
+			// upload usage and quotas per user
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RequireGlobalPermission("user.list", next)
+			}).Get("/upload-usage", adminUploadUsageHandler.ListUsage)
+
+			// configured root libraries, for picking where a new album lives
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RequireAnyGlobalPermission([]string{"album.list", "album.create"}, next)
+			}).Get("/libraries", handlers.ListLibraries(cfg))
+
+			// failed login counters and lockouts
+			r.Route("/login-lockouts", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("user.list", next)
+				}).Get("/", adminLoginLockoutHandler.ListLockouts)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("user.edit", next)
+				}).Delete("/{kind}/{subject}", adminLoginLockoutHandler.Unlock)
+			})
+
 			// role management Routes
 			r.Route("/roles", func(r chi.Router) {
 				r.With(func(next http.Handler) http.Handler {
@@ -265,6 +550,241 @@ func main() {
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("invite.delete", next)
 					}).Delete("/", adminInviteCodeHandler.DeleteInviteCode)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("invite.create", next)
+					}).Post("/send", adminInviteCodeHandler.SendInviteCode)
+				})
+			})
+
+			// runtime settings routes
+			r.Route("/settings", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.settings.view", next)
+				}).Get("/", adminSettingsHandler.ListSettings)
+
+				r.Route("/{key}", func(r chi.Router) {
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("system.settings.view", next)
+					}).Get("/", adminSettingsHandler.GetSetting)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("system.settings.edit", next)
+					}).Put("/", adminSettingsHandler.UpdateSetting)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("system.settings.edit", next)
+					}).Delete("/", adminSettingsHandler.ResetSetting)
+				})
+			})
+
+			// maintenance schedule routes
+			r.Route("/schedules", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.settings.view", next)
+				}).Get("/", adminScheduleHandler.ListSchedules)
+
+				r.Route("/{name}", func(r chi.Router) {
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("system.settings.view", next)
+					}).Get("/", adminScheduleHandler.GetSchedule)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("system.settings.edit", next)
+					}).Put("/", adminScheduleHandler.UpdateSchedule)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("job.manage", next)
+					}).Post("/run", adminScheduleHandler.RunSchedule)
+				})
+			})
+
+			// library integrity routes
+			r.Route("/integrity", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.list", next)
+				}).Get("/", adminIntegrityHandler.GetIntegrityReport)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.manage", next)
+				}).Post("/verify", adminIntegrityHandler.StartIntegrityCheck)
+			})
+
+			// face embedding reprocessing routes
+			r.Route("/faces/embeddings", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.list", next)
+				}).Get("/", adminFaceEmbeddingHandler.GetFaceEmbeddingProgress)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.manage", next)
+				}).Post("/reprocess", adminFaceEmbeddingHandler.StartFaceEmbedding)
+			})
+
+			// NSFW review queue routes
+			r.Route("/nsfw", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("nsfw.review", next)
+				})
+				r.Get("/", adminNSFWHandler.ListNSFWImages)
+				r.Post("/confirm", adminNSFWHandler.ConfirmNSFW)
+				r.Post("/clear", adminNSFWHandler.ClearNSFW)
+			})
+
+			// dashboard statistics, also streamed on the stats topic of /ws
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.RequireGlobalPermission("system.stats.view", next)
+			}).Get("/stats", adminStatsHandler.GetStats)
+
+			// backups of the database and runtime settings
+			r.Route("/backups", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.backup", next)
+				}).Get("/", adminBackupHandler.ListBackups)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.backup", next)
+				}).Post("/", adminBackupHandler.CreateBackup)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.restore", next)
+				}).Post("/upload", adminBackupHandler.UploadBackup)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.backup", next)
+				}).Get("/{name}", adminBackupHandler.DownloadBackup)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.backup", next)
+				}).Delete("/{name}", adminBackupHandler.DeleteBackup)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.restore", next)
+				}).Post("/{name}/restore", adminBackupHandler.RestoreBackup)
+			})
+
+			// imports of Google Takeout exports and folders with JSON sidecars
+			r.Route("/imports", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.import", next)
+				})
+				r.Get("/", adminImportHandler.GetImport)
+				r.Post("/", adminImportHandler.StartImport)
+			})
+
+			// face recognition diagnostics
+			r.Route("/diagnostics/faces", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("system.diagnostics", next)
+				})
+				r.Get("/compare", adminFaceDiagnosticsHandler.CompareFaces)
+				r.Get("/matrix", adminFaceDiagnosticsHandler.GetImageSimilarityMatrix)
+				r.Get("/{face_id}/embedding", adminFaceDiagnosticsHandler.GetEmbeddingStats)
+			})
+
+			// background job management routes
+			r.Route("/jobs", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.list", next)
+				}).Get("/", adminJobHandler.ListJobs)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("job.manage", next)
+				}).Post("/retry-errored", adminJobHandler.RetryErroredImages)
+
+				r.Route("/{jobID}", func(r chi.Router) {
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("job.list", next)
+					}).Get("/", adminJobHandler.GetJob)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("job.manage", next)
+					}).Post("/cancel", adminJobHandler.CancelJob)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("job.manage", next)
+					}).Post("/retry", adminJobHandler.RetryJob)
+				})
+			})
+
+			// share link management routes
+			r.Route("/share-links/{id}", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("share.list", next)
+				}).Get("/", adminShareLinkHandler.GetShareLink)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("share.edit", next)
+				}).Put("/", adminShareLinkHandler.UpdateShareLink)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("share.delete", next)
+				}).Delete("/", adminShareLinkHandler.DeleteShareLink)
+			})
+
+			// smart album management routes
+			r.Route("/smart-albums", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireAnyGlobalPermission([]string{"album.list", "album.view", "album.create", "album.edit.general", "album.delete"}, next)
+				}).Get("/", adminSmartAlbumHandler.ListSmartAlbums)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("album.create", next)
+				}).Post("/", adminSmartAlbumHandler.CreateSmartAlbum)
+
+				r.Route("/{id}", func(r chi.Router) {
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.list", next)
+					}).Get("/", adminSmartAlbumHandler.GetSmartAlbum)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}).Put("/", adminSmartAlbumHandler.UpdateSmartAlbum)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.delete", next)
+					}).Delete("/", adminSmartAlbumHandler.DeleteSmartAlbum)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.list", next)
+					}).Get("/contents", adminSmartAlbumHandler.GetSmartAlbumContents)
+				})
+			})
+
+			// webhook routes
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("webhook.manage", next)
+				})
+				r.Get("/", adminWebhookHandler.ListWebhooks)
+				r.Post("/", adminWebhookHandler.CreateWebhook)
+				r.Route("/{id}", func(r chi.Router) {
+					r.Get("/", adminWebhookHandler.GetWebhook)
+					r.Put("/", adminWebhookHandler.UpdateWebhook)
+					r.Delete("/", adminWebhookHandler.DeleteWebhook)
+					r.Get("/deliveries", adminWebhookHandler.ListDeliveries)
+					r.Post("/deliveries/{delivery_id}/redeliver", adminWebhookHandler.RedeliverDelivery)
+				})
+			})
+
+			// tag management routes
+			r.Route("/tags", func(r chi.Router) {
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("tag.manage", next)
+				}).Post("/", adminTagHandler.CreateTag)
+
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("tag.assign", next)
+				}).Post("/bulk", adminTagHandler.BulkTagImages)
+
+				r.Route("/{id}", func(r chi.Router) {
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("tag.manage", next)
+					}).Put("/", adminTagHandler.RenameTag)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("tag.manage", next)
+					}).Delete("/", adminTagHandler.DeleteTag)
 				})
 			})
 
@@ -289,15 +809,37 @@ func main() {
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.delete", next)
-					}).Delete("/", adminAlbumHandler.DeleteAlbum)
+					}, adminAlbumHandler.RejectArchivedAlbum).Delete("/", adminAlbumHandler.DeleteAlbum)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RateLimitMiddleware(uploadLimiter, next)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RequireVerifiedEmail(cfg.EmailVerificationRequired, next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Put("/banner", albumHandler.UploadAlbumBanner)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Put("/watermark", albumHandler.UpdateAlbumWatermark)
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.edit.general", next)
-					}).Put("/banner", albumHandler.UploadAlbumBanner)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RateLimitMiddleware(uploadLimiter, next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Put("/watermark/image", albumHandler.UploadAlbumWatermarkImage)
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.edit.general", next)
-					}).Post("/upload", adminAlbumHandler.UploadImages)
+					}, adminAlbumHandler.RejectArchivedAlbum).Delete("/watermark", albumHandler.DeleteAlbumWatermark)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RateLimitMiddleware(uploadLimiter, next)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RequireVerifiedEmail(cfg.EmailVerificationRequired, next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Post("/upload", adminAlbumHandler.UploadImages)
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.list", next)
@@ -305,7 +847,19 @@ func main() {
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.edit.general", next)
-					}).Delete("/images", adminAlbumHandler.DeleteAlbumImage)
+					}, adminAlbumHandler.RejectArchivedAlbum).Delete("/images", adminAlbumHandler.DeleteAlbumImage)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}).Post("/images/batch", adminAlbumHandler.BatchImages)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Put("/folder", adminAlbumHandler.MoveAlbumFolder)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}, adminAlbumHandler.RejectArchivedAlbum).Put("/order", adminAlbumHandler.UpdateImageOrder)
 
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.edit.general", next)
@@ -315,10 +869,35 @@ func main() {
 						return handlers.RequireGlobalPermission("album.list", next)
 					}).Get("/zip", albumHandler.DownloadAlbumZipByID)
 
+					// PDF of the album's thumbnails and filenames, for client proofing
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.edit.general", next)
+					}).Post("/contact-sheet", albumHandler.RequestAlbumContactSheet)
+
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.list", next)
+					}).Get("/contact-sheet", albumHandler.DownloadAlbumContactSheet)
+
+					// originals plus a manifest of their metadata, faces and people, for migrations
+					r.With(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("album.list", next)
+					}).Get("/export", adminAlbumExportHandler.ExportAlbum)
+
 					r.With(func(next http.Handler) http.Handler {
 						return handlers.RequireGlobalPermission("album.list", next)
 					}).Get("/uploaders", adminAlbumHandler.GetAlbumUploaders)
 
+					// album share link routes
+					r.Route("/share-links", func(r chi.Router) {
+						r.With(func(next http.Handler) http.Handler {
+							return handlers.RequireAnyGlobalPermission([]string{"share.list", "share.create", "share.edit", "share.delete"}, next)
+						}).Get("/", adminShareLinkHandler.ListAlbumShareLinks)
+
+						r.With(func(next http.Handler) http.Handler {
+							return handlers.RequireGlobalPermission("share.create", next)
+						}).Post("/", adminShareLinkHandler.CreateShareLink)
+					})
+
 					// Album user management routes
 					r.Route("/users", func(r chi.Router) {
 						r.With(func(next http.Handler) http.Handler {
@@ -347,28 +926,147 @@ func main() {
 			})
 		})
 
+		r.Get("/smart-albums", albumHandler.ListSmartAlbums)
+		// signed in users also find the files of hidden albums they may view
+		r.With(func(next http.Handler) http.Handler {
+			return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+		}).Get("/search", searchHandler.Search)
+		r.With(func(next http.Handler) http.Handler {
+			return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+		}).Get("/search/semantic", searchHandler.SemanticSearch)
+		r.With(func(next http.Handler) http.Handler {
+			return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+		}).Get("/map/images", mapHandler.GetMapImages)
+		r.Group(func(r chi.Router) {
+			r.Use(func(next http.Handler) http.Handler {
+				return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+			})
+			r.Get("/timeline", timelineHandler.GetTimeline)
+			r.Get("/timeline/{bucket}", timelineHandler.GetTimelineBucket)
+		})
+		r.Get("/tags", tagHandler.ListTags)
+		r.Get("/images/tags", tagHandler.ListImageTags)
+		r.Get("/machine-tags", tagHandler.ListMachineTags)
+		r.Get("/images/machine-tags", tagHandler.ListImageMachineTags)
+		// feed of the albums the requester can see; signed in users also see hidden albums they may view
+		r.With(func(next http.Handler) http.Handler {
+			return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+		}).Get("/activity", activityHandler.GetActivity)
+
+		// per-user favorites and star ratings
+		r.Group(func(r chi.Router) {
+			r.Use(func(next http.Handler) http.Handler {
+				return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+			})
+			r.Get("/favorites", ratingHandler.ListFavorites)
+			// images of the person the user is linked to, see users.person_id
+			r.Get("/me/photos", mePhotosHandler.ListMyPhotos)
+			// changes to the library since a cursor, for client apps that keep a local mirror
+			r.Get("/sync/changes", syncHandler.GetChanges)
+			r.Route("/images/rating", func(r chi.Router) {
+				r.Get("/", ratingHandler.GetRating)
+				r.Put("/", ratingHandler.SetRating)
+				r.Delete("/", ratingHandler.DeleteRating)
+			})
+			// capture time, title, description and copyright, also written to the file's XMP sidecar
+			r.Put("/images/metadata", imageMetadataHandler.UpdateImageMetadata)
+		})
+
 		r.Route("/albums", func(r chi.Router) {
 			r.Get("/", albumHandler.ListAlbums)
 			r.Route("/{album_identifier}", func(r chi.Router) {
-				r.Get("/", albumHandler.GetAlbum)
-				r.Get("/contents", albumHandler.GetAlbumContents)
-				r.Get("/zip", albumHandler.DownloadAlbumZip)
+				// links using a former slug of the album keep working
+				r.Use(albumHandler.RedirectFormerSlug)
+				// anonymous access is allowed except to hidden albums, which need an album permission
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+				})
+
+				r.With(func(next http.Handler) http.Handler {
+					return albumHandler.RequireAlbumAccess("album.view.content", next)
+				}).Get("/", albumHandler.GetAlbum)
+				// signed in users also get their favorites and ratings
+				r.With(func(next http.Handler) http.Handler {
+					return albumHandler.RequireAlbumAccess("album.view.content", next)
+				}).Get("/contents", albumHandler.GetAlbumContents)
+				// counts, capture dates, cameras, people and processing progress for the album admin page
+				r.With(func(next http.Handler) http.Handler {
+					return albumHandler.RequireAlbumAccess("album.view.content", next)
+				}).Get("/stats", albumHandler.GetAlbumStats)
+				// Atom feed of the latest uploads for feed readers
+				r.With(func(next http.Handler) http.Handler {
+					return albumHandler.RequireAlbumAccess("album.view.content", next)
+				}).Get("/feed.xml", albumHandler.GetAlbumFeed)
+
+				r.Group(func(r chi.Router) {
+					r.Use(func(next http.Handler) http.Handler {
+						return albumHandler.RequireAlbumAccess("album.download", next)
+					})
+					// signed in users asking while the archive is being built are emailed when it's ready
+					r.Get("/zip", albumHandler.DownloadAlbumZip)
+					// zipped on the fly, no need to wait for the archive to be generated
+					r.Get("/zip/stream", albumHandler.StreamAlbumZip)
+					// a one-off archive of chosen files, streamed like /zip/stream
+					r.Post("/zip/custom", albumHandler.StreamCustomAlbumZip)
+				})
 			})
 		})
 
 		r.Route("/share", func(r chi.Router) {
 			r.Route("/albums", func(r chi.Router) {
-				r.Get("/{album_identifier}", albumHandler.ShareAlbumHTML)
+				r.With(albumHandler.RedirectFormerSlug).Get("/{album_identifier}", albumHandler.ShareAlbumHTML)
+			})
+		})
+
+		// unfurling and embedding of public albums and images on other sites
+		r.Get("/oembed", albumHandler.GetOEmbed)
+		r.Route("/embed/albums/{album_identifier}", func(r chi.Router) {
+			r.Use(albumHandler.RedirectFormerSlug)
+			r.Use(func(next http.Handler) http.Handler {
+				return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+			})
+			r.With(func(next http.Handler) http.Handler {
+				return albumHandler.RequireAlbumAccess("album.view.content", next)
+			}).Get("/", albumHandler.EmbedAlbumHTML)
+		})
+
+		// public album access through share links
+		r.Route("/s/{share_token}", func(r chi.Router) {
+			r.Post("/session", shareLinkHandler.CreateSession)
+
+			r.Group(func(r chi.Router) {
+				r.Use(shareLinkHandler.ShareLinkMiddleware)
+				r.Get("/", shareLinkHandler.GetSharedAlbum)
+				r.Get("/contents", shareLinkHandler.GetSharedAlbumContents)
+				// watermarked when the album has a watermark, unlike the member routes
+				r.Get("/original", shareLinkHandler.GetSharedOriginal)
+				r.Get("/zip", shareLinkHandler.DownloadSharedAlbumZip)
 			})
 		})
 
 		r.Route("/people", func(r chi.Router) {
+			// hidden people are only listed for signed in users, and the handlers require
+			// person.edit for changes to the profile of a person
+			r.Use(func(next http.Handler) http.Handler {
+				return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+			})
 			r.Post("/", personHandler.CreatePerson)
 			r.Get("/", personHandler.ListPeople)
 			r.Route("/{person_id}", func(r chi.Router) {
 				r.Get("/", personHandler.GetPerson)
 				r.Put("/", personHandler.UpdatePerson)
 				r.Delete("/", personHandler.DeletePerson)
+				// profile photo cropped from a face tagged with the person
+				r.Route("/profile-face", func(r chi.Router) {
+					r.Use(func(next http.Handler) http.Handler {
+						return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+					}, func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("person.edit", next)
+					})
+					r.Put("/", personHandler.SetProfileFace)
+					r.Delete("/", personHandler.DeleteProfileFace)
+				})
+				r.Get("/images", personHandler.ListPersonImages)
 				r.Route("/aliases", func(r chi.Router) {
 					r.Post("/", personHandler.AddAlias)
 					r.Delete("/{alias_id}", personHandler.DeleteAlias)
@@ -383,6 +1081,37 @@ func main() {
 
 		r.Route("/faces", func(r chi.Router) {
 			r.Get("/untagged", faceHandler.GetUntaggedFaces)
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+			}, func(next http.Handler) http.Handler {
+				return handlers.RequireGlobalPermission("face.tag", next)
+			}).Post("/bulk-tag", faceHandler.BulkTagFaces)
+			// groups of similar untagged faces, rebuilt by the face_clustering maintenance task
+			r.Route("/clusters", func(r chi.Router) {
+				r.Get("/", faceHandler.ListFaceClusters)
+				r.Get("/{cluster_id}", faceHandler.GetFaceCluster)
+				r.With(func(next http.Handler) http.Handler {
+					return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+				}, func(next http.Handler) http.Handler {
+					return handlers.RequireGlobalPermission("face.tag", next)
+				}).Post("/{cluster_id}/tag", faceHandler.TagFaceCluster)
+			})
+			// person suggestions waiting for review, refreshed by the face_suggestions maintenance task.
+			// decisions are recorded with the reviewer, so they need a signed in user, and tag
+			// faces like the bulk tagging routes, so they need face.tag too
+			r.Route("/suggestions", func(r chi.Router) {
+				r.Use(func(next http.Handler) http.Handler {
+					return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+				})
+				r.Get("/", faceHandler.ListFaceSuggestions)
+				r.Group(func(r chi.Router) {
+					r.Use(func(next http.Handler) http.Handler {
+						return handlers.RequireGlobalPermission("face.tag", next)
+					})
+					r.Post("/{suggestion_id}/accept", faceHandler.AcceptFaceSuggestion)
+					r.Post("/{suggestion_id}/reject", faceHandler.RejectFaceSuggestion)
+				})
+			})
 			r.Route("/{face_id}", func(r chi.Router) {
 				r.Get("/", faceHandler.GetFace)
 				r.Put("/", faceHandler.UpdateFace)
@@ -395,20 +1124,59 @@ func main() {
 
 		r.Route("/search/faces", func(r chi.Router) {
 			r.Get("/", faceHandler.SearchFacesByPerson)
+			r.With(func(next http.Handler) http.Handler {
+				return handlers.AuthMiddleware(userRepo, apiTokenRepo, next)
+			}, func(next http.Handler) http.Handler {
+				return handlers.RequireGlobalPermission("face.search", next)
+			}, func(next http.Handler) http.Handler {
+				return handlers.RateLimitMiddleware(faceSearchLimiter, next)
+			}).Post("/by-image", faceHandler.SearchFacesByImage)
 		})
 
+		// alternative formats are negotiated with the Accept header, which presigned redirects
+		// can't check for
+		assetServer := func(subDir string, opts handlers.AssetServerOptions) http.HandlerFunc {
+			if presigner, ok := mediaStore.(media.Presigner); ok {
+				return handlers.PresignedAssetServer(presigner, subDir, time.Duration(cfg.S3PresignExpirySeconds)*time.Second)
+			}
+			return handlers.AssetServerWithOptions(cfg.MediaStoragePath, subDir, opts)
+		}
+
+		// with ASSET_URL_SECRET set these only serve the signed URLs handed out by the API
+		signedAssets := func(next http.Handler) http.Handler {
+			return handlers.SignedAssetMiddleware(cfg, next)
+		}
+
 		thumbnailSubDir := filepath.Base(cfg.ThumbnailsPath)
-		r.Get(fmt.Sprintf("/%s/*", thumbnailSubDir), handlers.AssetServer(cfg.MediaStoragePath, thumbnailSubDir))
+		r.With(signedAssets).Get(fmt.Sprintf("/%s/*", thumbnailSubDir), assetServer(thumbnailSubDir, handlers.AssetServerOptions{Formats: cfg.ThumbnailFormats, Immutable: true}))
 		log.Printf("Registered thumbnail server at /%s/*", thumbnailSubDir)
 
 		bannerSubDir := filepath.Base(cfg.BannersPath)
-		r.Get(fmt.Sprintf("/%s/*", bannerSubDir), handlers.AssetServer(cfg.MediaStoragePath, bannerSubDir))
+		r.With(signedAssets).Get(fmt.Sprintf("/%s/*", bannerSubDir), assetServer(bannerSubDir, handlers.AssetServerOptions{Immutable: true}))
 		log.Printf("Registered banner server at /%s/*", bannerSubDir)
 
 		archiveSubDir := filepath.Base(cfg.ArchivesPath)
-		r.Get(fmt.Sprintf("/%s/*", archiveSubDir), handlers.AssetServer(cfg.MediaStoragePath, archiveSubDir))
+		r.With(signedAssets).Get(fmt.Sprintf("/%s/*", archiveSubDir), assetServer(archiveSubDir, handlers.AssetServerOptions{}))
 		log.Printf("Registered archive server at /%s/*", archiveSubDir)
 
+		videoSubDir := filepath.Base(cfg.VideosPath)
+		r.With(signedAssets).Get(fmt.Sprintf("/%s/*", videoSubDir), assetServer(videoSubDir, handlers.AssetServerOptions{Immutable: true}))
+		log.Printf("Registered video rendition server at /%s/*", videoSubDir)
+
+		// HLS streams of long videos by the video's path, e.g. /stream/events/party.mov/master.m3u8.
+		// the playlists list the signed URLs of their variants and segments
+		r.With(signedAssets).Get("/stream/*", streamHandler.ServeStream)
+
+		// resized copies of library images by the image's path, generated on first request and
+		// cached. the signature of their resize_url leaves out the w, h and fit params
+		r.With(signedAssets, func(next http.Handler) http.Handler {
+			return handlers.OptionalAuthMiddleware(userRepo, apiTokenRepo, next)
+		}).Get("/resize/*", resizeHandler.Resize)
+
+		avatarSubDir := filepath.Base(cfg.AvatarsPath)
+		r.Get(fmt.Sprintf("/%s/*", avatarSubDir), assetServer(avatarSubDir, handlers.AssetServerOptions{Immutable: true}))
+		log.Printf("Registered avatar server at /%s/*", avatarSubDir)
+
 		r.Route("/debug", func(r chi.Router) {
 			// GET /debug/image_with_faces?path=relative/path/to/image.jpg
 			r.Get("/image_with_faces", imagePreviewHandler.ServeImageWithFaces)
@@ -418,9 +1186,6 @@ func main() {
 
 			// GET /debug/detection_status?path=relative/path/to/image.jpg
 			r.Get("/detection_status", debugHandler.GetDetectionStatus)
-
-			// GET /debug/faces - debug face information
-			r.Get("/faces", faceHandler.DebugFaces)
 		})
 
 		r.Get("/*", handlers.DirectoryHandler(cfg, imageRepo, imageProcessor))
@@ -431,15 +1196,12 @@ func main() {
 		if token := req.URL.Query().Get("token"); token != "" {
 			req.Header.Set("Authorization", "Bearer "+token)
 		}
-		handlers.AuthMiddleware(userRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthMiddleware(userRepo, apiTokenRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			hub.ServeWS(w, r)
 		})).ServeHTTP(w, req)
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := cfg.Port
 	serverAddr := ":" + port
 	fmt.Printf("Server starting on http://localhost:%s\n", port)
 	log.Printf("Server listening on %s", serverAddr)
@@ -450,5 +1212,40 @@ func main() {
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
-	log.Fatal(server.ListenAndServe())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("FATAL: Server failed: %v", err)
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process immediately
+	log.Println("Shutdown signal received, draining in-flight requests...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: HTTP server did not shut down cleanly: %v", err)
+	}
+
+	// maintenance tasks still running notice the processor stopping and return early; wait
+	// for them so the jobs they queued are saved too
+	scheduler.Stop()
+	statsService.Stop()
+	imageProcessor.Stop()
+	webhookDispatcher.Stop() // after the workers, whose last jobs may still emit events
+	scheduler.Wait()
+	if saved, err := imageProcessor.SaveQueue(cfg.QueueStatePath); err != nil {
+		log.Printf("Error: Failed to save queued jobs: %v", err)
+	} else if saved > 0 {
+		log.Printf("Saved %d queued job(s) to %s", saved, cfg.QueueStatePath)
+	}
+	log.Println("Shutdown complete")
 }
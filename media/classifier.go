@@ -0,0 +1,246 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// classifierInputSize is the side of the square image the classifier takes
+const classifierInputSize = 224
+
+// per-channel (RGB) normalization ImageNet classifiers are trained with
+var (
+	classifierMean = [3]float32{0.485, 0.456, 0.406}
+	classifierStd  = [3]float32{0.229, 0.224, 0.225}
+)
+
+// Classification is a label an ImageClassifier gave an image
+type Classification struct {
+	Label      string
+	Confidence float32 // probability, 0 to 1
+}
+
+// ImageClassifier labels whole images with a scene or object classification model (e.g.
+// MobileNet or EfficientNet) exported to ONNX. labels holds the name of each output class;
+// classes sharing a name are combined into one label and unnamed classes are ignored.
+type ImageClassifier struct {
+	Net       gocv.Net
+	Enabled   bool
+	ModelName string
+	labels    []string
+}
+
+// NewImageClassifier loads a classification model and its labels file. the returned
+// classifier is disabled if either cannot be loaded.
+func NewImageClassifier(modelPath, labelsPath, modelName string) *ImageClassifier {
+	labels, err := LoadClassifierLabels(labelsPath)
+	if err != nil {
+		log.Printf("classifier: ERROR - %v", err)
+		return &ImageClassifier{Enabled: false}
+	}
+	net, ok := loadClassifierNet(modelPath, "classifier")
+	if !ok {
+		return &ImageClassifier{Enabled: false}
+	}
+	return &ImageClassifier{Net: net, Enabled: true, ModelName: modelName, labels: labels}
+}
+
+// loadClassifierNet reads an ONNX image classification model, preferring CUDA unless
+// CUDA_ENABLED is false. kind prefixes the log lines.
+func loadClassifierNet(modelPath, kind string) (gocv.Net, bool) {
+	if modelPath == "" {
+		log.Printf("%s: model path is empty, disabling the %s", kind, kind)
+		return gocv.Net{}, false
+	}
+	if _, err := os.Stat(modelPath); err != nil {
+		log.Printf("%s: ERROR - Failed to stat model file %s: %v", kind, modelPath, err)
+		return gocv.Net{}, false
+	}
+
+	net := gocv.ReadNetFromONNX(modelPath)
+	if net.Empty() {
+		log.Printf("%s: ERROR - ReadNetFromONNX returned an empty network for %s. Check file path and integrity.", kind, modelPath)
+		return gocv.Net{}, false
+	}
+
+	cudaEnabled := true
+	if val := os.Getenv("CUDA_ENABLED"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			cudaEnabled = parsed
+		} else {
+			log.Printf("%s: Invalid CUDA_ENABLED value '%s'; defaulting to true", kind, val)
+		}
+	}
+	if cudaEnabled && net.SetPreferableBackend(gocv.NetBackendCUDA) == nil && net.SetPreferableTarget(gocv.NetTargetCUDA) == nil {
+		log.Printf("%s: loaded %s (CUDA)", kind, modelPath)
+	} else {
+		net.SetPreferableBackend(gocv.NetBackendDefault)
+		net.SetPreferableTarget(gocv.NetTargetCPU)
+		log.Printf("%s: loaded %s (CPU)", kind, modelPath)
+	}
+	return net, true
+}
+
+// LoadClassifierLabels reads a labels file: the name of each output class on its own line,
+// in output order. only the first of comma separated synonyms is used (as in the ImageNet
+// synset lists), and a blank line leaves its class unnamed.
+func LoadClassifierLabels(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open classifier labels %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var labels []string
+	named := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		label, _, _ := strings.Cut(scanner.Text(), ",")
+		label = strings.ToLower(strings.Join(strings.Fields(label), " "))
+		if label != "" {
+			named++
+		}
+		labels = append(labels, label)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read classifier labels %s: %w", path, err)
+	}
+	if named == 0 {
+		return nil, fmt.Errorf("classifier labels %s name no classes", path)
+	}
+	return labels, nil
+}
+
+// Close releases the network
+func (c *ImageClassifier) Close() {
+	if c != nil && c.Enabled {
+		c.Net.Close()
+		c.Enabled = false
+	}
+}
+
+// Classify returns up to maxLabels labels of a BGR image with a confidence of at least
+// minConfidence, most confident first. the image is scaled to cover the model input and
+// center cropped.
+func (c *ImageClassifier) Classify(img gocv.Mat, minConfidence float32, maxLabels int) ([]Classification, error) {
+	if c == nil || !c.Enabled {
+		return nil, fmt.Errorf("image classifier is not loaded")
+	}
+	scores, err := classifierScores(c.Net, img)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(c.labels) {
+		return nil, fmt.Errorf("model has %d classes but the labels file names %d", len(scores), len(c.labels))
+	}
+	return combineClassScores(classProbabilities(scores), c.labels, minConfidence, maxLabels), nil
+}
+
+// classifierScores runs an image classification network on a BGR image and returns its raw
+// class scores. the image is scaled to cover the 224x224 model input, center cropped and
+// normalized as for ImageNet.
+func classifierScores(net gocv.Net, img gocv.Mat) ([]float32, error) {
+	if img.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	blob := gocv.BlobFromImage(img, 1.0/255.0, image.Pt(classifierInputSize, classifierInputSize), gocv.NewScalar(0, 0, 0, 0), true, true)
+	defer blob.Close()
+	values, err := blob.DataPtrFloat32()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image blob: %w", err)
+	}
+	plane := classifierInputSize * classifierInputSize
+	if len(values) != 3*plane {
+		return nil, fmt.Errorf("unexpected image blob size %d", len(values))
+	}
+	for ch := 0; ch < 3; ch++ {
+		channel := values[ch*plane : (ch+1)*plane]
+		for i := range channel {
+			channel[i] = (channel[i] - classifierMean[ch]) / classifierStd[ch]
+		}
+	}
+
+	net.SetInput(blob, "")
+	output := net.Forward("")
+	defer output.Close()
+	if output.Empty() {
+		return nil, fmt.Errorf("model produced no output")
+	}
+	flattened := output.Reshape(1, 1)
+	defer flattened.Close()
+	scores := make([]float32, flattened.Cols())
+	for i := range scores {
+		scores[i] = flattened.GetFloatAt(0, i)
+	}
+	return scores, nil
+}
+
+// classProbabilities returns scores as probabilities, applying softmax unless the model
+// already outputs a probability distribution
+func classProbabilities(scores []float32) []float32 {
+	var sum float64
+	isDistribution := true
+	for _, s := range scores {
+		if s < 0 || s > 1 {
+			isDistribution = false
+			break
+		}
+		sum += float64(s)
+	}
+	if isDistribution && math.Abs(sum-1) < 0.01 {
+		return scores
+	}
+
+	maxScore := scores[0]
+	for _, s := range scores {
+		maxScore = max(maxScore, s)
+	}
+	probabilities := make([]float32, len(scores))
+	sum = 0
+	for i, s := range scores {
+		e := math.Exp(float64(s - maxScore))
+		probabilities[i] = float32(e)
+		sum += e
+	}
+	for i := range probabilities {
+		probabilities[i] = float32(float64(probabilities[i]) / sum)
+	}
+	return probabilities
+}
+
+// combineClassScores sums the probabilities of classes sharing a label and returns up to
+// maxLabels labels scoring at least minConfidence, most confident first
+func combineClassScores(probabilities []float32, labels []string, minConfidence float32, maxLabels int) []Classification {
+	byLabel := make(map[string]float32)
+	for i, p := range probabilities {
+		if labels[i] != "" {
+			byLabel[labels[i]] += p
+		}
+	}
+	var classifications []Classification
+	for label, confidence := range byLabel {
+		if confidence >= minConfidence {
+			classifications = append(classifications, Classification{Label: label, Confidence: min(confidence, 1)})
+		}
+	}
+	sort.Slice(classifications, func(i, j int) bool {
+		if classifications[i].Confidence != classifications[j].Confidence {
+			return classifications[i].Confidence > classifications[j].Confidence
+		}
+		return classifications[i].Label < classifications[j].Label
+	})
+	if len(classifications) > maxLabels {
+		classifications = classifications[:maxLabels]
+	}
+	return classifications
+}
@@ -0,0 +1,205 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// CLIPModelName is recorded with every image embedding made by the CLIP image encoder
+const CLIPModelName = "clip"
+
+// clipInputSize is the side of the square image the CLIP image encoder takes
+const clipInputSize = 224
+
+// per-channel (RGB) normalization the CLIP image encoder was trained with
+var (
+	clipMean = [3]float32{0.48145466, 0.4578275, 0.40821073}
+	clipStd  = [3]float32{0.26862954, 0.26130258, 0.27577711}
+)
+
+// CLIPImageEncoder embeds whole images with the image half of a CLIP model exported to ONNX.
+// its embeddings are comparable with those of a CLIPTextEncoder for the same model.
+type CLIPImageEncoder struct {
+	Net     gocv.Net
+	Enabled bool
+}
+
+// CLIPTextEncoder embeds search text with the text half of a CLIP model exported to ONNX. the
+// model takes one input of CLIPContextLength token IDs. it is safe for concurrent use.
+type CLIPTextEncoder struct {
+	Net       gocv.Net
+	Enabled   bool
+	tokenizer *CLIPTokenizer
+	mu        sync.Mutex // gocv networks and the tokenizer cache are not safe for concurrent use
+}
+
+// NewCLIPImageEncoder loads a CLIP image encoder. the returned encoder is disabled if the
+// model cannot be loaded.
+func NewCLIPImageEncoder(modelPath string) *CLIPImageEncoder {
+	net, ok := loadCLIPNet(modelPath, "image")
+	if !ok {
+		return &CLIPImageEncoder{Enabled: false}
+	}
+	return &CLIPImageEncoder{Net: net, Enabled: true}
+}
+
+// NewCLIPTextEncoder loads a CLIP text encoder and its tokenizer vocabulary. the returned
+// encoder is disabled if either cannot be loaded.
+func NewCLIPTextEncoder(modelPath, vocabPath string) *CLIPTextEncoder {
+	tokenizer, err := NewCLIPTokenizer(vocabPath)
+	if err != nil {
+		log.Printf("clip: ERROR - %v", err)
+		return &CLIPTextEncoder{Enabled: false}
+	}
+	net, ok := loadCLIPNet(modelPath, "text")
+	if !ok {
+		return &CLIPTextEncoder{Enabled: false}
+	}
+	return &CLIPTextEncoder{Net: net, Enabled: true, tokenizer: tokenizer}
+}
+
+// loadCLIPNet reads an ONNX model, preferring CUDA unless CUDA_ENABLED is false
+func loadCLIPNet(modelPath, kind string) (gocv.Net, bool) {
+	if modelPath == "" {
+		log.Printf("clip: %s model path is empty, disabling the %s encoder", kind, kind)
+		return gocv.Net{}, false
+	}
+	if info, err := os.Stat(modelPath); err != nil {
+		log.Printf("clip: ERROR - Failed to stat %s model file %s: %v", kind, modelPath, err)
+		return gocv.Net{}, false
+	} else if info.Size() == 0 {
+		log.Printf("clip: ERROR - %s model file is empty (0 bytes): %s", kind, modelPath)
+		return gocv.Net{}, false
+	}
+
+	net := gocv.ReadNetFromONNX(modelPath)
+	if net.Empty() {
+		log.Printf("clip: ERROR - ReadNetFromONNX returned an empty network for %s. Check file path and integrity.", modelPath)
+		return gocv.Net{}, false
+	}
+
+	cudaEnabled := true
+	if val := os.Getenv("CUDA_ENABLED"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			cudaEnabled = parsed
+		} else {
+			log.Printf("clip: Invalid CUDA_ENABLED value '%s'; defaulting to true", val)
+		}
+	}
+	if cudaEnabled && net.SetPreferableBackend(gocv.NetBackendCUDA) == nil && net.SetPreferableTarget(gocv.NetTargetCUDA) == nil {
+		log.Printf("clip: loaded %s encoder %s (CUDA)", kind, modelPath)
+	} else {
+		net.SetPreferableBackend(gocv.NetBackendDefault)
+		net.SetPreferableTarget(gocv.NetTargetCPU)
+		log.Printf("clip: loaded %s encoder %s (CPU)", kind, modelPath)
+	}
+	return net, true
+}
+
+// Close releases the network
+func (e *CLIPImageEncoder) Close() {
+	if e != nil && e.Enabled {
+		e.Net.Close()
+		e.Enabled = false
+	}
+}
+
+// Close releases the network
+func (e *CLIPTextEncoder) Close() {
+	if e != nil && e.Enabled {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.Net.Close()
+		e.Enabled = false
+	}
+}
+
+// EncodeImage returns the L2-normalized embedding of a BGR image. the image is scaled to cover
+// the model input and center cropped, as in CLIP's own preprocessing.
+func (e *CLIPImageEncoder) EncodeImage(img gocv.Mat) ([]float32, error) {
+	if e == nil || !e.Enabled {
+		return nil, fmt.Errorf("CLIP image encoder is not loaded")
+	}
+	if img.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	blob := gocv.BlobFromImage(img, 1.0/255.0, image.Pt(clipInputSize, clipInputSize), gocv.NewScalar(0, 0, 0, 0), true, true)
+	defer blob.Close()
+	values, err := blob.DataPtrFloat32()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image blob: %w", err)
+	}
+	plane := clipInputSize * clipInputSize
+	if len(values) != 3*plane {
+		return nil, fmt.Errorf("unexpected image blob size %d", len(values))
+	}
+	for c := 0; c < 3; c++ {
+		channel := values[c*plane : (c+1)*plane]
+		for i := range channel {
+			channel[i] = (channel[i] - clipMean[c]) / clipStd[c]
+		}
+	}
+
+	e.Net.SetInput(blob, "")
+	output := e.Net.Forward("")
+	defer output.Close()
+	return clipEmbedding(output)
+}
+
+// EncodeText returns the L2-normalized embedding of a search text
+func (e *CLIPTextEncoder) EncodeText(text string) ([]float32, error) {
+	if e == nil || !e.Enabled {
+		return nil, fmt.Errorf("CLIP text encoder is not loaded")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ids := e.tokenizer.Encode(text)
+	data := make([]byte, 4*len(ids))
+	for i, id := range ids {
+		binary.LittleEndian.PutUint32(data[4*i:], uint32(id))
+	}
+	tokens, err := gocv.NewMatFromBytes(1, len(ids), gocv.MatTypeCV32S, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token input: %w", err)
+	}
+	defer tokens.Close()
+
+	e.Net.SetInput(tokens, "")
+	output := e.Net.Forward("")
+	defer output.Close()
+	return clipEmbedding(output)
+}
+
+// clipEmbedding flattens an encoder output into an L2-normalized vector
+func clipEmbedding(output gocv.Mat) ([]float32, error) {
+	if output.Empty() {
+		return nil, fmt.Errorf("model produced no output")
+	}
+	flattened := output.Reshape(1, 1)
+	defer flattened.Close()
+
+	embedding := make([]float32, flattened.Cols())
+	var norm float64
+	for i := range embedding {
+		embedding[i] = flattened.GetFloatAt(0, i)
+		norm += float64(embedding[i]) * float64(embedding[i])
+	}
+	if norm == 0 {
+		return nil, fmt.Errorf("model produced a zero embedding")
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range embedding {
+		embedding[i] *= scale
+	}
+	return embedding, nil
+}
@@ -0,0 +1,192 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CLIPContextLength is the number of token IDs the CLIP text encoder takes
+const CLIPContextLength = 77
+
+const (
+	clipStartToken = "<|startoftext|>"
+	clipEndToken   = "<|endoftext|>"
+	// the released vocabulary uses the first 49152-256-2 merges of the BPE file
+	clipMergeCount = 49152 - 256 - 2
+)
+
+// clipWordPattern splits text into words the way the reference CLIP tokenizer does
+var clipWordPattern = regexp.MustCompile(`(?i)<\|startoftext\|>|<\|endoftext\|>|'s|'t|'re|'ve|'m|'ll|'d|\p{L}+|\p{N}|[^\s\p{L}\p{N}]+`)
+
+// CLIPTokenizer turns text into the token IDs of the CLIP text encoder: lower-cased byte-level
+// BPE with the merges of bpe_simple_vocab_16e6.txt. it is not safe for concurrent use.
+type CLIPTokenizer struct {
+	encoder   map[string]int32
+	bpeRanks  map[[2]string]int
+	byteRunes [256]rune
+	cache     map[string][]string
+}
+
+// NewCLIPTokenizer loads the BPE merges file of the CLIP tokenizer
+func NewCLIPTokenizer(vocabPath string) (*CLIPTokenizer, error) {
+	f, err := os.Open(vocabPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CLIP vocabulary: %w", err)
+	}
+	defer f.Close()
+
+	var merges [][2]string
+	scanner := bufio.NewScanner(f)
+	first := true
+	for scanner.Scan() && len(merges) < clipMergeCount {
+		if first {
+			first = false // version header
+			continue
+		}
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 {
+			continue
+		}
+		merges = append(merges, [2]string{parts[0], parts[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CLIP vocabulary: %w", err)
+	}
+	if len(merges) == 0 {
+		return nil, fmt.Errorf("CLIP vocabulary %s has no merges", vocabPath)
+	}
+
+	t := &CLIPTokenizer{
+		encoder:   make(map[string]int32, 2*256+len(merges)+2),
+		bpeRanks:  make(map[[2]string]int, len(merges)),
+		byteRunes: clipByteRunes(),
+		cache:     make(map[string][]string),
+	}
+	// the vocabulary is every byte, every byte ending a word, every merge and the special tokens
+	var vocab []string
+	for _, b := range clipByteOrder() {
+		vocab = append(vocab, string(t.byteRunes[b]))
+	}
+	for _, b := range clipByteOrder() {
+		vocab = append(vocab, string(t.byteRunes[b])+"</w>")
+	}
+	for i, merge := range merges {
+		vocab = append(vocab, merge[0]+merge[1])
+		t.bpeRanks[merge] = i
+	}
+	vocab = append(vocab, clipStartToken, clipEndToken)
+	for i, token := range vocab {
+		t.encoder[token] = int32(i)
+	}
+	return t, nil
+}
+
+// Encode returns the CLIPContextLength token IDs of a text: the start token, the text, the end
+// token and zero padding. text that does not fit is truncated.
+func (t *CLIPTokenizer) Encode(text string) []int32 {
+	text = strings.ToLower(strings.Join(strings.Fields(html.UnescapeString(text)), " "))
+
+	ids := []int32{t.encoder[clipStartToken]}
+	for _, word := range clipWordPattern.FindAllString(text, -1) {
+		var encoded strings.Builder
+		for _, b := range []byte(word) {
+			encoded.WriteRune(t.byteRunes[b])
+		}
+		for _, token := range t.bpe(encoded.String()) {
+			if id, ok := t.encoder[token]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) > CLIPContextLength-1 {
+		ids = ids[:CLIPContextLength-1]
+	}
+	ids = append(ids, t.encoder[clipEndToken])
+
+	padded := make([]int32, CLIPContextLength)
+	copy(padded, ids)
+	return padded
+}
+
+// bpe splits a byte-encoded word into vocabulary tokens by applying the merges in rank order
+func (t *CLIPTokenizer) bpe(word string) []string {
+	if cached, ok := t.cache[word]; ok {
+		return cached
+	}
+
+	var parts []string
+	for _, r := range word {
+		parts = append(parts, string(r))
+	}
+	parts[len(parts)-1] += "</w>"
+
+	for len(parts) > 1 {
+		best := -1
+		bestRank := 0
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := t.bpeRanks[[2]string{parts[i], parts[i+1]}]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		first, second := parts[best], parts[best+1]
+		merged := make([]string, 0, len(parts)-1)
+		for i := 0; i < len(parts); i++ {
+			if i < len(parts)-1 && parts[i] == first && parts[i+1] == second {
+				merged = append(merged, first+second)
+				i++
+			} else {
+				merged = append(merged, parts[i])
+			}
+		}
+		parts = merged
+	}
+
+	if len(t.cache) < 10000 {
+		t.cache[word] = parts
+	}
+	return parts
+}
+
+// clipPrintableByte reports whether the tokenizer keeps a byte as its own rune
+func clipPrintableByte(b byte) bool {
+	return (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || b >= 0xAE
+}
+
+// clipByteOrder lists the bytes in the order of the vocabulary: the printable ones, then the rest
+func clipByteOrder() []byte {
+	var order []byte
+	for b := 0; b < 256; b++ {
+		if clipPrintableByte(byte(b)) {
+			order = append(order, byte(b))
+		}
+	}
+	for b := 0; b < 256; b++ {
+		if !clipPrintableByte(byte(b)) {
+			order = append(order, byte(b))
+		}
+	}
+	return order
+}
+
+// clipByteRunes maps every byte to a printable rune: printable bytes map to themselves, the
+// others to runes from 256 up
+func clipByteRunes() [256]rune {
+	var runes [256]rune
+	n := 0
+	for _, b := range clipByteOrder() {
+		if clipPrintableByte(b) {
+			runes[b] = rune(b)
+		} else {
+			runes[b] = rune(256 + n)
+			n++
+		}
+	}
+	return runes
+}
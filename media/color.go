@@ -0,0 +1,365 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	iccMaxProfileSize = 4 << 20 // larger embedded profiles are ignored
+	iccHeaderSize     = 128
+	iccJPEGMarker     = "ICC_PROFILE\x00"
+
+	// entries of the linear light table used to convert back to 8 bit sRGB
+	srgbEncodeTableSize = 4096
+)
+
+// sRGB primaries adapted to the D50 white of the ICC connection space, as in the sRGB
+// profiles shipped with most systems. columns are red, green and blue.
+var srgbToXYZD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// iccRGBProfile is a matrix/TRC RGB profile, the kind Adobe RGB and Display P3 use
+type iccRGBProfile struct {
+	toXYZ  [3][3]float64   // linear RGB to XYZ (D50), colorants as columns
+	curves [3][256]float64 // 8 bit encoded value to linear light, per channel
+}
+
+// ReadICCProfile returns the ICC profile embedded in a JPEG or PNG file, nil if there is
+// none or the file can't be read
+func ReadICCProfile(filePath string) []byte {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	return readICCProfile(bufio.NewReader(file))
+}
+
+// readICCProfile reads the embedded profile from the header of an encoded image
+func readICCProfile(r *bufio.Reader) []byte {
+	magic, err := r.Peek(8)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return readJPEGICCProfile(r)
+	case bytes.Equal(magic, []byte("\x89PNG\r\n\x1a\n")):
+		return readPNGICCProfile(r)
+	default:
+		return nil
+	}
+}
+
+// readJPEGICCProfile joins the APP2 chunks a JPEG splits its profile into
+func readJPEGICCProfile(r *bufio.Reader) []byte {
+	if _, err := r.Discard(2); err != nil {
+		return nil
+	}
+	chunks := make(map[byte][]byte)
+	var chunkCount byte
+	total := 0
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			break
+		}
+		// the profile always precedes the image data
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			break
+		}
+		if marker[1] != 0xE2 || length < len(iccJPEGMarker)+2 {
+			if _, err := r.Discard(length); err != nil {
+				break
+			}
+			continue
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			break
+		}
+		if string(segment[:len(iccJPEGMarker)]) != iccJPEGMarker {
+			continue
+		}
+		sequence, count := segment[len(iccJPEGMarker)], segment[len(iccJPEGMarker)+1]
+		total += len(segment)
+		if total > iccMaxProfileSize {
+			return nil
+		}
+		chunks[sequence] = segment[len(iccJPEGMarker)+2:]
+		chunkCount = count
+	}
+
+	if chunkCount == 0 || len(chunks) != int(chunkCount) {
+		return nil
+	}
+	var profile []byte
+	for i := byte(1); i <= chunkCount; i++ {
+		chunk, ok := chunks[i]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// readPNGICCProfile inflates the profile of a PNG's iCCP chunk
+func readPNGICCProfile(r *bufio.Reader) []byte {
+	if _, err := r.Discard(8); err != nil {
+		return nil
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+		if chunkType == "IDAT" || chunkType == "IEND" || length > iccMaxProfileSize {
+			return nil
+		}
+		if chunkType != "iCCP" {
+			if _, err := r.Discard(length + 4); err != nil { // data and CRC
+				return nil
+			}
+			continue
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil
+		}
+		// profile name, a null separator and the compression method come first
+		nameEnd := bytes.IndexByte(data, 0)
+		if nameEnd < 0 || nameEnd+2 > len(data) {
+			return nil
+		}
+		inflater, err := zlib.NewReader(bytes.NewReader(data[nameEnd+2:]))
+		if err != nil {
+			return nil
+		}
+		defer inflater.Close()
+		profile, err := io.ReadAll(io.LimitReader(inflater, iccMaxProfileSize))
+		if err != nil {
+			return nil
+		}
+		return profile
+	}
+}
+
+// ConvertToSRGB converts an image from the color space of its embedded ICC profile to
+// sRGB, which browsers assume for untagged images. images without a profile, in sRGB
+// already or with a profile this can't interpret (e.g. CMYK or lookup table profiles)
+// are returned as they are.
+func ConvertToSRGB(img image.Image, profile []byte) image.Image {
+	if len(profile) == 0 {
+		return img
+	}
+	source, ok := parseICCRGBProfile(profile)
+	if !ok {
+		return img
+	}
+
+	toSRGB := multiply3x3(invert3x3(srgbToXYZD50), source.toXYZ)
+	if source.isSRGB(toSRGB) {
+		return img
+	}
+
+	var encode [srgbEncodeTableSize]uint8
+	for i := range encode {
+		encode[i] = uint8(linearToSRGB(float64(i) / (srgbEncodeTableSize - 1)))
+	}
+	encodeLinear := func(v float64) uint8 {
+		v = math.Max(0, math.Min(1, v)) // colors outside of sRGB are clipped
+		return encode[int(v*(srgbEncodeTableSize-1)+0.5)]
+	}
+
+	converted := imaging.Clone(img)
+	pix := converted.Pix
+	for i := 0; i+3 < len(pix); i += 4 {
+		r := source.curves[0][pix[i]]
+		g := source.curves[1][pix[i+1]]
+		b := source.curves[2][pix[i+2]]
+		pix[i] = encodeLinear(toSRGB[0][0]*r + toSRGB[0][1]*g + toSRGB[0][2]*b)
+		pix[i+1] = encodeLinear(toSRGB[1][0]*r + toSRGB[1][1]*g + toSRGB[1][2]*b)
+		pix[i+2] = encodeLinear(toSRGB[2][0]*r + toSRGB[2][1]*g + toSRGB[2][2]*b)
+	}
+	return converted
+}
+
+// isSRGB reports whether converting with the profile would leave the colors as they are
+func (p *iccRGBProfile) isSRGB(toSRGB [3][3]float64) bool {
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			identity := 0.0
+			if row == col {
+				identity = 1
+			}
+			if math.Abs(toSRGB[row][col]-identity) > 0.01 {
+				return false
+			}
+		}
+	}
+	for channel := 0; channel < 3; channel++ {
+		for value := 0; value < 256; value++ {
+			if math.Abs(p.curves[channel][value]-sRGBToLinear(uint8(value))) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseICCRGBProfile reads the colorants and tone curves of an RGB matrix/TRC profile
+func parseICCRGBProfile(profile []byte) (*iccRGBProfile, bool) {
+	if len(profile) < iccHeaderSize+4 || string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil, false
+	}
+	tags := make(map[string][]byte)
+	tagCount := int(binary.BigEndian.Uint32(profile[iccHeaderSize:]))
+	for i := 0; i < tagCount; i++ {
+		entry := iccHeaderSize + 4 + i*12
+		if entry+12 > len(profile) {
+			return nil, false
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			continue
+		}
+		tags[string(profile[entry:entry+4])] = profile[offset : offset+size]
+	}
+
+	p := &iccRGBProfile{}
+	for channel, prefix := range []string{"r", "g", "b"} {
+		xyz, ok := parseICCXYZ(tags[prefix+"XYZ"])
+		if !ok {
+			return nil, false
+		}
+		for row := 0; row < 3; row++ {
+			p.toXYZ[row][channel] = xyz[row]
+		}
+		curve, ok := parseICCCurve(tags[prefix+"TRC"])
+		if !ok {
+			return nil, false
+		}
+		for value := 0; value < 256; value++ {
+			p.curves[channel][value] = math.Max(0, math.Min(1, curve(float64(value)/255)))
+		}
+	}
+	return p, true
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parseICCXYZ reads an XYZType tag
+func parseICCXYZ(tag []byte) ([3]float64, bool) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, true
+}
+
+// parseICCCurve reads a curveType or parametricCurveType tag into a function from encoded
+// to linear values, both 0..1
+func parseICCCurve(tag []byte) (func(float64) float64, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+count*2 {
+			return nil, false
+		}
+		switch count {
+		case 0:
+			return func(x float64) float64 { return x }, true
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return func(x float64) float64 {
+			position := x * float64(count-1)
+			i := min(int(position), count-2)
+			return table[i] + (table[i+1]-table[i])*(position-float64(i))
+		}, true
+
+	case "para":
+		paramCounts := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		funcType := binary.BigEndian.Uint16(tag[8:])
+		n, ok := paramCounts[funcType]
+		if !ok || len(tag) < 12+n*4 {
+			return nil, false
+		}
+		// unused parameters stay 0, which makes every type a special case of type 4
+		var params [7]float64
+		for i := 0; i < n; i++ {
+			params[i] = s15Fixed16(tag[12+i*4:])
+		}
+		g, a, b, c, d, e, f := params[0], params[1], params[2], params[3], params[4], params[5], params[6]
+		switch funcType {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, true
+		case 1, 2:
+			if a == 0 {
+				return nil, false
+			}
+			d = -b / a
+			// type 1 is 0 below d, type 2 adds c everywhere
+			e, f, c = c, c, 0
+		}
+		return func(x float64) float64 {
+			if x >= d {
+				return math.Pow(math.Max(0, a*x+b), g) + e
+			}
+			return c*x + f
+		}, true
+	}
+	return nil, false
+}
+
+func multiply3x3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			for k := 0; k < 3; k++ {
+				m[row][col] += a[row][k] * b[k][col]
+			}
+		}
+	}
+	return m
+}
+
+func invert3x3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return [3][3]float64{
+		{(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det, (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det, (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det},
+		{(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det, (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det, (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det},
+	}
+}
@@ -0,0 +1,255 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// contact sheet layout, in pixels of an A4 page rendered at 150 DPI
+const (
+	contactSheetPageWidth   = 1240
+	contactSheetPageHeight  = 1754
+	contactSheetMargin      = 60
+	contactSheetColumns     = 4
+	contactSheetGap         = 20
+	contactSheetHeader      = 110 // title and subtitle, above the grid
+	contactSheetFooter      = 40  // page number, below the grid
+	contactSheetLabelScale  = 2   // of the 7x13 font the filenames are written in
+	contactSheetJPEGQuality = 85
+
+	// size of an A4 page in PDF points
+	contactSheetPDFWidth  = 595
+	contactSheetPDFHeight = 842
+)
+
+// ContactSheetCellSize is the longest side, in pixels, thumbnails are drawn at on a contact
+// sheet, so thumbnails at least this large look sharp
+const ContactSheetCellSize = (contactSheetPageWidth - 2*contactSheetMargin - (contactSheetColumns-1)*contactSheetGap) / contactSheetColumns
+
+// ContactSheet is a printable overview of an album: a grid of its thumbnails, each with its
+// filename, for clients to pick images from by name
+type ContactSheet struct {
+	Title    string // e.g. the album name
+	Subtitle string // e.g. the number of files and when the sheet was made
+	Entries  []ContactSheetEntry
+}
+
+// ContactSheetEntry is a cell of a contact sheet
+type ContactSheetEntry struct {
+	Name string
+	// Load returns the thumbnail of the entry, or nil to draw an empty box. it is called
+	// while the page with the entry is rendered, so only a page of thumbnails is in memory
+	// at a time.
+	Load func() image.Image
+}
+
+// WriteContactSheetPDF renders a contact sheet as a PDF of A4 pages, each page a JPEG of the
+// grid. a sheet without entries has one empty page.
+func WriteContactSheetPDF(w io.Writer, sheet ContactSheet) error {
+	labelHeight := basicfont.Face7x13.Height * contactSheetLabelScale
+	labelChars := ContactSheetCellSize / (basicfont.Face7x13.Advance * contactSheetLabelScale)
+	rowHeight := ContactSheetCellSize + 8 + 2*labelHeight
+	gridHeight := contactSheetPageHeight - 2*contactSheetMargin - contactSheetHeader - contactSheetFooter
+	rows := max(1, (gridHeight+contactSheetGap)/(rowHeight+contactSheetGap))
+	perPage := rows * contactSheetColumns
+	pageCount := max(1, (len(sheet.Entries)+perPage-1)/perPage)
+
+	pdf := newPDFWriter(w, pageCount)
+	for page := 0; page < pageCount; page++ {
+		canvas := image.NewNRGBA(image.Rect(0, 0, contactSheetPageWidth, contactSheetPageHeight))
+		draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+
+		drawContactSheetText(canvas, sheet.Title, image.Pt(contactSheetMargin, contactSheetMargin), 3, color.Black, contactSheetPageWidth-2*contactSheetMargin)
+		drawContactSheetText(canvas, sheet.Subtitle, image.Pt(contactSheetMargin, contactSheetMargin+55), 2, color.Gray{Y: 110}, contactSheetPageWidth-2*contactSheetMargin)
+
+		entries := sheet.Entries[min(page*perPage, len(sheet.Entries)):min((page+1)*perPage, len(sheet.Entries))]
+		for i, entry := range entries {
+			x := contactSheetMargin + (i%contactSheetColumns)*(ContactSheetCellSize+contactSheetGap)
+			y := contactSheetMargin + contactSheetHeader + (i/contactSheetColumns)*(rowHeight+contactSheetGap)
+			drawContactSheetCell(canvas, entry, image.Pt(x, y))
+			for line, text := range contactSheetLabel(entry.Name, labelChars) {
+				drawContactSheetText(canvas, text, image.Pt(x, y+ContactSheetCellSize+8+line*labelHeight), contactSheetLabelScale, color.Black, ContactSheetCellSize)
+			}
+		}
+
+		footer := fmt.Sprintf("Page %d of %d", page+1, pageCount)
+		footerWidth := font.MeasureString(basicfont.Face7x13, footer).Ceil() * 2
+		drawContactSheetText(canvas, footer, image.Pt((contactSheetPageWidth-footerWidth)/2, contactSheetPageHeight-contactSheetMargin-basicfont.Face7x13.Height*2), 2, color.Gray{Y: 110}, contactSheetPageWidth)
+
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, canvas, &jpeg.Options{Quality: contactSheetJPEGQuality}); err != nil {
+			return fmt.Errorf("failed to encode contact sheet page %d: %w", page+1, err)
+		}
+		if err := pdf.writeImagePage(encoded.Bytes(), contactSheetPageWidth, contactSheetPageHeight); err != nil {
+			return err
+		}
+	}
+	return pdf.close()
+}
+
+// drawContactSheetCell draws the thumbnail of an entry centered in its square cell at pos, or
+// a grey box when it has none
+func drawContactSheetCell(dst draw.Image, entry ContactSheetEntry, pos image.Point) {
+	cell := image.Rectangle{Min: pos, Max: pos.Add(image.Pt(ContactSheetCellSize, ContactSheetCellSize))}
+	var thumb image.Image
+	if entry.Load != nil {
+		thumb = entry.Load()
+	}
+	if thumb == nil {
+		draw.Draw(dst, cell, image.NewUniform(color.Gray{Y: 225}), image.Point{}, draw.Src)
+		return
+	}
+	thumb = imaging.Fit(thumb, ContactSheetCellSize, ContactSheetCellSize, imaging.Lanczos)
+	size := thumb.Bounds().Size()
+	at := pos.Add(image.Pt((ContactSheetCellSize-size.X)/2, (ContactSheetCellSize-size.Y)/2))
+	draw.Draw(dst, image.Rectangle{Min: at, Max: at.Add(size)}, thumb, thumb.Bounds().Min, draw.Over)
+}
+
+// contactSheetLabel splits a filename over the two lines of maxChars characters below its
+// thumbnail. longer names lose the middle of their second line, the end with the extension
+// and any camera counter stays visible.
+func contactSheetLabel(name string, maxChars int) []string {
+	runes := []rune(name)
+	switch {
+	case len(runes) <= maxChars:
+		return []string{name}
+	case len(runes) <= 2*maxChars:
+		return []string{string(runes[:maxChars]), string(runes[maxChars:])}
+	default:
+		return []string{string(runes[:maxChars]), "..." + string(runes[len(runes)-(maxChars-3):])}
+	}
+}
+
+// drawContactSheetText writes text at pos in the 7x13 bitmap font, magnified scale times so it
+// stays crisp. text wider than maxWidth is shortened in the middle.
+func drawContactSheetText(dst draw.Image, text string, pos image.Point, scale int, c color.Color, maxWidth int) {
+	face := basicfont.Face7x13
+	maxChars := maxWidth / (face.Advance * scale)
+	if runes := []rune(text); len(runes) > maxChars && maxChars > 3 {
+		head := (maxChars - 3) / 2
+		text = string(runes[:head]) + "..." + string(runes[len(runes)-(maxChars-3-head):])
+	}
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, face.Height))
+	drawer := font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	drawer.DrawString(text)
+	scaled := imaging.Resize(canvas, width*scale, face.Height*scale, imaging.NearestNeighbor)
+	draw.Draw(dst, scaled.Bounds().Add(pos), scaled, image.Point{}, draw.Over)
+}
+
+// pdfWriter writes a PDF whose pages are each a single full-page JPEG, a page at a time. the
+// objects are numbered up front: the catalog is 1, the page tree 2, and every page takes the
+// three after that for its image, content stream and page dictionary.
+type pdfWriter struct {
+	w         *bufio.Writer
+	written   int64
+	offsets   []int64 // of the objects, by number - 1
+	pageCount int
+	pages     int // written so far
+	err       error
+}
+
+func newPDFWriter(w io.Writer, pageCount int) *pdfWriter {
+	pdf := &pdfWriter{w: bufio.NewWriter(w), offsets: make([]int64, 2+3*pageCount), pageCount: pageCount}
+	// the binary comment marks the file as binary for transfer tools
+	pdf.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	pdf.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	return pdf
+}
+
+func (pdf *pdfWriter) printf(format string, args ...interface{}) {
+	if pdf.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pdf.w, format, args...)
+	pdf.written += int64(n)
+	pdf.err = err
+}
+
+func (pdf *pdfWriter) write(data []byte) {
+	if pdf.err != nil {
+		return
+	}
+	n, err := pdf.w.Write(data)
+	pdf.written += int64(n)
+	pdf.err = err
+}
+
+// object writes a whole object, recording where it starts for the cross-reference table
+func (pdf *pdfWriter) object(number int, body string) {
+	pdf.offsets[number-1] = pdf.written
+	pdf.printf("%d 0 obj\n%s\nendobj\n", number, body)
+}
+
+// stream writes an object holding a stream, with dict the entries of its dictionary besides
+// its length
+func (pdf *pdfWriter) stream(number int, dict string, data []byte) {
+	pdf.offsets[number-1] = pdf.written
+	pdf.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", number, dict, len(data))
+	pdf.write(data)
+	pdf.printf("\nendstream\nendobj\n")
+}
+
+// writeImagePage adds a page showing a width x height JPEG over the whole of an A4 page
+func (pdf *pdfWriter) writeImagePage(jpegData []byte, width, height int) error {
+	if pdf.pages >= pdf.pageCount {
+		return fmt.Errorf("contact sheet PDF has room for %d pages", pdf.pageCount)
+	}
+	first := 3 + 3*pdf.pages
+	pdf.pages++
+
+	pdf.stream(first, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", width, height), jpegData)
+	pdf.stream(first+1, "", []byte(fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", contactSheetPDFWidth, contactSheetPDFHeight)))
+	pdf.object(first+2, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		contactSheetPDFWidth, contactSheetPDFHeight, first, first+1))
+	if pdf.err != nil {
+		return fmt.Errorf("failed to write contact sheet PDF page %d: %w", pdf.pages, pdf.err)
+	}
+	return nil
+}
+
+// close writes the page tree, the cross-reference table and the trailer
+func (pdf *pdfWriter) close() error {
+	if pdf.pages != pdf.pageCount {
+		return fmt.Errorf("contact sheet PDF has %d of its %d pages", pdf.pages, pdf.pageCount)
+	}
+	kids := make([]string, pdf.pageCount)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+3*i)
+	}
+	pdf.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pdf.pageCount))
+
+	xref := pdf.written
+	pdf.printf("xref\n0 %d\n0000000000 65535 f \n", len(pdf.offsets)+1)
+	for _, offset := range pdf.offsets {
+		pdf.printf("%010d 00000 n \n", offset)
+	}
+	pdf.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pdf.offsets)+1, xref)
+	if pdf.err == nil {
+		pdf.err = pdf.w.Flush()
+	}
+	if pdf.err != nil {
+		return fmt.Errorf("failed to write contact sheet PDF: %w", pdf.err)
+	}
+	return nil
+}
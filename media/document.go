@@ -0,0 +1,68 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const documentRenderTimeout = 60 * time.Second
+
+var supportedDocumentExtensions = map[string]bool{
+	".pdf": true,
+}
+
+// IsDocument checks if the filename has a supported document extension, e.g. the program or
+// flyer of an event, which is listed with a preview of its first page
+func IsDocument(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return supportedDocumentExtensions[ext]
+}
+
+// DocumentTool wraps the pdftoppm binary (poppler-utils) used to render document previews
+type DocumentTool struct {
+	PdftoppmPath string
+}
+
+// NewDocumentTool creates a DocumentTool, falling back to the binary on PATH
+func NewDocumentTool(pdftoppmPath string) *DocumentTool {
+	if pdftoppmPath == "" {
+		pdftoppmPath = "pdftoppm"
+	}
+	return &DocumentTool{PdftoppmPath: pdftoppmPath}
+}
+
+// RenderFirstPage renders the first page of a PDF with its longest side maxSize pixels, to
+// generate the document's thumbnails from
+func (dt *DocumentTool) RenderFirstPage(documentPath string, maxSize int) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), documentRenderTimeout)
+	defer cancel()
+
+	// without an output file name, the page is written to stdout
+	cmd := exec.CommandContext(ctx, dt.PdftoppmPath,
+		"-f", "1",
+		"-l", "1",
+		"-singlefile",
+		"-png",
+		"-scale-to", strconv.Itoa(maxSize),
+		documentPath,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftoppm rendering failed for %s: %w (%s)", documentPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	img, _, err := image.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode first page of %s: %w", documentPath, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,86 @@
+package media
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// FaceEmbedder finds the faces in an uploaded photo and extracts their recognition
+// embeddings, without saving anything, for searching by example photo. it has its own copy
+// of the models, separate from the workers'.
+type FaceEmbedder struct {
+	detector    *RetinaFaceDetector
+	recognition *FaceRecognitionModel
+	Enabled     bool
+	mu          sync.Mutex // gocv networks are not safe for concurrent use
+}
+
+// NewFaceEmbedder loads the RetinaFace detector and a face recognition model. the returned
+// embedder is disabled if either cannot be loaded.
+func NewFaceEmbedder(detectorModelPath, recognitionModelPath, recognitionModelName string) *FaceEmbedder {
+	detector := NewRetinaFaceDetector(detectorModelPath)
+	if detector == nil || !detector.Enabled {
+		return &FaceEmbedder{Enabled: false}
+	}
+	recognition := NewFaceRecognitionModel(recognitionModelPath, recognitionModelName)
+	if recognition == nil || !recognition.Enabled {
+		detector.Close()
+		return &FaceEmbedder{Enabled: false}
+	}
+	return &FaceEmbedder{detector: detector, recognition: recognition, Enabled: true}
+}
+
+// Close releases the models
+func (e *FaceEmbedder) Close() {
+	if e != nil && e.Enabled {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.detector.Close()
+		e.recognition.Close()
+		e.Enabled = false
+	}
+}
+
+// SetDetectionThresholds changes the minimum confidence of detected faces and the overlap
+// above which duplicate detections are dropped
+func (e *FaceEmbedder) SetDetectionThresholds(confidence, iou float32) {
+	if e == nil || !e.Enabled {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.detector.ConfThreshold = confidence
+	e.detector.IoUThreshold = iou
+}
+
+// EmbedFaces decodes an encoded image and returns the faces found in it that have an
+// embedding, largest first
+func (e *FaceEmbedder) EmbedFaces(data []byte) ([]DetectionResult, error) {
+	if e == nil || !e.Enabled {
+		return nil, fmt.Errorf("face embedder is not loaded")
+	}
+	img, err := gocv.IMDecode(data, gocv.IMReadColor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	defer img.Close()
+	if img.Empty() {
+		return nil, fmt.Errorf("failed to decode image")
+	}
+
+	e.mu.Lock()
+	detections := e.detector.DetectFacesAndExtractEmbeddings(img, e.recognition)
+	e.mu.Unlock()
+
+	faces := make([]DetectionResult, 0, len(detections))
+	for _, detection := range detections {
+		if len(detection.Embedding) > 0 {
+			faces = append(faces, detection)
+		}
+	}
+	sort.SliceStable(faces, func(i, j int) bool { return faces[i].W*faces[i].H > faces[j].W*faces[j].H })
+	return faces, nil
+}
@@ -0,0 +1,314 @@
+package media
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+// Place is a position resolved to the names of the places it is in. any of them may be empty.
+type Place struct {
+	City        string `json:"city,omitempty"`
+	Region      string `json:"region,omitempty"` // state, province or similar
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"` // ISO 3166-1 alpha-2, upper case
+}
+
+// Name joins the non-empty parts of a place, e.g. "Austin, Texas, United States"
+func (p Place) Name() string {
+	var parts []string
+	for _, part := range []string{p.City, p.Region, p.Country} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Geocoder resolves GPS positions to places
+type Geocoder interface {
+	// ReverseGeocode returns the place at a position, or nil if there is none, e.g. at sea
+	ReverseGeocode(lat, lon float64) (*Place, error)
+}
+
+// NewGeocoderFromConfig creates the Geocoder selected by cfg.GeocodingProvider. returns nil
+// when reverse geocoding is disabled.
+func NewGeocoderFromConfig(cfg config.Config) (Geocoder, error) {
+	switch cfg.GeocodingProvider {
+	case config.GeocodingProviderNominatim:
+		return NewNominatimGeocoder(cfg.GeocodingURL, cfg.GeocodingUserAgent), nil
+	case config.GeocodingProviderOffline:
+		geocoder, err := NewOfflineGeocoder(cfg.GeocodingDatasetPath, cfg.GeocodingMaxDistanceKm)
+		if err != nil {
+			return nil, err
+		}
+		return geocoder, nil
+	case config.GeocodingProviderNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown geocoding provider '%s'", cfg.GeocodingProvider)
+	}
+}
+
+// nominatimInterval is the minimum time between requests, per the public Nominatim usage policy
+const nominatimInterval = time.Second
+
+// NominatimGeocoder resolves positions with the reverse endpoint of a Nominatim server.
+// requests are spaced nominatimInterval apart. it is safe for concurrent use.
+type NominatimGeocoder struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+
+	mu          sync.Mutex // serializes requests to honour the rate limit
+	lastRequest time.Time
+}
+
+// NewNominatimGeocoder creates a geocoder for the Nominatim server at baseURL
+func NewNominatimGeocoder(baseURL, userAgent string) *NominatimGeocoder {
+	return &NominatimGeocoder{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type nominatimResponse struct {
+	Error   string `json:"error"`
+	Address struct {
+		City         string `json:"city"`
+		Town         string `json:"town"`
+		Village      string `json:"village"`
+		Hamlet       string `json:"hamlet"`
+		Municipality string `json:"municipality"`
+		State        string `json:"state"`
+		Province     string `json:"province"`
+		Region       string `json:"region"`
+		Country      string `json:"country"`
+		CountryCode  string `json:"country_code"`
+	} `json:"address"`
+}
+
+// ReverseGeocode implements Geocoder
+func (g *NominatimGeocoder) ReverseGeocode(lat, lon float64) (*Place, error) {
+	query := url.Values{}
+	query.Set("format", "jsonv2")
+	query.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	query.Set("lon", strconv.FormatFloat(lon, 'f', 6, 64))
+	query.Set("zoom", "10") // city level
+	query.Set("addressdetails", "1")
+	req, err := http.NewRequest(http.MethodGet, g.baseURL+"/reverse?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build reverse geocoding request: %w", err)
+	}
+	req.Header.Set("User-Agent", g.userAgent)
+	req.Header.Set("Accept-Language", "en")
+
+	g.mu.Lock()
+	if wait := nominatimInterval - time.Since(g.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	resp, err := g.client.Do(req)
+	g.lastRequest = time.Now()
+	g.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("reverse geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("reverse geocoding failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var result nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode reverse geocoding response: %w", err)
+	}
+	if result.Error != "" {
+		return nil, nil // "Unable to geocode": nothing at this position
+	}
+
+	address := result.Address
+	place := &Place{
+		City:        firstNonEmpty(address.City, address.Town, address.Village, address.Municipality, address.Hamlet),
+		Region:      firstNonEmpty(address.State, address.Province, address.Region),
+		Country:     address.Country,
+		CountryCode: strings.ToUpper(address.CountryCode),
+	}
+	if *place == (Place{}) {
+		return nil, nil
+	}
+	return place, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// offlinePlace is a city of the offline dataset
+type offlinePlace struct {
+	lat, lon    float64
+	name        string
+	admin1      string // region code within the country
+	countryCode string
+}
+
+// OfflineGeocoder resolves positions to the nearest city of a GeoNames cities file
+// (https://download.geonames.org/export/dump/, e.g. cities1000.txt). region and country
+// names are read from admin1CodesASCII.txt and countryInfo.txt in the same directory when
+// present; otherwise the codes are used. it is safe for concurrent use.
+type OfflineGeocoder struct {
+	maxDistanceKm float64
+	cells         map[[2]int][]offlinePlace // places by the whole degrees of their position
+	regions       map[string]string         // "US.TX" -> "Texas"
+	countries     map[string]string         // "US" -> "United States"
+}
+
+// earthRadiusKm is the mean radius of the earth
+const earthRadiusKm = 6371.0
+
+// NewOfflineGeocoder loads a GeoNames cities file. positions further than maxDistanceKm from
+// every city are not resolved.
+func NewOfflineGeocoder(datasetPath string, maxDistanceKm float64) (*OfflineGeocoder, error) {
+	g := &OfflineGeocoder{
+		maxDistanceKm: maxDistanceKm,
+		cells:         make(map[[2]int][]offlinePlace),
+	}
+
+	count := 0
+	err := readGeoNamesFile(datasetPath, func(fields []string) {
+		// geonameid, name, asciiname, alternatenames, latitude, longitude, feature class,
+		// feature code, country code, cc2, admin1 code, ...
+		if len(fields) < 11 {
+			return
+		}
+		lat, latErr := strconv.ParseFloat(fields[4], 64)
+		lon, lonErr := strconv.ParseFloat(fields[5], 64)
+		if latErr != nil || lonErr != nil {
+			return
+		}
+		place := offlinePlace{lat: lat, lon: lon, name: fields[1], admin1: fields[10], countryCode: fields[8]}
+		key := offlineCell(lat, lon)
+		g.cells[key] = append(g.cells[key], place)
+		count++
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load geocoding dataset: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("geocoding dataset %s has no places", datasetPath)
+	}
+
+	dir := filepath.Dir(datasetPath)
+	g.regions = make(map[string]string)
+	if err := readGeoNamesFile(filepath.Join(dir, "admin1CodesASCII.txt"), func(fields []string) {
+		if len(fields) >= 2 {
+			g.regions[fields[0]] = fields[1]
+		}
+	}); err != nil && !os.IsNotExist(err) {
+		log.Printf("geocoding: Warning - failed to read region names: %v", err)
+	}
+	g.countries = make(map[string]string)
+	if err := readGeoNamesFile(filepath.Join(dir, "countryInfo.txt"), func(fields []string) {
+		if len(fields) >= 5 {
+			g.countries[fields[0]] = fields[4]
+		}
+	}); err != nil && !os.IsNotExist(err) {
+		log.Printf("geocoding: Warning - failed to read country names: %v", err)
+	}
+
+	log.Printf("geocoding: Loaded %d places from %s (%d region and %d country names)", count, datasetPath, len(g.regions), len(g.countries))
+	return g, nil
+}
+
+// readGeoNamesFile calls fn with the tab separated fields of every line of a GeoNames dump
+// file, skipping comments
+func readGeoNamesFile(path string, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // alternate names can make long lines
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Split(line, "\t"))
+	}
+	return scanner.Err()
+}
+
+func offlineCell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+}
+
+// ReverseGeocode implements Geocoder
+func (g *OfflineGeocoder) ReverseGeocode(lat, lon float64) (*Place, error) {
+	// search the cells that can hold a place within the maximum distance. near the poles that
+	// is every longitude, with the cells at both ends of the range being the same.
+	latSpan := int(math.Ceil(g.maxDistanceKm / 111.0))
+	lonSpan := 180
+	if cosLat := math.Cos(lat * math.Pi / 180); cosLat > 0.01 {
+		lonSpan = int(math.Min(180, math.Ceil(g.maxDistanceKm/(111.0*cosLat))))
+	}
+	center := offlineCell(lat, lon)
+
+	var best *offlinePlace
+	bestDistance := g.maxDistanceKm
+	for dy := -latSpan; dy <= latSpan; dy++ {
+		for dx := -lonSpan; dx <= lonSpan; dx++ {
+			cellLon := center[1] + dx
+			// wrap around the antimeridian
+			cellLon = ((cellLon+180)%360+360)%360 - 180
+			places := g.cells[[2]int{center[0] + dy, cellLon}]
+			for i := range places {
+				if d := haversineKm(lat, lon, places[i].lat, places[i].lon); d <= bestDistance {
+					best, bestDistance = &places[i], d
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	place := &Place{City: best.name, CountryCode: best.countryCode, Country: best.countryCode}
+	if name, ok := g.countries[best.countryCode]; ok {
+		place.Country = name
+	}
+	if best.admin1 != "" {
+		place.Region = g.regions[best.countryCode+"."+best.admin1]
+	}
+	return place, nil
+}
+
+// haversineKm is the great-circle distance between two positions
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
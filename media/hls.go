@@ -0,0 +1,145 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HLSMasterPlaylist is the name of the playlist listing the variants of a video stream
+	HLSMasterPlaylist = "master.m3u8"
+	// HLSPlaylistExtension is the extension of master and variant playlists
+	HLSPlaylistExtension = ".m3u8"
+
+	// target segment length. keyframes are forced at segment boundaries, so all variants are
+	// cut at the same times and players can switch between them
+	hlsSegmentSeconds = 6
+)
+
+// hlsVariantHeights picks the heights of the variants of a video sourceHeight pixels tall:
+// those no taller than the video, or the video's own height when it is smaller than all of
+// them. a video of unknown height gets the smallest.
+func hlsVariantHeights(heights []int, sourceHeight int) []int {
+	if sourceHeight <= 0 {
+		return heights[:min(len(heights), 1)]
+	}
+	var picked []int
+	for _, height := range heights {
+		if height <= sourceHeight {
+			picked = append(picked, height)
+		}
+	}
+	if len(picked) == 0 {
+		picked = []int{sourceHeight - sourceHeight%2}
+	}
+	return picked
+}
+
+// PackageHLS transcodes a video into H.264/AAC HLS variants in destDir, one per height of
+// heights no taller than the video, each a playlist with its segments, and writes the master
+// playlist HLSMasterPlaylist listing them. width and height are those of the video, or 0
+// when unknown.
+func (vt *VideoTool) PackageHLS(videoPath, destDir string, width, height int, heights []int) error {
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, variantHeight := range hlsVariantHeights(heights, height) {
+		name := strconv.Itoa(variantHeight) + "p"
+		if err := vt.packageHLSVariant(videoPath, destDir, name, variantHeight); err != nil {
+			return err
+		}
+		bandwidth, err := hlsPeakBandwidth(destDir, name+HLSPlaylistExtension)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d", bandwidth)
+		if width > 0 && height > 0 {
+			// scaled like the scale filter does: never up, width rounded to an even number
+			scaledHeight := min(variantHeight, height)
+			scaledWidth := (width*scaledHeight/height + 1) &^ 1
+			fmt.Fprintf(&master, ",RESOLUTION=%dx%d", scaledWidth, scaledHeight)
+		}
+		master.WriteString("\n" + name + HLSPlaylistExtension + "\n")
+	}
+
+	if err := os.WriteFile(filepath.Join(destDir, HLSMasterPlaylist), []byte(master.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write HLS master playlist: %w", err)
+	}
+	return nil
+}
+
+// packageHLSVariant transcodes one variant of an HLS stream into the playlist name.m3u8 and
+// its segments
+func (vt *VideoTool) packageHLSVariant(videoPath, destDir, name string, maxHeight int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), videoTranscodeTimeout)
+	defer cancel()
+
+	scaleFilter := fmt.Sprintf("scale=-2:'min(%d,ih)':force_divisible_by=2", maxHeight)
+	cmd := exec.CommandContext(ctx, vt.FFmpegPath,
+		"-v", "error",
+		"-y",
+		"-i", videoPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-vf", scaleFilter,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds),
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(destDir, name+"_%05d.ts"),
+		filepath.Join(destDir, name+HLSPlaylistExtension),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg HLS packaging (%s) failed for %s: %w (%s)", name, videoPath, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// hlsPeakBandwidth returns the highest bitrate of the segments of a variant playlist, in bits
+// per second, which the master playlist advertises as the variant's bandwidth
+func hlsPeakBandwidth(dir, playlist string) (int64, error) {
+	file, err := os.Open(filepath.Join(dir, playlist))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open HLS playlist %s: %w", playlist, err)
+	}
+	defer file.Close()
+
+	var peak int64
+	duration := 0.0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			duration, _ = strconv.ParseFloat(strings.SplitN(value, ",", 2)[0], 64)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || duration <= 0 {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, line))
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat HLS segment %s: %w", line, err)
+		}
+		peak = max(peak, int64(float64(info.Size()*8)/duration))
+		duration = 0
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read HLS playlist %s: %w", playlist, err)
+	}
+	return peak, nil
+}
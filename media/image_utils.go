@@ -17,3 +17,9 @@ func IsRasterImage(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	return supportedImageExtensions[ext]
 }
+
+// IsProcessableImage checks if the file can go through the thumbnail, metadata and
+// detection pipeline, either directly or via an embedded RAW preview
+func IsProcessableImage(filename string) bool {
+	return IsRasterImage(filename) || IsRawImage(filename)
+}
@@ -0,0 +1,316 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// jpegXMPHeader starts the XMP packet of a JPEG APP1 segment
+	jpegXMPHeader = "http://ns.adobe.com/xap/1.0/\x00"
+	// jpegPhotoshopHeader starts the Photoshop image resources of a JPEG APP13 segment
+	jpegPhotoshopHeader = "Photoshop 3.0\x00"
+	// photoshopIPTCResource is the ID of the image resource holding IPTC-IIM data
+	photoshopIPTCResource = 0x0404
+	// maxXMPScanBytes is how much of a non-JPEG file is searched for an embedded XMP packet
+	maxXMPScanBytes = 8 << 20
+
+	xmpDublinCoreNamespace = "http://purl.org/dc/elements/1.1/"
+	xmpRDFNamespace        = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// ReadKeywords returns the keywords of an image: the IPTC keywords and XMP dc:subject entries
+// embedded in the file, and those of an XMP sidecar next to it (IMG_1.xmp or IMG_1.CR2.xmp).
+// duplicates are dropped case-insensitively. files that cannot be read yield no keywords.
+func ReadKeywords(filePath string) []string {
+	var keywords []string
+	embedded, err := readEmbeddedKeywords(filePath)
+	if err != nil {
+		log.Printf("metadata: Warning - Could not read keywords of %s: %v", filePath, err)
+	}
+	keywords = append(keywords, embedded...)
+
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	for _, sidecar := range []string{base + ".xmp", base + ".XMP", filePath + ".xmp"} {
+		packet, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		keywords = append(keywords, parseXMPKeywords(packet)...)
+		break
+	}
+	return uniqueKeywords(keywords)
+}
+
+// readEmbeddedKeywords reads the IPTC and XMP keywords of a JPEG's APP segments, or of the XMP
+// packet near the start of any other file
+func readEmbeddedKeywords(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0xFF && magic[1] == 0xD8 {
+		return readJPEGKeywords(reader)
+	}
+
+	packet, err := scanXMPPacket(reader)
+	if err != nil || packet == nil {
+		return nil, err
+	}
+	return parseXMPKeywords(packet), nil
+}
+
+// readEmbeddedXMP returns the XMP packet of a JPEG's APP1 segment, or the one near the start
+// of any other file, or nil if it has none
+func readEmbeddedXMP(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(2); err != nil || magic[0] != 0xFF || magic[1] != 0xD8 {
+		return scanXMPPacket(reader)
+	}
+	var packet []byte
+	err = readJPEGSegments(reader, func(marker byte, segment []byte) {
+		if packet == nil && marker == 0xE1 && bytes.HasPrefix(segment, []byte(jpegXMPHeader)) {
+			packet = segment[len(jpegXMPHeader):]
+		}
+	})
+	return packet, err
+}
+
+// scanXMPPacket searches the first maxXMPScanBytes of a file for an x:xmpmeta element, as
+// embedded by most formats other than JPEG, and returns it, or nil if there is none
+func scanXMPPacket(reader io.Reader) ([]byte, error) {
+	head, err := io.ReadAll(io.LimitReader(reader, maxXMPScanBytes))
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(head, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil, nil
+	}
+	end := bytes.Index(head[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil, nil
+	}
+	return head[start : start+end+len("</x:xmpmeta>")], nil
+}
+
+// readJPEGKeywords collects the keywords of the XMP (APP1) and IPTC (APP13) segments of a JPEG
+func readJPEGKeywords(reader *bufio.Reader) ([]string, error) {
+	var keywords []string
+	var photoshop []byte // APP13 resources may be split over several segments
+	err := readJPEGSegments(reader, func(marker byte, segment []byte) {
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte(jpegXMPHeader)):
+			keywords = append(keywords, parseXMPKeywords(segment[len(jpegXMPHeader):])...)
+		case marker == 0xED && bytes.HasPrefix(segment, []byte(jpegPhotoshopHeader)):
+			photoshop = append(photoshop, segment[len(jpegPhotoshopHeader):]...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iptc := range photoshopResources(photoshop, photoshopIPTCResource) {
+		keywords = append(keywords, parseIPTCKeywords(iptc)...)
+	}
+	return keywords, nil
+}
+
+// readJPEGSegments walks the segments of a JPEG up to the image data, calling visit with the
+// marker and data of each APP1 and APP13 segment
+func readJPEGSegments(reader *bufio.Reader, visit func(marker byte, segment []byte)) error {
+	if _, err := reader.Discard(2); err != nil {
+		return err
+	}
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			break
+		}
+		if b != 0xFF {
+			return errors.New("invalid JPEG segment marker")
+		}
+		marker, err := reader.ReadByte()
+		for err == nil && marker == 0xFF { // fill bytes
+			marker, err = reader.ReadByte()
+		}
+		if err != nil {
+			break
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) { // no length
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length < 2 {
+			return errors.New("invalid JPEG segment length")
+		}
+		size := int(length) - 2
+		if marker != 0xE1 && marker != 0xED {
+			if _, err := reader.Discard(size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return err
+		}
+		visit(marker, segment)
+	}
+	return nil
+}
+
+// photoshopResources returns the data of the Photoshop image resource blocks with an ID
+func photoshopResources(data []byte, id uint16) [][]byte {
+	var resources [][]byte
+	for len(data) >= 12 && string(data[:4]) == "8BIM" {
+		// the name is a Pascal string padded to an even length
+		pos := 6 + (int(data[6])+2)&^1
+		if pos+4 > len(data) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			break
+		}
+		if binary.BigEndian.Uint16(data[4:6]) == id {
+			resources = append(resources, data[pos:pos+size])
+		}
+		// so is the data
+		pos += (size + 1) &^ 1
+		if pos >= len(data) {
+			break
+		}
+		data = data[pos:]
+	}
+	return resources
+}
+
+// parseIPTCKeywords returns the keywords (dataset 2:25) of IPTC-IIM data
+func parseIPTCKeywords(data []byte) []string {
+	var keywords []string
+	isUTF8 := false
+	for pos := 0; pos+5 <= len(data) && data[pos] == 0x1C; {
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3 : pos+5]))
+		pos += 5
+		if size&0x8000 != 0 {
+			// extended dataset: the low bits are the length of the size that follows
+			n := size & 0x7FFF
+			if n > 4 || pos+n > len(data) {
+				break
+			}
+			size = 0
+			for _, b := range data[pos : pos+n] {
+				size = size<<8 | int(b)
+			}
+			pos += n
+		}
+		if pos+size > len(data) {
+			break
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch {
+		case record == 1 && dataset == 90: // coded character set
+			isUTF8 = bytes.Equal(value, []byte("\x1b%G"))
+		case record == 2 && dataset == 25:
+			keywords = append(keywords, decodeIPTCString(value, isUTF8))
+		}
+	}
+	return keywords
+}
+
+// decodeIPTCString decodes an IPTC value. without a UTF-8 character set declaration, values
+// that are not valid UTF-8 are read as Latin-1.
+func decodeIPTCString(value []byte, isUTF8 bool) string {
+	if isUTF8 || utf8.Valid(value) {
+		return string(value)
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// parseXMPKeywords returns the dc:subject entries of an XMP packet
+func parseXMPKeywords(packet []byte) []string {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var keywords []string
+	var text strings.Builder
+	inSubject, inItem := false, false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == xmpDublinCoreNamespace && t.Name.Local == "subject" {
+				inSubject = true
+			} else if inSubject && t.Name.Space == xmpRDFNamespace && t.Name.Local == "li" {
+				inItem = true
+				text.Reset()
+			}
+		case xml.CharData:
+			if inItem {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if inItem && t.Name.Space == xmpRDFNamespace && t.Name.Local == "li" {
+				keywords = append(keywords, text.String())
+				inItem = false
+			} else if t.Name.Space == xmpDublinCoreNamespace && t.Name.Local == "subject" {
+				inSubject = false
+			}
+		}
+	}
+	return keywords
+}
+
+// uniqueKeywords trims keywords and drops empty ones and case-insensitive duplicates,
+// keeping the first spelling
+func uniqueKeywords(keywords []string) []string {
+	seen := make(map[string]bool, len(keywords))
+	var unique []string
+	for _, keyword := range keywords {
+		keyword = strings.Join(strings.Fields(keyword), " ")
+		key := strings.ToLower(keyword)
+		if keyword == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, keyword)
+	}
+	return unique
+}
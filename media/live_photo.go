@@ -0,0 +1,73 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// appleMakerNoteHeader starts the maker note of photos taken with an iPhone. the version
+	// and byte order follow, then an IFD whose offsets are relative to the maker note
+	appleMakerNoteHeader = "Apple iOS\x00"
+	// appleContentIdentifierTag is the maker note tag holding the content identifier the
+	// still of a Live Photo shares with its video
+	appleContentIdentifierTag = 0x0011
+	// quickTimeContentIdentifierKey is the metadata key holding it in the video
+	quickTimeContentIdentifierKey = "com.apple.quicktime.content.identifier"
+)
+
+// getContentIdentifier returns the Live Photo content identifier of the Apple maker note, or
+// nil for photos that aren't the still of a Live Photo
+func getContentIdentifier(exifData *exif.Exif) *string {
+	tag, err := exifData.Get(exif.MakerNote)
+	if err != nil || tag == nil {
+		return nil
+	}
+	if id := parseAppleContentIdentifier(tag.Val); id != "" {
+		return &id
+	}
+	return nil
+}
+
+// parseAppleContentIdentifier reads the content identifier from an Apple maker note, or
+// returns "" if it has none
+func parseAppleContentIdentifier(note []byte) string {
+	const ifdStart = len(appleMakerNoteHeader) + 4
+	if !bytes.HasPrefix(note, []byte(appleMakerNoteHeader)) || len(note) < ifdStart+2 {
+		return ""
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if string(note[ifdStart-2:ifdStart]) == "II" {
+		order = binary.LittleEndian
+	}
+	count := int(order.Uint16(note[ifdStart:]))
+	for i := 0; i < count; i++ {
+		entry := ifdStart + 2 + i*12
+		if entry+12 > len(note) {
+			break
+		}
+		if order.Uint16(note[entry:]) != appleContentIdentifierTag {
+			continue
+		}
+		// an ASCII string, stored in the entry itself when it fits
+		if order.Uint16(note[entry+2:]) != 2 {
+			return ""
+		}
+		length := int(order.Uint32(note[entry+4:]))
+		value := note[entry+8 : entry+12]
+		if length > 4 {
+			offset := int(order.Uint32(note[entry+8:]))
+			if offset < 0 || length > len(note) || offset > len(note)-length {
+				return ""
+			}
+			value = note[offset : offset+length]
+		} else {
+			value = value[:length]
+		}
+		return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+	}
+	return ""
+}
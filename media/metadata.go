@@ -1,10 +1,14 @@
 package media
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/jpeg"
 	"log"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/rwcarlsen/goexif/exif"
@@ -60,6 +64,57 @@ func getString(exifData *exif.Exif, tagName exif.FieldName) *string {
 	return &val
 }
 
+// getCopyright returns the copyright holder of the EXIF Copyright tag, or else the Artist.
+// the Copyright tag may hold the photographer's and the editor's copyright, NUL separated,
+// with a single space standing for a missing photographer.
+func getCopyright(exifData *exif.Exif) *string {
+	var parts []string
+	if tag, err := exifData.Get(exif.Copyright); err == nil && tag != nil {
+		if val, err := tag.StringVal(); err == nil {
+			for _, part := range strings.Split(val, "\x00") {
+				if part = strings.TrimSpace(part); part != "" {
+					parts = append(parts, part)
+				}
+			}
+		}
+	}
+	if len(parts) > 0 {
+		copyright := strings.Join(parts, "; ")
+		return &copyright
+	}
+	if tag, err := exifData.Get(exif.Artist); err == nil && tag != nil {
+		if val, err := tag.StringVal(); err == nil {
+			if artist := strings.TrimSpace(strings.Trim(val, "\x00")); artist != "" {
+				return &artist
+			}
+		}
+	}
+	return nil
+}
+
+// getSubSecondMillis returns the milliseconds of the EXIF SubSecTimeOriginal tag, the digits
+// of a decimal fraction of the capture second, or 0 without one
+func getSubSecondMillis(exifData *exif.Exif) int64 {
+	tag, err := exifData.Get(exif.SubSecTimeOriginal)
+	if err != nil || tag == nil {
+		return 0
+	}
+	val, err := tag.StringVal()
+	if err != nil {
+		return 0
+	}
+	digits := strings.TrimSpace(strings.Trim(val, "\x00"))
+	if digits == "" {
+		return 0
+	}
+	digits = (digits + "000")[:3]
+	ms, err := strconv.Atoi(digits)
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return int64(ms)
+}
+
 // helper to get Shutter Speed specifically, formatting it nicely
 func getShutterSpeed(exifData *exif.Exif) *string {
 	tag, err := exifData.Get(exif.ExposureTime)
@@ -87,6 +142,40 @@ func getShutterSpeed(exifData *exif.Exif) *string {
 	}
 }
 
+// helper to get the GPS position. (0, 0) is treated as missing, as some cameras write it
+// when they have no fix.
+func getGPS(exifData *exif.Exif) (lat, lon, alt *float64) {
+	latVal, lonVal, err := exifData.LatLong()
+	if err != nil || math.IsNaN(latVal) || math.IsNaN(lonVal) {
+		return nil, nil, nil
+	}
+	if latVal < -90 || latVal > 90 || lonVal < -180 || lonVal > 180 || (latVal == 0 && lonVal == 0) {
+		return nil, nil, nil
+	}
+	lat, lon = &latVal, &lonVal
+
+	alt = getRational(exifData, exif.GPSAltitude)
+	if alt != nil {
+		// GPSAltitudeRef is a single byte, 1 meaning below sea level
+		if tag, err := exifData.Get(exif.GPSAltitudeRef); err == nil && tag != nil {
+			if ref, err := tag.Int(0); err == nil && ref == 1 {
+				below := -*alt
+				alt = &below
+			}
+		}
+	}
+	return lat, lon, alt
+}
+
+// rawPreviewConfig reports the dimensions of a RAW file's largest embedded preview
+func rawPreviewConfig(filePath string) (image.Config, error) {
+	preview, err := ExtractRawPreview(filePath)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return jpeg.DecodeConfig(bytes.NewReader(preview))
+}
+
 // GetImageMetadata extracts relevant metadata using goexif
 func GetImageMetadata(filePath string) (*Metadata, error) {
 	file, err := os.Open(filePath)
@@ -95,7 +184,14 @@ func GetImageMetadata(filePath string) (*Metadata, error) {
 	}
 	defer file.Close()
 
-	config, format, err := image.DecodeConfig(file)
+	var config image.Config
+	var format string
+	if IsRawImage(filePath) {
+		config, err = rawPreviewConfig(filePath)
+		format = "raw"
+	} else {
+		config, format, err = image.DecodeConfig(file)
+	}
 	var width, height *int
 	if err == nil {
 		w, h := config.Width, config.Height
@@ -112,11 +208,17 @@ func GetImageMetadata(filePath string) (*Metadata, error) {
 	}
 
 	exifData, err := exif.Decode(file)
+	if err == nil && SwapsDimensions(orientationFromExif(exifData)) && width != nil {
+		// stored on its side; report the dimensions of the upright image thumbnails are made of
+		width, height = height, width
+	}
 	if err != nil {
 		// not necessarily a fatal error, the file might just lack EXIF data
 		log.Printf("metadata: No EXIF data found or error decoding EXIF for %s: %v", filePath, err)
 		// return metadata struct with only dimensions if they were found
-		return &Metadata{Width: width, Height: height}, nil
+		meta := &Metadata{Width: width, Height: height, Keywords: ReadKeywords(filePath), Projection: ReadProjection(filePath)}
+		applyXMPSidecar(meta, filePath)
+		return meta, nil
 	}
 
 	meta := &Metadata{
@@ -130,15 +232,43 @@ func GetImageMetadata(filePath string) (*Metadata, error) {
 		LensModel:    getString(exifData, exif.LensModel),
 		CameraMake:   getString(exifData, exif.Make),
 		CameraModel:  getString(exifData, exif.Model),
+		Copyright:    getCopyright(exifData),
+		ContentID:    getContentIdentifier(exifData),
 	}
 
 	dt, err := exifData.DateTime()
 	if err == nil {
 		ts := dt.Unix()
 		meta.TakenAt = &ts
+		ms := ts*1000 + getSubSecondMillis(exifData)
+		meta.TakenAtMs = &ms
 	} else {
 		log.Printf("metadata: Could not read DateTimeOriginal for %s: %v", filePath, err)
 	}
 
+	meta.Latitude, meta.Longitude, meta.Altitude = getGPS(exifData)
+	meta.Keywords = ReadKeywords(filePath)
+	meta.Projection = ReadProjection(filePath)
+	applyXMPSidecar(meta, filePath)
+
 	return meta, nil
 }
+
+// applyXMPSidecar adds the descriptive properties of the image's XMP sidecar to meta. a
+// capture time or copyright there, e.g. one corrected through the API, wins over the camera's.
+func applyXMPSidecar(meta *Metadata, filePath string) {
+	props := ReadXMPSidecar(filePath)
+	meta.Title = props.Title
+	meta.Description = props.Description
+	meta.License = props.License
+	if props.Copyright != nil {
+		meta.Copyright = props.Copyright
+	}
+	if props.TakenAt != nil {
+		if meta.TakenAt == nil || *meta.TakenAt != *props.TakenAt {
+			ms := *props.TakenAt * 1000
+			meta.TakenAtMs = &ms
+		}
+		meta.TakenAt = props.TakenAt
+	}
+}
@@ -0,0 +1,56 @@
+package media
+
+import (
+	"fmt"
+
+	"gocv.io/x/gocv"
+)
+
+// NSFWDetector scores images with an NSFW image classifier exported to ONNX (e.g. open_nsfw,
+// whose outputs are sfw and nsfw). the score of an image is the summed probability of the
+// output classes listed in nsfwClasses.
+type NSFWDetector struct {
+	Net         gocv.Net
+	Enabled     bool
+	nsfwClasses []int
+}
+
+// NewNSFWDetector loads an NSFW classification model. nsfwClasses are the indexes of its
+// output classes that count as NSFW. the returned detector is disabled if the model cannot
+// be loaded.
+func NewNSFWDetector(modelPath string, nsfwClasses []int) *NSFWDetector {
+	net, ok := loadClassifierNet(modelPath, "nsfw")
+	if !ok {
+		return &NSFWDetector{Enabled: false}
+	}
+	return &NSFWDetector{Net: net, Enabled: true, nsfwClasses: nsfwClasses}
+}
+
+// Close releases the network
+func (d *NSFWDetector) Close() {
+	if d != nil && d.Enabled {
+		d.Net.Close()
+		d.Enabled = false
+	}
+}
+
+// Score returns the probability, 0 to 1, that a BGR image is NSFW
+func (d *NSFWDetector) Score(img gocv.Mat) (float32, error) {
+	if d == nil || !d.Enabled {
+		return 0, fmt.Errorf("NSFW detector is not loaded")
+	}
+	scores, err := classifierScores(d.Net, img)
+	if err != nil {
+		return 0, err
+	}
+	probabilities := classProbabilities(scores)
+
+	var score float32
+	for _, class := range d.nsfwClasses {
+		if class < 0 || class >= len(probabilities) {
+			return 0, fmt.Errorf("NSFW class %d is out of range, the model has %d classes", class, len(probabilities))
+		}
+		score += probabilities[class]
+	}
+	return min(score, 1), nil
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	ocrTimeout = 2 * time.Minute
+
+	// longest text kept per image, enough for a slide or a page of a document
+	ocrMaxTextLength = 8000
+)
+
+// OCRTool wraps the tesseract binary used to read visible text from images
+type OCRTool struct {
+	TesseractPath string
+	Languages     string // tesseract language codes joined with '+', e.g. "eng+deu"
+}
+
+// NewOCRTool creates an OCRTool, falling back to the binary on PATH and to English
+func NewOCRTool(tesseractPath, languages string) *OCRTool {
+	if tesseractPath == "" {
+		tesseractPath = "tesseract"
+	}
+	if languages == "" {
+		languages = "eng"
+	}
+	return &OCRTool{TesseractPath: tesseractPath, Languages: languages}
+}
+
+// ExtractText returns the text found in an upright image, e.g. on signs, slides or
+// whiteboards, or "" if there is none
+func (ot *OCRTool) ExtractText(img image.Image) (string, error) {
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return "", fmt.Errorf("failed to encode image for tesseract: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ot.TesseractPath, "stdin", "stdout", "-l", ot.Languages)
+	cmd.Stdin = &input
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return cleanOCRText(stdout.String()), nil
+}
+
+// cleanOCRText collapses the whitespace of each line of tesseract output and drops the lines
+// without a letter or digit, which are mostly noise read from textures and edges
+func cleanOCRText(raw string) string {
+	var lines []string
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if strings.IndexFunc(line, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) < 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+	if len(text) > ocrMaxTextLength {
+		text = strings.ToValidUTF8(text[:ocrMaxTextLength], "")
+	}
+	return text
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"image"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// EXIF orientations, the transform that turns the stored pixels upright
+const (
+	OrientationNormal     = 1
+	OrientationFlipH      = 2
+	OrientationRotate180  = 3
+	OrientationFlipV      = 4
+	OrientationTranspose  = 5
+	OrientationRotate90   = 6 // turned 90 degrees clockwise to display, typical of portrait photos
+	OrientationTransverse = 7
+	OrientationRotate270  = 8
+)
+
+// ReadOrientation returns the EXIF orientation of an image file, OrientationNormal when it
+// has none. RAW files are TIFF containers, so their orientation is read the same way.
+func ReadOrientation(filePath string) int {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return OrientationNormal
+	}
+	defer file.Close()
+
+	exifData, err := exif.Decode(file)
+	if err != nil {
+		return OrientationNormal
+	}
+	return orientationFromExif(exifData)
+}
+
+func orientationFromExif(exifData *exif.Exif) int {
+	tag, err := exifData.Get(exif.Orientation)
+	if err != nil || tag == nil {
+		return OrientationNormal
+	}
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < OrientationNormal || orientation > OrientationRotate270 {
+		return OrientationNormal
+	}
+	return orientation
+}
+
+// SwapsDimensions reports whether an orientation turns the image on its side, so the
+// upright width is the stored height
+func SwapsDimensions(orientation int) bool {
+	return orientation >= OrientationTranspose && orientation <= OrientationRotate270
+}
+
+// ApplyOrientation transforms the stored pixels of an image so it's upright
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case OrientationFlipH:
+		return imaging.FlipH(img)
+	case OrientationRotate180:
+		return imaging.Rotate180(img)
+	case OrientationFlipV:
+		return imaging.FlipV(img)
+	case OrientationTranspose:
+		return imaging.Transpose(img)
+	case OrientationRotate90:
+		return imaging.Rotate270(img) // imaging rotates counter-clockwise
+	case OrientationTransverse:
+		return imaging.Transverse(img)
+	case OrientationRotate270:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
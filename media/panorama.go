@@ -0,0 +1,83 @@
+package media
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"os"
+	"strings"
+)
+
+// xmpGPanoNamespace is the namespace of the Google Photo Sphere properties that 360° cameras,
+// phone panorama modes and stitching software write into the XMP of spherical images
+const xmpGPanoNamespace = "http://ns.google.com/photos/1.0/panorama/"
+
+// ReadProjection returns the GPano:ProjectionType of an image, lowercased, e.g.
+// "equirectangular" for a photosphere, from the XMP packet embedded in the file or else its
+// XMP sidecar. images that aren't panoramas, or whose GPano:UsePanoramaViewer is False, have
+// none.
+func ReadProjection(filePath string) *string {
+	packet, err := readEmbeddedXMP(filePath)
+	if err != nil {
+		log.Printf("metadata: Warning - Could not read the XMP of %s: %v", filePath, err)
+	}
+	projection := parseXMPProjection(packet)
+	if projection == "" {
+		for _, sidecar := range xmpSidecarCandidates(filePath) {
+			if packet, err := os.ReadFile(sidecar); err == nil {
+				projection = parseXMPProjection(packet)
+				break
+			}
+		}
+	}
+	if projection == "" {
+		return nil
+	}
+	return &projection
+}
+
+// parseXMPProjection reads GPano:ProjectionType from an XMP packet, as an attribute of an
+// rdf:Description or an element, or returns "" if it has none or GPano:UsePanoramaViewer is
+// False
+func parseXMPProjection(packet []byte) string {
+	if len(packet) == 0 {
+		return ""
+	}
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var property string // being read
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == xmpGPanoNamespace {
+				property = t.Name.Local
+				text.Reset()
+			} else if t.Name.Space == xmpRDFNamespace && t.Name.Local == "Description" {
+				for _, attr := range t.Attr {
+					if attr.Name.Space == xmpGPanoNamespace {
+						values[attr.Name.Local] = attr.Value
+					}
+				}
+			}
+		case xml.CharData:
+			if property != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if property != "" && t.Name.Space == xmpGPanoNamespace && t.Name.Local == property {
+				values[property] = text.String()
+				property = ""
+			}
+		}
+	}
+
+	if strings.EqualFold(strings.TrimSpace(values["UsePanoramaViewer"]), "false") {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(values["ProjectionType"]))
+}
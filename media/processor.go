@@ -1,6 +1,8 @@
 package media
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/disintegration/imaging"
 	"github.com/google/uuid"
@@ -8,6 +10,10 @@ import (
 	"io"
 	"log"
 	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -17,8 +23,23 @@ const (
 
 	ThumbnailJpegQuality   = 90
 	ThumbnailFileExtension = ".jpg"
+
+	AvatarJpegQuality   = 85
+	AvatarFileExtension = ".jpg"
+	FaceAvatarMargin    = 0.4 // share of the face box added on every side of face avatars
+
+	ResizedJpegQuality   = 85
+	ResizedFileExtension = ".jpg"
+
+	WatermarkJpegQuality   = 92
+	WatermarkMaxSize       = 1024 // longest side overlays are stored at
+	WatermarkFileExtension = ".png"
 )
 
+// AvatarSizes are the square edge lengths every avatar is rendered at, smallest first.
+// the largest one is the path stored on the user.
+var AvatarSizes = []int{64, 256, 512}
+
 // Processor handles media transformations like thumbnailing and resizing. it
 // relies on a Store implementation for saving the results.
 type Processor struct {
@@ -29,14 +50,151 @@ func NewProcessor(store Store) *Processor {
 	return &Processor{store: store}
 }
 
+// ThumbnailOptions selects what GenerateThumbnails produces
+type ThumbnailOptions struct {
+	MaxSize int        // longest side of the thumbnail
+	Sizes   []int      // longest sides of extra sizes, ascending
+	Formats []string   // extra encodings of every size, e.g. config.ThumbnailFormatWebP
+	Encoder *VideoTool // encodes Formats with ffmpeg, required when any are set
+}
+
+// ThumbnailSet is every file generated for the thumbnail of an image
+type ThumbnailSet struct {
+	Path     string         // the JPEG thumbnail
+	Sizes    map[int]string // JPEG of each extra size by longest side
+	Formats  []string       // encodings stored next to every JPEG, see ThumbnailFormatPath
+	Blurhash string         // placeholder for the thumbnail, empty if it couldn't be computed
+}
+
+// jpegPaths returns the thumbnail and every extra size
+func (s *ThumbnailSet) jpegPaths() []string {
+	paths := []string{s.Path}
+	for _, sizePath := range s.Sizes {
+		paths = append(paths, sizePath)
+	}
+	return paths
+}
+
+// ThumbnailFormatPath returns where the given encoding of a JPEG thumbnail is stored:
+// the same name with the format as extension
+func ThumbnailFormatPath(jpegPath, format string) string {
+	return strings.TrimSuffix(jpegPath, ThumbnailFileExtension) + "." + format
+}
+
 // GenerateThumbnail creates a thumbnail where the longest side matches maxSize.
 // saves the result using the Store. returns relative path to saved thumb or error.
 func (p *Processor) GenerateThumbnail(originalImg image.Image, originalRelPath string, maxSize int) (string, error) {
+	set, err := p.GenerateThumbnails(originalImg, originalRelPath, ThumbnailOptions{MaxSize: maxSize})
+	if err != nil {
+		return "", err
+	}
+	return set.Path, nil
+}
+
+// renderedThumbnail is a scaled image waiting to be saved under name plus an extension
+type renderedThumbnail struct {
+	img  image.Image
+	name string
+	size int // 0 for the thumbnail itself
+}
+
+// GenerateThumbnails creates the thumbnail like GenerateThumbnail, plus one image for each
+// of opts.Sizes that is smaller than the original, saved as "<uuid>_<size>.jpg" next to
+// it. every image is also stored in each of opts.Formats; a format that fails to encode is
+// logged and left out, since the JPEGs still cover every client.
+func (p *Processor) GenerateThumbnails(originalImg image.Image, originalRelPath string, opts ThumbnailOptions) (*ThumbnailSet, error) {
+	thumb, err := scaleThumbnail(originalImg, opts.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	thumbUUID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID for thumbnail: %w", err)
+	}
+	base := thumbUUID.String()
+	rendered := []renderedThumbnail{{img: thumb, name: base}}
+
+	bounds := originalImg.Bounds()
+	longest := max(bounds.Dx(), bounds.Dy())
+	// largest first, so each size is scaled down from the previous one instead of the original
+	source := originalImg
+	for i := len(opts.Sizes) - 1; i >= 0; i-- {
+		size := opts.Sizes[i]
+		if size >= longest {
+			continue // never upscale
+		}
+		resized := imaging.Fit(source, size, size, imaging.Lanczos)
+		rendered = append(rendered, renderedThumbnail{img: resized, name: base + "_" + strconv.Itoa(size), size: size})
+		source = resized
+	}
+
+	set := &ThumbnailSet{}
+	for _, r := range rendered {
+		savedRelPath, err := p.saveJPEGThumbnail(r.img, r.name+ThumbnailFileExtension)
+		if err != nil {
+			if set.Path != "" {
+				p.deleteAll(set.jpegPaths())
+			}
+			return nil, err
+		}
+		if r.size == 0 {
+			set.Path = savedRelPath
+			continue
+		}
+		if set.Sizes == nil {
+			set.Sizes = make(map[int]string)
+		}
+		set.Sizes[r.size] = savedRelPath
+	}
+
+	// computed from the thumbnail, which is already close to the sample size
+	if hash, err := Blurhash(thumb); err != nil {
+		log.Printf("processor: Failed to compute blurhash for %s: %v", originalRelPath, err)
+	} else {
+		set.Blurhash = hash
+	}
+
+	for _, format := range opts.Formats {
+		if saved, err := p.saveThumbnailFormat(rendered, format, opts.Encoder); err != nil {
+			log.Printf("processor: Skipping %s thumbnails for %s: %v", format, originalRelPath, err)
+			p.deleteAll(saved)
+		} else {
+			set.Formats = append(set.Formats, format)
+		}
+	}
+
+	log.Printf("processor: Generated and saved thumbnail for %s at %s (%d extra size(s), formats: %v)", originalRelPath, set.Path, len(set.Sizes), set.Formats)
+	return set, nil
+}
+
+// saveThumbnailFormat encodes and saves every rendered image in format. returns what was
+// saved, so a failure part way can be cleaned up.
+func (p *Processor) saveThumbnailFormat(rendered []renderedThumbnail, format string, encoder *VideoTool) ([]string, error) {
+	if encoder == nil {
+		return nil, fmt.Errorf("no encoder available")
+	}
+	var saved []string
+	for _, r := range rendered {
+		data, err := encoder.EncodeImage(r.img, format)
+		if err != nil {
+			return saved, err
+		}
+		savedRelPath, err := p.store.Save(AssetTypeThumbnail, "", r.name+"."+format, bytes.NewReader(data))
+		if err != nil {
+			return saved, fmt.Errorf("failed to save thumbnail via store: %w", err)
+		}
+		saved = append(saved, savedRelPath)
+	}
+	return saved, nil
+}
+
+// scaleThumbnail scales an image so its longest side is at most maxSize
+func scaleThumbnail(originalImg image.Image, maxSize int) (image.Image, error) {
 	origBounds := originalImg.Bounds()
 	origWidth := origBounds.Dx()
 	origHeight := origBounds.Dy()
 	if origWidth <= 0 || origHeight <= 0 {
-		return "", fmt.Errorf("invalid original image dimensions: %dx%d", origWidth, origHeight)
+		return nil, fmt.Errorf("invalid original image dimensions: %dx%d", origWidth, origHeight)
 	}
 
 	var newWidth, newHeight int
@@ -58,8 +216,12 @@ func (p *Processor) GenerateThumbnail(originalImg image.Image, originalRelPath s
 	newWidth = maxInt(1, newWidth)
 	newHeight = maxInt(1, newHeight)
 
-	thumb := imaging.Resize(originalImg, newWidth, newHeight, imaging.Lanczos)
+	return imaging.Resize(originalImg, newWidth, newHeight, imaging.Lanczos), nil
+}
 
+// saveJPEGThumbnail encodes a thumbnail as JPEG and saves it as targetFilename. returns
+// relative path to saved thumb or error.
+func (p *Processor) saveJPEGThumbnail(thumb image.Image, targetFilename string) (string, error) {
 	reader, writer := io.Pipe()
 
 	go func() {
@@ -71,32 +233,84 @@ func (p *Processor) GenerateThumbnail(originalImg image.Image, originalRelPath s
 		}
 	}()
 
-	thumbUUID, err := uuid.NewRandom()
-	if err != nil {
-		reader.Close()
-		return "", fmt.Errorf("failed to generate UUID for thumbnail: %w", err)
-	}
-	targetFilename := thumbUUID.String() + ThumbnailFileExtension
-
 	savedRelPath, err := p.store.Save(AssetTypeThumbnail, "", targetFilename, reader)
 	// reader is automatically closed by io.Copy inside Save, or by the encoding goroutine on error
 
 	if err != nil {
 		return "", fmt.Errorf("failed to save thumbnail via store: %w", err)
 	}
+	return savedRelPath, nil
+}
+
+// SaveVideoRendition stores a transcoded video file. returns the relative path to the saved rendition
+func (p *Processor) SaveVideoRendition(renditionFile io.Reader, originalRelPath string) (string, error) {
+	renditionUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID for video rendition: %w", err)
+	}
+	targetFilename := renditionUUID.String() + VideoRenditionExtension
+
+	savedRelPath, err := p.store.Save(AssetTypeVideo, "", targetFilename, renditionFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to save video rendition via store: %w", err)
+	}
 
-	log.Printf("processor: Generated and saved thumbnail for %s at %s", originalRelPath, savedRelPath)
+	log.Printf("processor: Saved video rendition for %s at %s", originalRelPath, savedRelPath)
 	return savedRelPath, nil
 }
 
+// SaveVideoStream stores the playlists and segments PackageHLS wrote to dir in a directory
+// of their own. returns the relative paths of the saved files.
+func (p *Processor) SaveVideoStream(dir string, originalRelPath string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HLS stream files: %w", err)
+	}
+	streamUUID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID for video stream: %w", err)
+	}
+
+	var saved []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		relPath, err := p.saveFile(AssetTypeStream, streamUUID.String(), filepath.Join(dir, entry.Name()))
+		if err != nil {
+			p.deleteAll(saved)
+			return nil, fmt.Errorf("failed to save video stream file via store: %w", err)
+		}
+		saved = append(saved, relPath)
+	}
+
+	log.Printf("processor: Saved video stream of %s (%d files)", originalRelPath, len(saved))
+	return saved, nil
+}
+
+// saveFile stores a local file under its own name
+func (p *Processor) saveFile(assetType AssetType, relativeDir, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return p.store.Save(assetType, relativeDir, filepath.Base(filePath), file)
+}
+
 // ProcessBanner resizes an uploaded banner and saves it returns the relative
 // path to saved banner or error
 func (p *Processor) ProcessBanner(fileData io.Reader) (string, error) {
-	img, format, err := image.Decode(fileData)
+	data, err := io.ReadAll(fileData)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded banner image: %w", err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return "", fmt.Errorf("failed to decode uploaded banner image: %w", err)
 	}
 	log.Printf("processor: Decoded uploaded banner (format: %s)", format)
+	img = ConvertToSRGB(img, readICCProfile(bufio.NewReader(bytes.NewReader(data))))
 
 	processedImg := imaging.Resize(img, BannerTargetWidth, 0, imaging.Lanczos)
 
@@ -125,3 +339,140 @@ func (p *Processor) ProcessBanner(fileData io.Reader) (string, error) {
 	log.Printf("processor: Processed and saved banner to %s", savedRelPath)
 	return savedRelPath, nil
 }
+
+// ProcessWatermark saves an uploaded watermark overlay as PNG, keeping its transparency,
+// scaled down to WatermarkMaxSize. returns the relative path of the saved overlay.
+func (p *Processor) ProcessWatermark(fileData io.Reader) (string, error) {
+	img, format, err := image.Decode(fileData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode uploaded watermark image: %w", err)
+	}
+	log.Printf("processor: Decoded uploaded watermark (format: %s)", format)
+	if bounds := img.Bounds(); max(bounds.Dx(), bounds.Dy()) > WatermarkMaxSize {
+		img = imaging.Fit(img, WatermarkMaxSize, WatermarkMaxSize, imaging.Lanczos)
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.PNG); err != nil {
+		return "", fmt.Errorf("failed to encode watermark: %w", err)
+	}
+	watermarkUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID for watermark: %w", err)
+	}
+	savedRelPath, err := p.store.Save(AssetTypeWatermark, "", watermarkUUID.String()+WatermarkFileExtension, &buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to save watermark via store: %w", err)
+	}
+	log.Printf("processor: Processed and saved watermark to %s", savedRelPath)
+	return savedRelPath, nil
+}
+
+// LoadWatermark reads a watermark overlay saved by ProcessWatermark
+func (p *Processor) LoadWatermark(relativePath string) (image.Image, error) {
+	reader, _, err := p.store.Get(relativePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watermark %s: %w", relativePath, err)
+	}
+	defer reader.Close()
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode watermark %s: %w", relativePath, err)
+	}
+	return img, nil
+}
+
+// ProcessAvatar center crops an uploaded avatar to a square and saves it once for each of
+// AvatarSizes as "<uuid>_<size>.jpg". returns the relative path of the largest size, from
+// which AvatarSizePath derives the others.
+func (p *Processor) ProcessAvatar(fileData io.Reader) (string, error) {
+	img, format, err := image.Decode(fileData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode uploaded avatar image: %w", err)
+	}
+	log.Printf("processor: Decoded uploaded avatar (format: %s)", format)
+	return p.saveAvatar(img)
+}
+
+// ProcessFaceAvatar saves a square crop around a face, given as a box on the upright image,
+// in the same sizes as ProcessAvatar. the box is widened by FaceAvatarMargin on every side to
+// include the hair and chin; near the edges of the image the square is moved inwards rather
+// than cut off. returns the relative path of the largest size.
+func (p *Processor) ProcessFaceAvatar(img image.Image, face image.Rectangle) (string, error) {
+	bounds := img.Bounds()
+	face = face.Canon()
+	if face.Intersect(bounds).Empty() {
+		return "", fmt.Errorf("face box %v lies outside the image %v", face, bounds)
+	}
+	side := int(float64(max(face.Dx(), face.Dy())) * (1 + 2*FaceAvatarMargin))
+	side = max(min(side, bounds.Dx(), bounds.Dy()), 1)
+	clamp := func(v, lo, hi int) int { return max(lo, min(v, hi)) }
+	x := clamp((face.Min.X+face.Max.X-side)/2, bounds.Min.X, bounds.Max.X-side)
+	y := clamp((face.Min.Y+face.Max.Y-side)/2, bounds.Min.Y, bounds.Max.Y-side)
+	crop := imaging.Crop(img, image.Rect(x, y, x+side, y+side))
+	return p.saveAvatar(crop)
+}
+
+// saveAvatar center crops an image to a square and saves it once for each of AvatarSizes
+func (p *Processor) saveAvatar(img image.Image) (string, error) {
+	avatarUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID for avatar: %w", err)
+	}
+
+	var saved []string
+	for _, size := range AvatarSizes {
+		// never upscale, small uploads are kept at their own resolution
+		edge := size
+		bounds := img.Bounds()
+		if shortest := min(bounds.Dx(), bounds.Dy()); shortest < edge {
+			edge = shortest
+		}
+		processedImg := imaging.Fill(img, edge, edge, imaging.Center, imaging.Lanczos)
+
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, processedImg, imaging.JPEG, imaging.JPEGQuality(AvatarJpegQuality)); err != nil {
+			p.deleteAll(saved)
+			return "", fmt.Errorf("avatar encoding failed: %w", err)
+		}
+
+		targetFilename := avatarUUID.String() + "_" + strconv.Itoa(size) + AvatarFileExtension
+		savedRelPath, err := p.store.Save(AssetTypeAvatar, "", targetFilename, &buf)
+		if err != nil {
+			p.deleteAll(saved)
+			return "", fmt.Errorf("failed to save avatar via store: %w", err)
+		}
+		saved = append(saved, savedRelPath)
+	}
+
+	largest := saved[len(saved)-1]
+	log.Printf("processor: Processed and saved avatar to %s", largest)
+	return largest, nil
+}
+
+// AvatarSizePath returns the path of another size of the avatar stored at avatarPath
+func AvatarSizePath(avatarPath string, size int) string {
+	largestSuffix := "_" + strconv.Itoa(AvatarSizes[len(AvatarSizes)-1]) + AvatarFileExtension
+	base := strings.TrimSuffix(avatarPath, largestSuffix)
+	return base + "_" + strconv.Itoa(size) + AvatarFileExtension
+}
+
+// DeleteAvatar removes every size of the avatar stored at avatarPath
+func (p *Processor) DeleteAvatar(avatarPath string) error {
+	var firstErr error
+	for _, size := range AvatarSizes {
+		if err := p.store.Delete(AvatarSizePath(avatarPath, size)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// deleteAll removes already saved files after a later step failed
+func (p *Processor) deleteAll(relPaths []string) {
+	for _, relPath := range relPaths {
+		if err := p.store.Delete(relPath); err != nil {
+			log.Printf("processor: Failed to clean up %s: %v", relPath, err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RAW formats handled here are all TIFF containers that embed one or more
+// baseline JPEG previews next to the sensor data
+var supportedRawExtensions = map[string]bool{
+	".cr2": true, ".nef": true, ".arw": true, ".dng": true,
+}
+
+// TIFF tags used to locate embedded previews
+const (
+	tiffTagCompression       = 0x0103
+	tiffTagStripOffsets      = 0x0111
+	tiffTagStripByteCounts   = 0x0117
+	tiffTagSubIFDs           = 0x014A
+	tiffTagJPEGOffset        = 0x0201
+	tiffTagJPEGLength        = 0x0202
+	tiffTagExifIFD           = 0x8769
+	tiffCompressionOldJPEG   = 6
+	tiffCompressionJPEG      = 7
+	tiffMaxIFDs              = 64 // guards against IFD loops in corrupt files
+	tiffMaxEntriesPerIFD     = 1024
+	rawMaxPreviewSizeBytes   = 64 << 20
+	rawPreviewTempFilePrefix = "mediasys-raw-preview-*"
+)
+
+// ErrNoRawPreview is returned when a RAW file has no decodable embedded JPEG
+var ErrNoRawPreview = errors.New("no embedded JPEG preview found")
+
+// IsRawImage checks if the filename has a supported camera RAW extension
+func IsRawImage(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return supportedRawExtensions[ext]
+}
+
+type rawPreviewCandidate struct {
+	offset int64
+	length int64
+}
+
+// ExtractRawPreview returns the largest baseline JPEG preview embedded in a RAW file
+func ExtractRawPreview(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("raw: failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("raw: failed to stat file %s: %w", filePath, err)
+	}
+
+	candidates, err := findRawPreviewCandidates(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("raw: failed to parse %s: %w", filePath, err)
+	}
+
+	var best []byte
+	bestArea := 0
+	for _, c := range candidates {
+		if c.length <= 0 || c.length > rawMaxPreviewSizeBytes || c.offset+c.length > info.Size() {
+			continue
+		}
+		buf := make([]byte, c.length)
+		if _, err := file.ReadAt(buf, c.offset); err != nil {
+			continue
+		}
+		if len(buf) < 2 || buf[0] != 0xFF || buf[1] != 0xD8 {
+			continue
+		}
+		// lossless JPEG sensor data also starts with SOI; the stdlib decoder rejects it, which is what we want
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(buf))
+		if err != nil {
+			continue
+		}
+		if area := cfg.Width * cfg.Height; area > bestArea {
+			best, bestArea = buf, area
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("raw: %s: %w", filePath, ErrNoRawPreview)
+	}
+	return best, nil
+}
+
+// DecodeRawPreview extracts and decodes the largest embedded preview of a RAW file
+func DecodeRawPreview(filePath string) (image.Image, error) {
+	preview, err := ExtractRawPreview(filePath)
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(preview))
+	if err != nil {
+		return nil, fmt.Errorf("raw: failed to decode preview of %s: %w", filePath, err)
+	}
+	return ConvertToSRGB(img, readICCProfile(bufio.NewReader(bytes.NewReader(preview)))), nil
+}
+
+// WriteRawPreviewToTemp writes the embedded preview to a temporary JPEG file for
+// consumers that need a path (e.g., OpenCV). the caller must remove the file.
+// the RAW file's orientation is applied to the pixels, as previews rarely carry their own.
+func WriteRawPreviewToTemp(filePath string) (string, error) {
+	preview, err := ExtractRawPreview(filePath)
+	if err != nil {
+		return "", err
+	}
+	if orientation := ReadOrientation(filePath); orientation != OrientationNormal {
+		img, err := jpeg.Decode(bytes.NewReader(preview))
+		if err != nil {
+			return "", fmt.Errorf("raw: failed to decode preview of %s: %w", filePath, err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, ApplyOrientation(img, orientation), &jpeg.Options{Quality: ThumbnailJpegQuality}); err != nil {
+			return "", fmt.Errorf("raw: failed to encode rotated preview of %s: %w", filePath, err)
+		}
+		preview = buf.Bytes()
+	}
+	tmpFile, err := os.CreateTemp("", rawPreviewTempFilePrefix+".jpg")
+	if err != nil {
+		return "", fmt.Errorf("raw: failed to create temp file: %w", err)
+	}
+	if _, err := tmpFile.Write(preview); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("raw: failed to write preview to temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("raw: failed to close temp file: %w", err)
+	}
+	return tmpFile.Name(), nil
+}
+
+// DecodeImageFile decodes an image from disk, using the embedded preview for RAW files.
+// the image is converted to sRGB and turned upright according to its EXIF orientation;
+// the file itself is never changed.
+func DecodeImageFile(filePath string) (image.Image, string, error) {
+	if IsRawImage(filePath) {
+		img, err := DecodeRawPreview(filePath)
+		if err != nil {
+			return nil, "", err
+		}
+		return ApplyOrientation(img, ReadOrientation(filePath)), "raw", nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open original file: %w", err)
+	}
+	defer file.Close()
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return nil, "", err
+	}
+	img = ConvertToSRGB(img, ReadICCProfile(filePath))
+	return ApplyOrientation(img, ReadOrientation(filePath)), format, nil
+}
+
+// findRawPreviewCandidates walks every IFD (including SubIFDs and the EXIF IFD)
+// and collects byte ranges that may hold a JPEG preview
+func findRawPreviewCandidates(r io.ReaderAt, size int64) ([]rawPreviewCandidate, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF-based RAW file")
+	}
+
+	queue := []int64{int64(order.Uint32(header[4:8]))}
+	visited := make(map[int64]bool)
+	var candidates []rawPreviewCandidate
+
+	for len(queue) > 0 && len(visited) < tiffMaxIFDs {
+		ifdOffset := queue[0]
+		queue = queue[1:]
+		if ifdOffset <= 0 || ifdOffset+2 > size || visited[ifdOffset] {
+			continue
+		}
+		visited[ifdOffset] = true
+
+		countBuf := make([]byte, 2)
+		if _, err := r.ReadAt(countBuf, ifdOffset); err != nil {
+			continue
+		}
+		numEntries := int64(order.Uint16(countBuf))
+		if numEntries == 0 || numEntries > tiffMaxEntriesPerIFD {
+			continue
+		}
+
+		entries := make([]byte, numEntries*12+4)
+		if _, err := r.ReadAt(entries, ifdOffset+2); err != nil {
+			continue
+		}
+
+		var compression uint32
+		var jpegOffset, jpegLength int64
+		var stripOffsets, stripCounts []uint32
+
+		for i := int64(0); i < numEntries; i++ {
+			entry := entries[i*12 : i*12+12]
+			tag := order.Uint16(entry[0:2])
+			fieldType := order.Uint16(entry[2:4])
+			count := order.Uint32(entry[4:8])
+
+			switch tag {
+			case tiffTagCompression:
+				compression = readTIFFValues(r, order, entry, fieldType, count)[0]
+			case tiffTagJPEGOffset:
+				jpegOffset = int64(readTIFFValues(r, order, entry, fieldType, 1)[0])
+			case tiffTagJPEGLength:
+				jpegLength = int64(readTIFFValues(r, order, entry, fieldType, 1)[0])
+			case tiffTagStripOffsets:
+				stripOffsets = readTIFFValues(r, order, entry, fieldType, count)
+			case tiffTagStripByteCounts:
+				stripCounts = readTIFFValues(r, order, entry, fieldType, count)
+			case tiffTagSubIFDs:
+				for _, off := range readTIFFValues(r, order, entry, fieldType, count) {
+					queue = append(queue, int64(off))
+				}
+			case tiffTagExifIFD:
+				queue = append(queue, int64(readTIFFValues(r, order, entry, fieldType, 1)[0]))
+			}
+		}
+
+		if jpegOffset > 0 && jpegLength > 0 {
+			candidates = append(candidates, rawPreviewCandidate{offset: jpegOffset, length: jpegLength})
+		}
+		// a single JPEG-compressed strip is how CR2 (IFD0) and DNG previews are stored
+		if (compression == tiffCompressionOldJPEG || compression == tiffCompressionJPEG) &&
+			len(stripOffsets) == 1 && len(stripCounts) == 1 {
+			candidates = append(candidates, rawPreviewCandidate{offset: int64(stripOffsets[0]), length: int64(stripCounts[0])})
+		}
+
+		nextIFD := int64(order.Uint32(entries[numEntries*12:]))
+		queue = append(queue, nextIFD)
+	}
+
+	return candidates, nil
+}
+
+// readTIFFValues reads SHORT/LONG values of an IFD entry, following the value
+// offset when the data does not fit inline. always returns at least one value.
+func readTIFFValues(r io.ReaderAt, order binary.ByteOrder, entry []byte, fieldType uint16, count uint32) []uint32 {
+	const (
+		typeShort = 3
+		typeLong  = 4
+		typeIFD   = 13
+	)
+
+	var elemSize uint32
+	switch fieldType {
+	case typeShort:
+		elemSize = 2
+	case typeLong, typeIFD:
+		elemSize = 4
+	default:
+		return []uint32{0}
+	}
+	if count == 0 || count > tiffMaxEntriesPerIFD {
+		return []uint32{0}
+	}
+
+	data := entry[8:12]
+	if total := elemSize * count; total > 4 {
+		data = make([]byte, total)
+		if _, err := r.ReadAt(data, int64(order.Uint32(entry[8:12]))); err != nil {
+			return []uint32{0}
+		}
+	}
+
+	values := make([]uint32, count)
+	for i := uint32(0); i < count; i++ {
+		if elemSize == 2 {
+			values[i] = uint32(order.Uint16(data[i*2:]))
+		} else {
+			values[i] = order.Uint32(data[i*4:])
+		}
+	}
+	return values
+}
@@ -0,0 +1,51 @@
+package media
+
+import (
+	"image"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// how ResizeImage fits an image into the requested box
+const (
+	ResizeFitContain = "contain" // keep the whole image, at most the requested size
+	ResizeFitCover   = "cover"   // fill the whole box, cropping the overflow around the center
+)
+
+// ResizeImage scales img for a box of width x height, either of which may be 0 to follow
+// the aspect ratio. images are never upscaled; a box larger than the image is shrunk by the
+// same factor first, so cover still returns the requested proportions.
+func ResizeImage(img image.Image, width, height int, fit string) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || height <= 0 || fit != ResizeFitCover {
+		if width <= 0 {
+			width = bounds.Dx()
+		}
+		if height <= 0 {
+			height = bounds.Dy()
+		}
+		if width >= bounds.Dx() && height >= bounds.Dy() {
+			return img
+		}
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+
+	if width > bounds.Dx() || height > bounds.Dy() {
+		scale := min(float64(bounds.Dx())/float64(width), float64(bounds.Dy())/float64(height))
+		width = max(1, int(float64(width)*scale))
+		height = max(1, int(float64(height)*scale))
+	}
+	return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+}
+
+// EncodeResizedJPEG writes a resized image as JPEG
+func EncodeResizedJPEG(w io.Writer, img image.Image) error {
+	return EncodeJPEG(w, img, ResizedJpegQuality)
+}
+
+// EncodeJPEG writes an image as JPEG at the given quality. no metadata is written, so
+// re-encoded originals lose their EXIF data.
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	return imaging.Encode(w, img, imaging.JPEG, imaging.JPEGQuality(quality))
+}
@@ -0,0 +1,437 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3Service          = "s3"
+	s3AmzDateFormat    = "20060102T150405Z"
+	s3ShortDateFormat  = "20060102"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// presigned URLs are limited to 7 days by SigV4
+	s3MaxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config holds connection settings for an S3-compatible object store
+type S3Config struct {
+	Endpoint        string // scheme and host, e.g. https://s3.us-east-1.amazonaws.com
+	Region          string
+	Bucket          string
+	Prefix          string // optional key prefix applied to every object
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool // address the bucket as /bucket/key instead of bucket.host/key
+}
+
+// S3Storage implements the Store interface on top of an S3-compatible object
+// store (AWS S3, MinIO, R2, ...). requests are signed with AWS Signature V4.
+type S3Storage struct {
+	cfg       S3Config
+	endpoint  *url.URL
+	subDirMap map[AssetType]string // maps AssetType to key "directory" (e.g., "thumbnails")
+	client    *http.Client
+}
+
+// NewS3Storage creates a new object storage backed store
+func NewS3Storage(cfg S3Config, subDirs map[AssetType]string) (*S3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket name cannot be empty")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint '%s'", cfg.Endpoint)
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+
+	if subDirs == nil {
+		subDirs = make(map[AssetType]string)
+	}
+
+	log.Printf("media.store: Initialized S3Storage for bucket '%s' at %s (prefix: '%s')", cfg.Bucket, endpoint.String(), cfg.Prefix)
+	return &S3Storage{
+		cfg:       cfg,
+		endpoint:  endpoint,
+		subDirMap: subDirs,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// EnsureDir is a no-op for object storage; it returns the key prefix used for the asset type
+func (s *S3Storage) EnsureDir(assetType AssetType) (string, error) {
+	return s.assetTypeDir(assetType), nil
+}
+
+// assetTypeDir resolves the relative "directory" for an asset type
+func (s *S3Storage) assetTypeDir(assetType AssetType) string {
+	if dir, ok := s.subDirMap[assetType]; ok && dir != "" {
+		return dir
+	}
+	return string(assetType)
+}
+
+// Save uploads data to the bucket. the returned relative path has the same shape as
+// LocalStorage paths (e.g., "thumbnails/<uuid>.jpg") so database values stay portable.
+func (s *S3Storage) Save(assetType AssetType, relativeDirHint string, filenameHint string, data io.Reader) (string, error) {
+	if filenameHint == "" {
+		return "", fmt.Errorf("filename hint cannot be empty for S3Storage.Save")
+	}
+	if strings.Contains(relativeDirHint, "..") || strings.Contains(filenameHint, "..") {
+		return "", fmt.Errorf("invalid relative directory hint '%s'", relativeDirHint)
+	}
+
+	relativePath := path.Join(s.assetTypeDir(assetType), relativeDirHint, filenameHint)
+	cleanRelativePath, err := cleanObjectPath(relativePath)
+	if err != nil {
+		return "", err
+	}
+
+	// S3 needs the content length and payload hash up front, so spool the reader to a temp file
+	tmpFile, err := os.CreateTemp("", "mediasys-s3-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for upload: %w", err)
+	}
+	defer func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hasher), data)
+	if err != nil {
+		return "", fmt.Errorf("failed to buffer data for '%s': %w", cleanRelativePath, err)
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind temp file for '%s': %w", cleanRelativePath, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(cleanRelativePath).String(), io.NopCloser(tmpFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to build upload request for '%s': %w", cleanRelativePath, err)
+	}
+	req.ContentLength = size
+	if contentType := contentTypeForKey(cleanRelativePath); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, hex.EncodeToString(hasher.Sum(nil)), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload '%s': %w", cleanRelativePath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to upload '%s': %s", cleanRelativePath, readS3Error(resp))
+	}
+
+	log.Printf("media.store: Uploaded asset to s3://%s/%s", s.cfg.Bucket, s.objectKey(cleanRelativePath))
+	return cleanRelativePath, nil
+}
+
+// Get retrieves a reader for an object
+func (s *S3Storage) Get(relativePath string) (io.ReadCloser, os.FileInfo, error) {
+	cleanRelativePath, err := cleanObjectPath(relativePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(cleanRelativePath).String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request for '%s': %w", relativePath, err)
+	}
+	s.signRequest(req, s3EmptyPayloadHash, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch asset '%s': %w", relativePath, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("asset not found at '%s': %w", relativePath, os.ErrNotExist)
+	default:
+		defer resp.Body.Close()
+		return nil, nil, fmt.Errorf("failed to fetch asset '%s': %s", relativePath, readS3Error(resp))
+	}
+
+	info := &objectInfo{
+		name: path.Base(cleanRelativePath),
+		size: resp.ContentLength,
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = lastModified
+	}
+
+	return resp.Body, info, nil
+}
+
+// Delete removes an object. deleting a missing object is treated as success
+func (s *S3Storage) Delete(relativePath string) error {
+	cleanRelativePath, err := cleanObjectPath(relativePath)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(cleanRelativePath).String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build delete request for '%s': %w", relativePath, err)
+	}
+	s.signRequest(req, s3EmptyPayloadHash, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete asset '%s': %w", relativePath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete asset '%s': %s", relativePath, readS3Error(resp))
+	}
+
+	log.Printf("media.store: Deleted asset s3://%s/%s", s.cfg.Bucket, s.objectKey(cleanRelativePath))
+	return nil
+}
+
+// GetFullPath is not supported for object storage, assets have no filesystem path
+func (s *S3Storage) GetFullPath(relativePath string) (string, error) {
+	return "", fmt.Errorf("%w: '%s' is stored in bucket '%s'", ErrNoLocalPath, relativePath, s.cfg.Bucket)
+}
+
+// PresignGet returns a time-limited URL that allows anonymous GET access to an object
+func (s *S3Storage) PresignGet(relativePath string, expiry time.Duration) (string, error) {
+	return s.presignGet(relativePath, expiry, time.Now().UTC())
+}
+
+// presignGet signs the URL of PresignGet as of now
+func (s *S3Storage) presignGet(relativePath string, expiry time.Duration, now time.Time) (string, error) {
+	cleanRelativePath, err := cleanObjectPath(relativePath)
+	if err != nil {
+		return "", err
+	}
+	if expiry <= 0 || expiry > s3MaxPresignExpiry {
+		return "", fmt.Errorf("invalid presign expiry %s: must be between 1s and %s", expiry, s3MaxPresignExpiry)
+	}
+
+	amzDate := now.Format(s3AmzDateFormat)
+	scope := s.credentialScope(now)
+
+	u := s.objectURL(cleanRelativePath)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	signature := s.signature(now, canonicalRequest)
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// objectKey returns the full bucket key for a relative asset path
+func (s *S3Storage) objectKey(relativePath string) string {
+	if s.cfg.Prefix == "" {
+		return relativePath
+	}
+	return s.cfg.Prefix + "/" + relativePath
+}
+
+// objectURL builds the request URL for a relative asset path, honoring path-style addressing
+func (s *S3Storage) objectURL(relativePath string) *url.URL {
+	u := *s.endpoint
+	key := s.objectKey(relativePath)
+	if s.cfg.UsePathStyle {
+		u.Path = u.Path + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+// signRequest adds SigV4 authorization headers to a request
+func (s *S3Storage) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(s3AmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaderNames := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headerValues := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signedHeaderNames = append(signedHeaderNames, "content-type")
+		headerValues["content-type"] = contentType
+		sort.Strings(signedHeaderNames)
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaderNames {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headerValues[name]) + "\n")
+	}
+	signedHeaders := strings.Join(signedHeaderNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	signature := s.signature(now, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKeyID, s.credentialScope(now), signedHeaders, signature))
+}
+
+func (s *S3Storage) credentialScope(now time.Time) string {
+	return strings.Join([]string{now.Format(s3ShortDateFormat), s.cfg.Region, s3Service, "aws4_request"}, "/")
+}
+
+// signature derives the SigV4 signing key and signs the canonical request
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3AmzDateFormat),
+		s.credentialScope(now),
+		hex.EncodeToString(hashedRequest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), now.Format(s3ShortDateFormat))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString encodes query parameters as required by SigV4 (sorted, %20 for spaces)
+func canonicalQueryString(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), values[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath URI-encodes every path segment, keeping the slashes
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// cleanObjectPath normalizes a relative asset path and rejects traversal attempts
+func cleanObjectPath(relativePath string) (string, error) {
+	slashPath := strings.ReplaceAll(relativePath, "\\", "/")
+	cleaned := strings.TrimPrefix(path.Clean("/"+slashPath), "/")
+	if cleaned == "" || cleaned == "." || strings.Contains(slashPath, "..") {
+		return "", fmt.Errorf("invalid path: access denied for '%s'", relativePath)
+	}
+	return cleaned, nil
+}
+
+// contentTypeForKey picks a Content-Type for the stored object so presigned URLs render inline
+func contentTypeForKey(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".avif":
+		return "image/avif"
+	case ".zip":
+		return "application/zip"
+	}
+	return ""
+}
+
+// readS3Error extracts a short description from an S3 error response
+func readS3Error(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return resp.Status
+	}
+	return fmt.Sprintf("%s: %s", resp.Status, msg)
+}
+
+// objectInfo implements os.FileInfo for objects fetched from S3
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (oi *objectInfo) Name() string       { return oi.name }
+func (oi *objectInfo) Size() int64        { return oi.size }
+func (oi *objectInfo) Mode() os.FileMode  { return 0444 }
+func (oi *objectInfo) ModTime() time.Time { return oi.modTime }
+func (oi *objectInfo) IsDir() bool        { return false }
+func (oi *objectInfo) Sys() interface{}   { return nil }
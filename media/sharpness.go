@@ -0,0 +1,43 @@
+package media
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// sharpnessSampleSize is the longest side images are scored at. frames of a burst share a
+// size, so their scores stay comparable, and shrinking keeps the scoring cheap
+const sharpnessSampleSize = 1024
+
+// Sharpness scores how sharp an image is: the variance of the Laplacian of its luminance.
+// blurred and shaken frames score lower than sharp ones of the same scene; scores of
+// different scenes are not comparable.
+func Sharpness(img image.Image) (float64, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() < 3 || bounds.Dy() < 3 {
+		return 0, fmt.Errorf("image too small to score: %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	gray := imaging.Grayscale(imaging.Fit(img, sharpnessSampleSize, sharpnessSampleSize, imaging.Box))
+	width, height := gray.Bounds().Dx(), gray.Bounds().Dy()
+	luma := func(x, y int) float64 {
+		return float64(gray.Pix[y*gray.Stride+x*4])
+	}
+
+	var sum, sumSquares float64
+	count := 0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			laplacian := luma(x-1, y) + luma(x+1, y) + luma(x, y-1) + luma(x, y+1) - 4*luma(x, y)
+			sum += laplacian
+			sumSquares += laplacian * laplacian
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	mean := sum / float64(count)
+	return sumSquares/float64(count) - mean*mean, nil
+}
@@ -0,0 +1,99 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SniffLength is how many leading bytes of a file SniffMediaType looks at
+const SniffLength = 512
+
+// media types SniffMediaType reports for files the pipeline handles. camera RAW files are
+// TIFF containers, so they sniff as image/tiff.
+const (
+	MediaTypeJPEG      = "image/jpeg"
+	MediaTypePNG       = "image/png"
+	MediaTypeGIF       = "image/gif"
+	MediaTypeBMP       = "image/bmp"
+	MediaTypeTIFF      = "image/tiff"
+	MediaTypeMP4       = "video/mp4"
+	MediaTypeQuickTime = "video/quicktime"
+	MediaTypePDF       = "application/pdf"
+)
+
+// media types each supported extension may hold. MP4 and QuickTime share the same box
+// layout and are often misnamed, so video extensions accept both.
+var extensionMediaTypes = map[string][]string{
+	".jpg": {MediaTypeJPEG}, ".jpeg": {MediaTypeJPEG},
+	".png": {MediaTypePNG},
+	".gif": {MediaTypeGIF},
+	".bmp": {MediaTypeBMP},
+	".tif": {MediaTypeTIFF}, ".tiff": {MediaTypeTIFF},
+	".cr2": {MediaTypeTIFF}, ".nef": {MediaTypeTIFF}, ".arw": {MediaTypeTIFF}, ".dng": {MediaTypeTIFF},
+	".mp4": {MediaTypeMP4, MediaTypeQuickTime}, ".m4v": {MediaTypeMP4, MediaTypeQuickTime}, ".mov": {MediaTypeMP4, MediaTypeQuickTime},
+	".pdf": {MediaTypePDF},
+}
+
+// leading bytes of Windows, Linux and macOS executables and of scripts
+var executableSignatures = [][]byte{
+	[]byte("MZ"),
+	[]byte("\x7fELF"),
+	{0xFE, 0xED, 0xFA, 0xCE}, {0xFE, 0xED, 0xFA, 0xCF},
+	{0xCE, 0xFA, 0xED, 0xFE}, {0xCF, 0xFA, 0xED, 0xFE},
+	{0xCA, 0xFE, 0xBA, 0xBE}, // universal binaries
+	[]byte("#!"),
+}
+
+// SniffMediaType detects the media type of a file from its first SniffLength bytes, ignoring
+// its name. unrecognised content is reported as application/octet-stream.
+func SniffMediaType(header []byte) string {
+	if bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")) {
+		return MediaTypeTIFF
+	}
+	// ISO base media files start with an ftyp box naming the major brand
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" && string(header[8:12]) == "qt  " {
+		return MediaTypeQuickTime
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(header))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// IsExecutable reports whether the first bytes of a file are those of a program or script
+func IsExecutable(header []byte) bool {
+	for _, signature := range executableSignatures {
+		if bytes.HasPrefix(header, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUpload validates an uploaded file by its content rather than its name: the content
+// must not be executable, its media type must be one of allowedTypes, and it must be what
+// the file's extension claims, since processing goes by extension. returns the sniffed type.
+func CheckUpload(filename string, header []byte, allowedTypes []string) (string, error) {
+	if IsExecutable(header) {
+		return "", fmt.Errorf("file is an executable, not a photo, video or document")
+	}
+	mediaType := SniffMediaType(header)
+	if !slices.Contains(allowedTypes, mediaType) {
+		return mediaType, fmt.Errorf("file type %s is not allowed", mediaType)
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	expected, ok := extensionMediaTypes[ext]
+	if !ok {
+		return mediaType, fmt.Errorf("file extension '%s' is not supported", ext)
+	}
+	if !slices.Contains(expected, mediaType) {
+		return mediaType, fmt.Errorf("file content is %s, which does not match its '%s' extension", mediaType, ext)
+	}
+	return mediaType, nil
+}
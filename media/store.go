@@ -8,8 +8,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
 )
 
+// ErrNoLocalPath is returned by stores whose assets do not live on the local filesystem
+var ErrNoLocalPath = errors.New("asset has no local filesystem path")
+
 // Store defines the interface for saving, retrieving, and deleting media assets
 type Store interface {
 	// Save stores data from reader to a specific relative path within a subdirectory
@@ -25,6 +31,45 @@ type Store interface {
 	EnsureDir(assetType AssetType) (string, error)
 }
 
+// Presigner is implemented by stores that can hand out time-limited direct
+// download URLs, letting the asset server redirect instead of proxying bytes
+type Presigner interface {
+	PresignGet(relativePath string, expiry time.Duration) (string, error)
+}
+
+// SubDirsFromConfig maps each asset type to the subdirectory name configured for it
+func SubDirsFromConfig(cfg config.Config) map[AssetType]string {
+	return map[AssetType]string{
+		AssetTypeThumbnail: filepath.Base(cfg.ThumbnailsPath),
+		AssetTypeBanner:    filepath.Base(cfg.BannersPath),
+		AssetTypeArchive:   filepath.Base(cfg.ArchivesPath),
+		AssetTypeVideo:     filepath.Base(cfg.VideosPath),
+		AssetTypeAvatar:    filepath.Base(cfg.AvatarsPath),
+		AssetTypeWatermark: filepath.Base(cfg.WatermarksPath),
+		AssetTypeStream:    filepath.Base(cfg.StreamsPath),
+	}
+}
+
+// NewStoreFromConfig creates the Store selected by cfg.StorageBackend
+func NewStoreFromConfig(cfg config.Config) (Store, error) {
+	switch cfg.StorageBackend {
+	case config.StorageBackendS3:
+		return NewS3Storage(S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			Prefix:          cfg.S3Prefix,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UsePathStyle:    cfg.S3UsePathStyle,
+		}, SubDirsFromConfig(cfg))
+	case config.StorageBackendLocal, "":
+		return NewLocalStorage(cfg.MediaStoragePath, SubDirsFromConfig(cfg))
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s'", cfg.StorageBackend)
+	}
+}
+
 // LocalStorage implements the Store interface using the local filesystem
 type LocalStorage struct {
 	basePath        string               // absolute path to the MEDIA_STORAGE_PATH
@@ -6,6 +6,10 @@ const (
 	AssetTypeThumbnail AssetType = "thumbnail"
 	AssetTypeBanner    AssetType = "banner"
 	AssetTypeArchive   AssetType = "archive"
+	AssetTypeVideo     AssetType = "video"
+	AssetTypeAvatar    AssetType = "avatar"
+	AssetTypeWatermark AssetType = "watermark"
+	AssetTypeStream    AssetType = "stream"
 )
 
 // ImageProcessingOptions holds parameters for transformations
@@ -31,6 +35,26 @@ type Metadata struct {
 	CameraMake   *string  `json:"camera_make,omitempty"`
 	CameraModel  *string  `json:"camera_model,omitempty"`
 	TakenAt      *int64   `json:"taken_at,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`  // decimal degrees, north positive
+	Longitude    *float64 `json:"longitude,omitempty"` // decimal degrees, east positive
+	Altitude     *float64 `json:"altitude,omitempty"`  // meters above sea level
+	Keywords     []string `json:"keywords,omitempty"`  // IPTC and XMP keywords
+
+	// TakenAt in milliseconds with the EXIF sub-seconds, telling the frames of a burst apart
+	TakenAtMs *int64 `json:"taken_at_ms,omitempty"`
+	// the Live Photo content identifier of the Apple maker note, shared with the video
+	ContentID *string `json:"content_id,omitempty"`
+	// GPano:ProjectionType of spherical and panoramic images, e.g. "equirectangular"
+	Projection *string `json:"projection,omitempty"`
+
+	// dc:title and dc:description of the XMP sidecar
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+
+	// dc:rights and xmpRights:UsageTerms of the XMP sidecar, the copyright falling back to
+	// the EXIF Copyright and Artist
+	Copyright *string `json:"copyright,omitempty"`
+	License   *string `json:"license,omitempty"`
 }
 
 // DetectionResult represents a detected face with enhanced information
@@ -0,0 +1,284 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+)
+
+const (
+	VideoRenditionExtension = ".mp4"
+
+	// poster frames are grabbed a little into the clip to skip black lead-in frames
+	videoPosterOffsetSeconds = 1.0
+
+	videoProbeTimeout     = 30 * time.Second
+	videoPosterTimeout    = 60 * time.Second
+	videoTranscodeTimeout = 2 * time.Hour
+	imageEncodeTimeout    = 60 * time.Second
+)
+
+var supportedVideoExtensions = map[string]bool{
+	".mp4": true, ".mov": true, ".m4v": true,
+}
+
+// IsVideo checks if the filename has a supported video container extension
+func IsVideo(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return supportedVideoExtensions[ext]
+}
+
+// VideoInfo holds stream information extracted with ffprobe
+type VideoInfo struct {
+	Duration   *float64 `json:"duration,omitempty"` // seconds
+	Width      *int     `json:"width,omitempty"`
+	Height     *int     `json:"height,omitempty"`
+	VideoCodec *string  `json:"video_codec,omitempty"`
+	AudioCodec *string  `json:"audio_codec,omitempty"`
+	Bitrate    *int64   `json:"bitrate,omitempty"`    // bits per second, of all streams
+	CreatedAt  *int64   `json:"created_at,omitempty"` // Unix timestamp of the recording
+	ContentID  *string  `json:"content_id,omitempty"` // of the Live Photo whose motion the video is
+}
+
+// VideoTool wraps the ffmpeg/ffprobe binaries used for video processing
+type VideoTool struct {
+	FFmpegPath  string
+	FFprobePath string
+}
+
+// NewVideoTool creates a VideoTool, falling back to binaries on PATH
+func NewVideoTool(ffmpegPath, ffprobePath string) *VideoTool {
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+	}
+	return &VideoTool{FFmpegPath: ffmpegPath, FFprobePath: ffprobePath}
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// videoCreationTimeTags are the container tags a video's recording time is read from, by
+// preference: the local time with its offset written by Apple devices, then the UTC time
+// most cameras and encoders write
+var videoCreationTimeTags = []struct{ key, layout string }{
+	{"com.apple.quicktime.creationdate", "2006-01-02T15:04:05-0700"},
+	{"creation_time", time.RFC3339Nano},
+}
+
+// videoCreationTime returns when a video was recorded according to its container tags, or nil
+// if they don't say. the zero time some cameras write when their clock isn't set is ignored.
+func videoCreationTime(tags map[string]string) *int64 {
+	for _, tag := range videoCreationTimeTags {
+		raw := strings.TrimSpace(tags[tag.key])
+		if raw == "" {
+			continue
+		}
+		if t, err := time.Parse(tag.layout, raw); err == nil && t.Unix() > 0 {
+			ts := t.Unix()
+			return &ts
+		}
+	}
+	return nil
+}
+
+// Probe reads duration, dimensions, codecs, bitrate and recording time of a video file
+func (vt *VideoTool) Probe(videoPath string) (*VideoInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), videoProbeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, vt.FFprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		videoPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed for %s: %w (%s)", videoPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output for %s: %w", videoPath, err)
+	}
+
+	info := &VideoInfo{}
+	if d, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && d > 0 {
+		info.Duration = &d
+	}
+	if b, err := strconv.ParseInt(probe.Format.BitRate, 10, 64); err == nil && b > 0 {
+		info.Bitrate = &b
+	}
+	info.CreatedAt = videoCreationTime(probe.Format.Tags)
+	if id := strings.TrimSpace(probe.Format.Tags[quickTimeContentIdentifierKey]); id != "" {
+		info.ContentID = &id
+	}
+	for _, stream := range probe.Streams {
+		codec := stream.CodecName
+		switch stream.CodecType {
+		case "video":
+			if info.VideoCodec != nil {
+				continue // keep the first video stream, later ones are usually cover art
+			}
+			info.VideoCodec = &codec
+			if stream.Width > 0 && stream.Height > 0 {
+				w, h := stream.Width, stream.Height
+				info.Width = &w
+				info.Height = &h
+			}
+		case "audio":
+			if info.AudioCodec == nil {
+				info.AudioCodec = &codec
+			}
+		}
+	}
+
+	if info.VideoCodec == nil {
+		return nil, fmt.Errorf("no video stream found in %s", videoPath)
+	}
+	return info, nil
+}
+
+// ExtractPosterFrame decodes a single frame from the video to use as its thumbnail.
+// duration may be nil if unknown, in which case the first frame is used.
+func (vt *VideoTool) ExtractPosterFrame(videoPath string, duration *float64) (image.Image, error) {
+	offset := 0.0
+	if duration != nil {
+		offset = videoPosterOffsetSeconds
+		if *duration <= offset*2 {
+			offset = *duration / 2
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), videoPosterTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, vt.FFmpegPath,
+		"-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"-vcodec", "png",
+		"pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg poster extraction failed for %s: %w (%s)", videoPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	img, _, err := image.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode poster frame for %s: %w", videoPath, err)
+	}
+	return img, nil
+}
+
+// EncodeImage encodes an image in one of the thumbnail formats ffmpeg supports besides
+// JPEG, config.ThumbnailFormatWebP or config.ThumbnailFormatAVIF
+func (vt *VideoTool) EncodeImage(img image.Image, format string) ([]byte, error) {
+	var codecArgs []string
+	switch format {
+	case config.ThumbnailFormatWebP:
+		codecArgs = []string{"-c:v", "libwebp", "-quality", "80"}
+	case config.ThumbnailFormatAVIF:
+		codecArgs = []string{"-c:v", "libaom-av1", "-still-picture", "1", "-crf", "32", "-cpu-used", "6", "-pix_fmt", "yuv420p"}
+	default:
+		return nil, fmt.Errorf("unsupported image format '%s'", format)
+	}
+
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image for ffmpeg: %w", err)
+	}
+
+	// the avif muxer can't write to a pipe, so every format goes through a temp file
+	tmpFile, err := os.CreateTemp("", "mediasys-image-*."+format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file for %s image: %w", format, err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmpPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageEncodeTimeout)
+	defer cancel()
+
+	args := append([]string{"-v", "error", "-y", "-f", "image2pipe", "-c:v", "png", "-i", "pipe:0"}, codecArgs...)
+	cmd := exec.CommandContext(ctx, vt.FFmpegPath, append(args, tmpPath)...)
+	var stderr bytes.Buffer
+	cmd.Stdin = &input
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg %s encoding failed: %w (%s)", format, err, strings.TrimSpace(stderr.String()))
+	}
+
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encoded %s image: %w", format, err)
+	}
+	return data, nil
+}
+
+// TranscodeWeb converts a video into a web-playable H.264/AAC MP4 at destPath.
+// the output is scaled down so its height does not exceed maxHeight.
+func (vt *VideoTool) TranscodeWeb(videoPath, destPath string, maxHeight int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), videoTranscodeTimeout)
+	defer cancel()
+
+	// keep aspect ratio, never upscale, and force even dimensions for yuv420p
+	scaleFilter := fmt.Sprintf("scale=-2:'min(%d,ih)':force_divisible_by=2", maxHeight)
+
+	cmd := exec.CommandContext(ctx, vt.FFmpegPath,
+		"-v", "error",
+		"-y",
+		"-i", videoPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-vf", scaleFilter,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-movflags", "+faststart",
+		destPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg transcode failed for %s: %w (%s)", videoPath, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
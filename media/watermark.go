@@ -0,0 +1,122 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// where ApplyWatermark places the watermark
+const (
+	WatermarkTopLeft     = "top_left"
+	WatermarkTopRight    = "top_right"
+	WatermarkBottomLeft  = "bottom_left"
+	WatermarkBottomRight = "bottom_right"
+	WatermarkCenter      = "center"
+	WatermarkTiled       = "tiled" // repeated across the whole image
+)
+
+// watermark sizes, as a share of the watermarked image
+const (
+	watermarkTextHeight   = 0.04 // of the shorter side
+	watermarkOverlayWidth = 0.25 // of the width
+	watermarkMargin       = 0.02 // of the shorter side, kept clear around corner positions
+)
+
+// IsValidWatermarkPosition reports whether position is one of the Watermark* positions
+func IsValidWatermarkPosition(position string) bool {
+	switch position {
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter, WatermarkTiled:
+		return true
+	}
+	return false
+}
+
+// Watermark is a text or overlay image stamped onto downloads
+type Watermark struct {
+	Text     string      // drawn with a basic bitmap font, characters it lacks are left out
+	Overlay  image.Image // drawn instead of Text when set
+	Position string
+	Opacity  float64 // 0-1
+}
+
+// ApplyWatermark returns a copy of img with the watermark drawn on it, scaled to the
+// image so it looks the same at any resolution. returns img itself if there is nothing to draw.
+func ApplyWatermark(img image.Image, wm Watermark) image.Image {
+	bounds := img.Bounds()
+	shorter := min(bounds.Dx(), bounds.Dy())
+
+	var mark image.Image
+	if wm.Overlay != nil {
+		width := max(1, int(float64(bounds.Dx())*watermarkOverlayWidth))
+		mark = imaging.Resize(wm.Overlay, width, 0, imaging.Lanczos)
+	} else if wm.Text != "" {
+		mark = renderWatermarkText(wm.Text, max(8, int(float64(shorter)*watermarkTextHeight)))
+	}
+	if mark == nil || wm.Opacity <= 0 {
+		return img
+	}
+
+	dst := imaging.Clone(img) // always starts at 0,0
+	opacity := image.NewUniform(color.Alpha{A: uint8(min(wm.Opacity, 1) * 255)})
+	markSize := mark.Bounds().Size()
+	stamp := func(pos image.Point) {
+		draw.DrawMask(dst, image.Rectangle{Min: pos, Max: pos.Add(markSize)}, mark, mark.Bounds().Min, opacity, image.Point{}, draw.Over)
+	}
+
+	if wm.Position == WatermarkTiled {
+		// leave a gap of one watermark between repeats
+		for y := 0; y < bounds.Dy(); y += markSize.Y * 2 {
+			for x := 0; x < bounds.Dx(); x += markSize.X * 2 {
+				stamp(image.Pt(x, y))
+			}
+		}
+		return dst
+	}
+
+	margin := int(float64(shorter) * watermarkMargin)
+	left, top := margin, margin
+	right, bottom := bounds.Dx()-markSize.X-margin, bounds.Dy()-markSize.Y-margin
+	switch wm.Position {
+	case WatermarkTopLeft:
+		stamp(image.Pt(left, top))
+	case WatermarkTopRight:
+		stamp(image.Pt(right, top))
+	case WatermarkBottomLeft:
+		stamp(image.Pt(left, bottom))
+	case WatermarkCenter:
+		stamp(image.Pt((bounds.Dx()-markSize.X)/2, (bounds.Dy()-markSize.Y)/2))
+	default:
+		stamp(image.Pt(right, bottom))
+	}
+	return dst
+}
+
+// renderWatermarkText draws text in white with a dark shadow, so it stays readable on light
+// and dark images, scaled to height pixels
+func renderWatermarkText(text string, height int) image.Image {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return nil
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, width+1, face.Height+1))
+	for _, pass := range []struct {
+		color  color.Color
+		offset int
+	}{{color.NRGBA{A: 160}, 1}, {color.White, 0}} {
+		drawer := font.Drawer{
+			Dst:  canvas,
+			Src:  image.NewUniform(pass.color),
+			Face: face,
+			Dot:  fixed.P(pass.offset, face.Ascent+pass.offset),
+		}
+		drawer.DrawString(text)
+	}
+	return imaging.Resize(canvas, 0, height, imaging.Linear)
+}
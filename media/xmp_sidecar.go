@@ -0,0 +1,514 @@
+package media
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	xmpExifNamespace      = "http://ns.adobe.com/exif/1.0/"
+	xmpBasicNamespace     = "http://ns.adobe.com/xap/1.0/"
+	xmpPhotoshopNamespace = "http://ns.adobe.com/photoshop/1.0/"
+	xmpRightsNamespace    = "http://ns.adobe.com/xap/1.0/rights/"
+	xmlNamespace          = "http://www.w3.org/XML/1998/namespace"
+
+	// xmpDateLayout is how capture times are written, in local time like EXIF with the offset
+	xmpDateLayout = "2006-01-02T15:04:05-07:00"
+)
+
+// xmpDateLayouts are the forms of XMP dates read, from most to least precise. dates without
+// an offset are in local time, like EXIF dates.
+var xmpDateLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// XMPProperties are the descriptive properties of an image kept in its XMP sidecar: dc:title,
+// dc:description, dc:rights, xmpRights:UsageTerms and exif:DateTimeOriginal. nil properties
+// are absent.
+type XMPProperties struct {
+	Title       *string
+	Description *string
+	Copyright   *string
+	License     *string
+	TakenAt     *int64 // Unix timestamp
+}
+
+// xmpDateProperties are read for the capture time, in order of preference
+var xmpDateProperties = []xml.Name{
+	{Space: xmpExifNamespace, Local: "DateTimeOriginal"},
+	{Space: xmpPhotoshopNamespace, Local: "DateCreated"},
+	{Space: xmpBasicNamespace, Local: "CreateDate"},
+}
+
+// isXMPProperty reports whether a property is one of XMPProperties, which WriteXMPSidecar
+// replaces
+func isXMPProperty(name xml.Name) bool {
+	if name.Space == xmpDublinCoreNamespace {
+		return name.Local == "title" || name.Local == "description" || name.Local == "rights"
+	}
+	if name.Space == xmpRightsNamespace {
+		return name.Local == "UsageTerms"
+	}
+	for _, date := range xmpDateProperties {
+		if name == date {
+			return true
+		}
+	}
+	return false
+}
+
+// xmpSidecarCandidates are the names an XMP sidecar of filePath may have: IMG_1.xmp as
+// written by Lightroom, or IMG_1.CR2.xmp as written by darktable
+func xmpSidecarCandidates(filePath string) []string {
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	return []string{base + ".xmp", base + ".XMP", filePath + ".xmp"}
+}
+
+// XMPSidecarPath returns the XMP sidecar of an image: the existing one, or else IMG_1.CR2.xmp,
+// named after the whole file so the RAW and JPEG of a pair don't share one
+func XMPSidecarPath(filePath string) string {
+	candidates := xmpSidecarCandidates(filePath)
+	for _, sidecar := range candidates {
+		if info, err := os.Stat(sidecar); err == nil && info.Mode().IsRegular() {
+			return sidecar
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// ReadXMPSidecar returns the descriptive properties of the XMP sidecar of an image. an image
+// without a readable sidecar has none.
+func ReadXMPSidecar(filePath string) XMPProperties {
+	packet, err := os.ReadFile(XMPSidecarPath(filePath))
+	if err != nil {
+		return XMPProperties{}
+	}
+	return parseXMPProperties(packet)
+}
+
+// parseXMPProperties reads the descriptive properties of an XMP packet. the language
+// alternatives of dc:title, dc:description, dc:rights and xmpRights:UsageTerms yield their
+// x-default entry, or their first one. properties may be elements or attributes of their
+// rdf:Description.
+func parseXMPProperties(packet []byte) XMPProperties {
+	values := make(map[xml.Name]string)
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+
+	var property *xml.Name // being read
+	var direct, first, preferred strings.Builder
+	inItem, itemPreferred, haveItem := false, false, false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if property == nil {
+				if t.Name.Space == xmpRDFNamespace && t.Name.Local == "Description" {
+					for _, attr := range t.Attr {
+						if isXMPProperty(attr.Name) {
+							values[attr.Name] = attr.Value
+						}
+					}
+				} else if isXMPProperty(t.Name) {
+					name := t.Name
+					property = &name
+					direct.Reset()
+					first.Reset()
+					preferred.Reset()
+					haveItem = false
+				}
+			} else if t.Name.Space == xmpRDFNamespace && t.Name.Local == "li" {
+				inItem = true
+				itemPreferred = false
+				for _, attr := range t.Attr {
+					if attr.Name.Space == xmlNamespace && attr.Name.Local == "lang" && attr.Value == "x-default" {
+						itemPreferred = true
+					}
+				}
+			}
+		case xml.CharData:
+			switch {
+			case property == nil:
+			case !inItem:
+				direct.Write(t)
+			case itemPreferred:
+				preferred.Write(t)
+			case !haveItem:
+				first.Write(t)
+			}
+		case xml.EndElement:
+			if property == nil {
+				continue
+			}
+			if inItem && t.Name.Space == xmpRDFNamespace && t.Name.Local == "li" {
+				inItem = false
+				haveItem = true
+			} else if t.Name == *property {
+				value := direct.String()
+				if preferred.Len() > 0 {
+					value = preferred.String()
+				} else if first.Len() > 0 {
+					value = first.String()
+				}
+				values[*property] = value
+				property = nil
+			}
+		}
+	}
+
+	var props XMPProperties
+	text := func(space, local string) *string {
+		value := strings.TrimSpace(values[xml.Name{Space: space, Local: local}])
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	props.Title = text(xmpDublinCoreNamespace, "title")
+	props.Description = text(xmpDublinCoreNamespace, "description")
+	props.Copyright = text(xmpDublinCoreNamespace, "rights")
+	props.License = text(xmpRightsNamespace, "UsageTerms")
+	for _, name := range xmpDateProperties {
+		if taken, ok := parseXMPDate(values[name]); ok {
+			props.TakenAt = &taken
+			break
+		}
+	}
+	return props
+}
+
+// parseXMPDate parses an XMP date into a Unix timestamp
+func parseXMPDate(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	for _, layout := range xmpDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Unix(), true
+		}
+	}
+	return 0, false
+}
+
+// WriteXMPSidecar sets the descriptive properties of an image in its XMP sidecar, creating
+// one when there is none. the properties are replaced as a whole, nil ones are removed;
+// everything else in an existing sidecar, like the develop settings of a raw editor, is kept.
+func WriteXMPSidecar(filePath string, props XMPProperties) error {
+	sidecar := XMPSidecarPath(filePath)
+	existing, err := os.ReadFile(sidecar)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("xmp: failed to read sidecar %s: %w", sidecar, err)
+	}
+
+	var packet []byte
+	if len(bytes.TrimSpace(existing)) > 0 {
+		packet, err = replaceXMPProperties(existing, props)
+		if err != nil {
+			return fmt.Errorf("xmp: failed to update sidecar %s: %w", sidecar, err)
+		}
+	} else {
+		if props == (XMPProperties{}) {
+			return nil
+		}
+		packet = []byte(xmpMeta(props))
+	}
+
+	// written to a temp file first so a crash mid-write never leaves a truncated sidecar
+	tmpPath := sidecar + ".tmp"
+	if err := os.WriteFile(tmpPath, packet, 0644); err != nil {
+		return fmt.Errorf("xmp: failed to write sidecar %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, sidecar); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("xmp: failed to move sidecar into place at %s: %w", sidecar, err)
+	}
+	return nil
+}
+
+// xmpMeta returns an x:xmpmeta element holding props
+func xmpMeta(props XMPProperties) string {
+	return "<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n <rdf:RDF xmlns:rdf=\"" + xmpRDFNamespace + "\">\n" +
+		xmpDescription(props) + " </rdf:RDF>\n</x:xmpmeta>\n"
+}
+
+// EncodeJPEGWithXMP writes img as JPEG like EncodeJPEG, with props embedded in an XMP (APP1)
+// segment after the start of image marker. props too large for a segment are left out.
+func EncodeJPEGWithXMP(w io.Writer, img image.Image, quality int, props XMPProperties) error {
+	if props == (XMPProperties{}) {
+		return EncodeJPEG(w, img, quality)
+	}
+	packet := "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n" + xmpMeta(props) + "<?xpacket end=\"r\"?>"
+	length := 2 + len(jpegXMPHeader) + len(packet) // the length field counts itself
+	if length > 0xFFFF {
+		return EncodeJPEG(w, img, quality)
+	}
+	segment := []byte{0xFF, 0xE1, byte(length >> 8), byte(length)}
+	segment = append(segment, jpegXMPHeader...)
+	segment = append(segment, packet...)
+	return EncodeJPEG(&jpegSegmentInserter{w: w, segment: segment}, img, quality)
+}
+
+// jpegSegmentInserter passes an encoded JPEG through, adding segment after the two bytes of
+// its start of image marker
+type jpegSegmentInserter struct {
+	w       io.Writer
+	segment []byte // nil once written
+	passed  int    // bytes of the marker passed through
+}
+
+func (j *jpegSegmentInserter) Write(p []byte) (int, error) {
+	written := 0
+	if j.segment != nil {
+		n := min(2-j.passed, len(p))
+		if _, err := j.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+		j.passed += n
+		written, p = n, p[n:]
+		if j.passed < 2 {
+			return written, nil
+		}
+		if _, err := j.w.Write(j.segment); err != nil {
+			return written, err
+		}
+		j.segment = nil
+	}
+	n, err := j.w.Write(p)
+	return written + n, err
+}
+
+// xmpDescription returns an rdf:Description holding props, or "" when all are nil. it
+// declares every prefix it uses, so it can go into any rdf:RDF.
+func xmpDescription(props XMPProperties) string {
+	var body strings.Builder
+	alternative := func(property string, value *string) {
+		if value == nil || *value == "" {
+			return
+		}
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(*value))
+		fmt.Fprintf(&body, "   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </%s>\n", property, escaped.String(), property)
+	}
+	alternative("dc:title", props.Title)
+	alternative("dc:description", props.Description)
+	alternative("dc:rights", props.Copyright)
+	alternative("xmpRights:UsageTerms", props.License)
+	if props.TakenAt != nil {
+		fmt.Fprintf(&body, "   <exif:DateTimeOriginal>%s</exif:DateTimeOriginal>\n", time.Unix(*props.TakenAt, 0).Format(xmpDateLayout))
+	}
+	if body.Len() == 0 {
+		return ""
+	}
+	return "  <rdf:Description rdf:about=\"\"\n" +
+		"    xmlns:rdf=\"" + xmpRDFNamespace + "\"\n" +
+		"    xmlns:dc=\"" + xmpDublinCoreNamespace + "\"\n" +
+		"    xmlns:exif=\"" + xmpExifNamespace + "\"\n" +
+		"    xmlns:xmpRights=\"" + xmpRightsNamespace + "\">\n" +
+		body.String() +
+		"  </rdf:Description>\n"
+}
+
+// xmpSpan is a range of bytes of an XMP packet
+type xmpSpan struct {
+	start, end int64
+}
+
+// replaceXMPProperties removes the descriptive properties from an XMP packet, along with
+// any rdf:Description left empty, and adds an rdf:Description holding props to its rdf:RDF.
+// the rest of the packet is kept byte for byte.
+func replaceXMPProperties(packet []byte, props XMPProperties) ([]byte, error) {
+	// the raw tokens keep their prefixes, so namespaces are resolved here
+	scopes := []map[string]string{{"xml": xmlNamespace}}
+	resolve := func(name xml.Name) xml.Name {
+		if name.Space == "" {
+			return name
+		}
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if uri, ok := scopes[i][name.Space]; ok {
+				return xml.Name{Space: uri, Local: name.Local}
+			}
+		}
+		return name
+	}
+
+	// rdf:Description elements being read, and whether anything in them is kept
+	type description struct {
+		start      int64
+		firstCut   int
+		keep       bool
+		childDepth int
+	}
+	var descriptions []*description
+
+	var cuts []xmpSpan
+	insertAt := int64(-1)
+	skipDepth := 0 // of a property element being dropped
+	var skipStart int64
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					scope[attr.Name.Local] = attr.Value
+				} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					scope[""] = attr.Value
+				}
+			}
+			scopes = append(scopes, scope)
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			name := resolve(t.Name)
+			var current *description
+			if len(descriptions) > 0 {
+				current = descriptions[len(descriptions)-1]
+				current.childDepth++
+			}
+			if isXMPProperty(name) {
+				skipDepth, skipStart = 1, start
+				continue
+			}
+			if current != nil && current.childDepth == 1 {
+				// another property of the description
+				current.keep = true
+			}
+			if name.Space == xmpRDFNamespace && name.Local == "Description" {
+				desc := &description{start: start, firstCut: len(cuts)}
+				tag := packet[start:decoder.InputOffset()]
+				for _, attr := range t.Attr {
+					attrName := resolve(attr.Name)
+					switch {
+					case isXMPProperty(attrName):
+						if loc := xmpAttributePattern(attr.Name).FindIndex(tag); loc != nil {
+							cuts = append(cuts, xmpSpan{start + int64(loc[0]), start + int64(loc[1])})
+						}
+					case attr.Name.Space == "xmlns", attr.Name.Space == "" && attr.Name.Local == "xmlns",
+						attrName.Space == xmpRDFNamespace && attrName.Local == "about":
+					default:
+						desc.keep = true
+					}
+				}
+				descriptions = append(descriptions, desc)
+			}
+		case xml.EndElement:
+			name := resolve(t.Name)
+			scopes = scopes[:len(scopes)-1]
+			if skipDepth > 0 {
+				skipDepth--
+				if skipDepth == 0 {
+					cuts = append(cuts, widenXMPSpan(packet, xmpSpan{skipStart, decoder.InputOffset()}))
+					if len(descriptions) > 0 {
+						descriptions[len(descriptions)-1].childDepth--
+					}
+				}
+				continue
+			}
+			if name.Space == xmpRDFNamespace && name.Local == "Description" && len(descriptions) > 0 {
+				desc := descriptions[len(descriptions)-1]
+				descriptions = descriptions[:len(descriptions)-1]
+				if !desc.keep {
+					// nothing is left of it
+					cuts = append(cuts[:desc.firstCut], widenXMPSpan(packet, xmpSpan{desc.start, decoder.InputOffset()}))
+				}
+				if len(descriptions) > 0 {
+					descriptions[len(descriptions)-1].childDepth--
+				}
+				continue
+			}
+			if len(descriptions) > 0 {
+				descriptions[len(descriptions)-1].childDepth--
+			}
+			if name.Space == xmpRDFNamespace && name.Local == "RDF" && insertAt < 0 {
+				insertAt = start
+			}
+		}
+	}
+	if insertAt < 0 {
+		return nil, errors.New("no rdf:RDF element")
+	}
+
+	// the description goes on the lines before the closing tag
+	at := insertAt
+	for at > 0 && (packet[at-1] == ' ' || packet[at-1] == '\t') {
+		at--
+	}
+	added := xmpDescription(props)
+	if at > 0 && packet[at-1] != '\n' {
+		at = insertAt
+		if added != "" {
+			added = "\n" + added
+		}
+	}
+
+	// the cuts are all inside rdf:RDF, before the insertion point
+	var out bytes.Buffer
+	pos := int64(0)
+	for _, cut := range cuts {
+		out.Write(packet[pos:cut.start])
+		pos = cut.end
+	}
+	out.Write(packet[pos:at])
+	out.WriteString(added)
+	out.Write(packet[at:])
+	return out.Bytes(), nil
+}
+
+// xmpAttributePattern matches an attribute with the given raw name in a start tag, along
+// with the whitespace before it
+func xmpAttributePattern(raw xml.Name) *regexp.Regexp {
+	name := raw.Local
+	if raw.Space != "" {
+		name = raw.Space + ":" + raw.Local
+	}
+	return regexp.MustCompile(`\s+` + regexp.QuoteMeta(name) + `\s*=\s*(?:"[^"]*"|'[^']*')`)
+}
+
+// widenXMPSpan extends a span to its whole line when nothing else is on it, so removing an
+// element leaves no blank line behind
+func widenXMPSpan(packet []byte, span xmpSpan) xmpSpan {
+	start := span.start
+	for start > 0 && (packet[start-1] == ' ' || packet[start-1] == '\t') {
+		start--
+	}
+	if start > 0 && packet[start-1] != '\n' {
+		return span
+	}
+	end := span.end
+	for end < int64(len(packet)) && (packet[end] == ' ' || packet[end] == '\t' || packet[end] == '\r') {
+		end++
+	}
+	if end < int64(len(packet)) && packet[end] != '\n' {
+		return span
+	}
+	if end < int64(len(packet)) {
+		end++
+	}
+	return xmpSpan{start, end}
+}
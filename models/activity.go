@@ -0,0 +1,27 @@
+package models
+
+// activity types
+const (
+	ActivityAlbumCreated   = "album.created"
+	ActivityImagesUploaded = "images.uploaded"
+	ActivityAlbumZipReady  = "album.zip.ready"
+	ActivityPersonTagged   = "person.tagged"
+)
+
+// Activity is a notable event in an album, shown in the activity feed.
+// It corresponds to the 'activities' table.
+type Activity struct {
+	ID        uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Type      string  `gorm:"not null;index" json:"type"`
+	AlbumID   uint    `gorm:"not null;index" json:"album_id"`
+	UserID    *uint   `gorm:"index" json:"user_id,omitempty"`   // who caused the event, nil for background work
+	ImagePath *string `gorm:"" json:"image_path,omitempty"`     // the image of single image events
+	PersonID  *uint   `gorm:"" json:"person_id,omitempty"`      // person.tagged only
+	Count     int     `gorm:"not null;default:0" json:"count"`  // images.uploaded only
+	CreatedAt int64   `gorm:"not null;index" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (Activity) TableName() string {
+	return "activities"
+}
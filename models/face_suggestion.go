@@ -0,0 +1,33 @@
+package models
+
+// face suggestion review states
+const (
+	FaceSuggestionPending  = "pending"
+	FaceSuggestionAccepted = "accepted"
+	FaceSuggestionRejected = "rejected"
+)
+
+// FaceSuggestion is a person suggested for an untagged face by face recognition, waiting for
+// or having had a review. there is at most one suggestion per face and person, so a rejected
+// suggestion is never made again.
+// It corresponds to the 'face_suggestions' table.
+type FaceSuggestion struct {
+	ID         uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	FaceID     uint    `gorm:"not null;uniqueIndex:idx_face_suggestion_face_person" json:"face_id"`
+	PersonID   uint    `gorm:"not null;uniqueIndex:idx_face_suggestion_face_person;index" json:"person_id"`
+	Confidence float32 `gorm:"not null;default:0" json:"confidence"` // similarity of the closest face tagged with the person
+	Votes      int     `gorm:"not null;default:0" json:"votes"`      // similar faces tagged with the person, less rejections
+	Status     string  `gorm:"not null;default:'pending';index" json:"status"`
+	ReviewedBy *uint   `gorm:"" json:"reviewed_by,omitempty"` // user who accepted or rejected the suggestion
+	ReviewedAt *int64  `gorm:"" json:"reviewed_at,omitempty"` // Unix timestamp
+	CreatedAt  int64   `gorm:"not null" json:"created_at"`    // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt  int64   `gorm:"not null" json:"updated_at"`    // Stored as INTEGER in SQLite, Unix timestamp
+
+	Face   *Face   `gorm:"foreignKey:FaceID" json:"face,omitempty"`
+	Person *Person `gorm:"foreignKey:PersonID" json:"person,omitempty"`
+}
+
+// TableName explicitly sets the table name for GORM.
+func (FaceSuggestion) TableName() string {
+	return "face_suggestions"
+}
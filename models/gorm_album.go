@@ -1,6 +1,9 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"github.com/camden-git/mediasysbackend/utils"
+	"gorm.io/gorm"
+)
 
 // Album represents an album of images in the database using GORM.
 // It corresponds to the 'albums' table.
@@ -8,8 +11,10 @@ type Album struct {
 	ID                 uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name               string         `gorm:"not null;unique" json:"name"`
 	Slug               string         `gorm:"not null;unique" json:"slug"`
-	Description        *string        `gorm:"" json:"description,omitempty"` // Nullable
+	Description        *string        `gorm:"" json:"description,omitempty"`       // Nullable, markdown
+	DescriptionHTML    *string        `gorm:"-" json:"description_html,omitempty"` // Description rendered to sanitized HTML, see RenderDescription
 	FolderPath         string         `gorm:"not null;unique" json:"folder_path"`
+	LibraryID          string         `gorm:"not null;default:'default';index" json:"library_id"`
 	BannerImagePath    *string        `gorm:"" json:"banner_image_path,omitempty"` // Nullable
 	SortOrder          string         `gorm:"not null;default:'name_asc'" json:"sort_order"`
 	ZipPath            *string        `gorm:"" json:"zip_path,omitempty"` // Nullable
@@ -18,14 +23,74 @@ type Album struct {
 	ZipLastGeneratedAt *int64         `gorm:"" json:"zip_last_generated_at,omitempty"` // Nullable, Unix timestamp
 	ZipLastRequestedAt *int64         `gorm:"" json:"zip_last_requested_at,omitempty"` // Nullable, Unix timestamp
 	ZipError           *string        `gorm:"" json:"zip_error,omitempty"`             // Nullable
+	ZipProgress        int            `gorm:"not null;default:0" json:"zip_progress"`  // Percent of files zipped while processing
 	CreatedAt          int64          `gorm:"not null" json:"created_at"`              // Stored as INTEGER in SQLite, Unix timestamp
 	UpdatedAt          int64          `gorm:"not null" json:"updated_at"`              // Stored as INTEGER in SQLite, Unix timestamp
 	IsHidden           bool           `gorm:"not null;default:false" json:"-"`
+	IsArchived         bool           `gorm:"not null;default:false" json:"is_archived"`
 	Location           *string        `gorm:"" json:"location,omitempty"`        // Nullable
 	DeletedAt          gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // For soft deletes
+
+	// watermark stamped on images downloaded through share links, see media.Watermark.
+	// an album has one when WatermarkText or WatermarkImagePath is set
+	WatermarkText      *string `gorm:"" json:"-"`
+	WatermarkImagePath *string `gorm:"" json:"-"` // overlay drawn instead of the text, relative to media storage
+	WatermarkPosition  string  `gorm:"not null;default:'bottom_right'" json:"-"`
+	WatermarkOpacity   float64 `gorm:"not null;default:0.5" json:"-"`
+
+	// copyright holder and license of the album's images, for those that don't have their own
+	Copyright *string `gorm:"" json:"copyright,omitempty"` // Nullable
+	License   *string `gorm:"" json:"license,omitempty"`   // Nullable
+
+	// PDF of the album's thumbnails with their filenames, for clients proofing the album.
+	// generated on request by an admin, see media.WriteContactSheetPDF
+	ContactSheetPath        *string `gorm:"" json:"-"` // Nullable, relative to media storage
+	ContactSheetStatus      string  `gorm:"not null;default:notRequired" json:"-"`
+	ContactSheetGeneratedAt *int64  `gorm:"" json:"-"` // Nullable, Unix timestamp
+	ContactSheetError       *string `gorm:"" json:"-"` // Nullable
 }
 
 // TableName explicitly sets the table name for GORM.
 func (Album) TableName() string {
 	return "albums"
 }
+
+// RenderDescription sets DescriptionHTML from the markdown of Description
+func (a *Album) RenderDescription() {
+	a.DescriptionHTML = nil
+	if a.Description != nil && *a.Description != "" {
+		rendered := utils.RenderMarkdown(*a.Description)
+		a.DescriptionHTML = &rendered
+	}
+}
+
+// AfterFind renders the description of albums loaded from the database
+func (a *Album) AfterFind(tx *gorm.DB) error {
+	a.RenderDescription()
+	return nil
+}
+
+// AfterCreate renders the description of a new album
+func (a *Album) AfterCreate(tx *gorm.DB) error {
+	a.RenderDescription()
+	return nil
+}
+
+// HasWatermark reports whether share link downloads of the album are watermarked
+func (a *Album) HasWatermark() bool {
+	return (a.WatermarkText != nil && *a.WatermarkText != "") || (a.WatermarkImagePath != nil && *a.WatermarkImagePath != "")
+}
+
+// AlbumSlugRedirect is a former slug of an album, kept so links using it keep working after
+// the slug is changed. a slug is either the slug of an album or a redirect, never both.
+// It corresponds to the 'album_slug_redirects' table.
+type AlbumSlugRedirect struct {
+	Slug      string `gorm:"primaryKey" json:"slug"`
+	AlbumID   uint   `gorm:"not null;index" json:"album_id"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (AlbumSlugRedirect) TableName() string {
+	return "album_slug_redirects"
+}
@@ -26,6 +26,9 @@ type Face struct {
 	PosePitch *float32 `gorm:"" json:"pose_pitch,omitempty"` // pitch angle in degrees
 	PoseRoll  *float32 `gorm:"" json:"pose_roll,omitempty"`  // roll angle in degrees
 
+	// group of similar untagged faces found by clustering; renumbered on every clustering run
+	ClusterID *uint `gorm:"index" json:"cluster_id,omitempty"`
+
 	CreatedAt int64          `gorm:"not null" json:"created_at"`        // Stored as INTEGER in SQLite, Unix timestamp
 	UpdatedAt int64          `gorm:"not null" json:"updated_at"`        // Stored as INTEGER in SQLite, Unix timestamp
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // For soft deletes
@@ -27,38 +27,48 @@ func (FaceEmbedding) TableName() string {
 
 // GetEmbedding converts the BLOB data to []float32
 func (fe *FaceEmbedding) GetEmbedding() []float32 {
-	if len(fe.EmbeddingData) == 0 {
+	return decodeEmbedding(fe.EmbeddingData)
+}
+
+// SetEmbedding converts []float32 to BLOB data
+func (fe *FaceEmbedding) SetEmbedding(embedding []float32) {
+	fe.EmbeddingData = encodeEmbedding(embedding)
+}
+
+// decodeEmbedding converts an embedding BLOB (little-endian float32s) to []float32
+func decodeEmbedding(data []byte) []float32 {
+	if len(data) == 0 {
 		return nil
 	}
 
 	// Convert []byte to []float32
-	embedding := make([]float32, len(fe.EmbeddingData)/4) // 4 bytes per float32
+	embedding := make([]float32, len(data)/4) // 4 bytes per float32
 	for i := 0; i < len(embedding); i++ {
 		offset := i * 4
-		bits := uint32(fe.EmbeddingData[offset]) |
-			uint32(fe.EmbeddingData[offset+1])<<8 |
-			uint32(fe.EmbeddingData[offset+2])<<16 |
-			uint32(fe.EmbeddingData[offset+3])<<24
+		bits := uint32(data[offset]) |
+			uint32(data[offset+1])<<8 |
+			uint32(data[offset+2])<<16 |
+			uint32(data[offset+3])<<24
 		embedding[i] = math.Float32frombits(bits)
 	}
 	return embedding
 }
 
-// SetEmbedding converts []float32 to BLOB data
-func (fe *FaceEmbedding) SetEmbedding(embedding []float32) {
+// encodeEmbedding converts []float32 to an embedding BLOB
+func encodeEmbedding(embedding []float32) []byte {
 	if len(embedding) == 0 {
-		fe.EmbeddingData = nil
-		return
+		return nil
 	}
 
 	// Convert []float32 to []byte
-	fe.EmbeddingData = make([]byte, len(embedding)*4) // 4 bytes per float32
+	data := make([]byte, len(embedding)*4) // 4 bytes per float32
 	for i, val := range embedding {
 		offset := i * 4
 		bits := math.Float32bits(val)
-		fe.EmbeddingData[offset] = byte(bits)
-		fe.EmbeddingData[offset+1] = byte(bits >> 8)
-		fe.EmbeddingData[offset+2] = byte(bits >> 16)
-		fe.EmbeddingData[offset+3] = byte(bits >> 24)
+		data[offset] = byte(bits)
+		data[offset+1] = byte(bits >> 8)
+		data[offset+2] = byte(bits >> 16)
+		data[offset+3] = byte(bits >> 24)
 	}
+	return data
 }
@@ -1,6 +1,11 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"path"
+	"strings"
+
+	"gorm.io/gorm"
+)
 
 // Image represents an image record in the database using GORM.
 // It corresponds to the 'images' table.
@@ -10,6 +15,8 @@ type Image struct {
 
 	UploadedByUserID *uint `gorm:"index" json:"uploaded_by_user_id,omitempty"`
 
+	MediaType string `gorm:"not null;default:image;index" json:"media_type"` // "image", "video" or "document"
+
 	Width        *int     `gorm:"" json:"width,omitempty"`         // Nullable
 	Height       *int     `gorm:"" json:"height,omitempty"`        // Nullable
 	TakenAt      *int64   `gorm:"index" json:"taken_at,omitempty"` // Nullable, Unix timestamp
@@ -22,19 +29,110 @@ type Image struct {
 	ShutterSpeed *string  `gorm:"" json:"shutter_speed,omitempty"` // Nullable, e.g., "1/125s"
 	ISO          *int     `gorm:"" json:"iso,omitempty"`           // Nullable
 
-	ThumbnailPath *string `gorm:"" json:"thumbnail_path,omitempty"` // Nullable
+	// GPS position from EXIF, in decimal degrees and meters above sea level
+	Latitude  *float64 `gorm:"index:idx_images_location" json:"latitude,omitempty"`  // Nullable
+	Longitude *float64 `gorm:"index:idx_images_location" json:"longitude,omitempty"` // Nullable
+	Altitude  *float64 `gorm:"" json:"altitude,omitempty"`                           // Nullable
+
+	// place names resolved from the GPS position by the geocode worker task
+	Location        *string `gorm:"" json:"location,omitempty"`              // Nullable, e.g. "Austin, Texas, United States"
+	LocationCity    *string `gorm:"index" json:"location_city,omitempty"`    // Nullable
+	LocationRegion  *string `gorm:"index" json:"location_region,omitempty"`  // Nullable
+	LocationCountry *string `gorm:"index" json:"location_country,omitempty"` // Nullable
+	GeocodedAt      *int64  `gorm:"" json:"geocoded_at,omitempty"`           // Nullable, Unix timestamp, also set when no place was found
+
+	// title, copyright holder and license from the XMP sidecar of the file, which the metadata
+	// editing API writes along with the description and capture time. the copyright holder
+	// falls back to the EXIF Copyright and Artist.
+	Title     *string `gorm:"" json:"title,omitempty"`     // Nullable
+	Copyright *string `gorm:"" json:"copyright,omitempty"` // Nullable
+	License   *string `gorm:"" json:"license,omitempty"`   // Nullable
+
+	// read from the sidecar files of an imported library, e.g. a Google Takeout export. the
+	// capture time and position fill in for files whose own metadata has none, and the people
+	// are tagged once detection finds a single untagged face for a single person.
+	Description       *string  `gorm:"" json:"description,omitempty"` // Nullable
+	SidecarTakenAt    *int64   `gorm:"" json:"-"`                     // Nullable, Unix timestamp
+	SidecarLatitude   *float64 `gorm:"" json:"-"`                     // Nullable
+	SidecarLongitude  *float64 `gorm:"" json:"-"`                     // Nullable
+	SidecarAltitude   *float64 `gorm:"" json:"-"`                     // Nullable
+	ImportedPersonIDs []uint   `gorm:"serializer:json" json:"-"`
+
+	// set by the classification worker task when it stored the image's machine tags
+	ClassifiedAt *int64 `gorm:"" json:"classified_at,omitempty"` // Nullable, Unix timestamp, also set when no label was confident enough
+
+	// visible text read by the OCR worker task, indexed for full-text search
+	OCRText *string `gorm:"" json:"ocr_text,omitempty"` // Nullable
+	OCRAt   *int64  `gorm:"" json:"ocr_at,omitempty"`   // Nullable, Unix timestamp, also set when no text was found
+
+	// set by the NSFW worker task and the review queue; see NSFWFlagged and friends
+	NSFWScore      *float32 `gorm:"" json:"nsfw_score,omitempty"`                 // Nullable, 0 to 1
+	NSFWCheckedAt  *int64   `gorm:"" json:"nsfw_checked_at,omitempty"`            // Nullable, Unix timestamp
+	NSFWStatus     string   `gorm:"not null;default:'';index" json:"nsfw_status"` // "", "flagged", "confirmed" or "cleared"
+	NSFWReviewedBy *uint    `gorm:"" json:"nsfw_reviewed_by,omitempty"`           // user who confirmed or cleared the flag
+	NSFWReviewedAt *int64   `gorm:"" json:"nsfw_reviewed_at,omitempty"`           // Nullable, Unix timestamp
+
+	ThumbnailPath    *string        `gorm:"" json:"thumbnail_path,omitempty"`                   // Nullable
+	ThumbnailSizes   map[int]string `gorm:"serializer:json" json:"thumbnail_sizes,omitempty"`   // extra sizes by longest side in pixels
+	ThumbnailFormats []string       `gorm:"serializer:json" json:"thumbnail_formats,omitempty"` // encodings stored next to every JPEG size, e.g. "webp"
+	Blurhash         *string        `gorm:"" json:"blurhash,omitempty"`                         // Nullable, placeholder clients render until the thumbnail loads
+
+	// burst stacks: frames of one camera shot in quick succession are grouped under the path of
+	// their first frame, and album contents list only the sharpest of them
+	TakenAtMs *int64   `gorm:"" json:"-"`                                          // Nullable, capture time in milliseconds with the EXIF sub-seconds
+	StackID   *string  `gorm:"index" json:"stack_id,omitempty"`                    // Nullable, set for frames of a burst
+	StackBest bool     `gorm:"not null;default:false" json:"stack_best,omitempty"` // the frame a stack is listed as
+	Sharpness *float64 `gorm:"" json:"-"`                                          // Nullable, scored once the frame is stacked
+
+	// Live Photos: the still and the video shot with it share an Apple content identifier, and
+	// point at each other once paired. album contents list the still with the video as its motion.
+	ContentID    *string `gorm:"index" json:"-"`                        // Nullable
+	LivePairPath *string `gorm:"index" json:"live_pair_path,omitempty"` // Nullable, the video of a still or the still of a video
+
+	// GPano:ProjectionType of photospheres and other panoramas, which clients show in a
+	// panorama viewer
+	Projection *string `gorm:"index" json:"projection,omitempty"` // Nullable, e.g. "equirectangular"
+
+	// position within its folder when the album uses the custom sort order
+	SortPosition *int `gorm:"" json:"sort_position,omitempty"` // Nullable, unpositioned files follow by name
+
+	// video-only fields
+	Duration      *float64 `gorm:"" json:"duration,omitempty"`       // Nullable, seconds
+	VideoCodec    *string  `gorm:"" json:"video_codec,omitempty"`    // Nullable, e.g., "hevc"
+	AudioCodec    *string  `gorm:"" json:"audio_codec,omitempty"`    // Nullable, e.g., "aac"
+	Bitrate       *int64   `gorm:"" json:"bitrate,omitempty"`        // Nullable, bits per second
+	RenditionPath *string  `gorm:"" json:"rendition_path,omitempty"` // Nullable, web-playable MP4
+	StreamFiles   []string `gorm:"serializer:json" json:"-"`         // HLS playlists and segments of long videos
 
 	MetadataStatus  string `gorm:"not null;default:pending" json:"metadata_status"`
 	ThumbnailStatus string `gorm:"not null;default:pending" json:"thumbnail_status"`
 	DetectionStatus string `gorm:"not null;default:pending" json:"detection_status"`
+	TranscodeStatus string `gorm:"not null;default:notRequired" json:"transcode_status"`
+	StreamStatus    string `gorm:"not null;default:notRequired" json:"stream_status"`
 
 	MetadataProcessedAt  *int64 `gorm:"" json:"metadata_processed_at,omitempty"`  // Nullable, Unix timestamp
 	ThumbnailProcessedAt *int64 `gorm:"" json:"thumbnail_processed_at,omitempty"` // Nullable, Unix timestamp
 	DetectionProcessedAt *int64 `gorm:"" json:"detection_processed_at,omitempty"` // Nullable, Unix timestamp
+	TranscodeProcessedAt *int64 `gorm:"" json:"transcode_processed_at,omitempty"` // Nullable, Unix timestamp
+	StreamProcessedAt    *int64 `gorm:"" json:"stream_processed_at,omitempty"`    // Nullable, Unix timestamp
 
 	MetadataError  *string `gorm:"" json:"metadata_error,omitempty"`  // Nullable
 	ThumbnailError *string `gorm:"" json:"thumbnail_error,omitempty"` // Nullable
 	DetectionError *string `gorm:"" json:"detection_error,omitempty"` // Nullable
+	TranscodeError *string `gorm:"" json:"transcode_error,omitempty"` // Nullable
+	StreamError    *string `gorm:"" json:"stream_error,omitempty"`    // Nullable
+
+	// number of times each task has been attempted since it last succeeded
+	MetadataAttempts  int `gorm:"not null;default:0" json:"metadata_attempts"`
+	ThumbnailAttempts int `gorm:"not null;default:0" json:"thumbnail_attempts"`
+	DetectionAttempts int `gorm:"not null;default:0" json:"detection_attempts"`
+	TranscodeAttempts int `gorm:"not null;default:0" json:"transcode_attempts"`
+	StreamAttempts    int `gorm:"not null;default:0" json:"stream_attempts"`
+
+	// integrity checking: the original's content hash, recorded when it is first processed
+	ContentHash *string `gorm:"index" json:"content_hash,omitempty"` // Nullable, hex SHA-256
+	FileSize    *int64  `gorm:"" json:"file_size,omitempty"`         // Nullable, bytes at the time of hashing
+	HashedAt    *int64  `gorm:"" json:"hashed_at,omitempty"`         // Nullable, Unix timestamp
 
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // For soft deletes
 
@@ -46,3 +144,28 @@ type Image struct {
 func (Image) TableName() string {
 	return "images"
 }
+
+// AssetPaths returns the relative paths of every generated file of the image: the
+// thumbnail in each size and format, and the video rendition and stream
+func (i *Image) AssetPaths() []string {
+	var thumbs []string
+	if i.ThumbnailPath != nil && *i.ThumbnailPath != "" {
+		thumbs = append(thumbs, *i.ThumbnailPath)
+	}
+	for _, p := range i.ThumbnailSizes {
+		thumbs = append(thumbs, p)
+	}
+
+	paths := append([]string{}, thumbs...)
+	for _, format := range i.ThumbnailFormats {
+		for _, p := range thumbs {
+			// same name with the format as extension, see media.ThumbnailFormatPath
+			paths = append(paths, strings.TrimSuffix(p, path.Ext(p))+"."+format)
+		}
+	}
+	if i.RenditionPath != nil && *i.RenditionPath != "" {
+		paths = append(paths, *i.RenditionPath)
+	}
+	paths = append(paths, i.StreamFiles...)
+	return paths
+}
@@ -0,0 +1,27 @@
+package models
+
+// ImageEmbedding is the CLIP embedding of a whole image, used for semantic search.
+// It corresponds to the 'image_embeddings' table.
+type ImageEmbedding struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ImagePath      string `gorm:"uniqueIndex;not null" json:"image_path"`                                // images.original_path
+	EmbeddingData  []byte `gorm:"not null;column:embedding_data" json:"-"`                               // float32 vector as BLOB, L2-normalized
+	EmbeddingModel string `gorm:"not null;column:embedding_model;default:'clip'" json:"embedding_model"` // Name of the model used for embedding
+	CreatedAt      int64  `gorm:"not null" json:"created_at"`                                            // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt      int64  `gorm:"not null" json:"updated_at"`                                            // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (ImageEmbedding) TableName() string {
+	return "image_embeddings"
+}
+
+// GetEmbedding converts the BLOB data to []float32
+func (ie *ImageEmbedding) GetEmbedding() []float32 {
+	return decodeEmbedding(ie.EmbeddingData)
+}
+
+// SetEmbedding converts []float32 to BLOB data
+func (ie *ImageEmbedding) SetEmbedding(embedding []float32) {
+	ie.EmbeddingData = encodeEmbedding(embedding)
+}
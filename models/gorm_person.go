@@ -8,6 +8,20 @@ type Person struct {
 	CreatedAt   int64  `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
 	UpdatedAt   int64  `gorm:"not null" json:"updated_at"` // Stored as INTEGER in SQLite, Unix timestamp
 
+	// profile
+	BirthDate   *string `gorm:"" json:"birth_date,omitempty"`            // Nullable, YYYY-MM-DD
+	Description *string `gorm:"" json:"description,omitempty"`           // Nullable
+	IsHidden    bool    `gorm:"not null;default:false" json:"is_hidden"` // left out of search and of listings for anonymous visitors
+
+	// the person asked not to be recognized: their faces keep their tags but get no embeddings,
+	// so they are left out of similarity search, auto-tagging and suggestions
+	RecognitionOptOut bool `gorm:"not null;default:false" json:"recognition_opt_out"`
+
+	// profile photo, cropped from a face tagged with the person and stored like user avatars.
+	// the face may since have been deleted or retagged, the photo is kept.
+	ProfileFaceID *uint   `gorm:"" json:"profile_face_id,omitempty"` // Nullable
+	PhotoPath     *string `gorm:"" json:"photo_path,omitempty"`      // Nullable, relative path of the largest avatar size
+
 	// Relationships
 	// omitempty will hide these if they are not preloaded or are empty
 	Aliases []Alias `gorm:"foreignKey:PersonID;constraint:OnDelete:CASCADE" json:"aliases,omitempty"`
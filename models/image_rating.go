@@ -0,0 +1,21 @@
+package models
+
+// MaxImageRating is the highest star rating. a rating of 0 means the image is not rated.
+const MaxImageRating = 5
+
+// ImageRating is a user's favorite flag and star rating of an image. a row exists only while
+// the image is a favorite or rated.
+// It corresponds to the 'image_ratings' table.
+type ImageRating struct {
+	UserID    uint   `gorm:"primaryKey" json:"user_id"`
+	ImagePath string `gorm:"primaryKey;index" json:"image_path"` // images.original_path
+	Favorite  bool   `gorm:"not null;default:false" json:"favorite"`
+	Rating    int    `gorm:"not null;default:0" json:"rating"` // 1 to MaxImageRating stars, 0 when not rated
+	CreatedAt int64  `gorm:"not null" json:"created_at"`       // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt int64  `gorm:"not null" json:"updated_at"`       // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (ImageRating) TableName() string {
+	return "image_ratings"
+}
@@ -19,8 +19,17 @@ type InviteCode struct {
 	IsActive        bool       `json:"is_active" gorm:"default:true"`
 	CreatedByUserID uint       `json:"created_by_user_id"` // ID of the admin user who created the code
 	CreatedByUser   User       `json:"-" gorm:"foreignKey:CreatedByUserID"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// set when the code was emailed to someone
+	Email            *string    `json:"email,omitempty" gorm:"index"`    // Nullable, lower case address the code was sent to
+	BindEmail        bool       `json:"bind_email" gorm:"default:false"` // registration must use Email
+	EmailSentAt      *time.Time `json:"email_sent_at,omitempty"`         // Nullable, last time the invite email was sent
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`             // Nullable, first time the invite link was followed
+	RedeemedAt       *time.Time `json:"redeemed_at,omitempty"`           // Nullable, first registration with the code
+	RedeemedByUserID *uint      `json:"redeemed_by_user_id,omitempty"`   // Nullable, user of the first registration
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // BeforeCreate generates a unique code if not provided
@@ -0,0 +1,29 @@
+package models
+
+// kinds of subjects failed logins are counted for
+const (
+	LoginSubjectUsername  = "username" // lower case username as typed, whether or not the account exists
+	LoginSubjectIP        = "ip"
+	LoginSubjectShareLink = "share_link" // ID of a share link whose passcode was guessed wrong
+)
+
+// LoginFailure counts recent failed logins for a username or client IP and whether logins
+// for it are locked.
+// It corresponds to the 'login_failures' table.
+type LoginFailure struct {
+	Kind          string `gorm:"primaryKey" json:"kind"`
+	Subject       string `gorm:"primaryKey" json:"subject"`
+	Failures      int    `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt int64  `gorm:"not null;index" json:"last_failure_at"`  // Stored as INTEGER in SQLite, Unix timestamp
+	LockedUntil   int64  `gorm:"not null;default:0" json:"locked_until"` // Stored as INTEGER in SQLite, Unix timestamp, 0 when not locked
+}
+
+// TableName explicitly sets the table name for GORM.
+func (LoginFailure) TableName() string {
+	return "login_failures"
+}
+
+// IsLocked reports whether logins for the subject are locked at the given Unix time
+func (f *LoginFailure) IsLocked(now int64) bool {
+	return f.LockedUntil > now
+}
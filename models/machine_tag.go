@@ -0,0 +1,18 @@
+package models
+
+// MachineTag is a label an image classification model gave an image, e.g. "beach" or
+// "food". machine tags are kept apart from the tags users and metadata give images, and are
+// replaced whenever the image is classified again.
+// It corresponds to the 'machine_tags' table.
+type MachineTag struct {
+	ImagePath  string  `gorm:"primaryKey" json:"image_path"` // images.original_path
+	Name       string  `gorm:"primaryKey;index" json:"name"` // lower case label
+	Confidence float32 `gorm:"not null" json:"confidence"`   // probability the model gave the label, 0 to 1
+	Model      string  `gorm:"not null" json:"model"`        // Name of the model that gave the label
+	CreatedAt  int64   `gorm:"not null" json:"created_at"`   // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (MachineTag) TableName() string {
+	return "machine_tags"
+}
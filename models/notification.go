@@ -0,0 +1,109 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// notification types users can turn on or off
+const (
+	NotificationZipReady = "zip_ready" // an album archive the user asked for has been built
+)
+
+// DefaultNotificationPreferences is whether each notification type is emailed to users who
+// have not chosen otherwise
+var DefaultNotificationPreferences = map[string]bool{
+	NotificationZipReady: true,
+}
+
+// NotificationPreference is a user's choice for one notification type. only choices that
+// differ from DefaultNotificationPreferences need a row.
+// It corresponds to the 'notification_preferences' table.
+type NotificationPreference struct {
+	UserID    uint   `gorm:"primaryKey" json:"-"`
+	Type      string `gorm:"primaryKey" json:"type"`
+	Email     bool   `gorm:"not null" json:"email"`
+	UpdatedAt int64  `gorm:"not null" json:"updated_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// ZipWatcher is a user waiting to be told that an album archive is ready.
+// It corresponds to the 'zip_watchers' table.
+type ZipWatcher struct {
+	AlbumID   uint  `gorm:"primaryKey" json:"album_id"`
+	UserID    uint  `gorm:"primaryKey;index" json:"user_id"`
+	CreatedAt int64 `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (ZipWatcher) TableName() string {
+	return "zip_watchers"
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one. only a hash of
+// the token is stored; the token itself is only ever sent in the reset email.
+// It corresponds to the 'password_reset_tokens' table.
+type PasswordResetToken struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"not null;index" json:"user_id"`
+	TokenHash string `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt int64  `gorm:"not null" json:"expires_at"` // Stored as INTEGER in SQLite, Unix timestamp
+	CreatedAt int64  `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// EmailVerificationToken confirms that a user can receive mail at an address. the token is
+// tied to the address so changing it invalidates earlier links.
+// It corresponds to the 'email_verification_tokens' table.
+type EmailVerificationToken struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"not null;index" json:"user_id"`
+	Email     string `gorm:"not null" json:"email"`
+	TokenHash string `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt int64  `gorm:"not null" json:"expires_at"` // Stored as INTEGER in SQLite, Unix timestamp
+	CreatedAt int64  `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (EmailVerificationToken) TableName() string {
+	return "email_verification_tokens"
+}
+
+// GeneratePasswordResetToken creates a new random token, returning the plain text token and
+// its hash
+func GeneratePasswordResetToken() (string, string, error) {
+	return generateEmailToken("password reset")
+}
+
+// GenerateEmailVerificationToken creates a new random token, returning the plain text token
+// and its hash
+func GenerateEmailVerificationToken() (string, string, error) {
+	return generateEmailToken("email verification")
+}
+
+func generateEmailToken(purpose string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate %s token: %w", purpose, err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashEmailToken(token), nil
+}
+
+// HashEmailToken returns the stored representation of a plain text password reset or email
+// verification token
+func HashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
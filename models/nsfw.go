@@ -0,0 +1,16 @@
+package models
+
+// NSFW review states of an image. images that were never flagged have an empty status.
+const (
+	NSFWFlagged   = "flagged"   // scored at least the NSFW threshold, waiting for review
+	NSFWConfirmed = "confirmed" // a reviewer agreed with the flag
+	NSFWCleared   = "cleared"   // a reviewer overruled the flag
+)
+
+// NSFWHiddenStatuses are the NSFW states of the images hidden from public and share views
+var NSFWHiddenStatuses = []string{NSFWFlagged, NSFWConfirmed}
+
+// IsNSFWHidden reports whether the image is hidden from public and share views
+func (img *Image) IsNSFWHidden() bool {
+	return img.NSFWStatus == NSFWFlagged || img.NSFWStatus == NSFWConfirmed
+}
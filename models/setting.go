@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Setting is a runtime override of a configuration value, changed through the admin settings API.
+// Value holds the JSON encoding of the setting's value.
+type Setting struct {
+	Key             string    `json:"key" gorm:"primaryKey"`
+	Value           string    `json:"value" gorm:"type:text;not null"`
+	UpdatedByUserID *uint     `json:"updated_by_user_id,omitempty"` // Nullable
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// TableName explicitly sets the table name for GORM.
+func (Setting) TableName() string {
+	return "settings"
+}
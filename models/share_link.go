@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ShareLink grants anonymous access to a single album through an unguessable token.
+// links can optionally expire, be limited to a number of views, and require a passcode.
+type ShareLink struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Token           string     `json:"token" gorm:"uniqueIndex;not null"`
+	AlbumID         uint       `json:"album_id" gorm:"index;not null"`
+	Album           Album      `json:"-" gorm:"foreignKey:AlbumID"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty" gorm:"index"` // Nullable for no expiration
+	MaxViews        *int       `json:"max_views,omitempty"`               // Nullable for unlimited views
+	Views           int        `json:"views" gorm:"default:0"`
+	PasscodeHash    *string    `json:"-"` // Nullable, bcrypt hash; nil means no passcode
+	IsActive        bool       `json:"is_active" gorm:"default:true"`
+	CreatedByUserID uint       `json:"created_by_user_id"`
+	CreatedByUser   User       `json:"-" gorm:"foreignKey:CreatedByUserID"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName explicitly sets the table name for GORM.
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+// BeforeCreate generates a random token if not provided
+func (sl *ShareLink) BeforeCreate(tx *gorm.DB) (err error) {
+	if sl.Token == "" {
+		token, genErr := generateShareToken()
+		if genErr != nil {
+			return genErr
+		}
+		sl.Token = token
+	}
+	return nil
+}
+
+func generateShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SetPasscode hashes and stores the passcode. an empty passcode removes protection
+func (sl *ShareLink) SetPasscode(passcode string) error {
+	if passcode == "" {
+		sl.PasscodeHash = nil
+		return nil
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(passcode), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	h := string(hashed)
+	sl.PasscodeHash = &h
+	return nil
+}
+
+// HasPasscode reports whether the link is passcode protected
+func (sl *ShareLink) HasPasscode() bool {
+	return sl.PasscodeHash != nil && *sl.PasscodeHash != ""
+}
+
+// CheckPasscode compares a passcode with the stored hash
+func (sl *ShareLink) CheckPasscode(passcode string) bool {
+	if !sl.HasPasscode() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*sl.PasscodeHash), []byte(passcode)) == nil
+}
+
+// IsExpired checks if the link is past its expiry time
+func (sl *ShareLink) IsExpired() bool {
+	return sl.ExpiresAt != nil && time.Now().After(*sl.ExpiresAt)
+}
+
+// ViewsExhausted checks if the link has reached its maximum number of views
+func (sl *ShareLink) ViewsExhausted() bool {
+	return sl.MaxViews != nil && sl.Views >= *sl.MaxViews
+}
@@ -0,0 +1,39 @@
+package models
+
+import "gorm.io/gorm"
+
+// SmartAlbum is an album whose contents are computed from filter rules evaluated against the
+// images table, instead of being the files of a folder.
+// It corresponds to the 'smart_albums' table.
+type SmartAlbum struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string         `gorm:"not null;unique" json:"name"`
+	Slug        string         `gorm:"not null;unique" json:"slug"`
+	Description *string        `gorm:"" json:"description,omitempty"` // Nullable
+	Rules       string         `gorm:"type:text;not null" json:"-"`   // JSON encoding of SmartAlbumRules
+	SortOrder   string         `gorm:"not null;default:'date_desc'" json:"sort_order"`
+	IsHidden    bool           `gorm:"not null;default:false" json:"-"`
+	CreatedAt   int64          `gorm:"not null" json:"created_at"`        // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt   int64          `gorm:"not null" json:"updated_at"`        // Stored as INTEGER in SQLite, Unix timestamp
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"` // For soft deletes
+}
+
+// TableName explicitly sets the table name for GORM.
+func (SmartAlbum) TableName() string {
+	return "smart_albums"
+}
+
+// SmartAlbumRules selects the images of a smart album. every rule that is set must match;
+// a list matches if any of its values does.
+type SmartAlbumRules struct {
+	TakenAfter   *int64   `json:"taken_after,omitempty"`  // Unix timestamp, inclusive
+	TakenBefore  *int64   `json:"taken_before,omitempty"` // Unix timestamp, exclusive
+	CameraMakes  []string `json:"camera_makes,omitempty"` // case-insensitive
+	CameraModels []string `json:"camera_models,omitempty"`
+	PersonIDs    []uint   `json:"person_ids,omitempty"`   // images with a face tagged as any of these people
+	FolderGlobs  []string `json:"folder_globs,omitempty"` // matched against the path relative to the root; '*' also matches '/'
+	MediaType    string   `json:"media_type,omitempty"`   // "image", "video" or "document"
+	Locations    []string `json:"locations,omitempty"`    // city, region or country names, case-insensitive
+	Tags         []string `json:"tags,omitempty"`         // tag names, case-insensitive
+	MachineTags  []string `json:"machine_tags,omitempty"` // labels given by image classification, case-insensitive
+}
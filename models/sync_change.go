@@ -0,0 +1,28 @@
+package models
+
+// entities of the sync log
+const (
+	SyncEntityImage = "image"
+	SyncEntityAlbum = "album"
+	SyncEntityFace  = "face"
+
+	// SyncEntityReset marks where the log was started over, e.g. after a restore
+	SyncEntityReset = "reset"
+)
+
+// SyncChange is the latest change of an image, album or face, for client apps that mirror the
+// library. rows are written by triggers on the tracked tables and never deleted, so a deleted
+// entity stays known as a tombstone. Seq grows with every change across all entities.
+// It corresponds to the 'sync_changes' table.
+type SyncChange struct {
+	Entity    string `gorm:"primaryKey" json:"entity"`              // SyncEntityImage, SyncEntityAlbum or SyncEntityFace
+	Key       string `gorm:"primaryKey" json:"key"`                 // original path of images, ID of albums and faces
+	Seq       int64  `gorm:"not null;uniqueIndex" json:"seq"`       // position in the log, the sync cursor
+	Deleted   bool   `gorm:"not null;default:false" json:"deleted"` // deleted or soft deleted
+	ChangedAt int64  `gorm:"not null" json:"changed_at"`            // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (SyncChange) TableName() string {
+	return "sync_changes"
+}
@@ -0,0 +1,51 @@
+package models
+
+import "strings"
+
+const (
+	// TagSourceUser marks a tag added to an image through the API
+	TagSourceUser = "user"
+	// TagSourceMetadata marks a tag read from the IPTC/XMP keywords of the file. these are
+	// replaced whenever the metadata is extracted again.
+	TagSourceMetadata = "metadata"
+)
+
+// Tag is a keyword images can be labelled with. names are unique regardless of case.
+// It corresponds to the 'tags' table.
+type Tag struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string `gorm:"not null" json:"name"`
+	NameKey   string `gorm:"not null;uniqueIndex" json:"-"` // lower case Name, for case-insensitive lookups
+	CreatedAt int64  `gorm:"not null" json:"created_at"`    // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt int64  `gorm:"not null" json:"updated_at"`    // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// SetName stores a normalized name and its lookup key
+func (t *Tag) SetName(name string) {
+	t.Name = NormalizeTagName(name)
+	t.NameKey = strings.ToLower(t.Name)
+}
+
+// NormalizeTagName trims a tag name and collapses the whitespace inside it
+func NormalizeTagName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ImageTag links an image to a tag.
+// It corresponds to the 'image_tags' table.
+type ImageTag struct {
+	ImagePath string `gorm:"primaryKey" json:"image_path"` // images.original_path
+	TagID     uint   `gorm:"primaryKey;index" json:"tag_id"`
+	Source    string `gorm:"not null;default:'user'" json:"source"` // TagSourceUser or TagSourceMetadata
+	CreatedAt int64  `gorm:"not null" json:"created_at"`            // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (ImageTag) TableName() string {
+	return "image_tags"
+}
@@ -8,13 +8,18 @@ import (
 
 // User represents an artist or administrator in the system
 type User struct {
-	ID                uint     `json:"id" gorm:"primaryKey"`
-	Username          string   `json:"username" gorm:"uniqueIndex;not null"`
-	FirstName         string   `json:"first_name"`
-	LastName          string   `json:"last_name"`
-	PasswordHash      string   `json:"-" gorm:"not null"`                            // "-" means don't include in JSON responses
-	GlobalPermissions []string `json:"global_permissions" gorm:"serializer:json"`    // Use JSON serializer
-	Roles             []*Role  `json:"roles,omitempty" gorm:"many2many:user_roles;"` // Roles assigned to the user
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	Username          string     `json:"username" gorm:"uniqueIndex;not null"`
+	FirstName         string     `json:"first_name"`
+	LastName          string     `json:"last_name"`
+	Email             *string    `json:"email,omitempty" gorm:"uniqueIndex"`           // Nullable, stored lower case; where notifications are sent
+	EmailVerifiedAt   *time.Time `json:"email_verified_at,omitempty"`                  // Nullable, when the user confirmed Email
+	AvatarPath        *string    `json:"avatar_path,omitempty"`                        // Nullable, relative path of the largest avatar size
+	UploadQuotaMB     *int       `json:"upload_quota_mb,omitempty"`                    // Nullable, overrides the configured quota; 0 is unlimited
+	PersonID          *uint      `json:"person_id,omitempty" gorm:"uniqueIndex"`       // Nullable, the person the user is in photos, set by admins
+	PasswordHash      string     `json:"-" gorm:"not null"`                            // "-" means don't include in JSON responses
+	GlobalPermissions []string   `json:"global_permissions" gorm:"serializer:json"`    // Use JSON serializer
+	Roles             []*Role    `json:"roles,omitempty" gorm:"many2many:user_roles;"` // Roles assigned to the user
 	// AlbumPermissions stores permissions specific to certain albums.
 	// Key: AlbumID (as string, since GORM might handle complex map keys better as JSON or serialized string)
 	// Value: List of permission strings for that album
@@ -25,8 +30,12 @@ type User struct {
 	// For now, let's assume we'll handle serialization/deserialization if using a single JSON field.
 	// A more robust way is a separate UserAlbumPermission table: UserID, AlbumID, Permission
 	AlbumPermissionsMap map[string][]string `json:"album_permissions_map" gorm:"-"` // not directly mapped, handled by logic
-	CreatedAt           time.Time           `json:"created_at"`
-	UpdatedAt           time.Time           `json:"updated_at"`
+	// APIToken is set when the request was authenticated with a personal API token,
+	// in which case permission checks are limited to what the token allows
+	APIToken   *ApiToken  `json:"-" gorm:"-"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty" gorm:"index"` // Nullable, last authenticated request, updated every few minutes
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
 // UserAlbumPermission defines the relationship and permissions a user has for a specific album
@@ -57,8 +66,17 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// HasUnverifiedEmail reports whether the user has an email address they have not confirmed yet
+func (u *User) HasUnverifiedEmail() bool {
+	return u.Email != nil && u.EmailVerifiedAt == nil
+}
+
 // HasGlobalPermission checks if the user has a specific global permission, considering both direct permissions and permissions from roles
 func (u *User) HasGlobalPermission(permission string) bool {
+	if u.APIToken != nil && !u.APIToken.AllowsPermission(permission) {
+		return false
+	}
+
 	// check direct global permissions
 	for _, p := range u.GlobalPermissions {
 		if p == permission {
@@ -115,6 +133,13 @@ func (u *User) getAllAlbumPermissionsSet(albumID uint) map[string]struct{} {
 // GetAlbumPermissions returns a slice of unique permissions for a specific album, considering both direct user permissions and permissions from roles
 func (u *User) GetAlbumPermissions(albumID uint) []string {
 	permSet := u.getAllAlbumPermissionsSet(albumID)
+	if u.APIToken != nil {
+		for p := range permSet {
+			if !u.APIToken.AllowsPermission(p) || !u.APIToken.AllowsAlbum(albumID) {
+				delete(permSet, p)
+			}
+		}
+	}
 	if len(permSet) == 0 {
 		return []string{}
 	}
@@ -127,6 +152,9 @@ func (u *User) GetAlbumPermissions(albumID uint) []string {
 
 // HasAlbumPermission checks if the user has a specific permission for a given album, considering both direct user permissions and permissions from roles
 func (u *User) HasAlbumPermission(albumID uint, permission string) bool {
+	if u.APIToken != nil && (!u.APIToken.AllowsPermission(permission) || !u.APIToken.AllowsAlbum(albumID)) {
+		return false
+	}
 	permSet := u.getAllAlbumPermissionsSet(albumID)
 	_, ok := permSet[permission]
 	return ok
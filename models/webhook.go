@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// webhook events
+const (
+	WebhookEventImageProcessed = "image.processed"
+	WebhookEventAlbumZipDone   = "album.zip.done"
+	WebhookEventFaceTagged     = "face.tagged"
+	WebhookEventUserRegistered = "user.registered"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookEventImageProcessed,
+	WebhookEventAlbumZipDone,
+	WebhookEventFaceTagged,
+	WebhookEventUserRegistered,
+}
+
+// delivery statuses
+const (
+	WebhookDeliveryPending   = "pending" // waiting for its first attempt or a retry
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // gave up after the last attempt
+)
+
+// IsWebhookEvent reports whether the event is one webhooks can subscribe to
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is a URL that receives a signed JSON POST for each of the events it subscribes to.
+// It corresponds to the 'webhooks' table.
+type Webhook struct {
+	ID        uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	URL       string   `gorm:"not null" json:"url"`
+	Secret    string   `gorm:"not null" json:"-"` // HMAC-SHA256 key of the payload signature
+	Events    []string `gorm:"serializer:json" json:"events"`
+	IsActive  bool     `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt int64    `gorm:"not null" json:"created_at"` // Stored as INTEGER in SQLite, Unix timestamp
+	UpdatedAt int64    `gorm:"not null" json:"updated_at"` // Stored as INTEGER in SQLite, Unix timestamp
+}
+
+// TableName explicitly sets the table name for GORM.
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// Subscribes reports whether the webhook receives the event
+func (wh *Webhook) Subscribes(event string) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateWebhookSecret creates a random signing secret
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WebhookDelivery is one event sent to a webhook, with the outcome of its last attempt.
+// It corresponds to the 'webhook_deliveries' table.
+type WebhookDelivery struct {
+	ID             uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	WebhookID      uint    `gorm:"not null;index" json:"webhook_id"`
+	Event          string  `gorm:"not null" json:"event"`
+	Payload        string  `gorm:"not null" json:"payload"` // the exact JSON body that is signed and sent
+	Status         string  `gorm:"not null;default:'pending';index" json:"status"`
+	Attempts       int     `gorm:"not null;default:0" json:"attempts"`
+	ResponseStatus *int    `json:"response_status,omitempty"` // HTTP status of the last attempt, nil if no response
+	Error          *string `json:"error,omitempty"`           // why the last attempt failed
+	NextAttemptAt  *int64  `json:"next_attempt_at,omitempty"` // Stored as INTEGER in SQLite, Unix timestamp
+	LastAttemptAt  *int64  `json:"last_attempt_at,omitempty"` // Stored as INTEGER in SQLite, Unix timestamp
+	CreatedAt      int64   `gorm:"not null;index" json:"created_at"`
+}
+
+// TableName explicitly sets the table name for GORM.
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -147,6 +147,12 @@ var DefinedPermissionGroups = []PermissionGroupDefinition{
 				Description: "Allows viewing the photos and videos within an album.",
 				Scope:       ScopeAlbum,
 			},
+			{
+				Key:         "album.download",
+				Name:        "Download Album",
+				Description: "Allows downloading the files of a hidden album, individually or as a ZIP archive.",
+				Scope:       ScopeAlbum,
+			},
 			// album-specific permissions that are typically assigned per-album rather than globally
 			{
 				Key:         "album.photo.upload",
@@ -203,6 +209,36 @@ var DefinedPermissionGroups = []PermissionGroupDefinition{
 				Description: "Allows accessing and viewing system logs.",
 				Scope:       ScopeGlobal,
 			},
+			{
+				Key:         "system.diagnostics",
+				Name:        "Run Diagnostics",
+				Description: "Allows inspecting face embeddings and comparing the similarity of any faces.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "system.stats.view",
+				Name:        "View Dashboard Statistics",
+				Description: "Allows viewing library, storage, queue and user activity statistics, including their live stream.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "system.backup",
+				Name:        "Manage Backups",
+				Description: "Allows creating, downloading and deleting backups of the database and runtime settings.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "system.restore",
+				Name:        "Restore Backups",
+				Description: "Allows uploading backups and replacing the database with one.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "system.import",
+				Name:        "Import Libraries",
+				Description: "Allows importing Google Takeout exports and folders with JSON sidecars from the import folder into the library.",
+				Scope:       ScopeGlobal,
+			},
 		},
 	},
 	{
@@ -242,6 +278,126 @@ var DefinedPermissionGroups = []PermissionGroupDefinition{
 			},
 		},
 	},
+	{
+		Key:         "job",
+		Name:        "Job Management",
+		Description: "Permissions related to the background processing queue.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "job.list",
+				Name:        "List Jobs",
+				Description: "Allows viewing queued, processing and failed background jobs.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "job.manage",
+				Name:        "Manage Jobs",
+				Description: "Allows cancelling queued jobs and retrying failed ones.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
+	{
+		Key:         "share",
+		Name:        "Share Link Management",
+		Description: "Permissions related to managing public album share links.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "share.create",
+				Name:        "Create Share Links",
+				Description: "Allows creating share links for albums, including expiry, view limits and passcodes.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "share.list",
+				Name:        "List Share Links",
+				Description: "Allows viewing the share links of an album.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "share.edit",
+				Name:        "Edit Share Links",
+				Description: "Allows modifying share links (e.g., expiry, max views, passcode, active status).",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "share.delete",
+				Name:        "Delete Share Links",
+				Description: "Allows deleting share links.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
+	{
+		Key:         "tag",
+		Name:        "Tag Management",
+		Description: "Permissions related to image tags.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "tag.manage",
+				Name:        "Manage Tags",
+				Description: "Allows creating, renaming and deleting tags.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "tag.assign",
+				Name:        "Tag Images",
+				Description: "Allows adding tags to and removing tags from images.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
+	{
+		Key:         "webhook",
+		Name:        "Webhooks",
+		Description: "Permissions related to outgoing webhooks.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "webhook.manage",
+				Name:        "Manage Webhooks",
+				Description: "Allows registering, changing and deleting webhooks and viewing their delivery logs.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
+	{
+		Key:         "nsfw",
+		Name:        "NSFW Review",
+		Description: "Permissions related to images flagged as NSFW.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "nsfw.review",
+				Name:        "Review NSFW Flags",
+				Description: "Allows listing images flagged as NSFW and confirming or clearing their flags.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
+	{
+		Key:         "face",
+		Name:        "Faces and People",
+		Description: "Permissions related to faces and the people tagged in them.",
+		Permissions: []PermissionDefinition{
+			{
+				Key:         "face.tag",
+				Name:        "Tag Faces",
+				Description: "Allows tagging faces with people in bulk, such as whole clusters of similar faces, and reviewing suggested people for faces.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "face.search",
+				Name:        "Search by Face",
+				Description: "Allows searching the library for a person by uploading an example photo of their face.",
+				Scope:       ScopeGlobal,
+			},
+			{
+				Key:         "person.edit",
+				Name:        "Edit People",
+				Description: "Allows changing the profiles of people: their profile photos, birth dates and descriptions, whether they are hidden and whether they opted out of face recognition.",
+				Scope:       ScopeGlobal,
+			},
+		},
+	},
 }
 
 var (
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -17,29 +19,52 @@ type Event struct {
 	Status    string                 `json:"status,omitempty"`
 	Error     string                 `json:"error,omitempty"`
 	Extra     map[string]interface{} `json:"extra,omitempty"`
+	UserID    uint                   `json:"user_id,omitempty"` // the user who started it, if any
 	Timestamp int64                  `json:"timestamp"`
+
+	// Topic publishes the event on this topic alone, instead of the topics Access picks
+	Topic string `json:"-"`
+}
+
+// subscriptionRequest is a message clients send to change their topics
+type subscriptionRequest struct {
+	Action string   `json:"action"` // "subscribe" or "unsubscribe"
+	Topics []string `json:"topics"`
 }
 
 type Client struct {
 	conn *websocket.Conn
 	send chan []byte
+
+	canSubscribe func(topic string) bool
+	mu           sync.Mutex
+	topics       map[string]bool // subscribed topics, nil for every topic the client may read
+	allowed      map[string]bool // topics the client may read, cached for the connection
 }
 
-// Hub is a simple global pubsub for websocket clients
+// message is an encoded event and the topics it is published on
+type message struct {
+	data   []byte
+	topics []string
+}
+
+// Hub is a pubsub for websocket clients. without an Access every client receives every event.
 type Hub struct {
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
-	broadcast  chan []byte
+	broadcast  chan message
+	access     Access
 	mu         sync.RWMutex
 }
 
-func NewHub() *Hub {
+func NewHub(access Access) *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		broadcast:  make(chan []byte, 256),
+		broadcast:  make(chan message, 256),
+		access:     access,
 	}
 }
 
@@ -57,11 +82,14 @@ func (h *Hub) Run() {
 				close(client.send)
 			}
 			h.mu.Unlock()
-		case message := <-h.broadcast:
+		case msg := <-h.broadcast:
 			h.mu.RLock()
 			for client := range h.clients {
+				if !client.receives(msg.topics) {
+					continue
+				}
 				select {
-				case client.send <- message:
+				case client.send <- msg.data:
 				default:
 					close(client.send)
 					delete(h.clients, client)
@@ -73,13 +101,30 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) Broadcast(event Event) {
+	// finding the topics may hit the database, which is pointless without clients
+	h.mu.RLock()
+	idle := len(h.clients) == 0
+	h.mu.RUnlock()
+	if idle {
+		return
+	}
+
 	encoded, err := json.Marshal(event)
 	if err != nil {
 		log.Printf("realtime: failed to marshal event: %v", err)
 		return
 	}
+	msg := message{data: encoded}
+	if event.Topic != "" {
+		msg.topics = []string{event.Topic}
+	} else if h.access != nil {
+		msg.topics = h.access.EventTopics(event)
+		if len(msg.topics) == 0 {
+			return
+		}
+	}
 	select {
-	case h.broadcast <- encoded:
+	case h.broadcast <- msg:
 	default:
 		log.Printf("realtime: dropping event, broadcast channel full")
 	}
@@ -89,14 +134,26 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// ServeWS upgrades the connection and registers a client
+// ServeWS upgrades the connection and registers a client. the client is subscribed to the
+// comma separated topics query param, or to every topic it may read if there is none, and can
+// change its topics by sending {"action": "subscribe"|"unsubscribe", "topics": [...]}. each
+// change is answered with a "subscription" event listing the topics subscribed to and those
+// denied.
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("realtime: websocket upgrade error: %v", err)
 		return
 	}
-	client := &Client{conn: conn, send: make(chan []byte, 256)}
+	client := &Client{conn: conn, send: make(chan []byte, 256), allowed: make(map[string]bool)}
+	client.canSubscribe = func(topic string) bool {
+		return h.access == nil || h.access.CanSubscribe(r, topic)
+	}
+	if raw := r.URL.Query().Get("topics"); raw != "" {
+		subscribed, denied := client.subscribe(strings.Split(raw, ","))
+		// queued before registering, so it is the first message the client gets
+		client.send <- subscriptionEvent("subscribed", subscribed, denied)
+	}
 	h.register <- client
 
 	// writer
@@ -109,11 +166,138 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		client.conn.Close()
 	}()
 
-	// reader (just consume pings/close)
+	// reader: subscription changes, pings and close
 	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			break
 		}
+		var request subscriptionRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			continue
+		}
+		var reply []byte
+		switch request.Action {
+		case "subscribe":
+			subscribed, denied := client.subscribe(request.Topics)
+			reply = subscriptionEvent("subscribed", subscribed, denied)
+		case "unsubscribe":
+			reply = subscriptionEvent("unsubscribed", client.unsubscribe(request.Topics), nil)
+		default:
+			continue
+		}
+		h.sendTo(client, reply)
 	}
 	h.unregister <- client
 }
+
+// ClientCount returns the number of connected clients
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// sendTo queues a message for a single client, unless it was dropped
+func (h *Hub) sendTo(client *Client, msg []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.clients[client] {
+		return
+	}
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+func subscriptionEvent(status string, topics, denied []string) []byte {
+	if topics == nil {
+		topics = []string{}
+	}
+	extra := map[string]interface{}{"topics": topics}
+	if len(denied) > 0 {
+		extra["denied"] = denied
+	}
+	encoded, _ := json.Marshal(Event{Type: "subscription", Status: status, Extra: extra, Timestamp: time.Now().Unix()})
+	return encoded
+}
+
+// subscribe adds the topics the client may read to its subscriptions and returns all of
+// them, along with the topics it was denied
+func (c *Client) subscribe(topics []string) ([]string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]bool)
+	}
+	var denied []string
+	for _, topic := range topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if c.mayReadLocked(topic) {
+			c.topics[topic] = true
+		} else {
+			denied = append(denied, topic)
+		}
+	}
+	return c.subscribedLocked(), denied
+}
+
+// unsubscribe removes topics from the client's subscriptions and returns the remaining ones.
+// a client still subscribed to everything it may read is left with nothing once it
+// unsubscribes.
+func (c *Client) unsubscribe(topics []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]bool)
+	}
+	for _, topic := range topics {
+		delete(c.topics, strings.TrimSpace(topic))
+	}
+	return c.subscribedLocked()
+}
+
+func (c *Client) subscribedLocked() []string {
+	subscribed := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		subscribed = append(subscribed, topic)
+	}
+	return subscribed
+}
+
+// receives reports whether the client gets an event published on topics. events published
+// without topics go to every client.
+func (c *Client) receives(topics []string) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		if c.topics == nil && topic == StatsTopic {
+			continue
+		}
+		if c.topics != nil && !c.topics[topic] {
+			continue
+		}
+		if c.mayReadLocked(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayReadLocked checks whether the client may read a topic. the answer is kept for the rest
+// of the connection, so access changes apply when the client reconnects. c.mu must be held.
+func (c *Client) mayReadLocked(topic string) bool {
+	allowed, ok := c.allowed[topic]
+	if !ok {
+		allowed = c.canSubscribe(topic)
+		c.allowed[topic] = allowed
+	}
+	return allowed
+}
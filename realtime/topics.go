@@ -0,0 +1,34 @@
+package realtime
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// SystemTopic carries the events outside of any album, e.g. library integrity checks and
+// tasks on files no album holds
+const SystemTopic = "system"
+
+// StatsTopic carries the periodic stats of the admin dashboard. clients only receive it once
+// they subscribe to it by name.
+const StatsTopic = "stats"
+
+// AlbumTopic carries the events of the files in an album
+func AlbumTopic(albumID uint) string {
+	return fmt.Sprintf("album:%d", albumID)
+}
+
+// UserTopic carries the events started by a user, e.g. their uploads
+func UserTopic(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Access decides which events the client of a websocket connection receives. every event is
+// published on one or more topics; a client receives it if it is subscribed to, and allowed
+// to read, any of them.
+type Access interface {
+	// EventTopics returns the topics an event is published on
+	EventTopics(event Event) []string
+	// CanSubscribe reports whether the client of the websocket request r may read topic
+	CanSubscribe(r *http.Request, topic string) bool
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// ActivityRepository handles database operations for Activity entities
+type ActivityRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure ActivityRepository implements ActivityRepositoryInterface
+var _ ActivityRepositoryInterface = (*ActivityRepository)(nil)
+
+// NewActivityRepository creates a new instance of ActivityRepository
+func NewActivityRepository(db *gorm.DB) *ActivityRepository {
+	return &ActivityRepository{DB: db}
+}
+
+// ActivityEntry is an activity with the names of the album, user and person it refers to.
+// names are empty when the record has since been deleted.
+type ActivityEntry struct {
+	models.Activity
+	AlbumName  string `json:"album_name"`
+	AlbumSlug  string `json:"album_slug"`
+	Username   string `json:"username,omitempty"`
+	PersonName string `json:"person_name,omitempty"`
+}
+
+// Create records an activity, timestamped now unless CreatedAt is set
+func (r *ActivityRepository) Create(activity *models.Activity) error {
+	if activity.CreatedAt == 0 {
+		activity.CreatedAt = time.Now().Unix()
+	}
+	if err := r.DB.Create(activity).Error; err != nil {
+		return fmt.Errorf("failed to record %s activity for album %d: %w", activity.Type, activity.AlbumID, err)
+	}
+	return nil
+}
+
+// ListByAlbums returns a page of the activities of the given albums, newest first, together
+// with the total number of them
+func (r *ActivityRepository) ListByAlbums(albumIDs []uint, offset, limit int) ([]ActivityEntry, int64, error) {
+	if len(albumIDs) == 0 {
+		return []ActivityEntry{}, 0, nil
+	}
+
+	var total int64
+	if err := r.DB.Model(&models.Activity{}).Where("album_id IN ?", albumIDs).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count activities: %w", err)
+	}
+
+	query := r.DB.Model(&models.Activity{}).
+		Select("activities.*, albums.name AS album_name, albums.slug AS album_slug, users.username AS username, people.primary_name AS person_name").
+		Joins("JOIN albums ON albums.id = activities.album_id").
+		Joins("LEFT JOIN users ON users.id = activities.user_id").
+		Joins("LEFT JOIN people ON people.id = activities.person_id").
+		Where("activities.album_id IN ?", albumIDs).
+		Order("activities.created_at DESC").
+		Order("activities.id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var entries []ActivityEntry
+	if err := query.Scan(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list activities: %w", err)
+	}
+	if entries == nil {
+		entries = []ActivityEntry{}
+	}
+	return entries, total, nil
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/camden-git/mediasysbackend/database"
 	"github.com/camden-git/mediasysbackend/models"
@@ -21,6 +23,14 @@ func NewAlbumRepository(db *gorm.DB) *AlbumRepository {
 	return &AlbumRepository{DB: db}
 }
 
+// WithTx runs fn with a repository bound to a single transaction. what fn does through it is
+// committed when fn returns nil and rolled back otherwise.
+func (r *AlbumRepository) WithTx(fn func(repo AlbumRepositoryInterface) error) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(&AlbumRepository{DB: tx})
+	})
+}
+
 // Create creates a new album record in the database
 func (r *AlbumRepository) Create(album *models.Album) error {
 	now := time.Now().Unix()
@@ -37,8 +47,17 @@ func (r *AlbumRepository) Create(album *models.Album) error {
 	if album.ZipStatus == "" {
 		album.ZipStatus = database.StatusNotRequired
 	}
+	if album.ContactSheetStatus == "" {
+		album.ContactSheetStatus = database.StatusNotRequired
+	}
 
-	err := r.DB.Create(album).Error
+	// the album takes over the slug if it was one of another album before
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(album).Error; err != nil {
+			return err
+		}
+		return tx.Where("slug = ?", album.Slug).Delete(&models.AlbumSlugRedirect{}).Error
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create album %s: %w", album.Name, err)
 	}
@@ -94,6 +113,52 @@ func (r *AlbumRepository) GetBySlug(slug string) (*models.Album, error) {
 	return &album, nil
 }
 
+// GetBySlugRedirect retrieves the album a former slug redirects to
+func (r *AlbumRepository) GetBySlugRedirect(slug string) (*models.Album, error) {
+	var album models.Album
+	err := r.DB.Joins("JOIN album_slug_redirects ON album_slug_redirects.album_id = albums.id").
+		Where("album_slug_redirects.slug = ?", slug).
+		First(&album).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get album by slug redirect %s: %w", slug, err)
+	}
+	return &album, nil
+}
+
+// GetByFolderPath retrieves the album of a folder, relative to the root
+func (r *AlbumRepository) GetByFolderPath(folderPath string) (*models.Album, error) {
+	cleanPath := filepath.ToSlash(folderPath)
+	var album models.Album
+	err := r.DB.Where("folder_path = ?", cleanPath).First(&album).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get album of folder %s: %w", cleanPath, err)
+	}
+	return &album, nil
+}
+
+// FindByImagePath retrieves the album whose folder holds an image, directly or in a
+// subfolder. when album folders are nested the innermost one wins.
+func (r *AlbumRepository) FindByImagePath(imagePath string) (*models.Album, error) {
+	cleanPath := filepath.ToSlash(imagePath)
+	var album models.Album
+	err := r.DB.Where("substr(?, 1, length(folder_path) + 1) = folder_path || '/'", cleanPath).
+		Order("length(folder_path) DESC").
+		First(&album).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find album of %s: %w", cleanPath, err)
+	}
+	return &album, nil
+}
+
 // Update updates an existing album's name, description, hidden status, and location
 // other fields are updated by specific methods
 func (r *AlbumRepository) Update(albumID uint, name string, description *string, isHidden *bool, location *string) error {
@@ -160,8 +225,9 @@ func (r *AlbumRepository) RequestZip(albumID uint) error {
 func (r *AlbumRepository) MarkZipProcessing(albumID uint) error {
 	now := time.Now().Unix()
 	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
-		"zip_status": database.StatusProcessing,
-		"updated_at": now,
+		"zip_status":   database.StatusProcessing,
+		"zip_progress": 0,
+		"updated_at":   now,
 	})
 	if result.Error != nil {
 		return fmt.Errorf("failed to mark zip processing for album ID %d: %w", albumID, result.Error)
@@ -172,6 +238,15 @@ func (r *AlbumRepository) MarkZipProcessing(albumID uint) error {
 	return nil
 }
 
+// SetZipProgress records how far along a processing zip generation is, in percent
+func (r *AlbumRepository) SetZipProgress(albumID uint, percent int) error {
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Update("zip_progress", percent)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set zip progress for album ID %d: %w", albumID, result.Error)
+	}
+	return nil
+}
+
 // SetZipResult updates album with the result of a zip generation task
 func (r *AlbumRepository) SetZipResult(albumID uint, zipPath *string, zipSize *int64, taskErr error) error {
 	now := time.Now().Unix()
@@ -194,6 +269,7 @@ func (r *AlbumRepository) SetZipResult(albumID uint, zipPath *string, zipSize *i
 		updates["zip_path"] = zipPath
 		updates["zip_size"] = zipSize
 		updates["zip_last_generated_at"] = now
+		updates["zip_progress"] = 100
 	}
 
 	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(updates)
@@ -204,6 +280,89 @@ func (r *AlbumRepository) SetZipResult(albumID uint, zipPath *string, zipSize *i
 	return nil
 }
 
+// RequestContactSheet marks the contact sheet of an album as pending generation
+func (r *AlbumRepository) RequestContactSheet(albumID uint) error {
+	now := time.Now().Unix()
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+		"contact_sheet_status": database.StatusPending,
+		"contact_sheet_error":  gorm.Expr("NULL"),
+		"updated_at":           now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to request contact sheet for album ID %d: %w", albumID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkContactSheetProcessing updates album status to indicate its contact sheet is being generated
+func (r *AlbumRepository) MarkContactSheetProcessing(albumID uint) error {
+	now := time.Now().Unix()
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+		"contact_sheet_status": database.StatusProcessing,
+		"updated_at":           now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark contact sheet processing for album ID %d: %w", albumID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetContactSheetResult updates album with the result of a contact sheet generation task. a
+// failed generation keeps the previous sheet.
+func (r *AlbumRepository) SetContactSheetResult(albumID uint, sheetPath *string, taskErr error) error {
+	now := time.Now().Unix()
+	status := database.StatusDone
+	var errStr *string
+
+	if taskErr != nil {
+		status = database.StatusError
+		s := taskErr.Error()
+		errStr = &s
+	}
+
+	updates := map[string]interface{}{
+		"contact_sheet_status": status,
+		"contact_sheet_error":  errStr,
+		"updated_at":           now,
+	}
+	if status == database.StatusDone {
+		updates["contact_sheet_path"] = sheetPath
+		updates["contact_sheet_generated_at"] = now
+	}
+
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set contact sheet result for album ID %d: %w", albumID, result.Error)
+	}
+	return nil
+}
+
+// UpdateWatermark replaces the watermark settings of an album. nil text and imagePath
+// remove the watermark
+func (r *AlbumRepository) UpdateWatermark(albumID uint, text *string, imagePath *string, position string, opacity float64) error {
+	now := time.Now().Unix()
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+		"watermark_text":       text,
+		"watermark_image_path": imagePath,
+		"watermark_position":   position,
+		"watermark_opacity":    opacity,
+		"updated_at":           now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update watermark for album ID %d: %w", albumID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // UpdateBannerPath updates the banner image path for an album
 func (r *AlbumRepository) UpdateBannerPath(albumID uint, bannerPath *string) error {
 	now := time.Now().Unix()
@@ -220,6 +379,38 @@ func (r *AlbumRepository) UpdateBannerPath(albumID uint, bannerPath *string) err
 	return nil
 }
 
+// UpdateSlug changes the slug of an album, keeping the former slug as a redirect to it. a
+// redirect holding the new slug, e.g. when a slug is changed back, is dropped.
+func (r *AlbumRepository) UpdateSlug(albumID uint, slug string) error {
+	now := time.Now().Unix()
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var album models.Album
+		if err := tx.Select("id", "slug").First(&album, albumID).Error; err != nil {
+			return err
+		}
+		if album.Slug == slug {
+			return nil
+		}
+		if err := tx.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+			"slug":       slug,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("slug = ?", slug).Delete(&models.AlbumSlugRedirect{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&models.AlbumSlugRedirect{Slug: album.Slug, AlbumID: albumID, CreatedAt: now}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update slug for album ID %d: %w", albumID, err)
+	}
+	return nil
+}
+
 // UpdateSortOrder updates the sort order for an album
 // assumes sortOrder string is validated externally (e.g., by a service layer or IsValidSortOrder)
 func (r *AlbumRepository) UpdateSortOrder(albumID uint, sortOrder string) error {
@@ -241,15 +432,166 @@ func (r *AlbumRepository) UpdateSortOrder(albumID uint, sortOrder string) error
 	return nil
 }
 
-// Delete removes an album by its ID
-// this will perform a soft delete because models.Album has gorm.DeletedAt
-func (r *AlbumRepository) Delete(id uint) error {
-	result := r.DB.Delete(&models.Album{}, id)
+// SetArchived archives an album, making it read-only, or makes it editable again
+func (r *AlbumRepository) SetArchived(albumID uint, archived bool) error {
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+		"is_archived": archived,
+		"updated_at":  time.Now().Unix(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to set archived state for album ID %d: %w", albumID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateRights sets the copyright holder and license of an album. nil values are cleared.
+func (r *AlbumRepository) UpdateRights(albumID uint, copyright, license *string) error {
+	result := r.DB.Model(&models.Album{}).Where("id = ?", albumID).Updates(map[string]interface{}{
+		"copyright":  copyright,
+		"license":    license,
+		"updated_at": time.Now().Unix(),
+	})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete album ID %d: %w", id, result.Error)
+		return fmt.Errorf("failed to update rights for album ID %d: %w", albumID, result.Error)
 	}
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
 	return nil
 }
+
+// MoveFolder rewrites every path under an album folder after the folder was renamed on
+// disk: the folder of the album and of any album nested in it, the image records, their
+// faces and their embeddings. soft-deleted image records left under the new folder are purged first, since the
+// image path is the primary key. the moved albums are assigned to newLibraryID.
+func (r *AlbumRepository) MoveFolder(oldFolder, newFolder, newLibraryID string) error {
+	cleanOld := strings.TrimSuffix(filepath.ToSlash(oldFolder), "/")
+	cleanNew := strings.TrimSuffix(filepath.ToSlash(newFolder), "/")
+	// SQLite counts characters, not bytes, in substr
+	oldPrefixLen := utf8.RuneCountInString(cleanOld) + 1
+	newPrefixLen := utf8.RuneCountInString(cleanNew) + 1
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		result := tx.Unscoped().Model(&models.Album{}).Where("folder_path = ?", cleanOld).Updates(map[string]interface{}{
+			"folder_path": cleanNew,
+			"library_id":  newLibraryID,
+			"updated_at":  now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Unscoped().Model(&models.Album{}).
+			Where("substr(folder_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			Updates(map[string]interface{}{
+				"folder_path": gorm.Expr("? || substr(folder_path, ?)", cleanNew, oldPrefixLen),
+				"library_id":  newLibraryID,
+				"updated_at":  now,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().
+			Where("substr(original_path, 1, ?) = ? AND deleted_at IS NOT NULL", newPrefixLen, cleanNew+"/").
+			Delete(&models.Image{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.Image{}).
+			Where("substr(original_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("original_path", gorm.Expr("? || substr(original_path, ?)", cleanNew, oldPrefixLen)).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.Face{}).
+			Where("substr(image_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("image_path", gorm.Expr("? || substr(image_path, ?)", cleanNew, oldPrefixLen)).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("substr(image_path, 1, ?) = ?", newPrefixLen, cleanNew+"/").Delete(&models.ImageEmbedding{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.ImageEmbedding{}).
+			Where("substr(image_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("image_path", gorm.Expr("? || substr(image_path, ?)", cleanNew, oldPrefixLen)).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("substr(image_path, 1, ?) = ?", newPrefixLen, cleanNew+"/").Delete(&models.ImageTag{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.ImageTag{}).
+			Where("substr(image_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("image_path", gorm.Expr("? || substr(image_path, ?)", cleanNew, oldPrefixLen)).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("substr(image_path, 1, ?) = ?", newPrefixLen, cleanNew+"/").Delete(&models.MachineTag{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.MachineTag{}).
+			Where("substr(image_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("image_path", gorm.Expr("? || substr(image_path, ?)", cleanNew, oldPrefixLen)).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("substr(image_path, 1, ?) = ?", newPrefixLen, cleanNew+"/").Delete(&models.ImageRating{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.ImageRating{}).
+			Where("substr(image_path, 1, ?) = ?", oldPrefixLen, cleanOld+"/").
+			UpdateColumn("image_path", gorm.Expr("? || substr(image_path, ?)", cleanNew, oldPrefixLen)).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to move album folder %s to %s: %w", cleanOld, cleanNew, err)
+	}
+	return nil
+}
+
+// Delete removes an album by its ID, along with the permissions, share links and zip watchers
+// referring to it, in one transaction.
+// this will perform a soft delete because models.Album has gorm.DeletedAt
+func (r *AlbumRepository) Delete(id uint) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Album{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// the user and role grants, share links, archive watchers and slug redirects of the album go with it
+		for _, dependent := range []interface{}{&models.UserAlbumPermission{}, &models.RoleAlbumPermission{}, &models.ShareLink{}, &models.ZipWatcher{}, &models.AlbumSlugRedirect{}} {
+			if err := tx.Where("album_id = ?", id).Delete(dependent).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete album ID %d: %w", id, err)
+	}
+	return nil
+}
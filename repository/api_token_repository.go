@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+type GormApiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewGormApiTokenRepository(db *gorm.DB) ApiTokenRepository {
+	return &GormApiTokenRepository{db: db}
+}
+
+func (r *GormApiTokenRepository) Create(token *models.ApiToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *GormApiTokenRepository) GetByID(id uint) (*models.ApiToken, error) {
+	var token models.ApiToken
+	err := r.db.First(&token, id).Error
+	return &token, err
+}
+
+func (r *GormApiTokenRepository) GetByTokenHash(tokenHash string) (*models.ApiToken, error) {
+	var token models.ApiToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	return &token, err
+}
+
+func (r *GormApiTokenRepository) ListByUserID(userID uint) ([]models.ApiToken, error) {
+	var tokens []models.ApiToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *GormApiTokenRepository) Update(token *models.ApiToken) error {
+	return r.db.Save(token).Error
+}
+
+// TouchLastUsed records when a token was last used without bumping updated_at
+func (r *GormApiTokenRepository) TouchLastUsed(id uint, usedAt time.Time) error {
+	return r.db.Model(&models.ApiToken{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt).Error
+}
+
+func (r *GormApiTokenRepository) Delete(id uint) error {
+	return r.db.Delete(&models.ApiToken{}, id).Error
+}
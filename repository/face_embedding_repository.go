@@ -4,23 +4,36 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/camden-git/mediasysbackend/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // FaceEmbeddingRepository handles database operations for FaceEmbedding entities
 type FaceEmbeddingRepository struct {
 	DB *gorm.DB
+
+	index     *hnswIndex // similarity search index, filled by SyncIndex
+	indexedID uint       // the highest embedding ID in the index
+	indexMu   sync.Mutex // serializes syncs
 }
 
+// embeddings loaded at a time while building the similarity search index
+const faceIndexBatchSize = 1000
+
+// optedOutFaces selects the faces tagged with people who opted out of face recognition. their
+// embeddings are purged, this keeps any made since from being used.
+const optedOutFaces = "SELECT faces.id FROM faces JOIN people ON people.id = faces.person_id WHERE people.recognition_opt_out = 1"
+
 // Ensure FaceEmbeddingRepository implements FaceEmbeddingRepositoryInterface
 var _ FaceEmbeddingRepositoryInterface = (*FaceEmbeddingRepository)(nil)
 
 // NewFaceEmbeddingRepository creates a new instance of FaceEmbeddingRepository
 func NewFaceEmbeddingRepository(db *gorm.DB) *FaceEmbeddingRepository {
-	return &FaceEmbeddingRepository{DB: db}
+	return &FaceEmbeddingRepository{DB: db, index: newHNSWIndex()}
 }
 
 // Create creates a new face embedding record in the database
@@ -80,6 +93,33 @@ func (r *FaceEmbeddingRepository) Update(embedding *models.FaceEmbedding) error
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	if embedding.FaceID != 0 {
+		if vector := embedding.GetEmbedding(); vector != nil {
+			r.index.Add(embedding.FaceID, normalizeVector(vector))
+		}
+	}
+	return nil
+}
+
+// Upsert stores the embedding of a face, replacing any previous one, including a deleted one
+func (r *FaceEmbeddingRepository) Upsert(faceID uint, embedding []float32, modelName string) error {
+	now := time.Now().Unix()
+	record := models.FaceEmbedding{
+		FaceID:         faceID,
+		EmbeddingModel: modelName,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	record.SetEmbedding(embedding)
+
+	err := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "face_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"embedding_data", "embedding_model", "updated_at", "deleted_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to save face embedding for face ID %d: %w", faceID, err)
+	}
+	r.index.Add(faceID, normalizeVector(embedding))
 	return nil
 }
 
@@ -101,14 +141,39 @@ func (r *FaceEmbeddingRepository) DeleteByFaceID(faceID uint) error {
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete face embedding for face ID %d: %w", faceID, result.Error)
 	}
+	r.index.Remove(faceID)
 	return nil
 }
 
-// GetEmbeddingsByPersonID retrieves all face embeddings for a given person
+// PurgeByPersonID permanently deletes the embeddings of every face tagged with a person, for
+// people who opted out of face recognition. returns the number of embeddings deleted.
+func (r *FaceEmbeddingRepository) PurgeByPersonID(personID uint) (int64, error) {
+	var faceIDs []uint
+	if err := r.DB.Model(&models.Face{}).Where("person_id = ?", personID).Pluck("id", &faceIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to list faces of person ID %d: %w", personID, err)
+	}
+	var purged int64
+	for start := 0; start < len(faceIDs); start += faceIndexBatchSize {
+		batch := faceIDs[start:min(start+faceIndexBatchSize, len(faceIDs))]
+		result := r.DB.Unscoped().Where("face_id IN ?", batch).Delete(&models.FaceEmbedding{})
+		if result.Error != nil {
+			return purged, fmt.Errorf("failed to purge face embeddings of person ID %d: %w", personID, result.Error)
+		}
+		purged += result.RowsAffected
+		for _, faceID := range batch {
+			r.index.Remove(faceID)
+		}
+	}
+	return purged, nil
+}
+
+// GetEmbeddingsByPersonID retrieves all face embeddings for a given person, none for people
+// who opted out of face recognition
 func (r *FaceEmbeddingRepository) GetEmbeddingsByPersonID(personID uint) ([]models.FaceEmbedding, error) {
 	var embeddings []models.FaceEmbedding
 	err := r.DB.Joins("JOIN faces ON face_embeddings.face_id = faces.id").
 		Where("faces.person_id = ?", personID).
+		Where("face_embeddings.face_id NOT IN (" + optedOutFaces + ")").
 		Preload("Face").
 		Find(&embeddings).Error
 	if err != nil {
@@ -130,6 +195,21 @@ func (r *FaceEmbeddingRepository) GetUntaggedEmbeddings() ([]models.FaceEmbeddin
 	return embeddings, nil
 }
 
+// GetTaggedEmbeddings retrieves all face embeddings for faces tagged with a person, except
+// people who opted out of face recognition
+func (r *FaceEmbeddingRepository) GetTaggedEmbeddings() ([]models.FaceEmbedding, error) {
+	var embeddings []models.FaceEmbedding
+	err := r.DB.Joins("JOIN faces ON face_embeddings.face_id = faces.id").
+		Where("faces.person_id IS NOT NULL").
+		Where("face_embeddings.face_id NOT IN (" + optedOutFaces + ")").
+		Preload("Face").
+		Find(&embeddings).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tagged embeddings: %w", err)
+	}
+	return embeddings, nil
+}
+
 // GetEmbeddingsByImagePath retrieves all face embeddings for a given image
 func (r *FaceEmbeddingRepository) GetEmbeddingsByImagePath(imagePath string) ([]models.FaceEmbedding, error) {
 	var embeddings []models.FaceEmbedding
@@ -143,53 +223,86 @@ func (r *FaceEmbeddingRepository) GetEmbeddingsByImagePath(imagePath string) ([]
 	return embeddings, nil
 }
 
-// FindSimilarFaces finds faces with similar embeddings to a given embedding
+// FindSimilarFaces finds the faces with the embeddings most similar to a given embedding,
+// most similar first. the search goes through an approximate nearest neighbour index, so it
+// may miss a few of the closest faces. embeddings below threshold are left out, as are faces
+// of people who opted out of face recognition.
 func (r *FaceEmbeddingRepository) FindSimilarFaces(targetEmbedding []float32, threshold float32, limit int) ([]models.FaceEmbedding, error) {
-	var embeddings []models.FaceEmbedding
-
-	// Get all embeddings to compare against
-	err := r.DB.Preload("Face").Find(&embeddings).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to get embeddings for similarity search: %w", err)
-	}
-
-	// Calculate similarities and create pairs for sorting
-	type embeddingWithSimilarity struct {
-		embedding  models.FaceEmbedding
-		similarity float32
+	if err := r.SyncIndex(); err != nil {
+		return nil, err
 	}
+	target := normalizeVector(targetEmbedding)
 
-	var embeddingPairs []embeddingWithSimilarity
-	for _, embedding := range embeddings {
-		embeddingVector := embedding.GetEmbedding()
-		if embeddingVector != nil {
-			similarity := calculateCosineSimilarity(targetEmbedding, embeddingVector)
-			embeddingPairs = append(embeddingPairs, embeddingWithSimilarity{
-				embedding:  embedding,
-				similarity: similarity,
-			})
+	for {
+		var faceIDs []uint
+		for _, match := range r.index.Search(target, limit) {
+			if match.similarity >= threshold {
+				faceIDs = append(faceIDs, match.id)
+			}
+		}
+		if len(faceIDs) == 0 {
+			return nil, nil
 		}
-	}
 
-	// Sort by similarity (highest first)
-	for i := 0; i < len(embeddingPairs)-1; i++ {
-		for j := i + 1; j < len(embeddingPairs); j++ {
-			if embeddingPairs[i].similarity < embeddingPairs[j].similarity {
-				embeddingPairs[i], embeddingPairs[j] = embeddingPairs[j], embeddingPairs[i]
+		var embeddings []models.FaceEmbedding
+		err := r.DB.Where("face_id IN ?", faceIDs).
+			Where("face_id NOT IN (" + optedOutFaces + ")").
+			Preload("Face").
+			Find(&embeddings).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get embeddings for similarity search: %w", err)
+		}
+		byFaceID := make(map[uint]models.FaceEmbedding, len(embeddings))
+		for _, embedding := range embeddings {
+			if embedding.Face != nil {
+				byFaceID[embedding.FaceID] = embedding
 			}
 		}
-	}
 
-	// Return top results (let the service handle threshold filtering)
-	var result []models.FaceEmbedding
-	for i, pair := range embeddingPairs {
-		if i >= limit {
-			break
+		// faces and embeddings deleted since they were indexed, and faces of people who opted
+		// out, are dropped from the index as they turn up, and the search repeated to fill
+		// their places
+		result := make([]models.FaceEmbedding, 0, len(faceIDs))
+		stale := false
+		for _, faceID := range faceIDs {
+			embedding, ok := byFaceID[faceID]
+			if !ok {
+				r.index.Remove(faceID)
+				stale = true
+				continue
+			}
+			result = append(result, embedding)
+		}
+		if !stale {
+			return result, nil
 		}
-		result = append(result, pair.embedding)
 	}
+}
 
-	return result, nil
+// SyncIndex adds the embeddings created since the last sync to the similarity search index;
+// the first sync builds it from every embedding. embeddings get increasing IDs wherever they
+// are created, so the new ones are those past the last indexed ID.
+func (r *FaceEmbeddingRepository) SyncIndex() error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	var batch []models.FaceEmbedding
+	err := r.DB.Select("id", "face_id", "embedding_data").
+		Where("id > ?", r.indexedID).
+		Order("id ASC").
+		FindInBatches(&batch, faceIndexBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, embedding := range batch {
+				if vector := embedding.GetEmbedding(); vector != nil {
+					r.index.Add(embedding.FaceID, normalizeVector(vector))
+				}
+				r.indexedID = embedding.ID
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to index face embeddings: %w", err)
+	}
+	return nil
 }
 
 // calculateCosineSimilarity calculates cosine similarity between two embedding vectors
@@ -61,6 +61,19 @@ func (r *FaceRepository) ListByImagePath(imagePath string) ([]models.Face, error
 	return faces, nil
 }
 
+// ListByPersonAndImagePaths retrieves the faces tagged with a person in any of the given images
+func (r *FaceRepository) ListByPersonAndImagePaths(personID uint, imagePaths []string) ([]models.Face, error) {
+	if len(imagePaths) == 0 {
+		return nil, nil
+	}
+	var faces []models.Face
+	err := r.DB.Where("person_id = ? AND image_path IN ?", personID, imagePaths).Order("id ASC").Find(&faces).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list faces of person %d: %w", personID, err)
+	}
+	return faces, nil
+}
+
 // Update updates an existing face's details (coordinates, PersonID)
 // Pass a pointer to uint for PersonID to explicitly set it to NULL if needed.
 // For coordinates, pass pointers to int; if a pointer is nil, that field won't be updated.
@@ -133,6 +146,40 @@ func (r *FaceRepository) DeleteUntaggedByImagePath(imagePath string) (int64, err
 	return result.RowsAffected, nil
 }
 
+// faceNeedsEmbedding matches faces without an embedding made by the model given as its
+// parameter. faces of people who opted out of face recognition never need one.
+const faceNeedsEmbedding = "NOT EXISTS (SELECT 1 FROM face_embeddings WHERE face_embeddings.face_id = faces.id AND face_embeddings.deleted_at IS NULL AND face_embeddings.embedding_model = ?)" +
+	" AND (faces.person_id IS NULL OR faces.person_id NOT IN (SELECT id FROM people WHERE recognition_opt_out = 1))"
+
+// ListImagePathsNeedingEmbeddings returns the images that have faces, tagged or not, without
+// an embedding made by modelName, i.e. faces with no embedding or one from another model
+func (r *FaceRepository) ListImagePathsNeedingEmbeddings(modelName string) ([]string, error) {
+	var paths []string
+	err := r.DB.Model(&models.Face{}).
+		Where(faceNeedsEmbedding, modelName).
+		Distinct().
+		Order("image_path ASC").
+		Pluck("image_path", &paths).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images with faces needing %s embeddings: %w", modelName, err)
+	}
+	return paths, nil
+}
+
+// ListFacesNeedingEmbeddings returns the faces of an image without an embedding made by modelName
+func (r *FaceRepository) ListFacesNeedingEmbeddings(imagePath string, modelName string) ([]models.Face, error) {
+	cleanPath := filepath.ToSlash(imagePath)
+	var faces []models.Face
+	err := r.DB.Where("image_path = ?", cleanPath).
+		Where(faceNeedsEmbedding, modelName).
+		Order("id ASC").
+		Find(&faces).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list faces needing %s embeddings for %s: %w", modelName, cleanPath, err)
+	}
+	return faces, nil
+}
+
 // TagFace assigns a PersonID to an existing face
 func (r *FaceRepository) TagFace(faceID uint, personID uint) error {
 	updates := map[string]interface{}{
@@ -164,3 +211,138 @@ func (r *FaceRepository) UntagFace(faceID uint) error {
 	}
 	return nil
 }
+
+// faceClusterBatchSize caps the face IDs per UPDATE, well below SQLite's variable limit
+const faceClusterBatchSize = 500
+
+// FaceCluster is a group of similar untagged faces and how many faces it holds
+type FaceCluster struct {
+	ClusterID uint  `json:"cluster_id"`
+	FaceCount int64 `json:"face_count"`
+}
+
+// ReplaceClusters stores the result of a clustering run: the faces of clusters[i] get cluster
+// ID i+1 and every other face loses its cluster
+func (r *FaceRepository) ReplaceClusters(clusters [][]uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Face{}).Where("cluster_id IS NOT NULL").Update("cluster_id", gorm.Expr("NULL")).Error; err != nil {
+			return fmt.Errorf("failed to clear face clusters: %w", err)
+		}
+		for i, faceIDs := range clusters {
+			for start := 0; start < len(faceIDs); start += faceClusterBatchSize {
+				batch := faceIDs[start:min(start+faceClusterBatchSize, len(faceIDs))]
+				if err := tx.Model(&models.Face{}).Where("id IN ?", batch).Update("cluster_id", i+1).Error; err != nil {
+					return fmt.Errorf("failed to store face cluster %d: %w", i+1, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ListClusters returns the clusters that still have untagged faces, largest first. limit 0
+// returns every cluster.
+func (r *FaceRepository) ListClusters(limit int) ([]FaceCluster, error) {
+	var clusters []FaceCluster
+	query := r.DB.Model(&models.Face{}).
+		Select("cluster_id, COUNT(*) AS face_count").
+		Where("cluster_id IS NOT NULL AND person_id IS NULL").
+		Group("cluster_id").
+		Order("face_count DESC, cluster_id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Scan(&clusters).Error; err != nil {
+		return nil, fmt.Errorf("failed to list face clusters: %w", err)
+	}
+	return clusters, nil
+}
+
+// ListByClusterID returns the untagged faces of a cluster, the most confident detections
+// first. limit 0 returns every face.
+func (r *FaceRepository) ListByClusterID(clusterID uint, limit int) ([]models.Face, error) {
+	var faces []models.Face
+	query := r.DB.Where("cluster_id = ? AND person_id IS NULL", clusterID).Order("detection_confidence DESC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&faces).Error; err != nil {
+		return nil, fmt.Errorf("failed to list faces of cluster %d: %w", clusterID, err)
+	}
+	return faces, nil
+}
+
+// TagCluster assigns a PersonID to every untagged face of a cluster and takes them out of
+// the cluster. returns the IDs of the tagged faces, gorm.ErrRecordNotFound if there were none.
+func (r *FaceRepository) TagCluster(clusterID uint, personID uint) ([]uint, error) {
+	var faceIDs []uint
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Face{}).Where("cluster_id = ? AND person_id IS NULL", clusterID).Pluck("id", &faceIDs).Error; err != nil {
+			return err
+		}
+		if len(faceIDs) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		updates := map[string]interface{}{
+			"person_id":  personID,
+			"cluster_id": gorm.Expr("NULL"),
+			"updated_at": time.Now().Unix(),
+		}
+		return tx.Model(&models.Face{}).Where("cluster_id = ? AND person_id IS NULL", clusterID).Updates(updates).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to tag cluster %d with person ID %d: %w", clusterID, personID, err)
+	}
+	return faceIDs, nil
+}
+
+// SetPersonForFaces tags every listed face with a person, or untags them when personID is
+// nil, in one transaction. tagged faces are taken out of their cluster. if any face does not
+// exist nothing is changed and the missing IDs are returned.
+func (r *FaceRepository) SetPersonForFaces(faceIDs []uint, personID *uint) ([]uint, error) {
+	var missing []uint
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		found := make(map[uint]bool, len(faceIDs))
+		for start := 0; start < len(faceIDs); start += faceClusterBatchSize {
+			var ids []uint
+			batch := faceIDs[start:min(start+faceClusterBatchSize, len(faceIDs))]
+			if err := tx.Model(&models.Face{}).Where("id IN ?", batch).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				found[id] = true
+			}
+		}
+		for _, id := range faceIDs {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			return nil
+		}
+
+		updates := map[string]interface{}{
+			"person_id":  gorm.Expr("NULL"),
+			"updated_at": time.Now().Unix(),
+		}
+		if personID != nil {
+			updates["person_id"] = *personID
+			updates["cluster_id"] = gorm.Expr("NULL")
+		}
+		for start := 0; start < len(faceIDs); start += faceClusterBatchSize {
+			batch := faceIDs[start:min(start+faceClusterBatchSize, len(faceIDs))]
+			if err := tx.Model(&models.Face{}).Where("id IN ?", batch).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set person of %d faces: %w", len(faceIDs), err)
+	}
+	return missing, nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// FaceSuggestionRepository handles database operations for FaceSuggestion entities
+type FaceSuggestionRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure FaceSuggestionRepository implements FaceSuggestionRepositoryInterface
+var _ FaceSuggestionRepositoryInterface = (*FaceSuggestionRepository)(nil)
+
+// NewFaceSuggestionRepository creates a new instance of FaceSuggestionRepository
+func NewFaceSuggestionRepository(db *gorm.DB) *FaceSuggestionRepository {
+	return &FaceSuggestionRepository{DB: db}
+}
+
+// GetByID retrieves a suggestion with its face and person
+func (r *FaceSuggestionRepository) GetByID(id uint) (*models.FaceSuggestion, error) {
+	var suggestion models.FaceSuggestion
+	err := r.DB.Preload("Face").Preload("Person").First(&suggestion, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get face suggestion by ID %d: %w", id, err)
+	}
+	return &suggestion, nil
+}
+
+// ListPending returns a page of the suggestions waiting for review whose face is still
+// untagged, most confident first, together with their total number
+func (r *FaceSuggestionRepository) ListPending(offset, limit int) ([]models.FaceSuggestion, int64, error) {
+	pending := func() *gorm.DB {
+		return r.DB.Model(&models.FaceSuggestion{}).
+			Joins("JOIN faces ON faces.id = face_suggestions.face_id").
+			Where("face_suggestions.status = ? AND faces.person_id IS NULL AND faces.deleted_at IS NULL", models.FaceSuggestionPending)
+	}
+
+	var total int64
+	if err := pending().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count pending face suggestions: %w", err)
+	}
+
+	query := pending().Preload("Face").Preload("Person").
+		Order("face_suggestions.confidence DESC").Order("face_suggestions.id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var suggestions []models.FaceSuggestion
+	if err := query.Find(&suggestions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list pending face suggestions: %w", err)
+	}
+	return suggestions, total, nil
+}
+
+// ListRejected retrieves every rejected suggestion
+func (r *FaceSuggestionRepository) ListRejected() ([]models.FaceSuggestion, error) {
+	var suggestions []models.FaceSuggestion
+	if err := r.DB.Where("status = ?", models.FaceSuggestionRejected).Find(&suggestions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list rejected face suggestions: %w", err)
+	}
+	return suggestions, nil
+}
+
+// ReplacePending makes suggestion the pending suggestion of its face, replacing the one there
+// was. a nil suggestion only clears the pending suggestion of faceID. a suggestion of a person
+// that was already reviewed for the face is not made again.
+func (r *FaceSuggestionRepository) ReplacePending(faceID uint, suggestion *models.FaceSuggestion) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if suggestion == nil {
+			return tx.Where("face_id = ? AND status = ?", faceID, models.FaceSuggestionPending).
+				Delete(&models.FaceSuggestion{}).Error
+		}
+
+		var existing models.FaceSuggestion
+		err := tx.Where("face_id = ? AND person_id = ?", faceID, suggestion.PersonID).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && existing.Status != models.FaceSuggestionPending {
+			return tx.Where("face_id = ? AND status = ?", faceID, models.FaceSuggestionPending).
+				Delete(&models.FaceSuggestion{}).Error
+		}
+
+		err = tx.Where("face_id = ? AND person_id <> ? AND status = ?", faceID, suggestion.PersonID, models.FaceSuggestionPending).
+			Delete(&models.FaceSuggestion{}).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().Unix()
+		suggestion.FaceID = faceID
+		suggestion.Status = models.FaceSuggestionPending
+		suggestion.UpdatedAt = now
+		if existing.ID != 0 {
+			suggestion.ID = existing.ID
+			return tx.Model(&existing).Updates(map[string]interface{}{
+				"confidence": suggestion.Confidence,
+				"votes":      suggestion.Votes,
+				"updated_at": now,
+			}).Error
+		}
+		suggestion.CreatedAt = now
+		return tx.Create(suggestion).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace pending suggestion of face %d: %w", faceID, err)
+	}
+	return nil
+}
+
+// DeletePendingByPersonID removes the pending suggestions of a person, e.g. when they opt out
+// of face recognition. reviewed ones are kept as the record of the decision. returns the
+// number of suggestions removed.
+func (r *FaceSuggestionRepository) DeletePendingByPersonID(personID uint) (int64, error) {
+	result := r.DB.Where("person_id = ? AND status = ?", personID, models.FaceSuggestionPending).Delete(&models.FaceSuggestion{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete pending suggestions of person %d: %w", personID, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Review records a reviewer's decision on a pending suggestion. returns gorm.ErrRecordNotFound
+// if there is no pending suggestion with the ID.
+func (r *FaceSuggestionRepository) Review(id uint, status string, reviewerID uint) error {
+	now := time.Now().Unix()
+	result := r.DB.Model(&models.FaceSuggestion{}).
+		Where("id = ? AND status = ?", id, models.FaceSuggestionPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": reviewerID,
+			"reviewed_at": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to review face suggestion %d: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
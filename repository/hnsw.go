@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// HNSW graph parameters: the links each node keeps per layer (twice as many on the bottom
+// layer) and the candidate list sizes used while inserting and searching. larger values
+// trade speed for recall.
+const (
+	hnswM              = 16
+	hnswEfConstruction = 100
+	hnswEfSearch       = 64
+)
+
+// removed vectors are kept for navigation until they outnumber the live ones, and there are
+// at least this many, then the graph is rebuilt
+const hnswMinRebuildRemoved = 1000
+
+// hnswNode is a vector in the graph with its links on each layer it is on
+type hnswNode struct {
+	id      uint
+	slot    int       // position in insertion order, indexes the visited set of a search
+	vector  []float32 // normalized
+	links   [][]*hnswNode
+	removed bool
+}
+
+// hnswCandidate is a node found while searching and its distance to the query
+type hnswCandidate struct {
+	node     *hnswNode
+	distance float32
+}
+
+// hnswMatch is a search result
+type hnswMatch struct {
+	id         uint
+	similarity float32
+}
+
+// hnswIndex is an in-memory hierarchical navigable small world graph for approximate nearest
+// neighbour search by cosine similarity. vectors are keyed by ID and must be normalized.
+type hnswIndex struct {
+	mu      sync.RWMutex
+	nodes   map[uint]*hnswNode
+	entry   *hnswNode
+	slots   int // nodes added since the graph was last built, removed ones included
+	removed int
+	rng     *rand.Rand
+}
+
+func newHNSWIndex() *hnswIndex {
+	// a fixed seed keeps the graph the same for the same inserts
+	return &hnswIndex{nodes: make(map[uint]*hnswNode), rng: rand.New(rand.NewSource(1))}
+}
+
+// Len returns the number of vectors in the index
+func (idx *hnswIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.nodes)
+}
+
+// Add inserts the vector of id, replacing the one it had
+func (idx *hnswIndex) Add(id uint, vector []float32) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.add(id, vector)
+}
+
+// Remove takes the vector of id out of the search results
+func (idx *hnswIndex) Remove(id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+// Search returns up to k of the indexed vectors most similar to vector, most similar first
+func (idx *hnswIndex) Search(vector []float32, k int) []hnswMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.entry == nil || k <= 0 {
+		return nil
+	}
+
+	entry := idx.entry
+	for layer := len(entry.links) - 1; layer > 0; layer-- {
+		entry = idx.closest(vector, entry, layer)
+	}
+	candidates := idx.searchLayer(vector, []*hnswNode{entry}, max(hnswEfSearch, k), 0)
+
+	matches := make([]hnswMatch, 0, min(k, len(candidates)))
+	for _, candidate := range candidates {
+		if candidate.node.removed {
+			continue
+		}
+		matches = append(matches, hnswMatch{id: candidate.node.id, similarity: 1 - candidate.distance})
+		if len(matches) == k {
+			break
+		}
+	}
+	return matches
+}
+
+func (idx *hnswIndex) add(id uint, vector []float32) {
+	if existing, ok := idx.nodes[id]; ok {
+		if slices.Equal(existing.vector, vector) {
+			return
+		}
+		idx.remove(id)
+	}
+
+	// layers are exponentially less likely, each holding about 1/M of the layer below
+	level := int(-math.Log(1-idx.rng.Float64()) / math.Log(hnswM))
+	node := &hnswNode{id: id, slot: idx.slots, vector: vector, links: make([][]*hnswNode, level+1)}
+	idx.nodes[id] = node
+	idx.slots++
+	if idx.entry == nil {
+		idx.entry = node
+		return
+	}
+
+	entry := idx.entry
+	top := len(entry.links) - 1
+	for layer := top; layer > level; layer-- {
+		entry = idx.closest(vector, entry, layer)
+	}
+	entries := []*hnswNode{entry}
+	for layer := min(level, top); layer >= 0; layer-- {
+		candidates := idx.searchLayer(vector, entries, hnswEfConstruction, layer)
+		for _, neighbour := range hnswSelectNeighbours(candidates, hnswM) {
+			node.links[layer] = append(node.links[layer], neighbour)
+			neighbour.links[layer] = append(neighbour.links[layer], node)
+			if len(neighbour.links[layer]) > hnswMaxLinks(layer) {
+				hnswPrune(neighbour, layer)
+			}
+		}
+		entries = entries[:0]
+		for _, candidate := range candidates {
+			entries = append(entries, candidate.node)
+		}
+	}
+	if level > top {
+		idx.entry = node
+	}
+}
+
+func (idx *hnswIndex) remove(id uint) {
+	node, ok := idx.nodes[id]
+	if !ok {
+		return
+	}
+	node.removed = true
+	delete(idx.nodes, id)
+	idx.removed++
+	if idx.removed >= hnswMinRebuildRemoved && idx.removed > len(idx.nodes) {
+		idx.rebuild()
+	}
+}
+
+// rebuild builds the graph again from the live vectors, dropping the removed ones
+func (idx *hnswIndex) rebuild() {
+	live := make([]*hnswNode, 0, len(idx.nodes))
+	for _, node := range idx.nodes {
+		live = append(live, node)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].id < live[j].id })
+
+	idx.nodes = make(map[uint]*hnswNode, len(live))
+	idx.entry = nil
+	idx.slots = 0
+	idx.removed = 0
+	for _, node := range live {
+		idx.add(node.id, node.vector)
+	}
+}
+
+// closest walks greedily from entry to the node of a layer closest to vector
+func (idx *hnswIndex) closest(vector []float32, entry *hnswNode, layer int) *hnswNode {
+	best, bestDistance := entry, hnswDistance(vector, entry.vector)
+	for changed := true; changed; {
+		changed = false
+		for _, neighbour := range best.links[layer] {
+			if distance := hnswDistance(vector, neighbour.vector); distance < bestDistance {
+				best, bestDistance = neighbour, distance
+				changed = true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer finds the ef nodes of a layer closest to vector, starting from entries.
+// removed nodes are included, as the graph is navigated through them. returns them closest
+// first.
+func (idx *hnswIndex) searchLayer(vector []float32, entries []*hnswNode, ef, layer int) []hnswCandidate {
+	visited := make([]bool, idx.slots)
+	candidates := &hnswHeap{}            // closest first, still to be expanded
+	results := &hnswHeap{farthest: true} // farthest first, so the worst result is dropped
+	for _, entry := range entries {
+		if visited[entry.slot] {
+			continue
+		}
+		visited[entry.slot] = true
+		candidate := hnswCandidate{node: entry, distance: hnswDistance(vector, entry.vector)}
+		heap.Push(candidates, candidate)
+		heap.Push(results, candidate)
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.distance > results.items[0].distance {
+			break
+		}
+		for _, neighbour := range current.node.links[layer] {
+			if visited[neighbour.slot] {
+				continue
+			}
+			visited[neighbour.slot] = true
+			distance := hnswDistance(vector, neighbour.vector)
+			if results.Len() < ef || distance < results.items[0].distance {
+				candidate := hnswCandidate{node: neighbour, distance: distance}
+				heap.Push(candidates, candidate)
+				heap.Push(results, candidate)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	found := results.items
+	sort.Slice(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+	return found
+}
+
+// hnswSelectNeighbours picks up to m of candidates, sorted closest first, to link a node to.
+// a candidate closer to an already picked one than to the node is passed over at first, which
+// spreads the links out in different directions and keeps clusters connected.
+func hnswSelectNeighbours(candidates []hnswCandidate, m int) []*hnswNode {
+	selected := make([]*hnswNode, 0, m)
+	var passed []*hnswNode
+	for _, candidate := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if hnswDistance(candidate.node.vector, s.vector) < candidate.distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate.node)
+		} else {
+			passed = append(passed, candidate.node)
+		}
+	}
+	for _, node := range passed {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+// hnswPrune keeps the closest links of a node on a layer that has too many
+func hnswPrune(node *hnswNode, layer int) {
+	candidates := make([]hnswCandidate, len(node.links[layer]))
+	for i, link := range node.links[layer] {
+		candidates[i] = hnswCandidate{node: link, distance: hnswDistance(node.vector, link.vector)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	for i := range candidates[:hnswMaxLinks(layer)] {
+		node.links[layer][i] = candidates[i].node
+	}
+	node.links[layer] = node.links[layer][:hnswMaxLinks(layer)]
+}
+
+// hnswMaxLinks is how many links a node keeps on a layer
+func hnswMaxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * hnswM
+	}
+	return hnswM
+}
+
+// hnswDistance is the cosine distance of two normalized vectors
+func hnswDistance(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 1
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+// normalizeVector scales a vector to unit length, so dot products are cosine similarities
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	normalized := make([]float32, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i, v := range vector {
+		normalized[i] = v * scale
+	}
+	return normalized
+}
+
+// hnswHeap is a heap of candidates ordered by distance, closest or farthest first
+type hnswHeap struct {
+	items    []hnswCandidate
+	farthest bool
+}
+
+func (h *hnswHeap) Len() int { return len(h.items) }
+
+func (h *hnswHeap) Less(i, j int) bool {
+	if h.farthest {
+		return h.items[i].distance > h.items[j].distance
+	}
+	return h.items[i].distance < h.items[j].distance
+}
+
+func (h *hnswHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *hnswHeap) Push(x interface{}) { h.items = append(h.items, x.(hnswCandidate)) }
+
+func (h *hnswHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageEmbeddingRepository handles database operations for ImageEmbedding entities
+type ImageEmbeddingRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure ImageEmbeddingRepository implements ImageEmbeddingRepositoryInterface
+var _ ImageEmbeddingRepositoryInterface = (*ImageEmbeddingRepository)(nil)
+
+// NewImageEmbeddingRepository creates a new instance of ImageEmbeddingRepository
+func NewImageEmbeddingRepository(db *gorm.DB) *ImageEmbeddingRepository {
+	return &ImageEmbeddingRepository{DB: db}
+}
+
+// ImageSimilarity is an image ranked by the similarity of its embedding to a query
+type ImageSimilarity struct {
+	ImagePath  string
+	Similarity float32
+}
+
+// Upsert stores the embedding of an image, replacing any previous one
+func (r *ImageEmbeddingRepository) Upsert(imagePath string, embedding []float32, modelName string) error {
+	cleanPath := filepath.ToSlash(imagePath)
+	now := time.Now().Unix()
+	record := models.ImageEmbedding{
+		ImagePath:      cleanPath,
+		EmbeddingModel: modelName,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	record.SetEmbedding(embedding)
+
+	err := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"embedding_data", "embedding_model", "updated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to save image embedding for %s: %w", cleanPath, err)
+	}
+	return nil
+}
+
+// GetByImagePath retrieves the embedding of an image
+func (r *ImageEmbeddingRepository) GetByImagePath(imagePath string) (*models.ImageEmbedding, error) {
+	var embedding models.ImageEmbedding
+	err := r.DB.Where("image_path = ?", filepath.ToSlash(imagePath)).First(&embedding).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get image embedding for %s: %w", imagePath, err)
+	}
+	return &embedding, nil
+}
+
+// ListImagesMissingEmbeddings returns the path and modification time of the images (not
+// videos) that have no embedding, or whose embedding is older than the file
+func (r *ImageEmbeddingRepository) ListImagesMissingEmbeddings() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Model(&models.Image{}).
+		Select("images.original_path", "images.last_modified").
+		Joins("LEFT JOIN image_embeddings ON image_embeddings.image_path = images.original_path").
+		Where("images.media_type = ?", database.MediaTypeImage).
+		Where("image_embeddings.id IS NULL OR image_embeddings.updated_at < images.last_modified").
+		Order("images.original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing embeddings: %w", err)
+	}
+	return images, nil
+}
+
+// SearchSimilar ranks the embedded images by cosine similarity to a query embedding and
+// returns a page of those scoring at least minSimilarity, best first, together with the
+// total number of them. soft-deleted images are skipped, and so are images flagged or
+// confirmed as NSFW if excludeNSFW is set, and images anywhere below any of excludeFolders.
+func (r *ImageEmbeddingRepository) SearchSimilar(query []float32, minSimilarity float32, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]ImageSimilarity, int64, error) {
+	var embeddings []models.ImageEmbedding
+	q := r.DB.Model(&models.ImageEmbedding{}).
+		Joins("JOIN images ON images.original_path = image_embeddings.image_path AND images.deleted_at IS NULL").
+		Select("image_embeddings.image_path", "image_embeddings.embedding_data")
+	if excludeNSFW {
+		q = q.Where("images.nsfw_status NOT IN ?", models.NSFWHiddenStatuses)
+	}
+	if len(excludeFolders) > 0 {
+		condition, args := subtreesCondition("images.original_path", excludeFolders)
+		q = q.Where("NOT "+condition, args...)
+	}
+	err := q.Find(&embeddings).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load image embeddings for similarity search: %w", err)
+	}
+
+	var ranked []ImageSimilarity
+	for i := range embeddings {
+		similarity := calculateCosineSimilarity(query, embeddings[i].GetEmbedding())
+		if similarity >= minSimilarity {
+			ranked = append(ranked, ImageSimilarity{ImagePath: embeddings[i].ImagePath, Similarity: similarity})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Similarity != ranked[j].Similarity {
+			return ranked[i].Similarity > ranked[j].Similarity
+		}
+		return ranked[i].ImagePath < ranked[j].ImagePath
+	})
+
+	total := int64(len(ranked))
+	if offset >= len(ranked) {
+		return []ImageSimilarity{}, total, nil
+	}
+	ranked = ranked[offset:]
+	if limit > 0 && limit < len(ranked) {
+		ranked = ranked[:limit]
+	}
+	return ranked, total, nil
+}
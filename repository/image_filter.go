@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// ImageFilter selects image records by their metadata. every field that is set must match;
+// a list matches if any of its values does. string comparisons are case-insensitive.
+type ImageFilter struct {
+	Folder          string   // only files directly in this folder, relative to the root
+	FolderGlobs     []string // matched against the path relative to the root; '*' also matches '/'
+	Subtrees        []string // only files anywhere below any of these folders, relative to the root; "." is the root
+	ExcludeSubtrees []string // no files anywhere below any of these folders, e.g. those of hidden albums
+	TakenAfter      *int64   // Unix timestamp, inclusive
+	TakenBefore     *int64   // Unix timestamp, exclusive
+	CameraMakes     []string
+	CameraModels    []string
+	Lenses          []string // matched against the lens model
+	ISOMin          *int
+	ISOMax          *int
+	FocalMin        *float64 // mm
+	FocalMax        *float64 // mm
+	HasFaces        *bool
+	PersonIDs       []uint   // images with a face tagged as any of these people
+	MediaType       string   // "image" or "video"
+	Locations       []string // matched against the city, region and country the image was taken in
+	Tags            []string // images with any of these tags, case-insensitive
+	MachineTags     []string // images with any of these machine tags, case-insensitive
+	ExcludeNSFW     bool     // leaves out images flagged or confirmed as NSFW
+	StackID         string   // only the frames of this burst stack
+
+	// favorites and ratings are those of RatingUserID; they are ignored when it is 0
+	RatingUserID  uint
+	FavoritesOnly bool
+	RatingMin     *int // stars, inclusive
+	RatingMax     *int // stars, inclusive; unrated images never match
+}
+
+// apply adds the filter's conditions to a query on the images table
+func (f ImageFilter) apply(db *gorm.DB, query *gorm.DB) *gorm.DB {
+	if f.Folder != "" {
+		prefix := strings.TrimSuffix(f.Folder, "/") + "/"
+		prefixLen := utf8.RuneCountInString(prefix)
+		query = query.Where("substr(original_path, 1, ?) = ? AND instr(substr(original_path, ?), '/') = 0", prefixLen, prefix, prefixLen+1)
+	}
+	if len(f.Subtrees) > 0 {
+		condition, args := subtreesCondition("original_path", f.Subtrees)
+		query = query.Where(condition, args...)
+	}
+	if len(f.ExcludeSubtrees) > 0 {
+		condition, args := subtreesCondition("original_path", f.ExcludeSubtrees)
+		query = query.Where("NOT "+condition, args...)
+	}
+	if len(f.FolderGlobs) > 0 {
+		conditions := make([]string, len(f.FolderGlobs))
+		args := make([]interface{}, len(f.FolderGlobs))
+		for i, glob := range f.FolderGlobs {
+			conditions[i] = "original_path GLOB ?"
+			args[i] = glob
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	if f.TakenAfter != nil {
+		query = query.Where("taken_at >= ?", *f.TakenAfter)
+	}
+	if f.TakenBefore != nil {
+		query = query.Where("taken_at < ?", *f.TakenBefore)
+	}
+	if len(f.CameraMakes) > 0 {
+		query = query.Where("LOWER(camera_make) IN ?", lowerAll(f.CameraMakes))
+	}
+	if len(f.CameraModels) > 0 {
+		query = query.Where("LOWER(camera_model) IN ?", lowerAll(f.CameraModels))
+	}
+	if len(f.Lenses) > 0 {
+		query = query.Where("LOWER(lens_model) IN ?", lowerAll(f.Lenses))
+	}
+	if f.ISOMin != nil {
+		query = query.Where("iso >= ?", *f.ISOMin)
+	}
+	if f.ISOMax != nil {
+		query = query.Where("iso <= ?", *f.ISOMax)
+	}
+	if f.FocalMin != nil {
+		query = query.Where("focal_length >= ?", *f.FocalMin)
+	}
+	if f.FocalMax != nil {
+		query = query.Where("focal_length <= ?", *f.FocalMax)
+	}
+	if f.HasFaces != nil {
+		faces := "EXISTS (SELECT 1 FROM faces WHERE faces.image_path = images.original_path AND faces.deleted_at IS NULL)"
+		if *f.HasFaces {
+			query = query.Where(faces)
+		} else {
+			query = query.Where("NOT " + faces)
+		}
+	}
+	if len(f.PersonIDs) > 0 {
+		query = query.Where("original_path IN (?)",
+			db.Model(&models.Face{}).Select("image_path").Where("person_id IN ?", f.PersonIDs))
+	}
+	if f.MediaType != "" {
+		query = query.Where("media_type = ?", f.MediaType)
+	}
+	if len(f.Locations) > 0 {
+		locations := lowerAll(f.Locations)
+		query = query.Where("(LOWER(location_city) IN ? OR LOWER(location_region) IN ? OR LOWER(location_country) IN ?)", locations, locations, locations)
+	}
+	if len(f.Tags) > 0 {
+		query = query.Where("original_path IN (?)", taggedImagePaths(db, f.Tags))
+	}
+	if f.ExcludeNSFW {
+		query = query.Where("nsfw_status NOT IN ?", models.NSFWHiddenStatuses)
+	}
+	if f.StackID != "" {
+		query = query.Where("stack_id = ?", f.StackID)
+	}
+	if len(f.MachineTags) > 0 {
+		query = query.Where("original_path IN (?)", machineTaggedImagePaths(db, f.MachineTags))
+	}
+	if f.RatingUserID != 0 && (f.FavoritesOnly || f.RatingMin != nil || f.RatingMax != nil) {
+		rated := db.Model(&models.ImageRating{}).Select("image_path").Where("user_id = ?", f.RatingUserID)
+		if f.FavoritesOnly {
+			rated = rated.Where("favorite = ?", true)
+		}
+		if f.RatingMin != nil {
+			rated = rated.Where("rating >= ?", *f.RatingMin)
+		}
+		if f.RatingMax != nil {
+			rated = rated.Where("rating > 0 AND rating <= ?", *f.RatingMax)
+		}
+		query = query.Where("original_path IN (?)", rated)
+	}
+	return query
+}
+
+// subtreesCondition is an SQL condition on the paths in column, with its args, that matches
+// the files anywhere below any of folders, relative to the root; "." is the root
+func subtreesCondition(column string, folders []string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for _, folder := range folders {
+		folder = strings.Trim(folder, "/")
+		if folder == "" || folder == "." {
+			return "1 = 1", nil // the root holds every file
+		}
+		prefix := folder + "/"
+		conditions = append(conditions, "substr("+column+", 1, ?) = ?")
+		args = append(args, utf8.RuneCountInString(prefix), prefix)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// orderImages sorts a query on the images table by an album sort order. natural filename
+// order is not available in SQL, so it falls back to case-insensitive path order.
+func orderImages(query *gorm.DB, sortOrder string) *gorm.DB {
+	switch sortOrder {
+	case database.SortDateAsc:
+		return query.Order("COALESCE(taken_at, last_modified) ASC").Order("original_path ASC")
+	case database.SortDateDesc:
+		return query.Order("COALESCE(taken_at, last_modified) DESC").Order("original_path ASC")
+	case database.SortCustom:
+		return query.Order("sort_position IS NULL").Order("sort_position ASC").Order("original_path COLLATE NOCASE ASC")
+	default:
+		return query.Order("original_path COLLATE NOCASE ASC")
+	}
+}
+
+// listImagesPage counts the records matching a filter and returns one page of them
+func listImagesPage(db *gorm.DB, filter ImageFilter, sortOrder string, offset, limit int) ([]models.Image, int64, error) {
+	query := filter.apply(db, db.Model(&models.Image{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = orderImages(query, sortOrder)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var images []models.Image
+	if err := query.Find(&images).Error; err != nil {
+		return nil, 0, err
+	}
+	return images, total, nil
+}
+
+// taggedImagePaths is a subquery of the paths of the images with any of the named tags
+func taggedImagePaths(db *gorm.DB, tagNames []string) *gorm.DB {
+	keys := make([]string, len(tagNames))
+	for i, name := range tagNames {
+		keys[i] = strings.ToLower(models.NormalizeTagName(name))
+	}
+	return db.Model(&models.ImageTag{}).
+		Select("image_tags.image_path").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("tags.name_key IN ?", keys)
+}
+
+// machineTaggedImagePaths is a subquery of the paths of the images with any of the named machine tags
+func machineTaggedImagePaths(db *gorm.DB, names []string) *gorm.DB {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = strings.ToLower(models.NormalizeTagName(name))
+	}
+	return db.Model(&models.MachineTag{}).Select("image_path").Where("name IN ?", keys)
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
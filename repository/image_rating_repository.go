@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// ImageRatingRepository handles database operations for ImageRating entities
+type ImageRatingRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure ImageRatingRepository implements ImageRatingRepositoryInterface
+var _ ImageRatingRepositoryInterface = (*ImageRatingRepository)(nil)
+
+// NewImageRatingRepository creates a new instance of ImageRatingRepository
+func NewImageRatingRepository(db *gorm.DB) *ImageRatingRepository {
+	return &ImageRatingRepository{DB: db}
+}
+
+// Get retrieves a user's favorite flag and rating of an image. returns gorm.ErrRecordNotFound
+// if the image is neither a favorite nor rated.
+func (r *ImageRatingRepository) Get(userID uint, imagePath string) (*models.ImageRating, error) {
+	var rating models.ImageRating
+	err := r.DB.Where("user_id = ? AND image_path = ?", userID, filepath.ToSlash(imagePath)).First(&rating).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get rating of %s for user %d: %w", imagePath, userID, err)
+	}
+	return &rating, nil
+}
+
+// ListByImagePaths retrieves a user's favorite flags and ratings of a set of images
+func (r *ImageRatingRepository) ListByImagePaths(userID uint, imagePaths []string) ([]models.ImageRating, error) {
+	if len(imagePaths) == 0 {
+		return []models.ImageRating{}, nil
+	}
+	cleanPaths := make([]string, len(imagePaths))
+	for i, p := range imagePaths {
+		cleanPaths[i] = filepath.ToSlash(p)
+	}
+	var ratings []models.ImageRating
+	if err := r.DB.Where("user_id = ? AND image_path IN ?", userID, cleanPaths).Find(&ratings).Error; err != nil {
+		return nil, fmt.Errorf("failed to list ratings for user %d: %w", userID, err)
+	}
+	return ratings, nil
+}
+
+// Set changes a user's favorite flag and/or rating of an image; nil leaves a value as it is.
+// the row is removed once the image is neither a favorite nor rated. returns the new state.
+func (r *ImageRatingRepository) Set(userID uint, imagePath string, favorite *bool, rating *int) (*models.ImageRating, error) {
+	cleanPath := filepath.ToSlash(imagePath)
+	now := time.Now().Unix()
+	record := models.ImageRating{UserID: userID, ImagePath: cleanPath, CreatedAt: now}
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND image_path = ?", userID, cleanPath).First(&record).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if favorite != nil {
+			record.Favorite = *favorite
+		}
+		if rating != nil {
+			record.Rating = *rating
+		}
+		record.UpdatedAt = now
+
+		if !record.Favorite && record.Rating == 0 {
+			return tx.Where("user_id = ? AND image_path = ?", userID, cleanPath).Delete(&models.ImageRating{}).Error
+		}
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set rating of %s for user %d: %w", cleanPath, userID, err)
+	}
+	return &record, nil
+}
+
+// Delete clears a user's favorite flag and rating of an image
+func (r *ImageRatingRepository) Delete(userID uint, imagePath string) error {
+	err := r.DB.Where("user_id = ? AND image_path = ?", userID, filepath.ToSlash(imagePath)).Delete(&models.ImageRating{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clear rating of %s for user %d: %w", imagePath, userID, err)
+	}
+	return nil
+}
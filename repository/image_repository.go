@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/camden-git/mediasysbackend/database"
 	"github.com/camden-git/mediasysbackend/media"
@@ -86,6 +88,51 @@ func (r *ImageRepository) EnsureExistsWithUploader(originalPath string, modTime
 	return result.RowsAffected > 0, nil
 }
 
+// EnsureVideoExists creates a video record if it doesn't exist. image-only tasks are marked
+// not required and the video thumbnail/transcode tasks are set to pending
+func (r *ImageRepository) EnsureVideoExists(originalPath string, modTime int64, uploadedBy *uint, transcode bool) (bool, error) {
+	cleanPath := filepath.ToSlash(originalPath)
+	transcodeStatus := database.StatusNotRequired
+	if transcode {
+		transcodeStatus = database.StatusPending
+	}
+	video := models.Image{
+		OriginalPath:     cleanPath,
+		LastModified:     modTime,
+		MediaType:        database.MediaTypeVideo,
+		MetadataStatus:   database.StatusNotRequired,
+		ThumbnailStatus:  database.StatusPending,
+		DetectionStatus:  database.StatusNotRequired,
+		TranscodeStatus:  transcodeStatus,
+		UploadedByUserID: uploadedBy,
+	}
+	result := r.DB.Where(models.Image{OriginalPath: cleanPath}).FirstOrCreate(&video)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to ensure video record for %s: %w", cleanPath, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// EnsureDocumentExists creates a document record if it doesn't exist. its only task is the
+// thumbnail of its first page, set to pending
+func (r *ImageRepository) EnsureDocumentExists(originalPath string, modTime int64, uploadedBy *uint) (bool, error) {
+	cleanPath := filepath.ToSlash(originalPath)
+	document := models.Image{
+		OriginalPath:     cleanPath,
+		LastModified:     modTime,
+		MediaType:        database.MediaTypeDocument,
+		MetadataStatus:   database.StatusNotRequired,
+		ThumbnailStatus:  database.StatusPending,
+		DetectionStatus:  database.StatusNotRequired,
+		UploadedByUserID: uploadedBy,
+	}
+	result := r.DB.Where(models.Image{OriginalPath: cleanPath}).FirstOrCreate(&document)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to ensure document record for %s: %w", cleanPath, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // MarkTaskProcessing updates a specific task's status to 'processing' and clears its error
 func (r *ImageRepository) MarkTaskProcessing(originalPath, taskStatusColumn string) error {
 	cleanPath := filepath.ToSlash(originalPath)
@@ -93,6 +140,8 @@ func (r *ImageRepository) MarkTaskProcessing(originalPath, taskStatusColumn stri
 		"metadata_status":  "metadata_error",
 		"thumbnail_status": "thumbnail_error",
 		"detection_status": "detection_error",
+		"transcode_status": "transcode_error",
+		"stream_status":    "stream_error",
 	}
 
 	errorColumn, isValid := validStatusColumns[taskStatusColumn]
@@ -100,9 +149,11 @@ func (r *ImageRepository) MarkTaskProcessing(originalPath, taskStatusColumn stri
 		return fmt.Errorf("invalid task status column name: %s", taskStatusColumn)
 	}
 
+	attemptsColumn := strings.TrimSuffix(taskStatusColumn, "_status") + "_attempts"
 	updates := map[string]interface{}{
 		taskStatusColumn: database.StatusProcessing,
 		errorColumn:      gorm.Expr("NULL"),
+		attemptsColumn:   gorm.Expr(attemptsColumn + " + 1"),
 	}
 
 	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updates)
@@ -115,8 +166,43 @@ func (r *ImageRepository) MarkTaskProcessing(originalPath, taskStatusColumn stri
 	return nil
 }
 
-// UpdateThumbnailResult updates the image record with thumbnail generation results
-func (r *ImageRepository) UpdateThumbnailResult(originalPath string, thumbPath *string, modTime int64, taskErr error) error {
+// ResetTaskAttempts clears the attempt counter of a task, after it succeeded or before a forced retry
+func (r *ImageRepository) ResetTaskAttempts(originalPath, taskStatusColumn string) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	validStatusColumns := map[string]bool{
+		"metadata_status":  true,
+		"thumbnail_status": true,
+		"detection_status": true,
+		"transcode_status": true,
+		"stream_status":    true,
+	}
+	if !validStatusColumns[taskStatusColumn] {
+		return fmt.Errorf("invalid task status column name: %s", taskStatusColumn)
+	}
+
+	attemptsColumn := strings.TrimSuffix(taskStatusColumn, "_status") + "_attempts"
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).UpdateColumn(attemptsColumn, 0)
+	if result.Error != nil {
+		return fmt.Errorf("failed to reset %s for %s: %w", attemptsColumn, cleanPath, result.Error)
+	}
+	return nil
+}
+
+// GetImagesWithErrors retrieves all images with at least one task in the error state
+func (r *ImageRepository) GetImagesWithErrors() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Where("metadata_status = ? OR thumbnail_status = ? OR detection_status = ? OR transcode_status = ? OR stream_status = ?",
+		database.StatusError, database.StatusError, database.StatusError, database.StatusError, database.StatusError).
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get images with errors: %w", err)
+	}
+	return images, nil
+}
+
+// UpdateThumbnailResult updates the image record with thumbnail generation results.
+// thumbs is nil when generation failed, which keeps the previous thumbnail.
+func (r *ImageRepository) UpdateThumbnailResult(originalPath string, thumbs *media.ThumbnailSet, modTime int64, taskErr error) error {
 	cleanPath := filepath.ToSlash(originalPath)
 	now := time.Now().Unix()
 	status := database.StatusDone
@@ -128,21 +214,190 @@ func (r *ImageRepository) UpdateThumbnailResult(originalPath string, thumbPath *
 		errStr = &s
 	}
 
-	updates := models.Image{
-		ThumbnailPath:        thumbPath,
-		LastModified:         modTime,
-		ThumbnailStatus:      status,
-		ThumbnailProcessedAt: &now,
-		ThumbnailError:       errStr,
+	updateData := map[string]interface{}{
+		"last_modified":          modTime,
+		"thumbnail_status":       status,
+		"thumbnail_processed_at": &now,
+		"thumbnail_error":        errStr,
+	}
+	if err := addThumbnailColumns(updateData, thumbs); err != nil {
+		return fmt.Errorf("failed to encode thumbnail result for %s: %w", cleanPath, err)
 	}
 
-	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updates)
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update thumbnail result for %s: %w", cleanPath, result.Error)
 	}
 	return nil
 }
 
+// addThumbnailColumns sets the columns describing a generated thumbnail set. the sizes
+// and formats are encoded here, as map updates skip the columns' serializer.
+func addThumbnailColumns(updateData map[string]interface{}, thumbs *media.ThumbnailSet) error {
+	if thumbs == nil {
+		return nil
+	}
+	sizes, err := json.Marshal(thumbs.Sizes)
+	if err != nil {
+		return err
+	}
+	formats, err := json.Marshal(thumbs.Formats)
+	if err != nil {
+		return err
+	}
+	updateData["thumbnail_path"] = thumbs.Path
+	updateData["thumbnail_sizes"] = string(sizes)
+	updateData["thumbnail_formats"] = string(formats)
+	if thumbs.Blurhash != "" {
+		updateData["blurhash"] = thumbs.Blurhash
+	} else {
+		updateData["blurhash"] = nil
+	}
+	return nil
+}
+
+// UpdateVideoThumbnailResult updates a video record with its poster thumbnail and probed
+// stream info. thumbs is nil when generation failed, which clears the thumbnail.
+func (r *ImageRepository) UpdateVideoThumbnailResult(originalPath string, thumbs *media.ThumbnailSet, info *media.VideoInfo, modTime int64, taskErr error) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	now := time.Now().Unix()
+	status := database.StatusDone
+	var errStr *string
+
+	if taskErr != nil {
+		status = database.StatusError
+		s := taskErr.Error()
+		errStr = &s
+	}
+
+	updateData := map[string]interface{}{
+		"media_type":             database.MediaTypeVideo,
+		"last_modified":          modTime,
+		"thumbnail_path":         nil,
+		"blurhash":               nil,
+		"thumbnail_status":       status,
+		"thumbnail_processed_at": &now,
+		"thumbnail_error":        errStr,
+	}
+	if err := addThumbnailColumns(updateData, thumbs); err != nil {
+		return fmt.Errorf("failed to encode video thumbnail result for %s: %w", cleanPath, err)
+	}
+
+	if info != nil {
+		updateData["width"] = info.Width
+		updateData["height"] = info.Height
+		updateData["duration"] = info.Duration
+		updateData["video_codec"] = info.VideoCodec
+		updateData["audio_codec"] = info.AudioCodec
+		updateData["bitrate"] = info.Bitrate
+		// the recording time, like an image's capture time, sorts and filters it in listings
+		updateData["taken_at"] = gorm.Expr("COALESCE(?, sidecar_taken_at)", info.CreatedAt)
+		updateData["content_id"] = info.ContentID
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update video thumbnail result for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
+// UpdateTranscodeResult updates a video record with the result of transcoding a web rendition
+func (r *ImageRepository) UpdateTranscodeResult(originalPath string, renditionPath *string, modTime int64, taskErr error) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	now := time.Now().Unix()
+	status := database.StatusDone
+	var errStr *string
+
+	if taskErr != nil {
+		status = database.StatusError
+		s := taskErr.Error()
+		errStr = &s
+	}
+
+	updateData := map[string]interface{}{
+		"last_modified":          modTime,
+		"rendition_path":         renditionPath,
+		"transcode_status":       status,
+		"transcode_processed_at": &now,
+		"transcode_error":        errStr,
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update transcode result for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
+// SetStreamRequired marks whether a video is packaged for HLS streaming: its stream task
+// becomes pending, or not required, which also drops its stream. returns the files of the
+// dropped stream, for the caller to delete.
+func (r *ImageRepository) SetStreamRequired(originalPath string, required bool) ([]string, error) {
+	cleanPath := filepath.ToSlash(originalPath)
+	if required {
+		result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Update("stream_status", database.StatusPending)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to set stream status of %s: %w", cleanPath, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, nil
+	}
+
+	var video models.Image
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("stream_files").Where("original_path = ?", cleanPath).First(&video).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(map[string]interface{}{
+			"stream_status": database.StatusNotRequired,
+			"stream_files":  nil,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to set stream status of %s: %w", cleanPath, err)
+	}
+	return video.StreamFiles, nil
+}
+
+// UpdateStreamResult updates a video record with the files of its HLS stream. files is nil
+// when packaging failed, which clears the stream.
+func (r *ImageRepository) UpdateStreamResult(originalPath string, files []string, modTime int64, taskErr error) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	now := time.Now().Unix()
+	status := database.StatusDone
+	var errStr *string
+
+	if taskErr != nil {
+		status = database.StatusError
+		s := taskErr.Error()
+		errStr = &s
+	}
+
+	encodedFiles, err := json.Marshal(files)
+	if err != nil {
+		return fmt.Errorf("failed to encode stream files of %s: %w", cleanPath, err)
+	}
+	updateData := map[string]interface{}{
+		"last_modified":       modTime,
+		"stream_files":        string(encodedFiles),
+		"stream_status":       status,
+		"stream_processed_at": &now,
+		"stream_error":        errStr,
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update stream result for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
 // UpdateMetadataResult updates the image record with metadata extraction results
 func (r *ImageRepository) UpdateMetadataResult(originalPath string, meta *media.Metadata, modTime int64, taskErr error) error {
 	cleanPath := filepath.ToSlash(originalPath)
@@ -174,12 +429,43 @@ func (r *ImageRepository) UpdateMetadataResult(originalPath string, meta *media.
 		updateData["lens_model"] = meta.LensModel
 		updateData["camera_make"] = meta.CameraMake
 		updateData["camera_model"] = meta.CameraModel
-		updateData["taken_at"] = meta.TakenAt
+		updateData["title"] = meta.Title
+		updateData["copyright"] = meta.Copyright
+		updateData["license"] = meta.License
+		updateData["content_id"] = meta.ContentID
+		updateData["projection"] = meta.Projection
+		// an import's description is kept unless the XMP sidecar has one
+		updateData["description"] = gorm.Expr("COALESCE(?, description)", meta.Description)
+		// values from an import's sidecar fill in for those the file has none of
+		updateData["taken_at"] = gorm.Expr("COALESCE(?, sidecar_taken_at)", meta.TakenAt)
+		updateData["taken_at_ms"] = meta.TakenAtMs
+		// the file may have changed, so a stacked frame is scored again
+		updateData["sharpness"] = nil
+		updateData["latitude"] = gorm.Expr("COALESCE(?, sidecar_latitude)", meta.Latitude)
+		updateData["longitude"] = gorm.Expr("COALESCE(?, sidecar_longitude)", meta.Longitude)
+		updateData["altitude"] = gorm.Expr("COALESCE(?, sidecar_altitude)", meta.Altitude)
+		// the position may have changed, so it is geocoded again
+		updateData["geocoded_at"] = nil
+		if meta.Latitude == nil || meta.Longitude == nil {
+			updateData["location"] = nil
+			updateData["location_city"] = nil
+			updateData["location_region"] = nil
+			updateData["location_country"] = nil
+		}
 	}
 
-	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update metadata result for %s: %w", cleanPath, result.Error)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData).Error; err != nil {
+			return err
+		}
+		if meta == nil {
+			return nil
+		}
+		// IPTC/XMP keywords become metadata tags
+		return replaceMetadataTags(tx, cleanPath, meta.Keywords)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update metadata result for %s: %w", cleanPath, err)
 	}
 	return nil
 }
@@ -289,11 +575,429 @@ func (r *ImageRepository) Delete(originalPath string) error {
 	return nil
 }
 
+// SetFileSize records the size of an original file, e.g. right after it was uploaded and
+// before it has been hashed
+func (r *ImageRepository) SetFileSize(originalPath string, size int64) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Update("file_size", size)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set file size for %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListBurstCandidates returns the images directly in folder, "." being the root, taken by the
+// given camera at a known time, in order of their capture time in milliseconds. only the
+// fields burst grouping uses are loaded.
+func (r *ImageRepository) ListBurstCandidates(folder, cameraMake, cameraModel string) ([]models.Image, error) {
+	query := r.DB.Model(&models.Image{})
+	if folder == "." || folder == "" {
+		query = query.Where("instr(original_path, '/') = 0")
+	} else {
+		query = ImageFilter{Folder: folder}.apply(r.DB, query)
+	}
+	var images []models.Image
+	err := query.Select("original_path", "taken_at_ms", "stack_id", "stack_best", "sharpness").
+		Where("media_type = ? AND camera_make = ? AND camera_model = ? AND taken_at_ms IS NOT NULL", database.MediaTypeImage, cameraMake, cameraModel).
+		Order("taken_at_ms ASC").
+		Order("original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list burst candidates in %s: %w", folder, err)
+	}
+	return images, nil
+}
+
+// SetStack puts an image into the burst stack stackID, as its best frame or not. a nil
+// stackID takes it out of its stack.
+func (r *ImageRepository) SetStack(originalPath string, stackID *string, best bool) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(map[string]interface{}{
+		"stack_id":   stackID,
+		"stack_best": best,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to set stack of %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetSharpness stores the sharpness score of an image, see media.Sharpness
+func (r *ImageRepository) SetSharpness(originalPath string, sharpness float64) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Update("sharpness", sharpness)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set sharpness of %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindLivePhotoPartner returns the other half of the Live Photo the file at originalPath is
+// half of: the still or video directly in the same folder with the same content identifier,
+// and the other media type. returns gorm.ErrRecordNotFound if there is none.
+func (r *ImageRepository) FindLivePhotoPartner(originalPath, mediaType, contentID string) (*models.Image, error) {
+	cleanPath := filepath.ToSlash(originalPath)
+	query := r.DB.Model(&models.Image{})
+	if folder := path.Dir(cleanPath); folder == "." {
+		query = query.Where("instr(original_path, '/') = 0")
+	} else {
+		query = ImageFilter{Folder: folder}.apply(r.DB, query)
+	}
+	var partner models.Image
+	err := query.Where("content_id = ? AND media_type <> ? AND original_path <> ?", contentID, mediaType, cleanPath).
+		Order("original_path ASC").
+		First(&partner).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to find the Live Photo partner of %s: %w", cleanPath, err)
+	}
+	return &partner, nil
+}
+
+// SetLivePair pairs the still and the video of a Live Photo, unpairing whatever either was
+// paired with before
+func (r *ImageRepository) SetLivePair(stillPath, videoPath string) error {
+	cleanStill := filepath.ToSlash(stillPath)
+	cleanVideo := filepath.ToSlash(videoPath)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Image{}).Where("live_pair_path IN ?", []string{cleanStill, cleanVideo}).Update("live_pair_path", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.Image{}).Where("original_path = ?", cleanStill).Update("live_pair_path", cleanVideo)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		result = tx.Model(&models.Image{}).Where("original_path = ?", cleanVideo).Update("live_pair_path", cleanStill)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to pair %s with %s: %w", cleanStill, cleanVideo, err)
+	}
+	return nil
+}
+
+// EditedMetadata is the descriptive metadata of an image as edited through the API. nil
+// values are cleared, except TakenAt, which is left as it is.
+type EditedMetadata struct {
+	Title       *string
+	Description *string
+	Copyright   *string
+	License     *string
+	TakenAt     *int64 // Unix timestamp
+}
+
+// SetEditedMetadata stores the edited descriptive metadata of an image
+func (r *ImageRepository) SetEditedMetadata(originalPath string, meta EditedMetadata) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	updates := map[string]interface{}{
+		"title":       meta.Title,
+		"description": meta.Description,
+		"copyright":   meta.Copyright,
+		"license":     meta.License,
+	}
+	if meta.TakenAt != nil {
+		updates["taken_at"] = meta.TakenAt
+	}
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set edited metadata for %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ImportedMetadata is what an import read about a file from its sidecar
+type ImportedMetadata struct {
+	Description *string
+	TakenAt     *int64 // Unix timestamp
+	Latitude    *float64
+	Longitude   *float64
+	Altitude    *float64
+	PersonIDs   []uint
+}
+
+// SetImportedMetadata stores the sidecar values of an imported file. the capture time and
+// position are also filled in right away where the record has none, rather than once the
+// metadata task ran.
+func (r *ImageRepository) SetImportedMetadata(originalPath string, meta ImportedMetadata) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	// map updates skip the json serializer of the column
+	personIDs, err := json.Marshal(meta.PersonIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode imported people for %s: %w", cleanPath, err)
+	}
+	updates := map[string]interface{}{
+		"description":         meta.Description,
+		"sidecar_taken_at":    meta.TakenAt,
+		"sidecar_latitude":    meta.Latitude,
+		"sidecar_longitude":   meta.Longitude,
+		"sidecar_altitude":    meta.Altitude,
+		"imported_person_ids": string(personIDs),
+		"taken_at":            gorm.Expr("COALESCE(taken_at, ?)", meta.TakenAt),
+	}
+	if meta.Latitude != nil && meta.Longitude != nil {
+		updates["latitude"] = gorm.Expr("COALESCE(latitude, ?)", meta.Latitude)
+		updates["longitude"] = gorm.Expr("COALESCE(longitude, ?)", meta.Longitude)
+		updates["altitude"] = gorm.Expr("COALESCE(altitude, ?)", meta.Altitude)
+	}
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set imported metadata for %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UploadUsage is the number and total size of the files one user has uploaded
+type UploadUsage struct {
+	UserID uint
+	Files  int64
+	Bytes  int64
+}
+
+// GetUploadUsage sums up the files uploaded by a user that still exist
+func (r *ImageRepository) GetUploadUsage(userID uint) (UploadUsage, error) {
+	usage := UploadUsage{UserID: userID}
+	err := r.DB.Model(&models.Image{}).
+		Select("count(*) AS files, coalesce(sum(file_size), 0) AS bytes").
+		Where("uploaded_by_user_id = ?", userID).
+		Scan(&usage).Error
+	if err != nil {
+		return usage, fmt.Errorf("failed to sum uploads of user %d: %w", userID, err)
+	}
+	usage.UserID = userID
+	return usage, nil
+}
+
+// ListUploadUsage sums up the uploaded files of every user who has uploaded any, largest
+// first
+func (r *ImageRepository) ListUploadUsage() ([]UploadUsage, error) {
+	var usages []UploadUsage
+	err := r.DB.Model(&models.Image{}).
+		Select("uploaded_by_user_id AS user_id, count(*) AS files, coalesce(sum(file_size), 0) AS bytes").
+		Where("uploaded_by_user_id IS NOT NULL").
+		Group("uploaded_by_user_id").
+		Order("bytes DESC").
+		Scan(&usages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum uploads per user: %w", err)
+	}
+	return usages, nil
+}
+
+// UpdateContentHash records the content hash and size of an original file
+func (r *ImageRepository) UpdateContentHash(originalPath, hash string, size int64) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	updates := map[string]interface{}{
+		"content_hash": hash,
+		"file_size":    size,
+		"hashed_at":    time.Now().Unix(),
+	}
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update content hash for %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteWithFaces removes an image record together with its faces and their embeddings, and
+// the embedding, tags, machine tags and ratings of the image
+func (r *ImageRepository) DeleteWithFaces(originalPath string) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var faceIDs []uint
+		if err := tx.Model(&models.Face{}).Where("image_path = ?", cleanPath).Pluck("id", &faceIDs).Error; err != nil {
+			return err
+		}
+		if len(faceIDs) > 0 {
+			if err := tx.Where("face_id IN ?", faceIDs).Delete(&models.FaceEmbedding{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.Face{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.ImageEmbedding{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.ImageTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.MachineTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.ImageRating{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("original_path = ?", cleanPath).Delete(&models.Image{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete image record and faces for %s: %w", cleanPath, err)
+	}
+	return nil
+}
+
+// MovePath rewrites the path of an image record, its faces, embedding, tags, machine tags, ratings and Live Photo pairing after the file was moved.
+// the path is the primary key, so a soft-deleted record left at the new path is purged first.
+func (r *ImageRepository) MovePath(oldPath, newPath string) error {
+	cleanOld := filepath.ToSlash(oldPath)
+	cleanNew := filepath.ToSlash(newPath)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("original_path = ? AND deleted_at IS NOT NULL", cleanNew).Delete(&models.Image{}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.Image{}).Where("original_path = ?", cleanOld).Update("original_path", cleanNew)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&models.Image{}).Where("live_pair_path = ?", cleanOld).Update("live_pair_path", cleanNew).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Face{}).Where("image_path = ?", cleanOld).Update("image_path", cleanNew).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanNew).Delete(&models.ImageEmbedding{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ImageEmbedding{}).Where("image_path = ?", cleanOld).Update("image_path", cleanNew).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanNew).Delete(&models.ImageTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ImageTag{}).Where("image_path = ?", cleanOld).Update("image_path", cleanNew).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanNew).Delete(&models.MachineTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.MachineTag{}).Where("image_path = ?", cleanOld).Update("image_path", cleanNew).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_path = ?", cleanNew).Delete(&models.ImageRating{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ImageRating{}).Where("image_path = ?", cleanOld).Update("image_path", cleanNew).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to move image record %s to %s: %w", cleanOld, cleanNew, err)
+	}
+	return nil
+}
+
+// SetSortPositions stores the custom order of the files directly in a folder: each path gets
+// its index in orderedPaths and the other files of the folder lose their position. returns
+// gorm.ErrRecordNotFound, wrapped with the path, if a path has no record in the folder.
+func (r *ImageRepository) SetSortPositions(folderPath string, orderedPaths []string) error {
+	prefix := strings.TrimSuffix(filepath.ToSlash(folderPath), "/") + "/"
+	prefixLen := utf8.RuneCountInString(prefix)
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Image{}).
+			Where("substr(original_path, 1, ?) = ? AND instr(substr(original_path, ?), '/') = 0", prefixLen, prefix, prefixLen+1).
+			UpdateColumn("sort_position", nil).Error
+		if err != nil {
+			return err
+		}
+		for i, relPath := range orderedPaths {
+			cleanPath := filepath.ToSlash(relPath)
+			if path.Dir(cleanPath)+"/" != prefix {
+				return fmt.Errorf("%w: %s", gorm.ErrRecordNotFound, cleanPath)
+			}
+			result := tx.Model(&models.Image{}).Where("original_path = ?", cleanPath).UpdateColumn("sort_position", i)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: %s", gorm.ErrRecordNotFound, cleanPath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to set sort positions in %s: %w", folderPath, err)
+	}
+	return nil
+}
+
+// ListFiltered returns a page of the image records matching a filter in the given album sort
+// order, together with the total number of matches
+func (r *ImageRepository) ListFiltered(filter ImageFilter, sortOrder string, offset, limit int) ([]models.Image, int64, error) {
+	images, total, err := listImagesPage(r.DB, filter, sortOrder, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list filtered images: %w", err)
+	}
+	return images, total, nil
+}
+
+// ListRecent returns up to limit image records matching a filter, most recently modified
+// first. uploads are modified when they are stored, so new uploads come first.
+func (r *ImageRepository) ListRecent(filter ImageFilter, limit int) ([]models.Image, error) {
+	var images []models.Image
+	err := filter.apply(r.DB, r.DB.Model(&models.Image{})).
+		Order("last_modified DESC").
+		Order("original_path ASC").
+		Limit(limit).
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent images: %w", err)
+	}
+	return images, nil
+}
+
+// ListAll retrieves every image and video record
+func (r *ImageRepository) ListAll() ([]models.Image, error) {
+	var images []models.Image
+	if err := r.DB.Order("original_path ASC").Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return images, nil
+}
+
 // GetImagesRequiringProcessing retrieves images that have one or more tasks in 'pending' status
 func (r *ImageRepository) GetImagesRequiringProcessing() ([]models.Image, error) {
 	var images []models.Image
-	err := r.DB.Where("metadata_status = ? OR thumbnail_status = ? OR detection_status = ?",
-		database.StatusPending, database.StatusPending, database.StatusPending).
+	err := r.DB.Where("metadata_status = ? OR thumbnail_status = ? OR detection_status = ? OR transcode_status = ? OR stream_status = ?",
+		database.StatusPending, database.StatusPending, database.StatusPending, database.StatusPending, database.StatusPending).
 		Find(&images).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get images requiring processing: %w", err)
@@ -301,6 +1005,9 @@ func (r *ImageRepository) GetImagesRequiringProcessing() ([]models.Image, error)
 	return images, nil
 }
 
+// imagePathBatchSize caps the paths per query of GetImagesByPaths, well below SQLite's variable limit
+const imagePathBatchSize = 500
+
 // GetImagesByPaths retrieves multiple image records by their original paths
 func (r *ImageRepository) GetImagesByPaths(originalPaths []string) ([]models.Image, error) {
 	if len(originalPaths) == 0 {
@@ -312,10 +1019,14 @@ func (r *ImageRepository) GetImagesByPaths(originalPaths []string) ([]models.Ima
 		cleanPaths[i] = filepath.ToSlash(p)
 	}
 
-	var images []models.Image
-	err := r.DB.Where("original_path IN ?", cleanPaths).Find(&images).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to get images by paths: %w", err)
+	images := make([]models.Image, 0, len(cleanPaths))
+	for start := 0; start < len(cleanPaths); start += imagePathBatchSize {
+		var batch []models.Image
+		err := r.DB.Where("original_path IN ?", cleanPaths[start:min(start+imagePathBatchSize, len(cleanPaths))]).Find(&batch).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get images by paths: %w", err)
+		}
+		images = append(images, batch...)
 	}
 	return images, nil
 }
@@ -345,3 +1056,285 @@ func (r *ImageRepository) GetDistinctUploaderIDsByFolderPrefix(prefix string) ([
 	}
 	return ids, nil
 }
+
+// GeoPoint is the position of a geotagged image
+type GeoPoint struct {
+	OriginalPath string
+	Latitude     float64
+	Longitude    float64
+	TakenAt      *int64
+}
+
+// GeoBounds is a latitude/longitude box in decimal degrees. West is greater than East for a
+// box that crosses the antimeridian.
+type GeoBounds struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// ListGeoPoints returns the positions of the geotagged images inside bounds, or of all of
+// them when bounds is nil. soft-deleted images are skipped, and so are images flagged or
+// confirmed as NSFW if excludeNSFW is set, and images anywhere below any of excludeFolders.
+func (r *ImageRepository) ListGeoPoints(bounds *GeoBounds, excludeNSFW bool, excludeFolders []string) ([]GeoPoint, error) {
+	query := r.DB.Model(&models.Image{}).
+		Select("original_path", "latitude", "longitude", "taken_at").
+		Where("latitude IS NOT NULL AND longitude IS NOT NULL")
+	if excludeNSFW {
+		query = query.Where("nsfw_status NOT IN ?", models.NSFWHiddenStatuses)
+	}
+	if len(excludeFolders) > 0 {
+		condition, args := subtreesCondition("original_path", excludeFolders)
+		query = query.Where("NOT "+condition, args...)
+	}
+	if bounds != nil {
+		query = query.Where("latitude BETWEEN ? AND ?", bounds.South, bounds.North)
+		if bounds.West <= bounds.East {
+			query = query.Where("longitude BETWEEN ? AND ?", bounds.West, bounds.East)
+		} else {
+			query = query.Where("(longitude >= ? OR longitude <= ?)", bounds.West, bounds.East)
+		}
+	}
+
+	var points []GeoPoint
+	if err := query.Order("original_path ASC").Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to list geotagged images: %w", err)
+	}
+	return points, nil
+}
+
+// UpdateLocation stores the place an image was taken at, as resolved from its GPS position.
+// a nil place clears the location; either way the image is marked as geocoded.
+func (r *ImageRepository) UpdateLocation(originalPath string, place *media.Place) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	now := time.Now().Unix()
+	nullable := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+
+	updateData := map[string]interface{}{
+		"location":         nil,
+		"location_city":    nil,
+		"location_region":  nil,
+		"location_country": nil,
+		"geocoded_at":      &now,
+	}
+	if place != nil {
+		updateData["location"] = nullable(place.Name())
+		updateData["location_city"] = nullable(place.City)
+		updateData["location_region"] = nullable(place.Region)
+		updateData["location_country"] = nullable(place.Country)
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update location for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
+// ListImagesMissingLocation returns the path, modification time and position of the
+// geotagged images that have not been geocoded since their metadata was last extracted
+func (r *ImageRepository) ListImagesMissingLocation() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Model(&models.Image{}).
+		Select("original_path", "last_modified", "latitude", "longitude").
+		Where("latitude IS NOT NULL AND longitude IS NOT NULL AND geocoded_at IS NULL").
+		Order("original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing a location: %w", err)
+	}
+	return images, nil
+}
+
+// UpdateOCRText stores the visible text read from an image, which also makes it searchable.
+// empty text clears it; either way the image is marked as read.
+func (r *ImageRepository) UpdateOCRText(originalPath string, text string) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	now := time.Now().Unix()
+	updateData := map[string]interface{}{
+		"ocr_text": nil,
+		"ocr_at":   &now,
+	}
+	if text != "" {
+		updateData["ocr_text"] = &text
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update OCR text for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
+// ListImagesMissingOCR returns the path and modification time of the images that have not
+// been read by OCR since they last changed
+func (r *ImageRepository) ListImagesMissingOCR() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Model(&models.Image{}).
+		Select("original_path", "last_modified").
+		Where("media_type = ?", database.MediaTypeImage).
+		Where("ocr_at IS NULL OR ocr_at < last_modified").
+		Order("original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing OCR text: %w", err)
+	}
+	return images, nil
+}
+
+// UpdateNSFWScore stores the NSFW score of an image and flags it for review if flagged is
+// set. a review decision stands whatever the score; otherwise a flag is lifted once the
+// image scores below the threshold.
+func (r *ImageRepository) UpdateNSFWScore(originalPath string, score float32, flagged bool) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	status := ""
+	if flagged {
+		status = models.NSFWFlagged
+	}
+	updateData := map[string]interface{}{
+		"nsfw_score":      score,
+		"nsfw_checked_at": time.Now().Unix(),
+		"nsfw_status": gorm.Expr("CASE WHEN nsfw_status IN (?, ?) THEN nsfw_status ELSE ? END",
+			models.NSFWConfirmed, models.NSFWCleared, status),
+	}
+
+	result := r.DB.Model(&models.Image{}).Where("original_path = ?", cleanPath).Updates(updateData)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update NSFW score for %s: %w", cleanPath, result.Error)
+	}
+	return nil
+}
+
+// ListImagesMissingNSFWScore returns the path and modification time of the images that have
+// not been scored for NSFW content since they last changed
+func (r *ImageRepository) ListImagesMissingNSFWScore() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Model(&models.Image{}).
+		Select("original_path", "last_modified").
+		Where("media_type = ?", database.MediaTypeImage).
+		Where("nsfw_checked_at IS NULL OR nsfw_checked_at < last_modified").
+		Order("original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing an NSFW score: %w", err)
+	}
+	return images, nil
+}
+
+// ListByNSFWStatus returns a page of the images with an NSFW status, highest score first,
+// and their total number
+func (r *ImageRepository) ListByNSFWStatus(status string, offset, limit int) ([]models.Image, int64, error) {
+	query := r.DB.Model(&models.Image{}).Where("nsfw_status = ?", status)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count %s NSFW images: %w", status, err)
+	}
+	var images []models.Image
+	err := query.Order("nsfw_score DESC").Order("original_path ASC").Offset(offset).Limit(limit).Find(&images).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list %s NSFW images: %w", status, err)
+	}
+	return images, total, nil
+}
+
+// ReviewNSFW records a reviewer's decision, models.NSFWConfirmed or models.NSFWCleared, on an
+// image that was flagged as NSFW. an earlier decision may be changed. returns
+// gorm.ErrRecordNotFound if the image was never flagged.
+func (r *ImageRepository) ReviewNSFW(originalPath string, status string, reviewerID uint) error {
+	cleanPath := filepath.ToSlash(originalPath)
+	result := r.DB.Model(&models.Image{}).
+		Where("original_path = ? AND nsfw_status <> ''", cleanPath).
+		Updates(map[string]interface{}{
+			"nsfw_status":      status,
+			"nsfw_reviewed_by": reviewerID,
+			"nsfw_reviewed_at": time.Now().Unix(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to review NSFW flag of %s: %w", cleanPath, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// granularities of the timeline
+const (
+	TimelineYear  = "year"
+	TimelineMonth = "month"
+	TimelineDay   = "day"
+)
+
+// timelineFormats are the strftime formats of the bucket keys of each timeline granularity
+var timelineFormats = map[string]string{
+	TimelineYear:  "%Y",
+	TimelineMonth: "%Y-%m",
+	TimelineDay:   "%Y-%m-%d",
+}
+
+// TimelineBucket is the number of images taken in one year, month or day, and the most
+// recently taken of them
+type TimelineBucket struct {
+	Key       string // e.g. "2024", "2024-03" or "2024-03-15"
+	Count     int64
+	CoverPath string
+}
+
+// ListTimelineBuckets groups the images with a capture time by the local year, month or day
+// they were taken in and returns a page of the groups, newest first, together with the total
+// number of groups. takenAfter (inclusive) and takenBefore (exclusive) limit the images, e.g.
+// to the days of one month, and excludeNSFW leaves out images flagged or confirmed as NSFW.
+// excludeFolders leaves out the images anywhere below any of the folders.
+func (r *ImageRepository) ListTimelineBuckets(granularity string, takenAfter, takenBefore *int64, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]TimelineBucket, int64, error) {
+	format, ok := timelineFormats[granularity]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown timeline granularity '%s'", granularity)
+	}
+	key := "strftime('" + format + "', taken_at, 'unixepoch', 'localtime')"
+
+	query := r.DB.Model(&models.Image{}).Where("taken_at IS NOT NULL")
+	if takenAfter != nil {
+		query = query.Where("taken_at >= ?", *takenAfter)
+	}
+	if takenBefore != nil {
+		query = query.Where("taken_at < ?", *takenBefore)
+	}
+	if excludeNSFW {
+		query = query.Where("nsfw_status NOT IN ?", models.NSFWHiddenStatuses)
+	}
+	if len(excludeFolders) > 0 {
+		condition, args := subtreesCondition("original_path", excludeFolders)
+		query = query.Where("NOT "+condition, args...)
+	}
+
+	var total int64
+	keys := query.Session(&gorm.Session{}).Select(key + " AS key").Group("key")
+	if err := r.DB.Table("(?) AS buckets", keys).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count timeline buckets: %w", err)
+	}
+
+	// with max(), SQLite takes the bare original_path from the row holding the maximum
+	query = query.Select(key + " AS key, count(*) AS count, original_path AS cover_path, max(taken_at) AS latest").
+		Group("key").
+		Order("key DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var buckets []TimelineBucket
+	if err := query.Scan(&buckets).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list timeline buckets: %w", err)
+	}
+	if buckets == nil {
+		buckets = []TimelineBucket{}
+	}
+	return buckets, total, nil
+}
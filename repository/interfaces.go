@@ -1,38 +1,72 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/camden-git/mediasysbackend/media"
 	"github.com/camden-git/mediasysbackend/models"
 )
 
 // AlbumRepositoryInterface defines the methods for album data operations
 type AlbumRepositoryInterface interface {
+	WithTx(fn func(repo AlbumRepositoryInterface) error) error // runs fn atomically
 	Create(album *models.Album) error
 	ListAll() ([]models.Album, error)
 	ListAllAdmin() ([]models.Album, error)
 	GetByID(id uint) (*models.Album, error)
 	GetBySlug(slug string) (*models.Album, error)
+	GetBySlugRedirect(slug string) (*models.Album, error)
+	GetByFolderPath(folderPath string) (*models.Album, error)
+	FindByImagePath(imagePath string) (*models.Album, error)
 	Update(albumID uint, name string, description *string, isHidden *bool, location *string) error
 	RequestZip(albumID uint) error
 	MarkZipProcessing(albumID uint) error
+	SetZipProgress(albumID uint, percent int) error
 	SetZipResult(albumID uint, zipPath *string, zipSize *int64, taskErr error) error
+	RequestContactSheet(albumID uint) error
+	MarkContactSheetProcessing(albumID uint) error
+	SetContactSheetResult(albumID uint, sheetPath *string, taskErr error) error
 	UpdateBannerPath(albumID uint, bannerPath *string) error
+	UpdateWatermark(albumID uint, text *string, imagePath *string, position string, opacity float64) error
+	UpdateSlug(albumID uint, slug string) error
 	UpdateSortOrder(albumID uint, sortOrder string) error
+	SetArchived(albumID uint, archived bool) error
+	UpdateRights(albumID uint, copyright, license *string) error
+	MoveFolder(oldFolder, newFolder, newLibraryID string) error
 	Delete(id uint) error
 }
 
+// SmartAlbumRepositoryInterface defines the methods for smart album data operations
+type SmartAlbumRepositoryInterface interface {
+	Create(album *models.SmartAlbum) error
+	ListAll() ([]models.SmartAlbum, error)
+	ListAllAdmin() ([]models.SmartAlbum, error)
+	GetByID(id uint) (*models.SmartAlbum, error)
+	GetBySlug(slug string) (*models.SmartAlbum, error)
+	Update(album *models.SmartAlbum) error
+	Delete(id uint) error
+	ListImages(rules models.SmartAlbumRules, sortOrder string, excludeNSFW bool, offset, limit int) ([]models.Image, int64, error)
+}
+
+// SearchRepositoryInterface defines the methods for full-text search
+type SearchRepositoryInterface interface {
+	Search(query string, kinds []string, tags []string, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]SearchHit, int64, error)
+}
+
 // PersonRepositoryInterface defines the methods for person data operations
 type PersonRepositoryInterface interface {
 	Create(person *models.Person) error
 	GetByID(id uint) (*models.Person, error)
-	ListAll() ([]models.Person, error)
+	ListAll(includeHidden bool) ([]models.Person, error)
 	Update(person *models.Person) error
+	SetProfilePhoto(personID uint, faceID *uint, photoPath *string) error
 	Delete(id uint) error
 	AddAlias(alias *models.Alias) error
 	ListAliasesByPersonID(personID uint) ([]models.Alias, error)
 	DeleteAlias(aliasID uint) error
 	FindPersonIDsByNameOrAlias(query string) ([]uint, error)
 	FindImagesByPersonIDs(personIDs []uint) ([]string, error)
+	IsRecognitionOptedOut(personID uint) (bool, error)
 }
 
 // ImageRepositoryInterface defines the methods for image data operations
@@ -40,14 +74,49 @@ type ImageRepositoryInterface interface {
 	GetByPath(originalPath string) (*models.Image, error)
 	EnsureExists(originalPath string, modTime int64) (bool, error)
 	EnsureExistsWithUploader(originalPath string, modTime int64, uploadedBy *uint) (bool, error)
+	EnsureVideoExists(originalPath string, modTime int64, uploadedBy *uint, transcode bool) (bool, error)
+	EnsureDocumentExists(originalPath string, modTime int64, uploadedBy *uint) (bool, error)
 	MarkTaskProcessing(originalPath, taskStatusColumn string) error
-	UpdateThumbnailResult(originalPath string, thumbPath *string, modTime int64, taskErr error) error
+	ResetTaskAttempts(originalPath, taskStatusColumn string) error
+	UpdateThumbnailResult(originalPath string, thumbs *media.ThumbnailSet, modTime int64, taskErr error) error
 	UpdateMetadataResult(originalPath string, meta *media.Metadata, modTime int64, taskErr error) error
 	UpdateDetectionResult(originalPath string, detections []media.DetectionResult, modTime int64, taskErr error) error
+	UpdateVideoThumbnailResult(originalPath string, thumbs *media.ThumbnailSet, info *media.VideoInfo, modTime int64, taskErr error) error
+	UpdateTranscodeResult(originalPath string, renditionPath *string, modTime int64, taskErr error) error
+	SetStreamRequired(originalPath string, required bool) ([]string, error)
+	UpdateStreamResult(originalPath string, files []string, modTime int64, taskErr error) error
 	Delete(originalPath string) error
+	UpdateContentHash(originalPath, hash string, size int64) error
+	SetFileSize(originalPath string, size int64) error
+	SetImportedMetadata(originalPath string, meta ImportedMetadata) error
+	SetEditedMetadata(originalPath string, meta EditedMetadata) error
+	ListBurstCandidates(folder, cameraMake, cameraModel string) ([]models.Image, error)
+	SetStack(originalPath string, stackID *string, best bool) error
+	SetSharpness(originalPath string, sharpness float64) error
+	FindLivePhotoPartner(originalPath, mediaType, contentID string) (*models.Image, error)
+	SetLivePair(stillPath, videoPath string) error
+	GetUploadUsage(userID uint) (UploadUsage, error)
+	ListUploadUsage() ([]UploadUsage, error)
+	DeleteWithFaces(originalPath string) error
+	MovePath(oldPath, newPath string) error
+	SetSortPositions(folderPath string, orderedPaths []string) error
+	ListFiltered(filter ImageFilter, sortOrder string, offset, limit int) ([]models.Image, int64, error)
+	ListRecent(filter ImageFilter, limit int) ([]models.Image, error)
+	ListAll() ([]models.Image, error)
 	GetImagesRequiringProcessing() ([]models.Image, error)
+	GetImagesWithErrors() ([]models.Image, error)
 	GetImagesByPaths(originalPaths []string) ([]models.Image, error)
 	GetDistinctUploaderIDsByFolderPrefix(prefix string) ([]uint, error)
+	ListGeoPoints(bounds *GeoBounds, excludeNSFW bool, excludeFolders []string) ([]GeoPoint, error)
+	UpdateLocation(originalPath string, place *media.Place) error
+	ListImagesMissingLocation() ([]models.Image, error)
+	UpdateOCRText(originalPath string, text string) error
+	ListImagesMissingOCR() ([]models.Image, error)
+	UpdateNSFWScore(originalPath string, score float32, flagged bool) error
+	ListImagesMissingNSFWScore() ([]models.Image, error)
+	ListByNSFWStatus(status string, offset, limit int) ([]models.Image, int64, error)
+	ReviewNSFW(originalPath string, status string, reviewerID uint) error
+	ListTimelineBuckets(granularity string, takenAfter, takenBefore *int64, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]TimelineBucket, int64, error)
 }
 
 // FaceRepositoryInterface defines the methods for face data operations
@@ -55,11 +124,19 @@ type FaceRepositoryInterface interface {
 	Create(face *models.Face) error
 	GetByID(id uint) (*models.Face, error)
 	ListByImagePath(imagePath string) ([]models.Face, error)
+	ListByPersonAndImagePaths(personID uint, imagePaths []string) ([]models.Face, error)
 	Update(faceID uint, personID *uint, x1, y1, x2, y2 *int) error
 	Delete(id uint) error
 	DeleteUntaggedByImagePath(imagePath string) (int64, error)
+	ListImagePathsNeedingEmbeddings(modelName string) ([]string, error)
+	ListFacesNeedingEmbeddings(imagePath string, modelName string) ([]models.Face, error)
 	TagFace(faceID uint, personID uint) error
 	UntagFace(faceID uint) error
+	ReplaceClusters(clusters [][]uint) error
+	ListClusters(limit int) ([]FaceCluster, error)
+	ListByClusterID(clusterID uint, limit int) ([]models.Face, error)
+	TagCluster(clusterID uint, personID uint) ([]uint, error)
+	SetPersonForFaces(faceIDs []uint, personID *uint) ([]uint, error)
 }
 
 // FaceEmbeddingRepositoryInterface defines the methods for face embedding data operations
@@ -74,6 +151,100 @@ type FaceEmbeddingRepositoryInterface interface {
 	GetUntaggedEmbeddings() ([]models.FaceEmbedding, error)
 	GetEmbeddingsByImagePath(imagePath string) ([]models.FaceEmbedding, error)
 	FindSimilarFaces(targetEmbedding []float32, threshold float32, limit int) ([]models.FaceEmbedding, error)
+	GetTaggedEmbeddings() ([]models.FaceEmbedding, error)
+	Upsert(faceID uint, embedding []float32, modelName string) error
+	PurgeByPersonID(personID uint) (int64, error)
+}
+
+// FaceSuggestionRepositoryInterface defines the methods for face suggestion data operations
+type FaceSuggestionRepositoryInterface interface {
+	GetByID(id uint) (*models.FaceSuggestion, error)
+	ListPending(offset, limit int) ([]models.FaceSuggestion, int64, error)
+	ListRejected() ([]models.FaceSuggestion, error)
+	ReplacePending(faceID uint, suggestion *models.FaceSuggestion) error
+	Review(id uint, status string, reviewerID uint) error
+	DeletePendingByPersonID(personID uint) (int64, error)
+}
+
+// ImageEmbeddingRepositoryInterface defines the methods for image embedding data operations
+type ImageEmbeddingRepositoryInterface interface {
+	Upsert(imagePath string, embedding []float32, modelName string) error
+	GetByImagePath(imagePath string) (*models.ImageEmbedding, error)
+	ListImagesMissingEmbeddings() ([]models.Image, error)
+	SearchSimilar(query []float32, minSimilarity float32, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]ImageSimilarity, int64, error)
+}
+
+// TagRepositoryInterface defines the methods for tag data operations
+type TagRepositoryInterface interface {
+	Create(tag *models.Tag) error
+	GetByID(id uint) (*models.Tag, error)
+	ListByNames(names []string) ([]models.Tag, error)
+	ListWithCounts() ([]TagCount, error)
+	ListByImagePath(imagePath string) ([]models.Tag, error)
+	Rename(id uint, name string) (*models.Tag, error)
+	Delete(id uint) error
+	GetOrCreateByNames(names []string) ([]models.Tag, error)
+	AddToImages(tagIDs []uint, imagePaths []string) (int64, error)
+	RemoveFromImages(tagIDs []uint, imagePaths []string) (int64, error)
+}
+
+// MachineTagRepositoryInterface defines the methods for machine tag data operations
+type MachineTagRepositoryInterface interface {
+	ReplaceForImage(imagePath string, tags []models.MachineTag) error
+	ListByImagePath(imagePath string) ([]models.MachineTag, error)
+	ListWithCounts() ([]MachineTagCount, error)
+	ListImagesMissingClassification() ([]models.Image, error)
+}
+
+// ImageRatingRepositoryInterface defines the methods for per-user favorite and rating data operations
+type ImageRatingRepositoryInterface interface {
+	Get(userID uint, imagePath string) (*models.ImageRating, error)
+	ListByImagePaths(userID uint, imagePaths []string) ([]models.ImageRating, error)
+	Set(userID uint, imagePath string, favorite *bool, rating *int) (*models.ImageRating, error)
+	Delete(userID uint, imagePath string) error
+}
+
+// ActivityRepositoryInterface defines the methods for activity feed data operations
+type ActivityRepositoryInterface interface {
+	Create(activity *models.Activity) error
+	ListByAlbums(albumIDs []uint, offset, limit int) ([]ActivityEntry, int64, error)
+}
+
+// WebhookRepositoryInterface defines the methods for webhook and delivery log data operations
+type WebhookRepositoryInterface interface {
+	Create(webhook *models.Webhook) error
+	GetByID(id uint) (*models.Webhook, error)
+	List() ([]models.Webhook, error)
+	ListActiveForEvent(event string) ([]models.Webhook, error)
+	Update(webhook *models.Webhook) error
+	Delete(id uint) error
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	GetDelivery(id uint) (*models.WebhookDelivery, error)
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+	ListDeliveries(webhookID uint, offset, limit int) ([]models.WebhookDelivery, int64, error)
+	ListPendingDeliveries() ([]models.WebhookDelivery, error)
+}
+
+// NotificationRepositoryInterface defines the methods for notification preference, zip watcher,
+// password reset token and email verification token data operations
+type NotificationRepositoryInterface interface {
+	GetPreferences(userID uint) (map[string]bool, error)
+	SetPreference(userID uint, notificationType string, email bool) error
+	AddZipWatcher(albumID, userID uint) error
+	TakeZipWatchers(albumID uint) ([]models.User, error)
+	CreatePasswordResetToken(token *models.PasswordResetToken) error
+	ConsumePasswordResetToken(tokenHash string) (*models.PasswordResetToken, error)
+	CreateEmailVerificationToken(token *models.EmailVerificationToken) error
+	ConsumeEmailVerificationToken(tokenHash string) (*models.EmailVerificationToken, error)
+}
+
+// LoginFailureRepositoryInterface defines the methods for failed login counter data operations
+type LoginFailureRepositoryInterface interface {
+	Get(kind, subject string) (*models.LoginFailure, error)
+	Save(failure *models.LoginFailure) error
+	Delete(kind, subject string) error
+	ListActive(since, now int64) ([]models.LoginFailure, error)
+	DeleteStale(since, now int64) error
 }
 
 // UserRepository defines the methods for user data operations
@@ -81,7 +252,10 @@ type UserRepository interface {
 	Create(user *models.User) error
 	GetByID(id uint) (*models.User, error)
 	GetByUsername(username string) (*models.User, error)
+	GetByEmail(email string) (*models.User, error)
+	GetByPersonID(personID uint) (*models.User, error)
 	Update(user *models.User) error
+	TouchLastSeen(id uint, seenAt time.Time) error
 	Delete(id uint) error
 	ListAll() ([]models.User, error)
 
@@ -107,6 +281,7 @@ type UserRepository interface {
 
 // RoleRepository defines the methods for role data operations
 type RoleRepository interface {
+	WithTx(fn func(repo RoleRepository) error) error // runs fn atomically
 	Create(role *models.Role) error
 	GetByID(id uint) (*models.Role, error)
 	GetByName(name string) (*models.Role, error)
@@ -136,7 +311,54 @@ type InviteCodeRepository interface {
 	GetByCode(code string) (*models.InviteCode, error)
 	GetByID(id uint) (*models.InviteCode, error)
 	Update(inviteCode *models.InviteCode) error
+	MarkOpened(id uint) error
+	MarkRedeemed(id, userID uint) error
 	IncrementUses(id uint) error
 	ListAll() ([]models.InviteCode, error)
 	Delete(id uint) error
 }
+
+// ShareLinkRepository defines the methods for album share link data operations
+type ShareLinkRepository interface {
+	Create(shareLink *models.ShareLink) error
+	GetByToken(token string) (*models.ShareLink, error)
+	GetByID(id uint) (*models.ShareLink, error)
+	ListByAlbumID(albumID uint) ([]models.ShareLink, error)
+	Update(shareLink *models.ShareLink) error
+	ConsumeView(id uint) (bool, error)
+	Delete(id uint) error
+}
+
+// ApiTokenRepository defines the methods for personal API token data operations
+type ApiTokenRepository interface {
+	Create(token *models.ApiToken) error
+	GetByID(id uint) (*models.ApiToken, error)
+	GetByTokenHash(tokenHash string) (*models.ApiToken, error)
+	ListByUserID(userID uint) ([]models.ApiToken, error)
+	Update(token *models.ApiToken) error
+	TouchLastUsed(id uint, usedAt time.Time) error
+	Delete(id uint) error
+}
+
+// SettingRepository defines the methods for runtime setting overrides
+type SettingRepository interface {
+	ListAll() ([]models.Setting, error)
+	GetByKey(key string) (*models.Setting, error)
+	Upsert(setting *models.Setting) error
+	Delete(key string) error
+}
+
+// StatsRepositoryInterface defines the methods for admin dashboard and album statistics
+type StatsRepositoryInterface interface {
+	LibraryStats() (LibraryStats, error)
+	CountActiveUsers(since int64) (int64, error)
+	CountUploadedSince(since int64) (int64, error)
+	AlbumStats(folderPath string, excludeNSFW, includeHiddenPeople bool) (AlbumStats, error)
+}
+
+// SyncRepositoryInterface defines the methods for reading the sync log of client apps
+type SyncRepositoryInterface interface {
+	ListChanges(since int64, limit int) ([]models.SyncChange, error)
+	Bounds() (head int64, reset int64, err error)
+	ListFacesByIDs(ids []uint) ([]models.Face, error)
+}
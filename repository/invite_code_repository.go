@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/camden-git/mediasysbackend/models"
 	"gorm.io/gorm"
 )
@@ -37,6 +39,17 @@ func (r *GormInviteCodeRepository) IncrementUses(id uint) error {
 	return r.db.Model(&models.InviteCode{}).Where("id = ?", id).UpdateColumn("uses", gorm.Expr("uses + 1")).Error
 }
 
+// MarkOpened records the first time an invite link was followed
+func (r *GormInviteCodeRepository) MarkOpened(id uint) error {
+	return r.db.Model(&models.InviteCode{}).Where("id = ? AND opened_at IS NULL", id).UpdateColumn("opened_at", time.Now()).Error
+}
+
+// MarkRedeemed records the first registration with an invite code
+func (r *GormInviteCodeRepository) MarkRedeemed(id, userID uint) error {
+	return r.db.Model(&models.InviteCode{}).Where("id = ? AND redeemed_at IS NULL", id).
+		UpdateColumns(map[string]interface{}{"redeemed_at": time.Now(), "redeemed_by_user_id": userID}).Error
+}
+
 func (r *GormInviteCodeRepository) ListAll() ([]models.InviteCode, error) {
 	var inviteCodes []models.InviteCode
 	err := r.db.Find(&inviteCodes).Error
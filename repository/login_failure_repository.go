@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// LoginFailureRepository handles database operations for failed login counters
+type LoginFailureRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure LoginFailureRepository implements LoginFailureRepositoryInterface
+var _ LoginFailureRepositoryInterface = (*LoginFailureRepository)(nil)
+
+// NewLoginFailureRepository creates a new instance of LoginFailureRepository
+func NewLoginFailureRepository(db *gorm.DB) *LoginFailureRepository {
+	return &LoginFailureRepository{DB: db}
+}
+
+// Get returns the failure counter of a username or IP, or gorm.ErrRecordNotFound if it has
+// none
+func (r *LoginFailureRepository) Get(kind, subject string) (*models.LoginFailure, error) {
+	var failure models.LoginFailure
+	err := r.DB.Where("kind = ? AND subject = ?", kind, subject).First(&failure).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get login failures of %s %s: %w", kind, subject, err)
+	}
+	return &failure, nil
+}
+
+// Save creates or updates a failure counter
+func (r *LoginFailureRepository) Save(failure *models.LoginFailure) error {
+	if err := r.DB.Save(failure).Error; err != nil {
+		return fmt.Errorf("failed to save login failures of %s %s: %w", failure.Kind, failure.Subject, err)
+	}
+	return nil
+}
+
+// Delete removes a failure counter, lifting any lockout. returns gorm.ErrRecordNotFound if
+// there was none.
+func (r *LoginFailureRepository) Delete(kind, subject string) error {
+	result := r.DB.Where("kind = ? AND subject = ?", kind, subject).Delete(&models.LoginFailure{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete login failures of %s %s: %w", kind, subject, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListActive returns counters that failed since the given time or are still locked at now,
+// locked ones first
+func (r *LoginFailureRepository) ListActive(since, now int64) ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	err := r.DB.Where("last_failure_at >= ? OR locked_until > ?", since, now).
+		Order("locked_until DESC, last_failure_at DESC").
+		Find(&failures).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login failures: %w", err)
+	}
+	return failures, nil
+}
+
+// DeleteStale removes counters that neither failed since the given time nor are locked at now
+func (r *LoginFailureRepository) DeleteStale(since, now int64) error {
+	err := r.DB.Where("last_failure_at < ? AND locked_until <= ?", since, now).Delete(&models.LoginFailure{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete stale login failures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// MachineTagRepository handles database operations for MachineTag entities
+type MachineTagRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure MachineTagRepository implements MachineTagRepositoryInterface
+var _ MachineTagRepositoryInterface = (*MachineTagRepository)(nil)
+
+// NewMachineTagRepository creates a new instance of MachineTagRepository
+func NewMachineTagRepository(db *gorm.DB) *MachineTagRepository {
+	return &MachineTagRepository{DB: db}
+}
+
+// MachineTagCount is a machine tag name with the number of images carrying it
+type MachineTagCount struct {
+	Name       string `json:"name"`
+	ImageCount int64  `json:"image_count"`
+}
+
+// ReplaceForImage makes tags the machine tags of an image and marks it classified, replacing
+// the tags of any earlier classification
+func (r *MachineTagRepository) ReplaceForImage(imagePath string, tags []models.MachineTag) error {
+	cleanPath := filepath.ToSlash(imagePath)
+	now := time.Now().Unix()
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_path = ?", cleanPath).Delete(&models.MachineTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			records := make([]models.MachineTag, len(tags))
+			for i, tag := range tags {
+				tag.ImagePath = cleanPath
+				tag.Name = strings.ToLower(models.NormalizeTagName(tag.Name))
+				tag.CreatedAt = now
+				records[i] = tag
+			}
+			if err := tx.Create(&records).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Image{}).Where("original_path = ?", cleanPath).Update("classified_at", now).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store machine tags of %s: %w", cleanPath, err)
+	}
+	return nil
+}
+
+// ListByImagePath retrieves the machine tags of an image, most confident first
+func (r *MachineTagRepository) ListByImagePath(imagePath string) ([]models.MachineTag, error) {
+	var tags []models.MachineTag
+	err := r.DB.Where("image_path = ?", filepath.ToSlash(imagePath)).
+		Order("confidence DESC").
+		Order("name ASC").
+		Find(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machine tags of %s: %w", imagePath, err)
+	}
+	return tags, nil
+}
+
+// ListWithCounts retrieves every machine tag name with the number of (not deleted) images
+// carrying it, ordered by name
+func (r *MachineTagRepository) ListWithCounts() ([]MachineTagCount, error) {
+	var tags []MachineTagCount
+	err := r.DB.Model(&models.MachineTag{}).
+		Select("machine_tags.name, COUNT(*) AS image_count").
+		Joins("JOIN images ON images.original_path = machine_tags.image_path AND images.deleted_at IS NULL").
+		Group("machine_tags.name").
+		Order("machine_tags.name ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machine tags: %w", err)
+	}
+	return tags, nil
+}
+
+// ListImagesMissingClassification returns the path and modification time of the images (not
+// videos) that have not been classified since they last changed
+func (r *MachineTagRepository) ListImagesMissingClassification() ([]models.Image, error) {
+	var images []models.Image
+	err := r.DB.Model(&models.Image{}).
+		Select("original_path", "last_modified").
+		Where("media_type = ?", database.MediaTypeImage).
+		Where("classified_at IS NULL OR classified_at < last_modified").
+		Order("original_path ASC").
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing classification: %w", err)
+	}
+	return images, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationRepository handles database operations for notification preferences, zip
+// watchers, password reset tokens and email verification tokens
+type NotificationRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure NotificationRepository implements NotificationRepositoryInterface
+var _ NotificationRepositoryInterface = (*NotificationRepository)(nil)
+
+// NewNotificationRepository creates a new instance of NotificationRepository
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{DB: db}
+}
+
+// GetPreferences returns whether each notification type is emailed to a user, falling back
+// to models.DefaultNotificationPreferences for types the user has not chosen
+func (r *NotificationRepository) GetPreferences(userID uint) (map[string]bool, error) {
+	var rows []models.NotificationPreference
+	if err := r.DB.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences of user %d: %w", userID, err)
+	}
+	preferences := make(map[string]bool, len(models.DefaultNotificationPreferences))
+	for notificationType, enabled := range models.DefaultNotificationPreferences {
+		preferences[notificationType] = enabled
+	}
+	for _, row := range rows {
+		if _, known := preferences[row.Type]; known {
+			preferences[row.Type] = row.Email
+		}
+	}
+	return preferences, nil
+}
+
+// SetPreference stores whether a notification type is emailed to a user
+func (r *NotificationRepository) SetPreference(userID uint, notificationType string, email bool) error {
+	preference := models.NotificationPreference{UserID: userID, Type: notificationType, Email: email, UpdatedAt: time.Now().Unix()}
+	if err := r.DB.Save(&preference).Error; err != nil {
+		return fmt.Errorf("failed to set %s notification preference of user %d: %w", notificationType, userID, err)
+	}
+	return nil
+}
+
+// AddZipWatcher asks for a user to be told when an album's archive is ready
+func (r *NotificationRepository) AddZipWatcher(albumID, userID uint) error {
+	watcher := models.ZipWatcher{AlbumID: albumID, UserID: userID, CreatedAt: time.Now().Unix()}
+	if err := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&watcher).Error; err != nil {
+		return fmt.Errorf("failed to add zip watcher for album %d: %w", albumID, err)
+	}
+	return nil
+}
+
+// TakeZipWatchers removes and returns the users waiting for an album's archive
+func (r *NotificationRepository) TakeZipWatchers(albumID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).
+			Joins("JOIN zip_watchers ON zip_watchers.user_id = users.id").
+			Where("zip_watchers.album_id = ?", albumID).
+			Find(&users).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("album_id = ?", albumID).Delete(&models.ZipWatcher{}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to take zip watchers of album %d: %w", albumID, err)
+	}
+	return users, nil
+}
+
+// CreatePasswordResetToken stores a reset token, replacing any earlier token of the user
+func (r *NotificationRepository) CreatePasswordResetToken(token *models.PasswordResetToken) error {
+	if token.CreatedAt == 0 {
+		token.CreatedAt = time.Now().Unix()
+	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", token.UserID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token for user %d: %w", token.UserID, err)
+	}
+	return nil
+}
+
+// ConsumePasswordResetToken looks up an unexpired reset token by hash and removes every reset
+// token of its user, so a token works only once. returns gorm.ErrRecordNotFound if the token
+// does not exist or has expired.
+func (r *NotificationRepository) ConsumePasswordResetToken(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", token.UserID).Delete(&models.PasswordResetToken{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+	if token.ExpiresAt < time.Now().Unix() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+// CreateEmailVerificationToken stores a verification token, replacing any earlier token of
+// the user
+func (r *NotificationRepository) CreateEmailVerificationToken(token *models.EmailVerificationToken) error {
+	if token.CreatedAt == 0 {
+		token.CreatedAt = time.Now().Unix()
+	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", token.UserID).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create email verification token for user %d: %w", token.UserID, err)
+	}
+	return nil
+}
+
+// ConsumeEmailVerificationToken looks up an unexpired verification token by hash and removes
+// every verification token of its user. returns gorm.ErrRecordNotFound if the token does not
+// exist or has expired.
+func (r *NotificationRepository) ConsumeEmailVerificationToken(tokenHash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", token.UserID).Delete(&models.EmailVerificationToken{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to consume email verification token: %w", err)
+	}
+	if token.ExpiresAt < time.Now().Unix() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
@@ -49,26 +49,33 @@ func (r *PersonRepository) GetByID(id uint) (*models.Person, error) {
 	return &person, nil
 }
 
-// ListAll retrieves all people, ordered by primary_name, preloading Aliases
-func (r *PersonRepository) ListAll() ([]models.Person, error) {
+// ListAll retrieves all people, ordered by primary_name, preloading Aliases. hidden people
+// are only included when includeHidden is set.
+func (r *PersonRepository) ListAll(includeHidden bool) ([]models.Person, error) {
 	var people []models.Person
-	err := r.DB.Preload("Aliases").Order("primary_name ASC").Find(&people).Error
+	query := r.DB.Preload("Aliases")
+	if !includeHidden {
+		query = query.Where("is_hidden = ?", false)
+	}
+	err := query.Order("primary_name ASC").Find(&people).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to list people: %w", err)
 	}
 	return people, nil
 }
 
-// Update updates an existing person's details
+// Update updates an existing person's name and profile details. the profile photo is set
+// with SetProfilePhoto.
 func (r *PersonRepository) Update(person *models.Person) error {
 	person.UpdatedAt = time.Now().Unix()
-	// result := r.DB.Model(&models.Person{ID: person.ID}).Updates(map[string]interface{}{
-	// 	"PrimaryName": person.PrimaryName,
-	// 	"UpdatedAt":   person.UpdatedAt,
-	// })
-	result := r.DB.Model(&models.Person{ID: person.ID}).Updates(models.Person{
-		PrimaryName: person.PrimaryName,
-		UpdatedAt:   person.UpdatedAt,
+	// a map, so cleared profile fields and an unset hidden flag are written too
+	result := r.DB.Model(&models.Person{ID: person.ID}).Updates(map[string]interface{}{
+		"primary_name":        person.PrimaryName,
+		"birth_date":          person.BirthDate,
+		"description":         person.Description,
+		"is_hidden":           person.IsHidden,
+		"recognition_opt_out": person.RecognitionOptOut,
+		"updated_at":          person.UpdatedAt,
 	})
 
 	if result.Error != nil {
@@ -80,16 +87,16 @@ func (r *PersonRepository) Update(person *models.Person) error {
 	return nil
 }
 
-// Delete removes a person by their ID
-func (r *PersonRepository) Delete(id uint) error {
-	// result := r.DB.Unscoped().Delete(&models.Person{}, id)
-
-	// result := r.DB.Delete(&models.Person{}, id)
-
-	result := r.DB.Delete(&models.Person{}, id)
-
+// SetProfilePhoto sets the profile photo of a person and the face it was cropped from, or
+// removes it when both are nil
+func (r *PersonRepository) SetProfilePhoto(personID uint, faceID *uint, photoPath *string) error {
+	result := r.DB.Model(&models.Person{ID: personID}).Updates(map[string]interface{}{
+		"profile_face_id": faceID,
+		"photo_path":      photoPath,
+		"updated_at":      time.Now().Unix(),
+	})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete person ID %d: %w", id, result.Error)
+		return fmt.Errorf("failed to set profile photo of person ID %d: %w", personID, result.Error)
 	}
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
@@ -97,6 +104,27 @@ func (r *PersonRepository) Delete(id uint) error {
 	return nil
 }
 
+// Delete removes a person by their ID, unlinking the user linked to them
+func (r *PersonRepository) Delete(id uint) error {
+	// result := r.DB.Unscoped().Delete(&models.Person{}, id)
+
+	// result := r.DB.Delete(&models.Person{}, id)
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("person_id = ?", id).Update("person_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to unlink user from person ID %d: %w", id, err)
+		}
+		result := tx.Delete(&models.Person{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete person ID %d: %w", id, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
 // AddAlias adds a new alias for a person
 func (r *PersonRepository) AddAlias(alias *models.Alias) error {
 	err := r.DB.Create(alias).Error
@@ -179,6 +207,17 @@ func (r *PersonRepository) FindImagesByPersonIDs(personIDs []uint) ([]string, er
 	return imagePaths, nil
 }
 
+// IsRecognitionOptedOut reports whether a person opted out of face recognition. unknown
+// people have not.
+func (r *PersonRepository) IsRecognitionOptedOut(personID uint) (bool, error) {
+	var optedOut []bool
+	err := r.DB.Model(&models.Person{}).Where("id = ?", personID).Pluck("recognition_opt_out", &optedOut).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check recognition opt-out of person ID %d: %w", personID, err)
+	}
+	return len(optedOut) > 0 && optedOut[0], nil
+}
+
 // GetPersonWithAliases retrieves a person and their aliases
 func (r *PersonRepository) GetPersonWithAliases(personID uint) (*models.Person, error) {
 	var person models.Person
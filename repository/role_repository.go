@@ -17,6 +17,14 @@ func NewGormRoleRepository(db *gorm.DB) RoleRepository {
 	return &GormRoleRepository{db: db}
 }
 
+// WithTx runs fn with a repository bound to a single transaction. what fn does through it is
+// committed when fn returns nil and rolled back otherwise.
+func (r *GormRoleRepository) WithTx(fn func(repo RoleRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormRoleRepository{db: tx})
+	})
+}
+
 func (r *GormRoleRepository) Create(role *models.Role) error {
 	return r.db.Create(role).Error
 }
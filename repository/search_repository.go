@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// kinds of search results
+const (
+	SearchKindImage  = "image"
+	SearchKindAlbum  = "album"
+	SearchKindPerson = "person"
+)
+
+// SearchHit is a single full-text search match. Ref is the image path, or the album or
+// person ID.
+type SearchHit struct {
+	Kind  string  `json:"kind"`
+	Ref   string  `json:"ref"`
+	Title string  `json:"title"`
+	Body  string  `json:"body"`
+	Rank  float64 `json:"rank"` // lower is better
+}
+
+// SearchRepository runs full-text searches across images, albums and people. it uses the
+// FTS5 index created by database.EnsureSearchIndex, or LIKE matching when the index is
+// not available.
+type SearchRepository struct {
+	DB  *gorm.DB
+	FTS bool
+}
+
+// NewSearchRepository creates a new instance of SearchRepository
+func NewSearchRepository(db *gorm.DB, fts bool) *SearchRepository {
+	return &SearchRepository{DB: db, FTS: fts}
+}
+
+// SearchTerms splits a query into the words that are searched for
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Search returns a page of the results matching every term of a query, best first, and the
+// total number of results. kinds limits the result kinds; empty means all of them. tags limits
+// the results to images with any of the named tags, and excludeNSFW leaves out images flagged
+// or confirmed as NSFW. excludeFolders leaves out the images anywhere below any of the folders,
+// e.g. those of hidden albums. hidden albums and people are not returned.
+func (r *SearchRepository) Search(query string, kinds []string, tags []string, excludeNSFW bool, excludeFolders []string, offset, limit int) ([]SearchHit, int64, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []SearchHit{}, 0, nil
+	}
+	wanted := func(kind string) bool {
+		if len(tags) > 0 && kind != SearchKindImage {
+			return false
+		}
+		if len(kinds) == 0 {
+			return true
+		}
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	tagged := ""
+	var tagKeys []string
+	if len(tags) > 0 {
+		tagged = " AND %s IN (SELECT image_tags.image_path FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name_key IN ?)"
+		for _, tag := range tags {
+			tagKeys = append(tagKeys, strings.ToLower(models.NormalizeTagName(tag)))
+		}
+	}
+
+	// like the tag condition, the NSFW condition is filled in with the image path column
+	nsfw := ""
+	if excludeNSFW {
+		nsfw = " AND %s NOT IN (SELECT original_path FROM images WHERE nsfw_status IN ('" + strings.Join(models.NSFWHiddenStatuses, "', '") + "'))"
+	}
+
+	// excluded folders are a condition on the path column of each image select, with their args
+	excluded := func(column string) (string, []interface{}) {
+		if len(excludeFolders) == 0 {
+			return "", nil
+		}
+		condition, args := subtreesCondition(column, excludeFolders)
+		return " AND NOT " + condition, args
+	}
+
+	var selects []string
+	var args []interface{}
+	if r.FTS {
+		// every term is a quoted prefix query, so input cannot inject FTS5 syntax
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"*`
+		}
+		match := strings.Join(quoted, " ")
+		if wanted(SearchKindImage) {
+			folders, folderArgs := excluded("ref")
+			selects = append(selects, "SELECT 'image' AS kind, ref, title, body, bm25(search_images, 0, 2.0, 1.0) AS rank FROM search_images WHERE search_images MATCH ?"+tagFilter(tagged, "ref")+tagFilter(nsfw, "ref")+folders)
+			args = append(args, match)
+			if tagged != "" {
+				args = append(args, tagKeys)
+			}
+			args = append(args, folderArgs...)
+		}
+		if wanted(SearchKindAlbum) {
+			selects = append(selects, "SELECT 'album' AS kind, CAST(rowid AS TEXT) AS ref, title, body, bm25(search_albums, 4.0, 1.0) AS rank FROM search_albums WHERE search_albums MATCH ? AND rowid IN (SELECT id FROM albums WHERE is_hidden = 0)")
+			args = append(args, match)
+		}
+		if wanted(SearchKindPerson) {
+			selects = append(selects, "SELECT 'person' AS kind, CAST(rowid AS TEXT) AS ref, title, body, bm25(search_people, 4.0, 2.0) AS rank FROM search_people WHERE search_people MATCH ? AND rowid IN (SELECT id FROM people WHERE is_hidden = 0)")
+			args = append(args, match)
+		}
+	} else {
+		likeAll := func(columns ...string) (string, []interface{}) {
+			var conditions []string
+			var likeArgs []interface{}
+			for _, term := range terms {
+				var alternatives []string
+				for _, column := range columns {
+					alternatives = append(alternatives, "LOWER("+column+") LIKE ? ESCAPE '\\'")
+					likeArgs = append(likeArgs, "%"+escapeLike(term)+"%")
+				}
+				conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+			}
+			return strings.Join(conditions, " AND "), likeArgs
+		}
+		if wanted(SearchKindImage) {
+			where, likeArgs := likeAll("original_path", "camera_make", "camera_model", "lens_make", "lens_model", "ocr_text")
+			folders, folderArgs := excluded("original_path")
+			selects = append(selects, "SELECT 'image' AS kind, original_path AS ref, original_path AS title, trim(coalesce(camera_make, '') || ' ' || coalesce(camera_model, '')) AS body, 0 AS rank FROM images WHERE deleted_at IS NULL AND "+where+tagFilter(tagged, "original_path")+tagFilter(nsfw, "original_path")+folders)
+			args = append(args, likeArgs...)
+			if tagged != "" {
+				args = append(args, tagKeys)
+			}
+			args = append(args, folderArgs...)
+		}
+		if wanted(SearchKindAlbum) {
+			where, likeArgs := likeAll("name", "description", "folder_path")
+			selects = append(selects, "SELECT 'album' AS kind, CAST(id AS TEXT) AS ref, name AS title, coalesce(description, '') AS body, 0 AS rank FROM albums WHERE deleted_at IS NULL AND is_hidden = 0 AND "+where)
+			args = append(args, likeArgs...)
+		}
+		if wanted(SearchKindPerson) {
+			where, likeArgs := likeAll("primary_name", "coalesce((SELECT group_concat(name, ' ') FROM aliases WHERE aliases.person_id = people.id), '')")
+			selects = append(selects, "SELECT 'person' AS kind, CAST(id AS TEXT) AS ref, primary_name AS title, '' AS body, 0 AS rank FROM people WHERE is_hidden = 0 AND "+where)
+			args = append(args, likeArgs...)
+		}
+	}
+	if len(selects) == 0 {
+		return []SearchHit{}, 0, nil
+	}
+	union := strings.Join(selects, " UNION ALL ")
+
+	var total int64
+	if err := r.DB.Raw("SELECT count(*) FROM ("+union+")", args...).Scan(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	// people and albums come before images when ranks tie, e.g. in LIKE mode
+	paged := "SELECT * FROM (" + union + ") ORDER BY rank ASC, CASE kind WHEN 'person' THEN 0 WHEN 'album' THEN 1 ELSE 2 END, title ASC"
+	pageArgs := append([]interface{}{}, args...)
+	if limit > 0 {
+		paged += " LIMIT ? OFFSET ?"
+		pageArgs = append(pageArgs, limit, offset)
+	}
+	var hits []SearchHit
+	if err := r.DB.Raw(paged, pageArgs...).Scan(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+	return hits, total, nil
+}
+
+// tagFilter fills the path column into the tag or NSFW condition of a search, if there is one
+func tagFilter(condition, column string) string {
+	if condition == "" {
+		return ""
+	}
+	return fmt.Sprintf(condition, column)
+}
+
+// escapeLike escapes the LIKE wildcards of a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
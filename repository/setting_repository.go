@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormSettingRepository struct {
+	db *gorm.DB
+}
+
+func NewGormSettingRepository(db *gorm.DB) SettingRepository {
+	return &GormSettingRepository{db: db}
+}
+
+func (r *GormSettingRepository) ListAll() ([]models.Setting, error) {
+	var settings []models.Setting
+	err := r.db.Order("key asc").Find(&settings).Error
+	return settings, err
+}
+
+func (r *GormSettingRepository) GetByKey(key string) (*models.Setting, error) {
+	var setting models.Setting
+	err := r.db.Where("key = ?", key).First(&setting).Error
+	return &setting, err
+}
+
+func (r *GormSettingRepository) Upsert(setting *models.Setting) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by_user_id", "updated_at"}),
+	}).Create(setting).Error
+}
+
+func (r *GormSettingRepository) Delete(key string) error {
+	return r.db.Where("key = ?", key).Delete(&models.Setting{}).Error
+}
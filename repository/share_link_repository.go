@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+type GormShareLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewGormShareLinkRepository(db *gorm.DB) ShareLinkRepository {
+	return &GormShareLinkRepository{db: db}
+}
+
+func (r *GormShareLinkRepository) Create(shareLink *models.ShareLink) error {
+	return r.db.Create(shareLink).Error
+}
+
+func (r *GormShareLinkRepository) GetByToken(token string) (*models.ShareLink, error) {
+	var shareLink models.ShareLink
+	err := r.db.Where("token = ?", token).First(&shareLink).Error
+	return &shareLink, err
+}
+
+func (r *GormShareLinkRepository) GetByID(id uint) (*models.ShareLink, error) {
+	var shareLink models.ShareLink
+	err := r.db.First(&shareLink, id).Error
+	return &shareLink, err
+}
+
+func (r *GormShareLinkRepository) ListByAlbumID(albumID uint) ([]models.ShareLink, error) {
+	var shareLinks []models.ShareLink
+	err := r.db.Where("album_id = ?", albumID).Order("created_at DESC").Find(&shareLinks).Error
+	return shareLinks, err
+}
+
+func (r *GormShareLinkRepository) Update(shareLink *models.ShareLink) error {
+	return r.db.Save(shareLink).Error
+}
+
+// ConsumeView atomically counts a view, refusing once max_views has been reached.
+// returns false if no view was left
+func (r *GormShareLinkRepository) ConsumeView(id uint) (bool, error) {
+	result := r.db.Model(&models.ShareLink{}).
+		Where("id = ? AND (max_views IS NULL OR views < max_views)", id).
+		UpdateColumn("views", gorm.Expr("views + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormShareLinkRepository) Delete(id uint) error {
+	return r.db.Delete(&models.ShareLink{}, id).Error
+}
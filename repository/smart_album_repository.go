@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// SmartAlbumRepository handles database operations for SmartAlbum entities
+type SmartAlbumRepository struct {
+	DB *gorm.DB
+}
+
+// NewSmartAlbumRepository creates a new instance of SmartAlbumRepository
+func NewSmartAlbumRepository(db *gorm.DB) *SmartAlbumRepository {
+	return &SmartAlbumRepository{DB: db}
+}
+
+// Create creates a new smart album record in the database
+func (r *SmartAlbumRepository) Create(album *models.SmartAlbum) error {
+	now := time.Now().Unix()
+	if album.CreatedAt == 0 {
+		album.CreatedAt = now
+	}
+	if album.UpdatedAt == 0 {
+		album.UpdatedAt = now
+	}
+	if album.SortOrder == "" {
+		album.SortOrder = database.SortDateDesc
+	}
+
+	if err := r.DB.Create(album).Error; err != nil {
+		return fmt.Errorf("failed to create smart album %s: %w", album.Name, err)
+	}
+	return nil
+}
+
+// ListAll retrieves all non-hidden smart albums, ordered by name
+func (r *SmartAlbumRepository) ListAll() ([]models.SmartAlbum, error) {
+	var albums []models.SmartAlbum
+	if err := r.DB.Where("is_hidden = ?", false).Order("name ASC").Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("failed to list smart albums: %w", err)
+	}
+	return albums, nil
+}
+
+// ListAllAdmin retrieves all smart albums (including hidden ones), ordered by name
+func (r *SmartAlbumRepository) ListAllAdmin() ([]models.SmartAlbum, error) {
+	var albums []models.SmartAlbum
+	if err := r.DB.Order("name ASC").Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("failed to list smart albums for admin: %w", err)
+	}
+	return albums, nil
+}
+
+// GetByID retrieves a smart album by its ID
+func (r *SmartAlbumRepository) GetByID(id uint) (*models.SmartAlbum, error) {
+	var album models.SmartAlbum
+	err := r.DB.First(&album, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get smart album by ID %d: %w", id, err)
+	}
+	return &album, nil
+}
+
+// GetBySlug retrieves a smart album by its slug
+func (r *SmartAlbumRepository) GetBySlug(slug string) (*models.SmartAlbum, error) {
+	var album models.SmartAlbum
+	err := r.DB.Where("slug = ?", slug).First(&album).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get smart album by slug %s: %w", slug, err)
+	}
+	return &album, nil
+}
+
+// Update saves every field of a smart album
+func (r *SmartAlbumRepository) Update(album *models.SmartAlbum) error {
+	album.UpdatedAt = time.Now().Unix()
+	result := r.DB.Model(album).Select("*").Omit("id", "created_at", "deleted_at").Updates(album)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update smart album ID %d: %w", album.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete soft deletes a smart album by its ID
+func (r *SmartAlbumRepository) Delete(id uint) error {
+	result := r.DB.Delete(&models.SmartAlbum{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete smart album ID %d: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListImages evaluates smart album rules against the images table and returns a page of the
+// matching records in the given sort order, together with the total number of matches.
+// excludeNSFW leaves out images flagged or confirmed as NSFW.
+func (r *SmartAlbumRepository) ListImages(rules models.SmartAlbumRules, sortOrder string, excludeNSFW bool, offset, limit int) ([]models.Image, int64, error) {
+	filter := ImageFilter{
+		FolderGlobs:  rules.FolderGlobs,
+		TakenAfter:   rules.TakenAfter,
+		TakenBefore:  rules.TakenBefore,
+		CameraMakes:  rules.CameraMakes,
+		CameraModels: rules.CameraModels,
+		PersonIDs:    rules.PersonIDs,
+		MediaType:    rules.MediaType,
+		Locations:    rules.Locations,
+		Tags:         rules.Tags,
+		MachineTags:  rules.MachineTags,
+		ExcludeNSFW:  excludeNSFW,
+	}
+	images, total, err := listImagesPage(r.DB, filter, sortOrder, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list smart album images: %w", err)
+	}
+	return images, total, nil
+}
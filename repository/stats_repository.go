@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// LibraryStats counts the records of the library for the admin dashboard
+type LibraryStats struct {
+	Images        int64            `json:"images"`
+	Videos        int64            `json:"videos"`
+	Documents     int64            `json:"documents"`
+	Albums        int64            `json:"albums"`
+	People        int64            `json:"people"`
+	Users         int64            `json:"users"`
+	OriginalBytes int64            `json:"original_bytes"` // of the originals hashed so far
+	ArchiveBytes  int64            `json:"archive_bytes"`  // of the album zips
+	TaskErrors    map[string]int64 `json:"task_errors"`    // images whose last attempt of the task failed, by task
+	TaskPending   map[string]int64 `json:"task_pending"`   // images waiting for the task, by task
+}
+
+// status column of each image task
+var statsTaskColumns = map[string]string{
+	"thumbnail": "thumbnail_status",
+	"metadata":  "metadata_status",
+	"detection": "detection_status",
+	"transcode": "transcode_status",
+	"stream":    "stream_status",
+}
+
+// StatsRepository aggregates counts across tables for the admin dashboard
+type StatsRepository struct {
+	DB *gorm.DB
+}
+
+// NewStatsRepository creates a new instance of StatsRepository
+func NewStatsRepository(db *gorm.DB) *StatsRepository {
+	return &StatsRepository{DB: db}
+}
+
+// LibraryStats counts the images, videos, albums, people and users and the failed and
+// pending tasks, and sums the size of the originals and album zips
+func (r *StatsRepository) LibraryStats() (LibraryStats, error) {
+	stats := LibraryStats{TaskErrors: make(map[string]int64), TaskPending: make(map[string]int64)}
+
+	var byType []struct {
+		MediaType string
+		Count     int64
+		Bytes     int64
+	}
+	err := r.DB.Model(&models.Image{}).
+		Select("media_type, COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Group("media_type").
+		Scan(&byType).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count images: %w", err)
+	}
+	for _, row := range byType {
+		if row.MediaType == database.MediaTypeVideo {
+			stats.Videos += row.Count
+		} else if row.MediaType == database.MediaTypeDocument {
+			stats.Documents += row.Count
+		} else {
+			stats.Images += row.Count
+		}
+		stats.OriginalBytes += row.Bytes
+	}
+
+	counts := []struct {
+		model interface{}
+		into  *int64
+	}{
+		{&models.Album{}, &stats.Albums},
+		{&models.Person{}, &stats.People},
+		{&models.User{}, &stats.Users},
+	}
+	for _, c := range counts {
+		if err := r.DB.Model(c.model).Count(c.into).Error; err != nil {
+			return stats, fmt.Errorf("failed to count records: %w", err)
+		}
+	}
+	err = r.DB.Model(&models.Album{}).Select("COALESCE(SUM(zip_size), 0)").Scan(&stats.ArchiveBytes).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to sum album zip sizes: %w", err)
+	}
+
+	for task, column := range statsTaskColumns {
+		var rows []struct {
+			Status string
+			Count  int64
+		}
+		err := r.DB.Model(&models.Image{}).
+			Select(column+" AS status, COUNT(*) AS count").
+			Where(column+" IN ?", []string{database.StatusError, database.StatusPending}).
+			Group(column).
+			Scan(&rows).Error
+		if err != nil {
+			return stats, fmt.Errorf("failed to count %s task states: %w", task, err)
+		}
+		stats.TaskErrors[task], stats.TaskPending[task] = 0, 0
+		for _, row := range rows {
+			if row.Status == database.StatusError {
+				stats.TaskErrors[task] = row.Count
+			} else {
+				stats.TaskPending[task] = row.Count
+			}
+		}
+	}
+	return stats, nil
+}
+
+// CountActiveUsers counts the users who made an authenticated request since a Unix timestamp
+func (r *StatsRepository) CountActiveUsers(since int64) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.User{}).Where("last_seen_at >= ?", time.Unix(since, 0)).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active users: %w", err)
+	}
+	return count, nil
+}
+
+// CountUploadedSince counts the files uploaded into albums since a Unix timestamp, from the
+// activity feed
+func (r *StatsRepository) CountUploadedSince(since int64) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.Activity{}).
+		Select("COALESCE(SUM(count), 0)").
+		Where("type = ? AND created_at >= ?", models.ActivityImagesUploaded, since).
+		Scan(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count uploads: %w", err)
+	}
+	return count, nil
+}
+
+// AlbumStats summarizes the files of an album for its admin page
+type AlbumStats struct {
+	Images      int64                   `json:"images"`
+	Videos      int64                   `json:"videos"`
+	Documents   int64                   `json:"documents"`
+	TotalBytes  int64                   `json:"total_bytes"`
+	TakenFrom   *int64                  `json:"taken_from,omitempty"` // Unix timestamp of the earliest capture
+	TakenTo     *int64                  `json:"taken_to,omitempty"`   // Unix timestamp of the latest capture
+	Cameras     []CameraCount           `json:"cameras"`
+	People      []PersonImageCount      `json:"people"`
+	Processing  map[string]TaskProgress `json:"processing"`   // by task
+	PercentDone float64                 `json:"percent_done"` // of the tasks the files need, across tasks
+}
+
+// CameraCount is the number of files taken with a camera
+type CameraCount struct {
+	Make  string `json:"make"`
+	Model string `json:"model"`
+	Count int64  `json:"count"`
+}
+
+// PersonImageCount is the number of files a person is tagged in
+type PersonImageCount struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Images int64  `json:"images"`
+}
+
+// TaskProgress counts the files a task is done for, out of the files that need it
+type TaskProgress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// AlbumStats summarizes the files anywhere below folderPath. files flagged or confirmed as
+// NSFW are left out with excludeNSFW, and hidden people without includeHiddenPeople.
+func (r *StatsRepository) AlbumStats(folderPath string, excludeNSFW, includeHiddenPeople bool) (AlbumStats, error) {
+	filter := ImageFilter{Subtrees: []string{folderPath}, ExcludeNSFW: excludeNSFW}
+	images := func() *gorm.DB {
+		return filter.apply(r.DB, r.DB.Model(&models.Image{}))
+	}
+	stats := AlbumStats{Cameras: []CameraCount{}, People: []PersonImageCount{}, Processing: make(map[string]TaskProgress)}
+
+	var totals struct {
+		Images    int64
+		Videos    int64
+		Documents int64
+		Bytes     int64
+		TakenFrom *int64
+		TakenTo   *int64
+	}
+	err := images().
+		Select("COUNT(CASE WHEN media_type = ? THEN 1 END) AS images, COUNT(CASE WHEN media_type = ? THEN 1 END) AS videos, "+
+			"COUNT(CASE WHEN media_type = ? THEN 1 END) AS documents, "+
+			"COALESCE(SUM(file_size), 0) AS bytes, MIN(taken_at) AS taken_from, MAX(taken_at) AS taken_to",
+			database.MediaTypeImage, database.MediaTypeVideo, database.MediaTypeDocument).
+		Scan(&totals).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count album files: %w", err)
+	}
+	stats.Images, stats.Videos, stats.Documents, stats.TotalBytes = totals.Images, totals.Videos, totals.Documents, totals.Bytes
+	stats.TakenFrom, stats.TakenTo = totals.TakenFrom, totals.TakenTo
+
+	err = images().
+		Select("COALESCE(camera_make, '') AS make, COALESCE(camera_model, '') AS model, COUNT(*) AS count").
+		Where("camera_make IS NOT NULL OR camera_model IS NOT NULL").
+		Group("make, model").
+		Order("count DESC, make, model").
+		Scan(&stats.Cameras).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count album cameras: %w", err)
+	}
+
+	people := r.DB.Table("faces").
+		Select("people.id AS id, people.primary_name AS name, COUNT(DISTINCT faces.image_path) AS images").
+		Joins("JOIN people ON people.id = faces.person_id").
+		Where("faces.image_path IN (?)", images().Select("original_path"))
+	if !includeHiddenPeople {
+		people = people.Where("people.is_hidden = ?", false)
+	}
+	err = people.Group("people.id, people.primary_name").Order("images DESC, people.primary_name").Scan(&stats.People).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count album people: %w", err)
+	}
+
+	var done, total int64
+	for task, column := range statsTaskColumns {
+		var progress TaskProgress
+		err := images().
+			Select("COUNT(CASE WHEN "+column+" = ? THEN 1 END) AS done, COUNT(CASE WHEN "+column+" <> ? THEN 1 END) AS total",
+				database.StatusDone, database.StatusNotRequired).
+			Scan(&progress).Error
+		if err != nil {
+			return stats, fmt.Errorf("failed to count album %s progress: %w", task, err)
+		}
+		stats.Processing[task] = progress
+		done += progress.Done
+		total += progress.Total
+	}
+	stats.PercentDone = 100
+	if total > 0 {
+		stats.PercentDone = float64(done) * 100 / float64(total)
+	}
+	return stats, nil
+}
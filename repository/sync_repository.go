@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// SyncRepository reads the sync log that client apps mirror the library with, see
+// database.EnsureSyncLog
+type SyncRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure SyncRepository implements SyncRepositoryInterface
+var _ SyncRepositoryInterface = (*SyncRepository)(nil)
+
+// NewSyncRepository creates a new instance of SyncRepository
+func NewSyncRepository(db *gorm.DB) *SyncRepository {
+	return &SyncRepository{DB: db}
+}
+
+// ListChanges returns up to limit changes numbered after since, oldest first
+func (r *SyncRepository) ListChanges(since int64, limit int) ([]models.SyncChange, error) {
+	var changes []models.SyncChange
+	err := r.DB.Where("seq > ? AND entity != ?", since, models.SyncEntityReset).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&changes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sync changes since %d: %w", since, err)
+	}
+	return changes, nil
+}
+
+// Bounds returns the sequence number of the latest change, and of the marker left when the
+// log was last started over, 0 if it never was. cursors below the marker are no longer valid.
+func (r *SyncRepository) Bounds() (head int64, reset int64, err error) {
+	var bounds struct {
+		Head  int64
+		Reset int64
+	}
+	err = r.DB.Model(&models.SyncChange{}).
+		Select("coalesce(max(seq), 0) AS head, coalesce(max(CASE WHEN entity = ? THEN seq END), 0) AS reset", models.SyncEntityReset).
+		Scan(&bounds).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read sync log bounds: %w", err)
+	}
+	return bounds.Head, bounds.Reset, nil
+}
+
+// ListFacesByIDs retrieves the faces with the given IDs, preloading associated Person
+func (r *SyncRepository) ListFacesByIDs(ids []uint) ([]models.Face, error) {
+	if len(ids) == 0 {
+		return []models.Face{}, nil
+	}
+	var faces []models.Face
+	if err := r.DB.Preload("Person").Where("id IN ?", ids).Find(&faces).Error; err != nil {
+		return nil, fmt.Errorf("failed to get faces by IDs: %w", err)
+	}
+	return faces, nil
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// MaxTagNameLength is the longest tag name, in characters, that is stored
+const MaxTagNameLength = 100
+
+// TagRepository handles database operations for Tag and ImageTag entities
+type TagRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure TagRepository implements TagRepositoryInterface
+var _ TagRepositoryInterface = (*TagRepository)(nil)
+
+// NewTagRepository creates a new instance of TagRepository
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{DB: db}
+}
+
+// TagCount is a tag with the number of images carrying it
+type TagCount struct {
+	models.Tag
+	ImageCount int64 `json:"image_count"`
+}
+
+// Create creates a new tag. the name is normalized first.
+func (r *TagRepository) Create(tag *models.Tag) error {
+	now := time.Now().Unix()
+	tag.SetName(tag.Name)
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+	if err := r.DB.Create(tag).Error; err != nil {
+		return fmt.Errorf("failed to create tag %s: %w", tag.Name, err)
+	}
+	return nil
+}
+
+// GetByID retrieves a tag by its ID
+func (r *TagRepository) GetByID(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.DB.First(&tag, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get tag by ID %d: %w", id, err)
+	}
+	return &tag, nil
+}
+
+// ListByNames retrieves the tags with any of the given names, case-insensitively
+func (r *TagRepository) ListByNames(names []string) ([]models.Tag, error) {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = strings.ToLower(models.NormalizeTagName(name))
+	}
+	var tags []models.Tag
+	if err := r.DB.Where("name_key IN ?", keys).Order("name_key ASC").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tags by name: %w", err)
+	}
+	return tags, nil
+}
+
+// ListWithCounts retrieves every tag with the number of (not deleted) images carrying it,
+// ordered by name
+func (r *TagRepository) ListWithCounts() ([]TagCount, error) {
+	var tags []TagCount
+	err := r.DB.Model(&models.Tag{}).
+		Select("tags.*, COUNT(images.original_path) AS image_count").
+		Joins("LEFT JOIN image_tags ON image_tags.tag_id = tags.id").
+		Joins("LEFT JOIN images ON images.original_path = image_tags.image_path AND images.deleted_at IS NULL").
+		Group("tags.id").
+		Order("tags.name_key ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// ListByImagePath retrieves the tags of an image, ordered by name
+func (r *TagRepository) ListByImagePath(imagePath string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.DB.Model(&models.Tag{}).
+		Joins("JOIN image_tags ON image_tags.tag_id = tags.id").
+		Where("image_tags.image_path = ?", filepath.ToSlash(imagePath)).
+		Order("tags.name_key ASC").
+		Find(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", imagePath, err)
+	}
+	return tags, nil
+}
+
+// Rename changes the name of a tag. the name is normalized first.
+func (r *TagRepository) Rename(id uint, name string) (*models.Tag, error) {
+	var tag models.Tag
+	tag.SetName(name)
+	result := r.DB.Model(&models.Tag{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":       tag.Name,
+		"name_key":   tag.NameKey,
+		"updated_at": time.Now().Unix(),
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to rename tag ID %d: %w", id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.GetByID(id)
+}
+
+// Delete removes a tag and takes it off every image
+func (r *TagRepository) Delete(id uint) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(&models.ImageTag{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Tag{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete tag ID %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetOrCreateByNames returns the tags with the given names, creating the missing ones. names
+// are normalized and matched case-insensitively; empty and overlong names are skipped.
+func (r *TagRepository) GetOrCreateByNames(names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tags, err = ensureTags(tx, names)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tags: %w", err)
+	}
+	return tags, nil
+}
+
+// AddToImages tags the images at the given paths. paths without a (not deleted) image record
+// are skipped. a tag the image already has from its metadata becomes a user tag, so that it
+// is kept when the metadata is extracted again. returns the number of image tags written.
+func (r *TagRepository) AddToImages(tagIDs []uint, imagePaths []string) (int64, error) {
+	if len(tagIDs) == 0 || len(imagePaths) == 0 {
+		return 0, nil
+	}
+	cleanPaths := make([]string, len(imagePaths))
+	for i, p := range imagePaths {
+		cleanPaths[i] = filepath.ToSlash(p)
+	}
+	now := time.Now().Unix()
+
+	var affected int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, tagID := range tagIDs {
+			result := tx.Exec("INSERT INTO image_tags (image_path, tag_id, source, created_at) "+
+				"SELECT original_path, ?, ?, ? FROM images WHERE original_path IN ? AND deleted_at IS NULL "+
+				"ON CONFLICT (image_path, tag_id) DO UPDATE SET source = excluded.source",
+				tagID, models.TagSourceUser, now, cleanPaths)
+			if result.Error != nil {
+				return result.Error
+			}
+			affected += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to tag images: %w", err)
+	}
+	return affected, nil
+}
+
+// RemoveFromImages takes tags off the images at the given paths, wherever the tags came from.
+// returns the number of image tags removed.
+func (r *TagRepository) RemoveFromImages(tagIDs []uint, imagePaths []string) (int64, error) {
+	if len(tagIDs) == 0 || len(imagePaths) == 0 {
+		return 0, nil
+	}
+	cleanPaths := make([]string, len(imagePaths))
+	for i, p := range imagePaths {
+		cleanPaths[i] = filepath.ToSlash(p)
+	}
+	result := r.DB.Where("tag_id IN ? AND image_path IN ?", tagIDs, cleanPaths).Delete(&models.ImageTag{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to untag images: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ensureTags returns the tags with the given names within a transaction, creating the missing ones
+func ensureTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	now := time.Now().Unix()
+	seen := make(map[string]bool, len(names))
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		var tag models.Tag
+		tag.SetName(name)
+		if tag.Name == "" || utf8.RuneCountInString(tag.Name) > MaxTagNameLength || seen[tag.NameKey] {
+			continue
+		}
+		seen[tag.NameKey] = true
+		tag.CreatedAt = now
+		tag.UpdatedAt = now
+		if err := tx.Where(models.Tag{NameKey: tag.NameKey}).Attrs(tag).FirstOrCreate(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to ensure tag %s: %w", tag.Name, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// replaceMetadataTags makes the metadata tags of an image the given keywords within a
+// transaction. tags added by users are left alone.
+func replaceMetadataTags(tx *gorm.DB, imagePath string, keywords []string) error {
+	tags, err := ensureTags(tx, keywords)
+	if err != nil {
+		return err
+	}
+	tagIDs := make([]uint, len(tags))
+	for i, tag := range tags {
+		tagIDs[i] = tag.ID
+	}
+
+	stale := tx.Where("image_path = ? AND source = ?", imagePath, models.TagSourceMetadata)
+	if len(tagIDs) > 0 {
+		stale = stale.Where("tag_id NOT IN ?", tagIDs)
+	}
+	if err := stale.Delete(&models.ImageTag{}).Error; err != nil {
+		return fmt.Errorf("failed to remove old metadata tags of %s: %w", imagePath, err)
+	}
+
+	now := time.Now().Unix()
+	for _, tagID := range tagIDs {
+		err := tx.Exec("INSERT INTO image_tags (image_path, tag_id, source, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			imagePath, tagID, models.TagSourceMetadata, now).Error
+		if err != nil {
+			return fmt.Errorf("failed to add metadata tags of %s: %w", imagePath, err)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/camden-git/mediasysbackend/models"
 	"gorm.io/gorm"
@@ -60,10 +62,33 @@ func (r *GormUserRepository) GetByUsername(username string) (*models.User, error
 	return &user, nil
 }
 
+// GetByEmail retrieves a user by email address, which is matched case-insensitively
+func (r *GormUserRepository) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Select("id").Where("email = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return r.GetByID(user.ID)
+}
+
+// GetByPersonID returns the user linked to a person
+func (r *GormUserRepository) GetByPersonID(personID uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.Select("id").Where("person_id = ?", personID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return r.GetByID(user.ID)
+}
+
 func (r *GormUserRepository) Update(user *models.User) error {
 	return r.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(user).Error
 }
 
+// TouchLastSeen records when a user last made an authenticated request without bumping updated_at
+func (r *GormUserRepository) TouchLastSeen(id uint, seenAt time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).UpdateColumn("last_seen_at", seenAt).Error
+}
+
 func (r *GormUserRepository) Delete(id uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("user_id = ?", id).Delete(&models.UserAlbumPermission{}).Error; err != nil {
@@ -72,6 +97,11 @@ func (r *GormUserRepository) Delete(id uint) error {
 		if err := tx.Where("user_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
 			return err
 		}
+		for _, model := range []interface{}{&models.NotificationPreference{}, &models.ZipWatcher{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
 		return tx.Delete(&models.User{}, id).Error
 	})
 }
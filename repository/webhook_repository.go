@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// WebhookRepository handles database operations for Webhook and WebhookDelivery entities
+type WebhookRepository struct {
+	DB *gorm.DB
+}
+
+// Ensure WebhookRepository implements WebhookRepositoryInterface
+var _ WebhookRepositoryInterface = (*WebhookRepository)(nil)
+
+// NewWebhookRepository creates a new instance of WebhookRepository
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{DB: db}
+}
+
+// Create adds a new webhook
+func (r *WebhookRepository) Create(webhook *models.Webhook) error {
+	now := time.Now().Unix()
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	if err := r.DB.Create(webhook).Error; err != nil {
+		return fmt.Errorf("failed to create webhook for %s: %w", webhook.URL, err)
+	}
+	return nil
+}
+
+// GetByID retrieves a webhook by its ID
+func (r *WebhookRepository) GetByID(id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := r.DB.First(&webhook, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get webhook %d: %w", id, err)
+	}
+	return &webhook, nil
+}
+
+// List retrieves every webhook, oldest first
+func (r *WebhookRepository) List() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := r.DB.Order("id ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// ListActiveForEvent retrieves the active webhooks subscribed to an event
+func (r *WebhookRepository) ListActiveForEvent(event string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := r.DB.Where("is_active = ?", true).Order("id ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhooks for %s: %w", event, err)
+	}
+	// events are stored as a JSON list, so they are matched here rather than in SQL
+	subscribed := webhooks[:0]
+	for _, webhook := range webhooks {
+		if webhook.Subscribes(event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	return subscribed, nil
+}
+
+// Update saves every field of a webhook
+func (r *WebhookRepository) Update(webhook *models.Webhook) error {
+	webhook.UpdatedAt = time.Now().Unix()
+	if err := r.DB.Save(webhook).Error; err != nil {
+		return fmt.Errorf("failed to update webhook %d: %w", webhook.ID, err)
+	}
+	return nil
+}
+
+// Delete removes a webhook together with its delivery log
+func (r *WebhookRepository) Delete(id uint) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Webhook{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+// CreateDelivery records a delivery, timestamped now unless CreatedAt is set
+func (r *WebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	if delivery.CreatedAt == 0 {
+		delivery.CreatedAt = time.Now().Unix()
+	}
+	if delivery.Status == "" {
+		delivery.Status = models.WebhookDeliveryPending
+	}
+	if err := r.DB.Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to record %s delivery for webhook %d: %w", delivery.Event, delivery.WebhookID, err)
+	}
+	return nil
+}
+
+// GetDelivery retrieves a delivery by its ID
+func (r *WebhookRepository) GetDelivery(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := r.DB.First(&delivery, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery %d: %w", id, err)
+	}
+	return &delivery, nil
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	if err := r.DB.Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed to update webhook delivery %d: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// ListDeliveries returns a page of the delivery log of a webhook, newest first, together
+// with the total number of deliveries
+func (r *WebhookRepository) ListDeliveries(webhookID uint, offset, limit int) ([]models.WebhookDelivery, int64, error) {
+	var total int64
+	if err := r.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count deliveries of webhook %d: %w", webhookID, err)
+	}
+
+	query := r.DB.Where("webhook_id = ?", webhookID).Order("created_at DESC").Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var deliveries []models.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list deliveries of webhook %d: %w", webhookID, err)
+	}
+	return deliveries, total, nil
+}
+
+// ListPendingDeliveries retrieves every delivery still waiting for an attempt, oldest first
+func (r *WebhookRepository) ListPendingDeliveries() ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	if err := r.DB.Where("status = ?", models.WebhookDeliveryPending).Order("id ASC").Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,482 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/workers"
+	"gorm.io/gorm"
+)
+
+const (
+	// BackupFormat identifies the manifest of a backup
+	BackupFormat = "mediasys-backup"
+	// BackupVersion is bumped whenever the layout of a backup changes incompatibly
+	BackupVersion = 1
+
+	backupManifestName = "manifest.json"
+	backupDatabaseName = "database.sqlite"
+	backupSettingsName = "settings.json"
+
+	// how long a backup or restore waits for the jobs being processed to finish
+	backupDrainTimeout = time.Minute
+)
+
+var (
+	ErrBackupNotFound   = errors.New("backup not found")
+	ErrBackupInvalid    = errors.New("not a valid backup")
+	ErrBackupInProgress = errors.New("a backup or restore is already running")
+)
+
+// backup file names, e.g. mediasys-backup-20240131-120000.zip or
+// mediasys-backup-20240131-120000-pre-restore.zip
+var backupNamePattern = regexp.MustCompile(`^mediasys-backup-[0-9]{8}-[0-9]{6}(-[a-z0-9-]+)?\.zip$`)
+
+// BackupManifest is the manifest.json of a backup
+type BackupManifest struct {
+	Format       string `json:"format"`
+	Version      int    `json:"version"`
+	CreatedAt    int64  `json:"created_at"`
+	Label        string `json:"label,omitempty"` // e.g. "pre-restore" for the backups taken before a restore
+	DatabaseSize int64  `json:"database_size"`
+}
+
+// BackupInfo describes a backup file in the backup folder
+type BackupInfo struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// BackupService writes backups of the database and its runtime settings and restores them.
+// a backup is a zip holding a snapshot of the SQLite database, the runtime settings as
+// readable JSON, and a manifest. while a backup or restore runs the image processor and
+// the scheduler are paused, and while a restore runs the server reports maintenance mode.
+type BackupService struct {
+	db        *gorm.DB
+	settings  *SettingsService
+	processor *workers.ImageProcessor // nil when there are no workers to pause, e.g. in the CLI
+	scheduler *workers.Scheduler      // nil like processor
+	dir       string
+	keep      int
+
+	mu        sync.Mutex // held by the running backup or restore
+	restoring atomic.Bool
+}
+
+func NewBackupService(db *gorm.DB, settings *SettingsService, processor *workers.ImageProcessor, scheduler *workers.Scheduler, cfg config.Config) *BackupService {
+	return &BackupService{
+		db:        db,
+		settings:  settings,
+		processor: processor,
+		scheduler: scheduler,
+		dir:       cfg.BackupPath,
+		keep:      cfg.BackupKeep,
+	}
+}
+
+// Restoring reports whether a restore is running, so requests that change data can be
+// refused in the meantime
+func (s *BackupService) Restoring() bool {
+	return s.restoring.Load()
+}
+
+// List returns the backups in the backup folder, newest first
+func (s *BackupService) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: entry.Name(), Size: info.Size(), CreatedAt: info.ModTime().Unix()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Path returns the path of a backup in the backup folder, or ErrBackupNotFound
+func (s *BackupService) Path(name string) (string, error) {
+	if !backupNamePattern.MatchString(name) {
+		return "", ErrBackupNotFound
+	}
+	fullPath := filepath.Join(s.dir, name)
+	if info, err := os.Stat(fullPath); err != nil || !info.Mode().IsRegular() {
+		return "", ErrBackupNotFound
+	}
+	return fullPath, nil
+}
+
+// Delete removes a backup from the backup folder
+func (s *BackupService) Delete(name string) error {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", name, err)
+	}
+	return nil
+}
+
+// Create writes a new backup to the backup folder and removes the oldest beyond the number
+// kept
+func (s *BackupService) Create() (BackupInfo, error) {
+	if !s.mu.TryLock() {
+		return BackupInfo{}, ErrBackupInProgress
+	}
+	defer s.mu.Unlock()
+	s.pauseWorkers()
+	defer s.resumeWorkers()
+
+	info, err := s.createLocked("")
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	s.prune()
+	return info, nil
+}
+
+// createLocked writes a backup named after the current time and label
+func (s *BackupService) createLocked(label string) (BackupInfo, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create backup folder %s: %w", s.dir, err)
+	}
+	now := time.Now()
+	name := "mediasys-backup-" + now.UTC().Format("20060102-150405")
+	if label != "" {
+		name += "-" + label
+	}
+	name += ".zip"
+
+	snapshot, err := os.CreateTemp(s.dir, ".snapshot-*.sqlite")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	snapshotPath := snapshot.Name()
+	snapshot.Close()
+	os.Remove(snapshotPath) // VACUUM INTO needs a path that doesn't exist
+	defer os.Remove(snapshotPath)
+	if err := database.SnapshotDatabase(s.db, snapshotPath); err != nil {
+		return BackupInfo{}, err
+	}
+	snapshotInfo, err := os.Stat(snapshotPath)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	manifest := BackupManifest{
+		Format:       BackupFormat,
+		Version:      BackupVersion,
+		CreatedAt:    now.Unix(),
+		Label:        label,
+		DatabaseSize: snapshotInfo.Size(),
+	}
+	var settings []SettingValue
+	if s.settings != nil {
+		settings = s.settings.List()
+	}
+
+	fullPath := filepath.Join(s.dir, name)
+	partial := fullPath + ".partial"
+	if err := writeBackup(partial, manifest, snapshotPath, settings); err != nil {
+		os.Remove(partial)
+		return BackupInfo{}, err
+	}
+	if err := os.Rename(partial, fullPath); err != nil {
+		os.Remove(partial)
+		return BackupInfo{}, fmt.Errorf("failed to save backup %s: %w", name, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+	log.Printf("Backup: Wrote %s (%d bytes)", fullPath, info.Size())
+	return BackupInfo{Name: name, Size: info.Size(), CreatedAt: now.Unix()}, nil
+}
+
+// writeBackup writes the zip of a backup to path
+func writeBackup(path string, manifest BackupManifest, snapshotPath string, settings []SettingValue) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer file.Close()
+	zipWriter := zip.NewWriter(file)
+
+	writeJSONEntry := func(name string, value interface{}) error {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	if err := writeJSONEntry(backupManifestName, manifest); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if err := writeJSONEntry(backupSettingsName, settings); err != nil {
+		return fmt.Errorf("failed to write backup settings: %w", err)
+	}
+
+	snapshot, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer snapshot.Close()
+	entry, err := zipWriter.Create(backupDatabaseName)
+	if err != nil {
+		return fmt.Errorf("failed to write backup database: %w", err)
+	}
+	if _, err := io.Copy(entry, snapshot); err != nil {
+		return fmt.Errorf("failed to write backup database: %w", err)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return file.Close()
+}
+
+// Save stores an uploaded backup in the backup folder, so it can be restored, after
+// checking it is one
+func (s *BackupService) Save(r io.Reader) (BackupInfo, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create backup folder %s: %w", s.dir, err)
+	}
+	file, err := os.CreateTemp(s.dir, ".upload-*.zip")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return BackupInfo{}, fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to store upload: %w", err)
+	}
+	manifest, err := readBackupManifest(file.Name())
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	name := "mediasys-backup-" + time.Unix(manifest.CreatedAt, 0).UTC().Format("20060102-150405") + "-uploaded.zip"
+	fullPath := filepath.Join(s.dir, name)
+	if _, err := os.Stat(fullPath); err == nil {
+		return BackupInfo{}, fmt.Errorf("%w: %s was uploaded before", ErrBackupInvalid, name)
+	}
+	if err := os.Rename(file.Name(), fullPath); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to store upload: %w", err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+	return BackupInfo{Name: name, Size: info.Size(), CreatedAt: manifest.CreatedAt}, nil
+}
+
+// readBackupManifest reads and checks the manifest of a backup file
+func readBackupManifest(path string) (BackupManifest, error) {
+	var manifest BackupManifest
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+	defer archive.Close()
+	entry, err := archive.Open(backupManifestName)
+	if err != nil {
+		return manifest, fmt.Errorf("%w: it has no %s", ErrBackupInvalid, backupManifestName)
+	}
+	defer entry.Close()
+	if err := json.NewDecoder(entry).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("%w: unreadable %s: %v", ErrBackupInvalid, backupManifestName, err)
+	}
+	if manifest.Format != BackupFormat {
+		return manifest, fmt.Errorf("%w: unknown format %q", ErrBackupInvalid, manifest.Format)
+	}
+	if manifest.Version > BackupVersion {
+		return manifest, fmt.Errorf("%w: written by a newer version (format version %d)", ErrBackupInvalid, manifest.Version)
+	}
+	if _, err := archive.Open(backupDatabaseName); err != nil {
+		return manifest, fmt.Errorf("%w: it has no %s", ErrBackupInvalid, backupDatabaseName)
+	}
+	return manifest, nil
+}
+
+// Restore replaces the database with the one in a backup file. the backup is checked
+// before anything changes, and the current database is backed up first, labelled
+// pre-restore. the restored schema is migrated, the search index rebuilt and the runtime
+// settings reloaded. generated assets and originals are not part of backups and are left
+// as they are; the next library rescan reconciles them with the restored records.
+func (s *BackupService) Restore(path string) (BackupManifest, error) {
+	if !s.mu.TryLock() {
+		return BackupManifest{}, ErrBackupInProgress
+	}
+	defer s.mu.Unlock()
+
+	manifest, err := readBackupManifest(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return manifest, fmt.Errorf("failed to create backup folder %s: %w", s.dir, err)
+	}
+	extracted, err := extractBackupDatabase(path, s.dir)
+	if err != nil {
+		return manifest, err
+	}
+	defer os.Remove(extracted)
+	if err := database.CheckDatabaseFile(extracted); err != nil {
+		return manifest, fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+
+	s.restoring.Store(true)
+	defer s.restoring.Store(false)
+	s.pauseWorkers()
+	defer s.resumeWorkers()
+
+	if _, err := s.createLocked("pre-restore"); err != nil {
+		return manifest, fmt.Errorf("failed to back up the current database before restoring: %w", err)
+	}
+	syncHead, err := database.SyncLogHead(s.db)
+	if err != nil {
+		return manifest, err
+	}
+	log.Printf("Backup: Restoring the database from %s", path)
+	if err := database.RestoreDatabase(s.db, extracted); err != nil {
+		return manifest, err
+	}
+	if err := database.AutoMigrateModels(s.db); err != nil {
+		return manifest, fmt.Errorf("restored, but failed to migrate the restored database: %w", err)
+	}
+	// client apps mirror the library through the sync log, which no longer matches it
+	if err := database.ResetSyncLog(s.db, syncHead); err != nil {
+		log.Printf("Backup: Failed to reset the sync log after the restore: %v", err)
+	}
+	// rowids of the images change when the snapshot is written, so the index is rebuilt
+	if err := database.EnsureSearchIndex(s.db); err == nil {
+		if err := database.RebuildSearchIndex(s.db); err != nil {
+			log.Printf("Backup: Failed to rebuild the search index after the restore: %v", err)
+		}
+	} else if !errors.Is(err, database.ErrFTS5Unavailable) {
+		log.Printf("Backup: Failed to create the search index after the restore: %v", err)
+	}
+	if s.settings != nil {
+		if err := s.settings.Reload(); err != nil {
+			log.Printf("Backup: Failed to reload the runtime settings after the restore: %v", err)
+		}
+	}
+	s.prune()
+	log.Printf("Backup: Restored the database from %s, taken %s", filepath.Base(path), time.Unix(manifest.CreatedAt, 0).Format(time.RFC3339))
+	return manifest, nil
+}
+
+// extractBackupDatabase copies the database of a backup file into a temporary file in dir
+func extractBackupDatabase(path, dir string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+	defer archive.Close()
+	entry, err := archive.Open(backupDatabaseName)
+	if err != nil {
+		return "", fmt.Errorf("%w: it has no %s", ErrBackupInvalid, backupDatabaseName)
+	}
+	defer entry.Close()
+
+	file, err := os.CreateTemp(dir, ".restore-*.sqlite")
+	if err != nil {
+		return "", fmt.Errorf("failed to extract the backup database: %w", err)
+	}
+	if _, err := io.Copy(file, entry); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("%w: failed to extract %s: %v", ErrBackupInvalid, backupDatabaseName, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to extract the backup database: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// prune removes the oldest backups beyond the number kept
+func (s *BackupService) prune() {
+	if s.keep <= 0 {
+		return
+	}
+	backups, err := s.List()
+	if err != nil {
+		log.Printf("Backup: Failed to list backups to prune: %v", err)
+		return
+	}
+	for _, backup := range backups[min(s.keep, len(backups)):] {
+		if err := os.Remove(filepath.Join(s.dir, backup.Name)); err != nil {
+			log.Printf("Backup: Failed to remove old backup %s: %v", backup.Name, err)
+		} else {
+			log.Printf("Backup: Removed old backup %s", backup.Name)
+		}
+	}
+}
+
+// pauseWorkers holds the scheduler and job processing, and waits a while for the jobs
+// being processed to finish, so the database stays still
+func (s *BackupService) pauseWorkers() {
+	if s.scheduler != nil {
+		s.scheduler.SetPaused(true)
+	}
+	if s.processor == nil {
+		return
+	}
+	s.processor.SetPaused(true)
+	deadline := time.Now().Add(backupDrainTimeout)
+	for s.processor.QueueStats().States[workers.JobStateProcessing] > 0 {
+		if time.Now().After(deadline) {
+			log.Printf("Backup: Jobs are still being processed after %s, going ahead", backupDrainTimeout)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// resumeWorkers lifts the pause, unless the server is in maintenance mode, which holds
+// background processing too
+func (s *BackupService) resumeWorkers() {
+	paused := s.settings != nil && s.settings.String(SettingServiceMode) == config.ServiceModeMaintenance
+	if s.scheduler != nil {
+		s.scheduler.SetPaused(paused)
+	}
+	if s.processor != nil {
+		s.processor.SetPaused(paused)
+	}
+}
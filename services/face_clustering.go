@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// chinese whispers settles within a few passes; the cap only guards against oscillation
+const faceClusteringMaxIterations = 20
+
+// ClusterUntaggedFaces groups the untagged faces that have an embedding into clusters of
+// likely the same person and stores them, so a whole cluster can be tagged at once. faces
+// count as connected when their similarity reaches the similarity threshold; faces without
+// a similar face are left unclustered. returns the number of clusters found.
+func (s *FaceRecognitionService) ClusterUntaggedFaces() (int, error) {
+	embeddings, err := s.embeddingRepo.GetUntaggedEmbeddings()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get untagged embeddings: %w", err)
+	}
+
+	var faceIDs []uint
+	var vectors [][]float32
+	for _, embedding := range embeddings {
+		if vector := embedding.GetEmbedding(); vector != nil {
+			faceIDs = append(faceIDs, embedding.FaceID)
+			vectors = append(vectors, vector)
+		}
+	}
+
+	labels := clusterEmbeddings(vectors, s.GetSimilarityThreshold())
+	members := make(map[int][]uint)
+	for i, label := range labels {
+		members[label] = append(members[label], faceIDs[i])
+	}
+	var clusters [][]uint
+	for _, ids := range members {
+		if len(ids) > 1 {
+			clusters = append(clusters, ids)
+		}
+	}
+	// largest first, so cluster 1 is the person appearing most often
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+
+	if err := s.faceRepo.ReplaceClusters(clusters); err != nil {
+		return 0, err
+	}
+	log.Printf("Face clustering: Grouped %d untagged face(s) into %d cluster(s)", len(faceIDs), len(clusters))
+	return len(clusters), nil
+}
+
+// clusterEmbeddings labels embeddings with the chinese whispers algorithm: faces are linked
+// when their cosine similarity is at least threshold, every face starts in its own cluster
+// and then repeatedly joins the cluster its links are most strongly tied to. returns the
+// cluster label of each embedding.
+func clusterEmbeddings(vectors [][]float32, threshold float32) []int {
+	type link struct {
+		to     int
+		weight float32
+	}
+
+	normalized := make([][]float32, len(vectors))
+	for i, vector := range vectors {
+		normalized[i] = normalizeEmbedding(vector)
+	}
+	links := make([][]link, len(vectors))
+	for i := range normalized {
+		for j := i + 1; j < len(normalized); j++ {
+			if len(normalized[i]) != len(normalized[j]) {
+				continue
+			}
+			var similarity float32
+			for k := range normalized[i] {
+				similarity += normalized[i][k] * normalized[j][k]
+			}
+			if similarity >= threshold {
+				links[i] = append(links[i], link{to: j, weight: similarity})
+				links[j] = append(links[j], link{to: i, weight: similarity})
+			}
+		}
+	}
+
+	labels := make([]int, len(vectors))
+	for i := range labels {
+		labels[i] = i
+	}
+	// a fixed seed keeps runs over the same faces stable
+	rng := rand.New(rand.NewSource(1))
+	for iteration := 0; iteration < faceClusteringMaxIterations; iteration++ {
+		changed := false
+		for _, i := range rng.Perm(len(vectors)) {
+			if len(links[i]) == 0 {
+				continue
+			}
+			weights := make(map[int]float32)
+			for _, l := range links[i] {
+				weights[labels[l.to]] += l.weight
+			}
+			best, bestWeight := labels[i], weights[labels[i]]
+			for label, weight := range weights {
+				if weight > bestWeight || (weight == bestWeight && label < best) {
+					best, bestWeight = label, weight
+				}
+			}
+			if best != labels[i] {
+				labels[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return labels
+}
+
+// normalizeEmbedding scales an embedding to unit length, so dot products are cosine similarities
+func normalizeEmbedding(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	normalized := make([]float32, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i, v := range vector {
+		normalized[i] = v * scale
+	}
+	return normalized
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sync"
 
 	"github.com/camden-git/mediasysbackend/repository"
 )
@@ -13,7 +14,9 @@ type FaceRecognitionService struct {
 	faceRepo            repository.FaceRepositoryInterface
 	personRepo          repository.PersonRepositoryInterface
 	embeddingRepo       *repository.FaceEmbeddingRepository
+	suggestionRepo      repository.FaceSuggestionRepositoryInterface // suggestions are only persisted when set
 	similarityThreshold float32
+	thresholdMu         sync.RWMutex // the threshold can be changed at runtime from the settings API
 }
 
 // NewFaceRecognitionService creates a new face recognition service
@@ -21,24 +24,29 @@ func NewFaceRecognitionService(
 	faceRepo repository.FaceRepositoryInterface,
 	personRepo repository.PersonRepositoryInterface,
 	embeddingRepo *repository.FaceEmbeddingRepository,
+	suggestionRepo repository.FaceSuggestionRepositoryInterface,
 	similarityThreshold float32,
 ) *FaceRecognitionService {
 	return &FaceRecognitionService{
 		faceRepo:            faceRepo,
 		personRepo:          personRepo,
 		embeddingRepo:       embeddingRepo,
+		suggestionRepo:      suggestionRepo,
 		similarityThreshold: similarityThreshold,
 	}
 }
 
 // SimilarFaceResult represents a similar face found during recognition
 type SimilarFaceResult struct {
-	FaceID         uint    `json:"face_id"`
-	PersonID       *uint   `json:"person_id,omitempty"`
-	PersonName     *string `json:"person_name,omitempty"`
-	ImagePath      string  `json:"image_path"`
-	Similarity     float32 `json:"similarity"`
-	X1, Y1, X2, Y2 int     `json:"x1, y1, x2, y2"`
+	FaceID     uint    `json:"face_id"`
+	PersonID   *uint   `json:"person_id,omitempty"`
+	PersonName *string `json:"person_name,omitempty"`
+	ImagePath  string  `json:"image_path"`
+	Similarity float32 `json:"similarity"`
+	X1         int     `json:"x1"`
+	Y1         int     `json:"y1"`
+	X2         int     `json:"x2"`
+	Y2         int     `json:"y2"`
 }
 
 // FindSimilarFaces finds faces similar to a given face ID
@@ -54,6 +62,18 @@ func (s *FaceRecognitionService) FindSimilarFaces(faceID uint, limit int) ([]Sim
 		return nil, fmt.Errorf("target face has no valid embedding")
 	}
 
+	return s.findSimilarToEmbedding(targetVector, faceID, limit)
+}
+
+// FindSimilarToEmbedding finds the faces similar to a face embedding that is not in the
+// database, such as one from an example photo
+func (s *FaceRecognitionService) FindSimilarToEmbedding(targetVector []float32, limit int) ([]SimilarFaceResult, error) {
+	return s.findSimilarToEmbedding(targetVector, 0, limit)
+}
+
+// findSimilarToEmbedding finds the faces similar to an embedding, leaving out the face it
+// belongs to, 0 when it is not a stored face
+func (s *FaceRecognitionService) findSimilarToEmbedding(targetVector []float32, faceID uint, limit int) ([]SimilarFaceResult, error) {
 	// Find similar embeddings (without threshold filtering, we'll do that in the service)
 	similarEmbeddings, err := s.embeddingRepo.FindSimilarFaces(targetVector, 0.0, limit*2) // Get more candidates
 	if err != nil {
@@ -61,6 +81,7 @@ func (s *FaceRecognitionService) FindSimilarFaces(faceID uint, limit int) ([]Sim
 	}
 
 	// Convert to results and apply threshold filtering
+	threshold := s.GetSimilarityThreshold()
 	var results []SimilarFaceResult
 	for _, embedding := range similarEmbeddings {
 		if embedding.FaceID == faceID {
@@ -76,7 +97,7 @@ func (s *FaceRecognitionService) FindSimilarFaces(faceID uint, limit int) ([]Sim
 		similarity := s.CalculateSimilarity(targetVector, embeddingVector)
 
 		// Apply threshold filtering
-		if similarity < s.similarityThreshold {
+		if similarity < threshold {
 			continue
 		}
 
@@ -160,7 +181,33 @@ func (s *FaceRecognitionService) SuggestPersonForFace(faceID uint) (*uint, *stri
 	return bestPersonID, bestPersonName, bestSimilarity, nil
 }
 
-// TagFaceWithPerson tags a face with a person and updates related faces
+// EnforceRecognitionOptOut purges the face embeddings and pending suggestions of a person who
+// opted out of face recognition, and does nothing for anyone else. it is called when a person
+// opts out and whenever a face is tagged, so faces tagged later are purged too. reports
+// whether the person opted out.
+func (s *FaceRecognitionService) EnforceRecognitionOptOut(personID uint) (bool, error) {
+	optedOut, err := s.personRepo.IsRecognitionOptedOut(personID)
+	if err != nil || !optedOut {
+		return false, err
+	}
+	purged, err := s.embeddingRepo.PurgeByPersonID(personID)
+	if err != nil {
+		return true, err
+	}
+	var removed int64
+	if s.suggestionRepo != nil {
+		if removed, err = s.suggestionRepo.DeletePendingByPersonID(personID); err != nil {
+			return true, err
+		}
+	}
+	if purged > 0 || removed > 0 {
+		log.Printf("Face recognition: Purged %d embedding(s) and %d pending suggestion(s) of opted out person %d", purged, removed, personID)
+	}
+	return true, nil
+}
+
+// TagFaceWithPerson tags a face with a person and updates related faces. faces of people who
+// opted out of face recognition are only tagged.
 func (s *FaceRecognitionService) TagFaceWithPerson(faceID uint, personID uint) error {
 	// Tag the target face
 	err := s.faceRepo.TagFace(faceID, personID)
@@ -168,6 +215,16 @@ func (s *FaceRecognitionService) TagFaceWithPerson(faceID uint, personID uint) e
 		return fmt.Errorf("failed to tag face %d with person %d: %w", faceID, personID, err)
 	}
 
+	// when in doubt the similar faces are left alone
+	optedOut, err := s.EnforceRecognitionOptOut(personID)
+	if err != nil {
+		log.Printf("Warning: Failed to enforce recognition opt-out of person %d, skipping auto-tagging: %v", personID, err)
+		return nil
+	}
+	if optedOut {
+		return nil
+	}
+
 	// Find similar faces and suggest tagging them too
 	similarFaces, err := s.FindSimilarFaces(faceID, 20)
 	if err != nil {
@@ -190,49 +247,53 @@ func (s *FaceRecognitionService) TagFaceWithPerson(faceID uint, personID uint) e
 	return nil
 }
 
-// GetUntaggedFacesWithSuggestions returns untagged faces with person suggestions
+// GetUntaggedFacesWithSuggestions returns untagged faces with person suggestions. the
+// suggestions are stored as pending, so they can be accepted or rejected by their ID.
 func (s *FaceRecognitionService) GetUntaggedFacesWithSuggestions(limit int) ([]map[string]interface{}, error) {
 	// Get untagged embeddings
 	untaggedEmbeddings, err := s.embeddingRepo.GetUntaggedEmbeddings()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get untagged embeddings: %w", err)
 	}
+	suggester, err := s.newFaceSuggester(untaggedEmbeddings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load faces for suggestions: %w", err)
+	}
 
 	var results []map[string]interface{}
 	for i, embedding := range untaggedEmbeddings {
 		if i >= limit {
 			break
 		}
-
-		// Get similar faces for this untagged face
-		similarFaces, err := s.FindSimilarFaces(embedding.FaceID, 5)
-		if err != nil {
-			log.Printf("Warning: Failed to find similar faces for face %d: %v", embedding.FaceID, err)
+		vector := embedding.GetEmbedding()
+		if vector == nil {
 			continue
 		}
 
-		// Count person suggestions
-		personSuggestions := make(map[uint]int)
-		for _, similarFace := range similarFaces {
-			if similarFace.PersonID != nil {
-				personSuggestions[*similarFace.PersonID]++
+		suggestion, similarFaces := suggester.suggest(embedding.FaceID, vector)
+		if s.suggestionRepo != nil {
+			if err := s.suggestionRepo.ReplacePending(embedding.FaceID, suggestion); err != nil {
+				log.Printf("Warning: Failed to store suggestion for face %d: %v", embedding.FaceID, err)
 			}
 		}
 
-		// Find most suggested person
+		var suggestionID *uint
 		var suggestedPersonID *uint
 		var suggestedPersonName *string
+		var confidence float32
 		maxSuggestions := 0
-		for personID, count := range personSuggestions {
-			if count > maxSuggestions {
-				maxSuggestions = count
-				suggestedPersonID = &personID
-
-				// Get person name
-				person, err := s.personRepo.GetByID(personID)
-				if err == nil {
-					suggestedPersonName = &person.PrimaryName
-				}
+		if suggestion != nil {
+			if suggestion.ID != 0 {
+				suggestionID = &suggestion.ID
+			}
+			suggestedPersonID = &suggestion.PersonID
+			confidence = suggestion.Confidence
+			maxSuggestions = suggestion.Votes
+
+			// Get person name
+			person, err := s.personRepo.GetByID(suggestion.PersonID)
+			if err == nil {
+				suggestedPersonName = &person.PrimaryName
 			}
 		}
 
@@ -245,10 +306,12 @@ func (s *FaceRecognitionService) GetUntaggedFacesWithSuggestions(limit int) ([]m
 			"y2":                    embedding.Face.Y2,
 			"detection_confidence":  embedding.Face.DetectionConfidence,
 			"quality_score":         embedding.Face.QualityScore,
-			"similar_faces_count":   len(similarFaces),
+			"similar_faces_count":   similarFaces,
+			"suggestion_id":         suggestionID,
 			"suggested_person_id":   suggestedPersonID,
 			"suggested_person_name": suggestedPersonName,
 			"suggestion_count":      maxSuggestions,
+			"suggestion_confidence": confidence,
 		}
 
 		results = append(results, result)
@@ -257,16 +320,20 @@ func (s *FaceRecognitionService) GetUntaggedFacesWithSuggestions(limit int) ([]m
 	return results, nil
 }
 
-// GetEmbeddingRepo returns the embedding repository for debugging
-func (s *FaceRecognitionService) GetEmbeddingRepo() *repository.FaceEmbeddingRepository {
-	return s.embeddingRepo
-}
-
-// GetSimilarityThreshold returns the similarity threshold for debugging
+// GetSimilarityThreshold returns the minimum similarity for faces to be considered a match
 func (s *FaceRecognitionService) GetSimilarityThreshold() float32 {
+	s.thresholdMu.RLock()
+	defer s.thresholdMu.RUnlock()
 	return s.similarityThreshold
 }
 
+// SetSimilarityThreshold changes the minimum similarity for faces to be considered a match
+func (s *FaceRecognitionService) SetSimilarityThreshold(threshold float32) {
+	s.thresholdMu.Lock()
+	defer s.thresholdMu.Unlock()
+	s.similarityThreshold = threshold
+}
+
 // CalculateSimilarity calculates cosine similarity between two embeddings
 func (s *FaceRecognitionService) CalculateSimilarity(embedding1, embedding2 []float32) float32 {
 	if len(embedding1) != len(embedding2) || len(embedding1) == 0 {
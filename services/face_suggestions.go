@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+// how many of the most similar tagged faces vote on the person suggested for a face
+const faceSuggestionNeighbours = 10
+
+// faceVector is a face's normalized embedding with the person it is tagged with, or the
+// person rejected for it when used as a negative example
+type faceVector struct {
+	faceID   uint
+	personID uint
+	vector   []float32
+}
+
+// faceSuggester works out the person of untagged faces from the tagged faces similar to them
+// and from the suggestions reviewers rejected
+type faceSuggester struct {
+	tagged         []faceVector
+	negatives      []faceVector
+	rejectedPeople map[uint][]uint // face ID -> people rejected for the face
+	threshold      float32
+}
+
+// newFaceSuggester loads the tagged faces and rejected suggestions. untagged are the untagged
+// faces' embeddings, needed for those of their rejections that are negative examples.
+func (s *FaceRecognitionService) newFaceSuggester(untagged []models.FaceEmbedding) (*faceSuggester, error) {
+	tagged, err := s.embeddingRepo.GetTaggedEmbeddings()
+	if err != nil {
+		return nil, err
+	}
+	fs := &faceSuggester{rejectedPeople: make(map[uint][]uint), threshold: s.GetSimilarityThreshold()}
+	if s.suggestionRepo != nil {
+		rejected, err := s.suggestionRepo.ListRejected()
+		if err != nil {
+			return nil, err
+		}
+		for _, suggestion := range rejected {
+			fs.rejectedPeople[suggestion.FaceID] = append(fs.rejectedPeople[suggestion.FaceID], suggestion.PersonID)
+		}
+	}
+
+	for _, embedding := range tagged {
+		vector := embedding.GetEmbedding()
+		if vector == nil || embedding.Face == nil || embedding.Face.PersonID == nil {
+			continue
+		}
+		normalized := normalizeEmbedding(vector)
+		fs.tagged = append(fs.tagged, faceVector{faceID: embedding.FaceID, personID: *embedding.Face.PersonID, vector: normalized})
+		fs.addNegatives(embedding.FaceID, normalized)
+	}
+	for _, embedding := range untagged {
+		if vector := embedding.GetEmbedding(); vector != nil {
+			fs.addNegatives(embedding.FaceID, normalizeEmbedding(vector))
+		}
+	}
+	return fs, nil
+}
+
+// addNegatives records a face as a negative example of each person rejected for it
+func (fs *faceSuggester) addNegatives(faceID uint, vector []float32) {
+	for _, personID := range fs.rejectedPeople[faceID] {
+		fs.negatives = append(fs.negatives, faceVector{faceID: faceID, personID: personID, vector: vector})
+	}
+}
+
+// suggest picks the person most of the face's similar tagged faces are tagged with. a similar
+// face that had a person rejected takes a vote away from that person, and people rejected for
+// the face itself are never picked. returns nil when no person has a vote left, along with
+// the number of similar tagged faces.
+func (fs *faceSuggester) suggest(faceID uint, embedding []float32) (*models.FaceSuggestion, int) {
+	vector := normalizeEmbedding(embedding)
+
+	type neighbour struct {
+		personID   uint
+		similarity float32
+	}
+	var neighbours []neighbour
+	for _, tagged := range fs.tagged {
+		if tagged.faceID == faceID {
+			continue
+		}
+		if similarity := dotProduct(vector, tagged.vector); similarity >= fs.threshold {
+			neighbours = append(neighbours, neighbour{personID: tagged.personID, similarity: similarity})
+		}
+	}
+	sort.Slice(neighbours, func(i, j int) bool { return neighbours[i].similarity > neighbours[j].similarity })
+	if len(neighbours) > faceSuggestionNeighbours {
+		neighbours = neighbours[:faceSuggestionNeighbours]
+	}
+
+	votes := make(map[uint]int)
+	confidence := make(map[uint]float32)
+	for _, n := range neighbours {
+		votes[n.personID]++
+		confidence[n.personID] = max(confidence[n.personID], n.similarity)
+	}
+	for _, negative := range fs.negatives {
+		if _, ok := votes[negative.personID]; !ok || negative.faceID == faceID {
+			continue
+		}
+		if dotProduct(vector, negative.vector) >= fs.threshold {
+			votes[negative.personID]--
+		}
+	}
+	for _, personID := range fs.rejectedPeople[faceID] {
+		delete(votes, personID)
+	}
+
+	var best *models.FaceSuggestion
+	for personID, count := range votes {
+		if count <= 0 {
+			continue
+		}
+		if best == nil || count > best.Votes ||
+			(count == best.Votes && (confidence[personID] > best.Confidence ||
+				(confidence[personID] == best.Confidence && personID < best.PersonID))) {
+			best = &models.FaceSuggestion{FaceID: faceID, PersonID: personID, Votes: count, Confidence: confidence[personID]}
+		}
+	}
+	return best, len(neighbours)
+}
+
+// dotProduct is the cosine similarity of two normalized embeddings
+func dotProduct(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// RefreshFaceSuggestions works out the person of every untagged face with an embedding and
+// stores it as the face's pending suggestion for review, replacing the previous one. returns
+// the number of faces with a pending suggestion.
+func (s *FaceRecognitionService) RefreshFaceSuggestions() (int, error) {
+	if s.suggestionRepo == nil {
+		return 0, nil
+	}
+	untagged, err := s.embeddingRepo.GetUntaggedEmbeddings()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get untagged embeddings: %w", err)
+	}
+	suggester, err := s.newFaceSuggester(untagged)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load faces for suggestions: %w", err)
+	}
+
+	suggested := 0
+	for _, embedding := range untagged {
+		vector := embedding.GetEmbedding()
+		if vector == nil {
+			continue
+		}
+		suggestion, _ := suggester.suggest(embedding.FaceID, vector)
+		if err := s.suggestionRepo.ReplacePending(embedding.FaceID, suggestion); err != nil {
+			return suggested, err
+		}
+		if suggestion != nil {
+			suggested++
+		}
+	}
+	log.Printf("Face suggestions: Suggested a person for %d of %d untagged face(s)", suggested, len(untagged))
+	return suggested, nil
+}
+
+// AcceptFaceSuggestion tags the face of a pending suggestion with the suggested person and
+// records the reviewer's decision. returns gorm.ErrRecordNotFound if the suggestion is not
+// pending.
+func (s *FaceRecognitionService) AcceptFaceSuggestion(suggestion *models.FaceSuggestion, reviewerID uint) error {
+	if err := s.faceRepo.TagFace(suggestion.FaceID, suggestion.PersonID); err != nil {
+		return fmt.Errorf("failed to tag face %d with person %d: %w", suggestion.FaceID, suggestion.PersonID, err)
+	}
+	return s.suggestionRepo.Review(suggestion.ID, models.FaceSuggestionAccepted, reviewerID)
+}
+
+// RejectFaceSuggestion records that a pending suggestion is wrong. the person is not suggested
+// for the face again, and counts against being suggested for faces similar to it. returns
+// gorm.ErrRecordNotFound if the suggestion is not pending.
+func (s *FaceRecognitionService) RejectFaceSuggestion(suggestion *models.FaceSuggestion, reviewerID uint) error {
+	return s.suggestionRepo.Review(suggestion.ID, models.FaceSuggestionRejected, reviewerID)
+}
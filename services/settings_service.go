@@ -0,0 +1,468 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/workers"
+)
+
+// keys of the settings that can be changed at runtime
+const (
+	SettingThumbnailMaxSize        = "thumbnail_max_size"
+	SettingWorkerCount             = "worker_count"
+	SettingFaceSimilarityThreshold = "face_similarity_threshold"
+	SettingFaceDetectionConfidence = "face_detection_confidence"
+	SettingFaceDetectionIoU        = "face_detection_iou_threshold"
+	SettingNSFWThreshold           = "nsfw_threshold"
+	SettingCORSAllowedOrigins      = "cors_allowed_origins"
+	SettingServiceMode             = "service_mode"
+
+	SettingScheduleLibraryRescanMinutes          = "schedule_library_rescan_minutes"
+	SettingScheduleOrphanCleanupMinutes          = "schedule_orphan_cleanup_minutes"
+	SettingScheduleZipRefreshMinutes             = "schedule_zip_refresh_minutes"
+	SettingScheduleEmbeddingBackfillMinutes      = "schedule_embedding_backfill_minutes"
+	SettingScheduleIntegrityCheckMinutes         = "schedule_integrity_check_minutes"
+	SettingScheduleGeocodeBackfillMinutes        = "schedule_geocode_backfill_minutes"
+	SettingScheduleFaceClusteringMinutes         = "schedule_face_clustering_minutes"
+	SettingScheduleFaceSuggestionsMinutes        = "schedule_face_suggestions_minutes"
+	SettingScheduleClassificationBackfillMinutes = "schedule_classification_backfill_minutes"
+	SettingScheduleOCRBackfillMinutes            = "schedule_ocr_backfill_minutes"
+	SettingScheduleNSFWBackfillMinutes           = "schedule_nsfw_backfill_minutes"
+)
+
+// ScheduleSettingKeys maps each maintenance task to the setting holding its interval
+var ScheduleSettingKeys = map[string]string{
+	workers.MaintenanceLibraryRescan:          SettingScheduleLibraryRescanMinutes,
+	workers.MaintenanceOrphanCleanup:          SettingScheduleOrphanCleanupMinutes,
+	workers.MaintenanceZipRefresh:             SettingScheduleZipRefreshMinutes,
+	workers.MaintenanceEmbeddingBackfill:      SettingScheduleEmbeddingBackfillMinutes,
+	workers.MaintenanceIntegrityCheck:         SettingScheduleIntegrityCheckMinutes,
+	workers.MaintenanceGeocodeBackfill:        SettingScheduleGeocodeBackfillMinutes,
+	workers.MaintenanceFaceClustering:         SettingScheduleFaceClusteringMinutes,
+	workers.MaintenanceFaceSuggestions:        SettingScheduleFaceSuggestionsMinutes,
+	workers.MaintenanceClassificationBackfill: SettingScheduleClassificationBackfillMinutes,
+	workers.MaintenanceOCRBackfill:            SettingScheduleOCRBackfillMinutes,
+	workers.MaintenanceNSFWBackfill:           SettingScheduleNSFWBackfillMinutes,
+}
+
+// SettingType describes how a setting's value is encoded
+type SettingType string
+
+const (
+	SettingTypeInt        SettingType = "int"
+	SettingTypeFloat      SettingType = "float"
+	SettingTypeStringList SettingType = "string_list"
+	SettingTypeString     SettingType = "string"
+)
+
+var (
+	ErrUnknownSetting      = errors.New("unknown setting")
+	ErrInvalidSettingValue = errors.New("invalid setting value")
+)
+
+// SettingDefinition describes a runtime setting. Min and Max bound numeric settings,
+// Options lists the values a string setting accepts.
+type SettingDefinition struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Description string      `json:"description"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	Options     []string    `json:"options,omitempty"`
+}
+
+// SettingValue is the effective value of a setting, with its default
+type SettingValue struct {
+	SettingDefinition
+	Value           interface{} `json:"value"`
+	Default         interface{} `json:"default"`
+	Overridden      bool        `json:"overridden"` // false if the default from the config is in effect
+	UpdatedByUserID *uint       `json:"updated_by_user_id,omitempty"`
+	UpdatedAt       *time.Time  `json:"updated_at,omitempty"`
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+var settingDefinitions = []SettingDefinition{
+	{
+		Key:         SettingThumbnailMaxSize,
+		Type:        SettingTypeInt,
+		Description: "Longest side of newly generated thumbnails, in pixels.",
+		Min:         bound(32),
+		Max:         bound(4096),
+	},
+	{
+		Key:         SettingWorkerCount,
+		Type:        SettingTypeInt,
+		Description: "Number of background image processing workers.",
+		Min:         bound(1),
+		Max:         bound(64),
+	},
+	{
+		Key:         SettingFaceSimilarityThreshold,
+		Type:        SettingTypeFloat,
+		Description: "Minimum similarity for two faces to be considered the same person.",
+		Min:         bound(0),
+		Max:         bound(1),
+	},
+	{
+		Key:         SettingFaceDetectionConfidence,
+		Type:        SettingTypeFloat,
+		Description: "Minimum RetinaFace confidence for a detection to be kept as a face. Applies to images detected from now on.",
+		Min:         bound(0),
+		Max:         bound(1),
+	},
+	{
+		Key:         SettingFaceDetectionIoU,
+		Type:        SettingTypeFloat,
+		Description: "Overlap (intersection over union) above which the weaker of two RetinaFace detections is dropped as a duplicate.",
+		Min:         bound(0),
+		Max:         bound(1),
+	},
+	{
+		Key:         SettingNSFWThreshold,
+		Type:        SettingTypeFloat,
+		Description: "NSFW score at which images are flagged for review. Applies to images scored from now on.",
+		Min:         bound(0),
+		Max:         bound(1),
+	},
+	{
+		Key:         SettingCORSAllowedOrigins,
+		Type:        SettingTypeStringList,
+		Description: "Origins allowed to make cross-origin requests. \"*\" allows any origin.",
+	},
+	{
+		Key:         SettingServiceMode,
+		Type:        SettingTypeString,
+		Description: "\"read_only\" refuses every change, \"maintenance\" also pauses background processing. Reads keep working in both.",
+		Options:     []string{config.ServiceModeNormal, config.ServiceModeReadOnly, config.ServiceModeMaintenance},
+	},
+	scheduleDefinition(SettingScheduleLibraryRescanMinutes, "Minutes between full library rescans. 0 disables them."),
+	scheduleDefinition(SettingScheduleOrphanCleanupMinutes, "Minutes between cleanups of records whose file was deleted. 0 disables them."),
+	scheduleDefinition(SettingScheduleZipRefreshMinutes, "Minutes between checks for outdated album archives. 0 disables them."),
+	scheduleDefinition(SettingScheduleEmbeddingBackfillMinutes, "Minutes between backfills of missing face embeddings and, with CLIP enabled, image embeddings. 0 disables them."),
+	scheduleDefinition(SettingScheduleIntegrityCheckMinutes, "Minutes between library integrity checks, which hash every original. 0 disables them."),
+	scheduleDefinition(SettingScheduleGeocodeBackfillMinutes, "Minutes between reverse geocoding runs for geotagged images without a place name. 0 disables them."),
+	scheduleDefinition(SettingScheduleFaceClusteringMinutes, "Minutes between clusterings of untagged faces into groups of likely the same person. 0 disables them."),
+	scheduleDefinition(SettingScheduleFaceSuggestionsMinutes, "Minutes between refreshes of the person suggestions waiting for review. 0 disables them."),
+	scheduleDefinition(SettingScheduleClassificationBackfillMinutes, "Minutes between classification runs for images without up to date machine tags, when classification is enabled. 0 disables them."),
+	scheduleDefinition(SettingScheduleOCRBackfillMinutes, "Minutes between OCR runs for images whose text has not been read, when OCR is enabled. 0 disables them."),
+	scheduleDefinition(SettingScheduleNSFWBackfillMinutes, "Minutes between NSFW detection runs for images not yet scored, when NSFW detection is enabled. 0 disables them."),
+}
+
+// scheduleDefinition defines the interval setting of a maintenance task, up to four weeks
+func scheduleDefinition(key, description string) SettingDefinition {
+	return SettingDefinition{
+		Key:         key,
+		Type:        SettingTypeInt,
+		Description: description,
+		Min:         bound(0),
+		Max:         bound(40320),
+	}
+}
+
+// SettingsService holds the runtime settings: database overrides on top of the defaults
+// from the config. listeners registered with OnChange apply changes without a restart.
+type SettingsService struct {
+	repo repository.SettingRepository
+
+	mu        sync.RWMutex
+	defaults  map[string]interface{}
+	overrides map[string]models.Setting
+	values    map[string]interface{} // decoded effective values
+	listeners map[string][]func(value interface{})
+}
+
+// NewSettingsService creates the service and loads the stored overrides. overrides that
+// no longer decode or validate are logged and ignored.
+func NewSettingsService(repo repository.SettingRepository, cfg config.Config) (*SettingsService, error) {
+	s := &SettingsService{
+		repo: repo,
+		defaults: map[string]interface{}{
+			SettingThumbnailMaxSize:        cfg.ThumbnailMaxSize,
+			SettingWorkerCount:             cfg.NumThumbnailWorkers,
+			SettingFaceSimilarityThreshold: cfg.FaceRecognitionThreshold,
+			SettingFaceDetectionConfidence: cfg.FaceDetectionConfidence,
+			SettingFaceDetectionIoU:        cfg.FaceDetectionIoUThreshold,
+			SettingNSFWThreshold:           cfg.NSFWThreshold,
+			SettingCORSAllowedOrigins:      append([]string{}, cfg.CORSAllowedOrigins...),
+			SettingServiceMode:             cfg.ServiceMode,
+
+			SettingScheduleLibraryRescanMinutes:          cfg.ScheduleLibraryRescanMinutes,
+			SettingScheduleOrphanCleanupMinutes:          cfg.ScheduleOrphanCleanupMinutes,
+			SettingScheduleZipRefreshMinutes:             cfg.ScheduleZipRefreshMinutes,
+			SettingScheduleEmbeddingBackfillMinutes:      cfg.ScheduleEmbeddingBackfillMinutes,
+			SettingScheduleIntegrityCheckMinutes:         cfg.ScheduleIntegrityCheckMinutes,
+			SettingScheduleGeocodeBackfillMinutes:        cfg.ScheduleGeocodeBackfillMinutes,
+			SettingScheduleFaceClusteringMinutes:         cfg.ScheduleFaceClusteringMinutes,
+			SettingScheduleFaceSuggestionsMinutes:        cfg.ScheduleFaceSuggestionsMinutes,
+			SettingScheduleClassificationBackfillMinutes: cfg.ScheduleClassificationBackfillMinutes,
+			SettingScheduleOCRBackfillMinutes:            cfg.ScheduleOCRBackfillMinutes,
+			SettingScheduleNSFWBackfillMinutes:           cfg.ScheduleNSFWBackfillMinutes,
+		},
+		listeners: make(map[string][]func(value interface{})),
+	}
+	var err error
+	if s.overrides, s.values, err = s.loadStored(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadStored reads the stored overrides and returns them with the effective values
+func (s *SettingsService) loadStored() (map[string]models.Setting, map[string]interface{}, error) {
+	overrides := make(map[string]models.Setting)
+	values := make(map[string]interface{}, len(s.defaults))
+	for key, value := range s.defaults {
+		values[key] = value
+	}
+
+	stored, err := s.repo.ListAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	for _, setting := range stored {
+		def, ok := findSettingDefinition(setting.Key)
+		if !ok {
+			log.Printf("Warning: Ignoring unknown stored setting '%s'", setting.Key)
+			continue
+		}
+		value, err := decodeSettingValue(def, json.RawMessage(setting.Value))
+		if err != nil {
+			log.Printf("Warning: Ignoring stored setting '%s': %v", setting.Key, err)
+			continue
+		}
+		overrides[setting.Key] = setting
+		values[setting.Key] = value
+	}
+	return overrides, values, nil
+}
+
+// Reload reads the stored overrides again, e.g. after the database was restored from a
+// backup, and runs the listeners of the settings whose value changed
+func (s *SettingsService) Reload() error {
+	overrides, values, err := s.loadStored()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	var changed []string
+	for key, value := range values {
+		if !reflect.DeepEqual(s.values[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	s.overrides, s.values = overrides, values
+	listeners := make(map[string][]func(value interface{}), len(changed))
+	for _, key := range changed {
+		listeners[key] = append([]func(value interface{}){}, s.listeners[key]...)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(changed)
+	for _, key := range changed {
+		log.Printf("Setting '%s' changed to %v", key, values[key])
+		for _, fn := range listeners[key] {
+			fn(values[key])
+		}
+	}
+	return nil
+}
+
+func findSettingDefinition(key string) (SettingDefinition, bool) {
+	for _, def := range settingDefinitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return SettingDefinition{}, false
+}
+
+// decodeSettingValue decodes and validates a JSON value for a setting
+func decodeSettingValue(def SettingDefinition, raw json.RawMessage) (interface{}, error) {
+	switch def.Type {
+	case SettingTypeInt, SettingTypeFloat:
+		var number float64
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidSettingValue, def.Key)
+		}
+		if def.Min != nil && number < *def.Min || def.Max != nil && number > *def.Max {
+			return nil, fmt.Errorf("%w: %s must be between %g and %g", ErrInvalidSettingValue, def.Key, *def.Min, *def.Max)
+		}
+		if def.Type == SettingTypeFloat {
+			return number, nil
+		}
+		if number != math.Trunc(number) {
+			return nil, fmt.Errorf("%w: %s must be a whole number", ErrInvalidSettingValue, def.Key)
+		}
+		return int(number), nil
+	case SettingTypeStringList:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a list of strings", ErrInvalidSettingValue, def.Key)
+		}
+		cleaned := make([]string, 0, len(list))
+		for _, item := range list {
+			if item = strings.TrimSpace(item); item != "" {
+				cleaned = append(cleaned, item)
+			}
+		}
+		return cleaned, nil
+	case SettingTypeString:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a string", ErrInvalidSettingValue, def.Key)
+		}
+		if len(def.Options) > 0 && !slices.Contains(def.Options, value) {
+			return nil, fmt.Errorf("%w: %s must be one of %s", ErrInvalidSettingValue, def.Key, strings.Join(def.Options, ", "))
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("%w: %s has unsupported type %s", ErrInvalidSettingValue, def.Key, def.Type)
+	}
+}
+
+// OnChange registers fn to be called with the new value whenever the setting changes.
+// fn is also called once right away with the current value.
+func (s *SettingsService) OnChange(key string, fn func(value interface{})) {
+	s.mu.Lock()
+	s.listeners[key] = append(s.listeners[key], fn)
+	value := s.values[key]
+	s.mu.Unlock()
+	fn(value)
+}
+
+// List returns every runtime setting with its effective value
+func (s *SettingsService) List() []SettingValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make([]SettingValue, 0, len(settingDefinitions))
+	for _, def := range settingDefinitions {
+		values = append(values, s.settingValueLocked(def))
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
+	})
+	return values
+}
+
+// Get returns a single runtime setting
+func (s *SettingsService) Get(key string) (SettingValue, error) {
+	def, ok := findSettingDefinition(key)
+	if !ok {
+		return SettingValue{}, ErrUnknownSetting
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settingValueLocked(def), nil
+}
+
+func (s *SettingsService) settingValueLocked(def SettingDefinition) SettingValue {
+	sv := SettingValue{
+		SettingDefinition: def,
+		Value:             s.values[def.Key],
+		Default:           s.defaults[def.Key],
+	}
+	if override, ok := s.overrides[def.Key]; ok {
+		updatedAt := override.UpdatedAt
+		sv.Overridden = true
+		sv.UpdatedByUserID = override.UpdatedByUserID
+		sv.UpdatedAt = &updatedAt
+	}
+	return sv
+}
+
+// Set validates and stores a new value for a setting, then applies it
+func (s *SettingsService) Set(key string, raw json.RawMessage, userID uint) (SettingValue, error) {
+	def, ok := findSettingDefinition(key)
+	if !ok {
+		return SettingValue{}, ErrUnknownSetting
+	}
+	value, err := decodeSettingValue(def, raw)
+	if err != nil {
+		return SettingValue{}, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return SettingValue{}, fmt.Errorf("failed to encode setting %s: %w", key, err)
+	}
+
+	setting := models.Setting{
+		Key:             key,
+		Value:           string(encoded),
+		UpdatedByUserID: &userID,
+		UpdatedAt:       time.Now(),
+	}
+	if err := s.repo.Upsert(&setting); err != nil {
+		return SettingValue{}, fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+
+	return s.update(def, value, &setting), nil
+}
+
+// Reset removes the override of a setting, restoring the default from the config
+func (s *SettingsService) Reset(key string) (SettingValue, error) {
+	def, ok := findSettingDefinition(key)
+	if !ok {
+		return SettingValue{}, ErrUnknownSetting
+	}
+	if err := s.repo.Delete(key); err != nil {
+		return SettingValue{}, fmt.Errorf("failed to reset setting %s: %w", key, err)
+	}
+
+	return s.update(def, s.defaults[key], nil), nil
+}
+
+// update stores the effective value and override (nil when reset to the default), then
+// runs the setting's listeners
+func (s *SettingsService) update(def SettingDefinition, value interface{}, override *models.Setting) SettingValue {
+	s.mu.Lock()
+	if override != nil {
+		s.overrides[def.Key] = *override
+	} else {
+		delete(s.overrides, def.Key)
+	}
+	s.values[def.Key] = value
+	sv := s.settingValueLocked(def)
+	listeners := append([]func(value interface{}){}, s.listeners[def.Key]...)
+	s.mu.Unlock()
+
+	log.Printf("Setting '%s' changed to %v", def.Key, value)
+	for _, fn := range listeners {
+		fn(value)
+	}
+	return sv
+}
+
+// StringList returns the current value of a string list setting
+func (s *SettingsService) StringList(key string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, _ := s.values[key].([]string)
+	return list
+}
+
+// String returns the current value of a string setting
+func (s *SettingsService) String(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, _ := s.values[key].(string)
+	return value
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/realtime"
+	"github.com/camden-git/mediasysbackend/repository"
+	"github.com/camden-git/mediasysbackend/workers"
+)
+
+// walking the asset folders is slow on large libraries, so their sizes are reused for a while
+const storageStatsTTL = 10 * time.Minute
+
+// DashboardStats is the snapshot served to the admin dashboard
+type DashboardStats struct {
+	Library repository.LibraryStats `json:"library"`
+	Storage map[string]int64        `json:"storage"` // bytes used by each asset type
+	Queue   workers.QueueStats      `json:"queue"`
+
+	ActiveUsers24h int64 `json:"active_users_24h"`
+	ActiveUsers7d  int64 `json:"active_users_7d"`
+	Uploads24h     int64 `json:"uploads_24h"`
+	Uploads7d      int64 `json:"uploads_7d"`
+
+	StorageMeasuredAt int64 `json:"storage_measured_at,omitempty"` // when the asset folders were last walked
+	GeneratedAt       int64 `json:"generated_at"`
+}
+
+// StatsService gathers the admin dashboard statistics and streams them to subscribers of
+// the stats topic of the realtime hub
+type StatsService struct {
+	statsRepo repository.StatsRepositoryInterface
+	processor *workers.ImageProcessor
+	hub       *realtime.Hub
+	cfg       config.Config
+
+	storageMu         sync.Mutex
+	storage           map[string]int64
+	storageMeasuredAt time.Time
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+func NewStatsService(
+	statsRepo repository.StatsRepositoryInterface,
+	processor *workers.ImageProcessor,
+	hub *realtime.Hub,
+	cfg config.Config,
+) *StatsService {
+	return &StatsService{
+		statsRepo: statsRepo,
+		processor: processor,
+		hub:       hub,
+		cfg:       cfg,
+	}
+}
+
+// Collect gathers a fresh snapshot, except for the sizes of the asset folders which are
+// measured at most every storageStatsTTL
+func (s *StatsService) Collect() (DashboardStats, error) {
+	now := time.Now()
+	stats := DashboardStats{GeneratedAt: now.Unix()}
+
+	library, err := s.statsRepo.LibraryStats()
+	if err != nil {
+		return stats, err
+	}
+	stats.Library = library
+
+	counts := []struct {
+		count func(since int64) (int64, error)
+		since time.Duration
+		into  *int64
+	}{
+		{s.statsRepo.CountActiveUsers, 24 * time.Hour, &stats.ActiveUsers24h},
+		{s.statsRepo.CountActiveUsers, 7 * 24 * time.Hour, &stats.ActiveUsers7d},
+		{s.statsRepo.CountUploadedSince, 24 * time.Hour, &stats.Uploads24h},
+		{s.statsRepo.CountUploadedSince, 7 * 24 * time.Hour, &stats.Uploads7d},
+	}
+	for _, c := range counts {
+		if *c.into, err = c.count(now.Add(-c.since).Unix()); err != nil {
+			return stats, err
+		}
+	}
+
+	if s.processor != nil {
+		stats.Queue = s.processor.QueueStats()
+	}
+
+	storage, measuredAt := s.assetStorage()
+	stats.Storage = map[string]int64{
+		"originals": library.OriginalBytes,
+		"archives":  library.ArchiveBytes,
+	}
+	for asset, bytes := range storage {
+		stats.Storage[asset] = bytes
+	}
+	if !measuredAt.IsZero() {
+		stats.StorageMeasuredAt = measuredAt.Unix()
+	}
+	return stats, nil
+}
+
+// assetStorage returns the bytes used by each type of generated asset and when they were
+// measured. assets in object storage aren't measured; archives are already counted from
+// the albums.
+func (s *StatsService) assetStorage() (map[string]int64, time.Time) {
+	if s.cfg.StorageBackend == config.StorageBackendS3 {
+		return nil, time.Time{}
+	}
+
+	s.storageMu.Lock()
+	defer s.storageMu.Unlock()
+	if s.storage != nil && time.Since(s.storageMeasuredAt) < storageStatsTTL {
+		return s.storage, s.storageMeasuredAt
+	}
+
+	folders := map[string]string{
+		"thumbnails": s.cfg.ThumbnailsPath,
+		"banners":    s.cfg.BannersPath,
+		"videos":     s.cfg.VideosPath,
+		"avatars":    s.cfg.AvatarsPath,
+		"resized":    s.cfg.ResizedPath,
+		"watermarks": s.cfg.WatermarksPath,
+	}
+	storage := make(map[string]int64, len(folders))
+	for asset, dir := range folders {
+		bytes, err := folderSize(dir)
+		if err != nil {
+			log.Printf("Stats: Failed to measure the %s in %s: %v", asset, dir, err)
+		}
+		storage[asset] = bytes
+	}
+	s.storage, s.storageMeasuredAt = storage, time.Now()
+	return s.storage, s.storageMeasuredAt
+}
+
+// folderSize sums the size of the files under dir. a missing folder is empty.
+func folderSize(dir string) (int64, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return total, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return total, nil
+}
+
+// Start streams a snapshot as a "stats" event on the stats topic every interval, skipping
+// the ticks when no client is connected
+func (s *StatsService) Start(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil || s.hub == nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go s.stream(interval, s.stop)
+	log.Printf("Stats: Streaming dashboard stats every %s", interval)
+}
+
+// Stop ends the stream started by Start
+func (s *StatsService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *StatsService) stream(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if s.hub.ClientCount() == 0 {
+				continue
+			}
+			stats, err := s.Collect()
+			if err != nil {
+				log.Printf("Stats: Failed to collect dashboard stats: %v", err)
+				continue
+			}
+			s.hub.Broadcast(realtime.Event{
+				Type:      "stats",
+				Topic:     realtime.StatsTopic,
+				Extra:     map[string]interface{}{"stats": stats},
+				Timestamp: stats.GeneratedAt,
+			})
+		}
+	}
+}
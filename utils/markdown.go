@@ -0,0 +1,356 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown renders markdown, e.g. an album description, to HTML that is safe to insert
+// into a page as it is. a subset of markdown is supported: paragraphs, headings, emphasis,
+// code, links, lists, blockquotes and rules. raw HTML is escaped rather than passed through,
+// and links only keep http, https, mailto and relative URLs.
+func RenderMarkdown(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"))
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderBlocks renders lines as a sequence of block elements
+func renderBlocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case trimmed == "":
+			i++
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j]), fence) {
+				j++
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(lines[i+1:j], "\n")) + "</code></pre>\n")
+			i = min(j+1, len(lines))
+		case headingLevel(trimmed) > 0:
+			level := headingLevel(trimmed)
+			text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "# "))
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, renderInline(text), level)
+			i++
+		case isRule(trimmed):
+			b.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				line := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(line, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+		default:
+			if _, _, _, ok := listItem(trimmed); ok {
+				i = renderList(b, lines, i)
+				continue
+			}
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) != "" && !startsBlock(lines[j]) {
+				j++
+			}
+			b.WriteString("<p>" + renderLines(lines[i:j]) + "</p>\n")
+			i = j
+		}
+	}
+}
+
+// renderList renders the list starting at lines[i] and returns the index of the line after it
+func renderList(b *strings.Builder, lines []string, i int) int {
+	ordered, start, _, _ := listItem(strings.TrimSpace(lines[i]))
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	if ordered && start != 1 {
+		fmt.Fprintf(b, "<ol start=\"%d\">\n", start)
+	} else {
+		b.WriteString("<" + tag + ">\n")
+	}
+	var item []string
+	flush := func() {
+		if item != nil {
+			b.WriteString("<li>" + renderLines(item) + "</li>\n")
+		}
+		item = nil
+	}
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			break
+		}
+		if itemOrdered, _, content, ok := listItem(trimmed); ok {
+			if itemOrdered != ordered {
+				break
+			}
+			flush()
+			item = []string{content}
+			continue
+		}
+		if startsBlock(lines[i]) {
+			break
+		}
+		// a line continuing the item
+		item = append(item, lines[i])
+	}
+	flush()
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderLines renders the lines of a paragraph or list item. a line ending in two spaces or
+// a backslash is followed by a line break.
+func renderLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		hardBreak := i < len(lines)-1 && (strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\"))
+		line = strings.TrimSpace(line)
+		if hardBreak {
+			line = strings.TrimSuffix(line, "\\")
+		}
+		b.WriteString(renderInline(line))
+		if hardBreak {
+			b.WriteString("<br>")
+		}
+		if i < len(lines)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// startsBlock reports whether a line starts a block other than a paragraph
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	_, _, _, isItem := listItem(trimmed)
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") ||
+		headingLevel(trimmed) > 0 || isRule(trimmed) || strings.HasPrefix(trimmed, ">") || isItem
+}
+
+// headingLevel returns the level of an ATX heading like "## Title", or 0
+func headingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// isRule reports whether a line is a thematic break like "---" or "* * *"
+func isRule(line string) bool {
+	compact := strings.ReplaceAll(line, " ", "")
+	if len(compact) < 3 {
+		return false
+	}
+	for _, marker := range []string{"-", "*", "_"} {
+		if strings.Trim(compact, marker) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listItem parses a list item like "- text" or "2. text"
+func listItem(line string) (ordered bool, start int, content string, ok bool) {
+	if len(line) >= 2 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' ' {
+		return false, 0, strings.TrimSpace(line[2:]), true
+	}
+	digits := 0
+	for digits < len(line) && digits < 9 && line[digits] >= '0' && line[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits+1 >= len(line) || (line[digits] != '.' && line[digits] != ')') || line[digits+1] != ' ' {
+		return false, 0, "", false
+	}
+	start, _ = strconv.Atoi(line[:digits])
+	return true, start, strings.TrimSpace(line[digits+2:]), true
+}
+
+// renderInline renders the emphasis, code spans and links of a line of text, escaping
+// everything else
+func renderInline(s string) string {
+	return renderSpans(s, true)
+}
+
+// renderSpans renders inline markdown like renderInline. the text of a link is rendered
+// without links, as browsers don't nest them: a link inside one would be split off it.
+func renderSpans(s string, links bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>~|", s[i+1]) >= 0 {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+		case '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			delim := s[i : i+n]
+			if end := strings.Index(s[i+n:], delim); end >= 0 {
+				b.WriteString("<code>" + html.EscapeString(strings.TrimSpace(s[i+n:i+n+end])) + "</code>")
+				i += n + end + n
+				continue
+			}
+			b.WriteString(delim)
+			i += n
+			continue
+		case '!', '[':
+			if !links {
+				break
+			}
+			// images are shown as links to them
+			start := i
+			if c == '!' {
+				start++
+			}
+			if text, dest, n, ok := parseLink(s[start:]); ok && start < len(s) && s[start] == '[' {
+				if safeLinkURL(dest) {
+					b.WriteString(`<a href="` + html.EscapeString(dest) + `" rel="nofollow noopener noreferrer">` + renderSpans(text, false) + "</a>")
+				} else {
+					b.WriteString(renderSpans(text, links))
+				}
+				i = start + n
+				continue
+			}
+		case '<':
+			// autolinks like <https://example.com>
+			if end := strings.IndexByte(s[i:], '>'); links && end > 0 {
+				dest := s[i+1 : i+end]
+				lower := strings.ToLower(dest)
+				if !strings.ContainsAny(dest, " <") && (strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")) {
+					escaped := html.EscapeString(dest)
+					b.WriteString(`<a href="` + escaped + `" rel="nofollow noopener noreferrer">` + escaped + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+		case '*', '_':
+			// "_" inside a word, like in snake_case, is text
+			if c == '_' && i > 0 && isWordByte(s[i-1]) {
+				break
+			}
+			n := 1
+			if i+1 < len(s) && s[i+1] == c {
+				n = 2
+			}
+			open := i + n
+			if open < len(s) && s[open] != ' ' {
+				if end := emphasisCloser(s, open, s[i:open]); end >= 0 {
+					tag := "em"
+					if n == 2 {
+						tag = "strong"
+					}
+					b.WriteString("<" + tag + ">" + renderSpans(s[open:end], links) + "</" + tag + ">")
+					i = end + n
+					continue
+				}
+			}
+		}
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// emphasisCloser returns the index of the delimiter closing emphasis opened before start, or -1
+func emphasisCloser(s string, start int, delim string) int {
+	for j := start + 1; j+len(delim) <= len(s); j++ {
+		if s[j:j+len(delim)] != delim || s[j-1] == ' ' {
+			continue
+		}
+		// a single "*" isn't part of a "**"
+		if len(delim) == 1 && (s[j-1] == delim[0] || (j+1 < len(s) && s[j+1] == delim[0])) {
+			continue
+		}
+		if delim[0] == '_' && j+len(delim) < len(s) && isWordByte(s[j+len(delim)]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseLink parses an inline link like [text](url "title") at the start of s, returning the
+// text, the URL and the length of the link
+func parseLink(s string) (text, dest string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+	// the URL may hold balanced parentheses
+	closeDest := -1
+	depth = 0
+	for i := closeText + 2; i < len(s) && closeDest < 0; i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				closeDest = i - (closeText + 2)
+			}
+			depth--
+		}
+	}
+	if closeDest < 0 {
+		return "", "", 0, false
+	}
+	fields := strings.Fields(s[closeText+2 : closeText+2+closeDest])
+	if len(fields) > 0 {
+		dest = strings.Trim(fields[0], "<>")
+	}
+	return s[1:closeText], dest, closeText + 2 + closeDest + 1, true
+}
+
+// safeLinkURL reports whether a link URL is http, https, mailto or relative. anything else,
+// like a javascript: URL, is left out.
+func safeLinkURL(u string) bool {
+	if u == "" {
+		return false
+	}
+	lower := strings.ToLower(u)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	// a relative URL has no colon before its path, query or fragment
+	i := strings.IndexAny(u, ":/?#")
+	return i < 0 || u[i] != ':'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
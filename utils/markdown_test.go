@@ -0,0 +1,67 @@
+package utils
+
+import "testing"
+
+func TestRenderMarkdownIsSafe(t *testing.T) {
+	const rel = ` rel="nofollow noopener noreferrer"`
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"script in a heading", "# <script>alert(1)</script>", "<h1>&lt;script&gt;alert(1)&lt;/script&gt;</h1>"},
+		{"script in a code block", "```\n<script>alert(1)</script>\n```", "<pre><code>&lt;script&gt;alert(1)&lt;/script&gt;</code></pre>"},
+		{"html element", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"javascript url", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"javascript url in mixed case", "[click](JaVaScRiPt:alert(1))", "<p>click</p>"},
+		{"javascript url in an image", "![pic](javascript:alert(1))", "<p>pic</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"data url", "[click](data:text/html;base64,PHNjcmlwdD4=)", "<p>click</p>"},
+		{"vbscript url", "[click](vbscript:msgbox)", "<p>click</p>"},
+		{"safe link", "[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2"` + rel + `>site</a></p>`},
+		{"relative link", "[album](/albums/summer)", `<p><a href="/albums/summer"` + rel + `>album</a></p>`},
+		{
+			"attribute injection in a link",
+			`[x](https://example.com/"onmouseover="alert(1))`,
+			`<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1)"` + rel + `>x</a></p>`,
+		},
+		{
+			"attribute injection in an autolink",
+			`<https://example.com/'onmouseover='alert(1)>`,
+			`<p><a href="https://example.com/&#39;onmouseover=&#39;alert(1)"` + rel + `>https://example.com/&#39;onmouseover=&#39;alert(1)</a></p>`,
+		},
+		{
+			"html in link text",
+			"[<b onclick=alert(1)>x</b>](https://example.com)",
+			`<p><a href="https://example.com"` + rel + `>&lt;b onclick=alert(1)&gt;x&lt;/b&gt;</a></p>`,
+		},
+		{
+			"nested link",
+			"[[inner](https://inner.example)](https://outer.example)",
+			`<p><a href="https://outer.example"` + rel + `>[inner](https://inner.example)</a></p>`,
+		},
+		{
+			"nested autolink",
+			"[see <https://inner.example>](https://outer.example)",
+			`<p><a href="https://outer.example"` + rel + `>see &lt;https://inner.example&gt;</a></p>`,
+		},
+		{
+			"nested link in emphasis",
+			"[**[inner](https://inner.example)**](https://outer.example)",
+			`<p><a href="https://outer.example"` + rel + `><strong>[inner](https://inner.example)</strong></a></p>`,
+		},
+		{
+			"link in the text of an unsafe link",
+			"[[inner](https://inner.example)](javascript:alert(1))",
+			`<p><a href="https://inner.example"` + rel + `>inner</a></p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderMarkdown(tt.src); got != tt.want {
+				t.Errorf("RenderMarkdown(%q)\n got: %s\nwant: %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
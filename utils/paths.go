@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrUnsafePath is returned for untrusted paths that are absolute or climb out of their root
+var ErrUnsafePath = errors.New("path must be relative and cannot use '..'")
+
+// caseInsensitiveFS is set where the filesystems are case-insensitive by default, so "/Photos"
+// and "/photos" are the same folder
+var caseInsensitiveFS = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// CleanRelPath cleans an untrusted relative path, e.g. an image path from a request, into the
+// slash separated form image records are keyed by. fails with ErrUnsafePath for absolute
+// paths and paths climbing out of their root with "..". "." is returned for an empty path.
+func CleanRelPath(unsafePath string) (string, error) {
+	slashed := filepath.ToSlash(unsafePath)
+	if strings.HasPrefix(slashed, "/") || filepath.VolumeName(unsafePath) != "" {
+		return "", ErrUnsafePath
+	}
+	cleaned := path.Clean(slashed)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrUnsafePath
+	}
+	return cleaned, nil
+}
+
+// SecureJoin joins an untrusted relative path onto root, checked like CleanRelPath, so the
+// result is always root or a path inside it
+func SecureJoin(root, unsafePath string) (string, error) {
+	rel, err := CleanRelPath(unsafePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// IsWithin reports whether fullPath is root or inside it, going by the paths alone. unlike a
+// plain prefix check, "/srv/photos2" isn't inside "/srv/photos", and on case-insensitive
+// filesystems case is ignored.
+func IsWithin(root, fullPath string) bool {
+	root = filepath.Clean(root)
+	fullPath = filepath.Clean(fullPath)
+	if caseInsensitiveFS {
+		root = strings.ToLower(root)
+		fullPath = strings.ToLower(fullPath)
+	}
+	if fullPath == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(fullPath, root)
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := filepath.FromSlash("/srv/photos")
+	tests := []struct {
+		name       string
+		unsafePath string
+		want       string
+		wantErr    bool
+	}{
+		{"file", "2024/a.jpg", "/srv/photos/2024/a.jpg", false},
+		{"empty is the root", "", "/srv/photos", false},
+		{"dot is the root", ".", "/srv/photos", false},
+		{"dot segments are cleaned", "2024/./trip/../a.jpg", "/srv/photos/2024/a.jpg", false},
+		{"climbing back in stays inside", "2024/../2025/a.jpg", "/srv/photos/2025/a.jpg", false},
+		{"absolute", "/etc/passwd", "", true},
+		{"parent", "..", "", true},
+		{"climbing out", "../secrets/a.jpg", "", true},
+		{"climbing out after a folder", "2024/../../secrets", "", true},
+		{"climbing out into a sibling", "../photos2/a.jpg", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SecureJoin(root, tt.unsafePath)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Errorf("SecureJoin(%q) = %q, %v, want ErrUnsafePath", tt.unsafePath, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SecureJoin(%q): %v", tt.unsafePath, err)
+			}
+			if want := filepath.FromSlash(tt.want); got != want {
+				t.Errorf("SecureJoin(%q) = %q, want %q", tt.unsafePath, got, want)
+			}
+			if !IsWithin(root, got) {
+				t.Errorf("SecureJoin(%q) = %q, which is outside the root", tt.unsafePath, got)
+			}
+		})
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		fullPath string
+		want     bool
+	}{
+		{"root itself", "/srv/photos", "/srv/photos", true},
+		{"root with a trailing slash", "/srv/photos/", "/srv/photos", true},
+		{"file", "/srv/photos", "/srv/photos/2024/a.jpg", true},
+		{"unclean path inside", "/srv/photos", "/srv/photos/2024/../a.jpg", true},
+		{"filesystem root", "/", "/srv/photos", true},
+		{"sibling sharing the prefix", "/srv/photos", "/srv/photos2/a.jpg", false},
+		{"parent", "/srv/photos", "/srv", false},
+		{"climbing out", "/srv/photos", "/srv/photos/../secrets/a.jpg", false},
+		{"unrelated", "/srv/photos", "/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, fullPath := filepath.FromSlash(tt.root), filepath.FromSlash(tt.fullPath)
+			if got := IsWithin(root, fullPath); got != tt.want {
+				t.Errorf("IsWithin(%q, %q) = %v, want %v", root, fullPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWithinCase(t *testing.T) {
+	defer func(saved bool) { caseInsensitiveFS = saved }(caseInsensitiveFS)
+	root, fullPath := filepath.FromSlash("/srv/Photos"), filepath.FromSlash("/srv/photos/a.jpg")
+
+	caseInsensitiveFS = false
+	if IsWithin(root, fullPath) {
+		t.Errorf("IsWithin(%q, %q) = true on a case-sensitive filesystem", root, fullPath)
+	}
+	caseInsensitiveFS = true
+	if !IsWithin(root, fullPath) {
+		t.Errorf("IsWithin(%q, %q) = false on a case-insensitive filesystem", root, fullPath)
+	}
+}
@@ -2,20 +2,55 @@ package utils
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 )
 
+// ErrNoFilesToZip is returned when an album folder has no files to archive
+var ErrNoFilesToZip = errors.New("no files found to zip")
+
+// ZipProgress is how far along writing an album archive is
+type ZipProgress struct {
+	FilesDone    int
+	FilesTotal   int
+	BytesWritten int64 // size of the archive so far, give or take what's still being compressed
+}
+
+// Percent returns the share of files done, 0-100
+func (p ZipProgress) Percent() int {
+	if p.FilesTotal == 0 {
+		return 0
+	}
+	return p.FilesDone * 100 / p.FilesTotal
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // CreateAlbumZip creates a ZIP archive of files in an album folder.
 // sourceRootDir: Absolute path to the root where original images reside.
 // albumRelativeFolderPath: Path of the album folder relative to sourceRootDir.
 // archiveSaveDir: The *full, absolute* path to the directory where the ZIP file should be saved (e.g., cfg.ArchivesPath).
 // archiveFilenameBase: The base name for the zip file (e.g., "album_123_archive_ts"). Extension (.zip) will be added.
+// ignored: Reports the file names left out of the archive, may be nil.
+// followSymlink: Reports the symlinked files included in the archive, may be nil to leave all out.
+// progress: Called after each file, may be nil.
 // Returns: final filename (e.g., "album_123_archive_ts.zip"), size in bytes, error.
-func CreateAlbumZip(sourceRootDir, albumRelativeFolderPath, archiveSaveDir, archiveFilenameBase string) (string, int64, error) {
+func CreateAlbumZip(sourceRootDir, albumRelativeFolderPath, archiveSaveDir, archiveFilenameBase string, ignored func(name string) bool, followSymlink func(fullPath string) bool, progress func(ZipProgress)) (string, int64, error) {
 
 	albumFullPath := filepath.Join(sourceRootDir, albumRelativeFolderPath)
 	albumFullPath = filepath.Clean(albumFullPath)
@@ -43,74 +78,105 @@ func CreateAlbumZip(sourceRootDir, albumRelativeFolderPath, archiveSaveDir, arch
 	// Defer closing the file handle itself
 	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	// Defer closing the zip writer *before* the file handle
-	defer zipWriter.Close()
+	names, err := AlbumZipFiles(albumFullPath, ignored, followSymlink)
+	if err == nil {
+		err = WriteAlbumZip(zipFile, albumFullPath, names, progress)
+	}
+	if err != nil {
+		// Remove the partial or empty zip
+		zipFile.Close()
+		os.Remove(zipFilePath)
+		return "", 0, fmt.Errorf("failed to write zip file %s: %w", zipFilePath, err)
+	}
 
-	// Walk the album directory
-	entries, err := os.ReadDir(albumFullPath)
+	// Get the size of the created ZIP file (Stat needs file handle closed)
+	// We closed zipWriter, now close zipFile to allow Stat
+	zipFile.Close() // Explicit close before Stat
+
+	zipInfo, err := os.Stat(zipFilePath)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to read album directory %s: %w", albumFullPath, err)
+		// File might be locked briefly? Unlikely but possible.
+		// If Stat fails, we can't return size, but the file might exist.
+		log.Printf("zipper: Warning - failed to stat created zip file %s: %v", zipFilePath, err)
+		return zipFilename, 0, fmt.Errorf("zip created but failed to get size: %w", err) // Return filename but size 0 and error
 	}
 
-	foundFiles := false
+	log.Printf("Successfully created album zip: %s (Size: %d bytes)", zipFilePath, zipInfo.Size())
+	// Return the FILENAME only (relative to archiveSaveDir), size, and nil error
+	return zipFilename, zipInfo.Size(), nil
+}
+
+// AlbumZipFiles lists the names of the files an album archive holds, those directly
+// inside albumFullPath that ignored, if not nil, doesn't report. symlinks to files are
+// included when followSymlink, if not nil, reports them. returns ErrNoFilesToZip if there
+// are none.
+func AlbumZipFiles(albumFullPath string, ignored func(name string) bool, followSymlink func(fullPath string) bool) ([]string, error) {
+	entries, err := os.ReadDir(albumFullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read album directory %s: %w", albumFullPath, err)
+	}
+	var names []string
 	for _, entry := range entries {
-		if entry.IsDir() {
-			continue // Skip subdirectories
+		if entry.Type()&fs.ModeSymlink != 0 {
+			fullPath := filepath.Join(albumFullPath, entry.Name())
+			if followSymlink == nil || !followSymlink(fullPath) {
+				continue
+			}
+			if info, err := os.Stat(fullPath); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+		} else if !entry.Type().IsRegular() { // Skip subdirectories
+			continue
 		}
+		if ignored != nil && ignored(entry.Name()) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoFilesToZip, albumFullPath)
+	}
+	return names, nil
+}
 
-		filePathInAlbum := filepath.Join(albumFullPath, entry.Name())
+// WriteAlbumZip writes a ZIP archive of the named files in albumFullPath to w, e.g. a file
+// or an HTTP response. files that can't be opened are skipped; a failed write leaves
+// the archive truncated. progress, if not nil, is called after each file, skipped ones included.
+func WriteAlbumZip(w io.Writer, albumFullPath string, names []string, progress func(ZipProgress)) error {
+	counter := &countingWriter{w: w}
+	zipWriter := zip.NewWriter(counter)
+	for i, name := range names {
+		if progress != nil && i > 0 {
+			progress(ZipProgress{FilesDone: i, FilesTotal: len(names), BytesWritten: counter.n})
+		}
+		filePathInAlbum := filepath.Join(albumFullPath, name)
 		fileToZip, err := os.Open(filePathInAlbum)
 		if err != nil {
 			log.Printf("zipper: Failed to open file %s for zipping: %v. Skipping.", filePathInAlbum, err)
 			continue // Skip this file, try others
 		}
 		// Ensure fileToZip is closed within the loop iteration
-		func() {
+		err = func() error {
 			defer fileToZip.Close()
-			writer, err := zipWriter.Create(entry.Name()) // Path inside zip is just filename
+			writer, err := zipWriter.Create(name) // Path inside zip is just filename
 			if err != nil {
-				log.Printf("zipper: Failed to create entry in zip for %s: %v. Skipping.", entry.Name(), err)
-				return // Skip this file
+				return fmt.Errorf("failed to create entry in zip for %s: %w", name, err)
 			}
 			if _, err := io.Copy(writer, fileToZip); err != nil {
-				log.Printf("zipper: Failed to write file %s to zip: %v. Skipping.", entry.Name(), err)
-				return // Skip this file
+				return fmt.Errorf("failed to write file %s to zip: %w", name, err)
 			}
-			foundFiles = true
-			// log.Printf("zipper: Added %s to archive %s", entry.Name(), zipFilePath) // Less verbose log
+			return nil
 		}() // Immediately invoke the func to ensure defer runs
+		if err != nil {
+			return err
+		}
 	}
 
-	// Close the zip writer explicitly here to ensure data is flushed before the
-	// file is stat. The defer will also run, but this ensures timing.
 	if err := zipWriter.Close(); err != nil {
-		// Attempt cleanup on finalize error
-		zipFile.Close()
-		os.Remove(zipFilePath)
-		return "", 0, fmt.Errorf("failed to finalize zip writer for %s: %w", zipFilePath, err)
+		return fmt.Errorf("failed to finalize zip writer: %w", err)
 	}
-
-	// If no files were added, remove the empty zip and return an error
-	if !foundFiles {
-		zipFile.Close() // Need to close before removing
-		os.Remove(zipFilePath)
-		return "", 0, fmt.Errorf("no files found in album folder %s to zip", albumFullPath)
+	if progress != nil {
+		progress(ZipProgress{FilesDone: len(names), FilesTotal: len(names), BytesWritten: counter.n})
 	}
-
-	// Get the size of the created ZIP file (Stat needs file handle closed)
-	// We closed zipWriter, now close zipFile to allow Stat
-	zipFile.Close() // Explicit close before Stat
-
-	zipInfo, err := os.Stat(zipFilePath)
-	if err != nil {
-		// File might be locked briefly? Unlikely but possible.
-		// If Stat fails, we can't return size, but the file might exist.
-		log.Printf("zipper: Warning - failed to stat created zip file %s: %v", zipFilePath, err)
-		return zipFilename, 0, fmt.Errorf("zip created but failed to get size: %w", err) // Return filename but size 0 and error
-	}
-
-	log.Printf("Successfully created album zip: %s (Size: %d bytes)", zipFilePath, zipInfo.Size())
-	// Return the FILENAME only (relative to archiveSaveDir), size, and nil error
-	return zipFilename, zipInfo.Size(), nil
+	return nil
 }
@@ -0,0 +1,296 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+// headers sent with every delivery. receivers verify a delivery by computing the HMAC-SHA256
+// of the raw request body with the webhook's secret and comparing it to SignatureHeader.
+const (
+	SignatureHeader = "X-Mediasys-Signature" // "sha256=" followed by the hex digest
+	EventHeader     = "X-Mediasys-Event"
+	DeliveryHeader  = "X-Mediasys-Delivery" // ID of the delivery, the same for every retry
+)
+
+// maxConcurrentDeliveries bounds the number of requests in flight at once
+const maxConcurrentDeliveries = 4
+
+// maxRetryDelay caps the exponential backoff between attempts
+const maxRetryDelay = 6 * time.Hour
+
+// maxLoggedResponseBytes is how much of a failed response body is kept in the delivery log
+const maxLoggedResponseBytes = 512
+
+var ErrDispatcherStopped = errors.New("webhook dispatcher is stopped")
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Event     string      `json:"event"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher delivers events to the webhooks subscribed to them. every delivery is stored
+// before it is attempted, so deliveries still pending at shutdown are resumed by Start.
+// a nil *Dispatcher ignores events.
+type Dispatcher struct {
+	Repo           repository.WebhookRepositoryInterface
+	Client         *http.Client
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+
+	mu      sync.Mutex
+	timers  map[uint]*time.Timer // armed attempts by delivery ID
+	stopped bool
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewDispatcher(repo repository.WebhookRepositoryInterface, cfg config.Config) *Dispatcher {
+	return &Dispatcher{
+		Repo:           repo,
+		Client:         &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutSeconds) * time.Second},
+		MaxAttempts:    cfg.WebhookMaxAttempts,
+		RetryBaseDelay: time.Duration(cfg.WebhookRetryBaseDelaySeconds) * time.Second,
+		timers:         make(map[uint]*time.Timer),
+		slots:          make(chan struct{}, maxConcurrentDeliveries),
+	}
+}
+
+// Start schedules the deliveries left pending by the last run
+func (d *Dispatcher) Start() {
+	deliveries, err := d.Repo.ListPendingDeliveries()
+	if err != nil {
+		log.Printf("Webhooks: failed to resume pending deliveries: %v", err)
+		return
+	}
+	now := time.Now().Unix()
+	for _, delivery := range deliveries {
+		var delay time.Duration
+		if delivery.NextAttemptAt != nil && *delivery.NextAttemptAt > now {
+			delay = time.Duration(*delivery.NextAttemptAt-now) * time.Second
+		}
+		d.schedule(delivery.ID, delay)
+	}
+	if len(deliveries) > 0 {
+		log.Printf("Webhooks: resumed %d pending deliveries", len(deliveries))
+	}
+}
+
+// Stop cancels the armed attempts and waits for the ones in flight. cancelled deliveries stay
+// pending and are resumed by the next Start.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	for id, timer := range d.timers {
+		if timer.Stop() {
+			d.wg.Done()
+		}
+		delete(d.timers, id)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// Emit queues a delivery of the event to every active webhook subscribed to it. data becomes
+// the "data" field of the payload.
+func (d *Dispatcher) Emit(event string, data interface{}) {
+	if d == nil {
+		return
+	}
+	webhooks, err := d.Repo.ListActiveForEvent(event)
+	if err != nil {
+		log.Printf("Webhooks: failed to look up webhooks for %s: %v", event, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Payload{Event: event, Timestamp: time.Now().Unix(), Data: data})
+	if err != nil {
+		log.Printf("Webhooks: failed to encode %s payload: %v", event, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		delivery := models.WebhookDelivery{WebhookID: webhook.ID, Event: event, Payload: string(body)}
+		if err := d.Repo.CreateDelivery(&delivery); err != nil {
+			log.Printf("Webhooks: %v", err)
+			continue
+		}
+		d.schedule(delivery.ID, 0)
+	}
+}
+
+// Redeliver sends the payload of a past delivery again as a new delivery, with a fresh set of
+// attempts
+func (d *Dispatcher) Redeliver(original *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	d.mu.Lock()
+	stopped := d.stopped
+	d.mu.Unlock()
+	if stopped {
+		return nil, ErrDispatcherStopped
+	}
+
+	delivery := models.WebhookDelivery{WebhookID: original.WebhookID, Event: original.Event, Payload: original.Payload}
+	if err := d.Repo.CreateDelivery(&delivery); err != nil {
+		return nil, err
+	}
+	d.schedule(delivery.ID, 0)
+	return &delivery, nil
+}
+
+// Sign returns the signature header value of a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// schedule arms the next attempt of a delivery
+func (d *Dispatcher) schedule(id uint, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	if timer, ok := d.timers[id]; ok && timer.Stop() {
+		d.wg.Done()
+	}
+	d.wg.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		defer d.wg.Done()
+		d.mu.Lock()
+		if d.timers[id] == timer {
+			delete(d.timers, id)
+		}
+		d.mu.Unlock()
+
+		d.slots <- struct{}{}
+		defer func() { <-d.slots }()
+		d.attempt(id)
+	})
+	d.timers[id] = timer
+}
+
+// retryDelay returns the exponential backoff after the given number of attempts
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.RetryBaseDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// attempt sends a delivery once and records the outcome, arming a retry if it failed and has
+// attempts left
+func (d *Dispatcher) attempt(id uint) {
+	delivery, err := d.Repo.GetDelivery(id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Webhooks: %v", err)
+		}
+		return // the webhook and its log were deleted meanwhile
+	}
+	if delivery.Status != models.WebhookDeliveryPending {
+		return
+	}
+
+	webhook, err := d.Repo.GetByID(delivery.WebhookID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Webhooks: %v", err)
+		}
+		return
+	}
+
+	now := time.Now().Unix()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.NextAttemptAt = nil
+	delivery.ResponseStatus = nil
+	delivery.Error = nil
+
+	var sendErr error
+	retryable := webhook.IsActive
+	if webhook.IsActive {
+		sendErr = d.send(webhook, delivery)
+	} else {
+		sendErr = errors.New("webhook is disabled")
+	}
+
+	if sendErr == nil {
+		delivery.Status = models.WebhookDeliverySucceeded
+	} else {
+		msg := sendErr.Error()
+		delivery.Error = &msg
+		if retryable && delivery.Attempts < d.MaxAttempts {
+			delay := d.retryDelay(delivery.Attempts)
+			next := now + int64(delay/time.Second)
+			delivery.NextAttemptAt = &next
+			defer d.schedule(delivery.ID, delay)
+		} else {
+			delivery.Status = models.WebhookDeliveryFailed
+			log.Printf("Webhooks: giving up on delivery %d of %s to %s after %d attempt(s): %v", delivery.ID, delivery.Event, webhook.URL, delivery.Attempts, sendErr)
+		}
+	}
+	if err := d.Repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Webhooks: %v", err)
+	}
+}
+
+// send POSTs the payload of a delivery to the webhook, storing the response status in the
+// delivery. any response outside of 2xx is an error.
+func (d *Dispatcher) send(webhook *models.Webhook, delivery *models.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mediasys-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, fmt.Sprintf("%d", delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	status := resp.StatusCode
+	delivery.ResponseStatus = &status
+	if status < 200 || status > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponseBytes))
+		if len(snippet) > 0 {
+			return fmt.Errorf("unexpected response status %d: %s", status, bytes.TrimSpace(snippet))
+		}
+		return fmt.Errorf("unexpected response status %d", status)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // lets the connection be reused
+	return nil
+}
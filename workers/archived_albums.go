@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RefreshArchivedFolders reloads the folders of archived albums, whose files are not
+// processed again. called at startup and whenever an album is archived or unarchived.
+func (ip *ImageProcessor) RefreshArchivedFolders() error {
+	albums, err := ip.AlbumRepo.ListAllAdmin()
+	if err != nil {
+		return fmt.Errorf("failed to load archived albums: %w", err)
+	}
+	var folders []string
+	for _, album := range albums {
+		if album.IsArchived {
+			folders = append(folders, album.FolderPath)
+		}
+	}
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.archivedFolders = folders
+	return nil
+}
+
+// inArchivedAlbumLocked reports whether relPath is inside the folder of an archived album.
+// ip.Mutex must be held.
+func (ip *ImageProcessor) inArchivedAlbumLocked(relPath string) bool {
+	for _, folder := range ip.archivedFolders {
+		if relPath == folder || strings.HasPrefix(relPath, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package workers
+
+import (
+	"log"
+	"path"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// groupBursts regroups the burst stacks of an image's folder and camera once its metadata
+// was extracted. frames shot less than Config.BurstIntervalMs after the one before form a
+// stack, identified by the path of its first frame, with its sharpest frame as the best.
+// the stack the image was in before is regrouped too, in case it left it.
+func (ip *ImageProcessor) groupBursts(relPath string) {
+	if ip.Config.BurstIntervalMs <= 0 {
+		return
+	}
+	// frames of a burst are processed concurrently, but grouped one at a time
+	ip.burstMutex.Lock()
+	defer ip.burstMutex.Unlock()
+
+	image, err := ip.ImageRepo.GetByPath(relPath)
+	if err != nil {
+		log.Printf("Worker: Failed to load %s for burst grouping: %v", relPath, err)
+		return
+	}
+	folder := path.Dir(image.OriginalPath)
+	candidate := image.MediaType == database.MediaTypeImage && image.TakenAtMs != nil && image.CameraMake != nil && image.CameraModel != nil
+	if candidate {
+		ip.regroupBursts(folder, *image.CameraMake, *image.CameraModel)
+	} else if image.StackID != nil {
+		if err := ip.ImageRepo.SetStack(image.OriginalPath, nil, false); err != nil {
+			log.Printf("Worker: Failed to take %s out of its burst stack: %v", relPath, err)
+		}
+	}
+	if image.StackID == nil {
+		return
+	}
+
+	// frames still in the former stack were shot with another camera than the image has now
+	frames, _, err := ip.ImageRepo.ListFiltered(repository.ImageFilter{StackID: *image.StackID}, database.DefaultSortOrder, 0, 0)
+	if err != nil {
+		log.Printf("Worker: Failed to list the former burst stack of %s: %v", relPath, err)
+		return
+	}
+	for _, frame := range frames {
+		if frame.OriginalPath == image.OriginalPath || frame.CameraMake == nil || frame.CameraModel == nil {
+			continue
+		}
+		if !candidate || *frame.CameraMake != *image.CameraMake || *frame.CameraModel != *image.CameraModel {
+			ip.regroupBursts(folder, *frame.CameraMake, *frame.CameraModel)
+		}
+		return
+	}
+}
+
+// regroupBursts splits the photos of one camera in a folder into bursts by their capture
+// times and stores the stacks that changed
+func (ip *ImageProcessor) regroupBursts(folder, cameraMake, cameraModel string) {
+	frames, err := ip.ImageRepo.ListBurstCandidates(folder, cameraMake, cameraModel)
+	if err != nil {
+		log.Printf("Worker: Failed to list burst candidates in %s: %v", folder, err)
+		return
+	}
+	interval := int64(ip.Config.BurstIntervalMs)
+	for start := 0; start < len(frames); {
+		end := start + 1
+		for end < len(frames) && *frames[end].TakenAtMs-*frames[end-1].TakenAtMs < interval {
+			end++
+		}
+		ip.storeStack(frames[start:end])
+		start = end
+	}
+}
+
+// storeStack stores a burst, updating only the frames whose stack changed. a single frame
+// isn't a burst, and is taken out of any stack it was in.
+func (ip *ImageProcessor) storeStack(frames []models.Image) {
+	var stackID *string
+	best := ""
+	if len(frames) > 1 {
+		stackID = &frames[0].OriginalPath
+		best = ip.sharpestFrame(frames)
+	}
+	for _, frame := range frames {
+		isBest := frame.OriginalPath == best
+		unchanged := frame.StackBest == isBest && (frame.StackID == nil) == (stackID == nil) &&
+			(stackID == nil || *frame.StackID == *stackID)
+		if unchanged {
+			continue
+		}
+		if err := ip.ImageRepo.SetStack(frame.OriginalPath, stackID, isBest); err != nil {
+			log.Printf("Worker: Failed to set the burst stack of %s: %v", frame.OriginalPath, err)
+		}
+	}
+}
+
+// sharpestFrame returns the path of the sharpest frame of a burst, scoring the frames that
+// haven't been yet. the earliest frame wins ties and bursts none of which could be scored.
+func (ip *ImageProcessor) sharpestFrame(frames []models.Image) string {
+	best := frames[0].OriginalPath
+	bestScore := -1.0
+	for i := range frames {
+		frame := &frames[i]
+		if frame.Sharpness == nil {
+			img, _, err := media.DecodeImageFile(ip.Config.ResolvePath(frame.OriginalPath))
+			if err != nil {
+				log.Printf("Worker: Failed to decode %s to score its sharpness: %v", frame.OriginalPath, err)
+				continue
+			}
+			score, err := media.Sharpness(img)
+			if err != nil {
+				log.Printf("Worker: Failed to score the sharpness of %s: %v", frame.OriginalPath, err)
+				continue
+			}
+			if err := ip.ImageRepo.SetSharpness(frame.OriginalPath, score); err != nil {
+				log.Printf("Worker: Failed to store the sharpness of %s: %v", frame.OriginalPath, err)
+			}
+			frame.Sharpness = &score
+		}
+		if *frame.Sharpness > bestScore {
+			best, bestScore = frame.OriginalPath, *frame.Sharpness
+		}
+	}
+	return best
+}
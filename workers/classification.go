@@ -0,0 +1,91 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"gocv.io/x/gocv"
+)
+
+// processClassificationTask labels an image with the scene and object classifier and stores
+// the labels as its machine tags
+func (ip *ImageProcessor) processClassificationTask(job ImageJob, classifier *media.ImageClassifier) error {
+	if classifier == nil || !classifier.Enabled {
+		return fmt.Errorf("image classifier is not loaded")
+	}
+	if _, err := os.Stat(job.OriginalImagePath); err != nil {
+		return fmt.Errorf("failed to stat original file: %w", err)
+	}
+
+	// OpenCV cannot read RAW files, so they are classified from their preview
+	imagePath := job.OriginalImagePath
+	if media.IsRawImage(job.OriginalImagePath) {
+		previewPath, err := media.WriteRawPreviewToTemp(job.OriginalImagePath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(previewPath)
+		imagePath = previewPath
+	}
+
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to read image file for classification: %s", imagePath)
+	}
+	defer img.Close()
+
+	classifications, err := classifier.Classify(img, float32(ip.Config.ClassificationMinConfidence), ip.Config.ClassificationMaxTags)
+	if err != nil {
+		log.Printf("Worker: ERROR classifying %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	tags := make([]models.MachineTag, len(classifications))
+	for i, classification := range classifications {
+		tags[i] = models.MachineTag{Name: classification.Label, Confidence: classification.Confidence, Model: classifier.ModelName}
+	}
+	if err := ip.MachineTagRepo.ReplaceForImage(job.OriginalRelativePath, tags); err != nil {
+		log.Printf("Worker: ERROR saving machine tags for %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	log.Printf("Worker: Classified %s with %d machine tag(s)", job.OriginalRelativePath, len(tags))
+	return nil
+}
+
+// queueClassification queues a low priority classification of an image
+func (ip *ImageProcessor) queueClassification(relPath string, modTime int64) bool {
+	return ip.QueueJob(ImageJob{
+		OriginalImagePath:    ip.Config.ResolvePath(relPath),
+		OriginalRelativePath: relPath,
+		ModTimeUnix:          modTime,
+		TaskType:             TaskClassification,
+		Priority:             PriorityLow,
+	})
+}
+
+// BackfillClassifications queues classification of the images that have not been classified
+// since they last changed, e.g. those processed before classification was enabled. returns
+// the number of tasks queued.
+func (ip *ImageProcessor) BackfillClassifications() (int, error) {
+	if !ip.Config.ClassificationEnabled {
+		return 0, nil
+	}
+	images, err := ip.MachineTagRepo.ListImagesMissingClassification()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if ip.queueClassification(img.OriginalPath, img.LastModified) {
+			queued++
+		}
+	}
+	log.Printf("Classification backfill: Queued classification for %d image(s)", queued)
+	return queued, nil
+}
@@ -0,0 +1,140 @@
+package workers
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/repository"
+)
+
+// processAlbumContactSheetTask renders the contact sheet of an album, a PDF of the thumbnails
+// of its files in the album's sort order, saves it with the archives and replaces the
+// previous sheet with it
+func (ip *ImageProcessor) processAlbumContactSheetTask(job ImageJob, store media.Store) error {
+	log.Printf("Worker: Starting contact sheet task for Album ID: %d", job.AlbumID)
+	var taskErr error
+	var sheetRelPath *string
+
+	album, err := ip.AlbumRepo.GetByID(uint(job.AlbumID))
+	if err != nil {
+		taskErr = fmt.Errorf("failed to fetch album details for ID %d: %w", job.AlbumID, err)
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else if store == nil {
+		taskErr = fmt.Errorf("no media store to save the contact sheet of album ID %d in", job.AlbumID)
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else if images, _, listErr := ip.ImageRepo.ListFiltered(repository.ImageFilter{Folder: album.FolderPath}, album.SortOrder, 0, 0); listErr != nil {
+		taskErr = fmt.Errorf("failed to list files of album %s: %w", album.FolderPath, listErr)
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else {
+		sheet := contactSheetOf(album, images, store)
+
+		safeSlug := strings.ReplaceAll(album.Slug, "/", "_")
+		safeSlug = strings.ReplaceAll(safeSlug, "\\", "_")
+		filename := fmt.Sprintf("album_%s_%d_contact_sheet_%d.pdf", safeSlug, album.ID, time.Now().Unix())
+
+		// rendered straight into the store, a page at a time
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(media.WriteContactSheetPDF(writer, sheet))
+		}()
+		savedPath, saveErr := store.Save(media.AssetTypeArchive, "", filename, reader)
+		reader.CloseWithError(io.ErrClosedPipe) // stops the rendering if the store gave up early
+		if saveErr != nil {
+			taskErr = fmt.Errorf("failed to save contact sheet of album %s: %w", album.FolderPath, saveErr)
+			log.Printf("Worker: ERROR %v", taskErr)
+		} else {
+			sheetRelPath = &savedPath
+			log.Printf("Worker: Successfully created contact sheet of %d file(s) for Album ID %d: %s", len(sheet.Entries), job.AlbumID, savedPath)
+		}
+	}
+
+	dbErr := ip.AlbumRepo.SetContactSheetResult(uint(job.AlbumID), sheetRelPath, taskErr)
+	if dbErr != nil {
+		log.Printf("Worker: ERROR updating album contact sheet DB result for Album ID %d: %v", job.AlbumID, dbErr)
+		if sheetRelPath != nil {
+			if err := store.Delete(*sheetRelPath); err != nil {
+				log.Printf("Worker: Failed to remove contact sheet %s after DB error: %v", *sheetRelPath, err)
+			}
+		}
+	} else if sheetRelPath != nil && album.ContactSheetPath != nil && *album.ContactSheetPath != "" && *album.ContactSheetPath != *sheetRelPath {
+		if err := store.Delete(*album.ContactSheetPath); err != nil {
+			log.Printf("Worker: Failed to remove previous contact sheet %s: %v", *album.ContactSheetPath, err)
+		}
+	}
+	return taskErrOrDBErr(taskErr, dbErr)
+}
+
+// contactSheetOf lays out the files of an album on a contact sheet. the video of a Live Photo
+// is left to its still, like album contents list them. every frame of a burst stack is on
+// it, as clients pick from all of them.
+func contactSheetOf(album *models.Album, images []models.Image, store media.Store) media.ContactSheet {
+	listed := make(map[string]bool, len(images))
+	for _, img := range images {
+		listed[img.OriginalPath] = true
+	}
+
+	var entries []media.ContactSheetEntry
+	for _, img := range images {
+		if img.MediaType == database.MediaTypeVideo && img.LivePairPath != nil && listed[*img.LivePairPath] {
+			continue
+		}
+		thumbPath := contactSheetThumbnail(img)
+		entries = append(entries, media.ContactSheetEntry{
+			Name: path.Base(img.OriginalPath),
+			Load: func() image.Image {
+				if thumbPath == "" {
+					return nil
+				}
+				return loadStoredImage(store, thumbPath)
+			},
+		})
+	}
+
+	return media.ContactSheet{
+		Title:    album.Name,
+		Subtitle: fmt.Sprintf("%d file(s) - %s", len(entries), time.Now().Format("2 January 2006")),
+		Entries:  entries,
+	}
+}
+
+// contactSheetThumbnail picks the smallest thumbnail of an image that is drawn sharp on a
+// contact sheet, or returns "" if it has none
+func contactSheetThumbnail(img models.Image) string {
+	if img.ThumbnailStatus != database.StatusDone {
+		return ""
+	}
+	best, bestSize := "", 0
+	for size, sizePath := range img.ThumbnailSizes {
+		if size >= media.ContactSheetCellSize && (bestSize == 0 || size < bestSize) {
+			best, bestSize = sizePath, size
+		}
+	}
+	if best == "" && img.ThumbnailPath != nil {
+		best = *img.ThumbnailPath
+	}
+	return best
+}
+
+// loadStoredImage decodes an image from the media store, or returns nil if it can't
+func loadStoredImage(store media.Store, relPath string) image.Image {
+	file, _, err := store.Get(relPath)
+	if err != nil {
+		log.Printf("Worker: Failed to open %s for the contact sheet: %v", relPath, err)
+		return nil
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		log.Printf("Worker: Failed to decode %s for the contact sheet: %v", relPath, err)
+		return nil
+	}
+	return img
+}
@@ -0,0 +1,48 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/media"
+)
+
+// processDocumentThumbnailTask renders the first page of a document and generates its
+// thumbnails from it. documents have no metadata task, so they are hashed here.
+func (ip *ImageProcessor) processDocumentThumbnailTask(job ImageJob, documentTool *media.DocumentTool, processor *media.Processor, videoTool *media.VideoTool) error {
+	var taskErr error
+	var thumbs *media.ThumbnailSet
+
+	opts := ip.thumbnailOptions(videoTool)
+	renderSize := opts.MaxSize
+	for _, size := range opts.Sizes {
+		renderSize = max(renderSize, size)
+	}
+
+	if _, statErr := os.Stat(job.OriginalImagePath); statErr != nil {
+		taskErr = fmt.Errorf("failed to stat original document: %w", statErr)
+		log.Printf("Worker: Skipping document thumbnail task for %s: %v", job.OriginalRelativePath, taskErr)
+	} else if page, renderErr := documentTool.RenderFirstPage(job.OriginalImagePath, renderSize); renderErr != nil {
+		taskErr = renderErr
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else {
+		set, genErr := processor.GenerateThumbnails(page, job.OriginalRelativePath, opts)
+		if genErr != nil {
+			taskErr = fmt.Errorf("thumbnail generation/save failed: %w", genErr)
+			log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+		} else {
+			thumbs = set
+			log.Printf("Worker: Generated document thumbnail for %s", job.OriginalRelativePath)
+		}
+	}
+	if taskErr == nil {
+		ip.recordContentHash(job)
+	}
+
+	dbErr := ip.ImageRepo.UpdateThumbnailResult(job.OriginalRelativePath, thumbs, job.ModTimeUnix, taskErr)
+	if dbErr != nil {
+		log.Printf("Worker: ERROR updating document thumbnail DB result for %s: %v", job.OriginalRelativePath, dbErr)
+	}
+	return taskErrOrDBErr(taskErr, dbErr)
+}
@@ -0,0 +1,244 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/realtime"
+	"gocv.io/x/gocv"
+	"gorm.io/gorm"
+)
+
+// ErrFaceEmbeddingRunning is returned by ReembedFaces while the images of the previous run
+// are still being processed
+var ErrFaceEmbeddingRunning = errors.New("face embedding is already running")
+
+// FaceEmbeddingProgress reports on the most recent ReembedFaces run
+type FaceEmbeddingProgress struct {
+	Model      string `json:"model"` // the recognition model faces are embedded with
+	Running    bool   `json:"running"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt *int64 `json:"finished_at,omitempty"`
+	Images     int    `json:"images"`    // images queued
+	Processed  int    `json:"processed"` // images finished, failed ones included
+	Failed     int    `json:"failed"`    // images that could not be read, or were cancelled
+	Embedded   int    `json:"embedded"`  // faces that got an embedding
+	Skipped    int    `json:"skipped"`   // faces no embedding could be extracted from
+	Error      string `json:"error,omitempty"`
+
+	queuing bool // images are still being queued, so the run can't complete yet
+}
+
+// LastFaceEmbeddingProgress returns the progress of the most recent ReembedFaces run
+func (ip *ImageProcessor) LastFaceEmbeddingProgress() (FaceEmbeddingProgress, bool) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	if ip.faceEmbedding == nil {
+		return FaceEmbeddingProgress{}, false
+	}
+	return *ip.faceEmbedding, true
+}
+
+func (ip *ImageProcessor) broadcastFaceEmbeddingLocked(status string, path string) {
+	if ip.Hub == nil {
+		return
+	}
+	progress := ip.faceEmbedding
+	ip.Hub.Broadcast(realtime.Event{
+		Type:   "face_embedding",
+		Path:   path,
+		Status: status,
+		Extra: map[string]interface{}{
+			"model":     progress.Model,
+			"images":    progress.Images,
+			"processed": progress.Processed,
+			"failed":    progress.Failed,
+			"embedded":  progress.Embedded,
+			"skipped":   progress.Skipped,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// ReembedFaces queues a face embedding task for every image with faces, tagged or not, that
+// have no embedding from the configured recognition model, e.g. faces detected before
+// recognition was enabled or embedded with a model since replaced. unlike detecting again,
+// it keeps the faces and their tags and only replaces the embeddings. progress is broadcast
+// as "face_embedding" events and available from LastFaceEmbeddingProgress. returns the
+// number of images queued.
+func (ip *ImageProcessor) ReembedFaces() (int, error) {
+	if !ip.Config.FaceRecognitionEnabled {
+		return 0, fmt.Errorf("face recognition is disabled")
+	}
+	model := ip.Config.FaceRecognitionModelName
+
+	ip.Mutex.Lock()
+	if ip.faceEmbedding != nil && ip.faceEmbedding.Running {
+		ip.Mutex.Unlock()
+		return 0, ErrFaceEmbeddingRunning
+	}
+	ip.faceEmbedding = &FaceEmbeddingProgress{Model: model, Running: true, StartedAt: time.Now().Unix(), queuing: true}
+	ip.broadcastFaceEmbeddingLocked("started", "")
+	ip.Mutex.Unlock()
+
+	queued, err := ip.queueFaceEmbeddings(model)
+
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.faceEmbedding.queuing = false
+	if err != nil {
+		ip.faceEmbedding.Error = err.Error()
+	}
+	ip.completeFaceEmbeddingLocked()
+	log.Printf("Face embedding: Queued %d image(s) for %s embeddings", queued, model)
+	return queued, err
+}
+
+func (ip *ImageProcessor) queueFaceEmbeddings(model string) (int, error) {
+	paths, err := ip.FaceRepo.ListImagePathsNeedingEmbeddings(model)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, relPath := range paths {
+		img, err := ip.ImageRepo.GetByPath(relPath)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Face embedding: Failed to load %s: %v", relPath, err)
+			}
+			continue
+		}
+		if img.MediaType != database.MediaTypeImage {
+			continue
+		}
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		job := ImageJob{
+			OriginalImagePath:    ip.Config.ResolvePath(relPath),
+			OriginalRelativePath: relPath,
+			ModTimeUnix:          img.LastModified,
+			TaskType:             TaskFaceEmbedding,
+			Priority:             PriorityLow,
+		}
+		// count the image before queuing it, so a quick worker can't finish it uncounted
+		ip.Mutex.Lock()
+		ip.faceEmbedding.Images++
+		ip.Mutex.Unlock()
+		if ip.QueueJob(job) {
+			queued++
+		} else {
+			ip.Mutex.Lock()
+			ip.faceEmbedding.Images--
+			ip.Mutex.Unlock()
+		}
+	}
+	return queued, nil
+}
+
+// faceEmbeddingFinishedLocked counts a face embedding task that won't be retried, or was
+// cancelled, towards the progress of the current run. ip.Mutex must be held.
+func (ip *ImageProcessor) faceEmbeddingFinishedLocked(job ImageJob, failed bool) {
+	progress := ip.faceEmbedding
+	if progress == nil || !progress.Running {
+		return
+	}
+	progress.Processed++
+	status := "processed"
+	if failed {
+		progress.Failed++
+		status = "failed"
+	}
+	ip.broadcastFaceEmbeddingLocked(status, job.OriginalRelativePath)
+	ip.completeFaceEmbeddingLocked()
+}
+
+// completeFaceEmbeddingLocked ends the current run once every queued image is processed.
+// ip.Mutex must be held.
+func (ip *ImageProcessor) completeFaceEmbeddingLocked() {
+	progress := ip.faceEmbedding
+	if progress.queuing || progress.Processed < progress.Images {
+		return
+	}
+	now := time.Now().Unix()
+	progress.Running = false
+	progress.FinishedAt = &now
+	ip.broadcastFaceEmbeddingLocked("completed", "")
+}
+
+// processFaceEmbeddingTask extracts embeddings for the stored faces of an image that have
+// none from the current recognition model, from the face boxes found at detection
+func (ip *ImageProcessor) processFaceEmbeddingTask(job ImageJob, recognitionModel *media.FaceRecognitionModel) error {
+	if recognitionModel == nil || !recognitionModel.Enabled {
+		return fmt.Errorf("face recognition model is not loaded")
+	}
+	faces, err := ip.FaceRepo.ListFacesNeedingEmbeddings(job.OriginalRelativePath, recognitionModel.ModelName)
+	if err != nil {
+		return err
+	}
+	if len(faces) == 0 {
+		return nil
+	}
+
+	// boxes were found on the same upright image detection reads, the RAW preview for RAW files
+	imagePath := job.OriginalImagePath
+	if media.IsRawImage(job.OriginalImagePath) {
+		previewPath, err := media.WriteRawPreviewToTemp(job.OriginalImagePath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(previewPath)
+		imagePath = previewPath
+	}
+
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to read image file for face embedding: %s", imagePath)
+	}
+	defer img.Close()
+
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	embedded, skipped := 0, 0
+	var saveErr error
+	for _, face := range faces {
+		box := image.Rect(face.X1, face.Y1, face.X2, face.Y2).Intersect(bounds)
+		if box.Empty() {
+			log.Printf("Worker: Face %d of %s lies outside the image, skipping its embedding", face.ID, job.OriginalRelativePath)
+			skipped++
+			continue
+		}
+		region := img.Region(box)
+		embedding := recognitionModel.ExtractEmbedding(region)
+		region.Close()
+		if embedding == nil {
+			log.Printf("Worker: WARNING failed to extract an embedding for face %d of %s", face.ID, job.OriginalRelativePath)
+			skipped++
+			continue
+		}
+		if err := ip.FaceEmbeddingRepo.Upsert(face.ID, embedding, recognitionModel.ModelName); err != nil {
+			log.Printf("Worker: ERROR saving embedding for face %d of %s: %v", face.ID, job.OriginalRelativePath, err)
+			saveErr = err
+			break
+		}
+		embedded++
+	}
+
+	ip.Mutex.Lock()
+	if ip.faceEmbedding != nil && ip.faceEmbedding.Running {
+		ip.faceEmbedding.Embedded += embedded
+		ip.faceEmbedding.Skipped += skipped
+	}
+	ip.Mutex.Unlock()
+	if saveErr != nil {
+		return saveErr
+	}
+	log.Printf("Worker: Embedded %d face(s) of %s with %s, skipped %d", embedded, job.OriginalRelativePath, recognitionModel.ModelName, skipped)
+	return nil
+}
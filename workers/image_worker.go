@@ -1,20 +1,25 @@
 package workers
 
 import (
+	"errors"
 	"fmt"
-	"image"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/camden-git/mediasysbackend/config"
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/email"
 	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
 	"github.com/camden-git/mediasysbackend/realtime"
 	"github.com/camden-git/mediasysbackend/repository"
 	"github.com/camden-git/mediasysbackend/utils"
+	"github.com/camden-git/mediasysbackend/webhooks"
 	"gocv.io/x/gocv"
 )
 
@@ -24,27 +29,110 @@ const (
 	TaskMetadata  = "metadata"
 	TaskDetection = "detection"
 	TaskAlbumZip  = "album_zip"
+
+	TaskAlbumContactSheet = "album_contact_sheet"
+
+	TaskVideoThumbnail = "video_thumbnail"
+	TaskVideoTranscode = "video_transcode"
+	TaskVideoStream    = "video_stream"
+
+	TaskDocumentThumbnail = "document_thumbnail"
+
+	// optional, has no status column: an image is done once it has an embedding
+	TaskCLIPEmbedding = "clip_embedding"
+	// optional, has no status column: an image is done once its geocoded_at is set
+	TaskGeocode = "geocode"
+	// has no status column: a face is done once it has an embedding from the current model
+	TaskFaceEmbedding = "face_embedding"
+	// optional, has no status column: an image is done once its classified_at is set
+	TaskClassification = "classification"
+	// optional, has no status column: an image is done once its ocr_at is set
+	TaskOCR = "ocr"
+	// optional, has no status column: an image is done once its nsfw_checked_at is set
+	TaskNSFW = "nsfw"
 )
 
+// taskStatusColumn maps a task type to the images table column tracking its status
+func taskStatusColumn(taskType string) string {
+	switch taskType {
+	case TaskVideoThumbnail, TaskDocumentThumbnail:
+		return "thumbnail_status" // a video's poster frame and a document's first page are their thumbnail
+	case TaskVideoTranscode:
+		return "transcode_status"
+	case TaskVideoStream:
+		return "stream_status"
+	default:
+		return taskType + "_status"
+	}
+}
+
+// TaskNeedsProcessing reports whether a task should be (re)queued for a file that has not
+// changed. tasks that failed on every automatic retry are left alone until they are retried
+// through the admin jobs API
+func TaskNeedsProcessing(status string, attempts, maxAttempts int) bool {
+	if status == database.StatusDone || status == database.StatusNotRequired {
+		return false
+	}
+	return status != database.StatusError || attempts < maxAttempts
+}
+
 type ImageJob struct {
+	ID                   string // assigned when queued
 	OriginalImagePath    string
 	OriginalRelativePath string
 	ModTimeUnix          int64
 	TaskType             string
 	AlbumID              int64
+	Attempt              int         // 1 for the first run, incremented on each automatic retry
+	Priority             JobPriority // defaults to PriorityNormal
 }
 
 type ImageProcessor struct {
-	JobQueue  chan ImageJob
+	HighQueue chan ImageJob // interactive work, e.g. thumbnails for a folder a user is viewing
+	JobQueue  chan ImageJob // normal priority
+	LowQueue  chan ImageJob // bulk background work
 	Config    config.Config
 	ImageRepo repository.ImageRepositoryInterface
 	AlbumRepo repository.AlbumRepositoryInterface
 	FaceRepo  repository.FaceRepositoryInterface
 	Wg        sync.WaitGroup
 	StopChan  chan struct{}
-	Pending   map[string]bool
+	Pending   map[string]string     // pending key -> ID of the queued/processing job, prevents duplicates
+	Jobs      map[string]*JobRecord // job state by ID, including recently finished jobs
 	Mutex     sync.Mutex
 	Hub       *realtime.Hub
+
+	// image embeddings for semantic search, only used when CLIP is enabled
+	EmbeddingRepo repository.ImageEmbeddingRepositoryInterface
+	// face embeddings written by face embedding tasks, only used when face recognition is enabled
+	FaceEmbeddingRepo repository.FaceEmbeddingRepositoryInterface
+	// machine tags written by classification tasks, only used when classification is enabled
+	MachineTagRepo repository.MachineTagRepositoryInterface
+	// resolves GPS positions to place names, nil when reverse geocoding is disabled
+	Geocoder media.Geocoder
+	// records zip completions in the activity feed
+	ActivityRepo repository.ActivityRepositoryInterface
+	// sends image.processed and album.zip.done to webhooks, nil disables them
+	Webhooks *webhooks.Dispatcher
+	// emails users waiting for an album archive, nil disables it
+	Notifier *email.Notifier
+
+	workerStops      []chan struct{} // one per running worker, closing it retires that worker
+	nextWorkerID     int
+	thumbnailMaxSize atomic.Int64           // adjustable at runtime, seeded from Config.ThumbnailMaxSize
+	integrityReport  *IntegrityReport       // last VerifyIntegrity run, guarded by Mutex
+	faceEmbedding    *FaceEmbeddingProgress // last ReembedFaces run, guarded by Mutex
+	detectionConf    float32                // minimum RetinaFace confidence, adjustable at runtime. guarded by Mutex
+	detectionIoU     float32                // RetinaFace duplicate overlap, adjustable at runtime. guarded by Mutex
+	nsfwThreshold    float32                // NSFW score images are flagged at, adjustable at runtime. guarded by Mutex
+	resume           chan struct{}          // non-nil while paused, closed on resume. guarded by Mutex
+	archivedFolders  []string               // folders of archived albums, see RefreshArchivedFolders. guarded by Mutex
+	burstMutex       sync.Mutex             // held while grouping bursts, see groupBursts
+
+	// renders images for task events, see SetFileInfoRenderer. guarded by Mutex
+	renderFileInfo func(img *models.Image) interface{}
+	// told about images whose tasks finished, see SetImageChangedListener. guarded by Mutex
+	imageChanged func(relPath string)
 }
 
 func NewImageProcessor(
@@ -52,8 +140,15 @@ func NewImageProcessor(
 	imgRepo repository.ImageRepositoryInterface,
 	albumRepo repository.AlbumRepositoryInterface,
 	faceRepo repository.FaceRepositoryInterface,
+	embeddingRepo repository.ImageEmbeddingRepositoryInterface,
+	faceEmbeddingRepo repository.FaceEmbeddingRepositoryInterface,
+	machineTagRepo repository.MachineTagRepositoryInterface,
+	geocoder media.Geocoder,
+	activityRepo repository.ActivityRepositoryInterface,
 	queueSize, numWorkers int,
 	hub *realtime.Hub,
+	dispatcher *webhooks.Dispatcher,
+	notifier *email.Notifier,
 ) *ImageProcessor {
 	if numWorkers <= 0 {
 		numWorkers = 1
@@ -62,37 +157,152 @@ func NewImageProcessor(
 		queueSize = 100
 	}
 	proc := &ImageProcessor{
-		JobQueue:  make(chan ImageJob, queueSize),
-		Config:    cfg,
-		ImageRepo: imgRepo,
-		AlbumRepo: albumRepo,
-		FaceRepo:  faceRepo,
-		StopChan:  make(chan struct{}),
-		Pending:   make(map[string]bool),
-		Hub:       hub,
-	}
-	proc.Wg.Add(numWorkers)
-	for i := 0; i < numWorkers; i++ {
-		go proc.worker(i, cfg)
+		HighQueue:         make(chan ImageJob, queueSize),
+		JobQueue:          make(chan ImageJob, queueSize),
+		LowQueue:          make(chan ImageJob, queueSize),
+		Config:            cfg,
+		ImageRepo:         imgRepo,
+		AlbumRepo:         albumRepo,
+		FaceRepo:          faceRepo,
+		EmbeddingRepo:     embeddingRepo,
+		FaceEmbeddingRepo: faceEmbeddingRepo,
+		MachineTagRepo:    machineTagRepo,
+		Geocoder:          geocoder,
+		ActivityRepo:      activityRepo,
+		StopChan:          make(chan struct{}),
+		Pending:           make(map[string]string),
+		Jobs:              make(map[string]*JobRecord),
+		Hub:               hub,
+		Webhooks:          dispatcher,
+		Notifier:          notifier,
 	}
+	proc.thumbnailMaxSize.Store(int64(cfg.ThumbnailMaxSize))
+	proc.detectionConf = float32(cfg.FaceDetectionConfidence)
+	proc.detectionIoU = float32(cfg.FaceDetectionIoUThreshold)
+	proc.nsfwThreshold = float32(cfg.NSFWThreshold)
+	proc.SetWorkerCount(numWorkers)
 	log.Printf("Started %d image processing worker(s) with queue size %d", numWorkers, queueSize)
 	return proc
 }
 
-// worker loads resources and processes jobs from the queue
-func (ip *ImageProcessor) worker(id int, cfg config.Config) {
+// SetWorkerCount starts or retires workers until n are running. retired workers
+// finish the job they are processing before exiting.
+func (ip *ImageProcessor) SetWorkerCount(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	select {
+	case <-ip.StopChan:
+		return // shutting down
+	default:
+	}
+
+	for len(ip.workerStops) < n {
+		quit := make(chan struct{})
+		ip.workerStops = append(ip.workerStops, quit)
+		ip.Wg.Add(1)
+		go ip.worker(ip.nextWorkerID, ip.Config, quit)
+		ip.nextWorkerID++
+	}
+	for len(ip.workerStops) > n {
+		last := len(ip.workerStops) - 1
+		close(ip.workerStops[last])
+		ip.workerStops = ip.workerStops[:last]
+	}
+}
+
+// WorkerCount returns the number of running workers
+func (ip *ImageProcessor) WorkerCount() int {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	return len(ip.workerStops)
+}
+
+// ThumbnailMaxSize returns the longest side, in pixels, of newly generated thumbnails
+func (ip *ImageProcessor) ThumbnailMaxSize() int {
+	return int(ip.thumbnailMaxSize.Load())
+}
+
+// SetThumbnailMaxSize changes the size of thumbnails generated from now on. existing
+// thumbnails are not regenerated.
+func (ip *ImageProcessor) SetThumbnailMaxSize(size int) {
+	ip.thumbnailMaxSize.Store(int64(size))
+}
+
+// DetectionThresholds returns the minimum confidence of a RetinaFace detection and the
+// overlap above which duplicate detections are dropped
+func (ip *ImageProcessor) DetectionThresholds() (confidence, iou float32) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	return ip.detectionConf, ip.detectionIoU
+}
+
+// SetDetectionConfidence changes the minimum confidence of RetinaFace detections from the
+// next detection task on. faces already detected are kept.
+func (ip *ImageProcessor) SetDetectionConfidence(confidence float32) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.detectionConf = confidence
+}
+
+// SetDetectionIoUThreshold changes the overlap above which duplicate RetinaFace detections
+// are dropped, from the next detection task on
+func (ip *ImageProcessor) SetDetectionIoUThreshold(iou float32) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.detectionIoU = iou
+}
+
+// thumbnailOptions returns what the thumbnail tasks generate. videoTool encodes the extra
+// formats.
+func (ip *ImageProcessor) thumbnailOptions(videoTool *media.VideoTool) media.ThumbnailOptions {
+	return media.ThumbnailOptions{
+		MaxSize: ip.ThumbnailMaxSize(),
+		Sizes:   ip.Config.ThumbnailSizes,
+		Formats: ip.Config.ThumbnailFormats,
+		Encoder: videoTool,
+	}
+}
+
+// SetPaused stops or resumes job processing. while paused, jobs are still queued but
+// workers wait before starting the next one; jobs already running finish.
+func (ip *ImageProcessor) SetPaused(paused bool) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	if paused && ip.resume == nil {
+		ip.resume = make(chan struct{})
+		log.Println("Image processing paused")
+	} else if !paused && ip.resume != nil {
+		close(ip.resume)
+		ip.resume = nil
+		log.Println("Image processing resumed")
+	}
+}
+
+// Paused reports whether job processing is paused
+func (ip *ImageProcessor) Paused() bool {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	return ip.resume != nil
+}
+
+// worker loads resources and processes jobs from the queue until quit is closed or the processor stops
+func (ip *ImageProcessor) worker(id int, cfg config.Config, quit <-chan struct{}) {
 	defer ip.Wg.Done()
 
-	mediaStore, err := media.NewLocalStorage(cfg.MediaStoragePath, map[media.AssetType]string{
-		media.AssetTypeThumbnail: filepath.Base(cfg.ThumbnailsPath),
-		media.AssetTypeBanner:    filepath.Base(cfg.BannersPath),
-		media.AssetTypeArchive:   filepath.Base(cfg.ArchivesPath),
-	})
+	mediaStore, err := media.NewStoreFromConfig(cfg)
 	if err != nil {
 		log.Printf("Worker %d: FATAL - Failed to initialize media store: %v. Worker exiting.", id, err)
 		return
 	}
 	mediaProcessor := media.NewProcessor(mediaStore)
+	videoTool := media.NewVideoTool(cfg.FFmpegPath, cfg.FFprobePath)
+	ocrTool := media.NewOCRTool(cfg.TesseractPath, cfg.OCRLanguages)
+	documentTool := media.NewDocumentTool(cfg.PdftoppmPath)
 
 	log.Printf("Worker %d: Loading face detectors...", id)
 
@@ -138,126 +348,360 @@ func (ip *ImageProcessor) worker(id int, cfg config.Config) {
 		log.Printf("Worker %d: Face Recognition is DISABLED via config.", id)
 	}
 
+	var clipEncoder *media.CLIPImageEncoder
+	if cfg.CLIPEnabled {
+		clipEncoder = media.NewCLIPImageEncoder(cfg.CLIPImageModelPath)
+		defer clipEncoder.Close()
+		if !clipEncoder.Enabled {
+			log.Printf("Worker %d: CLIP image encoder failed to load.", id)
+		}
+	}
+
+	var classifier *media.ImageClassifier
+	if cfg.ClassificationEnabled {
+		classifier = media.NewImageClassifier(cfg.ClassificationModelPath, cfg.ClassificationLabelsPath, cfg.ClassificationModelName)
+		defer classifier.Close()
+		if !classifier.Enabled {
+			log.Printf("Worker %d: Image classifier failed to load.", id)
+		}
+	}
+
+	var nsfwDetector *media.NSFWDetector
+	if cfg.NSFWEnabled {
+		nsfwDetector = media.NewNSFWDetector(cfg.NSFWModelPath, cfg.NSFWClasses)
+		defer nsfwDetector.Close()
+		if !nsfwDetector.Enabled {
+			log.Printf("Worker %d: NSFW detector failed to load.", id)
+		}
+	}
+
 	log.Printf("Image worker %d started", id)
 	for {
-		select {
-		case job, ok := <-ip.JobQueue:
-			if !ok {
-				log.Printf("Image worker %d stopping: Job queue closed", id)
-				return
-			}
+		job, ok := ip.nextJob(quit)
+		if !ok {
+			log.Printf("Image worker %d stopping", id)
+			return
+		}
 
-			var err error
-
-			var pendingKey string
-			var statusColumn string
-			var entityPath string
-
-			log.Printf("Worker %d: Received job type '%s' for: %s", id, job.TaskType, entityPath)
-			if ip.Hub != nil {
-				ip.Hub.Broadcast(realtime.Event{
-					Type:      "task",
-					Path:      job.OriginalRelativePath,
-					Task:      job.TaskType,
-					Status:    "processing",
-					Timestamp: time.Now().Unix(),
-				})
-			}
+		if !ip.startJob(job) {
+			log.Printf("Worker %d: Skipping cancelled job %s (%s for %s)", id, job.ID, job.TaskType, job.OriginalRelativePath)
+			continue
+		}
 
-			if job.TaskType == TaskAlbumZip {
-				err = ip.AlbumRepo.MarkZipProcessing(uint(job.AlbumID))
-				statusColumn = "zip_status" // for logging key
-				entityPath = fmt.Sprintf("album ID %d", job.AlbumID)
-				pendingKey = fmt.Sprintf("album_%d:%s", job.AlbumID, job.TaskType)
-			} else {
-				statusColumn = job.TaskType + "_status"
-				err = ip.ImageRepo.MarkTaskProcessing(job.OriginalRelativePath, statusColumn)
-				log.Printf("Status column: %s", statusColumn)
-				entityPath = job.OriginalRelativePath
-				pendingKey = fmt.Sprintf("%s:%s", job.OriginalRelativePath, job.TaskType)
-			}
+		var err error
 
-			if err != nil {
-				log.Printf("Worker %d: ERROR marking %s processing for %s: %v. Skipping job.", id, job.TaskType, entityPath, err)
-				if ip.Hub != nil {
-					ip.Hub.Broadcast(realtime.Event{Type: "task", Path: job.OriginalRelativePath, Task: job.TaskType, Status: "error", Error: err.Error(), Timestamp: time.Now().Unix()})
-				}
-				ip.Mutex.Lock()
-				delete(ip.Pending, pendingKey)
-				ip.Mutex.Unlock()
-				continue
-			}
+		var statusColumn string
+		var entityPath string
 
-			switch job.TaskType {
-			case TaskThumbnail:
-				ip.processThumbnailTask(job, mediaProcessor)
-			case TaskMetadata:
-				ip.processMetadataTask(job)
-			case TaskDetection:
-				ip.processDetectionTask(job, faceDetector, retinaFaceDetector, recognitionModel, cfg)
-			case TaskAlbumZip:
-				ip.processAlbumZipTask(job, mediaStore)
-			default:
-				log.Printf("Worker %d: ERROR unknown task type '%s'", id, job.TaskType)
-			}
+		log.Printf("Worker %d: Received job type '%s' for: %s", id, job.TaskType, entityPath)
+		if ip.Hub != nil {
+			ip.Hub.Broadcast(realtime.Event{
+				Type:      "task",
+				Path:      job.OriginalRelativePath,
+				Task:      job.TaskType,
+				Status:    "processing",
+				Extra:     taskEventExtra(job),
+				Timestamp: time.Now().Unix(),
+			})
+		}
 
-			if ip.Hub != nil {
-				ip.Hub.Broadcast(realtime.Event{
-					Type:      "task",
-					Path:      job.OriginalRelativePath,
-					Task:      job.TaskType,
-					Status:    "done",
-					Timestamp: time.Now().Unix(),
-				})
-			}
+		if job.TaskType == TaskAlbumZip {
+			err = ip.AlbumRepo.MarkZipProcessing(uint(job.AlbumID))
+			statusColumn = "zip_status" // for logging key
+			entityPath = fmt.Sprintf("album ID %d", job.AlbumID)
+		} else if job.TaskType == TaskAlbumContactSheet {
+			err = ip.AlbumRepo.MarkContactSheetProcessing(uint(job.AlbumID))
+			statusColumn = "contact_sheet_status"
+			entityPath = fmt.Sprintf("album ID %d", job.AlbumID)
+		} else if job.TaskType == TaskCLIPEmbedding || job.TaskType == TaskGeocode || job.TaskType == TaskFaceEmbedding || job.TaskType == TaskClassification || job.TaskType == TaskOCR || job.TaskType == TaskNSFW {
+			entityPath = job.OriginalRelativePath
+		} else {
+			statusColumn = taskStatusColumn(job.TaskType)
+			err = ip.ImageRepo.MarkTaskProcessing(job.OriginalRelativePath, statusColumn)
+			log.Printf("Status column: %s", statusColumn)
+			entityPath = job.OriginalRelativePath
+		}
 
-			ip.Mutex.Lock()
-			delete(ip.Pending, pendingKey)
-			ip.Mutex.Unlock()
+		if err != nil {
+			log.Printf("Worker %d: ERROR marking %s processing for %s: %v. Skipping job.", id, job.TaskType, entityPath, err)
+			ip.broadcastTaskFinished(job, err, ip.finishJob(job, err))
+			continue
+		}
 
-		case <-ip.StopChan:
-			log.Printf("Image worker %d stopping: Stop signal received", id)
-			return
+		var taskErr error
+		switch job.TaskType {
+		case TaskThumbnail:
+			taskErr = ip.processThumbnailTask(job, mediaProcessor, videoTool)
+		case TaskMetadata:
+			taskErr = ip.processMetadataTask(job)
+		case TaskDetection:
+			taskErr = ip.processDetectionTask(job, faceDetector, retinaFaceDetector, recognitionModel, cfg)
+		case TaskAlbumZip:
+			taskErr = ip.processAlbumZipTask(job, mediaStore)
+		case TaskAlbumContactSheet:
+			taskErr = ip.processAlbumContactSheetTask(job, mediaStore)
+		case TaskVideoThumbnail:
+			taskErr = ip.processVideoThumbnailTask(job, videoTool, mediaProcessor)
+		case TaskVideoTranscode:
+			taskErr = ip.processVideoTranscodeTask(job, videoTool, mediaProcessor)
+		case TaskVideoStream:
+			taskErr = ip.processVideoStreamTask(job, videoTool, mediaProcessor, mediaStore)
+		case TaskDocumentThumbnail:
+			taskErr = ip.processDocumentThumbnailTask(job, documentTool, mediaProcessor, videoTool)
+		case TaskCLIPEmbedding:
+			taskErr = ip.processCLIPEmbeddingTask(job, clipEncoder)
+		case TaskGeocode:
+			taskErr = ip.processGeocodeTask(job)
+		case TaskFaceEmbedding:
+			taskErr = ip.processFaceEmbeddingTask(job, recognitionModel)
+		case TaskClassification:
+			taskErr = ip.processClassificationTask(job, classifier)
+		case TaskOCR:
+			taskErr = ip.processOCRTask(job, ocrTool)
+		case TaskNSFW:
+			taskErr = ip.processNSFWTask(job, nsfwDetector)
+		default:
+			taskErr = fmt.Errorf("unknown task type '%s'", job.TaskType)
+			log.Printf("Worker %d: ERROR unknown task type '%s'", id, job.TaskType)
+		}
+
+		if taskErr == nil && job.TaskType == TaskThumbnail && cfg.CLIPEnabled {
+			ip.queueCLIPEmbedding(job.OriginalRelativePath, job.ModTimeUnix)
+		}
+		if taskErr == nil && job.TaskType == TaskThumbnail && cfg.ClassificationEnabled {
+			ip.queueClassification(job.OriginalRelativePath, job.ModTimeUnix)
+		}
+		if taskErr == nil && job.TaskType == TaskThumbnail && cfg.OCREnabled {
+			ip.queueOCR(job.OriginalRelativePath, job.ModTimeUnix)
+		}
+		if taskErr == nil && job.TaskType == TaskThumbnail && cfg.NSFWEnabled {
+			ip.queueNSFWCheck(job.OriginalRelativePath, job.ModTimeUnix)
+		}
+		if taskErr == nil && job.TaskType == TaskVideoThumbnail && cfg.VideoHLSEnabled {
+			ip.scheduleStream(job, mediaStore)
+		}
+		if taskErr == nil && !job.isAlbumTask() && job.TaskType != TaskCLIPEmbedding && job.TaskType != TaskGeocode && job.TaskType != TaskFaceEmbedding && job.TaskType != TaskClassification && job.TaskType != TaskOCR && job.TaskType != TaskNSFW {
+			if resetErr := ip.ImageRepo.ResetTaskAttempts(job.OriginalRelativePath, statusColumn); resetErr != nil {
+				log.Printf("Worker %d: ERROR resetting %s attempts for %s: %v", id, job.TaskType, entityPath, resetErr)
+			}
+			ip.emitImageProcessed(job.OriginalRelativePath)
 		}
+		ip.broadcastTaskFinished(job, taskErr, ip.finishJob(job, taskErr))
 	}
 }
 
 // processThumbnailTask generates thumbnail and updates DB
-func (ip *ImageProcessor) processThumbnailTask(job ImageJob, processor *media.Processor) {
+func (ip *ImageProcessor) processThumbnailTask(job ImageJob, processor *media.Processor, videoTool *media.VideoTool) error {
 	var taskErr error
-	var thumbRelPath *string
+	var thumbs *media.ThumbnailSet
 
-	file, openErr := os.Open(job.OriginalImagePath)
-	if openErr != nil {
-		taskErr = fmt.Errorf("failed to open original file: %w", openErr)
+	if _, statErr := os.Stat(job.OriginalImagePath); statErr != nil {
+		taskErr = fmt.Errorf("failed to open original file: %w", statErr)
 		log.Printf("Worker: Skipping thumbnail task for %s: %v", job.OriginalRelativePath, taskErr)
 	} else {
-		img, format, decodeErr := image.Decode(file)
-		file.Close()
+		// RAW files are decoded from their embedded JPEG preview
+		img, format, decodeErr := media.DecodeImageFile(job.OriginalImagePath)
 
 		if decodeErr != nil {
 			taskErr = fmt.Errorf("failed to decode image for thumbnail: %w", decodeErr)
 			log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
 		} else {
 			log.Printf("Worker: Decoded image %s (format: %s) for thumbnail", job.OriginalRelativePath, format)
-			relPath, genErr := processor.GenerateThumbnail(img, job.OriginalRelativePath, ip.Config.ThumbnailMaxSize)
+			set, genErr := processor.GenerateThumbnails(img, job.OriginalRelativePath, ip.thumbnailOptions(videoTool))
 			if genErr != nil {
 				taskErr = fmt.Errorf("thumbnail generation/save failed: %w", genErr)
 				log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
 			} else {
-				thumbRelPath = &relPath
+				thumbs = set
 				log.Printf("Worker: Generated thumbnail for %s", job.OriginalRelativePath)
 			}
 		}
 	}
 
-	dbErr := ip.ImageRepo.UpdateThumbnailResult(job.OriginalRelativePath, thumbRelPath, job.ModTimeUnix, taskErr)
+	dbErr := ip.ImageRepo.UpdateThumbnailResult(job.OriginalRelativePath, thumbs, job.ModTimeUnix, taskErr)
 	if dbErr != nil {
 		log.Printf("Worker: ERROR updating thumbnail DB result for %s: %v", job.OriginalRelativePath, dbErr)
 	}
+	return taskErrOrDBErr(taskErr, dbErr)
+}
+
+// processCLIPEmbeddingTask embeds an image with the CLIP image encoder for semantic search
+func (ip *ImageProcessor) processCLIPEmbeddingTask(job ImageJob, encoder *media.CLIPImageEncoder) error {
+	if encoder == nil || !encoder.Enabled {
+		return fmt.Errorf("CLIP image encoder is not loaded")
+	}
+	if _, err := os.Stat(job.OriginalImagePath); err != nil {
+		return fmt.Errorf("failed to stat original file: %w", err)
+	}
+
+	// OpenCV cannot read RAW files, so they are embedded from their preview
+	imagePath := job.OriginalImagePath
+	if media.IsRawImage(job.OriginalImagePath) {
+		previewPath, err := media.WriteRawPreviewToTemp(job.OriginalImagePath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(previewPath)
+		imagePath = previewPath
+	}
+
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to read image file for CLIP: %s", imagePath)
+	}
+	defer img.Close()
+
+	embedding, err := encoder.EncodeImage(img)
+	if err != nil {
+		log.Printf("Worker: ERROR embedding %s with CLIP: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	if err := ip.EmbeddingRepo.Upsert(job.OriginalRelativePath, embedding, media.CLIPModelName); err != nil {
+		log.Printf("Worker: ERROR saving CLIP embedding for %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	log.Printf("Worker: Embedded %s with CLIP (%d dimensions)", job.OriginalRelativePath, len(embedding))
+	return nil
+}
+
+// queueCLIPEmbedding queues a low priority CLIP embedding of an image
+func (ip *ImageProcessor) queueCLIPEmbedding(relPath string, modTime int64) bool {
+	return ip.QueueJob(ImageJob{
+		OriginalImagePath:    ip.Config.ResolvePath(relPath),
+		OriginalRelativePath: relPath,
+		ModTimeUnix:          modTime,
+		TaskType:             TaskCLIPEmbedding,
+		Priority:             PriorityLow,
+	})
+}
+
+// processGeocodeTask resolves the GPS position of an image to a place name
+func (ip *ImageProcessor) processGeocodeTask(job ImageJob) error {
+	if ip.Geocoder == nil {
+		return fmt.Errorf("reverse geocoding is not enabled")
+	}
+	img, err := ip.ImageRepo.GetByPath(job.OriginalRelativePath)
+	if err != nil {
+		return fmt.Errorf("failed to load image record: %w", err)
+	}
+	if img.Latitude == nil || img.Longitude == nil {
+		log.Printf("Worker: Skipping geocoding of %s, it has no GPS position", job.OriginalRelativePath)
+		return nil
+	}
+
+	place, err := ip.Geocoder.ReverseGeocode(*img.Latitude, *img.Longitude)
+	if err != nil {
+		log.Printf("Worker: ERROR geocoding %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	if err := ip.ImageRepo.UpdateLocation(job.OriginalRelativePath, place); err != nil {
+		log.Printf("Worker: ERROR saving location for %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	if place != nil {
+		log.Printf("Worker: Geocoded %s to %s", job.OriginalRelativePath, place.Name())
+	} else {
+		log.Printf("Worker: No place found for the position of %s", job.OriginalRelativePath)
+	}
+	return nil
 }
 
-func (ip *ImageProcessor) processMetadataTask(job ImageJob) {
+// queueGeocode queues low priority reverse geocoding of an image
+func (ip *ImageProcessor) queueGeocode(relPath string, modTime int64) bool {
+	return ip.QueueJob(ImageJob{
+		OriginalImagePath:    ip.Config.ResolvePath(relPath),
+		OriginalRelativePath: relPath,
+		ModTimeUnix:          modTime,
+		TaskType:             TaskGeocode,
+		Priority:             PriorityLow,
+	})
+}
+
+// processVideoThumbnailTask probes a video, generates a thumbnail from a poster frame and updates DB.
+// the video of a Live Photo whose still was processed gets no thumbnail, being listed as the still.
+func (ip *ImageProcessor) processVideoThumbnailTask(job ImageJob, videoTool *media.VideoTool, processor *media.Processor) error {
+	var taskErr error
+	var thumbs *media.ThumbnailSet
+	var info *media.VideoInfo
+
+	if _, statErr := os.Stat(job.OriginalImagePath); statErr != nil {
+		taskErr = fmt.Errorf("failed to stat original video: %w", statErr)
+		log.Printf("Worker: Skipping video thumbnail task for %s: %v", job.OriginalRelativePath, taskErr)
+	} else if info, taskErr = videoTool.Probe(job.OriginalImagePath); taskErr != nil {
+		log.Printf("Worker: ERROR probing video %s: %v", job.OriginalRelativePath, taskErr)
+	} else if still := ip.livePhotoPartner(job.OriginalRelativePath, database.MediaTypeVideo, info.ContentID); still != nil {
+		log.Printf("Worker: Skipping thumbnail of %s, the video of Live Photo %s", job.OriginalRelativePath, still.OriginalPath)
+	} else {
+		poster, posterErr := videoTool.ExtractPosterFrame(job.OriginalImagePath, info.Duration)
+		if posterErr != nil {
+			taskErr = posterErr
+			log.Printf("Worker: ERROR %v", taskErr)
+		} else {
+			set, genErr := processor.GenerateThumbnails(poster, job.OriginalRelativePath, ip.thumbnailOptions(videoTool))
+			if genErr != nil {
+				taskErr = fmt.Errorf("thumbnail generation/save failed: %w", genErr)
+				log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+			} else {
+				thumbs = set
+				log.Printf("Worker: Generated video thumbnail for %s", job.OriginalRelativePath)
+			}
+		}
+	}
+	if taskErr == nil {
+		ip.recordContentHash(job) // videos have no metadata task, so they are hashed here
+	}
+
+	dbErr := ip.ImageRepo.UpdateVideoThumbnailResult(job.OriginalRelativePath, thumbs, info, job.ModTimeUnix, taskErr)
+	if dbErr != nil {
+		log.Printf("Worker: ERROR updating video thumbnail DB result for %s: %v", job.OriginalRelativePath, dbErr)
+	} else if taskErr == nil {
+		ip.pairLivePhoto(job.OriginalRelativePath, database.MediaTypeVideo, info.ContentID)
+	}
+	return taskErrOrDBErr(taskErr, dbErr)
+}
+
+// processVideoTranscodeTask creates a web-playable MP4 rendition and updates DB
+func (ip *ImageProcessor) processVideoTranscodeTask(job ImageJob, videoTool *media.VideoTool, processor *media.Processor) error {
+	var taskErr error
+	var renditionRelPath *string
+
+	tmpFile, err := os.CreateTemp("", "mediasys-transcode-*"+media.VideoRenditionExtension)
+	if err != nil {
+		taskErr = fmt.Errorf("failed to create temp file for transcode: %w", err)
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else {
+		tmpPath := tmpFile.Name()
+		tmpFile.Close()
+		defer os.Remove(tmpPath)
+
+		log.Printf("Worker: Transcoding video %s (max height %dpx)", job.OriginalRelativePath, ip.Config.VideoTranscodeMaxHeight)
+		if err := videoTool.TranscodeWeb(job.OriginalImagePath, tmpPath, ip.Config.VideoTranscodeMaxHeight); err != nil {
+			taskErr = err
+			log.Printf("Worker: ERROR %v", taskErr)
+		} else if rendition, openErr := os.Open(tmpPath); openErr != nil {
+			taskErr = fmt.Errorf("failed to open transcoded rendition: %w", openErr)
+			log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+		} else {
+			relPath, saveErr := processor.SaveVideoRendition(rendition, job.OriginalRelativePath)
+			rendition.Close()
+			if saveErr != nil {
+				taskErr = saveErr
+				log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+			} else {
+				renditionRelPath = &relPath
+				log.Printf("Worker: Transcoded video %s", job.OriginalRelativePath)
+			}
+		}
+	}
+
+	dbErr := ip.ImageRepo.UpdateTranscodeResult(job.OriginalRelativePath, renditionRelPath, job.ModTimeUnix, taskErr)
+	if dbErr != nil {
+		log.Printf("Worker: ERROR updating transcode DB result for %s: %v", job.OriginalRelativePath, dbErr)
+	}
+	return taskErrOrDBErr(taskErr, dbErr)
+}
+
+func (ip *ImageProcessor) processMetadataTask(job ImageJob) error {
 	var taskErr error
 	var metadata *media.Metadata
 
@@ -275,15 +719,25 @@ func (ip *ImageProcessor) processMetadataTask(job ImageJob) {
 			log.Printf("Worker: Extracted metadata for %s", job.OriginalRelativePath)
 		}
 	}
+	if taskErr == nil {
+		ip.recordContentHash(job)
+	}
 
 	dbErr := ip.ImageRepo.UpdateMetadataResult(job.OriginalRelativePath, metadata, job.ModTimeUnix, taskErr)
 	if dbErr != nil {
 		log.Printf("Worker: ERROR updating metadata DB result for %s: %v", job.OriginalRelativePath, dbErr)
+	} else if taskErr == nil {
+		ip.groupBursts(job.OriginalRelativePath)
+		ip.pairLivePhoto(job.OriginalRelativePath, database.MediaTypeImage, metadata.ContentID)
+		if ip.Geocoder != nil && metadata.Latitude != nil && metadata.Longitude != nil {
+			ip.queueGeocode(job.OriginalRelativePath, job.ModTimeUnix)
+		}
 	}
+	return taskErrOrDBErr(taskErr, dbErr)
 }
 
 // processDetectionTask performs detection and updates DB
-func (ip *ImageProcessor) processDetectionTask(job ImageJob, faceDetector *media.DNNFaceDetector, retinaFaceDetector *media.RetinaFaceDetector, recognitionModel *media.FaceRecognitionModel, cfg config.Config) {
+func (ip *ImageProcessor) processDetectionTask(job ImageJob, faceDetector *media.DNNFaceDetector, retinaFaceDetector *media.RetinaFaceDetector, recognitionModel *media.FaceRecognitionModel, cfg config.Config) error {
 	var taskErr error
 	var detections []media.DetectionResult
 
@@ -294,11 +748,30 @@ func (ip *ImageProcessor) processDetectionTask(job ImageJob, faceDetector *media
 		taskErr = fmt.Errorf("failed to stat original file: %w", statErr)
 		log.Printf("Worker: ERROR stating file for detection task %s: %v", job.OriginalRelativePath, taskErr)
 	} else {
+		// OpenCV cannot read RAW files, so detection runs on the embedded preview instead
+		detectionPath := job.OriginalImagePath
+		if media.IsRawImage(job.OriginalImagePath) {
+			previewPath, previewErr := media.WriteRawPreviewToTemp(job.OriginalImagePath)
+			if previewErr != nil {
+				taskErr = previewErr
+				log.Printf("Worker: ERROR extracting RAW preview for detection %s: %v", job.OriginalRelativePath, taskErr)
+			} else {
+				defer os.Remove(previewPath)
+				detectionPath = previewPath
+			}
+		}
+
+		// OpenCV reads JPEGs upright according to their EXIF orientation (and RAW previews are
+		// rotated when extracted), so boxes line up with the thumbnails and stored dimensions.
 		// Try RetinaFace first (preferred), fall back to DNN if needed
-		if retinaFaceDetector != nil && retinaFaceDetector.Enabled {
-			img := gocv.IMRead(job.OriginalImagePath, gocv.IMReadColor)
+		if taskErr != nil {
+			// RAW preview extraction failed, nothing to run detection on
+		} else if retinaFaceDetector != nil && retinaFaceDetector.Enabled {
+			// each worker has its own detector, so the current thresholds are applied per task
+			retinaFaceDetector.ConfThreshold, retinaFaceDetector.IoUThreshold = ip.DetectionThresholds()
+			img := gocv.IMRead(detectionPath, gocv.IMReadColor)
 			if img.Empty() {
-				taskErr = fmt.Errorf("failed to read image file for RetinaFace: %s", job.OriginalImagePath)
+				taskErr = fmt.Errorf("failed to read image file for RetinaFace: %s", detectionPath)
 			} else {
 				defer img.Close()
 
@@ -315,7 +788,7 @@ func (ip *ImageProcessor) processDetectionTask(job ImageJob, faceDetector *media
 			}
 		} else if faceDetector != nil && faceDetector.Enabled {
 			// Fall back to DNN detector
-			detections, taskErr = media.DetectFacesAndAnimals(job.OriginalImagePath, faceDetector)
+			detections, taskErr = media.DetectFacesAndAnimals(detectionPath, faceDetector)
 			if taskErr != nil {
 				log.Printf("Worker: ERROR during DNN detection for %s: %v", job.OriginalRelativePath, taskErr)
 			} else {
@@ -330,10 +803,42 @@ func (ip *ImageProcessor) processDetectionTask(job ImageJob, faceDetector *media
 	dbErr := ip.ImageRepo.UpdateDetectionResult(job.OriginalRelativePath, detections, job.ModTimeUnix, taskErr)
 	if dbErr != nil {
 		log.Printf("Worker: ERROR updating detection DB result for %s: %v", job.OriginalRelativePath, dbErr)
+	} else if taskErr == nil {
+		ip.tagImportedPerson(job.OriginalRelativePath)
 	}
+	return taskErrOrDBErr(taskErr, dbErr)
 }
 
-func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) {
+// tagImportedPerson tags the face of an imported image with the person its sidecar named.
+// sidecars carry no face positions, so only images with one untagged face and one named
+// person are tagged; the others are left for the face suggestions.
+func (ip *ImageProcessor) tagImportedPerson(relPath string) {
+	image, err := ip.ImageRepo.GetByPath(relPath)
+	if err != nil || len(image.ImportedPersonIDs) != 1 {
+		return
+	}
+	faces, err := ip.FaceRepo.ListByImagePath(relPath)
+	if err != nil {
+		log.Printf("Worker: Failed to list faces of %s to tag its imported person: %v", relPath, err)
+		return
+	}
+	var untagged []models.Face
+	for _, face := range faces {
+		if face.PersonID == nil {
+			untagged = append(untagged, face)
+		} else if *face.PersonID == image.ImportedPersonIDs[0] {
+			return
+		}
+	}
+	if len(untagged) != 1 {
+		return
+	}
+	if err := ip.FaceRepo.TagFace(untagged[0].ID, image.ImportedPersonIDs[0]); err != nil {
+		log.Printf("Worker: Failed to tag the imported person of %s: %v", relPath, err)
+	}
+}
+
+func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) error {
 	log.Printf("Worker: Starting ZIP task for Album ID: %d", job.AlbumID)
 	var taskErr error
 	var finalZipRelPath *string
@@ -343,6 +848,9 @@ func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) {
 	if err != nil {
 		taskErr = fmt.Errorf("failed to fetch album details for ID %d: %w", job.AlbumID, err)
 		log.Printf("Worker: ERROR %v", taskErr)
+	} else if err := ip.Config.CheckSymlinks(ip.Config.ResolvePath(album.FolderPath)); err != nil {
+		taskErr = fmt.Errorf("album folder %s is not accessible under the symlink policy: %w", album.FolderPath, err)
+		log.Printf("Worker: ERROR %v", taskErr)
 	} else {
 		//zipSaveDirName := filepath.Base(ip.Config.ArchivesPath)
 		zipSaveDirAbs := ip.Config.ArchivesPath // full path to archives directory
@@ -353,11 +861,15 @@ func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) {
 
 		zipFilenameBase := fmt.Sprintf("album_%s_%d_archive_%d", safeSlug, album.ID, time.Now().Unix())
 
+		library, folderInLibrary := ip.Config.SplitPath(album.FolderPath)
 		savedZipFilename, zipSizeBytes, zipErr := utils.CreateAlbumZip(
-			ip.Config.RootDirectory, // root of all media folders
-			album.FolderPath,        // path relative to RootDirectory
-			zipSaveDirAbs,           // absolute path to save the zip
-			zipFilenameBase,         // filename base for the zip
+			library.Path,    // root directory of the album's library
+			folderInLibrary, // path relative to the library
+			zipSaveDirAbs,   // absolute path to save the zip
+			zipFilenameBase, // filename base for the zip
+			ip.Config.IsIgnored,
+			ip.Config.AllowsSymlink,
+			ip.zipProgressReporter(album),
 		)
 
 		if zipErr != nil {
@@ -368,6 +880,10 @@ func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) {
 			// example: if MediaStoragePath is /srv/media and zipSaveDirAbs is /srv/media/archives,
 			// then relativePathToStore should be "archives/the_zip_file.zip"
 			relativePathToStore, relErr := filepath.Rel(ip.Config.MediaStoragePath, filepath.Join(zipSaveDirAbs, savedZipFilename))
+			if _, isLocal := store.(*media.LocalStorage); !isLocal && store != nil && relErr == nil {
+				// the zip is always built on local disk; move it into the configured store
+				relativePathToStore, relErr = ip.uploadZipToStore(store, filepath.Join(zipSaveDirAbs, savedZipFilename))
+			}
 			if relErr != nil {
 				taskErr = fmt.Errorf("failed to calculate relative path for zip: %w", relErr)
 				log.Printf("Worker: ERROR %v", taskErr)
@@ -384,51 +900,171 @@ func (ip *ImageProcessor) processAlbumZipTask(job ImageJob, store media.Store) {
 	if dbErr != nil {
 		log.Printf("Worker: ERROR updating album ZIP DB result for Album ID %d: %v", job.AlbumID, dbErr)
 		if finalZipRelPath != nil && store != nil { // Ensure store is not nil
-			fullPathToClean, _ := store.GetFullPath(*finalZipRelPath)
-			if fullPathToClean != "" {
-				if err := os.Remove(fullPathToClean); err != nil {
-					log.Printf("Worker: Failed to remove zip file %s after DB error: %v", fullPathToClean, err)
-				}
+			if err := store.Delete(*finalZipRelPath); err != nil {
+				log.Printf("Worker: Failed to remove zip file %s after DB error: %v", *finalZipRelPath, err)
 			}
 		}
 	}
+	if ip.Webhooks != nil {
+		data := map[string]interface{}{"album_id": job.AlbumID, "status": database.StatusDone}
+		if taskErr != nil || dbErr != nil {
+			data["status"] = database.StatusError
+			data["error"] = taskErrOrDBErr(taskErr, dbErr).Error()
+		} else {
+			data["zip_size"] = finalZipSize
+		}
+		if album != nil {
+			data["album_slug"] = album.Slug
+		}
+		ip.Webhooks.Emit(models.WebhookEventAlbumZipDone, data)
+	}
+	if taskErr == nil && dbErr == nil && ip.ActivityRepo != nil {
+		activity := models.Activity{Type: models.ActivityAlbumZipReady, AlbumID: uint(job.AlbumID)}
+		if err := ip.ActivityRepo.Create(&activity); err != nil {
+			log.Printf("Worker: Failed to record zip activity for Album ID %d: %v", job.AlbumID, err)
+		}
+	}
+	if taskErr == nil && dbErr == nil && album != nil {
+		ip.Notifier.ZipReady(album)
+	}
+	return taskErrOrDBErr(taskErr, dbErr)
 }
 
-// QueueJob queues a specific task if not already pending
-func (ip *ImageProcessor) QueueJob(job ImageJob) bool {
-	// use composite key: "relativePath:taskType"
-	var pendingKey string
-	if job.TaskType == TaskAlbumZip {
-		pendingKey = fmt.Sprintf("album_%d:%s", job.AlbumID, job.TaskType)
+// zipProgressInterval is the least time between two progress updates of an album zip
+const zipProgressInterval = time.Second
+
+// zipProgressReporter returns a progress callback for building an album's zip, which
+// broadcasts the progress and stores the percent on the album, at most once per
+// zipProgressInterval and only when the percent changed
+func (ip *ImageProcessor) zipProgressReporter(album *models.Album) func(utils.ZipProgress) {
+	var lastReport time.Time
+	lastPercent := -1
+	return func(progress utils.ZipProgress) {
+		percent := progress.Percent()
+		if percent == lastPercent || (percent < 100 && time.Since(lastReport) < zipProgressInterval) {
+			return
+		}
+		lastReport, lastPercent = time.Now(), percent
+
+		if err := ip.AlbumRepo.SetZipProgress(album.ID, percent); err != nil {
+			log.Printf("Worker: Failed to store zip progress for Album ID %d: %v", album.ID, err)
+		}
+		if ip.Hub != nil {
+			ip.Hub.Broadcast(realtime.Event{
+				Type:   "task",
+				Path:   album.FolderPath,
+				Task:   TaskAlbumZip,
+				Status: "progress",
+				Extra: map[string]interface{}{
+					"album_id":      album.ID,
+					"files_done":    progress.FilesDone,
+					"files_total":   progress.FilesTotal,
+					"bytes_written": progress.BytesWritten,
+					"percent":       percent,
+				},
+				Timestamp: time.Now().Unix(),
+			})
+		}
+	}
+}
+
+// emitImageProcessed sends image.processed once none of an image's processing tasks is pending
+// or running anymore. two tasks finishing at the same moment can both see the image as
+// complete, so receivers may get the event twice.
+func (ip *ImageProcessor) emitImageProcessed(imagePath string) {
+	if ip.Webhooks == nil {
+		return
+	}
+	img, err := ip.ImageRepo.GetByPath(imagePath)
+	if err != nil {
+		log.Printf("Worker: Failed to load %s for webhooks: %v", imagePath, err)
+		return
+	}
+
+	var statuses map[string]string
+	if img.MediaType == database.MediaTypeVideo {
+		statuses = map[string]string{"thumbnail": img.ThumbnailStatus, "transcode": img.TranscodeStatus, "stream": img.StreamStatus}
+	} else if img.MediaType == database.MediaTypeDocument {
+		statuses = map[string]string{"thumbnail": img.ThumbnailStatus}
 	} else {
-		pendingKey = fmt.Sprintf("%s:%s", job.OriginalRelativePath, job.TaskType)
+		statuses = map[string]string{"thumbnail": img.ThumbnailStatus, "metadata": img.MetadataStatus, "detection": img.DetectionStatus}
+	}
+	for _, status := range statuses {
+		if status == database.StatusPending || status == database.StatusProcessing {
+			return
+		}
 	}
 
-	ip.Mutex.Lock()
-	if ip.Pending[pendingKey] {
-		ip.Mutex.Unlock()
-		return false
+	ip.Webhooks.Emit(models.WebhookEventImageProcessed, map[string]interface{}{
+		"path":       "/" + img.OriginalPath,
+		"media_type": img.MediaType,
+		"width":      img.Width,
+		"height":     img.Height,
+		"taken_at":   img.TakenAt,
+		"tasks":      statuses,
+	})
+}
+
+// taskErrOrDBErr picks the error that decides a job's outcome: the task's own error,
+// or failing that the error from recording its result
+func taskErrOrDBErr(taskErr, dbErr error) error {
+	if taskErr != nil {
+		return taskErr
 	}
+	if dbErr != nil {
+		return fmt.Errorf("failed to record task result: %w", dbErr)
+	}
+	return nil
+}
 
-	ip.Pending[pendingKey] = true
-	ip.Mutex.Unlock()
+// uploadZipToStore copies a locally built archive into a non-local store and removes the local copy
+func (ip *ImageProcessor) uploadZipToStore(store media.Store, localZipPath string) (string, error) {
+	zipFile, err := os.Open(localZipPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open zip for upload: %w", err)
+	}
+	defer func() {
+		zipFile.Close()
+		if err := os.Remove(localZipPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Worker: Failed to remove local zip %s after upload: %v", localZipPath, err)
+		}
+	}()
 
-	select {
-	case ip.JobQueue <- job:
-		log.Printf("Queued task '%s' for: %s", job.TaskType, job.OriginalRelativePath)
-		return true
-	default:
-		log.Printf("WARNING: Image processing job queue full. Failed to queue task '%s' for: %s", job.TaskType, job.OriginalRelativePath)
-		ip.Mutex.Lock()
-		delete(ip.Pending, pendingKey)
-		ip.Mutex.Unlock()
+	savedRelPath, err := store.Save(media.AssetTypeArchive, "", filepath.Base(localZipPath), zipFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload zip to media store: %w", err)
+	}
+	return savedRelPath, nil
+}
+
+// QueueJob queues a specific task if not already pending. a task already queued at a lower
+// priority is promoted to the job's priority.
+func (ip *ImageProcessor) QueueJob(job ImageJob) bool {
+	if _, err := ip.enqueue(job, ""); err != nil {
+		if errors.Is(err, ErrJobQueueFull) {
+			log.Printf("WARNING: Image processing job queue full. Failed to queue task '%s' for: %s", job.TaskType, job.OriginalRelativePath)
+		} else if errors.Is(err, ErrAlbumArchived) {
+			log.Printf("Skipping task '%s' for %s: its album is archived", job.TaskType, job.OriginalRelativePath)
+		}
 		return false
 	}
+	log.Printf("Queued task '%s' (%s priority) for: %s", job.TaskType, job.Priority, job.OriginalRelativePath)
+	return true
 }
 
+// Stop lets workers finish the task they are running and waits for them to exit. jobs
+// still queued or waiting for a retry stay tracked so they can be saved with SaveQueue.
 func (ip *ImageProcessor) Stop() {
 	log.Println("Stopping image processor workers...")
+	ip.Mutex.Lock()
 	close(ip.StopChan)
+	for _, rec := range ip.Jobs {
+		if rec.retryTimer != nil {
+			rec.retryTimer.Stop()
+			rec.retryTimer = nil
+		}
+	}
+	ip.Mutex.Unlock()
 	ip.Wg.Wait()
 	log.Println("All image processor workers stopped")
 }
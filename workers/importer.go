@@ -0,0 +1,558 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/realtime"
+	"github.com/camden-git/mediasysbackend/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	// errors beyond this many are only counted in the report
+	maxImportErrors = 100
+	// a progress event is broadcast every this many files
+	importProgressEvery = 50
+	// attempts at a unique name and slug for an imported album
+	maxAlbumNameAttempts = 20
+)
+
+var (
+	ErrImportRunning          = errors.New("an import is already running")
+	ErrImportSourceInvalid    = errors.New("the import source is not a readable folder")
+	ErrImportDestinationRoot  = errors.New("the import destination must be a folder inside a library")
+	ErrImportOverlappingPaths = errors.New("the import source and destination overlap")
+)
+
+// ImportOptions describes the import of an external library, e.g. a Google Takeout export or
+// a plain folder with JSON sidecars
+type ImportOptions struct {
+	Source      string `json:"source"`      // absolute path of the folder holding the export
+	Destination string `json:"destination"` // library folder the files are placed in, relative to the root
+	Move        bool   `json:"move"`        // move the files rather than copy them
+	UserID      *uint  `json:"user_id,omitempty"`
+}
+
+// ImportReport is the outcome of an import, updated while it runs
+type ImportReport struct {
+	Options       ImportOptions `json:"options"`
+	State         string        `json:"state"` // "running", "completed" or "failed"
+	StartedAt     int64         `json:"started_at"`
+	FinishedAt    int64         `json:"finished_at,omitempty"`
+	Files         int           `json:"files"`          // files placed in the library
+	Existing      int           `json:"existing"`       // files found already imported, their sidecars are applied again
+	Unsupported   int           `json:"unsupported"`    // files that aren't photos or videos mediasys processes
+	WithSidecar   int           `json:"with_sidecar"`   // files whose sidecar was found
+	AlbumsCreated int           `json:"albums_created"` // albums created for the album folders
+	PeopleCreated int           `json:"people_created"` // people created for names no person had
+	TasksQueued   int           `json:"tasks_queued"`
+	ErrorCount    int           `json:"error_count"`
+	Errors        []string      `json:"errors"` // the first maxImportErrors errors
+	Error         string        `json:"error,omitempty"`
+}
+
+// Importer copies external libraries into the library, maps their album folders to albums
+// and their sidecars to descriptions, capture times, positions and people, and queues the
+// files for processing. one import runs at a time.
+type Importer struct {
+	Processor  *ImageProcessor
+	PersonRepo repository.PersonRepositoryInterface
+
+	mu     sync.Mutex
+	report *ImportReport // the running or last import
+}
+
+func NewImporter(processor *ImageProcessor, personRepo repository.PersonRepositoryInterface) *Importer {
+	return &Importer{Processor: processor, PersonRepo: personRepo}
+}
+
+// Report returns the report of the running or last import
+func (im *Importer) Report() (ImportReport, bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.report == nil {
+		return ImportReport{}, false
+	}
+	report := *im.report
+	report.Errors = append([]string{}, im.report.Errors...)
+	return report, true
+}
+
+// Start checks the options and runs the import in the background. progress is broadcast as
+// "import" events and available from Report.
+func (im *Importer) Start(opts ImportOptions) (ImportReport, error) {
+	run, err := im.begin(opts)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report, _ := im.Report()
+	go run()
+	return report, nil
+}
+
+// Run runs an import and returns its report once every file was placed and queued. the
+// queued tasks may still be running.
+func (im *Importer) Run(opts ImportOptions) (ImportReport, error) {
+	run, err := im.begin(opts)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if err := run(); err != nil {
+		report, _ := im.Report()
+		return report, err
+	}
+	report, _ := im.Report()
+	return report, nil
+}
+
+// begin validates the options and claims the importer, returning the import to run
+func (im *Importer) begin(opts ImportOptions) (func() error, error) {
+	source, destDir, destRel, err := im.resolvePaths(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Source, opts.Destination = source, destRel
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.report != nil && im.report.State == "running" {
+		return nil, ErrImportRunning
+	}
+	im.report = &ImportReport{Options: opts, State: "running", StartedAt: time.Now().Unix(), Errors: []string{}}
+
+	return func() error {
+		job := &importJob{
+			importer: im,
+			opts:     opts,
+			destDir:  destDir,
+			people:   make(map[string]uint),
+		}
+		return job.run()
+	}, nil
+}
+
+// resolvePaths returns the cleaned source, and the absolute and relative destination
+func (im *Importer) resolvePaths(opts ImportOptions) (string, string, string, error) {
+	source, err := filepath.Abs(opts.Source)
+	if err != nil || opts.Source == "" {
+		return "", "", "", ErrImportSourceInvalid
+	}
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return "", "", "", ErrImportSourceInvalid
+	}
+
+	cfg := im.Processor.Config
+	if _, inner := cfg.SplitPath(opts.Destination); inner == "" {
+		return "", "", "", ErrImportDestinationRoot
+	}
+	destDir := cfg.ResolvePath(opts.Destination)
+	destRel, err := cfg.RelativePath(destDir)
+	if err != nil {
+		return "", "", "", ErrImportDestinationRoot
+	}
+	if isWithinDir(destDir, source) || isWithinDir(source, destDir) {
+		return "", "", "", ErrImportOverlappingPaths
+	}
+	return source, destDir, destRel, nil
+}
+
+// isWithinDir reports whether p is dir or inside it
+func isWithinDir(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// update changes the report of the running import
+func (im *Importer) update(fn func(report *ImportReport)) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	fn(im.report)
+}
+
+// importJob is a single run of the importer
+type importJob struct {
+	importer *Importer
+	opts     ImportOptions
+	destDir  string
+	people   map[string]uint // person IDs by lower case name or alias
+	placed   int
+}
+
+func (job *importJob) run() error {
+	log.Printf("Import: Importing %s into %s", job.opts.Source, job.opts.Destination)
+	job.broadcast("started", nil)
+
+	err := job.loadPeople()
+	if err == nil {
+		err = job.walk(takeoutPhotosRoot(job.opts.Source))
+	}
+
+	var report ImportReport
+	job.importer.update(func(r *ImportReport) {
+		r.FinishedAt = time.Now().Unix()
+		r.State = "completed"
+		if err != nil {
+			r.State = "failed"
+			r.Error = err.Error()
+		}
+		report = *r
+	})
+	if err != nil {
+		log.Printf("Import: Import of %s failed: %v", job.opts.Source, err)
+		job.broadcast("failed", map[string]interface{}{"error": err.Error()})
+		return err
+	}
+	log.Printf("Import: Imported %d file(s) (%d already present) and created %d album(s) from %s; %d task(s) queued",
+		report.Files, report.Existing, report.AlbumsCreated, job.opts.Source, report.TasksQueued)
+	job.broadcast("completed", nil)
+	return nil
+}
+
+// loadPeople indexes the existing people by name and alias, so sidecar names map to them
+func (job *importJob) loadPeople() error {
+	people, err := job.importer.PersonRepo.ListAll(true)
+	if err != nil {
+		return fmt.Errorf("failed to list people: %w", err)
+	}
+	for _, person := range people {
+		job.people[strings.ToLower(person.PrimaryName)] = person.ID
+		for _, alias := range person.Aliases {
+			if _, taken := job.people[strings.ToLower(alias.Name)]; !taken {
+				job.people[strings.ToLower(alias.Name)] = person.ID
+			}
+		}
+	}
+	return nil
+}
+
+// walk imports the folders below root, each into the same folder below the destination
+func (job *importJob) walk(root string) error {
+	return filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			job.fail(fmt.Errorf("failed to read %s: %w", dir, err))
+			if d != nil && d.IsDir() && dir != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if dir != root && job.importer.Processor.Config.IsIgnored(d.Name()) {
+			return filepath.SkipDir
+		}
+		if job.importer.Processor.stopping() {
+			return errProcessorStopping
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		return job.importFolder(dir, filepath.Join(job.destDir, rel))
+	})
+}
+
+// importFolder places the media files of a folder in target, applies their sidecars and
+// creates an album for the folder if it is an album of the export
+func (job *importJob) importFolder(dir, target string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		job.fail(fmt.Errorf("failed to list %s: %w", dir, err))
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !job.importer.Processor.Config.IsIgnored(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var mediaNames []string
+	for _, name := range names {
+		if strings.EqualFold(filepath.Ext(name), ".json") {
+			continue
+		}
+		if mediaTypeOf(name) == "" {
+			job.importer.update(func(r *ImportReport) { r.Unsupported++ })
+			continue
+		}
+		mediaNames = append(mediaNames, name)
+	}
+	album := readTakeoutAlbumMetadata(dir)
+	if len(mediaNames) == 0 && album == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	if album != nil {
+		job.ensureAlbum(target, album)
+	}
+
+	sidecars := readTakeoutSidecars(dir, names)
+	for _, name := range mediaNames {
+		if job.importer.Processor.stopping() {
+			return errProcessorStopping
+		}
+		job.importFile(filepath.Join(dir, name), target, sidecars.find(name))
+	}
+	return nil
+}
+
+// importFile places a file in the target folder, stores what its sidecar says about it and
+// queues its processing
+func (job *importJob) importFile(src, target string, sidecar *takeoutSidecar) {
+	ip := job.importer.Processor
+	fullPath, existing, err := job.place(src, target)
+	if err != nil {
+		job.fail(fmt.Errorf("failed to import %s: %w", src, err))
+		return
+	}
+	relPath, err := ip.Config.RelativePath(fullPath)
+	if err != nil {
+		job.fail(err)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		job.fail(err)
+		return
+	}
+	modTime := info.ModTime().Unix()
+	mediaType := mediaTypeOf(fullPath)
+
+	switch mediaType {
+	case database.MediaTypeVideo:
+		_, err = ip.ImageRepo.EnsureVideoExists(relPath, modTime, job.opts.UserID, ip.Config.VideoTranscodeEnabled)
+	case database.MediaTypeDocument:
+		_, err = ip.ImageRepo.EnsureDocumentExists(relPath, modTime, job.opts.UserID)
+	default:
+		_, err = ip.ImageRepo.EnsureExistsWithUploader(relPath, modTime, job.opts.UserID)
+	}
+	if err != nil {
+		job.fail(fmt.Errorf("failed to create the record of %s: %w", relPath, err))
+		return
+	}
+	if sidecar != nil {
+		if err := ip.ImageRepo.SetImportedMetadata(relPath, job.importedMetadata(sidecar)); err != nil {
+			job.fail(err)
+		}
+	}
+
+	queued, err := ip.queueStaleTasks(fullPath, relPath, modTime, mediaType)
+	if err != nil && !errors.Is(err, errProcessorStopping) {
+		job.fail(fmt.Errorf("failed to queue the processing of %s: %w", relPath, err))
+	}
+	job.importer.update(func(r *ImportReport) {
+		if existing {
+			r.Existing++
+		} else {
+			r.Files++
+		}
+		if sidecar != nil {
+			r.WithSidecar++
+		}
+		r.TasksQueued += queued
+	})
+	job.placed++
+	if job.placed%importProgressEvery == 0 {
+		job.broadcast("progress", nil)
+	}
+}
+
+// place copies or moves src into the target folder. a file of the same name and size is
+// taken to be src imported before; other files of the same name get a numbered name.
+// returns the path of the file and whether it was already there.
+func (job *importJob) place(src, target string) (string, bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", false, err
+	}
+	ext := filepath.Ext(src)
+	stem := strings.TrimSuffix(filepath.Base(src), ext)
+	dst := filepath.Join(target, filepath.Base(src))
+	for n := 1; ; n++ {
+		info, err := os.Stat(dst)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if info.Size() == srcInfo.Size() {
+			if job.opts.Move {
+				os.Remove(src)
+			}
+			return dst, true, nil
+		}
+		dst = filepath.Join(target, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+	}
+
+	if job.opts.Move {
+		if err := os.Rename(src, dst); err == nil {
+			return dst, false, nil
+		}
+		// e.g. across file systems
+	}
+	if err := copyImportFile(src, dst, srcInfo); err != nil {
+		return "", false, err
+	}
+	if job.opts.Move {
+		if err := os.Remove(src); err != nil {
+			log.Printf("Import: Copied %s but failed to remove it: %v", src, err)
+		}
+	}
+	return dst, false, nil
+}
+
+// copyImportFile copies src to the new file dst, keeping its modification time
+func copyImportFile(src, dst string, srcInfo fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+}
+
+// importedMetadata maps a sidecar to the values stored with the file, creating the people it
+// names that no person has as name or alias
+func (job *importJob) importedMetadata(sidecar *takeoutSidecar) repository.ImportedMetadata {
+	meta := repository.ImportedMetadata{TakenAt: sidecar.takenAt()}
+	if description := strings.TrimSpace(sidecar.Description); description != "" {
+		meta.Description = &description
+	}
+	meta.Latitude, meta.Longitude, meta.Altitude = sidecar.position()
+	for _, name := range sidecar.peopleNames() {
+		if id, ok := job.personID(name); ok {
+			meta.PersonIDs = append(meta.PersonIDs, id)
+		}
+	}
+	return meta
+}
+
+// personID returns the person named name, creating them if there is none
+func (job *importJob) personID(name string) (uint, bool) {
+	key := strings.ToLower(name)
+	if id, ok := job.people[key]; ok {
+		return id, true
+	}
+	now := time.Now().Unix()
+	person := &models.Person{PrimaryName: name, CreatedAt: now, UpdatedAt: now}
+	if err := job.importer.PersonRepo.Create(person); err != nil {
+		job.fail(fmt.Errorf("failed to create person %q: %w", name, err))
+		return 0, false
+	}
+	job.people[key] = person.ID
+	job.importer.update(func(r *ImportReport) { r.PeopleCreated++ })
+	return person.ID, true
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ensureAlbum creates a hidden album for an imported album folder, unless the folder has one.
+// albums are hidden so nothing is published before an admin had a look.
+func (job *importJob) ensureAlbum(folder string, meta *takeoutAlbumMetadata) {
+	ip := job.importer.Processor
+	folderPath, err := ip.Config.RelativePath(folder)
+	if err != nil {
+		job.fail(err)
+		return
+	}
+	if _, err := ip.AlbumRepo.GetByFolderPath(folderPath); err == nil {
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		job.fail(err)
+		return
+	}
+
+	name := strings.TrimSpace(meta.Title)
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		slug = "album"
+	}
+	library, _ := ip.Config.SplitPath(folderPath)
+	album := models.Album{FolderPath: folderPath, LibraryID: library.ID, IsHidden: true}
+	if description := strings.TrimSpace(meta.Description); description != "" {
+		album.Description = &description
+	}
+	for attempt := 1; attempt <= maxAlbumNameAttempts; attempt++ {
+		album.ID, album.Name, album.Slug = 0, name, slug
+		if attempt > 1 {
+			album.Name = fmt.Sprintf("%s (%d)", name, attempt)
+			album.Slug = fmt.Sprintf("%s-%d", slug, attempt)
+		}
+		err = ip.AlbumRepo.Create(&album)
+		if err == nil {
+			log.Printf("Import: Created album '%s' for %s", album.Name, folderPath)
+			job.importer.update(func(r *ImportReport) { r.AlbumsCreated++ })
+			return
+		}
+		if !strings.Contains(strings.ToLower(err.Error()), "unique") {
+			break
+		}
+	}
+	job.fail(fmt.Errorf("failed to create album '%s' for %s: %w", name, path.Base(folderPath), err))
+}
+
+// fail records an error that doesn't stop the import
+func (job *importJob) fail(err error) {
+	log.Printf("Import: %v", err)
+	job.importer.update(func(r *ImportReport) {
+		r.ErrorCount++
+		if len(r.Errors) < maxImportErrors {
+			r.Errors = append(r.Errors, err.Error())
+		}
+	})
+}
+
+func (job *importJob) broadcast(status string, extra map[string]interface{}) {
+	hub := job.importer.Processor.Hub
+	if hub == nil {
+		return
+	}
+	report, _ := job.importer.Report()
+	if extra == nil {
+		extra = make(map[string]interface{})
+	}
+	extra["files"] = report.Files
+	extra["existing"] = report.Existing
+	extra["albums_created"] = report.AlbumsCreated
+	extra["error_count"] = report.ErrorCount
+	hub.Broadcast(realtime.Event{
+		Type:      "import",
+		Path:      report.Options.Destination,
+		Status:    status,
+		Extra:     extra,
+		Timestamp: time.Now().Unix(),
+	})
+}
@@ -0,0 +1,246 @@
+package workers
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/realtime"
+)
+
+// IntegrityIssueKind classifies a problem found by VerifyIntegrity
+type IntegrityIssueKind string
+
+const (
+	// the content changed while the modification time did not, i.e. bit-rot or tampering
+	IntegrityChecksumMismatch IntegrityIssueKind = "checksum_mismatch"
+	// the file is gone, but a file with the same content exists elsewhere without a record
+	IntegrityMoved IntegrityIssueKind = "moved"
+	// the file is gone and no copy was found
+	IntegrityMissing IntegrityIssueKind = "missing"
+	// the file has no record yet; the next rescan or folder listing creates one
+	IntegrityUntracked IntegrityIssueKind = "untracked"
+)
+
+// IntegrityIssue is a single problem found by VerifyIntegrity
+type IntegrityIssue struct {
+	Kind         IntegrityIssueKind `json:"kind"`
+	Path         string             `json:"path"`
+	MovedTo      string             `json:"moved_to,omitempty"`
+	ExpectedHash string             `json:"expected_hash,omitempty"`
+	ActualHash   string             `json:"actual_hash,omitempty"`
+}
+
+// IntegrityReport is the outcome of a VerifyIntegrity run
+type IntegrityReport struct {
+	StartedAt  int64                      `json:"started_at"`
+	FinishedAt int64                      `json:"finished_at"`
+	Checked    int                        `json:"checked"` // records whose file was found and hashed
+	Hashed     int                        `json:"hashed"`  // records that had no valid hash yet and got one
+	Counts     map[IntegrityIssueKind]int `json:"counts"`
+	Issues     []IntegrityIssue           `json:"issues"`
+	Error      string                     `json:"error,omitempty"` // set if the run was cut short
+}
+
+// recordContentHash stores the content hash of a processed original, unless the stored hash
+// is newer than the file. hashing problems are logged and do not fail the task.
+func (ip *ImageProcessor) recordContentHash(job ImageJob) {
+	img, err := ip.ImageRepo.GetByPath(job.OriginalRelativePath)
+	if err != nil {
+		log.Printf("Worker: ERROR loading %s to record its content hash: %v", job.OriginalRelativePath, err)
+		return
+	}
+	if img.ContentHash != nil && img.HashedAt != nil && job.ModTimeUnix <= *img.HashedAt {
+		return
+	}
+	hash, size, err := media.FileChecksum(job.OriginalImagePath)
+	if err != nil {
+		log.Printf("Worker: ERROR hashing %s: %v", job.OriginalRelativePath, err)
+		return
+	}
+	if err := ip.ImageRepo.UpdateContentHash(job.OriginalRelativePath, hash, size); err != nil {
+		log.Printf("Worker: ERROR storing content hash for %s: %v", job.OriginalRelativePath, err)
+	}
+}
+
+// LastIntegrityReport returns the report of the most recent VerifyIntegrity run
+func (ip *ImageProcessor) LastIntegrityReport() (IntegrityReport, bool) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	if ip.integrityReport == nil {
+		return IntegrityReport{}, false
+	}
+	return *ip.integrityReport, true
+}
+
+func (ip *ImageProcessor) broadcastIntegrity(status string, path string, extra map[string]interface{}) {
+	if ip.Hub == nil {
+		return
+	}
+	ip.Hub.Broadcast(realtime.Event{
+		Type:      "integrity",
+		Path:      path,
+		Status:    status,
+		Extra:     extra,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// VerifyIntegrity hashes every original and compares the library against the database:
+// files whose content no longer matches their hash, records whose file moved or vanished,
+// and files without a record. records without a valid hash get one. issues are broadcast as
+// they are found and the full report is kept for LastIntegrityReport. returns the number of
+// issues found.
+func (ip *ImageProcessor) VerifyIntegrity() (int, error) {
+	report := IntegrityReport{
+		StartedAt: time.Now().Unix(),
+		Counts:    make(map[IntegrityIssueKind]int),
+		Issues:    []IntegrityIssue{},
+	}
+	ip.broadcastIntegrity("started", "", nil)
+
+	addIssue := func(issue IntegrityIssue) {
+		report.Issues = append(report.Issues, issue)
+		report.Counts[issue.Kind]++
+		log.Printf("Integrity: Found %s file %s", issue.Kind, issue.Path)
+		ip.broadcastIntegrity("issue", issue.Path, map[string]interface{}{
+			"kind":     issue.Kind,
+			"moved_to": issue.MovedTo,
+		})
+	}
+
+	err := ip.verifyIntegrity(&report, addIssue)
+	report.FinishedAt = time.Now().Unix()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	ip.Mutex.Lock()
+	ip.integrityReport = &report
+	ip.Mutex.Unlock()
+
+	ip.broadcastIntegrity("completed", "", map[string]interface{}{
+		"checked": report.Checked,
+		"hashed":  report.Hashed,
+		"counts":  report.Counts,
+		"error":   report.Error,
+	})
+	log.Printf("Integrity: Checked %d file(s), hashed %d, found %d issue(s)", report.Checked, report.Hashed, len(report.Issues))
+	return len(report.Issues), err
+}
+
+type diskFile struct {
+	fullPath string
+	size     int64
+	modTime  int64
+}
+
+func (ip *ImageProcessor) verifyIntegrity(report *IntegrityReport, addIssue func(IntegrityIssue)) error {
+	onDisk := make(map[string]diskFile)
+	err := ip.walkLibrary(func(fullPath, relPath string, info fs.FileInfo, mediaType string) error {
+		onDisk[relPath] = diskFile{fullPath: fullPath, size: info.Size(), modTime: info.ModTime().Unix()}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	images, err := ip.ImageRepo.ListAll()
+	if err != nil {
+		return err
+	}
+
+	var gone []IntegrityIssue // records whose file is gone, with the hash to look for
+	var goneSizes []int64
+	for _, img := range images {
+		if ip.stopping() {
+			return errProcessorStopping
+		}
+
+		file, ok := onDisk[img.OriginalPath]
+		if !ok {
+			fullPath := ip.Config.ResolvePath(img.OriginalPath)
+			if _, statErr := os.Stat(fullPath); !os.IsNotExist(statErr) {
+				continue // outside the walk, e.g. in a hidden or unreadable folder
+			}
+			if img.ContentHash == nil {
+				addIssue(IntegrityIssue{Kind: IntegrityMissing, Path: img.OriginalPath})
+				continue
+			}
+			gone = append(gone, IntegrityIssue{Kind: IntegrityMissing, Path: img.OriginalPath, ExpectedHash: *img.ContentHash})
+			goneSizes = append(goneSizes, sizeOrZero(img.FileSize))
+			continue
+		}
+		delete(onDisk, img.OriginalPath)
+
+		hash, size, err := media.FileChecksum(file.fullPath)
+		if err != nil {
+			log.Printf("Integrity: Failed to hash %s: %v", img.OriginalPath, err)
+			continue
+		}
+		report.Checked++
+
+		// a file saved after it was hashed legitimately has new content
+		if img.ContentHash == nil || img.HashedAt == nil || file.modTime > *img.HashedAt {
+			if err := ip.ImageRepo.UpdateContentHash(img.OriginalPath, hash, size); err != nil {
+				log.Printf("Integrity: Failed to store hash for %s: %v", img.OriginalPath, err)
+				continue
+			}
+			report.Hashed++
+			continue
+		}
+		if hash != *img.ContentHash {
+			addIssue(IntegrityIssue{Kind: IntegrityChecksumMismatch, Path: img.OriginalPath, ExpectedHash: *img.ContentHash, ActualHash: hash})
+		}
+	}
+
+	// files left in onDisk have no record; one of them may be a moved original
+	untracked := make([]string, 0, len(onDisk))
+	for relPath := range onDisk {
+		untracked = append(untracked, relPath)
+	}
+	sort.Strings(untracked)
+	claimed := make(map[string]bool)
+	untrackedHashes := make(map[string]string)
+
+	for i, issue := range gone {
+		for _, relPath := range untracked {
+			file := onDisk[relPath]
+			if claimed[relPath] || (goneSizes[i] > 0 && file.size != goneSizes[i]) {
+				continue
+			}
+			hash, ok := untrackedHashes[relPath]
+			if !ok {
+				var err error
+				if hash, _, err = media.FileChecksum(file.fullPath); err != nil {
+					log.Printf("Integrity: Failed to hash %s: %v", relPath, err)
+				}
+				untrackedHashes[relPath] = hash
+			}
+			if hash != "" && hash == issue.ExpectedHash {
+				claimed[relPath] = true
+				issue.Kind = IntegrityMoved
+				issue.MovedTo = relPath
+				break
+			}
+		}
+		addIssue(issue)
+	}
+
+	for _, relPath := range untracked {
+		if !claimed[relPath] {
+			addIssue(IntegrityIssue{Kind: IntegrityUntracked, Path: relPath})
+		}
+	}
+	return nil
+}
+
+func sizeOrZero(size *int64) int64 {
+	if size == nil {
+		return 0
+	}
+	return *size
+}
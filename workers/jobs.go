@@ -0,0 +1,387 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobState describes where a job is in its lifecycle
+type JobState string
+
+const (
+	JobStateQueued     JobState = "queued"
+	JobStateProcessing JobState = "processing"
+	JobStateRetrying   JobState = "retrying" // failed, waiting for its backoff before the next attempt
+	JobStateCompleted  JobState = "completed"
+	JobStateFailed     JobState = "failed"
+	JobStateCancelled  JobState = "cancelled"
+)
+
+// finished jobs are kept around so failures can be inspected and retried; the oldest
+// are dropped once this many have accumulated
+const maxFinishedJobs = 500
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobNotCancellable = errors.New("only queued or retrying jobs can be cancelled")
+	ErrJobNotRetryable   = errors.New("only failed or cancelled jobs can be retried")
+	ErrJobAlreadyPending = errors.New("task is already queued or processing")
+	ErrJobQueueFull      = errors.New("job queue is full")
+	ErrFolderBusy        = errors.New("files in this folder are being processed")
+	ErrAlbumArchived     = errors.New("the album of this file is archived")
+)
+
+// JobRecord tracks a single queued task and its outcome
+type JobRecord struct {
+	ID            string   `json:"id"`
+	TaskType      string   `json:"task_type"`
+	Path          string   `json:"path,omitempty"`
+	AlbumID       int64    `json:"album_id,omitempty"`
+	State         JobState `json:"state"`
+	Error         string   `json:"error,omitempty"`
+	Attempt       int      `json:"attempt"`
+	Priority      string   `json:"priority"`
+	QueuedAt      int64    `json:"queued_at"`
+	StartedAt     *int64   `json:"started_at,omitempty"`
+	FinishedAt    *int64   `json:"finished_at,omitempty"`
+	NextAttemptAt *int64   `json:"next_attempt_at,omitempty"` // set while retrying
+	RetryOf       string   `json:"retry_of,omitempty"`        // ID of the job this one retries
+
+	job        ImageJob
+	retryTimer *time.Timer
+}
+
+// isAlbumTask reports whether a job works on an album, identified by its AlbumID, rather than
+// on a file
+func (job ImageJob) isAlbumTask() bool {
+	return job.TaskType == TaskAlbumZip || job.TaskType == TaskAlbumContactSheet
+}
+
+// pendingKey identifies the entity/task pair a job works on, so the same task is never queued twice
+func (job ImageJob) pendingKey() string {
+	if job.isAlbumTask() {
+		return fmt.Sprintf("album_%d:%s", job.AlbumID, job.TaskType)
+	}
+	return fmt.Sprintf("%s:%s", job.OriginalRelativePath, job.TaskType)
+}
+
+// ListJobs returns tracked jobs, newest first. an empty state returns jobs in every state.
+func (ip *ImageProcessor) ListJobs(state JobState) []JobRecord {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	jobs := make([]JobRecord, 0, len(ip.Jobs))
+	for _, rec := range ip.Jobs {
+		if state == "" || rec.State == state {
+			jobs = append(jobs, *rec)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].QueuedAt > jobs[j].QueuedAt
+	})
+	return jobs
+}
+
+// QueueStats summarizes the work queues for the admin dashboard
+type QueueStats struct {
+	Depth       map[string]int   `json:"depth"`        // jobs waiting in each priority lane
+	States      map[JobState]int `json:"states"`       // tracked jobs in each state
+	FailedTasks map[string]int   `json:"failed_tasks"` // tracked failed jobs, by task type
+}
+
+// QueueStats returns the depth of each priority lane and counts the tracked jobs
+func (ip *ImageProcessor) QueueStats() QueueStats {
+	stats := QueueStats{
+		Depth: map[string]int{
+			"high":   len(ip.HighQueue),
+			"normal": len(ip.JobQueue),
+			"low":    len(ip.LowQueue),
+		},
+		States:      make(map[JobState]int),
+		FailedTasks: make(map[string]int),
+	}
+
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	for _, rec := range ip.Jobs {
+		stats.States[rec.State]++
+		if rec.State == JobStateFailed {
+			stats.FailedTasks[rec.TaskType]++
+		}
+	}
+	return stats
+}
+
+// GetJob returns a copy of a tracked job
+func (ip *ImageProcessor) GetJob(id string) (JobRecord, error) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	rec, ok := ip.Jobs[id]
+	if !ok {
+		return JobRecord{}, ErrJobNotFound
+	}
+	return *rec, nil
+}
+
+// CancelJob cancels a job that has not started yet or is waiting to be retried. a queued
+// job stays in the queue channel but is skipped when a worker picks it up.
+func (ip *ImageProcessor) CancelJob(id string) (JobRecord, error) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	rec, ok := ip.Jobs[id]
+	if !ok {
+		return JobRecord{}, ErrJobNotFound
+	}
+	if rec.State != JobStateQueued && rec.State != JobStateRetrying {
+		return *rec, ErrJobNotCancellable
+	}
+
+	ip.cancelLocked(rec)
+	ip.pruneFinishedJobsLocked()
+	return *rec, nil
+}
+
+// CancelJobsForPath cancels the queued and retrying jobs of a file, e.g. before the file is
+// moved or deleted. returns the number of jobs cancelled.
+func (ip *ImageProcessor) CancelJobsForPath(relPath string) int {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	cancelled := 0
+	for _, rec := range ip.Jobs {
+		if rec.Path == relPath && (rec.State == JobStateQueued || rec.State == JobStateRetrying) {
+			ip.cancelLocked(rec)
+			cancelled++
+		}
+	}
+	if cancelled > 0 {
+		ip.pruneFinishedJobsLocked()
+	}
+	return cancelled
+}
+
+// CancelJobsForFolder cancels the queued and retrying jobs of every file under a folder, e.g.
+// before the folder is renamed. it fails without cancelling anything while a file of the
+// folder is being processed. returns the distinct paths that had jobs cancelled.
+func (ip *ImageProcessor) CancelJobsForFolder(folderPath string) ([]string, error) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	prefix := strings.TrimSuffix(folderPath, "/") + "/"
+	for _, rec := range ip.Jobs {
+		if rec.State == JobStateProcessing && strings.HasPrefix(rec.Path, prefix) {
+			return nil, ErrFolderBusy
+		}
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, rec := range ip.Jobs {
+		if !strings.HasPrefix(rec.Path, prefix) || (rec.State != JobStateQueued && rec.State != JobStateRetrying) {
+			continue
+		}
+		ip.cancelLocked(rec)
+		if !seen[rec.Path] {
+			seen[rec.Path] = true
+			paths = append(paths, rec.Path)
+		}
+	}
+	if len(paths) > 0 {
+		ip.pruneFinishedJobsLocked()
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// cancelLocked marks a queued or retrying job cancelled. ip.Mutex must be held.
+func (ip *ImageProcessor) cancelLocked(rec *JobRecord) {
+	if rec.retryTimer != nil {
+		rec.retryTimer.Stop()
+		rec.retryTimer = nil
+	}
+	now := time.Now().Unix()
+	rec.State = JobStateCancelled
+	rec.FinishedAt = &now
+	rec.NextAttemptAt = nil
+	ip.releasePendingLocked(rec.job)
+	if rec.job.TaskType == TaskFaceEmbedding {
+		ip.faceEmbeddingFinishedLocked(rec.job, true)
+	}
+}
+
+// RetryJob queues a failed or cancelled job again as a new job
+func (ip *ImageProcessor) RetryJob(id string) (JobRecord, error) {
+	ip.Mutex.Lock()
+	rec, ok := ip.Jobs[id]
+	if !ok {
+		ip.Mutex.Unlock()
+		return JobRecord{}, ErrJobNotFound
+	}
+	if rec.State != JobStateFailed && rec.State != JobStateCancelled {
+		ip.Mutex.Unlock()
+		return *rec, ErrJobNotRetryable
+	}
+	job := rec.job
+	ip.Mutex.Unlock()
+
+	job.ID = ""
+	job.Attempt = 0
+	newRec, err := ip.enqueue(job, id)
+	if err != nil {
+		return JobRecord{}, err
+	}
+	return newRec, nil
+}
+
+// enqueue registers and queues a job. retryOf is the ID of the job being retried, if any.
+// if the same task is already queued at a lower priority, the queued copy is superseded
+// so the task is promoted to the new lane.
+func (ip *ImageProcessor) enqueue(job ImageJob, retryOf string) (JobRecord, error) {
+	pendingKey := job.pendingKey()
+	if job.ID == "" {
+		job.ID = uuid.NewString()
+	}
+	if job.Attempt < 1 {
+		job.Attempt = 1
+	}
+
+	ip.Mutex.Lock()
+	// archived albums are read-only, so their files aren't processed again. their archives
+	// and contact sheets can still be built.
+	if !job.isAlbumTask() && ip.inArchivedAlbumLocked(job.OriginalRelativePath) {
+		ip.Mutex.Unlock()
+		return JobRecord{}, ErrAlbumArchived
+	}
+	var superseded *JobRecord
+	if existingID, pending := ip.Pending[pendingKey]; pending {
+		existing := ip.Jobs[existingID]
+		if existing == nil || existing.State != JobStateQueued || job.Priority.rank() <= existing.job.Priority.rank() {
+			ip.Mutex.Unlock()
+			return JobRecord{}, ErrJobAlreadyPending
+		}
+		// workers skip cancelled jobs, so the lower priority copy is dropped when dequeued
+		superseded = existing
+		superseded.State = JobStateCancelled
+		superseded.Error = "superseded by higher priority job " + job.ID
+	}
+	ip.Pending[pendingKey] = job.ID
+	rec := &JobRecord{
+		ID:       job.ID,
+		TaskType: job.TaskType,
+		Path:     job.OriginalRelativePath,
+		AlbumID:  job.AlbumID,
+		State:    JobStateQueued,
+		Attempt:  job.Attempt,
+		Priority: job.Priority.String(),
+		QueuedAt: time.Now().Unix(),
+		RetryOf:  retryOf,
+		job:      job,
+	}
+	ip.Jobs[job.ID] = rec
+
+	// the send must not block while holding the mutex, workers need it to finish jobs
+	select {
+	case ip.queueFor(job.Priority) <- job:
+		if superseded != nil {
+			now := time.Now().Unix()
+			superseded.FinishedAt = &now
+		}
+		ip.Mutex.Unlock()
+		return *rec, nil
+	default:
+		delete(ip.Jobs, job.ID)
+		delete(ip.Pending, pendingKey)
+		if superseded != nil {
+			// keep the original copy, it is still in its lane
+			superseded.State = JobStateQueued
+			superseded.Error = ""
+			ip.Pending[pendingKey] = superseded.ID
+		}
+		ip.Mutex.Unlock()
+		return JobRecord{}, ErrJobQueueFull
+	}
+}
+
+// releasePendingLocked frees the pending key of a job, unless another job holds it by now.
+// ip.Mutex must be held.
+func (ip *ImageProcessor) releasePendingLocked(job ImageJob) {
+	key := job.pendingKey()
+	if ip.Pending[key] == job.ID {
+		delete(ip.Pending, key)
+	}
+}
+
+// startJob marks a dequeued job as processing. returns false if it was cancelled while queued.
+func (ip *ImageProcessor) startJob(job ImageJob) bool {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	rec, ok := ip.Jobs[job.ID]
+	if !ok {
+		return true // untracked job, process it anyway
+	}
+	if rec.State == JobStateCancelled {
+		return false
+	}
+	now := time.Now().Unix()
+	rec.State = JobStateProcessing
+	rec.StartedAt = &now
+	return true
+}
+
+// finishJob records the outcome of a job. failed jobs with attempts left are scheduled
+// for a retry and keep their pending key; otherwise the pending key is released. returns
+// whether a retry was scheduled.
+func (ip *ImageProcessor) finishJob(job ImageJob, taskErr error) bool {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	rec, ok := ip.Jobs[job.ID]
+	if taskErr != nil && ok && ip.scheduleRetryLocked(rec, taskErr) {
+		return true
+	}
+
+	ip.releasePendingLocked(job)
+	if job.TaskType == TaskFaceEmbedding {
+		ip.faceEmbeddingFinishedLocked(job, taskErr != nil)
+	}
+	if !ok {
+		return false
+	}
+	now := time.Now().Unix()
+	rec.FinishedAt = &now
+	if taskErr != nil {
+		rec.State = JobStateFailed
+		rec.Error = taskErr.Error()
+	} else {
+		rec.State = JobStateCompleted
+	}
+	ip.pruneFinishedJobsLocked()
+	return false
+}
+
+// pruneFinishedJobsLocked drops the oldest finished jobs beyond maxFinishedJobs. ip.Mutex must be held.
+func (ip *ImageProcessor) pruneFinishedJobsLocked() {
+	var finished []*JobRecord
+	for _, rec := range ip.Jobs {
+		if rec.FinishedAt != nil {
+			finished = append(finished, rec)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return *finished[i].FinishedAt < *finished[j].FinishedAt
+	})
+	for _, rec := range finished[:len(finished)-maxFinishedJobs] {
+		delete(ip.Jobs, rec.ID)
+	}
+}
@@ -0,0 +1,44 @@
+package workers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// livePhotoPartner returns the other half of the Live Photo the file at relPath is half of,
+// or nil if it isn't one or the other half hasn't been processed yet
+func (ip *ImageProcessor) livePhotoPartner(relPath, mediaType string, contentID *string) *models.Image {
+	if contentID == nil {
+		return nil
+	}
+	partner, err := ip.ImageRepo.FindLivePhotoPartner(relPath, mediaType, *contentID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Worker: Failed to look up the Live Photo partner of %s: %v", relPath, err)
+		}
+		return nil
+	}
+	return partner
+}
+
+// pairLivePhoto pairs a still or video with the other half of its Live Photo once its content
+// identifier was stored. whichever half is processed last finds the other.
+func (ip *ImageProcessor) pairLivePhoto(relPath, mediaType string, contentID *string) {
+	partner := ip.livePhotoPartner(relPath, mediaType, contentID)
+	if partner == nil {
+		return
+	}
+	stillPath, videoPath := relPath, partner.OriginalPath
+	if mediaType == database.MediaTypeVideo {
+		stillPath, videoPath = partner.OriginalPath, relPath
+	}
+	if err := ip.ImageRepo.SetLivePair(stillPath, videoPath); err != nil {
+		log.Printf("Worker: Failed to pair Live Photo %s with %s: %v", stillPath, videoPath, err)
+		return
+	}
+	log.Printf("Worker: Paired Live Photo %s with its video %s", stillPath, videoPath)
+}
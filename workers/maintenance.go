@@ -0,0 +1,523 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+	"github.com/camden-git/mediasysbackend/models"
+	"gorm.io/gorm"
+)
+
+// names of the periodic maintenance tasks run by the Scheduler
+const (
+	MaintenanceLibraryRescan          = "library_rescan"
+	MaintenanceOrphanCleanup          = "orphan_cleanup"
+	MaintenanceZipRefresh             = "zip_refresh"
+	MaintenanceEmbeddingBackfill      = "embedding_backfill"
+	MaintenanceIntegrityCheck         = "integrity_check"
+	MaintenanceGeocodeBackfill        = "geocode_backfill"
+	MaintenanceFaceClustering         = "face_clustering"  // run by the face recognition service
+	MaintenanceFaceSuggestions        = "face_suggestions" // run by the face recognition service
+	MaintenanceClassificationBackfill = "classification_backfill"
+	MaintenanceOCRBackfill            = "ocr_backfill"
+	MaintenanceNSFWBackfill           = "nsfw_backfill"
+	MaintenanceFaceEmbedding          = "face_embedding" // manual only, has no schedule setting
+)
+
+var errProcessorStopping = errors.New("image processor is stopping")
+
+// waitForLowLane blocks until the low priority lane has room, so bulk maintenance work
+// queues everything instead of overflowing the lane. returns false once Stop is called.
+func (ip *ImageProcessor) waitForLowLane() bool {
+	for len(ip.LowQueue) >= cap(ip.LowQueue) {
+		select {
+		case <-ip.StopChan:
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return !ip.stopping()
+}
+
+// stopping reports whether Stop has been called
+func (ip *ImageProcessor) stopping() bool {
+	select {
+	case <-ip.StopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// mediaTypeOf returns the database media type of a file by its name, or "" for files that
+// aren't processed
+func mediaTypeOf(name string) string {
+	switch {
+	case media.IsVideo(name):
+		return database.MediaTypeVideo
+	case media.IsDocument(name):
+		return database.MediaTypeDocument
+	case media.IsProcessableImage(name):
+		return database.MediaTypeImage
+	default:
+		return ""
+	}
+}
+
+// walkLibrary calls fn for every image, video and document in every library, skipping
+// ignored entries and the media storage directory. unreadable paths are logged and skipped;
+// an error returned by fn stops the walk.
+func (ip *ImageProcessor) walkLibrary(fn func(fullPath, relPath string, info fs.FileInfo, mediaType string) error) error {
+	roots := []string{ip.Config.RootDirectory}
+	for _, lib := range ip.Config.ExtraLibraries() {
+		roots = append(roots, lib.Path)
+	}
+	for _, root := range roots {
+		if err := ip.walkRoot(root, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoot is walkLibrary for a single root directory
+func (ip *ImageProcessor) walkRoot(root string, fn func(fullPath, relPath string, info fs.FileInfo, mediaType string) error) error {
+	mediaStorage := filepath.Clean(ip.Config.MediaStoragePath)
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			log.Printf("Library walk: Skipping unreadable path %s: %v", path, walkErr)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (ip.Config.IsIgnored(d.Name()) || filepath.Clean(path) == mediaStorage) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ip.Config.IsIgnored(d.Name()) {
+			return nil
+		}
+		mediaType := mediaTypeOf(d.Name())
+		if mediaType == "" {
+			return nil
+		}
+		// symlinked files are followed as the symlink policy allows. symlinked folders aren't
+		// walked into, their files are found when the folder is listed.
+		var info fs.FileInfo
+		var err error
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !ip.Config.AllowsSymlink(path) {
+				return nil
+			}
+			info, err = os.Stat(path)
+		} else {
+			info, err = d.Info()
+		}
+		if err != nil {
+			log.Printf("Library walk: Failed to stat %s: %v", path, err)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := ip.Config.RelativePath(path)
+		if err != nil {
+			return nil
+		}
+		return fn(path, relPath, info, mediaType)
+	})
+}
+
+// RescanLibrary walks the whole library, creating records for new files and queuing every
+// task that is missing or stale, the same way a folder listing does. returns the number of
+// tasks queued.
+func (ip *ImageProcessor) RescanLibrary() (int, error) {
+	queued := 0
+	err := ip.walkLibrary(func(fullPath, relPath string, info fs.FileInfo, mediaType string) error {
+		n, err := ip.queueStaleTasks(fullPath, relPath, info.ModTime().Unix(), mediaType)
+		queued += n
+		if errors.Is(err, errProcessorStopping) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Rescan: Failed to check %s: %v", relPath, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return queued, err
+	}
+	log.Printf("Rescan: Queued %d task(s)", queued)
+	return queued, nil
+}
+
+// staleTasks ensures a record exists for a media file and returns its missing or stale tasks
+func (ip *ImageProcessor) staleTasks(dbKey string, modTime int64, mediaType string) ([]string, error) {
+	img, err := ip.ImageRepo.GetByPath(dbKey)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		switch mediaType {
+		case database.MediaTypeVideo:
+			_, err = ip.ImageRepo.EnsureVideoExists(dbKey, modTime, nil, ip.Config.VideoTranscodeEnabled)
+		case database.MediaTypeDocument:
+			_, err = ip.ImageRepo.EnsureDocumentExists(dbKey, modTime, nil)
+		default:
+			_, err = ip.ImageRepo.EnsureExists(dbKey, modTime)
+		}
+		if err != nil {
+			return nil, err
+		}
+		img, err = ip.ImageRepo.GetByPath(dbKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changed := modTime > img.LastModified
+	maxAttempts := ip.Config.WorkerMaxAttempts
+	var tasks []string
+	if mediaType == database.MediaTypeDocument {
+		if changed || TaskNeedsProcessing(img.ThumbnailStatus, img.ThumbnailAttempts, maxAttempts) {
+			tasks = append(tasks, TaskDocumentThumbnail)
+		}
+		return tasks, nil
+	}
+	if mediaType == database.MediaTypeVideo {
+		if changed || TaskNeedsProcessing(img.ThumbnailStatus, img.ThumbnailAttempts, maxAttempts) {
+			tasks = append(tasks, TaskVideoThumbnail)
+		}
+		if ip.Config.VideoTranscodeEnabled && (changed || TaskNeedsProcessing(img.TranscodeStatus, img.TranscodeAttempts, maxAttempts)) {
+			tasks = append(tasks, TaskVideoTranscode)
+		}
+		// whether a video is streamed is decided once it was probed, see scheduleStream
+		if ip.Config.VideoHLSEnabled && !changed && TaskNeedsProcessing(img.StreamStatus, img.StreamAttempts, maxAttempts) {
+			tasks = append(tasks, TaskVideoStream)
+		}
+		return tasks, nil
+	}
+	if changed || TaskNeedsProcessing(img.ThumbnailStatus, img.ThumbnailAttempts, maxAttempts) {
+		tasks = append(tasks, TaskThumbnail)
+	}
+	if changed || TaskNeedsProcessing(img.MetadataStatus, img.MetadataAttempts, maxAttempts) {
+		tasks = append(tasks, TaskMetadata)
+	}
+	if changed || TaskNeedsProcessing(img.DetectionStatus, img.DetectionAttempts, maxAttempts) {
+		tasks = append(tasks, TaskDetection)
+	}
+	return tasks, nil
+}
+
+// queueStaleTasks queues the missing or stale tasks of a media file in the low priority
+// lane, waiting for room when it is full
+func (ip *ImageProcessor) queueStaleTasks(fullPath, dbKey string, modTime int64, mediaType string) (int, error) {
+	tasks, err := ip.staleTasks(dbKey, modTime, mediaType)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, taskType := range tasks {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		job := ImageJob{
+			OriginalImagePath:    fullPath,
+			OriginalRelativePath: dbKey,
+			ModTimeUnix:          modTime,
+			TaskType:             taskType,
+			Priority:             PriorityLow,
+		}
+		if ip.QueueJob(job) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// QueueStaleTasks ensures a record exists for a library file and queues its missing or stale
+// tasks without waiting for queue space, e.g. after the file was moved or copied.
+// returns the number of tasks queued.
+func (ip *ImageProcessor) QueueStaleTasks(relPath string, priority JobPriority) (int, error) {
+	fullPath := ip.Config.ResolvePath(relPath)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	modTime := info.ModTime().Unix()
+	tasks, err := ip.staleTasks(relPath, modTime, mediaTypeOf(relPath))
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, taskType := range tasks {
+		job := ImageJob{
+			OriginalImagePath:    fullPath,
+			OriginalRelativePath: relPath,
+			ModTimeUnix:          modTime,
+			TaskType:             taskType,
+			Priority:             priority,
+		}
+		if ip.QueueJob(job) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// CleanupOrphans removes the records, faces and generated assets of media files that no
+// longer exist on disk, or that are ignored, e.g. indexed before a pattern was added to
+// IGNORE_PATTERNS. returns the number of records removed.
+//
+// an unmounted library looks like every one of its files was deleted, so missing files are
+// only removed from libraries whose root is a readable, non-empty directory, and not at all
+// from a library missing more than ORPHAN_CLEANUP_MAX_PERCENT of its files.
+func (ip *ImageProcessor) CleanupOrphans() (int, error) {
+	images, err := ip.ImageRepo.ListAll()
+	if err != nil {
+		return 0, err
+	}
+	store, err := media.NewStoreFromConfig(ip.Config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to initialize media store: %w", err)
+	}
+
+	type libraryFiles struct {
+		available bool
+		total     int
+		missing   int
+	}
+	libraries := make(map[string]*libraryFiles)
+	var orphans []models.Image
+	for _, img := range images {
+		if ip.stopping() {
+			return 0, errProcessorStopping
+		}
+		if ip.Config.IsIgnoredPath(img.OriginalPath) {
+			orphans = append(orphans, img)
+			continue
+		}
+		library, _ := ip.Config.SplitPath(img.OriginalPath)
+		files, ok := libraries[library.ID]
+		if !ok {
+			files = &libraryFiles{}
+			if err := checkLibraryRoot(library.Path); err != nil {
+				log.Printf("Orphan cleanup: Skipping missing files of library '%s': %v", library.ID, err)
+			} else {
+				files.available = true
+			}
+			libraries[library.ID] = files
+		}
+		files.total++
+		if !files.available {
+			continue
+		}
+		if _, err := os.Stat(ip.Config.ResolvePath(img.OriginalPath)); !os.IsNotExist(err) {
+			continue // still there, or the check failed and the record is kept to be safe
+		}
+		files.missing++
+		orphans = append(orphans, img)
+	}
+
+	maxPercent := ip.Config.OrphanCleanupMaxPercent
+	for id, files := range libraries {
+		if files.missing > 0 && maxPercent < 100 && files.missing*100 > files.total*maxPercent {
+			log.Printf("Orphan cleanup: Skipping library '%s': %d of its %d files are missing, more than the %d%% ORPHAN_CLEANUP_MAX_PERCENT allows", id, files.missing, files.total, maxPercent)
+			files.available = false
+		}
+	}
+
+	removed := 0
+	for _, img := range orphans {
+		if ip.stopping() {
+			return removed, errProcessorStopping
+		}
+		ignored := ip.Config.IsIgnoredPath(img.OriginalPath)
+		if library, _ := ip.Config.SplitPath(img.OriginalPath); !ignored && !libraries[library.ID].available {
+			continue
+		}
+
+		for _, asset := range img.AssetPaths() {
+			if err := store.Delete(asset); err != nil {
+				log.Printf("Orphan cleanup: Failed to delete asset %s of %s: %v", asset, img.OriginalPath, err)
+			}
+		}
+		if err := ip.ImageRepo.DeleteWithFaces(img.OriginalPath); err != nil {
+			return removed, err
+		}
+		removed++
+		if ignored {
+			log.Printf("Orphan cleanup: Removed record of ignored file %s", img.OriginalPath)
+		} else {
+			log.Printf("Orphan cleanup: Removed record of missing file %s", img.OriginalPath)
+		}
+	}
+	log.Printf("Orphan cleanup: Removed %d record(s)", removed)
+	return removed, nil
+}
+
+// checkLibraryRoot fails unless the root of a library is a directory that can be read and
+// holds at least one entry, as the mount point of an unmounted disk is often left empty
+func checkLibraryRoot(root string) error {
+	dir, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("library root %s is empty", root)
+		}
+		return fmt.Errorf("failed to read library root %s: %w", root, err)
+	}
+	return nil
+}
+
+// RefreshAlbumZips regenerates album archives whose folder has changed since the archive
+// was built. returns the number of archives queued.
+func (ip *ImageProcessor) RefreshAlbumZips() (int, error) {
+	albums, err := ip.AlbumRepo.ListAllAdmin()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, album := range albums {
+		if album.ZipStatus != database.StatusDone || album.ZipLastGeneratedAt == nil {
+			continue
+		}
+		stale, err := ip.folderChangedSince(album.FolderPath, *album.ZipLastGeneratedAt)
+		if err != nil {
+			log.Printf("Zip refresh: Failed to check folder of album %d: %v", album.ID, err)
+			continue
+		}
+		if !stale {
+			continue
+		}
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if err := ip.AlbumRepo.RequestZip(album.ID); err != nil {
+			return queued, err
+		}
+		job := ImageJob{
+			AlbumID:     int64(album.ID),
+			TaskType:    TaskAlbumZip,
+			ModTimeUnix: time.Now().Unix(),
+			Priority:    PriorityLow,
+		}
+		if ip.QueueJob(job) {
+			queued++
+		}
+	}
+	log.Printf("Zip refresh: Queued %d album archive(s)", queued)
+	return queued, nil
+}
+
+// folderChangedSince reports whether any file or directory under an album folder was
+// modified after the given unix time. directory times catch files that were removed.
+func (ip *ImageProcessor) folderChangedSince(folderPath string, since int64) (bool, error) {
+	root := ip.Config.ResolvePath(folderPath)
+	changed := false
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path != root && ip.Config.IsIgnored(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Unix() > since {
+			changed = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// BackfillEmbeddings queues embedding of faces that have no embedding from the current
+// recognition model, so they can take part in recognition, and, when CLIP is enabled, CLIP
+// embedding of images that have no embedding or a stale one. returns the number of tasks
+// queued.
+func (ip *ImageProcessor) BackfillEmbeddings() (int, error) {
+	queued := 0
+	if ip.Config.FaceRecognitionEnabled {
+		n, err := ip.ReembedFaces()
+		queued += n
+		if errors.Is(err, ErrFaceEmbeddingRunning) {
+			log.Printf("Embedding backfill: Face embedding is already running, skipping faces")
+		} else if err != nil {
+			return queued, err
+		}
+	}
+	if ip.Config.CLIPEnabled {
+		n, err := ip.backfillCLIPEmbeddings()
+		queued += n
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// backfillCLIPEmbeddings queues CLIP embedding of images missing an up to date embedding
+func (ip *ImageProcessor) backfillCLIPEmbeddings() (int, error) {
+	images, err := ip.EmbeddingRepo.ListImagesMissingEmbeddings()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if ip.queueCLIPEmbedding(img.OriginalPath, img.LastModified) {
+			queued++
+		}
+	}
+	log.Printf("Embedding backfill: Queued CLIP embedding for %d image(s)", queued)
+	return queued, nil
+}
+
+// BackfillLocations queues reverse geocoding of the geotagged images that have no place name
+// yet, e.g. those processed before geocoding was enabled. returns the number of tasks queued.
+func (ip *ImageProcessor) BackfillLocations() (int, error) {
+	if ip.Geocoder == nil {
+		return 0, nil
+	}
+	images, err := ip.ImageRepo.ListImagesMissingLocation()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if ip.queueGeocode(img.OriginalPath, img.LastModified) {
+			queued++
+		}
+	}
+	log.Printf("Geocode backfill: Queued geocoding for %d image(s)", queued)
+	return queued, nil
+}
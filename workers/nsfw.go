@@ -0,0 +1,104 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/media"
+	"gocv.io/x/gocv"
+)
+
+// NSFWThreshold returns the NSFW score at which images are flagged for review
+func (ip *ImageProcessor) NSFWThreshold() float32 {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	return ip.nsfwThreshold
+}
+
+// SetNSFWThreshold changes the NSFW score at which images are flagged, from the next NSFW
+// task on. existing flags are kept until their images are scored again.
+func (ip *ImageProcessor) SetNSFWThreshold(threshold float32) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.nsfwThreshold = threshold
+}
+
+// processNSFWTask scores an image with the NSFW detector and flags it for review if it
+// scores at least the threshold
+func (ip *ImageProcessor) processNSFWTask(job ImageJob, detector *media.NSFWDetector) error {
+	if detector == nil || !detector.Enabled {
+		return fmt.Errorf("NSFW detector is not loaded")
+	}
+	if _, err := os.Stat(job.OriginalImagePath); err != nil {
+		return fmt.Errorf("failed to stat original file: %w", err)
+	}
+
+	// OpenCV cannot read RAW files, so they are scored from their preview
+	imagePath := job.OriginalImagePath
+	if media.IsRawImage(job.OriginalImagePath) {
+		previewPath, err := media.WriteRawPreviewToTemp(job.OriginalImagePath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(previewPath)
+		imagePath = previewPath
+	}
+
+	img := gocv.IMRead(imagePath, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to read image file for NSFW detection: %s", imagePath)
+	}
+	defer img.Close()
+
+	score, err := detector.Score(img)
+	if err != nil {
+		log.Printf("Worker: ERROR scoring %s for NSFW content: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	flagged := score >= ip.NSFWThreshold()
+	if err := ip.ImageRepo.UpdateNSFWScore(job.OriginalRelativePath, score, flagged); err != nil {
+		log.Printf("Worker: ERROR saving NSFW score for %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	if flagged {
+		log.Printf("Worker: Flagged %s as NSFW (score %.2f)", job.OriginalRelativePath, score)
+	}
+	return nil
+}
+
+// queueNSFWCheck queues a low priority NSFW check of an image
+func (ip *ImageProcessor) queueNSFWCheck(relPath string, modTime int64) bool {
+	return ip.QueueJob(ImageJob{
+		OriginalImagePath:    ip.Config.ResolvePath(relPath),
+		OriginalRelativePath: relPath,
+		ModTimeUnix:          modTime,
+		TaskType:             TaskNSFW,
+		Priority:             PriorityLow,
+	})
+}
+
+// BackfillNSFW queues NSFW checks of the images that have not been scored since they last
+// changed, e.g. those processed before NSFW detection was enabled. returns the number of
+// tasks queued.
+func (ip *ImageProcessor) BackfillNSFW() (int, error) {
+	if !ip.Config.NSFWEnabled {
+		return 0, nil
+	}
+	images, err := ip.ImageRepo.ListImagesMissingNSFWScore()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if ip.queueNSFWCheck(img.OriginalPath, img.LastModified) {
+			queued++
+		}
+	}
+	log.Printf("NSFW backfill: Queued NSFW checks for %d image(s)", queued)
+	return queued, nil
+}
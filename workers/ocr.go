@@ -0,0 +1,63 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/camden-git/mediasysbackend/media"
+)
+
+// processOCRTask reads the visible text of an image with tesseract and stores it, which also
+// adds it to the search index
+func (ip *ImageProcessor) processOCRTask(job ImageJob, ocrTool *media.OCRTool) error {
+	img, _, err := media.DecodeImageFile(job.OriginalImagePath)
+	if err != nil {
+		return fmt.Errorf("failed to decode image for OCR: %w", err)
+	}
+	text, err := ocrTool.ExtractText(img)
+	if err != nil {
+		log.Printf("Worker: ERROR reading text of %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	if err := ip.ImageRepo.UpdateOCRText(job.OriginalRelativePath, text); err != nil {
+		log.Printf("Worker: ERROR saving OCR text for %s: %v", job.OriginalRelativePath, err)
+		return err
+	}
+	log.Printf("Worker: Read %d character(s) of text from %s", len([]rune(text)), job.OriginalRelativePath)
+	return nil
+}
+
+// queueOCR queues a low priority OCR of an image
+func (ip *ImageProcessor) queueOCR(relPath string, modTime int64) bool {
+	return ip.QueueJob(ImageJob{
+		OriginalImagePath:    ip.Config.ResolvePath(relPath),
+		OriginalRelativePath: relPath,
+		ModTimeUnix:          modTime,
+		TaskType:             TaskOCR,
+		Priority:             PriorityLow,
+	})
+}
+
+// BackfillOCR queues OCR of the images that have not been read since they last changed,
+// e.g. those processed before OCR was enabled. returns the number of tasks queued.
+func (ip *ImageProcessor) BackfillOCR() (int, error) {
+	if !ip.Config.OCREnabled {
+		return 0, nil
+	}
+	images, err := ip.ImageRepo.ListImagesMissingOCR()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		if !ip.waitForLowLane() {
+			return queued, errProcessorStopping
+		}
+		if ip.queueOCR(img.OriginalPath, img.LastModified) {
+			queued++
+		}
+	}
+	log.Printf("OCR backfill: Queued OCR for %d image(s)", queued)
+	return queued, nil
+}
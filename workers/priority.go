@@ -0,0 +1,134 @@
+package workers
+
+import "log"
+
+// JobPriority selects the queue lane a job is dispatched from
+type JobPriority int
+
+const (
+	PriorityNormal JobPriority = iota // zero value, so jobs default to normal
+	PriorityHigh
+	PriorityLow
+)
+
+func (p JobPriority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// rank orders priorities so that higher values are dispatched first
+func (p JobPriority) rank() int {
+	switch p {
+	case PriorityHigh:
+		return 2
+	case PriorityLow:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// queueFor returns the lane for a priority
+func (ip *ImageProcessor) queueFor(p JobPriority) chan ImageJob {
+	switch p {
+	case PriorityHigh:
+		return ip.HighQueue
+	case PriorityLow:
+		return ip.LowQueue
+	default:
+		return ip.JobQueue
+	}
+}
+
+// nextJob blocks until a job is available and processing isn't paused, always preferring
+// higher priority lanes. returns false once the processor is stopping or quit is closed.
+func (ip *ImageProcessor) nextJob(quit <-chan struct{}) (ImageJob, bool) {
+	if !ip.waitWhilePaused(quit) {
+		return ImageJob{}, false
+	}
+	job, ok := ip.takeJob(quit)
+	if !ok {
+		return ImageJob{}, false
+	}
+	// processing may have been paused while this worker was waiting for the job
+	if !ip.waitWhilePaused(quit) {
+		select {
+		case <-ip.StopChan:
+			// the job is still tracked as queued, so SaveQueue keeps it
+		default:
+			// a retired worker hands the job back to its lane
+			select {
+			case ip.queueFor(job.Priority) <- job:
+			default:
+				log.Printf("WARNING: Could not requeue job %s (%s for %s) from a retired worker", job.ID, job.TaskType, job.OriginalRelativePath)
+			}
+		}
+		return ImageJob{}, false
+	}
+	return job, true
+}
+
+// waitWhilePaused blocks until processing is resumed. returns false once the processor is
+// stopping or quit is closed.
+func (ip *ImageProcessor) waitWhilePaused(quit <-chan struct{}) bool {
+	for {
+		ip.Mutex.Lock()
+		resume := ip.resume
+		ip.Mutex.Unlock()
+		if resume == nil {
+			return true
+		}
+		select {
+		case <-resume:
+		case <-ip.StopChan:
+			return false
+		case <-quit:
+			return false
+		}
+	}
+}
+
+// takeJob takes the next job off the queue, blocking until one is available
+func (ip *ImageProcessor) takeJob(quit <-chan struct{}) (ImageJob, bool) {
+	select {
+	case <-ip.StopChan:
+		return ImageJob{}, false
+	case <-quit:
+		return ImageJob{}, false
+	default:
+	}
+
+	select {
+	case job := <-ip.HighQueue:
+		return job, true
+	default:
+	}
+
+	select {
+	case job := <-ip.HighQueue:
+		return job, true
+	case job := <-ip.JobQueue:
+		return job, true
+	default:
+	}
+
+	// every lane is empty, take whatever arrives first
+	select {
+	case job := <-ip.HighQueue:
+		return job, true
+	case job := <-ip.JobQueue:
+		return job, true
+	case job := <-ip.LowQueue:
+		return job, true
+	case <-ip.StopChan:
+		return ImageJob{}, false
+	case <-quit:
+		return ImageJob{}, false
+	}
+}
@@ -0,0 +1,88 @@
+package workers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// SaveQueue writes every job that has not run yet (queued, or waiting for a retry) to path
+// so RestoreQueue can pick them up on the next start. call it after Stop. returns the
+// number of jobs saved; a stale file is removed when there is nothing to save.
+func (ip *ImageProcessor) SaveQueue(path string) (int, error) {
+	ip.Mutex.Lock()
+	var recs []*JobRecord
+	for _, rec := range ip.Jobs {
+		if rec.State == JobStateQueued || rec.State == JobStateRetrying {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].QueuedAt < recs[j].QueuedAt
+	})
+	jobs := make([]ImageJob, 0, len(recs))
+	for _, rec := range recs {
+		job := rec.job
+		if rec.State == JobStateRetrying {
+			job.Attempt++ // the attempt it was waiting for
+		}
+		jobs = append(jobs, job)
+	}
+	ip.Mutex.Unlock()
+
+	if len(jobs) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove stale queue state file %s: %w", path, err)
+		}
+		return 0, nil
+	}
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode queue state: %w", err)
+	}
+	// write to a temp file first so a crash mid-write never leaves a truncated state file
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write queue state file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("failed to move queue state file into place at %s: %w", path, err)
+	}
+	return len(jobs), nil
+}
+
+// RestoreQueue queues the jobs saved by SaveQueue and removes the state file.
+// a missing file is not an error. returns the number of jobs queued.
+func (ip *ImageProcessor) RestoreQueue(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read queue state file %s: %w", path, err)
+	}
+
+	var jobs []ImageJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return 0, fmt.Errorf("failed to decode queue state file %s: %w", path, err)
+	}
+
+	restored := 0
+	for _, job := range jobs {
+		job.ID = "" // job records are not persisted, so each restored job is tracked as a new one
+		if _, err := ip.enqueue(job, ""); err != nil {
+			log.Printf("Warning: could not restore task '%s' for %s: %v", job.TaskType, job.OriginalRelativePath, err)
+			continue
+		}
+		restored++
+	}
+
+	if err := os.Remove(path); err != nil {
+		return restored, fmt.Errorf("failed to remove queue state file %s: %w", path, err)
+	}
+	return restored, nil
+}
@@ -0,0 +1,178 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/models"
+)
+
+// retryDelay returns the exponential backoff before the given attempt (2 for the first retry)
+func (ip *ImageProcessor) retryDelay(nextAttempt int) time.Duration {
+	base := time.Duration(ip.Config.WorkerRetryBaseDelaySeconds) * time.Second
+	maxDelay := time.Duration(ip.Config.WorkerRetryMaxDelaySeconds) * time.Second
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := base
+	for i := 2; i < nextAttempt; i++ {
+		delay *= 2
+		if maxDelay > 0 && delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// scheduleRetryLocked puts a failed job into the retrying state and arms a timer that
+// queues its next attempt. returns false if the job has used all of its attempts.
+// ip.Mutex must be held.
+func (ip *ImageProcessor) scheduleRetryLocked(rec *JobRecord, taskErr error) bool {
+	if rec.job.Attempt >= ip.Config.WorkerMaxAttempts {
+		return false
+	}
+
+	nextAttempt := rec.job.Attempt + 1
+	delay := ip.retryDelay(nextAttempt)
+	nextAt := time.Now().Add(delay).Unix()
+
+	rec.State = JobStateRetrying
+	rec.Error = taskErr.Error()
+	rec.NextAttemptAt = &nextAt
+	rec.retryTimer = time.AfterFunc(delay, func() {
+		ip.queueRetry(rec.ID)
+	})
+
+	log.Printf("Worker: Task '%s' for %s failed (attempt %d/%d), retrying in %s: %v",
+		rec.TaskType, rec.job.OriginalRelativePath, rec.job.Attempt, ip.Config.WorkerMaxAttempts, delay, taskErr)
+	return true
+}
+
+// queueRetry pushes the next attempt of a retrying job onto the queue. the job still holds
+// its pending key, so no other copy of the task can have been queued in the meantime.
+func (ip *ImageProcessor) queueRetry(id string) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+
+	rec, ok := ip.Jobs[id]
+	if !ok || rec.State != JobStateRetrying {
+		return // cancelled or pruned while waiting
+	}
+	select {
+	case <-ip.StopChan:
+		return // shutting down, the job is saved with the rest of the queue
+	default:
+	}
+
+	job := rec.job
+	job.Attempt++
+
+	select {
+	case ip.queueFor(job.Priority) <- job:
+		rec.job = job
+		rec.Attempt = job.Attempt
+		rec.State = JobStateQueued
+		rec.NextAttemptAt = nil
+		rec.retryTimer = nil
+	default:
+		// queue is full; try again after the same delay without using up an attempt
+		delay := ip.retryDelay(job.Attempt)
+		nextAt := time.Now().Add(delay).Unix()
+		rec.NextAttemptAt = &nextAt
+		rec.retryTimer = time.AfterFunc(delay, func() {
+			ip.queueRetry(id)
+		})
+		log.Printf("WARNING: Image processing job queue full. Delaying retry of task '%s' for %s by %s", rec.TaskType, rec.job.OriginalRelativePath, delay)
+	}
+}
+
+// RetryErroredImages resets the attempt counters of every errored image task and queues
+// it again. tasks already waiting for an automatic retry are started immediately.
+// returns the number of tasks queued.
+func (ip *ImageProcessor) RetryErroredImages() (int, error) {
+	images, err := ip.ImageRepo.GetImagesWithErrors()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, img := range images {
+		for _, taskType := range erroredTaskTypes(img) {
+			statusColumn := taskStatusColumn(taskType)
+			if err := ip.ImageRepo.ResetTaskAttempts(img.OriginalPath, statusColumn); err != nil {
+				return queued, fmt.Errorf("failed to reset attempts of %s for %s: %w", taskType, img.OriginalPath, err)
+			}
+
+			job := ImageJob{
+				OriginalImagePath:    ip.Config.ResolvePath(img.OriginalPath),
+				OriginalRelativePath: img.OriginalPath,
+				ModTimeUnix:          img.LastModified,
+				TaskType:             taskType,
+			}
+			if ip.QueueJob(job) || ip.retryNow(job.pendingKey()) {
+				queued++
+			}
+		}
+	}
+	log.Printf("Queued %d errored task(s) for retry", queued)
+	return queued, nil
+}
+
+// retryNow skips the backoff of a retrying job with the given pending key
+func (ip *ImageProcessor) retryNow(pendingKey string) bool {
+	ip.Mutex.Lock()
+	id := ip.Pending[pendingKey]
+	rec, ok := ip.Jobs[id]
+	if !ok || rec.State != JobStateRetrying {
+		ip.Mutex.Unlock()
+		return false
+	}
+	if rec.retryTimer != nil {
+		rec.retryTimer.Stop()
+		rec.retryTimer = nil
+	}
+	rec.job.Attempt = 0 // a forced retry gets a fresh set of attempts
+	ip.Mutex.Unlock()
+
+	ip.queueRetry(id)
+	return true
+}
+
+// erroredTaskTypes lists the worker tasks of an image whose status is error
+func erroredTaskTypes(img models.Image) []string {
+	var tasks []string
+	if img.MediaType == database.MediaTypeDocument {
+		if img.ThumbnailStatus == database.StatusError {
+			tasks = append(tasks, TaskDocumentThumbnail)
+		}
+		return tasks
+	}
+	if img.MediaType == database.MediaTypeVideo {
+		if img.ThumbnailStatus == database.StatusError {
+			tasks = append(tasks, TaskVideoThumbnail)
+		}
+		if img.TranscodeStatus == database.StatusError {
+			tasks = append(tasks, TaskVideoTranscode)
+		}
+		if img.StreamStatus == database.StatusError {
+			tasks = append(tasks, TaskVideoStream)
+		}
+		return tasks
+	}
+	if img.ThumbnailStatus == database.StatusError {
+		tasks = append(tasks, TaskThumbnail)
+	}
+	if img.MetadataStatus == database.StatusError {
+		tasks = append(tasks, TaskMetadata)
+	}
+	if img.DetectionStatus == database.StatusError {
+		tasks = append(tasks, TaskDetection)
+	}
+	return tasks
+}
@@ -0,0 +1,243 @@
+package workers
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrScheduledTaskNotFound = errors.New("scheduled task not found")
+	ErrScheduledTaskRunning  = errors.New("scheduled task is already running")
+	ErrSchedulerStopped      = errors.New("scheduler is stopped")
+)
+
+// ScheduledTaskFunc runs a maintenance task and returns the number of items it handled
+type ScheduledTaskFunc func() (int, error)
+
+// ScheduledTaskStatus is the schedule and last run of a periodic task
+type ScheduledTaskStatus struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	IntervalMinutes int    `json:"interval_minutes"` // 0 when disabled
+	Enabled         bool   `json:"enabled"`
+	Running         bool   `json:"running"`
+	NextRunAt       *int64 `json:"next_run_at,omitempty"`
+	LastStartedAt   *int64 `json:"last_started_at,omitempty"`
+	LastFinishedAt  *int64 `json:"last_finished_at,omitempty"`
+	LastDurationMs  *int64 `json:"last_duration_ms,omitempty"`
+	LastItems       *int   `json:"last_items,omitempty"` // e.g. tasks queued or records removed
+	LastError       string `json:"last_error,omitempty"`
+	RunCount        int    `json:"run_count"`
+}
+
+type scheduledTask struct {
+	status   ScheduledTaskStatus
+	run      ScheduledTaskFunc
+	interval time.Duration
+	timer    *time.Timer
+}
+
+// Scheduler runs registered maintenance tasks periodically. the interval counts from the end
+// of the previous run, so a slow run never overlaps with the next one.
+type Scheduler struct {
+	mu      sync.Mutex
+	tasks   []*scheduledTask // in registration order
+	started bool
+	stopped bool
+	paused  bool
+	wg      sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Register adds a task. it stays disabled until SetInterval gives it an interval.
+func (s *Scheduler) Register(name, description string, run ScheduledTaskFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &scheduledTask{
+		status: ScheduledTaskStatus{Name: name, Description: description},
+		run:    run,
+	})
+}
+
+func (s *Scheduler) findLocked(name string) *scheduledTask {
+	for _, task := range s.tasks {
+		if task.status.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// Start arms the timers of every enabled task
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+	for _, task := range s.tasks {
+		if !task.status.Running {
+			s.armLocked(task)
+		}
+	}
+	log.Printf("Scheduler: Started with %d task(s)", len(s.tasks))
+}
+
+// Stop disarms every timer. tasks already running are left to finish; use Wait to wait for them.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for _, task := range s.tasks {
+		s.disarmLocked(task)
+	}
+}
+
+// SetPaused holds or resumes the periodic runs, e.g. during maintenance. tasks already
+// running finish and RunNow still works; resuming schedules every task's next run from now.
+func (s *Scheduler) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == paused {
+		return
+	}
+	s.paused = paused
+	for _, task := range s.tasks {
+		if !task.status.Running {
+			s.armLocked(task)
+		}
+	}
+}
+
+// Wait blocks until no task is running
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// SetInterval changes how often a task runs. 0 disables it. the next run is rescheduled
+// from now, unless the task is running, in which case it applies after that run.
+func (s *Scheduler) SetInterval(name string, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.findLocked(name)
+	if task == nil {
+		return ErrScheduledTaskNotFound
+	}
+	if interval < 0 {
+		interval = 0
+	}
+	task.interval = interval
+	task.status.IntervalMinutes = int(interval / time.Minute)
+	task.status.Enabled = interval > 0
+	if !task.status.Running {
+		s.armLocked(task)
+	}
+	return nil
+}
+
+// armLocked schedules the next run of a task, or clears it if the task is disabled.
+// s.mu must be held.
+func (s *Scheduler) armLocked(task *scheduledTask) {
+	s.disarmLocked(task)
+	if !s.started || s.stopped || s.paused || task.interval <= 0 {
+		return
+	}
+	next := time.Now().Add(task.interval).Unix()
+	task.status.NextRunAt = &next
+	task.timer = time.AfterFunc(task.interval, func() {
+		if _, err := s.RunNow(task.status.Name); err != nil && !errors.Is(err, ErrScheduledTaskRunning) && !errors.Is(err, ErrSchedulerStopped) {
+			log.Printf("Scheduler: Could not start task '%s': %v", task.status.Name, err)
+		}
+	})
+}
+
+// disarmLocked stops the pending timer of a task. s.mu must be held.
+func (s *Scheduler) disarmLocked(task *scheduledTask) {
+	if task.timer != nil {
+		task.timer.Stop()
+		task.timer = nil
+	}
+	task.status.NextRunAt = nil
+}
+
+// RunNow starts a task in the background right away, whatever its schedule
+func (s *Scheduler) RunNow(name string) (ScheduledTaskStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.findLocked(name)
+	if task == nil {
+		return ScheduledTaskStatus{}, ErrScheduledTaskNotFound
+	}
+	if s.stopped {
+		return task.status, ErrSchedulerStopped
+	}
+	if task.status.Running {
+		return task.status, ErrScheduledTaskRunning
+	}
+
+	s.disarmLocked(task)
+	started := time.Now()
+	startedUnix := started.Unix()
+	task.status.Running = true
+	task.status.LastStartedAt = &startedUnix
+
+	s.wg.Add(1)
+	go s.execute(task, started)
+	return task.status, nil
+}
+
+// execute runs a task and records the outcome, then schedules its next run
+func (s *Scheduler) execute(task *scheduledTask, started time.Time) {
+	defer s.wg.Done()
+	log.Printf("Scheduler: Running task '%s'", task.status.Name)
+
+	items, err := task.run()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now()
+	finishedUnix := finished.Unix()
+	duration := finished.Sub(started).Milliseconds()
+	task.status.Running = false
+	task.status.RunCount++
+	task.status.LastFinishedAt = &finishedUnix
+	task.status.LastDurationMs = &duration
+	task.status.LastItems = &items
+	task.status.LastError = ""
+	if err != nil {
+		task.status.LastError = err.Error()
+		log.Printf("Scheduler: Task '%s' failed after %s: %v", task.status.Name, finished.Sub(started), err)
+	} else {
+		log.Printf("Scheduler: Task '%s' finished in %s (%d item(s))", task.status.Name, finished.Sub(started), items)
+	}
+	s.armLocked(task)
+}
+
+// List returns the status of every task, in registration order
+func (s *Scheduler) List() []ScheduledTaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]ScheduledTaskStatus, len(s.tasks))
+	for i, task := range s.tasks {
+		statuses[i] = task.status
+	}
+	return statuses
+}
+
+// Get returns the status of a single task
+func (s *Scheduler) Get(name string) (ScheduledTaskStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.findLocked(name)
+	if task == nil {
+		return ScheduledTaskStatus{}, ErrScheduledTaskNotFound
+	}
+	return task.status, nil
+}
@@ -0,0 +1,92 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/camden-git/mediasysbackend/database"
+	"github.com/camden-git/mediasysbackend/media"
+)
+
+// scheduleStream queues HLS packaging of a video once it was probed, if it is long enough to
+// be streamed and its stream isn't up to date. the stream of a video that no longer is, e.g.
+// after it was trimmed, is deleted.
+func (ip *ImageProcessor) scheduleStream(job ImageJob, store media.Store) {
+	video, err := ip.ImageRepo.GetByPath(job.OriginalRelativePath)
+	if err != nil {
+		log.Printf("Worker: Failed to load %s to schedule its stream: %v", job.OriginalRelativePath, err)
+		return
+	}
+	required := video.Duration != nil && *video.Duration >= float64(ip.Config.VideoHLSMinDuration)
+	if required && video.StreamStatus == database.StatusDone && video.StreamProcessedAt != nil && *video.StreamProcessedAt >= job.ModTimeUnix {
+		return
+	}
+
+	dropped, err := ip.ImageRepo.SetStreamRequired(job.OriginalRelativePath, required)
+	if err != nil {
+		log.Printf("Worker: Failed to schedule the stream of %s: %v", job.OriginalRelativePath, err)
+		return
+	}
+	deleteStreamFiles(store, job.OriginalRelativePath, dropped)
+	if required {
+		ip.QueueJob(ImageJob{
+			OriginalImagePath:    job.OriginalImagePath,
+			OriginalRelativePath: job.OriginalRelativePath,
+			ModTimeUnix:          job.ModTimeUnix,
+			TaskType:             TaskVideoStream,
+			Priority:             PriorityLow,
+		})
+	}
+}
+
+// processVideoStreamTask packages a video for HLS streaming and updates DB, replacing its
+// previous stream
+func (ip *ImageProcessor) processVideoStreamTask(job ImageJob, videoTool *media.VideoTool, processor *media.Processor, store media.Store) error {
+	var taskErr error
+	var files, previous []string
+
+	video, err := ip.ImageRepo.GetByPath(job.OriginalRelativePath)
+	if err != nil {
+		taskErr = fmt.Errorf("failed to load video record: %w", err)
+		log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+	} else if tmpDir, err := os.MkdirTemp("", "mediasys-stream-*"); err != nil {
+		taskErr = fmt.Errorf("failed to create temp dir for HLS packaging: %w", err)
+		log.Printf("Worker: ERROR %v", taskErr)
+	} else {
+		defer os.RemoveAll(tmpDir)
+		previous = video.StreamFiles
+
+		width, height := 0, 0
+		if video.Width != nil && video.Height != nil {
+			width, height = *video.Width, *video.Height
+		}
+		log.Printf("Worker: Packaging video %s for HLS streaming", job.OriginalRelativePath)
+		if err := videoTool.PackageHLS(job.OriginalImagePath, tmpDir, width, height, ip.Config.VideoHLSHeights); err != nil {
+			taskErr = err
+			log.Printf("Worker: ERROR %v", taskErr)
+		} else if files, taskErr = processor.SaveVideoStream(tmpDir, job.OriginalRelativePath); taskErr != nil {
+			log.Printf("Worker: ERROR %v for %s", taskErr, job.OriginalRelativePath)
+		} else {
+			log.Printf("Worker: Packaged video %s for HLS streaming", job.OriginalRelativePath)
+		}
+	}
+
+	dbErr := ip.ImageRepo.UpdateStreamResult(job.OriginalRelativePath, files, job.ModTimeUnix, taskErr)
+	if dbErr != nil {
+		log.Printf("Worker: ERROR updating stream DB result for %s: %v", job.OriginalRelativePath, dbErr)
+		// the record still points at the previous stream, so the new one is dropped instead
+		previous = files
+	}
+	deleteStreamFiles(store, job.OriginalRelativePath, previous)
+	return taskErrOrDBErr(taskErr, dbErr)
+}
+
+// deleteStreamFiles deletes the playlists and segments of a stream that was replaced or dropped
+func deleteStreamFiles(store media.Store, relPath string, files []string) {
+	for _, file := range files {
+		if err := store.Delete(file); err != nil {
+			log.Printf("Worker: Failed to delete stream file %s of %s: %v", file, relPath, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package workers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// takeoutAlbumMetadata is the metadata.json of an album folder in a Google Takeout export
+type takeoutAlbumMetadata struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// takeoutSidecar is the JSON file Google Takeout writes next to each photo or video. plain
+// folders exported by other tools can use the same format.
+type takeoutSidecar struct {
+	Title          string `json:"title"` // name of the file it describes
+	Description    string `json:"description"`
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"` // Unix timestamp, as a string
+	} `json:"photoTakenTime"`
+	GeoData     takeoutGeoData `json:"geoData"`
+	GeoDataExif takeoutGeoData `json:"geoDataExif"`
+	People      []struct {
+		Name string `json:"name"`
+	} `json:"people"`
+}
+
+type takeoutGeoData struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// takenAt returns the capture time, if the sidecar has one
+func (s *takeoutSidecar) takenAt() *int64 {
+	ts, err := strconv.ParseInt(s.PhotoTakenTime.Timestamp, 10, 64)
+	if err != nil || ts <= 0 {
+		return nil
+	}
+	return &ts
+}
+
+// position returns the GPS position, preferring the one edited in Google Photos over the one
+// from the file. takeout writes 0,0 when there is none.
+func (s *takeoutSidecar) position() (lat, lon, alt *float64) {
+	for _, geo := range []takeoutGeoData{s.GeoData, s.GeoDataExif} {
+		if geo.Latitude != 0 || geo.Longitude != 0 {
+			return &geo.Latitude, &geo.Longitude, &geo.Altitude
+		}
+	}
+	return nil, nil, nil
+}
+
+// peopleNames returns the distinct names of the people tagged in the file
+func (s *takeoutSidecar) peopleNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, person := range s.People {
+		name := strings.Join(strings.Fields(person.Name), " ")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// names of the year folders takeout puts every photo in, next to the album folders
+var takeoutYearFolder = regexp.MustCompile(`^Photos from \d{4}$`)
+
+// duplicate files are numbered before the extension, e.g. IMG_1(1).jpg, while their sidecar
+// is numbered after it, e.g. IMG_1.jpg(1).json
+var takeoutDuplicateSuffix = regexp.MustCompile(`^(.*)(\(\d+\))(\.[^.]*)$`)
+
+// takeoutSidecars finds the sidecars of the files in a folder. takeout names them after the
+// file plus .json or .supplemental-metadata.json, but cuts long names short, so sidecars are
+// matched by the file name they hold too.
+type takeoutSidecars struct {
+	byFile  map[string]*takeoutSidecar // by sidecar file name
+	byTitle map[string]*takeoutSidecar // by the name of the file described
+	byStem  map[string]*takeoutSidecar // by that name without extension, e.g. for live photo videos
+}
+
+// readTakeoutSidecars reads the sidecars among the files of a folder. files that aren't
+// sidecars are ignored.
+func readTakeoutSidecars(dir string, fileNames []string) *takeoutSidecars {
+	sidecars := &takeoutSidecars{
+		byFile:  make(map[string]*takeoutSidecar),
+		byTitle: make(map[string]*takeoutSidecar),
+		byStem:  make(map[string]*takeoutSidecar),
+	}
+	for _, name := range fileNames {
+		if !strings.EqualFold(filepath.Ext(name), ".json") || name == "metadata.json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var sidecar takeoutSidecar
+		if err := json.Unmarshal(data, &sidecar); err != nil || sidecar.Title == "" {
+			continue
+		}
+		sidecars.byFile[name] = &sidecar
+		if _, ok := sidecars.byTitle[sidecar.Title]; !ok {
+			sidecars.byTitle[sidecar.Title] = &sidecar
+		}
+		stem := strings.TrimSuffix(sidecar.Title, filepath.Ext(sidecar.Title))
+		if _, ok := sidecars.byStem[stem]; !ok {
+			sidecars.byStem[stem] = &sidecar
+		}
+	}
+	return sidecars
+}
+
+// find returns the sidecar of a file, or nil if it has none
+func (s *takeoutSidecars) find(fileName string) *takeoutSidecar {
+	candidates := []string{fileName + ".json", fileName + ".supplemental-metadata.json"}
+	if m := takeoutDuplicateSuffix.FindStringSubmatch(fileName); m != nil {
+		candidates = append(candidates, m[1]+m[3]+m[2]+".json", m[1]+m[3]+".supplemental-metadata"+m[2]+".json")
+	}
+	for _, candidate := range candidates {
+		if sidecar, ok := s.byFile[candidate]; ok {
+			return sidecar
+		}
+	}
+	if sidecar, ok := s.byTitle[fileName]; ok {
+		return sidecar
+	}
+	// edited copies share the sidecar of the original
+	ext := filepath.Ext(fileName)
+	stem := strings.TrimSuffix(fileName, ext)
+	if original := strings.TrimSuffix(stem, "-edited"); original != stem {
+		if sidecar, ok := s.byTitle[original+ext]; ok {
+			return sidecar
+		}
+		stem = original
+	}
+	return s.byStem[stem]
+}
+
+// readTakeoutAlbumMetadata reads the metadata.json of an album folder. year folders and
+// folders without one return nil.
+func readTakeoutAlbumMetadata(dir string) *takeoutAlbumMetadata {
+	if takeoutYearFolder.MatchString(filepath.Base(dir)) {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil
+	}
+	var meta takeoutAlbumMetadata
+	if err := json.Unmarshal(data, &meta); err != nil || strings.TrimSpace(meta.Title) == "" {
+		return nil
+	}
+	return &meta
+}
+
+// takeoutPhotosRoot returns the folder holding the albums of an export: the Google Photos
+// folder of a Takeout archive, or the source itself for a plain folder
+func takeoutPhotosRoot(source string) string {
+	for _, candidate := range []string{
+		filepath.Join(source, "Takeout", "Google Photos"),
+		filepath.Join(source, "Google Photos"),
+	} {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
+		}
+	}
+	return source
+}
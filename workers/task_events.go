@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/camden-git/mediasysbackend/models"
+	"github.com/camden-git/mediasysbackend/realtime"
+)
+
+// SetFileInfoRenderer sets how images are rendered into the "done" events of their thumbnail
+// tasks, e.g. with the signed URLs of the new thumbnails, so clients can swap a placeholder
+// for the thumbnail without listing the folder again. without one the events carry no image.
+func (ip *ImageProcessor) SetFileInfoRenderer(render func(img *models.Image) interface{}) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.renderFileInfo = render
+}
+
+// SetImageChangedListener sets a function told the path of every image or video whose task
+// finished, successfully or not, e.g. to drop cached listings of its folder
+func (ip *ImageProcessor) SetImageChangedListener(listener func(relPath string)) {
+	ip.Mutex.Lock()
+	defer ip.Mutex.Unlock()
+	ip.imageChanged = listener
+}
+
+// broadcastTaskFinished sends the outcome of a task as a "task" event: done, retrying with
+// the time of the next attempt, or error once the task has no attempts left. the listener
+// from SetImageChangedListener is told first.
+func (ip *ImageProcessor) broadcastTaskFinished(job ImageJob, taskErr error, retrying bool) {
+	if !job.isAlbumTask() {
+		ip.Mutex.Lock()
+		listener := ip.imageChanged
+		ip.Mutex.Unlock()
+		if listener != nil {
+			listener(job.OriginalRelativePath)
+		}
+	}
+	if ip.Hub == nil {
+		return
+	}
+	event := realtime.Event{
+		Type:      "task",
+		Path:      job.OriginalRelativePath,
+		Task:      job.TaskType,
+		Extra:     taskEventExtra(job),
+		Timestamp: time.Now().Unix(),
+	}
+	switch {
+	case taskErr == nil:
+		event.Status = "done"
+		if job.TaskType == TaskThumbnail || job.TaskType == TaskVideoThumbnail || job.TaskType == TaskDocumentThumbnail {
+			if file := ip.renderedFileInfo(job.OriginalRelativePath); file != nil {
+				event.Extra["file"] = file
+			}
+		}
+	case retrying:
+		event.Status = "retrying"
+		event.Error = taskErr.Error()
+		ip.Mutex.Lock()
+		if rec, ok := ip.Jobs[job.ID]; ok && rec.NextAttemptAt != nil {
+			event.Extra["next_attempt_at"] = *rec.NextAttemptAt
+		}
+		ip.Mutex.Unlock()
+	default:
+		event.Status = "error"
+		event.Error = taskErr.Error()
+	}
+	ip.Hub.Broadcast(event)
+}
+
+// taskEventExtra returns the extra fields of the events of a job
+func taskEventExtra(job ImageJob) map[string]interface{} {
+	extra := map[string]interface{}{"job_id": job.ID, "attempt": job.Attempt}
+	if job.isAlbumTask() {
+		extra["album_id"] = uint(job.AlbumID)
+	}
+	return extra
+}
+
+// renderedFileInfo renders the image at relPath with the renderer from SetFileInfoRenderer,
+// or returns nil if there is none or the image can't be loaded
+func (ip *ImageProcessor) renderedFileInfo(relPath string) interface{} {
+	ip.Mutex.Lock()
+	render := ip.renderFileInfo
+	ip.Mutex.Unlock()
+	if render == nil {
+		return nil
+	}
+	img, err := ip.ImageRepo.GetByPath(relPath)
+	if err != nil {
+		log.Printf("Worker: Failed to load %s for its task event: %v", relPath, err)
+		return nil
+	}
+	return render(img)
+}